@@ -0,0 +1,39 @@
+// Command migrate migrates the database and runs the startup backfills.
+// The server does the same on start, but serverless instances do not, so
+// run this when deploying to Vercel.
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"github.com/SebbieMzingKe/customer-order-api/internal/secrets"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	if _, err := secrets.LoadFromEnv(context.Background()); err != nil {
+		log.Fatal("failed to load secrets: ", err)
+	}
+
+	keyring, err := pii.KeyringFromEnv()
+	if err != nil {
+		log.Fatal("invalid pii encryption keys: ", err)
+	}
+	pii.SetKeyring(keyring)
+
+	db, err := app.OpenDatabase(app.DatabaseConfigFromEnv())
+	if err != nil {
+		log.Fatal("failed to connect to database: ", err)
+	}
+	if err := app.BootstrapDatabase(db); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("database is up to date")
+}
@@ -0,0 +1,54 @@
+// Command pii-backfill encrypts customer phone numbers and emails still in
+// plain text or sealed with a retired key, and refreshes their blind
+// indexes. The server does the same on start; run this to do it ahead of a
+// deploy, or with -all after changing PII_HASH_KEY.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"github.com/SebbieMzingKe/customer-order-api/internal/secrets"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	all := flag.Bool("all", false, "rewrite every customer, not only those that need it")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found")
+	}
+
+	if _, err := secrets.LoadFromEnv(context.Background()); err != nil {
+		log.Fatal("failed to load secrets: ", err)
+	}
+
+	keyring, err := pii.KeyringFromEnv()
+	if err != nil {
+		log.Fatal("invalid pii encryption keys: ", err)
+	}
+	if keyring == nil {
+		log.Fatal("PII_ENCRYPTION_KEYS is not set")
+	}
+	pii.SetKeyring(keyring)
+
+	db, err := app.OpenDatabase(app.DatabaseConfigFromEnv())
+	if err != nil {
+		log.Fatal("failed to connect to database: ", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		log.Fatal("failed to migrate database: ", err)
+	}
+
+	n, err := services.BackfillCustomerPII(context.Background(), db, *all)
+	if err != nil {
+		log.Fatal("failed to backfill customer pii: ", err)
+	}
+	log.Printf("rewrote %d customers under key %s", n, keyring.Primary())
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+)
+
+// runMigrations does what cmd/migrate does
+func runMigrations(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("run-migrations", flag.ExitOnError)
+	flags.Parse(args)
+
+	container, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+
+	if err := app.BootstrapDatabase(db.WithContext(ctx)); err != nil {
+		return err
+	}
+	fmt.Println("database is up to date")
+	return nil
+}
+
+// reindex recomputes the customer blind indexes, which lookups by phone and
+// email go through, and the daily order stats of the last days
+func reindex(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	statsDays := flags.Int("stats-days", 7, "days of daily order stats to recompute, 0 for none")
+	flags.Parse(args)
+
+	container, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+
+	customers, err := services.BackfillCustomerPII(ctx, db, true)
+	if err != nil {
+		return fmt.Errorf("failed to rebuild customer indexes: %w", err)
+	}
+	fmt.Printf("rebuilt the indexes of %d customers\n", customers)
+
+	if *statsDays > 0 {
+		now := time.Now()
+		reports := services.NewReportService(db, container.ProvideConfig().ReportLocation)
+		if err := reports.RefreshDailyStats(ctx, now.AddDate(0, 0, -*statsDays), now); err != nil {
+			return fmt.Errorf("failed to refresh daily order stats: %w", err)
+		}
+		fmt.Printf("recomputed %d days of order stats\n", *statsDays+1)
+	}
+	return nil
+}
+
+// verify runs the server's startup checks without migrating, so it can
+// gate a deploy before traffic moves. It fails when any check does.
+func verify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	flags.Parse(args)
+
+	container := app.NewContainer().ForServerless()
+	defer container.Close()
+
+	report := container.Verify(ctx)
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, check := range report.Checks {
+			fmt.Printf("%-4s  %-32s %s\n", check.Status, check.Name, check.Message)
+		}
+	}
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("%d checks failed", len(failed))
+	}
+	return nil
+}
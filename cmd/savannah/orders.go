@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/pkg/client"
+	"gorm.io/gorm"
+)
+
+var orderColumns = []string{"id", "customer_id", "item", "quantity", "amount", "net_amount", "tax_amount", "gross_amount", "status", "priority", "time", "created_at"}
+
+// exportOrders writes live orders as CSV. With an API URL
+// and key it pages through GET /api/v1/orders instead of reading the
+// database, so it also works without database access.
+func exportOrders(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export-orders", flag.ExitOnError)
+	apiURL := flags.String("api", os.Getenv("SAVANNAH_API_URL"), "API to export from instead of the database, e.g. https://api.example.com")
+	apiKey := flags.String("api-key", os.Getenv("SAVANNAH_API_KEY"), "API key to call the API with")
+	customerID := flags.Uint("customer", 0, "only export this customer's orders")
+	output := flags.String("o", "", "file to write, standard output if empty")
+	flags.Parse(args)
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	w := csv.NewWriter(out)
+	if err := w.Write(orderColumns); err != nil {
+		return err
+	}
+
+	var exported int
+	write := func(order models.Order) error {
+		exported++
+		return w.Write(orderRow(order))
+	}
+
+	var err error
+	if *apiURL != "" {
+		if *apiKey == "" {
+			return errors.New("-api-key is required with -api")
+		}
+		err = exportOrdersFromAPI(ctx, client.New(*apiURL, client.WithAPIKey(*apiKey)), *customerID, write)
+	} else {
+		err = exportOrdersFromDatabase(ctx, *customerID, write)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d orders\n", exported)
+	return nil
+}
+
+func exportOrdersFromDatabase(ctx context.Context, customerID uint, write func(models.Order) error) error {
+	container, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+
+	query := db.WithContext(ctx).Order("id ASC")
+	if customerID != 0 {
+		query = query.Where("customer_id = ?", customerID)
+	}
+
+	var orders []models.Order
+	return query.FindInBatches(&orders, 500, func(_ *gorm.DB, _ int) error {
+		for _, order := range orders {
+			if err := write(order); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+func exportOrdersFromAPI(ctx context.Context, api *client.Client, customerID uint, write func(models.Order) error) error {
+	opts := client.ListOrdersOptions{ListOptions: client.ListOptions{Limit: 100}, CustomerID: customerID}
+	for order, err := range api.AllOrders(ctx, opts) {
+		if err != nil {
+			return err
+		}
+		if err := write(order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orderRow(order models.Order) []string {
+	return []string{
+		strconv.FormatUint(uint64(order.ID), 10),
+		strconv.FormatUint(uint64(order.CustomerID), 10),
+		order.Item,
+		strconv.Itoa(order.Quantity),
+		order.Amount.String(),
+		order.NetAmount.String(),
+		order.TaxAmount.String(),
+		order.GrossAmount.String(),
+		order.Status,
+		order.Priority,
+		order.Time.UTC().Format(time.RFC3339),
+		order.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
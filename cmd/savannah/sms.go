@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+)
+
+// sendTestSMS sends a text the way the server would, to check the provider
+// credentials and sender id after changing them
+func sendTestSMS(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("send-test-sms", flag.ExitOnError)
+	to := flags.String("to", "", "phone number to text, e.g. +254740827150")
+	message := flags.String("message", "test message from savannah", "text to send")
+	flags.Parse(args)
+
+	if *to == "" {
+		return errors.New("-to is required")
+	}
+
+	container := app.NewContainer().ForServerless()
+	defer container.Close()
+
+	sms, err := container.ProvideSMS()
+	if err != nil {
+		return err
+	}
+	if err := sms.SendSMS(ctx, *to, *message); err != nil {
+		return fmt.Errorf("failed to send sms: %w", err)
+	}
+	fmt.Printf("sent to %s\n", *to)
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/authz"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+)
+
+// createUser gives a user a role. Users sign in through the identity
+// provider, so there is no password to set; until they have a role of
+// their own they are plain users.
+func createUser(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create-user", flag.ExitOnError)
+	email := flags.String("email", "", "email the user signs in with")
+	role := flags.String("role", authz.RoleUser, "role to give the user, e.g. admin")
+	flags.Parse(args)
+
+	if *email == "" {
+		return errors.New("-email is required")
+	}
+
+	container, db, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer container.Close()
+
+	assignment, err := authz.NewStore(db, 0).AssignRole(ctx, *email, *role, actor())
+	if err != nil {
+		return err
+	}
+	services.NewAuditLogger(db).Record(models.AuditEvent{
+		Type:    models.AuditRoleAssigned,
+		Actor:   actor(),
+		Details: fmt.Sprintf("email=%s role=%s", assignment.Email, assignment.Role),
+	})
+
+	fmt.Printf("%s has role %s\n", assignment.Email, assignment.Role)
+	return nil
+}
+
+// rotateJWTKey prints a new JWT_SECRET to put wherever the server reads it
+// from. Tokens signed with the old secret stop working as soon as the
+// server has the new one; -revoke-sessions also ends their sessions now.
+func rotateJWTKey(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("rotate-jwt-key", flag.ExitOnError)
+	revoke := flags.Bool("revoke-sessions", false, "end every open session")
+	flags.Parse(args)
+
+	secret := make([]byte, 48)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	if *revoke {
+		container, db, err := openDatabase()
+		if err != nil {
+			return err
+		}
+		defer container.Close()
+
+		revoked, err := services.NewSessionStore(db).RevokeAll(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+		services.NewAuditLogger(db).Record(models.AuditEvent{
+			Type:    models.AuditJWTKeyRotated,
+			Actor:   actor(),
+			Details: fmt.Sprintf("sessions_revoked=%d", revoked),
+		})
+		fmt.Printf("revoked %d sessions\n", revoked)
+	}
+
+	fmt.Println("set this in the environment or the secret manager and restart or refresh the server:")
+	fmt.Printf("JWT_SECRET=%s\n", base64.RawURLEncoding.EncodeToString(secret))
+	return nil
+}
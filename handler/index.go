@@ -1,94 +1,82 @@
 package handler
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strings"
+	"sync/atomic"
+	"time"
 
-	"github.com/SebbieMzingKe/customer-order-api/internal/handlers"
-	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
-	"github.com/SebbieMzingKe/customer-order-api/internal/services"
-	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-var router *gin.Engine
-
-func init() {
-
-	dsn := os.Getenv("DATABASE_URL")
-	jwt := os.Getenv("JWT_SECRET")
-	fmt.Println("jwt:", jwt)
-	fmt.Println("DATABASE_URL:", dsn)
-
-	var err error
+// container outlives invocations, so a warm instance reuses its database
+// connection and router. Nothing connects until the first request, and the
+// schema is migrated at deploy time rather than on every cold start.
+var container = app.NewContainer().ForServerless()
+
+var (
+	// loadedAt is when the instance loaded the package, the start of its
+	// cold start
+	loadedAt = time.Now()
+	// warm is set once the instance has served its first request
+	warm atomic.Bool
+)
 
-	dsn = os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		panic("database url ennvironment variable is not set")
+func Handler(w http.ResponseWriter, r *http.Request) {
+	// DATABASE_URL may be loaded from the secret manager on first use
+	if os.Getenv("DATABASE_URL") == "" && os.Getenv("SECRETS_PROVIDER") == "" {
+		unavailable(w, "database url environment variable is not set")
+		return
 	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	router, err := container.Router()
 	if err != nil {
-
-		panic("failed to connect to database: " + err.Error())
+		// not cached, the next invocation tries again
+		log.Printf("failed to start: %v", err)
+		unavailable(w, "service is starting, try again")
+		return
 	}
 
-	if err := db.AutoMigrate(&models.Customer{}, &models.Order{}); err != nil {
-		panic("failed to migrate database: " + err.Error())
+	// serverless instances run no jobs, so rotated secrets are picked up
+	// here instead
+	if deps, err := container.ProvideDeps(); err == nil && deps.Secrets != nil {
+		if err := deps.Secrets.RefreshIfStale(r.Context()); err != nil {
+			log.Printf("failed to refresh secrets: %v", err)
+		}
 	}
 
-	smsService := services.NewSMSService(
-		os.Getenv("AFRICASTALKING_USERNAME"),
-		os.Getenv("AFRICASTALKING_API_KEY"),
-		os.Getenv("AFRICASTALKING_SENDER_ID"),
-	)
-
-	router = gin.Default()
-
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
-
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "welcome to customer order api"})
-	})
-
-	authHandler := handlers.NewAuthHandler()
-	auth := router.Group("/auth")
-	{
-		auth.GET("/login", authHandler.Login)
-		auth.GET("/callback", authHandler.Callback)
-		auth.GET("/userinfo", middleware.AuthMiddleware(), authHandler.UserInfo)
+	if warm.CompareAndSwap(false, true) {
+		timing := serverTiming(time.Since(loadedAt), container.StartupTimings())
+		log.Printf("cold start of %s: %s", buildinfo.Get(), timing)
+		w.Header().Set("Server-Timing", timing)
 	}
+	router.ServeHTTP(w, r)
+}
 
-	api := router.Group("/api/v1")
-	api.Use(middleware.AuthMiddleware())
-	{
-		customers := api.Group("/customers")
-		{
-			customerHandler := handlers.NewCustomerHandler(db)
-			customers.POST("", customerHandler.CreateCustomer)
-			customers.GET("", customerHandler.GetCustomers)
-			customers.GET("/:id", customerHandler.GetCustomer)
-			customers.PUT("/:id", customerHandler.UpdateCustomer)
-			customers.DELETE("/:id", customerHandler.DeleteCustomer)
-		}
-
-		orders := api.Group("/orders")
-		{
-			orderHandler := handlers.NewOrderHandler(db, smsService)
-			orders.POST("", orderHandler.CreateOrder)
-			orders.GET("", orderHandler.GetOrders)
-			orders.GET("/:id", orderHandler.GetOrder)
-			orders.PUT("/:id", orderHandler.UpdateOrder)
-			orders.DELETE("/:id", orderHandler.DeleteOrder)
-		}
+// serverTiming formats the cold start as a Server-Timing header, so it
+// shows in browser dev tools and can be read off sampled responses
+func serverTiming(total time.Duration, phases []app.StartupPhase) string {
+	metrics := []string{fmt.Sprintf("cold-start;dur=%s", millis(total))}
+	for _, phase := range phases {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%s", phase.Name, millis(phase.Duration)))
 	}
+	return strings.Join(metrics, ", ")
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	router.ServeHTTP(w, r)
+func millis(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d)/float64(time.Millisecond))
+}
+
+func unavailable(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(models.ErrorEnvelope{
+		Error: models.ErrorBody{Code: "unavailable", Message: message},
+	})
 }
@@ -0,0 +1,363 @@
+package app
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/authz"
+	"github.com/SebbieMzingKe/customer-order-api/internal/features"
+	"github.com/SebbieMzingKe/customer-order-api/internal/jobs"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/secrets"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/validation"
+	"gorm.io/gorm"
+)
+
+// Config holds the settings that shape the router
+type Config struct {
+	PublicBaseURL  string
+	TrackingSecret string
+	TrackingTTL    time.Duration
+	// StatementLinkTTL is how long statement links texted to customers work
+	StatementLinkTTL time.Duration
+	AdminPhones      []string
+	// AdminEmails may use the /api/v1/admin endpoints. Setting any switches
+	// the password login off.
+	AdminEmails []string
+	// SMSCallback authenticates Africa's Talking callbacks
+	SMSCallback middleware.CallbackConfig
+	// LogisticsCallback authenticates courier shipment webhooks
+	LogisticsCallback middleware.CallbackConfig
+	// TrustedProxies may set X-Forwarded-For, which client IPs (and so
+	// callback IP allowlists) are read from, and X-Forwarded-Proto, which
+	// decides whether HSTS is sent. Unset trusts no proxy, so both are
+	// ignored.
+	TrustedProxies []string
+	// ClientIPHeader is read from trusted proxies ahead of X-Forwarded-For,
+	// for platforms that send the client's address on its own, such as
+	// CF-Connecting-IP
+	ClientIPHeader string
+	// StrictJSON rejects /api/v1 request bodies with unknown fields. It is
+	// opt in since v1 clients may send extra fields today.
+	StrictJSON    bool
+	LoginThrottle middleware.LoginThrottleConfig
+	// AuthCookies sets the token as a cookie on login for browser clients
+	AuthCookies middleware.CookieConfig
+	// Tokens sets the lifetime, issuer and audience of access tokens
+	Tokens      middleware.TokenConfig
+	Compression middleware.CompressionConfig
+	Middleware  MiddlewareConfig
+	// Validation bounds the amounts and times orders may be placed with
+	Validation validation.Limits
+
+	ReportLocation         *time.Location
+	ReportsRefreshInterval time.Duration
+
+	OrderArchiveAfter    time.Duration
+	OrderArchiveInterval time.Duration
+
+	NotificationResendLimit  int
+	NotificationResendWindow time.Duration
+
+	TaxPolicy services.TaxPolicy
+	// OrderNumbers sets the prefix and scheme of order numbers; the year in
+	// them is the year in ReportLocation
+	OrderNumbers services.OrderNumberPolicy
+
+	// SMSLength picks the shorter templates of order confirmations and
+	// rider texts when the full ones would take too many segments
+	SMSLength services.SMSLengthPolicy
+
+	// QuoteHold is how long quotes hold stock and price by default; the
+	// expiry job returns the stock of lapsed quotes every QuoteExpiryInterval
+	QuoteHold           time.Duration
+	QuoteExpiryInterval time.Duration
+
+	SLAPolicy        services.SLAPolicy
+	SLACheckInterval time.Duration
+	// OpsPhones receive SLA escalations, defaulting to AdminPhones
+	OpsPhones []string
+
+	// SagaStaleAfter is how long a saga may go without progress before the
+	// recovery job treats its pending steps as failed
+	SagaStaleAfter       time.Duration
+	SagaRecoveryInterval time.Duration
+
+	AnomalyPolicy        services.AnomalyPolicy
+	AnomalyCheckInterval time.Duration
+	// AnomalyAlertPhones are texted about unusual order amounts; without any
+	// anomalies are only recorded
+	AnomalyAlertPhones []string
+
+	// SMSFailureAlerts sets when OpsPhones are alerted about failing text
+	// messages, checked every SMSFailureCheckInterval
+	SMSFailureAlerts        services.SMSFailureAlertPolicy
+	SMSFailureCheckInterval time.Duration
+
+	// PushPolicy sets when unacknowledged pushes are texted instead
+	PushPolicy           services.PushPolicy
+	PushFallbackInterval time.Duration
+
+	// BackfillInterval is how often the server checks for unfinished
+	// schema backfills, which pause for BackfillPause between batches
+	BackfillInterval time.Duration
+	BackfillPause    time.Duration
+
+	// CachePolicy sets how long the CDN may keep the tracking page and the
+	// product catalog
+	CachePolicy services.CachePolicy
+
+	SLO services.SLOConfig
+	// LoadShed sets when reports and exports are turned away under load.
+	// Without a MaxLatency it sheds once requests average over the latency
+	// SLO threshold.
+	LoadShed services.LoadShedConfig
+	// MetricsToken, when set, must be sent as a bearer token to scrape /metrics
+	MetricsToken string
+
+	// Policies from AUTHZ_POLICIES apply along with those admins keep in
+	// the database
+	Policies []models.Policy
+
+	// WinBackPolicy sets the campaign texting customers who stopped
+	// ordering, run every WinBackInterval when it has a message
+	WinBackPolicy   services.WinBackPolicy
+	WinBackInterval time.Duration
+
+	// GreetingPolicy sets the birthday and anniversary texts, checked for
+	// every GreetingInterval and sent once a day to the customers their
+	// feature flags are on for
+	GreetingPolicy   services.GreetingPolicy
+	GreetingInterval time.Duration
+
+	// CampaignPolicy sets the daily quota, batch size and quiet hours of
+	// SMS campaigns, sent every CampaignInterval; the quiet hours and the
+	// day of the quota are in ReportLocation
+	CampaignPolicy   services.CampaignPolicy
+	CampaignInterval time.Duration
+
+	// OrderProjection turns on the job that starts the event history of
+	// older orders and rewrites order rows from their events, every
+	// OrderProjectionInterval
+	OrderProjection         bool
+	OrderProjectionInterval time.Duration
+
+	// DigestRecipients are emailed the previous day's orders digest,
+	// checked for every DigestInterval
+	DigestRecipients []string
+	DigestInterval   time.Duration
+
+	// WebhookInterval is how often order events are sent to webhook
+	// subscriptions, and the first wait after a failed delivery
+	WebhookInterval time.Duration
+
+	// SegmentSyncInterval is how often tagged customers are synced to the
+	// marketing platforms
+	SegmentSyncInterval time.Duration
+
+	// ReadYourWritesWindow is how long a client's reads go to the primary
+	// after it writes, when the database has read replicas
+	ReadYourWritesWindow time.Duration
+}
+
+// Deps holds the external dependencies handlers are built from
+type Deps struct {
+	DB  *gorm.DB
+	SMS services.SMSServiceInterface
+	// Push is nil when push notifications are not configured, and customers
+	// are only texted
+	Push services.PushSender
+	// Purger is nil when no CDN is configured, and cached responses only
+	// expire with their TTL
+	Purger services.CachePurger
+	// Email is nil when no SMTP relay is configured, and no digests are
+	// emailed
+	Email services.EmailSender
+	// Marketing holds the marketing platforms with credentials, by name;
+	// segments are only synced to these
+	Marketing map[string]services.MarketingPlatform
+	Flags     *features.Store
+	// Secrets is nil when secrets are read from plain environment variables
+	Secrets *secrets.Manager
+	// Scheduler runs the background jobs. BuildRouter builds one when it is
+	// nil, which is never started but lets admins run jobs on demand.
+	Scheduler *jobs.Scheduler
+}
+
+// ConfigFromEnv builds a Config from environment variables
+func ConfigFromEnv() Config {
+	cfg := Config{
+		PublicBaseURL:     os.Getenv("PUBLIC_BASE_URL"),
+		TrackingSecret:    os.Getenv("TRACKING_SECRET"),
+		SMSCallback:       middleware.CallbackConfigFromEnv("SMS"),
+		LogisticsCallback: middleware.CallbackConfigFromEnv("LOGISTICS"),
+		LoginThrottle:     middleware.LoginThrottleConfigFromEnv(),
+		AuthCookies:       middleware.CookieConfigFromEnv(),
+		Tokens:            middleware.TokenConfigFromEnv(),
+		Compression:       middleware.CompressionConfigFromEnv(),
+		Middleware:        MiddlewareConfigFromEnv(),
+		Validation:        validation.LimitsFromEnv(),
+		CachePolicy:       services.CachePolicyFromEnv(),
+		SLO:               services.SLOConfigFromEnv(),
+		LoadShed:          services.LoadShedConfigFromEnv(),
+		MetricsToken:      os.Getenv("METRICS_TOKEN"),
+	}
+
+	if cfg.TrackingSecret == "" {
+		cfg.TrackingSecret = os.Getenv("JWT_SECRET")
+	}
+
+	cfg.TrackingTTL, _ = time.ParseDuration(os.Getenv("TRACKING_LINK_TTL"))
+	cfg.StatementLinkTTL, _ = time.ParseDuration(os.Getenv("STATEMENT_LINK_TTL"))
+
+	if phones := os.Getenv("ADMIN_PHONES"); phones != "" {
+		cfg.AdminPhones = strings.Split(phones, ",")
+	}
+	if emails := os.Getenv("ADMIN_EMAILS"); emails != "" {
+		cfg.AdminEmails = strings.Split(emails, ",")
+	}
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		cfg.TrustedProxies = strings.Split(proxies, ",")
+	}
+	cfg.ClientIPHeader = http.CanonicalHeaderKey(strings.TrimSpace(os.Getenv("TRUSTED_CLIENT_IP_HEADER")))
+	cfg.StrictJSON, _ = strconv.ParseBool(os.Getenv("STRICT_JSON"))
+
+	timezone := os.Getenv("REPORTS_TIMEZONE")
+	if timezone == "" {
+		timezone = "Africa/Nairobi"
+	}
+	if location, err := time.LoadLocation(timezone); err == nil {
+		cfg.ReportLocation = location
+	} else {
+		log.Printf("unknown REPORTS_TIMEZONE %q, using UTC", timezone)
+		cfg.ReportLocation = time.UTC
+	}
+
+	cfg.ReportsRefreshInterval, _ = time.ParseDuration(os.Getenv("REPORTS_REFRESH_INTERVAL"))
+	if cfg.ReportsRefreshInterval <= 0 {
+		cfg.ReportsRefreshInterval = time.Hour
+	}
+
+	cfg.OrderArchiveAfter, _ = time.ParseDuration(os.Getenv("ORDER_ARCHIVE_AFTER"))
+	cfg.OrderArchiveInterval, _ = time.ParseDuration(os.Getenv("ORDER_ARCHIVE_INTERVAL"))
+	if cfg.OrderArchiveInterval <= 0 {
+		cfg.OrderArchiveInterval = 24 * time.Hour
+	}
+
+	cfg.NotificationResendLimit, _ = strconv.Atoi(os.Getenv("NOTIFICATION_RESEND_LIMIT"))
+	cfg.NotificationResendWindow, _ = time.ParseDuration(os.Getenv("NOTIFICATION_RESEND_WINDOW"))
+
+	cfg.TaxPolicy = services.TaxPolicyFromEnv()
+	cfg.OrderNumbers = services.OrderNumberPolicyFromEnv()
+	cfg.OrderNumbers.Location = cfg.ReportLocation
+	cfg.SMSLength = services.SMSLengthPolicyFromEnv()
+	cfg.QuoteHold, _ = time.ParseDuration(os.Getenv("QUOTE_HOLD"))
+	cfg.QuoteExpiryInterval, _ = time.ParseDuration(os.Getenv("QUOTE_EXPIRY_INTERVAL"))
+	if cfg.QuoteExpiryInterval <= 0 {
+		cfg.QuoteExpiryInterval = time.Minute
+	}
+	cfg.SLAPolicy = services.SLAPolicyFromEnv()
+	cfg.SLACheckInterval, _ = time.ParseDuration(os.Getenv("SLA_CHECK_INTERVAL"))
+	if cfg.SLACheckInterval <= 0 {
+		cfg.SLACheckInterval = 5 * time.Minute
+	}
+	cfg.OpsPhones = cfg.AdminPhones
+	if phones := os.Getenv("OPS_PHONES"); phones != "" {
+		cfg.OpsPhones = strings.Split(phones, ",")
+	}
+
+	cfg.SagaStaleAfter, _ = time.ParseDuration(os.Getenv("SAGA_STALE_AFTER"))
+	if cfg.SagaStaleAfter <= 0 {
+		cfg.SagaStaleAfter = 10 * time.Minute
+	}
+	cfg.SagaRecoveryInterval, _ = time.ParseDuration(os.Getenv("SAGA_RECOVERY_INTERVAL"))
+	if cfg.SagaRecoveryInterval <= 0 {
+		cfg.SagaRecoveryInterval = 5 * time.Minute
+	}
+
+	cfg.AnomalyPolicy = services.AnomalyPolicyFromEnv()
+	cfg.AnomalyCheckInterval, _ = time.ParseDuration(os.Getenv("ANOMALY_CHECK_INTERVAL"))
+	if cfg.AnomalyCheckInterval <= 0 {
+		cfg.AnomalyCheckInterval = 5 * time.Minute
+	}
+	if phones := os.Getenv("ANOMALY_ALERT_PHONES"); phones != "" {
+		cfg.AnomalyAlertPhones = strings.Split(phones, ",")
+	}
+
+	cfg.SMSFailureAlerts = services.SMSFailureAlertPolicyFromEnv()
+	cfg.SMSFailureCheckInterval, _ = time.ParseDuration(os.Getenv("SMS_FAILURE_CHECK_INTERVAL"))
+	if cfg.SMSFailureCheckInterval <= 0 {
+		cfg.SMSFailureCheckInterval = 5 * time.Minute
+	}
+
+	cfg.PushPolicy = services.PushPolicyFromEnv()
+	cfg.PushFallbackInterval, _ = time.ParseDuration(os.Getenv("PUSH_FALLBACK_INTERVAL"))
+	if cfg.PushFallbackInterval <= 0 {
+		cfg.PushFallbackInterval = time.Minute
+	}
+
+	cfg.BackfillInterval, _ = time.ParseDuration(os.Getenv("BACKFILL_INTERVAL"))
+	if cfg.BackfillInterval <= 0 {
+		cfg.BackfillInterval = 10 * time.Minute
+	}
+	cfg.BackfillPause, _ = time.ParseDuration(os.Getenv("BACKFILL_PAUSE"))
+
+	cfg.WinBackPolicy = services.WinBackPolicyFromEnv()
+	cfg.WinBackInterval, _ = time.ParseDuration(os.Getenv("WINBACK_CHECK_INTERVAL"))
+	if cfg.WinBackInterval <= 0 {
+		cfg.WinBackInterval = 24 * time.Hour
+	}
+
+	cfg.GreetingPolicy = services.GreetingPolicyFromEnv()
+	cfg.GreetingInterval, _ = time.ParseDuration(os.Getenv("GREETING_CHECK_INTERVAL"))
+	if cfg.GreetingInterval <= 0 {
+		cfg.GreetingInterval = time.Hour
+	}
+
+	cfg.CampaignPolicy = services.CampaignPolicyFromEnv()
+	cfg.CampaignPolicy.Location = cfg.ReportLocation
+	cfg.CampaignInterval, _ = time.ParseDuration(os.Getenv("CAMPAIGN_SEND_INTERVAL"))
+	if cfg.CampaignInterval <= 0 {
+		cfg.CampaignInterval = time.Minute
+	}
+
+	cfg.OrderProjection, _ = strconv.ParseBool(os.Getenv("ORDER_PROJECTION_ENABLED"))
+	cfg.OrderProjectionInterval, _ = time.ParseDuration(os.Getenv("ORDER_PROJECTION_INTERVAL"))
+	if cfg.OrderProjectionInterval <= 0 {
+		cfg.OrderProjectionInterval = 10 * time.Minute
+	}
+
+	if recipients := os.Getenv("DIGEST_RECIPIENTS"); recipients != "" {
+		cfg.DigestRecipients = strings.Split(recipients, ",")
+	}
+	cfg.DigestInterval, _ = time.ParseDuration(os.Getenv("DIGEST_CHECK_INTERVAL"))
+	if cfg.DigestInterval <= 0 {
+		cfg.DigestInterval = time.Hour
+	}
+
+	cfg.WebhookInterval, _ = time.ParseDuration(os.Getenv("WEBHOOK_DELIVERY_INTERVAL"))
+	if cfg.WebhookInterval <= 0 {
+		cfg.WebhookInterval = time.Minute
+	}
+
+	cfg.SegmentSyncInterval, _ = time.ParseDuration(os.Getenv("SEGMENT_SYNC_INTERVAL"))
+	if cfg.SegmentSyncInterval <= 0 {
+		cfg.SegmentSyncInterval = time.Hour
+	}
+
+	cfg.ReadYourWritesWindow, _ = time.ParseDuration(os.Getenv("READ_YOUR_WRITES_WINDOW"))
+
+	policies, err := authz.ParsePolicies(os.Getenv("AUTHZ_POLICIES"))
+	if err != nil {
+		log.Printf("ignoring AUTHZ_POLICIES: %v", err)
+	}
+	cfg.Policies = policies
+
+	return cfg
+}
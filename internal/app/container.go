@@ -0,0 +1,457 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/features"
+	"github.com/SebbieMzingKe/customer-order-api/internal/jobs"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"github.com/SebbieMzingKe/customer-order-api/internal/secrets"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Container wires the dependencies every entrypoint needs. Each one is
+// built on first use and kept, so a warm serverless instance connects to
+// the database once; a failed build is not kept and is tried again on the
+// next call. Tests swap any dependency with the With methods before it is
+// first provided.
+type Container struct {
+	mu sync.Mutex
+
+	config *Config
+	db     *gorm.DB
+	sms    services.SMSServiceInterface
+	push   services.PushSender
+	purger services.CachePurger
+	email  services.EmailSender
+	flags  *features.Store
+	router *gin.Engine
+
+	// marketing is nil until read from the environment, and may be empty
+	marketing map[string]services.MarketingPlatform
+
+	scheduler *jobs.Scheduler
+
+	// secrets is nil when no secret manager is configured; secretsLoaded
+	// tells that apart from not having loaded them yet
+	secrets       *secrets.Manager
+	secretsLoaded bool
+
+	serverless bool
+	timings    []StartupPhase
+
+	// closers release what the container opened itself, last first
+	closers []func() error
+}
+
+// StartupPhase is how long building one dependency took
+type StartupPhase struct {
+	Name     string
+	Duration time.Duration
+}
+
+func NewContainer() *Container {
+	return &Container{}
+}
+
+// ForServerless tunes the container for short-lived instances. The
+// database is neither migrated nor backfilled, which is left to
+// cmd/migrate at deploy time; it is connected to by the first query rather
+// than on start; and the pool is kept small, since every warm instance
+// holds its own.
+func (c *Container) ForServerless() *Container {
+	c.serverless = true
+	return c
+}
+
+// WithConfig uses cfg instead of reading the environment
+func (c *Container) WithConfig(cfg Config) *Container {
+	c.config = &cfg
+	return c
+}
+
+// WithDB uses db as is: it is not migrated, backfilled or closed
+func (c *Container) WithDB(db *gorm.DB) *Container {
+	c.db = db
+	return c
+}
+
+func (c *Container) WithSMS(sms services.SMSServiceInterface) *Container {
+	c.sms = sms
+	return c
+}
+
+func (c *Container) WithPush(push services.PushSender) *Container {
+	c.push = push
+	return c
+}
+
+func (c *Container) WithPurger(purger services.CachePurger) *Container {
+	c.purger = purger
+	return c
+}
+
+func (c *Container) WithEmail(email services.EmailSender) *Container {
+	c.email = email
+	return c
+}
+
+// WithMarketing uses platforms, by name, instead of those with credentials
+// in the environment
+func (c *Container) WithMarketing(platforms map[string]services.MarketingPlatform) *Container {
+	c.marketing = platforms
+	return c
+}
+
+func (c *Container) WithFlags(flags *features.Store) *Container {
+	c.flags = flags
+	return c
+}
+
+// WithSecrets uses manager, already loaded, instead of reading
+// SECRETS_PROVIDER
+func (c *Container) WithSecrets(manager *secrets.Manager) *Container {
+	c.secrets = manager
+	c.secretsLoaded = true
+	return c
+}
+
+// ProvideConfig returns the router config, read from the environment
+func (c *Container) ProvideConfig() Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provideConfig()
+}
+
+// ProvideDB connects to the configured database, migrates it and runs the
+// startup backfills
+func (c *Container) ProvideDB() (*gorm.DB, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provideDB()
+}
+
+// ProvideSMS builds the Africa's Talking client, or the dry run service
+// when SMS_DRY_RUN is set. Either stores the messages it sends.
+func (c *Container) ProvideSMS() (services.SMSServiceInterface, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provideSMS()
+}
+
+// ProvidePush builds the FCM client, or returns nil when FCM_PROJECT_ID
+// and FCM_CREDENTIALS_FILE are not set
+func (c *Container) ProvidePush() (services.PushSender, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.providePush()
+}
+
+// ProvideDeps returns every dependency handlers are built from
+func (c *Container) ProvideDeps() (Deps, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provideDeps()
+}
+
+// Router builds the router around the provided dependencies
+func (c *Container) Router() (*gin.Engine, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.router != nil {
+		return c.router, nil
+	}
+	deps, err := c.provideDeps()
+	if err != nil {
+		return nil, err
+	}
+	defer c.time("router")()
+	c.router = BuildRouter(c.provideConfig(), deps)
+	return c.router, nil
+}
+
+// Verify runs the startup checks against the provided database. A database
+// that cannot be reached fails the schema check rather than the call.
+func (c *Container) Verify(ctx context.Context) StartupReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	db, err := c.provideDB()
+	if err != nil {
+		log.Printf("failed to open the database: %v", err)
+		db = nil
+	}
+	return VerifyStartup(ctx, db)
+}
+
+// StartupTimings reports how long each dependency built so far took, in
+// the order they were built
+func (c *Container) StartupTimings() []StartupPhase {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]StartupPhase(nil), c.timings...)
+}
+
+// Close releases what the container opened, such as the database
+// connection. Dependencies passed in with the With methods are left open.
+func (c *Container) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var firstErr error
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		if err := c.closers[i](); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.closers = nil
+	return firstErr
+}
+
+func (c *Container) provideConfig() Config {
+	if c.config == nil {
+		// JWT_SECRET may be kept in the secret manager; a failed load is
+		// returned by the next provideDeps
+		if _, err := c.provideSecrets(); err != nil {
+			log.Printf("failed to load secrets: %v", err)
+		}
+		cfg := ConfigFromEnv()
+		c.config = &cfg
+	}
+	return *c.config
+}
+
+func (c *Container) provideDB() (*gorm.DB, error) {
+	if c.db != nil {
+		return c.db, nil
+	}
+	if _, err := c.provideSecrets(); err != nil {
+		return nil, err
+	}
+	defer c.time("database")()
+
+	keyring, err := pii.KeyringFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pii encryption keys: %w", err)
+	}
+	if keyring == nil {
+		log.Println("PII_ENCRYPTION_KEYS is not set, customer phone numbers and emails are stored in plain text")
+	}
+	pii.SetKeyring(keyring)
+
+	cfg := DatabaseConfigFromEnv()
+	if c.serverless {
+		cfg = serverlessDatabaseConfig(cfg)
+	}
+	db, err := OpenDatabase(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if !c.serverless {
+		if err := BootstrapDatabase(db); err != nil {
+			sqlDB.Close()
+			return nil, err
+		}
+	}
+
+	// replicas are only read from once the primary is migrated
+	replicas, err := OpenReplicas(db, cfg)
+	if err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+
+	c.db = db
+	c.closers = append(c.closers, sqlDB.Close)
+	for _, replica := range replicas {
+		c.closers = append(c.closers, replica.Close)
+	}
+	return db, nil
+}
+
+// serverlessDatabaseConfig connects lazily and caps the pool unless the
+// environment sets the limits
+func serverlessDatabaseConfig(cfg DatabaseConfig) DatabaseConfig {
+	cfg.Lazy = true
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = 5
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = 2
+	}
+	if cfg.ConnMaxIdleTime <= 0 {
+		// a frozen instance should not hold on to connections for long
+		cfg.ConnMaxIdleTime = time.Minute
+	}
+	return cfg
+}
+
+// BootstrapDatabase brings a database up to date: it migrates the schema
+// and runs the backfills
+func BootstrapDatabase(db *gorm.DB) error {
+	if err := models.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if n, err := services.BackfillOrderTax(context.Background(), db, services.TaxPolicyFromEnv()); err != nil {
+		return fmt.Errorf("failed to backfill order tax: %w", err)
+	} else if n > 0 {
+		log.Printf("computed tax for %d existing orders", n)
+	}
+
+	if n, err := services.BackfillCustomerPII(context.Background(), db, false); err != nil {
+		return fmt.Errorf("failed to backfill customer pii: %w", err)
+	} else if n > 0 {
+		log.Printf("encrypted contact details of %d existing customers", n)
+	}
+	return nil
+}
+
+func (c *Container) provideSMS() (services.SMSServiceInterface, error) {
+	if c.sms != nil {
+		return c.sms, nil
+	}
+	if _, err := c.provideSecrets(); err != nil {
+		return nil, err
+	}
+
+	db, err := c.provideDB()
+	if err != nil {
+		return nil, err
+	}
+	length := services.SMSLengthPolicyFromEnv()
+
+	if dryRun, _ := strconv.ParseBool(os.Getenv("SMS_DRY_RUN")); dryRun {
+		log.Println("SMS_DRY_RUN is set, text messages are logged and stored but not sent")
+		c.sms = services.NewDryRunSMSService(db).WithLengthPolicy(length)
+		return c.sms, nil
+	}
+
+	c.sms = services.NewSMSService(
+		os.Getenv("AFRICASTALKING_USERNAME"),
+		os.Getenv("AFRICASTALKING_API_KEY"),
+		os.Getenv("AFRICASTALKING_SENDER_ID"),
+	).WithHTTPClient(services.NewResilientClient(services.HTTPClientConfigFromEnv("SMS"))).
+		WithBulkConfig(services.BulkSMSConfigFromEnv()).
+		WithEnvironment(services.SMSEnvironmentFromEnv()).
+		WithLengthPolicy(length).
+		WithMessageLog(db)
+	return c.sms, nil
+}
+
+func (c *Container) providePush() (services.PushSender, error) {
+	if c.push != nil {
+		return c.push, nil
+	}
+
+	defer c.time("push")()
+	fcm, err := services.FCMServiceFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if fcm == nil {
+		// a nil *FCMService would not compare equal to a nil PushSender
+		return nil, nil
+	}
+	c.push = fcm
+	return c.push, nil
+}
+
+// provideSecrets loads the secrets SECRETS_PROVIDER and SECRETS describe
+// into the environment, before anything reads them. It is a no-op when no
+// secret manager is configured.
+func (c *Container) provideSecrets() (*secrets.Manager, error) {
+	if c.secretsLoaded {
+		return c.secrets, nil
+	}
+
+	done := c.time("secrets")
+	manager, err := secrets.LoadFromEnv(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	if manager != nil {
+		// only timed when there was something to load
+		done()
+		manager.OnRotate(logRotation)
+	}
+	c.secrets = manager
+	c.secretsLoaded = true
+	return manager, nil
+}
+
+// logRotation reports a rotated secret. JWT_SECRET is read on every
+// request and takes effect at once; the database and Africa's Talking
+// clients hold on to what they were built with until a restart.
+func logRotation(name string) {
+	if name == "JWT_SECRET" {
+		log.Println("JWT_SECRET was rotated, tokens signed with the old secret are no longer accepted")
+		return
+	}
+	log.Printf("%s was rotated, restart to start using it", name)
+}
+
+func (c *Container) provideDeps() (Deps, error) {
+	manager, err := c.provideSecrets()
+	if err != nil {
+		return Deps{}, err
+	}
+	db, err := c.provideDB()
+	if err != nil {
+		return Deps{}, err
+	}
+	sms, err := c.provideSMS()
+	if err != nil {
+		return Deps{}, err
+	}
+	push, err := c.providePush()
+	if err != nil {
+		return Deps{}, err
+	}
+	if c.purger == nil {
+		// a nil *FastlyPurger would not compare equal to a nil CachePurger
+		if fastly := services.FastlyPurgerFromEnv(); fastly != nil {
+			c.purger = fastly
+		}
+	}
+	if c.email == nil {
+		// a nil *SMTPEmailService would not compare equal to a nil EmailSender
+		if smtp := services.SMTPEmailServiceFromEnv(); smtp != nil {
+			c.email = smtp
+		}
+	}
+	if c.marketing == nil {
+		c.marketing = services.MarketingPlatformsFromEnv()
+	}
+	if c.flags == nil {
+		c.flags = features.NewStore(db, 0)
+	}
+	deps := Deps{DB: db, SMS: sms, Push: push, Purger: c.purger, Email: c.email, Marketing: c.marketing, Flags: c.flags, Secrets: manager}
+	if c.scheduler == nil {
+		c.scheduler = BuildScheduler(c.provideConfig(), deps)
+	}
+	deps.Scheduler = c.scheduler
+	return deps, nil
+}
+
+// time records how long the phase took when the returned func is called
+func (c *Container) time(name string) func() {
+	start := time.Now()
+	return func() {
+		c.timings = append(c.timings, StartupPhase{Name: name, Duration: time.Since(start)})
+	}
+}
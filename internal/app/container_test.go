@@ -0,0 +1,99 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestContainerUsesSwappedDependencies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	sms := services.NewMockSMSService()
+
+	container := NewContainer().
+		WithConfig(Config{TrackingSecret: "test-secret"}).
+		WithDB(db).
+		WithSMS(sms)
+
+	deps, err := container.ProvideDeps()
+	assert.NoError(t, err)
+	assert.Same(t, db, deps.DB)
+	assert.Same(t, sms, deps.SMS)
+	assert.NotNil(t, deps.Flags)
+	assert.Equal(t, "test-secret", container.ProvideConfig().TrackingSecret)
+
+	router, err := container.Router()
+	assert.NoError(t, err)
+	again, _ := container.Router()
+	assert.Same(t, router, again, "the router is built once")
+
+	// what was passed in is not the container's to close
+	assert.NoError(t, container.Close())
+	assert.NoError(t, db.Exec("SELECT 1").Error)
+}
+
+func TestContainerProvidesDatabaseLazily(t *testing.T) {
+	t.Setenv("PII_ENCRYPTION_KEYS", "")
+	t.Setenv("SMS_DRY_RUN", "true")
+
+	container := NewContainer()
+
+	// a failed connection is not kept, so the next call tries again
+	t.Setenv("DB_DRIVER", "oracle")
+	_, err := container.ProvideDB()
+	assert.ErrorContains(t, err, "unsupported DB_DRIVER")
+
+	t.Setenv("DB_DRIVER", DriverSQLite)
+	t.Setenv("DATABASE_URL", filepath.Join(t.TempDir(), "savannah.db"))
+	db, err := container.ProvideDB()
+	assert.NoError(t, err)
+	assert.True(t, db.Migrator().HasTable(&models.Customer{}), "the database is migrated")
+
+	again, err := container.ProvideDB()
+	assert.NoError(t, err)
+	assert.Same(t, db, again, "the database is connected once")
+
+	sms, err := container.ProvideSMS()
+	assert.NoError(t, err)
+	assert.IsType(t, &services.DryRunSMSService{}, sms)
+
+	assert.NoError(t, container.Close())
+	assert.Error(t, db.Exec("SELECT 1").Error, "the connection the container opened is closed")
+}
+
+func TestContainerForServerless(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("PII_ENCRYPTION_KEYS", "")
+	t.Setenv("SMS_DRY_RUN", "true")
+	t.Setenv("DB_DRIVER", DriverSQLite)
+	t.Setenv("DATABASE_URL", filepath.Join(t.TempDir(), "savannah.db"))
+
+	container := NewContainer().WithConfig(Config{}).ForServerless()
+	defer container.Close()
+
+	_, err := container.Router()
+	assert.NoError(t, err)
+
+	db, _ := container.ProvideDB()
+	assert.False(t, db.Migrator().HasTable(&models.Customer{}), "migrations are left to the deploy")
+
+	var phases []string
+	for _, phase := range container.StartupTimings() {
+		phases = append(phases, phase.Name)
+	}
+	assert.Equal(t, []string{"database", "push", "router"}, phases)
+}
@@ -0,0 +1,541 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// updateContracts rewrites the golden files under testdata/contracts from
+// the current responses: go test ./internal/app -run TestContracts -update
+var updateContracts = flag.Bool("update", false, "rewrite the API contract golden files")
+
+const (
+	contractAdmin         = "admin@example.com"
+	contractCallbackToken = "contract-token"
+	// contractSessionID is a second session of the admin, for revoking
+	contractSessionID = "contract0session0000000000000001"
+)
+
+// contractCase is one request made against the seeded provider state. Path
+// and body may use {now} (an order time the validators accept),
+// {today} and {last_week} (dates around the seeded orders),
+// {tracking_token} (a valid tracking token for order 1) and
+// {statement_token} (a valid statement link token for customer 1).
+type contractCase struct {
+	name   string
+	method string
+	route  string
+	// path defaults to route
+	path        string
+	contentType string
+	body        string
+	// anonymous requests are sent without a bearer token
+	anonymous bool
+}
+
+// contract is what a golden file holds. The response body is recorded as
+// its shape, the JSON type of every field, so that ids, timestamps and
+// tokens may change without breaking consumers while a renamed, removed or
+// retyped field does. Error codes are kept as they are part of the contract.
+type contract struct {
+	Request  contractRequest  `json:"request"`
+	Response contractResponse `json:"response"`
+}
+
+type contractRequest struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	Form        string          `json:"form,omitempty"`
+}
+
+type contractResponse struct {
+	Status      int         `json:"status"`
+	ContentType string      `json:"content_type"`
+	Location    string      `json:"location,omitempty"`
+	Body        interface{} `json:"body,omitempty"`
+}
+
+var contractCases = []contractCase{
+	{name: "root", method: "GET", route: "/", anonymous: true},
+	{name: "health", method: "GET", route: "/health", anonymous: true},
+	{name: "health_ready", method: "GET", route: "/health/ready", anonymous: true},
+	{name: "version", method: "GET", route: "/version", anonymous: true},
+	{name: "metrics", method: "GET", route: "/metrics", anonymous: true},
+	{name: "track", method: "GET", route: "/track/:token", path: "/track/{tracking_token}", anonymous: true},
+	{name: "statement_shared", method: "GET", route: "/statements/:token", path: "/statements/{statement_token}", anonymous: true},
+	{name: "catalog_list", method: "GET", route: "/catalog/products", anonymous: true},
+	{name: "catalog_get", method: "GET", route: "/catalog/products/:id", path: "/catalog/products/1", anonymous: true},
+
+	{name: "sms_inbound", method: "POST", route: "/callbacks/sms/inbound", path: "/callbacks/sms/inbound?token=" + contractCallbackToken,
+		contentType: "application/x-www-form-urlencoded", body: "from=%2B254740827150&to=20880&text=STOP&id=ATXid_1", anonymous: true},
+	{name: "sms_delivery", method: "POST", route: "/callbacks/sms/delivery", path: "/callbacks/sms/delivery?token=" + contractCallbackToken,
+		contentType: "application/x-www-form-urlencoded", body: "id=ATXid_campaign_1&status=Success&phoneNumber=%2B254740827150&networkCode=63902&retryCount=0", anonymous: true},
+	{name: "shipment_status", method: "POST", route: "/integrations/3pl/status", path: "/integrations/3pl/status?format=status&token=" + contractCallbackToken,
+		body: `{"event_id": "evt_1", "reference": "1", "tracking_number": "TRK1", "status": "IN_TRANSIT", "timestamp": "{now}"}`, anonymous: true},
+
+	{name: "auth_login", method: "GET", route: "/auth/login", body: `{"email": "admin@example.com", "password": "secret"}`, anonymous: true},
+	{name: "auth_callback", method: "GET", route: "/auth/callback", path: "/auth/callback?code=abc&state=xyz", anonymous: true},
+	{name: "auth_callback_provider", method: "GET", route: "/auth/callback/:provider", path: "/auth/callback/google?code=abc&state=xyz", anonymous: true},
+	{name: "auth_providers", method: "GET", route: "/auth/providers", anonymous: true},
+	{name: "auth_userinfo", method: "GET", route: "/auth/userinfo"},
+	{name: "auth_logout", method: "POST", route: "/auth/logout"},
+	{name: "auth_sessions_list", method: "GET", route: "/auth/sessions"},
+	{name: "auth_sessions_revoke", method: "DELETE", route: "/auth/sessions/:id", path: "/auth/sessions/" + contractSessionID},
+
+	{name: "customers_create", method: "POST", route: "/api/v1/customers", body: `{"name": "Jane Wanjiru", "code": "CUST010", "phone": "+254712345678", "email": "jane@example.com", "birthday": "1994-07-21", "onboarded_on": "2025-01-15"}`},
+	{name: "customers_list", method: "GET", route: "/api/v1/customers"},
+	{name: "customers_stream", method: "GET", route: "/api/v1/customers/stream.ndjson"},
+	{name: "customers_by_code", method: "GET", route: "/api/v1/customers/by-code/:code", path: "/api/v1/customers/by-code/CUST001"},
+	{name: "customers_get", method: "GET", route: "/api/v1/customers/:id", path: "/api/v1/customers/1"},
+	{name: "customers_update", method: "PUT", route: "/api/v1/customers/:id", path: "/api/v1/customers/1", body: `{"name": "Sebbie C."}`},
+	{name: "customers_delete", method: "DELETE", route: "/api/v1/customers/:id", path: "/api/v1/customers/2"},
+	{name: "customers_change_code", method: "POST", route: "/api/v1/customers/:id/change-code", path: "/api/v1/customers/1/change-code", body: `{"code": "CUST100"}`},
+	{name: "customers_orders_list", method: "GET", route: "/api/v1/customers/:id/orders", path: "/api/v1/customers/1/orders"},
+	{name: "customers_orders_create", method: "POST", route: "/api/v1/customers/:id/orders", path: "/api/v1/customers/1/orders",
+		body: `{"item": "phone", "amount": 800, "time": "{now}"}`},
+	{name: "customers_anonymize", method: "POST", route: "/api/v1/customers/:id/anonymize", path: "/api/v1/customers/2/anonymize"},
+	{name: "customers_export", method: "GET", route: "/api/v1/customers/:id/export", path: "/api/v1/customers/1/export"},
+	{name: "customers_statement", method: "GET", route: "/api/v1/customers/:id/statement", path: "/api/v1/customers/1/statement?from={last_week}&to={today}"},
+	{name: "customers_statement_csv", method: "GET", route: "/api/v1/customers/:id/statement", path: "/api/v1/customers/1/statement?format=csv"},
+	{name: "customers_statement_send", method: "POST", route: "/api/v1/customers/:id/statement/send", path: "/api/v1/customers/1/statement/send", body: `{"format": "pdf"}`},
+	{name: "notes_create", method: "POST", route: "/api/v1/customers/:id/notes", path: "/api/v1/customers/1/notes", body: `{"text": "prefers evening delivery", "pinned": true}`},
+	{name: "notes_list", method: "GET", route: "/api/v1/customers/:id/notes", path: "/api/v1/customers/1/notes"},
+	{name: "notes_update", method: "PUT", route: "/api/v1/customers/:id/notes/:noteId", path: "/api/v1/customers/1/notes/1", body: `{"pinned": false}`},
+	{name: "notes_delete", method: "DELETE", route: "/api/v1/customers/:id/notes/:noteId", path: "/api/v1/customers/1/notes/1"},
+	{name: "notes_search", method: "GET", route: "/api/v1/notes", path: "/api/v1/notes?q=delivery"},
+	{name: "devices_register", method: "POST", route: "/api/v1/customers/:id/devices", path: "/api/v1/customers/1/devices", body: `{"token": "fcm-token-2", "platform": "ios"}`},
+	{name: "devices_list", method: "GET", route: "/api/v1/customers/:id/devices", path: "/api/v1/customers/1/devices"},
+	{name: "customer_tags", method: "GET", route: "/api/v1/customers/:id/tags", path: "/api/v1/customers/1/tags"},
+	{name: "customer_tags_add", method: "POST", route: "/api/v1/customers/:id/tags", path: "/api/v1/customers/1/tags", body: `{"tags": ["vip", "nairobi"]}`},
+	{name: "customer_tags_remove", method: "DELETE", route: "/api/v1/customers/:id/tags/:tag", path: "/api/v1/customers/1/tags/vip"},
+	{name: "devices_delete", method: "DELETE", route: "/api/v1/customers/:id/devices/:deviceId", path: "/api/v1/customers/1/devices/1"},
+	{name: "push_acknowledge", method: "POST", route: "/api/v1/notifications/:id/delivered", path: "/api/v1/notifications/1/delivered"},
+
+	{name: "orders_create", method: "POST", route: "/api/v1/orders", body: `{"item": "tablet", "amount": 1200, "time": "{now}", "customer_id": 1, "product_id": 1, "quantity": 1}`},
+	{name: "orders_create_with_promo_code", method: "POST", route: "/api/v1/orders", body: `{"item": "charger", "amount": 1000, "time": "{now}", "customer_id": 1, "promo_code": "dec-2026"}`},
+	{name: "orders_list", method: "GET", route: "/api/v1/orders"},
+	{name: "orders_archive", method: "GET", route: "/api/v1/orders/archive"},
+	{name: "orders_stream", method: "GET", route: "/api/v1/orders/stream.ndjson"},
+	{name: "orders_totals", method: "GET", route: "/api/v1/orders/totals", path: "/api/v1/orders/totals?group_by=customer"},
+	{name: "orders_get", method: "GET", route: "/api/v1/orders/:id", path: "/api/v1/orders/1"},
+	{name: "orders_get_by_number", method: "GET", route: "/api/v1/orders/by-number/:number", path: "/api/v1/orders/by-number/ord-2025-000001"},
+	{name: "orders_update", method: "PUT", route: "/api/v1/orders/:id", path: "/api/v1/orders/1", body: `{"status": "confirmed"}`},
+	{name: "orders_history", method: "GET", route: "/api/v1/orders/:id/history", path: "/api/v1/orders/1/history"},
+	{name: "orders_events", method: "GET", route: "/api/v1/orders/:id/events", path: "/api/v1/orders/1/events"},
+	{name: "orders_delete", method: "DELETE", route: "/api/v1/orders/:id", path: "/api/v1/orders/2"},
+	{name: "orders_duplicate", method: "POST", route: "/api/v1/orders/:id/duplicate", path: "/api/v1/orders/1/duplicate", body: `{"quantity": 2}`},
+	{name: "orders_resend_notification", method: "POST", route: "/api/v1/orders/:id/notifications/resend", path: "/api/v1/orders/1/notifications/resend", body: `{}`},
+	{name: "orders_assign", method: "POST", route: "/api/v1/orders/:id/assignment", path: "/api/v1/orders/2/assignment", body: `{"rider_id": 1}`},
+	{name: "orders_assignment_update", method: "PUT", route: "/api/v1/orders/:id/assignment", path: "/api/v1/orders/1/assignment", body: `{"status": "picked_up"}`},
+	{name: "orders_assignments", method: "GET", route: "/api/v1/orders/:id/assignments", path: "/api/v1/orders/1/assignments"},
+	{name: "quotes_create", method: "POST", route: "/api/v1/quotes", body: `{"customer_id": 1, "product_id": 1, "quantity": 2}`},
+	{name: "quotes_get", method: "GET", route: "/api/v1/quotes/:id", path: "/api/v1/quotes/1"},
+	{name: "quotes_confirm", method: "POST", route: "/api/v1/quotes/:id/confirm", path: "/api/v1/quotes/1/confirm"},
+	{name: "quotes_cancel", method: "DELETE", route: "/api/v1/quotes/:id", path: "/api/v1/quotes/1"},
+
+	{name: "riders_create", method: "POST", route: "/api/v1/riders", body: `{"name": "Kevin Otieno", "phone": "+254722000111"}`},
+	{name: "riders_list", method: "GET", route: "/api/v1/riders"},
+	{name: "riders_get", method: "GET", route: "/api/v1/riders/:id", path: "/api/v1/riders/1"},
+	{name: "riders_update", method: "PUT", route: "/api/v1/riders/:id", path: "/api/v1/riders/1", body: `{"active": false}`},
+	{name: "riders_orders", method: "GET", route: "/api/v1/riders/:id/orders", path: "/api/v1/riders/1/orders"},
+
+	{name: "products_create", method: "POST", route: "/api/v1/products", body: `{"name": "Tablet", "sku": "TAB-001", "price": 1200, "stock_quantity": 10, "low_stock_threshold": 2}`},
+	{name: "products_list", method: "GET", route: "/api/v1/products"},
+	{name: "products_low_stock", method: "GET", route: "/api/v1/products/low-stock"},
+	{name: "products_get", method: "GET", route: "/api/v1/products/:id", path: "/api/v1/products/1"},
+	{name: "products_update", method: "PUT", route: "/api/v1/products/:id", path: "/api/v1/products/1", body: `{"stock_quantity": 3}`},
+
+	{name: "reports_daily", method: "GET", route: "/api/v1/reports/daily"},
+	{name: "reports_weekly", method: "GET", route: "/api/v1/reports/weekly"},
+	{name: "reports_monthly", method: "GET", route: "/api/v1/reports/monthly"},
+	{name: "reports_vat", method: "GET", route: "/api/v1/reports/vat"},
+	{name: "reports_heatmap", method: "GET", route: "/api/v1/reports/orders/heatmap"},
+	{name: "reports_win_back", method: "GET", route: "/api/v1/reports/win-back"},
+	{name: "reports_refresh", method: "POST", route: "/api/v1/reports/refresh"},
+
+	{name: "campaigns_create", method: "POST", route: "/api/v1/campaigns", body: `{"name": "June offer", "message": "Hi {first_name}, 10% off laptops this week", "tags": ["vip"], "send_at": "2030-06-01T07:00:00Z"}`},
+	{name: "campaigns_list", method: "GET", route: "/api/v1/campaigns"},
+	{name: "campaigns_get", method: "GET", route: "/api/v1/campaigns/:id", path: "/api/v1/campaigns/1"},
+	{name: "campaigns_cancel", method: "POST", route: "/api/v1/campaigns/:id/cancel", path: "/api/v1/campaigns/1/cancel"},
+
+	{name: "admin_features_list", method: "GET", route: "/api/v1/admin/features"},
+	{name: "admin_features_update", method: "PUT", route: "/api/v1/admin/features/:key", path: "/api/v1/admin/features/new_checkout",
+		body: `{"description": "new checkout flow", "enabled": true, "rollout_percent": 25}`},
+	{name: "admin_sagas_list", method: "GET", route: "/api/v1/admin/sagas"},
+	{name: "admin_sagas_get", method: "GET", route: "/api/v1/admin/sagas/:id", path: "/api/v1/admin/sagas/1"},
+	{name: "admin_sagas_compensate", method: "POST", route: "/api/v1/admin/sagas/:id/compensate", path: "/api/v1/admin/sagas/1/compensate"},
+	{name: "admin_slo", method: "GET", route: "/api/v1/admin/slo"},
+	{name: "admin_backfills", method: "GET", route: "/api/v1/admin/backfills"},
+	{name: "admin_jobs_list", method: "GET", route: "/api/v1/admin/jobs"},
+	{name: "admin_jobs_runs", method: "GET", route: "/api/v1/admin/jobs/:name/runs", path: "/api/v1/admin/jobs/daily_order_stats/runs"},
+	// an unknown job, so no job runs in the background during the contracts
+	{name: "admin_digests_list", method: "GET", route: "/api/v1/admin/digests"},
+	{name: "admin_digests_get", method: "GET", route: "/api/v1/admin/digests/:id", path: "/api/v1/admin/digests/1"},
+	{name: "admin_digests_send", method: "POST", route: "/api/v1/admin/digests", body: `{"day": "2026-01-01", "recipients": ["ops@example.com"]}`},
+	{name: "admin_jobs_run", method: "POST", route: "/api/v1/admin/jobs/:name/run", path: "/api/v1/admin/jobs/unknown/run"},
+	{name: "admin_sms_failures", method: "GET", route: "/api/v1/admin/sms/failures", path: "/api/v1/admin/sms/failures?window=1h"},
+	{name: "admin_customers_duplicates", method: "GET", route: "/api/v1/admin/customers/duplicates", path: "/api/v1/admin/customers/duplicates?min_confidence=0.8"},
+	{name: "admin_api_keys_create", method: "POST", route: "/api/v1/admin/api-keys", body: `{"name": "Acme Logistics", "monthly_quota": 10000, "scopes": ["orders:read", "reports:read"]}`},
+	{name: "admin_api_keys", method: "GET", route: "/api/v1/admin/api-keys"},
+	{name: "admin_api_keys_revoke", method: "DELETE", route: "/api/v1/admin/api-keys/:id", path: "/api/v1/admin/api-keys/1"},
+	{name: "admin_usage", method: "GET", route: "/api/v1/admin/usage"},
+	{name: "admin_webhooks", method: "GET", route: "/api/v1/admin/webhooks"},
+	{name: "admin_webhooks_create", method: "POST", route: "/api/v1/admin/webhooks", body: `{"url": "https://hooks.example.com/orders", "description": "warehouse", "events": ["order.created", "order.status_changed"]}`},
+	{name: "admin_webhook", method: "GET", route: "/api/v1/admin/webhooks/:id", path: "/api/v1/admin/webhooks/1"},
+	{name: "admin_webhook_update", method: "PUT", route: "/api/v1/admin/webhooks/:id", path: "/api/v1/admin/webhooks/1", body: `{"active": false}`},
+	{name: "admin_webhook_rotate_secret", method: "POST", route: "/api/v1/admin/webhooks/:id/rotate-secret", path: "/api/v1/admin/webhooks/1/rotate-secret", body: `{"grace_period_minutes": 60}`},
+	{name: "admin_segment_syncs", method: "GET", route: "/api/v1/admin/segment-syncs"},
+	{name: "admin_segment_syncs_create", method: "POST", route: "/api/v1/admin/segment-syncs", body: `{"tag": "vip", "platform": "mailchimp", "audience": "a1b2c3d4", "fields": {"FNAME": "first_name", "PHONE": "phone"}}`},
+	{name: "admin_segment_sync", method: "GET", route: "/api/v1/admin/segment-syncs/:id", path: "/api/v1/admin/segment-syncs/1"},
+	{name: "admin_segment_sync_update", method: "PUT", route: "/api/v1/admin/segment-syncs/:id", path: "/api/v1/admin/segment-syncs/1", body: `{"active": false}`},
+	{name: "admin_segment_sync_run", method: "POST", route: "/api/v1/admin/segment-syncs/:id/run", path: "/api/v1/admin/segment-syncs/1/run"},
+	{name: "admin_segment_sync_delete", method: "DELETE", route: "/api/v1/admin/segment-syncs/:id", path: "/api/v1/admin/segment-syncs/1"},
+	{name: "admin_promo_codes", method: "GET", route: "/api/v1/admin/promo-codes"},
+	{name: "admin_promo_codes_create", method: "POST", route: "/api/v1/admin/promo-codes", body: `{"code": "xmas25", "description": "Christmas week", "type": "percentage", "percent_off": 25, "min_amount": 1000, "ends_at": "2030-12-26T00:00:00Z", "max_per_customer": 1}`},
+	{name: "admin_promo_code", method: "GET", route: "/api/v1/admin/promo-codes/:id", path: "/api/v1/admin/promo-codes/1"},
+	{name: "admin_promo_code_update", method: "PUT", route: "/api/v1/admin/promo-codes/:id", path: "/api/v1/admin/promo-codes/1", body: `{"max_redemptions": 500}`},
+	{name: "admin_promo_code_delete", method: "DELETE", route: "/api/v1/admin/promo-codes/:id", path: "/api/v1/admin/promo-codes/1"},
+	{name: "admin_webhook_delete", method: "DELETE", route: "/api/v1/admin/webhooks/:id", path: "/api/v1/admin/webhooks/1"},
+	{name: "admin_policies", method: "GET", route: "/api/v1/admin/policies"},
+	{name: "admin_policies_create", method: "POST", route: "/api/v1/admin/policies", body: `{"role": "agent", "method": "POST", "path": "/api/v1/customers/bulk*", "effect": "deny"}`},
+	{name: "admin_policies_delete", method: "DELETE", route: "/api/v1/admin/policies/:id", path: "/api/v1/admin/policies/1"},
+	{name: "admin_roles", method: "GET", route: "/api/v1/admin/roles"},
+	{name: "admin_roles_assign", method: "PUT", route: "/api/v1/admin/roles/:email", path: "/api/v1/admin/roles/clerk@example.com", body: `{"role": "manager"}`},
+	{name: "admin_identities_list", method: "GET", route: "/api/v1/admin/identities", path: "/api/v1/admin/identities?email=clerk@example.com"},
+	{name: "admin_identities_update", method: "PUT", route: "/api/v1/admin/identities/:id", path: "/api/v1/admin/identities/1", body: `{"email": "amina@example.com"}`},
+	{name: "admin_roles_remove", method: "DELETE", route: "/api/v1/admin/roles/:email", path: "/api/v1/admin/roles/clerk@example.com"},
+	{name: "admin_customers_bulk_delete", method: "POST", route: "/api/v1/admin/customers/bulk-delete", body: `{"ids": [2]}`},
+	{name: "admin_customers_bulk_restore", method: "POST", route: "/api/v1/admin/customers/bulk-restore", body: `{"ids": [3]}`},
+}
+
+// TestContracts replays every contract case against a freshly seeded
+// router and compares the response with its golden file
+func TestContracts(t *testing.T) {
+	t.Setenv("JWT_SECRET", "contract-jwt-secret")
+	now := time.Now().UTC()
+	links, err := services.NewStatementLinks("test-secret", "", 0)
+	if err != nil {
+		t.Fatalf("failed to create statement links: %v", err)
+	}
+	tracking, err := services.NewTrackingService("test-secret", "", 0)
+	if err != nil {
+		t.Fatalf("failed to create tracking service: %v", err)
+	}
+
+	for _, tc := range contractCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r, db := setupContractRouter(t)
+			seedContractState(t, db, now)
+
+			statementURL, _ := links.URL(services.StatementRef{CustomerID: 1, From: now.AddDate(0, 0, -7), To: now, Format: services.StatementJSON})
+			replace := strings.NewReplacer(
+				"{now}", now.Add(-time.Hour).Format(time.RFC3339),
+				"{tracking_token}", tracking.GenerateToken(1),
+				"{statement_token}", strings.TrimPrefix(statementURL, "/statements/"),
+				"{today}", now.Format(time.DateOnly),
+				"{last_week}", now.AddDate(0, 0, -7).Format(time.DateOnly),
+			)
+			token := ""
+			if !tc.anonymous {
+				token = contractToken(t, db)
+			}
+
+			path := tc.path
+			if path == "" {
+				path = tc.route
+			}
+			contentType := tc.contentType
+			if contentType == "" && tc.body != "" {
+				contentType = "application/json"
+			}
+
+			req, _ := http.NewRequest(tc.method, replace.Replace(path), strings.NewReader(replace.Replace(tc.body)))
+			if contentType != "" {
+				req.Header.Set("Content-Type", contentType)
+			}
+			if token != "" {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			got := contract{
+				Request: contractRequest{Method: tc.method, Path: path, ContentType: contentType},
+				Response: contractResponse{
+					Status:      w.Code,
+					ContentType: w.Header().Get("Content-Type"),
+					Location:    w.Header().Get("Location"),
+				},
+			}
+			if contentType == "application/json" {
+				got.Request.Body = json.RawMessage(tc.body)
+			} else {
+				got.Request.Form = tc.body
+			}
+			if strings.HasPrefix(got.Response.ContentType, "application/json") {
+				var body interface{}
+				if !assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), "response is not json") {
+					return
+				}
+				got.Response.Body = contractShape(body)
+			}
+			// a stream's lines are recorded like the elements of an array
+			if strings.HasPrefix(got.Response.ContentType, "application/x-ndjson") {
+				var lines []interface{}
+				for _, line := range bytes.Split(bytes.TrimSpace(w.Body.Bytes()), []byte("\n")) {
+					var body interface{}
+					if !assert.NoError(t, json.Unmarshal(line, &body), "line is not json") {
+						return
+					}
+					lines = append(lines, body)
+				}
+				got.Response.Body = contractShape(lines)
+			}
+
+			actual, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				t.Fatalf("failed to encode contract: %v", err)
+			}
+			actual = append(actual, '\n')
+
+			golden := filepath.Join("testdata", "contracts", tc.name+".json")
+			if *updateContracts {
+				if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+					t.Fatalf("failed to create contracts directory: %v", err)
+				}
+				if err := os.WriteFile(golden, actual, 0o644); err != nil {
+					t.Fatalf("failed to write %s: %v", golden, err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("missing contract %s, run make contract-update: %v", golden, err)
+			}
+			assert.Equal(t, string(expected), string(actual), "response no longer matches %s", golden)
+		})
+	}
+}
+
+// TestContractsCoverEveryRoute keeps new routes from going without a contract
+func TestContractsCoverEveryRoute(t *testing.T) {
+	r, _ := setupContractRouter(t)
+
+	covered := map[string]bool{}
+	names := map[string]bool{}
+	for _, tc := range contractCases {
+		covered[tc.method+" "+tc.route] = true
+		assert.False(t, names[tc.name], "contract %s is defined twice", tc.name)
+		names[tc.name] = true
+	}
+	for _, route := range r.Routes() {
+		assert.True(t, covered[route.Method+" "+route.Path], "route %s %s has no contract case", route.Method, route.Path)
+	}
+}
+
+func setupContractRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+
+	db := testutil.DB(t)
+
+	callback := middleware.DefaultCallbackConfig()
+	callback.Token = contractCallbackToken
+	r := BuildRouter(Config{
+		TrackingSecret:    "test-secret",
+		AdminEmails:       []string{contractAdmin},
+		SMSCallback:       callback,
+		LogisticsCallback: callback,
+	}, Deps{
+		DB:    db,
+		SMS:   services.NewMockSMSService(),
+		Email: services.NewMockEmailService(),
+		Marketing: map[string]services.MarketingPlatform{
+			models.MarketingPlatformMailchimp: services.NewMockMarketingPlatform(),
+		},
+	})
+
+	// one request served, so the SLO report has a route group to show
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	return r, db
+}
+
+// seedContractState inserts the provider state every contract runs against
+func seedContractState(t *testing.T, db *gorm.DB, now time.Time) {
+	placed := now.Add(-2 * time.Hour)
+	productID := uint(1)
+	orderID := uint(1)
+	orderNumber := "ORD-2025-000001"
+	campaignMessageID := "ATXid_campaign_1"
+	deleted := gorm.DeletedAt{Time: now.Add(-time.Hour), Valid: true}
+	created := services.OrderCreatedEvent(models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: placed, Status: models.OrderStatusPending, CustomerID: 1, ProductID: &productID, Quantity: 1}, contractAdmin)
+	created.OrderID, created.Sequence = 1, 1
+
+	for _, record := range []interface{}{
+		&models.Customer{ID: 1, Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+		&models.Customer{ID: 2, Name: "Amina Hassan", Code: "CUST002", Phone: "+254711222333", Email: "amina@example.com"},
+		&models.Customer{ID: 3, Name: "Peter Kamau", Code: "CUST003", Phone: "+254733444555", Email: "peter@example.com", DeletedAt: deleted},
+		&models.Product{ID: 1, Name: "Laptop", SKU: "LAP-001", Price: models.Shillings(1500), StockQuantity: 5, LowStockThreshold: 5},
+		&models.Order{ID: 1, Number: &orderNumber, Item: "laptop", Amount: models.Shillings(1500), Time: placed, Status: models.OrderStatusPending, CustomerID: 1, ProductID: &productID, Quantity: 1},
+		&models.Order{ID: 2, Item: "charger", Amount: models.Shillings(200), Time: placed, Status: models.OrderStatusPending, CustomerID: 1, Quantity: 1},
+		&models.OrderRevision{OrderID: 1, Field: "amount", OldValue: "1600", NewValue: "1500", Actor: contractAdmin},
+		&created,
+		&models.ArchivedOrder{ID: 100, Item: "mouse", Amount: models.Shillings(50), Time: placed, Status: models.OrderStatusDelivered, CustomerID: 1, Quantity: 1, ArchivedAt: now},
+		&models.Rider{ID: 1, Name: "Brian Mwangi", Phone: "+254700111222", Active: true},
+		&models.DeliveryAssignment{ID: 1, OrderID: 1, RiderID: 1, Status: models.AssignmentStatusAssigned, AssignedBy: contractAdmin},
+		&models.CustomerNote{ID: 1, CustomerID: 1, Author: contractAdmin, Text: "asked for delivery after 5pm"},
+		&models.DeviceToken{ID: 1, CustomerID: 1, Token: "fcm-token-1", Platform: models.DevicePlatformAndroid},
+		&models.PushNotification{ID: 1, CustomerID: 1, OrderID: &orderID, Title: "Order confirmed", Body: "your order is confirmed", Status: models.PushStatusPending, SentAt: now},
+		&models.Saga{ID: 1, Kind: models.SagaKindOrderCreation, OrderID: 1, Status: models.SagaStatusCompleted, Steps: []models.SagaStep{
+			{Position: 1, Name: services.SagaStepCreateOrder, Critical: true, Status: models.SagaStepDone},
+			{Position: 2, Name: services.SagaStepNotifyCustomer, Status: models.SagaStepDone},
+		}},
+		&models.Quote{ID: 1, CustomerID: 1, Item: "charger", Quantity: 1, UnitPrice: models.Shillings(200), Amount: models.Shillings(200), TaxRate: 16, TaxInclusive: true, NetAmount: models.Shillings(172.41), TaxAmount: models.Shillings(27.59), GrossAmount: models.Shillings(200), Priority: models.OrderPriorityNormal, Status: models.QuoteStatusHeld, ExpiresAt: now.Add(15 * time.Minute)},
+		&models.BackfillRun{Name: "orders.placed_at", Table: "orders", LastID: 2, EndID: 2, RowsDone: 2, RowsTotal: 2, StartedAt: &placed, FinishedAt: &now},
+		&models.JobRun{Job: "daily_order_stats", Trigger: "schedule", Status: models.JobRunSucceeded, StartedAt: placed, FinishedAt: &placed, DurationMs: 120},
+		&models.APIKey{ID: 1, Name: "Acme Logistics", Prefix: "sav_0123abcd", KeyHash: "contract-key-hash", MonthlyQuota: 10000, CreatedBy: contractAdmin},
+		&models.WebhookSubscription{ID: 1, URL: "https://hooks.example.com/orders", Description: "warehouse", Events: []string{"order.created"}, Active: true, Secret: "whsec_contract", CreatedBy: contractAdmin},
+		&models.CustomerTag{CustomerID: 1, Tag: "vip", CreatedBy: contractAdmin},
+		&models.Campaign{ID: 1, Name: "Easter offer", Message: "Hi {first_name}, 10% off chargers today", Tags: []string{"vip"}, SendAt: placed, Status: models.CampaignSending, Recipients: 1, StartedAt: &placed, CreatedBy: contractAdmin},
+		&models.CampaignRecipient{CampaignID: 1, CustomerID: 1, Status: models.CampaignRecipientSent, ProviderMessageID: &campaignMessageID, SentAt: &placed},
+		&models.PromoCode{ID: 1, Code: "DEC-2026", Description: "December offer", Type: models.PromoCodeFixed, AmountOff: models.Shillings(200), Active: true, CreatedBy: contractAdmin},
+		&models.SegmentSync{ID: 1, Tag: "vip", Platform: models.MarketingPlatformMailchimp, Audience: "a1b2c3d4", Segment: "vip", Fields: map[string]string{"FNAME": "first_name"}, Active: true, CreatedBy: contractAdmin},
+		&models.APIUsage{APIKeyID: 1, Day: now.UTC().Format(services.DayLayout), Requests: 42},
+		&models.Policy{ID: 1, Role: "agent", Method: "DELETE", Path: "/api/v1/customers/:id", Effect: models.PolicyDeny, Description: "agents cannot delete customers", CreatedBy: contractAdmin},
+		&models.UserRole{Email: "clerk@example.com", Role: "agent", CreatedBy: contractAdmin},
+		&models.UserIdentity{ID: 1, Provider: "google", Subject: "108234567890", Email: "clerk@example.com", ProviderEmail: "clerk@example.com", Name: "Clerk", LastLoginAt: now},
+		&models.OrderDigest{ID: 1, Day: placed.Format(services.DayLayout), Trigger: "schedule", Status: models.DigestSent, Recipients: []string{contractAdmin}, OrdersCount: 1, Revenue: models.Shillings(1500), SMSSent: 2, SMSSegments: 2, SMSCost: models.Shillings(1.6),
+			Orders: []models.DigestOrder{{ID: 1, Time: placed, CustomerID: 1, Item: "laptop", Quantity: 1, Amount: models.Shillings(1500), Status: models.OrderStatusPending}}, CreatedAt: now, SentAt: &now},
+		&models.Session{ID: contractSessionID, UserEmail: contractAdmin, Subject: contractAdmin, Method: models.LoginMethodPassword, LastSeenAt: now, ExpiresAt: now.Add(24 * time.Hour)},
+	} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("failed to seed %T: %v", record, err)
+		}
+	}
+}
+
+// contractToken signs the admin in as an OIDC login would, with a session,
+// as the password login is off while admins are configured
+func contractToken(t *testing.T, db *gorm.DB) string {
+	claims := testutil.Claims(contractAdmin, time.Hour)
+	session := models.Session{
+		UserEmail: contractAdmin,
+		Subject:   contractAdmin,
+		Method:    models.LoginMethodOIDC,
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := services.NewSessionStore(db).Create(context.Background(), &session); err != nil {
+		t.Fatalf("failed to start session: %v", err)
+	}
+	claims.ID = session.ID
+	return testutil.Sign(t, claims, os.Getenv("JWT_SECRET"))
+}
+
+// contractShape replaces every value with its JSON type. Arrays become the
+// merged shape of their elements, and error codes are kept.
+func contractShape(v interface{}) interface{} {
+	shape := shapeOf(v)
+	if envelope, ok := v.(map[string]interface{}); ok {
+		if body, ok := envelope["error"].(map[string]interface{}); ok {
+			if code, ok := body["code"].(string); ok {
+				shape.(map[string]interface{})["error"].(map[string]interface{})["code"] = code
+			}
+		}
+	}
+	return shape
+}
+
+var timestampPattern = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}`)
+
+func shapeOf(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		shape := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			shape[key] = shapeOf(value)
+		}
+		return shape
+	case []interface{}:
+		var element interface{}
+		for i, value := range v {
+			if i == 0 {
+				element = shapeOf(value)
+				continue
+			}
+			element = mergeShapes(element, shapeOf(value))
+		}
+		if element == nil {
+			return []interface{}{}
+		}
+		return []interface{}{element}
+	case string:
+		if timestampPattern.MatchString(v) {
+			return "timestamp"
+		}
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// mergeShapes combines the shapes of two array elements, listing every type
+// a field took
+func mergeShapes(a, b interface{}) interface{} {
+	objectA, okA := a.(map[string]interface{})
+	objectB, okB := b.(map[string]interface{})
+	if okA && okB {
+		merged := make(map[string]interface{}, len(objectA))
+		for key, value := range objectA {
+			merged[key] = value
+		}
+		for key, value := range objectB {
+			if existing, ok := merged[key]; ok {
+				value = mergeShapes(existing, value)
+			}
+			merged[key] = value
+		}
+		return merged
+	}
+
+	typeA, okA := a.(string)
+	typeB, okB := b.(string)
+	if !okA || !okB {
+		// arrays and mixed kinds keep the first element's shape
+		return a
+	}
+	types := map[string]bool{}
+	for _, name := range append(strings.Split(typeA, "|"), strings.Split(typeB, "|")...) {
+		types[name] = true
+	}
+	names := make([]string, 0, len(types))
+	for name := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, "|")
+}
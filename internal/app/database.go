@@ -0,0 +1,190 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/migrations"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverMySQL    = "mysql"
+	DriverSQLite   = "sqlite"
+)
+
+// DatabaseConfig selects the database the API runs on
+type DatabaseConfig struct {
+	Driver string
+	DSN    string
+	// Replicas are DSNs of read replicas of DSN, on the same driver. Reads
+	// are spread over them; see OpenReplicas.
+	Replicas []string
+
+	// Lazy skips the ping on open, so the first query connects instead
+	Lazy bool
+	// pool limits; zero keeps the database/sql default
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxIdleTime time.Duration
+	ConnMaxLifetime time.Duration
+}
+
+// DatabaseConfigFromEnv reads DB_DRIVER (postgres, mysql or sqlite, default
+// postgres) and DATABASE_URL, falling back to a local database per driver,
+// the comma separated DATABASE_REPLICA_URLS, and the pool limits
+// DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_IDLE_TIME and
+// DB_CONN_MAX_LIFETIME
+func DatabaseConfigFromEnv() DatabaseConfig {
+	cfg := DatabaseConfig{
+		Driver: strings.ToLower(strings.TrimSpace(os.Getenv("DB_DRIVER"))),
+		DSN:    os.Getenv("DATABASE_URL"),
+	}
+	cfg.MaxOpenConns, _ = strconv.Atoi(os.Getenv("DB_MAX_OPEN_CONNS"))
+	cfg.MaxIdleConns, _ = strconv.Atoi(os.Getenv("DB_MAX_IDLE_CONNS"))
+	cfg.ConnMaxIdleTime, _ = time.ParseDuration(os.Getenv("DB_CONN_MAX_IDLE_TIME"))
+	cfg.ConnMaxLifetime, _ = time.ParseDuration(os.Getenv("DB_CONN_MAX_LIFETIME"))
+	if cfg.Driver == "" {
+		cfg.Driver = DriverPostgres
+	}
+	for _, dsn := range strings.Split(os.Getenv("DATABASE_REPLICA_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			cfg.Replicas = append(cfg.Replicas, dsn)
+		}
+	}
+
+	if cfg.DSN == "" {
+		switch cfg.Driver {
+		case DriverPostgres:
+			cfg.DSN = "host=localhost user=savannah password=savannah dbname=savannah port=5432 sslmode=disable"
+		case DriverMySQL:
+			cfg.DSN = "savannah:savannah@tcp(localhost:3306)/savannah"
+		case DriverSQLite:
+			cfg.DSN = "savannah.db"
+		}
+	}
+	return cfg
+}
+
+// OpenDatabase connects with the configured driver. It does not migrate.
+func OpenDatabase(cfg DatabaseConfig) (*gorm.DB, error) {
+	var dialector gorm.Dialector
+
+	switch cfg.Driver {
+	case DriverPostgres:
+		dialector = postgres.Open(cfg.DSN)
+	case DriverMySQL:
+		dialector = mysql.New(mysql.Config{
+			DSN: mysqlDSN(cfg.DSN),
+			// string columns would otherwise be longtext, which MySQL
+			// cannot put a unique index on. Free text fields are tagged
+			// type:text so they are not capped.
+			DefaultStringSize: 191,
+		})
+	case DriverSQLite:
+		dialector = sqlite.Open(cfg.DSN)
+	default:
+		return nil, fmt.Errorf("unsupported DB_DRIVER %q, use postgres, mysql or sqlite", cfg.Driver)
+	}
+
+	db, err := gorm.Open(dialector, &gorm.Config{DisableAutomaticPing: cfg.Lazy})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s database: %w", cfg.Driver, err)
+	}
+	// every instance writes both columns of a rename in progress, including
+	// those started before the rename was migrated
+	if err := migrations.RegisterRenames(db, migrations.Renames...); err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Driver == DriverSQLite {
+		// SQLite allows one writer at a time; a single connection queues
+		// writes from background jobs instead of failing with "database is
+		// locked"
+		sqlDB.SetMaxOpenConns(1)
+	} else if cfg.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	if cfg.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	}
+	if cfg.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+	if cfg.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	}
+
+	return db, nil
+}
+
+// OpenReplicas connects to the configured replicas, with the primary's pool
+// limits, and sends db's reads to them. Reads stay on the primary when
+// their context comes from scopes.WithPrimary, which is how clients read
+// their own writes. The returned connections are closed by the caller.
+func OpenReplicas(db *gorm.DB, cfg DatabaseConfig) ([]*sql.DB, error) {
+	var pools []gorm.ConnPool
+	var conns []*sql.DB
+	closeAll := func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}
+
+	for i, dsn := range cfg.Replicas {
+		replicaCfg := cfg
+		replicaCfg.DSN, replicaCfg.Replicas = dsn, nil
+		replica, err := OpenDatabase(replicaCfg)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		conn, err := replica.DB()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		conns = append(conns, conn)
+		pools = append(pools, conn)
+	}
+
+	if err := scopes.UseReplicas(db, pools...); err != nil {
+		closeAll()
+		return nil, err
+	}
+	return conns, nil
+}
+
+// mysqlDSN makes DATETIME columns scan into time.Time and stores text as
+// utf8mb4, unless the DSN already sets parseTime or charset
+func mysqlDSN(dsn string) string {
+	params := []string{}
+	if !strings.Contains(dsn, "parseTime=") {
+		params = append(params, "parseTime=true")
+	}
+	if !strings.Contains(dsn, "charset=") {
+		params = append(params, "charset=utf8mb4")
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + strings.Join(params, "&")
+}
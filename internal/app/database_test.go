@@ -0,0 +1,117 @@
+package app
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name           string
+		driver         string
+		url            string
+		expectedDriver string
+		expectedDSN    string
+	}{
+		{name: "defaults to local postgres", expectedDriver: DriverPostgres, expectedDSN: "host=localhost user=savannah password=savannah dbname=savannah port=5432 sslmode=disable"},
+		{name: "sqlite file by default", driver: "SQLite", expectedDriver: DriverSQLite, expectedDSN: "savannah.db"},
+		{name: "database url wins", driver: "mysql", url: "user:pass@tcp(db:3306)/orders", expectedDriver: DriverMySQL, expectedDSN: "user:pass@tcp(db:3306)/orders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DB_DRIVER", tt.driver)
+			t.Setenv("DATABASE_URL", tt.url)
+
+			cfg := DatabaseConfigFromEnv()
+			assert.Equal(t, tt.expectedDriver, cfg.Driver)
+			assert.Equal(t, tt.expectedDSN, cfg.DSN)
+		})
+	}
+}
+
+func TestOpenDatabase(t *testing.T) {
+	db, err := OpenDatabase(DatabaseConfig{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "savannah.db")})
+	assert.NoError(t, err)
+	assert.NoError(t, models.Migrate(db))
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	assert.NoError(t, db.Create(&customer).Error)
+	assert.NoError(t, db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), CustomerID: customer.ID}).Error)
+
+	// migrating an existing database is a no-op
+	assert.NoError(t, models.Migrate(db))
+
+	_, err = OpenDatabase(DatabaseConfig{Driver: "oracle", DSN: "x"})
+	assert.ErrorContains(t, err, "unsupported DB_DRIVER")
+}
+
+type floatProduct struct {
+	ID    uint
+	Name  string
+	SKU   string
+	Price float64
+}
+
+func (floatProduct) TableName() string { return "products" }
+
+func TestMigrateAmountsToCents(t *testing.T) {
+	db, err := OpenDatabase(DatabaseConfig{Driver: DriverSQLite, DSN: filepath.Join(t.TempDir(), "savannah.db")})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&floatProduct{}))
+	assert.NoError(t, db.Create(&floatProduct{Name: "Laptop", SKU: "LAP-001", Price: 1499.9}).Error)
+	assert.NoError(t, db.Create(&floatProduct{Name: "Cable", SKU: "CAB-001", Price: 0.1 + 0.2}).Error)
+
+	assert.NoError(t, models.Migrate(db))
+	// a second run finds BIGINT columns and leaves them alone
+	assert.NoError(t, models.Migrate(db))
+
+	var products []models.Product
+	assert.NoError(t, db.Order("id").Find(&products).Error)
+	if assert.Len(t, products, 2) {
+		assert.Equal(t, models.Money(149990), products[0].Price)
+		assert.Equal(t, models.Money(30), products[1].Price)
+	}
+	columns, _ := db.Migrator().ColumnTypes(&models.Product{})
+	for _, column := range columns {
+		if column.Name() == "price" {
+			assert.Equal(t, "bigint", strings.ToLower(column.DatabaseTypeName()))
+		}
+	}
+}
+
+func TestOpenDatabaseLazily(t *testing.T) {
+	t.Setenv("DB_DRIVER", DriverPostgres)
+	t.Setenv("DATABASE_URL", "host=127.0.0.1 port=1 user=savannah dbname=savannah sslmode=disable connect_timeout=1")
+	t.Setenv("DB_MAX_OPEN_CONNS", "4")
+	t.Setenv("DB_MAX_IDLE_CONNS", "2")
+	t.Setenv("DB_CONN_MAX_IDLE_TIME", "1m")
+
+	cfg := DatabaseConfigFromEnv()
+	assert.Equal(t, 4, cfg.MaxOpenConns)
+	assert.Equal(t, 2, cfg.MaxIdleConns)
+	assert.Equal(t, time.Minute, cfg.ConnMaxIdleTime)
+
+	// nothing listens on the port, so only a lazy open succeeds
+	_, err := OpenDatabase(cfg)
+	assert.Error(t, err)
+
+	cfg.Lazy = true
+	db, err := OpenDatabase(cfg)
+	assert.NoError(t, err)
+	sqlDB, _ := db.DB()
+	assert.Equal(t, 4, sqlDB.Stats().MaxOpenConnections)
+	assert.Error(t, db.Exec("SELECT 1").Error, "the first query connects")
+	sqlDB.Close()
+}
+
+func TestMySQLDSN(t *testing.T) {
+	assert.Equal(t, "u:p@tcp(db)/app?parseTime=true&charset=utf8mb4", mysqlDSN("u:p@tcp(db)/app"))
+	assert.Equal(t, "u:p@tcp(db)/app?tls=true&charset=latin1&parseTime=true", mysqlDSN("u:p@tcp(db)/app?tls=true&charset=latin1"))
+	assert.Equal(t, "u:p@tcp(db)/app?parseTime=false&charset=utf8", mysqlDSN("u:p@tcp(db)/app?parseTime=false&charset=utf8"))
+}
@@ -0,0 +1,252 @@
+package app
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/features"
+	"github.com/SebbieMzingKe/customer-order-api/internal/jobs"
+	"github.com/SebbieMzingKe/customer-order-api/internal/migrations"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+)
+
+// BuildScheduler registers the background jobs run by the long-lived server,
+// recording each run in the job_runs table. Serverless entrypoints do not
+// start it, and their jobs only run when an admin triggers them.
+func BuildScheduler(cfg Config, deps Deps) *jobs.Scheduler {
+	scheduler := jobs.NewScheduler().WithHistory(services.NewJobHistory(deps.DB))
+
+	reports := services.NewReportService(deps.DB, cfg.ReportLocation)
+	scheduler.Register(jobs.Job{
+		Name:     "daily_order_stats",
+		Interval: cfg.ReportsRefreshInterval,
+		Run: func(ctx context.Context) error {
+			// refresh yesterday as well so late updates around midnight land
+			now := time.Now()
+			return reports.RefreshDailyStats(ctx, now.AddDate(0, 0, -1), now)
+		},
+	})
+
+	archive := services.NewArchiveService(deps.DB, cfg.OrderArchiveAfter)
+	scheduler.Register(jobs.Job{
+		Name:     "order_archival",
+		Interval: cfg.OrderArchiveInterval,
+		Run: func(ctx context.Context) error {
+			moved, err := archive.ArchiveOrders(ctx)
+			if moved > 0 {
+				log.Printf("archived %d orders", moved)
+			}
+			return err
+		},
+	})
+
+	sla := services.NewSLAService(deps.DB, deps.SMS, cfg.OpsPhones, cfg.SLAPolicy)
+	scheduler.Register(jobs.Job{
+		Name:     "order_sla_check",
+		Interval: cfg.SLACheckInterval,
+		Run: func(ctx context.Context) error {
+			breached, escalated, err := sla.Check(ctx)
+			if breached > 0 || escalated > 0 {
+				log.Printf("sla check: %d orders breached, %d escalated", breached, escalated)
+			}
+			return err
+		},
+	})
+
+	sagas := services.NewSagaCoordinator(deps.DB)
+	scheduler.Register(jobs.Job{
+		Name:     "saga_recovery",
+		Interval: cfg.SagaRecoveryInterval,
+		Run: func(ctx context.Context) error {
+			recovered, err := sagas.Recover(ctx, cfg.SagaStaleAfter)
+			if recovered > 0 {
+				log.Printf("recovered %d interrupted sagas", recovered)
+			}
+			return err
+		},
+	})
+
+	scheduler.Register(jobs.Job{
+		Name:     "quote_expiry",
+		Interval: cfg.QuoteExpiryInterval,
+		Run: func(ctx context.Context) error {
+			expired, err := services.ExpireQuotes(ctx, deps.DB)
+			if expired > 0 {
+				log.Printf("expired %d quotes", expired)
+			}
+			return err
+		},
+	})
+
+	anomalies := services.NewAnomalyService(deps.DB, deps.SMS, cfg.AnomalyAlertPhones, cfg.AnomalyPolicy)
+	scheduler.Register(jobs.Job{
+		Name:     "order_amount_anomalies",
+		Interval: cfg.AnomalyCheckInterval,
+		Run: func(ctx context.Context) error {
+			flagged, err := anomalies.Check(ctx)
+			if flagged > 0 {
+				log.Printf("flagged %d orders with unusual amounts", flagged)
+			}
+			return err
+		},
+	})
+
+	if cfg.WinBackPolicy.Enabled() {
+		winBack := services.NewWinBackService(deps.DB, deps.SMS, cfg.WinBackPolicy)
+		scheduler.Register(jobs.Job{
+			Name:     "win_back_campaign",
+			Interval: cfg.WinBackInterval,
+			Run: func(ctx context.Context) error {
+				sent, err := winBack.Run(ctx)
+				if sent > 0 {
+					log.Printf("sent %d win-back messages", sent)
+				}
+				return err
+			},
+		})
+	}
+
+	if cfg.GreetingPolicy.Enabled() {
+		flags := deps.Flags
+		if flags == nil {
+			flags = features.NewStore(deps.DB, 0)
+		}
+		greetings := services.NewGreetingService(deps.DB, deps.SMS, cfg.GreetingPolicy, cfg.ReportLocation).WithFlags(flags)
+		scheduler.Register(jobs.Job{
+			Name:     "greeting_campaigns",
+			Interval: cfg.GreetingInterval,
+			Run: func(ctx context.Context) error {
+				sent, err := greetings.Run(ctx)
+				if sent > 0 {
+					log.Printf("sent %d greeting messages", sent)
+				}
+				return err
+			},
+		})
+	}
+
+	campaigns := services.NewCampaignService(deps.DB, deps.SMS, cfg.CampaignPolicy)
+	scheduler.Register(jobs.Job{
+		Name:     "sms_campaigns",
+		Interval: cfg.CampaignInterval,
+		Run: func(ctx context.Context) error {
+			sent, err := campaigns.Run(ctx)
+			if sent > 0 {
+				log.Printf("sent %d campaign messages", sent)
+			}
+			return err
+		},
+	})
+
+	if cfg.OrderProjection {
+		projection := services.NewOrderProjection(deps.DB)
+		scheduler.Register(jobs.Job{
+			Name:     "order_projection",
+			Interval: cfg.OrderProjectionInterval,
+			Run: func(ctx context.Context) error {
+				projected, err := projection.Run(ctx)
+				if projected > 0 {
+					log.Printf("projected events of %d orders", projected)
+				}
+				return err
+			},
+		})
+	}
+
+	backfills := migrations.NewRunner(deps.DB, migrations.Backfills()...).WithPause(cfg.BackfillPause)
+	scheduler.Register(jobs.Job{
+		Name:     "schema_backfills",
+		Interval: cfg.BackfillInterval,
+		Run: func(ctx context.Context) error {
+			updated, err := backfills.Run(ctx)
+			if updated > 0 {
+				log.Printf("backfilled %d rows", updated)
+			}
+			return err
+		},
+	})
+
+	webhooks := services.NewWebhookService(deps.DB, cfg.WebhookInterval)
+	scheduler.Register(jobs.Job{
+		Name:     "webhook_delivery",
+		Interval: cfg.WebhookInterval,
+		Run: func(ctx context.Context) error {
+			delivered, err := webhooks.Deliver(ctx)
+			if delivered > 0 {
+				log.Printf("delivered %d order events to webhooks", delivered)
+			}
+			return err
+		},
+	})
+
+	if len(deps.Marketing) > 0 {
+		segments := services.NewSegmentService(deps.DB, deps.Marketing)
+		scheduler.Register(jobs.Job{
+			Name:     "segment_sync",
+			Interval: cfg.SegmentSyncInterval,
+			Run: func(ctx context.Context) error {
+				changed, err := segments.RunAll(ctx)
+				if changed > 0 {
+					log.Printf("synced %d customers to marketing platforms", changed)
+				}
+				return err
+			},
+		})
+	}
+
+	if failures := smsFailures(deps.SMS); failures != nil {
+		alerter := services.NewSMSFailureAlerter(failures, deps.SMS, cfg.OpsPhones, cfg.SMSFailureAlerts)
+		scheduler.Register(jobs.Job{
+			Name:     "sms_failure_alert",
+			Interval: cfg.SMSFailureCheckInterval,
+			Run: func(ctx context.Context) error {
+				_, err := alerter.Check(ctx)
+				return err
+			},
+		})
+	}
+
+	if deps.Push != nil {
+		pushes := services.NewPushNotifier(deps.DB, deps.Push, deps.SMS, cfg.PushPolicy)
+		scheduler.Register(jobs.Job{
+			Name:     "push_fallback",
+			Interval: cfg.PushFallbackInterval,
+			Run: func(ctx context.Context) error {
+				texted, err := pushes.FallBack(ctx)
+				if texted > 0 {
+					log.Printf("texted %d unacknowledged push notifications", texted)
+				}
+				return err
+			},
+		})
+	}
+
+	if deps.Email != nil && len(cfg.DigestRecipients) > 0 {
+		digests := services.NewDigestService(deps.DB, deps.Email, cfg.ReportLocation, cfg.DigestRecipients)
+		scheduler.Register(jobs.Job{
+			Name:     "order_digest",
+			Interval: cfg.DigestInterval,
+			Run: func(ctx context.Context) error {
+				sent, err := digests.SendScheduled(ctx)
+				if sent && err == nil {
+					log.Printf("emailed the orders digest to %d recipients", len(cfg.DigestRecipients))
+				}
+				return err
+			},
+		})
+	}
+
+	if deps.Secrets != nil {
+		scheduler.Register(jobs.Job{
+			Name:     "secrets_refresh",
+			Interval: deps.Secrets.RefreshInterval(),
+			Run: func(ctx context.Context) error {
+				_, err := deps.Secrets.Refresh(ctx)
+				return err
+			},
+		})
+	}
+
+	return scheduler
+}
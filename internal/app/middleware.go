@@ -0,0 +1,96 @@
+package app
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// MiddlewareConfig switches the optional middleware every request passes
+// through. Request ids, error handling, SLO and load tracking and no-store
+// caching always run; the zero value runs everything but CORS and the
+// request timeout.
+type MiddlewareConfig struct {
+	AccessLogDisabled       bool
+	SecurityHeadersDisabled bool
+	// RequestTimeout is the deadline of every request but untimedRoutes;
+	// 0 for none
+	RequestTimeout time.Duration
+	// CORS lets browsers on any origin call the API with a bearer token
+	CORS bool
+	// HSTS shapes the Strict-Transport-Security header sent with the
+	// security headers, and whether plain HTTP is redirected
+	HSTS middleware.HSTSConfig
+}
+
+// MiddlewareConfigFromEnv reads ACCESS_LOG_DISABLED,
+// SECURITY_HEADERS_DISABLED, REQUEST_TIMEOUT (default 30s, 0 for none),
+// CORS_ENABLED and the HSTS settings
+func MiddlewareConfigFromEnv() MiddlewareConfig {
+	var cfg MiddlewareConfig
+	cfg.HSTS = middleware.HSTSConfigFromEnv()
+	cfg.AccessLogDisabled, _ = strconv.ParseBool(os.Getenv("ACCESS_LOG_DISABLED"))
+	cfg.SecurityHeadersDisabled, _ = strconv.ParseBool(os.Getenv("SECURITY_HEADERS_DISABLED"))
+	cfg.CORS, _ = strconv.ParseBool(os.Getenv("CORS_ENABLED"))
+
+	cfg.RequestTimeout = 30 * time.Second
+	if timeout, err := time.ParseDuration(os.Getenv("REQUEST_TIMEOUT")); err == nil && timeout >= 0 {
+		cfg.RequestTimeout = timeout
+	}
+	return cfg
+}
+
+// untimedRoutes stream their response for as long as the client reads it,
+// so they get no request timeout
+var untimedRoutes = []string{
+	"/api/v1/customers/stream.ndjson",
+	"/api/v1/orders/stream.ndjson",
+}
+
+type namedMiddleware struct {
+	name    string
+	handler gin.HandlerFunc
+}
+
+// globalMiddleware is the chain every request passes through, in order.
+// The request id comes first so everything after can log it; the access
+// log wraps error handling so a panic is logged as the 500 it is answered with,
+// and the SLO tracker counts it; every request is in flight for the load
+// monitor until it is answered; the timeout is inside all three, so a
+// request that runs out of time is logged, counted and answered as the
+// 503 it is; plain HTTP is redirected before anything
+// is served over it; CORS answers preflights before anything is
+// compressed; and no-store is last so handlers can override it.
+func globalMiddleware(cfg Config, proxies *middleware.Proxies, slo *services.SLOTracker, load *services.LoadMonitor) []namedMiddleware {
+	chain := []namedMiddleware{
+		{"request_id", middleware.RequestID()},
+	}
+	if !cfg.Middleware.AccessLogDisabled {
+		chain = append(chain, namedMiddleware{"access_log", middleware.AccessLog()})
+	}
+	chain = append(chain,
+		namedMiddleware{"errors", middleware.Errors()},
+		namedMiddleware{"slo", middleware.SLO(slo)},
+		namedMiddleware{"load", middleware.TrackLoad(load)},
+	)
+	if cfg.Middleware.RequestTimeout > 0 {
+		chain = append(chain, namedMiddleware{"timeout", middleware.Timeout(cfg.Middleware.RequestTimeout, untimedRoutes...)})
+	}
+	if cfg.Middleware.HSTS.Enforce {
+		chain = append(chain, namedMiddleware{"https_redirect", middleware.HTTPSRedirect(proxies)})
+	}
+	if !cfg.Middleware.SecurityHeadersDisabled {
+		chain = append(chain, namedMiddleware{"security_headers", middleware.SecurityHeaders(cfg.Middleware.HSTS, proxies)})
+	}
+	if cfg.Middleware.CORS {
+		chain = append(chain, namedMiddleware{"cors", middleware.CORSMiddleware()})
+	}
+	return append(chain,
+		namedMiddleware{"compress", middleware.Compress(cfg.Compression)},
+		namedMiddleware{"no_store", middleware.NoStore()},
+	)
+}
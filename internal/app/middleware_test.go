@@ -0,0 +1,224 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGlobalMiddlewareOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      MiddlewareConfig
+		expected []string
+	}{
+		{
+			name:     "defaults",
+			expected: []string{"request_id", "access_log", "errors", "slo", "load", "security_headers", "compress", "no_store"},
+		},
+		{
+			name:     "everything",
+			cfg:      MiddlewareConfig{CORS: true, HSTS: middleware.HSTSConfig{Enforce: true}, RequestTimeout: 30 * time.Second},
+			expected: []string{"request_id", "access_log", "errors", "slo", "load", "timeout", "https_redirect", "security_headers", "cors", "compress", "no_store"},
+		},
+		{
+			name:     "optional middleware disabled",
+			cfg:      MiddlewareConfig{AccessLogDisabled: true, SecurityHeadersDisabled: true},
+			expected: []string{"request_id", "errors", "slo", "load", "compress", "no_store"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := globalMiddleware(Config{Middleware: tt.cfg}, nil, services.NewSLOTracker(services.SLOConfig{}), services.NewLoadMonitor(services.LoadShedConfig{}))
+
+			names := make([]string, len(chain))
+			for i, m := range chain {
+				names[i] = m.name
+			}
+			assert.Equal(t, tt.expected, names)
+		})
+	}
+}
+
+func TestBuildRouterMiddleware(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	deps := Deps{DB: db, SMS: services.NewMockSMSService()}
+
+	tests := []struct {
+		name            string
+		cfg             MiddlewareConfig
+		method          string
+		expectedStatus  int
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "security headers",
+			method:         "GET",
+			expectedStatus: http.StatusUnauthorized,
+			expectedHeaders: map[string]string{
+				"X-Content-Type-Options":      "nosniff",
+				"X-Frame-Options":             "DENY",
+				"Access-Control-Allow-Origin": "",
+			},
+		},
+		{
+			name:            "security headers disabled",
+			cfg:             MiddlewareConfig{SecurityHeadersDisabled: true},
+			method:          "GET",
+			expectedStatus:  http.StatusUnauthorized,
+			expectedHeaders: map[string]string{"X-Content-Type-Options": ""},
+		},
+		{
+			name:            "cors preflight skips auth",
+			cfg:             MiddlewareConfig{CORS: true},
+			method:          "OPTIONS",
+			expectedStatus:  http.StatusNoContent,
+			expectedHeaders: map[string]string{"Access-Control-Allow-Origin": "*"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := BuildRouter(Config{TrackingSecret: "test-secret", Middleware: tt.cfg}, deps)
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/api/v1/customers", nil)
+			req.Header.Set("Origin", "https://shop.example.com")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			for header, value := range tt.expectedHeaders {
+				assert.Equal(t, value, w.Header().Get(header), header)
+			}
+			assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+		})
+	}
+}
+
+func TestBuildRouterTrustedProxies(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	deps := Deps{DB: db, SMS: services.NewMockSMSService()}
+
+	cfg := Config{
+		TrackingSecret: "test-secret",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		ClientIPHeader: "Cf-Connecting-Ip",
+		Middleware:     MiddlewareConfig{HSTS: middleware.DefaultHSTSConfig()},
+	}
+	cfg.Middleware.HSTS.Enforce = true
+	r := BuildRouter(cfg, deps)
+	r.GET("/test/client-ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	tests := []struct {
+		name             string
+		remoteAddr       string
+		proto            string
+		expectedStatus   int
+		expectedHSTS     string
+		expectedLocation string
+		expectedIP       string
+	}{
+		{
+			name:           "https from a trusted proxy",
+			remoteAddr:     "10.1.2.3:40000",
+			proto:          "https",
+			expectedStatus: http.StatusOK,
+			expectedHSTS:   "max-age=31536000; includeSubDomains",
+			expectedIP:     "203.0.113.7",
+		},
+		{
+			name:             "plain http from a trusted proxy is redirected",
+			remoteAddr:       "10.1.2.3:40000",
+			proto:            "http",
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "https://api.example.com/test/client-ip?x=1",
+		},
+		{
+			name:           "headers from anyone else are ignored",
+			remoteAddr:     "198.51.100.9:40000",
+			proto:          "http",
+			expectedStatus: http.StatusOK,
+			expectedIP:     "198.51.100.9",
+		},
+		{
+			name:           "https claimed by anyone else",
+			remoteAddr:     "198.51.100.9:40000",
+			proto:          "https",
+			expectedStatus: http.StatusOK,
+			expectedIP:     "198.51.100.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "http://api.example.com/test/client-ip?x=1", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			req.Header.Set("CF-Connecting-IP", "203.0.113.7")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedHSTS, w.Header().Get("Strict-Transport-Security"))
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+			if tt.expectedIP != "" {
+				assert.Equal(t, tt.expectedIP, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBuildRouterNoTrustedProxies(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	deps := Deps{DB: db, SMS: services.NewMockSMSService()}
+
+	cfg := Config{
+		TrackingSecret: "test-secret",
+		Middleware:     MiddlewareConfig{HSTS: middleware.DefaultHSTSConfig()},
+	}
+	r := BuildRouter(cfg, deps)
+	r.GET("/test/client-ip", func(c *gin.Context) {
+		c.String(http.StatusOK, c.ClientIP())
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/test/client-ip", nil)
+	req.RemoteAddr = "198.51.100.9:40000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "198.51.100.9", w.Body.String(), "unset, no peer is believed about the client")
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+}
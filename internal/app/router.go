@@ -0,0 +1,373 @@
+package app
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/authz"
+	"github.com/SebbieMzingKe/customer-order-api/internal/features"
+	"github.com/SebbieMzingKe/customer-order-api/internal/handlers"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/validation"
+	"github.com/gin-gonic/gin"
+)
+
+// BuildRouter registers every route and middleware. All entrypoints (the
+// standalone server and the serverless handler) must use it so routes only
+// need to be added in one place.
+func BuildRouter(cfg Config, deps Deps) *gin.Engine {
+	if deps.Flags == nil {
+		deps.Flags = features.NewStore(deps.DB, 0)
+	}
+	if deps.Scheduler == nil {
+		deps.Scheduler = BuildScheduler(cfg, deps)
+	}
+	validation.SetLimits(cfg.Validation)
+
+	// with no secret, links are not issued rather than signed with an
+	// empty key
+	trackingService, err := services.NewTrackingService(cfg.TrackingSecret, cfg.PublicBaseURL, cfg.TrackingTTL)
+	if err != nil {
+		log.Printf("no TRACKING_SECRET or JWT_SECRET set, tracking links will not be issued: %v", err)
+	}
+	auditLogger := services.NewAuditLogger(deps.DB)
+	sessionStore := services.NewSessionStore(deps.DB)
+	apiKeys := services.NewAPIKeyStore(deps.DB)
+
+	customerHandler := handlers.NewCustomerHandler(deps.DB).WithAudit(auditLogger)
+	orderHandler := handlers.NewOrderHandler(deps.DB, deps.SMS).
+		WithTracking(trackingService).
+		WithLowStockAlerts(cfg.AdminPhones).
+		WithResendLimit(cfg.NotificationResendLimit, cfg.NotificationResendWindow).
+		WithSLAPolicy(cfg.SLAPolicy).
+		WithTaxPolicy(cfg.TaxPolicy).
+		WithOrderNumbers(cfg.OrderNumbers).
+		WithSMSLengthPolicy(cfg.SMSLength).
+		WithQuoteHold(cfg.QuoteHold).
+		WithCachePurger(deps.Purger)
+	if deps.Push != nil {
+		orderHandler.WithNotifier(services.NewPushNotifier(deps.DB, deps.Push, deps.SMS, cfg.PushPolicy))
+	}
+	productHandler := handlers.NewProductHandler(deps.DB).
+		WithCachePolicy(cfg.CachePolicy).
+		WithCachePurger(deps.Purger)
+	trackingHandler := handlers.NewTrackingHandler(deps.DB, trackingService).WithCachePolicy(cfg.CachePolicy)
+	campaignService := services.NewCampaignService(deps.DB, deps.SMS, cfg.CampaignPolicy)
+	campaignHandler := handlers.NewCampaignHandler(campaignService).WithAudit(auditLogger)
+	smsCallbackHandler := handlers.NewSMSCallbackHandler(deps.DB, deps.SMS).WithCampaigns(campaignService)
+	smsCallbacks := middleware.NewCallbackVerifier("sms", cfg.SMSCallback)
+	logisticsHandler := handlers.NewLogisticsHandler(deps.DB, deps.SMS).WithCachePurger(deps.Purger)
+	logisticsCallbacks := middleware.NewCallbackVerifier("3pl", cfg.LogisticsCallback)
+	if deps.Push != nil {
+		logisticsHandler.WithNotifier(services.NewPushNotifier(deps.DB, deps.Push, deps.SMS, cfg.PushPolicy))
+	}
+	identities := services.NewIdentityStore(deps.DB)
+	authHandler := handlers.NewAuthHandler().WithSessions(sessionStore, auditLogger).WithIdentities(identities).WithCookies(cfg.AuthCookies).WithTokens(cfg.Tokens)
+	// admin access follows the token's email, which the password login
+	// takes on trust
+	if hasAdmins(cfg.AdminEmails) {
+		authHandler.WithoutPasswordLogin()
+	}
+	identityHandler := handlers.NewIdentityHandler(identities).WithAudit(auditLogger)
+	sessionHandler := handlers.NewSessionHandler(sessionStore).WithAudit(auditLogger)
+	reportService := services.NewReportService(deps.DB, cfg.ReportLocation)
+	reportHandler := handlers.NewReportHandler(reportService).
+		WithWinBack(services.NewWinBackService(deps.DB, deps.SMS, cfg.WinBackPolicy))
+	statementLinks, err := services.NewStatementLinks(cfg.TrackingSecret, cfg.PublicBaseURL, cfg.StatementLinkTTL)
+	if err != nil {
+		log.Printf("no TRACKING_SECRET or JWT_SECRET set, statement links will not be issued: %v", err)
+	}
+	statementHandler := handlers.NewStatementHandler(deps.DB, reportService, statementLinks, deps.SMS)
+	featureHandler := handlers.NewFeatureHandler(deps.Flags)
+	noteHandler := handlers.NewNoteHandler(deps.DB)
+	deviceHandler := handlers.NewDeviceHandler(deps.DB)
+	riderHandler := handlers.NewRiderHandler(deps.DB, deps.SMS).
+		WithSMSLengthPolicy(cfg.SMSLength).
+		WithCachePurger(deps.Purger)
+	sagaHandler := handlers.NewSagaHandler(deps.DB).WithAudit(auditLogger)
+	migrationHandler := handlers.NewMigrationHandler(deps.DB)
+	jobHandler := handlers.NewJobHandler(deps.DB, deps.Scheduler).WithAudit(auditLogger)
+	digestHandler := handlers.NewDigestHandler(deps.DB, services.NewDigestService(deps.DB, deps.Email, cfg.ReportLocation, cfg.DigestRecipients)).WithAudit(auditLogger)
+	smsFailureHandler := handlers.NewSMSFailureHandler(smsFailures(deps.SMS))
+	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeys).WithAudit(auditLogger)
+	segmentHandler := handlers.NewSegmentHandler(deps.DB, services.NewSegmentService(deps.DB, deps.Marketing)).WithAudit(auditLogger)
+	promoCodeHandler := handlers.NewPromoCodeHandler(services.NewPromoCodeService(deps.DB)).WithAudit(auditLogger)
+	webhookHandler := handlers.NewWebhookHandler(services.NewWebhookService(deps.DB, cfg.WebhookInterval)).WithAudit(auditLogger)
+	policies := authz.NewStore(deps.DB, 0).WithPolicies(cfg.Policies).WithAdmins(cfg.AdminEmails)
+	policyHandler := handlers.NewPolicyHandler(policies).WithAudit(auditLogger)
+	loginThrottle := middleware.NewLoginThrottle(cfg.LoginThrottle, auditLogger)
+	recentWriters := middleware.NewRecentWriters(cfg.ReadYourWritesWindow)
+	sloTracker := services.NewSLOTracker(cfg.SLO)
+	loadShed := cfg.LoadShed
+	if loadShed.MaxLatency <= 0 {
+		loadShed.MaxLatency = cfg.SLO.LatencyThreshold
+	}
+	loadMonitor := services.NewLoadMonitor(loadShed)
+	// reports and exports are the first to go when the server is busy
+	shed := middleware.ShedLoad(loadMonitor)
+	sloHandler := handlers.NewSLOHandler(sloTracker).WithMetricsToken(cfg.MetricsToken).WithOutboundMetrics(services.DefaultOutboundMetrics()).WithLoadMonitor(loadMonitor)
+
+	providers := map[string]services.ProviderHealthChecker{}
+	if checker, ok := deps.SMS.(services.ProviderHealthChecker); ok {
+		providers["sms_provider"] = checker
+	}
+	if authHandler.OIDCConfigured() {
+		providers["oidc_provider"] = authHandler
+	}
+	healthHandler := handlers.NewHealthHandler(deps.DB, providers)
+
+	r := gin.New()
+	// gin trusts every proxy until told otherwise, so an empty list is
+	// passed on too
+	proxies, err := middleware.NewProxies(cfg.TrustedProxies)
+	if err == nil {
+		err = r.SetTrustedProxies(cfg.TrustedProxies)
+	}
+	if err != nil {
+		log.Printf("invalid TRUSTED_PROXIES, trusting no proxy: %v", err)
+		r.SetTrustedProxies(nil)
+		proxies = nil
+	}
+	smsCallbacks.WithProxies(proxies)
+	logisticsCallbacks.WithProxies(proxies)
+	loginThrottle.WithProxies(proxies)
+	if cfg.ClientIPHeader != "" {
+		// read ahead of X-Forwarded-For, and only from trusted proxies
+		r.RemoteIPHeaders = append([]string{cfg.ClientIPHeader}, r.RemoteIPHeaders...)
+	}
+	for _, m := range globalMiddleware(cfg, proxies, sloTracker, loadMonitor) {
+		r.Use(m.handler)
+	}
+
+	r.HandleMethodNotAllowed = true
+	r.NoRoute(func(c *gin.Context) {
+		respond.Error(c, http.StatusNotFound, "not_found", "resource not found")
+	})
+	r.NoMethod(func(c *gin.Context) {
+		respond.Error(c, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	})
+
+	r.GET("/health", func(c *gin.Context) {
+		respond.OK(c, http.StatusOK, gin.H{"status": "ok"})
+	})
+	r.GET("/health/ready", healthHandler.Ready)
+	r.GET("/version", healthHandler.Version)
+	r.GET("/metrics", sloHandler.Metrics)
+
+	r.GET("/", func(c *gin.Context) {
+		respond.OK(c, http.StatusOK, gin.H{"status": "welcome to customer order api"})
+	})
+
+	r.GET("/track/:token", trackingHandler.Track)
+	r.GET("/statements/:token", statementHandler.GetSharedStatement)
+	r.GET("/catalog/products", productHandler.GetCatalog)
+	r.GET("/catalog/products/:id", productHandler.GetCatalogProduct)
+
+	// every provider callback changes state, so each provider's group is
+	// verified as a whole and new callbacks cannot be added unverified
+	callbacks := r.Group("/callbacks")
+	{
+		sms := callbacks.Group("/sms", smsCallbacks.Middleware())
+		sms.POST("/inbound", smsCallbackHandler.InboundSMS)
+		sms.POST("/delivery", smsCallbackHandler.DeliveryReport)
+	}
+
+	// courier webhooks move orders on, so they are verified like callbacks
+	integrations := r.Group("/integrations")
+	{
+		logistics := integrations.Group("/3pl", logisticsCallbacks.Middleware())
+		logistics.POST("/status", logisticsHandler.ShipmentStatus)
+	}
+
+	auth := r.Group("/auth")
+	{
+		auth.GET("/login", loginThrottle.Middleware(), authHandler.Login)
+		auth.GET("/callback", loginThrottle.Middleware(), authHandler.Callback)
+		auth.GET("/callback/:provider", loginThrottle.Middleware(), authHandler.Callback)
+		auth.GET("/providers", authHandler.Providers)
+		auth.GET("/userinfo", middleware.AuthMiddleware(cfg.Tokens), middleware.ActiveSession(sessionStore), authHandler.UserInfo)
+		auth.POST("/logout", middleware.AuthMiddleware(cfg.Tokens), middleware.ActiveSession(sessionStore), authHandler.Logout)
+		auth.GET("/sessions", middleware.AuthMiddleware(cfg.Tokens), middleware.ActiveSession(sessionStore), sessionHandler.GetSessions)
+		auth.DELETE("/sessions/:id", middleware.AuthMiddleware(cfg.Tokens), middleware.ActiveSession(sessionStore), sessionHandler.RevokeSession)
+	}
+
+	// tokens and API keys limited by scope only reach the groups they have
+	// the read or write scope of; see middleware.RequireScope
+	api := r.Group("/api/v1")
+	api.Use(middleware.APIKeyAuth(apiKeys), middleware.AuthMiddleware(cfg.Tokens), middleware.ActiveSession(sessionStore), policies.Enforce(), recentWriters.Middleware())
+	if cfg.StrictJSON {
+		api.Use(middleware.StrictJSON())
+	}
+	{
+		customers := api.Group("/customers", middleware.RequireScope("customers"))
+		{
+			customers.POST("", customerHandler.CreateCustomer)
+			customers.GET("", customerHandler.GetCustomers)
+			customers.GET("/stream.ndjson", shed, customerHandler.StreamCustomers)
+			customers.GET("/by-code/:code", customerHandler.GetCustomerByCode)
+			customers.GET("/:id", customerHandler.GetCustomer)
+			customers.PUT("/:id", customerHandler.UpdateCustomer)
+			customers.DELETE("/:id", customerHandler.DeleteCustomer)
+			customers.POST("/:id/change-code", customerHandler.ChangeCustomerCode)
+			customers.GET("/:id/orders", orderHandler.GetCustomerOrders)
+			customers.POST("/:id/orders", orderHandler.CreateCustomerOrder)
+			customers.POST("/:id/anonymize", middleware.RequireAdmin(cfg.AdminEmails), customerHandler.AnonymizeCustomer)
+			customers.GET("/:id/export", middleware.RequireAdmin(cfg.AdminEmails), shed, customerHandler.ExportCustomer)
+			customers.GET("/:id/statement", statementHandler.GetStatement)
+			customers.POST("/:id/statement/send", statementHandler.SendStatement)
+			customers.POST("/:id/notes", noteHandler.CreateNote)
+			customers.GET("/:id/notes", noteHandler.GetNotes)
+			customers.PUT("/:id/notes/:noteId", noteHandler.UpdateNote)
+			customers.DELETE("/:id/notes/:noteId", noteHandler.DeleteNote)
+			customers.POST("/:id/devices", deviceHandler.RegisterDevice)
+			customers.GET("/:id/devices", deviceHandler.GetDevices)
+			customers.DELETE("/:id/devices/:deviceId", deviceHandler.DeleteDevice)
+			customers.GET("/:id/tags", segmentHandler.GetCustomerTags)
+			customers.POST("/:id/tags", segmentHandler.TagCustomer)
+			customers.DELETE("/:id/tags/:tag", segmentHandler.UntagCustomer)
+		}
+
+		api.GET("/notes", middleware.RequireScope("customers"), noteHandler.SearchNotes)
+		api.POST("/notifications/:id/delivered", middleware.RequireScope("customers"), deviceHandler.AcknowledgePush)
+
+		orders := api.Group("/orders", middleware.RequireScope("orders"))
+		{
+			orders.POST("", orderHandler.CreateOrder)
+			orders.GET("", orderHandler.GetOrders)
+			orders.GET("/stream.ndjson", shed, orderHandler.StreamOrders)
+			orders.GET("/archive", shed, orderHandler.GetArchivedOrders)
+			orders.GET("/totals", shed, reportHandler.GetOrderTotals)
+			orders.GET("/by-number/:number", orderHandler.GetOrderByNumber)
+			orders.GET("/:id", orderHandler.GetOrder)
+			orders.PUT("/:id", orderHandler.UpdateOrder)
+			orders.GET("/:id/history", orderHandler.GetOrderHistory)
+			orders.GET("/:id/events", orderHandler.GetOrderEvents)
+			orders.DELETE("/:id", orderHandler.DeleteOrder)
+			orders.POST("/:id/duplicate", orderHandler.DuplicateOrder)
+			orders.POST("/:id/notifications/resend", middleware.RequireAdmin(cfg.AdminEmails), orderHandler.ResendOrderNotification)
+			orders.POST("/:id/assignment", riderHandler.AssignOrder)
+			orders.PUT("/:id/assignment", riderHandler.UpdateAssignment)
+			orders.GET("/:id/assignments", riderHandler.GetOrderAssignments)
+		}
+
+		quotes := api.Group("/quotes", middleware.RequireScope("orders"))
+		{
+			quotes.POST("", orderHandler.CreateQuote)
+			quotes.GET("/:id", orderHandler.GetQuote)
+			quotes.POST("/:id/confirm", orderHandler.ConfirmQuote)
+			quotes.DELETE("/:id", orderHandler.CancelQuote)
+		}
+
+		riders := api.Group("/riders", middleware.RequireScope("riders"))
+		{
+			riders.POST("", riderHandler.CreateRider)
+			riders.GET("", riderHandler.GetRiders)
+			riders.GET("/:id", riderHandler.GetRider)
+			riders.PUT("/:id", riderHandler.UpdateRider)
+			riders.GET("/:id/orders", riderHandler.GetRiderOrders)
+		}
+
+		products := api.Group("/products", middleware.RequireScope("products"))
+		{
+			products.POST("", productHandler.CreateProduct)
+			products.GET("", productHandler.GetProducts)
+			products.GET("/low-stock", productHandler.GetLowStockProducts)
+			products.GET("/:id", productHandler.GetProduct)
+			products.PUT("/:id", productHandler.UpdateProduct)
+		}
+
+		reports := api.Group("/reports", middleware.RequireScope("reports"), shed)
+		{
+			reports.GET("/daily", reportHandler.GetDailyReport)
+			reports.GET("/weekly", reportHandler.GetWeeklyReport)
+			reports.GET("/monthly", reportHandler.GetMonthlyReport)
+			reports.GET("/vat", reportHandler.GetVATReport)
+			reports.GET("/orders/heatmap", reportHandler.GetOrderHeatmap)
+			reports.GET("/win-back", reportHandler.GetWinBackReport)
+			reports.POST("/refresh", reportHandler.RefreshReports)
+		}
+
+		// campaigns text many customers at once, so only admins send them
+		campaigns := api.Group("/campaigns", middleware.RequireAdmin(cfg.AdminEmails), middleware.RequireScope("admin"))
+		{
+			campaigns.POST("", campaignHandler.CreateCampaign)
+			campaigns.GET("", campaignHandler.GetCampaigns)
+			campaigns.GET("/:id", campaignHandler.GetCampaign)
+			campaigns.POST("/:id/cancel", campaignHandler.CancelCampaign)
+		}
+
+		admin := api.Group("/admin")
+		admin.Use(middleware.RequireAdmin(cfg.AdminEmails), middleware.RequireScope("admin"))
+		{
+			admin.GET("/features", featureHandler.GetFeatureFlags)
+			admin.PUT("/features/:key", featureHandler.UpdateFeatureFlag)
+			admin.GET("/sagas", sagaHandler.GetSagas)
+			admin.GET("/sagas/:id", sagaHandler.GetSaga)
+			admin.POST("/sagas/:id/compensate", sagaHandler.CompensateSaga)
+			admin.GET("/slo", sloHandler.GetSLO)
+			admin.GET("/backfills", migrationHandler.GetBackfills)
+			admin.GET("/jobs", jobHandler.GetJobs)
+			admin.POST("/jobs/:name/run", jobHandler.RunJob)
+			admin.GET("/jobs/:name/runs", jobHandler.GetJobRuns)
+			admin.GET("/digests", digestHandler.GetDigests)
+			admin.POST("/digests", digestHandler.SendDigest)
+			admin.GET("/digests/:id", digestHandler.GetDigest)
+			admin.GET("/sms/failures", smsFailureHandler.GetFailures)
+			admin.GET("/customers/duplicates", customerHandler.GetDuplicates)
+			admin.POST("/api-keys", apiKeyHandler.CreateAPIKey)
+			admin.GET("/api-keys", apiKeyHandler.GetAPIKeys)
+			admin.DELETE("/api-keys/:id", apiKeyHandler.RevokeAPIKey)
+			admin.GET("/usage", apiKeyHandler.GetUsage)
+			admin.GET("/webhooks", webhookHandler.GetWebhooks)
+			admin.POST("/webhooks", webhookHandler.CreateWebhook)
+			admin.GET("/webhooks/:id", webhookHandler.GetWebhook)
+			admin.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+			admin.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+			admin.POST("/webhooks/:id/rotate-secret", webhookHandler.RotateWebhookSecret)
+			admin.GET("/segment-syncs", segmentHandler.GetSegmentSyncs)
+			admin.POST("/segment-syncs", segmentHandler.CreateSegmentSync)
+			admin.GET("/segment-syncs/:id", segmentHandler.GetSegmentSync)
+			admin.PUT("/segment-syncs/:id", segmentHandler.UpdateSegmentSync)
+			admin.DELETE("/segment-syncs/:id", segmentHandler.DeleteSegmentSync)
+			admin.POST("/segment-syncs/:id/run", segmentHandler.RunSegmentSync)
+			admin.GET("/promo-codes", promoCodeHandler.GetPromoCodes)
+			admin.POST("/promo-codes", promoCodeHandler.CreatePromoCode)
+			admin.GET("/promo-codes/:id", promoCodeHandler.GetPromoCode)
+			admin.PUT("/promo-codes/:id", promoCodeHandler.UpdatePromoCode)
+			admin.DELETE("/promo-codes/:id", promoCodeHandler.DeletePromoCode)
+			admin.GET("/policies", policyHandler.GetPolicies)
+			admin.POST("/policies", policyHandler.CreatePolicy)
+			admin.DELETE("/policies/:id", policyHandler.DeletePolicy)
+			admin.GET("/roles", policyHandler.GetRoles)
+			admin.PUT("/roles/:email", policyHandler.AssignRole)
+			admin.DELETE("/roles/:email", policyHandler.RemoveRole)
+			admin.GET("/identities", identityHandler.GetIdentities)
+			admin.PUT("/identities/:id", identityHandler.UpdateIdentity)
+			admin.POST("/customers/bulk-delete", customerHandler.BulkDeleteCustomers)
+			admin.POST("/customers/bulk-restore", customerHandler.BulkRestoreCustomers)
+		}
+	}
+
+	return r
+}
+
+// smsFailures returns the failure counts of SMS services that keep them
+func smsFailures(sms services.SMSServiceInterface) *services.SMSFailureTracker {
+	if reporter, ok := sms.(services.SMSFailureReporter); ok {
+		return reporter.Failures()
+	}
+	return nil
+}
+
+// hasAdmins reports whether any admin email is set
+func hasAdmins(emails []string) bool {
+	for _, email := range emails {
+		if strings.TrimSpace(email) != "" {
+			return true
+		}
+	}
+	return false
+}
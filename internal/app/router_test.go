@@ -0,0 +1,591 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestRouter(t *testing.T) *gin.Engine {
+	r, _ := setupTestRouterDB(t)
+	return r
+}
+
+func setupTestRouterDB(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+
+	db := testutil.DB(t)
+
+	return BuildRouter(Config{TrackingSecret: "test-secret"}, Deps{
+		DB:  db,
+		SMS: services.NewMockSMSService(),
+	}), db
+}
+
+func TestBuildRouterRegistersRoutes(t *testing.T) {
+	r := setupTestRouter(t)
+
+	registered := map[string]bool{}
+	for _, route := range r.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	for _, route := range []string{
+		"GET /health",
+		"GET /health/ready",
+		"GET /version",
+		"GET /track/:token",
+		"GET /catalog/products",
+		"GET /catalog/products/:id",
+		"GET /auth/login",
+		"GET /auth/callback",
+		"GET /auth/callback/:provider",
+		"GET /auth/providers",
+		"GET /auth/userinfo",
+		"POST /api/v1/customers",
+		"GET /api/v1/customers/:id",
+		"POST /api/v1/orders",
+		"PUT /api/v1/orders/:id",
+		"GET /api/v1/orders/:id/history",
+		"GET /api/v1/orders/:id/events",
+		"GET /api/v1/products/low-stock",
+		"GET /api/v1/orders/archive",
+		"GET /api/v1/orders/stream.ndjson",
+		"GET /api/v1/customers/stream.ndjson",
+		"GET /api/v1/orders/totals",
+		"GET /api/v1/orders/by-number/:number",
+		"GET /api/v1/reports/orders/heatmap",
+		"POST /callbacks/sms/inbound",
+		"POST /callbacks/sms/delivery",
+		"POST /api/v1/campaigns",
+		"GET /api/v1/campaigns",
+		"GET /api/v1/campaigns/:id",
+		"POST /api/v1/campaigns/:id/cancel",
+		"POST /integrations/3pl/status",
+		"GET /api/v1/admin/features",
+		"PUT /api/v1/admin/features/:key",
+		"GET /api/v1/admin/sagas",
+		"GET /api/v1/admin/sagas/:id",
+		"POST /api/v1/admin/sagas/:id/compensate",
+		"GET /api/v1/admin/slo",
+		"GET /api/v1/admin/backfills",
+		"GET /api/v1/admin/jobs",
+		"POST /api/v1/admin/jobs/:name/run",
+		"GET /api/v1/admin/jobs/:name/runs",
+		"GET /api/v1/admin/digests",
+		"POST /api/v1/admin/digests",
+		"GET /api/v1/admin/digests/:id",
+		"GET /api/v1/admin/sms/failures",
+		"GET /api/v1/admin/customers/duplicates",
+		"POST /api/v1/admin/api-keys",
+		"GET /api/v1/admin/api-keys",
+		"DELETE /api/v1/admin/api-keys/:id",
+		"GET /api/v1/admin/usage",
+		"GET /api/v1/admin/webhooks",
+		"POST /api/v1/admin/webhooks",
+		"GET /api/v1/admin/webhooks/:id",
+		"PUT /api/v1/admin/webhooks/:id",
+		"DELETE /api/v1/admin/webhooks/:id",
+		"POST /api/v1/admin/webhooks/:id/rotate-secret",
+		"GET /api/v1/admin/segment-syncs",
+		"POST /api/v1/admin/segment-syncs",
+		"GET /api/v1/admin/segment-syncs/:id",
+		"PUT /api/v1/admin/segment-syncs/:id",
+		"DELETE /api/v1/admin/segment-syncs/:id",
+		"POST /api/v1/admin/segment-syncs/:id/run",
+		"GET /api/v1/admin/promo-codes",
+		"POST /api/v1/admin/promo-codes",
+		"GET /api/v1/admin/promo-codes/:id",
+		"PUT /api/v1/admin/promo-codes/:id",
+		"DELETE /api/v1/admin/promo-codes/:id",
+		"GET /api/v1/admin/policies",
+		"POST /api/v1/admin/policies",
+		"DELETE /api/v1/admin/policies/:id",
+		"GET /api/v1/admin/roles",
+		"PUT /api/v1/admin/roles/:email",
+		"DELETE /api/v1/admin/roles/:email",
+		"GET /api/v1/admin/identities",
+		"PUT /api/v1/admin/identities/:id",
+		"POST /api/v1/admin/customers/bulk-delete",
+		"POST /api/v1/admin/customers/bulk-restore",
+		"GET /metrics",
+		"POST /api/v1/orders/:id/notifications/resend",
+		"POST /api/v1/orders/:id/duplicate",
+		"POST /api/v1/customers/:id/anonymize",
+		"GET /api/v1/customers/:id/export",
+		"GET /api/v1/customers/:id/statement",
+		"POST /api/v1/customers/:id/statement/send",
+		"GET /statements/:token",
+		"POST /api/v1/customers/:id/change-code",
+		"GET /api/v1/customers/:id/orders",
+		"POST /api/v1/customers/:id/orders",
+		"GET /api/v1/customers/by-code/:code",
+		"POST /api/v1/customers/:id/notes",
+		"PUT /api/v1/customers/:id/notes/:noteId",
+		"GET /api/v1/notes",
+		"POST /api/v1/customers/:id/devices",
+		"GET /api/v1/customers/:id/devices",
+		"DELETE /api/v1/customers/:id/devices/:deviceId",
+		"GET /api/v1/customers/:id/tags",
+		"POST /api/v1/customers/:id/tags",
+		"DELETE /api/v1/customers/:id/tags/:tag",
+		"POST /api/v1/notifications/:id/delivered",
+		"POST /api/v1/orders/:id/assignment",
+		"PUT /api/v1/orders/:id/assignment",
+		"POST /api/v1/quotes",
+		"POST /api/v1/quotes/:id/confirm",
+		"DELETE /api/v1/quotes/:id",
+		"POST /api/v1/riders",
+		"GET /api/v1/riders/:id/orders",
+		"GET /api/v1/reports/vat",
+		"GET /api/v1/reports/win-back",
+		"GET /auth/sessions",
+		"POST /auth/logout",
+		"DELETE /auth/sessions/:id",
+	} {
+		assert.True(t, registered[route], "route %s not registered", route)
+	}
+}
+
+func TestBuildRouterProtectsAPI(t *testing.T) {
+	r := setupTestRouter(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+	}{
+		{name: "health is public", path: "/health", expectedStatus: http.StatusOK},
+		{name: "readiness is public", path: "/health/ready", expectedStatus: http.StatusOK},
+		{name: "version is public", path: "/version", expectedStatus: http.StatusOK},
+		{name: "tracking is public", path: "/track/invalid", expectedStatus: http.StatusNotFound},
+		{name: "catalog is public", path: "/catalog/products", expectedStatus: http.StatusOK},
+		{name: "metrics are public without a token", path: "/metrics", expectedStatus: http.StatusOK},
+		{name: "api requires auth", path: "/api/v1/customers", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestBuildRouterCacheHeaders(t *testing.T) {
+	r := setupTestRouter(t)
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedCache string
+	}{
+		{name: "catalog is cached by the cdn", path: "/catalog/products", expectedCache: "public, max-age=0, s-maxage=300"},
+		{name: "errors are not cached", path: "/track/invalid", expectedCache: "no-store"},
+		{name: "api is not cached", path: "/api/v1/customers", expectedCache: "no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedCache, w.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestBuildRouterEnvelopes(t *testing.T) {
+	r := setupTestRouter(t)
+
+	tests := []struct {
+		name              string
+		method            string
+		path              string
+		requestID         string
+		expectedStatus    int
+		expectedCode      string
+		expectedRequestID string
+	}{
+		{name: "success", method: "GET", path: "/health", requestID: "abc-123", expectedStatus: http.StatusOK, expectedRequestID: "abc-123"},
+		{name: "unauthorized", method: "GET", path: "/api/v1/customers", expectedStatus: http.StatusUnauthorized, expectedCode: "missing_token"},
+		{name: "unknown route", method: "GET", path: "/nope", expectedStatus: http.StatusNotFound, expectedCode: "not_found"},
+		{name: "wrong method", method: "DELETE", path: "/health", expectedStatus: http.StatusMethodNotAllowed, expectedCode: "method_not_allowed"},
+		{name: "unsafe request id replaced", method: "GET", path: "/health", requestID: "bad id\n", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			var response struct {
+				Data      interface{}       `json:"data"`
+				Error     *models.ErrorBody `json:"error"`
+				RequestID string            `json:"request_id"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.NotEmpty(t, response.RequestID)
+			assert.Equal(t, w.Header().Get("X-Request-ID"), response.RequestID)
+			if tt.expectedRequestID != "" {
+				assert.Equal(t, tt.expectedRequestID, response.RequestID)
+			}
+			if tt.requestID != "" && tt.expectedRequestID == "" {
+				assert.NotEqual(t, tt.requestID, response.RequestID)
+			}
+
+			if tt.expectedCode != "" {
+				assert.NotNil(t, response.Error)
+				assert.Equal(t, tt.expectedCode, response.Error.Code)
+			} else {
+				assert.Nil(t, response.Error)
+				assert.NotNil(t, response.Data)
+			}
+		})
+	}
+}
+
+func TestBuildRouterSessions(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-jwt-secret")
+	r, db := setupTestRouterDB(t)
+
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "field-app/1.0")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	login := func() string {
+		w := serve("GET", "/auth/login", "", `{"email": "agent@example.com", "password": "secret"}`)
+		if !assert.Equal(t, http.StatusOK, w.Code) {
+			t.FailNow()
+		}
+		var auth models.AuthResponse
+		json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &auth})
+		return auth.AccessToken
+	}
+
+	phone, laptop := login(), login()
+
+	w := serve("GET", "/auth/sessions", laptop, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var sessions []models.Session
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &sessions})
+	if !assert.Len(t, sessions, 2) {
+		return
+	}
+
+	var phoneSession string
+	for _, session := range sessions {
+		assert.Equal(t, models.LoginMethodPassword, session.Method)
+		assert.Equal(t, "field-app/1.0", session.UserAgent)
+		if !session.Current {
+			phoneSession = session.ID
+		}
+	}
+	assert.NotEmpty(t, phoneSession)
+
+	w = serve("DELETE", "/auth/sessions/"+phoneSession, laptop, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the revoked token is rejected, the other keeps working
+	w = serve("GET", "/api/v1/customers", phone, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	var errorResponse models.ErrorEnvelope
+	json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.Equal(t, "session_revoked", errorResponse.Error.Code)
+
+	w = serve("GET", "/api/v1/customers", laptop, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("DELETE", "/auth/sessions/"+phoneSession, laptop, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// failed logins are audited with the method
+	w = serve("GET", "/auth/login", "", `{"email": "agent@example.com"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var events []models.AuditEvent
+	db.Order("id ASC").Find(&events)
+	types := make([]string, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		models.AuditLoginSucceeded,
+		models.AuditLoginSucceeded,
+		models.AuditSessionRevoked,
+		models.AuditLoginFailed,
+	}, types)
+	assert.Equal(t, "method=password status=400", events[3].Details)
+}
+
+func TestBuildRouterAPIKeys(t *testing.T) {
+	testutil.UseSecret(t)
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	r := BuildRouter(Config{TrackingSecret: "test-secret", AdminEmails: []string{"agent@example.com"}}, Deps{
+		DB:  db,
+		SMS: services.NewMockSMSService(),
+	})
+
+	serve := func(method, path, token, apiKey, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var errorResponse models.ErrorEnvelope
+		json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		return errorResponse.Error.Code
+	}
+
+	// the password login is off while admins are configured
+	admin := testutil.Token(t, "agent@example.com")
+
+	w := serve("POST", "/api/v1/admin/api-keys", admin, "", `{"name": "Acme Logistics", "monthly_quota": 2}`)
+	if !assert.Equal(t, http.StatusCreated, w.Code) {
+		t.FailNow()
+	}
+	var key models.APIKey
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &key})
+	assert.True(t, strings.HasPrefix(key.Key, key.Prefix))
+
+	// the key signs partners in, up to the quota
+	w = serve("GET", "/api/v1/customers", "", key.Key, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-Quota-Remaining"))
+	w = serve("GET", "/api/v1/admin/usage", "", key.Key, "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "api keys are never admins")
+	w = serve("GET", "/api/v1/customers", "", key.Key, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "quota_exceeded", errorCode(w))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	w = serve("GET", "/api/v1/admin/usage", admin, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var usage []models.APIUsageReport
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &usage})
+	if assert.Len(t, usage, 1) {
+		assert.Equal(t, key.ID, usage[0].APIKeyID)
+		assert.Equal(t, int64(2), usage[0].Requests, "rejected requests are not counted")
+		assert.Len(t, usage[0].Days, 1)
+	}
+
+	w = serve("GET", "/api/v1/admin/usage?month=2025-13", admin, "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve("DELETE", fmt.Sprintf("/api/v1/admin/api-keys/%d", key.ID), admin, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("GET", "/api/v1/customers", "", key.Key, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, "invalid_api_key", errorCode(w))
+}
+
+func TestBuildRouterPasswordLogin(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-jwt-secret")
+	gin.SetMode(gin.TestMode)
+
+	login := func(r *gin.Engine, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/auth/login", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// with no admins it stands in for a real login, scopes included
+	r := BuildRouter(Config{TrackingSecret: "test-secret"}, Deps{DB: testutil.DB(t), SMS: services.NewMockSMSService()})
+	w := login(r, `{"email": "agent@example.com", "password": "secret", "scope": "customers:read"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var auth models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &auth})
+	assert.Equal(t, "customers:read", auth.Scope)
+	w = login(r, `{"email": "agent@example.com", "password": "secret", "scope": "orders:delete"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_scope")
+
+	// it checks no password, so anyone could sign in as an admin
+	r = BuildRouter(Config{TrackingSecret: "test-secret", AdminEmails: []string{"admin@example.com"}}, Deps{DB: testutil.DB(t), SMS: services.NewMockSMSService()})
+	w = login(r, `{"email": "admin@example.com", "password": "made-up"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "password_login_disabled")
+	assert.NotContains(t, w.Body.String(), "access_token")
+}
+
+func TestBuildRouterScopes(t *testing.T) {
+	testutil.UseSecret(t)
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	customer := models.Customer{Name: "Wanjiru", Phone: "+254700000001", Code: "C-1"}
+	db.Create(&customer)
+	order := models.Order{CustomerID: customer.ID, Item: "Laptop", Amount: models.Shillings(1000), Status: models.OrderStatusPending}
+	db.Create(&order)
+	r := BuildRouter(Config{TrackingSecret: "test-secret", AdminEmails: []string{"admin@example.com"}}, Deps{
+		DB:  db,
+		SMS: services.NewMockSMSService(),
+	})
+
+	serve := func(method, path, token, apiKey, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	ordersPath := fmt.Sprintf("/api/v1/orders/%d", order.ID)
+
+	// the password login is off while admins are configured
+	admin := testutil.Token(t, "admin@example.com")
+
+	w := serve("POST", "/api/v1/admin/api-keys", admin, "", `{"name": "BI", "scopes": ["orders:read", "reports:read", "orders:read"]}`)
+	if !assert.Equal(t, http.StatusCreated, w.Code) {
+		t.FailNow()
+	}
+	var key models.APIKey
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &key})
+	assert.Equal(t, []string{models.ScopeOrdersRead, models.ScopeReportsRead}, key.Scopes)
+
+	// the BI key reads orders and reports and nothing else
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/v1/orders", "", key.Key, "").Code)
+	assert.Equal(t, http.StatusOK, serve("GET", ordersPath, "", key.Key, "").Code)
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/v1/reports/daily", "", key.Key, "").Code)
+	w = serve("PUT", ordersPath, "", key.Key, `{"status": "completed"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "insufficient_scope")
+	assert.Equal(t, http.StatusForbidden, serve("DELETE", ordersPath, "", key.Key, "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/api/v1/quotes", "", key.Key, `{}`).Code)
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/customers", "", key.Key, "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("POST", "/api/v1/reports/refresh", "", key.Key, "").Code)
+
+	var unchanged models.Order
+	db.First(&unchanged, order.ID)
+	assert.Equal(t, models.OrderStatusPending, unchanged.Status)
+
+	// tokens can be limited by scope too, even admins
+	scoped := testutil.ScopedToken(t, "admin@example.com", "customers:read")
+	assert.Equal(t, http.StatusOK, serve("GET", "/api/v1/customers", scoped, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/orders", scoped, "", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve("GET", "/api/v1/admin/api-keys", scoped, "", "").Code)
+
+	w = serve("POST", "/api/v1/admin/api-keys", admin, "", `{"name": "BI", "scopes": ["everything"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBuildRouterPolicies(t *testing.T) {
+	testutil.UseSecret(t)
+	gin.SetMode(gin.TestMode)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	db.Create(&models.Customer{Name: "Wanjiru", Phone: "+254700000001", Code: "C-1"})
+	r := BuildRouter(Config{
+		TrackingSecret: "test-secret",
+		AdminEmails:    []string{"admin@example.com"},
+		Policies:       []models.Policy{{Effect: models.PolicyAllow, Role: "manager", Method: "*", Path: "/api/v1/reports*"}},
+	}, Deps{
+		DB:  db,
+		SMS: services.NewMockSMSService(),
+	})
+
+	serve := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	// the password login is off while admins are configured
+	admin, agent := testutil.Token(t, "admin@example.com"), testutil.Token(t, "agent@example.com")
+
+	w := serve("POST", "/api/v1/admin/policies", admin, `{"role": "agent", "method": "DELETE", "path": "/api/v1/customers/:id", "effect": "deny"}`)
+	if !assert.Equal(t, http.StatusCreated, w.Code) {
+		t.FailNow()
+	}
+	w = serve("PUT", "/api/v1/admin/roles/agent@example.com", admin, `{"role": "agent"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("DELETE", "/api/v1/customers/1", agent, "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "agents cannot delete customers")
+	w = serve("GET", "/api/v1/customers/1", agent, "")
+	assert.Equal(t, http.StatusOK, w.Code, "routes without policies stay open")
+	w = serve("GET", "/api/v1/reports/daily", agent, "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "only managers may read reports")
+
+	w = serve("GET", "/api/v1/admin/policies", admin, "")
+	var policies []models.Policy
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &policies})
+	if assert.Len(t, policies, 2) {
+		assert.Equal(t, models.PolicySourceConfig, policies[0].Source)
+		assert.Equal(t, models.PolicySourceDatabase, policies[1].Source)
+	}
+
+	w = serve("DELETE", "/api/v1/admin/roles/agent@example.com", admin, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("DELETE", "/api/v1/customers/1", agent, "")
+	assert.Equal(t, http.StatusOK, w.Code, "users are no longer agents once their role is removed")
+	w = serve("DELETE", "/api/v1/admin/roles/agent@example.com", admin, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
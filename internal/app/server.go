@@ -0,0 +1,153 @@
+package app
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// ServerConfig sets where and how the standalone server listens
+type ServerConfig struct {
+	Addr string
+	// TLSCertFile and TLSKeyFile enable HTTPS. Without them the server still
+	// speaks HTTP/2 to clients that use it over plain TCP (h2c), such as a
+	// load balancer terminating TLS.
+	TLSCertFile string
+	TLSKeyFile  string
+	// AutocertDomains enable HTTPS with certificates from Let's Encrypt for
+	// these domains, instead of from files. Certificates are kept in
+	// AutocertCacheDir so a restart doesn't request them again.
+	AutocertDomains  []string
+	AutocertCacheDir string
+	AutocertEmail    string
+	// RedirectAddr, with HTTPS, also listens for plain HTTP, answering ACME
+	// challenges and redirecting everything else to HTTPS
+	RedirectAddr string
+}
+
+// ServerConfigFromEnv reads PORT (default 8080), TLS_CERT_FILE,
+// TLS_KEY_FILE, TLS_AUTOCERT_DOMAINS (comma separated),
+// TLS_AUTOCERT_CACHE_DIR (default "certs"), TLS_AUTOCERT_EMAIL and
+// HTTP_REDIRECT_PORT
+func ServerConfigFromEnv() ServerConfig {
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	cfg := ServerConfig{
+		Addr:             ":" + port,
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		AutocertCacheDir: os.Getenv("TLS_AUTOCERT_CACHE_DIR"),
+		AutocertEmail:    os.Getenv("TLS_AUTOCERT_EMAIL"),
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_AUTOCERT_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cfg.AutocertDomains = append(cfg.AutocertDomains, domain)
+		}
+	}
+	if cfg.AutocertCacheDir == "" {
+		cfg.AutocertCacheDir = "certs"
+	}
+	if redirectPort := os.Getenv("HTTP_REDIRECT_PORT"); redirectPort != "" {
+		cfg.RedirectAddr = ":" + redirectPort
+	}
+	return cfg
+}
+
+func (c ServerConfig) TLS() bool {
+	return c.autocert() || (c.TLSCertFile != "" && c.TLSKeyFile != "")
+}
+
+func (c ServerConfig) autocert() bool {
+	return len(c.AutocertDomains) > 0
+}
+
+// NewServer builds an HTTP/1.1 and HTTP/2 server for handler
+func NewServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	server := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           handler,
+		Protocols:         protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	if cfg.TLS() {
+		server.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	return server
+}
+
+// ListenAndServe serves over HTTPS when a certificate is configured and
+// plain TCP otherwise. With HTTPS and a RedirectAddr, plain HTTP is
+// redirected to it from a second listener.
+func ListenAndServe(cfg ServerConfig, server *http.Server) error {
+	if !cfg.TLS() {
+		return server.ListenAndServe()
+	}
+
+	var redirect http.Handler = httpsRedirectHandler(cfg.Addr)
+	if cfg.autocert() {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		server.TLSConfig = tlsConfig
+		redirect = manager.HTTPHandler(redirect)
+	}
+
+	if cfg.RedirectAddr != "" {
+		go func() {
+			redirectServer := &http.Server{
+				Addr:              cfg.RedirectAddr,
+				Handler:           redirect,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+			if err := redirectServer.ListenAndServe(); err != nil {
+				log.Printf("http redirect listener on %s stopped: %v", cfg.RedirectAddr, err)
+			}
+		}()
+	}
+
+	if cfg.autocert() {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+}
+
+// httpsRedirectHandler redirects every request to the same URL on the
+// HTTPS listener at addr, leaving the port out when it is 443
+func httpsRedirectHandler(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if host == "" {
+			http.Error(w, "requests must be made over HTTPS", http.StatusBadRequest)
+			return
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
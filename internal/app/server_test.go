@@ -0,0 +1,82 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerSpeaksHTTP2(t *testing.T) {
+	server := NewServer(ServerConfig{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+
+	ts := httptest.NewUnstartedServer(server.Handler)
+	ts.Config.Protocols = server.Protocols
+	ts.Start()
+	defer ts.Close()
+
+	// prior knowledge h2c, as a TLS terminating load balancer would use
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get(ts.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, 2, resp.ProtoMajor)
+
+	// HTTP/1.1 clients still work
+	resp, err = http.Get(ts.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+}
+
+func TestServerConfigFromEnvAutocert(t *testing.T) {
+	t.Setenv("PORT", "443")
+	t.Setenv("TLS_AUTOCERT_DOMAINS", "api.example.com, shop.example.com")
+	t.Setenv("TLS_AUTOCERT_CACHE_DIR", "")
+	t.Setenv("HTTP_REDIRECT_PORT", "80")
+
+	cfg := ServerConfigFromEnv()
+	assert.True(t, cfg.TLS())
+	assert.Equal(t, []string{"api.example.com", "shop.example.com"}, cfg.AutocertDomains)
+	assert.Equal(t, "certs", cfg.AutocertCacheDir)
+	assert.Equal(t, ":80", cfg.RedirectAddr)
+	assert.NotNil(t, NewServer(cfg, http.NotFoundHandler()).TLSConfig)
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name             string
+		addr             string
+		host             string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "default https port", addr: ":443", host: "api.example.com", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "https://api.example.com/orders?page=2"},
+		{name: "other https port", addr: ":8443", host: "api.example.com:8080", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "https://api.example.com:8443/orders?page=2"},
+		{name: "ipv6 host", addr: ":443", host: "[2001:db8::1]:80", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "https://[2001:db8::1]/orders?page=2"},
+		{name: "no host", addr: ":443", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/orders?page=2", nil)
+			req.Host = tt.host
+			httpsRedirectHandler(tt.addr).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
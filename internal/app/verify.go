@@ -0,0 +1,218 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/handlers"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"gorm.io/gorm"
+)
+
+// Outcomes of a startup check. Only failures stop a strict server.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// MinJWTSecretLength is the shortest JWT_SECRET accepted, in bytes, which
+// is what HS256 needs to be as strong as its hash
+const MinJWTSecretLength = 32
+
+// oidcCheckTimeout bounds how long start up waits on the identity provider
+const oidcCheckTimeout = 5 * time.Second
+
+// CheckResult is the outcome of one startup check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// StartupReport is the outcome of every startup check. With Strict set
+// the server refuses to serve traffic when any check failed.
+type StartupReport struct {
+	Strict bool          `json:"strict"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Failed returns the checks that failed
+func (r StartupReport) Failed() []CheckResult {
+	var failed []CheckResult
+	for _, check := range r.Checks {
+		if check.Status == CheckFail {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Refuse reports whether the server should not serve traffic
+func (r StartupReport) Refuse() bool {
+	return r.Strict && len(r.Failed()) > 0
+}
+
+// Log writes the report as one JSON line, followed by a line for each check
+// that did not pass so they stand out
+func (r StartupReport) Log() {
+	encoded, err := json.Marshal(r)
+	if err != nil {
+		log.Printf("failed to encode startup report: %v", err)
+		return
+	}
+	log.Printf("startup report: %s", encoded)
+	for _, check := range r.Checks {
+		if check.Status != CheckOK {
+			log.Printf("startup check %s: %s: %s", check.Name, check.Status, check.Message)
+		}
+	}
+}
+
+// StartupStrictFromEnv reads STARTUP_STRICT
+func StartupStrictFromEnv() bool {
+	strict, _ := strconv.ParseBool(os.Getenv("STARTUP_STRICT"))
+	return strict
+}
+
+// VerifyStartup checks the environment the server runs with and that the
+// database schema matches the models. db may be nil when the database could
+// not be reached, which fails the schema check.
+func VerifyStartup(ctx context.Context, db *gorm.DB) StartupReport {
+	report := StartupReport{Strict: StartupStrictFromEnv()}
+	report.Checks = append(report.Checks, checkEnv()...)
+	report.Checks = append(report.Checks, checkJWTSecret())
+	report.Checks = append(report.Checks, checkSchema(db)...)
+	report.Checks = append(report.Checks, checkOIDC(ctx)...)
+	return report
+}
+
+func checkEnv() []CheckResult {
+	required := []string{"DATABASE_URL"}
+	if dryRun, _ := strconv.ParseBool(os.Getenv("SMS_DRY_RUN")); !dryRun {
+		required = append(required, "AFRICASTALKING_USERNAME", "AFRICASTALKING_API_KEY")
+	}
+
+	var results []CheckResult
+	for _, name := range required {
+		result := CheckResult{Name: "env." + name, Status: CheckOK}
+		if strings.TrimSpace(os.Getenv(name)) == "" {
+			result.Status = CheckFail
+			result.Message = name + " is not set"
+		}
+		results = append(results, result)
+	}
+
+	pii := CheckResult{Name: "env.PII_ENCRYPTION_KEYS", Status: CheckOK}
+	if strings.TrimSpace(os.Getenv("PII_ENCRYPTION_KEYS")) == "" {
+		pii.Status = CheckWarn
+		pii.Message = "not set, customer phone numbers and emails are stored in plain text"
+	}
+	return append(results, pii)
+}
+
+func checkJWTSecret() CheckResult {
+	result := CheckResult{Name: "env.JWT_SECRET", Status: CheckOK}
+	secret := os.Getenv("JWT_SECRET")
+	switch {
+	case secret == "":
+		result.Status = CheckFail
+		result.Message = "not set, tokens are signed with the built-in development key"
+	case len(secret) < MinJWTSecretLength:
+		result.Status = CheckFail
+		result.Message = fmt.Sprintf("%d bytes long, at least %d are needed", len(secret), MinJWTSecretLength)
+	}
+	return result
+}
+
+// checkSchema looks for the table, columns and indexes of every model,
+// one result per table
+func checkSchema(db *gorm.DB) []CheckResult {
+	if db == nil {
+		return []CheckResult{{Name: "schema", Status: CheckFail, Message: "database is not reachable"}}
+	}
+
+	var results []CheckResult
+	migrator := db.Migrator()
+	for _, model := range models.All() {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			results = append(results, CheckResult{Name: "schema", Status: CheckFail, Message: err.Error()})
+			continue
+		}
+		table := stmt.Schema.Table
+		result := CheckResult{Name: "schema." + table, Status: CheckOK}
+		results = append(results, result)
+		last := &results[len(results)-1]
+
+		if !migrator.HasTable(model) {
+			last.Status = CheckFail
+			last.Message = "table is missing"
+			continue
+		}
+		columnTypes, err := migrator.ColumnTypes(model)
+		if err != nil {
+			last.Status = CheckFail
+			last.Message = fmt.Sprintf("failed to read columns: %v", err)
+			continue
+		}
+		columns := make(map[string]bool, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns[strings.ToLower(columnType.Name())] = true
+		}
+
+		var missing []string
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if !columns[strings.ToLower(field.DBName)] {
+				missing = append(missing, "column "+field.DBName)
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !migrator.HasIndex(model, index.Name) {
+				missing = append(missing, "index "+index.Name)
+			}
+		}
+		if len(missing) > 0 {
+			last.Status = CheckFail
+			last.Message = "missing " + strings.Join(missing, ", ")
+		}
+	}
+	return results
+}
+
+// checkOIDC discovers each configured identity provider. Settings that
+// are partly given leave their provider out, which is only a warning.
+func checkOIDC(ctx context.Context) []CheckResult {
+	result := CheckResult{Name: "oidc", Status: CheckOK}
+	providers, err := handlers.OIDCProvidersFromEnv()
+	switch {
+	case err != nil:
+		result.Status = CheckWarn
+		result.Message = strings.ReplaceAll(err.Error(), "\n", "; ")
+	case len(providers) == 0:
+		result.Message = "not configured, logins use passwords"
+	}
+	results := []CheckResult{result}
+
+	for _, provider := range providers {
+		check := CheckResult{Name: "oidc." + provider.Name, Status: CheckOK}
+		ctx, cancel := context.WithTimeout(ctx, oidcCheckTimeout)
+		if _, err := oidc.NewProvider(ctx, provider.Issuer); err != nil {
+			check.Status = CheckFail
+			check.Message = fmt.Sprintf("discovery failed: %v", err)
+		}
+		cancel()
+		results = append(results, check)
+	}
+	return results
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func checkNamed(report StartupReport, name string) CheckResult {
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	return CheckResult{}
+}
+
+func TestVerifyStartup(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+
+	t.Setenv("DATABASE_URL", "savannah.db")
+	t.Setenv("JWT_SECRET", strings.Repeat("k", MinJWTSecretLength))
+	t.Setenv("SMS_DRY_RUN", "true")
+	t.Setenv("PII_ENCRYPTION_KEYS", "")
+	t.Setenv("OIDC_PROVIDER_URL", "")
+	t.Setenv("OIDC_CLIENT_ID", "")
+	t.Setenv("OIDC_CLIENT_SECRET", "")
+	t.Setenv("OIDC_REDIRECT_URI", "")
+	t.Setenv("OIDC_PROVIDERS", "")
+	t.Setenv("STARTUP_STRICT", "true")
+
+	t.Run("migrated database passes", func(t *testing.T) {
+		report := VerifyStartup(context.Background(), db)
+		assert.Empty(t, report.Failed())
+		assert.False(t, report.Refuse())
+		assert.Equal(t, CheckOK, checkNamed(report, "schema.orders").Status)
+		assert.Equal(t, CheckWarn, checkNamed(report, "env.PII_ENCRYPTION_KEYS").Status)
+		assert.Equal(t, CheckOK, checkNamed(report, "oidc").Status)
+	})
+
+	t.Run("short secret and missing provider credentials fail", func(t *testing.T) {
+		t.Setenv("JWT_SECRET", "secret-key")
+		t.Setenv("SMS_DRY_RUN", "")
+		t.Setenv("AFRICASTALKING_USERNAME", "sandbox")
+		t.Setenv("AFRICASTALKING_API_KEY", "")
+
+		report := VerifyStartup(context.Background(), db)
+		assert.Equal(t, CheckFail, checkNamed(report, "env.JWT_SECRET").Status)
+		assert.Equal(t, CheckOK, checkNamed(report, "env.AFRICASTALKING_USERNAME").Status)
+		assert.Equal(t, CheckFail, checkNamed(report, "env.AFRICASTALKING_API_KEY").Status)
+		assert.True(t, report.Refuse())
+
+		t.Setenv("STARTUP_STRICT", "")
+		assert.False(t, VerifyStartup(context.Background(), db).Refuse(), "failures are only reported outside strict mode")
+	})
+
+	t.Run("partly configured oidc warns", func(t *testing.T) {
+		t.Setenv("OIDC_PROVIDER_URL", "https://accounts.example.com")
+
+		check := checkNamed(VerifyStartup(context.Background(), db), "oidc")
+		assert.Equal(t, CheckWarn, check.Status)
+		assert.Contains(t, check.Message, "OIDC_CLIENT_ID")
+	})
+
+	t.Run("missing column and index fail", func(t *testing.T) {
+		require.NoError(t, db.Migrator().DropColumn(&models.Order{}, "delivery_instructions"))
+		require.NoError(t, db.Migrator().DropIndex(&models.Customer{}, "idx_customers_phone_hash"))
+
+		report := VerifyStartup(context.Background(), db)
+		assert.Equal(t, CheckFail, checkNamed(report, "schema.orders").Status)
+		assert.Contains(t, checkNamed(report, "schema.orders").Message, "column delivery_instructions")
+		assert.Contains(t, checkNamed(report, "schema.customers").Message, "index idx_customers_phone_hash")
+		assert.Equal(t, CheckOK, checkNamed(report, "schema.riders").Status)
+	})
+
+	t.Run("unreachable database fails", func(t *testing.T) {
+		assert.Equal(t, CheckFail, checkNamed(VerifyStartup(context.Background(), nil), "schema").Status)
+	})
+}
@@ -0,0 +1,322 @@
+// Package authz decides which roles may call which routes, from policies
+// kept in the database and in AUTHZ_POLICIES, so rules such as "agents
+// cannot delete customers" change without touching handlers.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Built in roles. Every signed in user has RoleUser unless given another;
+// admins are those in ADMIN_EMAILS and partners call with an API key.
+const (
+	RoleAdmin   = "admin"
+	RoleUser    = "user"
+	RolePartner = "partner"
+)
+
+const defaultCacheTTL = 30 * time.Second
+
+var (
+	ErrPolicyNotFound = errors.New("policy not found")
+	ErrRoleNotFound   = errors.New("role assignment not found")
+)
+
+// Store reads policies and role assignments from the database and caches
+// them like feature flags: changes are visible at once on this instance
+// and within one TTL on others.
+//
+// A request is refused when a deny policy matches one of its roles. When
+// any allow policy matches the route, only the roles it names may call it.
+// Routes without policies are open to every role, and admins are never
+// refused, so a policy cannot lock them out of changing policies.
+type Store struct {
+	db     *gorm.DB
+	ttl    time.Duration
+	now    func() time.Time
+	config []models.Policy
+	admins map[string]bool
+
+	mu       sync.RWMutex
+	policies []models.Policy
+	roles    map[string]string
+	loadedAt time.Time
+}
+
+func NewStore(db *gorm.DB, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Store{db: db, ttl: ttl, now: time.Now, admins: map[string]bool{}}
+}
+
+// WithPolicies adds policies from configuration, applied with those in the
+// database
+func (s *Store) WithPolicies(policies []models.Policy) *Store {
+	s.config = nil
+	for _, policy := range policies {
+		policy.Source = models.PolicySourceConfig
+		s.config = append(s.config, policy)
+	}
+	return s
+}
+
+// WithAdmins gives the admin role to these emails
+func (s *Store) WithAdmins(emails []string) *Store {
+	for _, email := range emails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			s.admins[email] = true
+		}
+	}
+	return s
+}
+
+// Enforce refuses requests the policies do not allow with 403. It must run
+// after AuthMiddleware, and allows every request if the policies cannot be
+// read, as routes did before policies.
+func (s *Store) Enforce() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles, err := s.Roles(c)
+		if err != nil {
+			log.Printf("failed to load authorization policies: %v", err)
+			c.Next()
+			return
+		}
+		allowed, err := s.Allowed(c.Request.Context(), roles, c.Request.Method, c.FullPath())
+		if err != nil {
+			log.Printf("failed to load authorization policies: %v", err)
+		} else if !allowed {
+			respond.AbortError(c, http.StatusForbidden, "forbidden", fmt.Sprintf("role %s may not %s %s", strings.Join(roles, ","), c.Request.Method, c.FullPath()))
+			return
+		}
+		c.Next()
+	}
+}
+
+// Roles returns the roles of the request's caller
+func (s *Store) Roles(c *gin.Context) ([]string, error) {
+	if strings.HasPrefix(middleware.CurrentSubject(c), "api_key:") {
+		return []string{RolePartner}, nil
+	}
+
+	email := strings.ToLower(middleware.CurrentUserEmail(c))
+	_, roles, err := s.load(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	role := roles[email]
+	if role == "" {
+		role = RoleUser
+	}
+	if s.admins[email] && role != RoleAdmin {
+		return []string{RoleAdmin, role}, nil
+	}
+	return []string{role}, nil
+}
+
+// Allowed reports whether any of roles may call the route with method
+func (s *Store) Allowed(ctx context.Context, roles []string, method, route string) (bool, error) {
+	for _, role := range roles {
+		if role == RoleAdmin {
+			return true, nil
+		}
+	}
+
+	policies, _, err := s.load(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	restricted, allowed := false, false
+	for _, policy := range policies {
+		if !matches(policy.Method, method) || !matchesPath(policy.Path, route) {
+			continue
+		}
+		hasRole := false
+		for _, role := range roles {
+			hasRole = hasRole || matches(policy.Role, role)
+		}
+
+		switch policy.Effect {
+		case models.PolicyDeny:
+			if hasRole {
+				return false, nil
+			}
+		case models.PolicyAllow:
+			restricted = true
+			allowed = allowed || hasRole
+		}
+	}
+	return !restricted || allowed, nil
+}
+
+// List returns the configured policies, then those in the database
+func (s *Store) List(ctx context.Context) ([]models.Policy, error) {
+	var stored []models.Policy
+	if err := s.db.WithContext(ctx).Order("id ASC").Find(&stored).Error; err != nil {
+		return nil, err
+	}
+	policies := append([]models.Policy{}, s.config...)
+	for _, policy := range stored {
+		policy.Source = models.PolicySourceDatabase
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// Create stores a policy and drops the cache
+func (s *Store) Create(ctx context.Context, policy *models.Policy) error {
+	if err := s.db.WithContext(ctx).Create(policy).Error; err != nil {
+		return fmt.Errorf("failed to create policy: %w", err)
+	}
+	policy.Source = models.PolicySourceDatabase
+	s.invalidate()
+	return nil
+}
+
+// Delete removes a policy kept in the database
+func (s *Store) Delete(ctx context.Context, id uint) (models.Policy, error) {
+	var policy models.Policy
+	db := s.db.WithContext(ctx)
+	if err := db.First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return policy, ErrPolicyNotFound
+		}
+		return policy, err
+	}
+	if err := db.Delete(&policy).Error; err != nil {
+		return policy, err
+	}
+	policy.Source = models.PolicySourceDatabase
+	s.invalidate()
+	return policy, nil
+}
+
+// ListRoles returns every role assignment, ordered by email
+func (s *Store) ListRoles(ctx context.Context) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	err := s.db.WithContext(ctx).Order("email ASC").Find(&roles).Error
+	return roles, err
+}
+
+// AssignRole gives the user with email a role, replacing any they had
+func (s *Store) AssignRole(ctx context.Context, email, role, assignedBy string) (models.UserRole, error) {
+	db := s.db.WithContext(ctx)
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var assignment models.UserRole
+	if err := db.Where(models.UserRole{Email: email}).FirstOrInit(&assignment).Error; err != nil {
+		return assignment, err
+	}
+	assignment.Role = role
+	assignment.CreatedBy = assignedBy
+	if err := db.Save(&assignment).Error; err != nil {
+		return assignment, fmt.Errorf("failed to assign role: %w", err)
+	}
+	s.invalidate()
+	return assignment, nil
+}
+
+// RemoveRole puts the user back to the user role
+func (s *Store) RemoveRole(ctx context.Context, email string) (models.UserRole, error) {
+	db := s.db.WithContext(ctx)
+	var assignment models.UserRole
+	if err := db.Where("email = ?", strings.ToLower(strings.TrimSpace(email))).First(&assignment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return assignment, ErrRoleNotFound
+		}
+		return assignment, err
+	}
+	if err := db.Delete(&assignment).Error; err != nil {
+		return assignment, err
+	}
+	s.invalidate()
+	return assignment, nil
+}
+
+func (s *Store) load(ctx context.Context) ([]models.Policy, map[string]string, error) {
+	s.mu.RLock()
+	if s.roles != nil && s.now().Sub(s.loadedAt) < s.ttl {
+		policies, roles := s.policies, s.roles
+		s.mu.RUnlock()
+		return policies, roles, nil
+	}
+	s.mu.RUnlock()
+
+	policies, err := s.List(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	assignments, err := s.ListRoles(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	roles := make(map[string]string, len(assignments))
+	for _, assignment := range assignments {
+		roles[assignment.Email] = assignment.Role
+	}
+
+	s.mu.Lock()
+	s.policies, s.roles = policies, roles
+	s.loadedAt = s.now()
+	s.mu.Unlock()
+	return policies, roles, nil
+}
+
+func (s *Store) invalidate() {
+	s.mu.Lock()
+	s.roles = nil
+	s.mu.Unlock()
+}
+
+func matches(pattern, value string) bool {
+	return pattern == "*" || strings.EqualFold(pattern, value)
+}
+
+// matchesPath compares a policy path with the route as registered, so
+// /api/v1/customers/:id matches however the id is written
+func matchesPath(pattern, route string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(route, prefix)
+	}
+	return pattern == route
+}
+
+// ParsePolicies reads policies written one per line or separated by
+// semicolons as "effect role method path", e.g.
+//
+//	deny agent DELETE /api/v1/customers/:id; allow manager * /api/v1/reports*
+func ParsePolicies(list string) ([]models.Policy, error) {
+	var policies []models.Policy
+	for _, line := range strings.FieldsFunc(list, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("invalid policy %q, expected: effect role method path", strings.TrimSpace(line))
+		}
+		policy := models.Policy{Effect: strings.ToLower(fields[0]), Role: fields[1], Method: strings.ToUpper(fields[2]), Path: fields[3]}
+		if policy.Effect != models.PolicyAllow && policy.Effect != models.PolicyDeny {
+			return nil, fmt.Errorf("invalid policy %q, effect must be allow or deny", strings.TrimSpace(line))
+		}
+		if !strings.HasPrefix(policy.Path, "/") {
+			return nil, fmt.Errorf("invalid policy %q, path must start with /", strings.TrimSpace(line))
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
@@ -0,0 +1,94 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return NewStore(db, 0)
+}
+
+func TestAllowed(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestStore(t).WithPolicies([]models.Policy{
+		{Effect: models.PolicyDeny, Role: "agent", Method: "DELETE", Path: "/api/v1/customers/:id"},
+		{Effect: models.PolicyAllow, Role: "manager", Method: "*", Path: "/api/v1/reports*"},
+		{Effect: models.PolicyAllow, Role: "finance", Method: "GET", Path: "/api/v1/reports/vat"},
+		{Effect: models.PolicyDeny, Role: "*", Method: "POST", Path: "/api/v1/customers/bulk"},
+	})
+
+	tests := []struct {
+		name     string
+		roles    []string
+		method   string
+		route    string
+		expected bool
+	}{
+		{name: "no policy for the route", roles: []string{"agent"}, method: "GET", route: "/api/v1/customers/:id", expected: true},
+		{name: "denied role", roles: []string{"agent"}, method: "DELETE", route: "/api/v1/customers/:id", expected: false},
+		{name: "deny for another role", roles: []string{"user"}, method: "DELETE", route: "/api/v1/customers/:id", expected: true},
+		{name: "allow listed role", roles: []string{"manager"}, method: "GET", route: "/api/v1/reports/daily", expected: true},
+		{name: "role left off the allow list", roles: []string{"user"}, method: "GET", route: "/api/v1/reports/daily", expected: false},
+		{name: "any allow that matches", roles: []string{"finance"}, method: "GET", route: "/api/v1/reports/vat", expected: true},
+		{name: "deny for every role", roles: []string{"manager"}, method: "POST", route: "/api/v1/customers/bulk", expected: false},
+		{name: "admins are never refused", roles: []string{RoleAdmin, "agent"}, method: "DELETE", route: "/api/v1/customers/:id", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allowed, err := store.Allowed(ctx, tt.roles, tt.method, tt.route)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, allowed)
+		})
+	}
+}
+
+func TestStoreChangesApplyAtOnce(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestStore(t)
+
+	allowed, _ := store.Allowed(ctx, []string{"agent"}, "DELETE", "/api/v1/orders/:id")
+	assert.True(t, allowed)
+
+	policy := models.Policy{Effect: models.PolicyDeny, Role: "agent", Method: "DELETE", Path: "/api/v1/orders/:id"}
+	assert.NoError(t, store.Create(ctx, &policy))
+	allowed, _ = store.Allowed(ctx, []string{"agent"}, "DELETE", "/api/v1/orders/:id")
+	assert.False(t, allowed)
+
+	_, err := store.Delete(ctx, policy.ID)
+	assert.NoError(t, err)
+	allowed, _ = store.Allowed(ctx, []string{"agent"}, "DELETE", "/api/v1/orders/:id")
+	assert.True(t, allowed)
+
+	_, err = store.Delete(ctx, policy.ID)
+	assert.ErrorIs(t, err, ErrPolicyNotFound)
+}
+
+func TestParsePolicies(t *testing.T) {
+	policies, err := ParsePolicies("deny agent DELETE /api/v1/customers/:id; allow manager * /api/v1/reports*\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Policy{
+		{Effect: "deny", Role: "agent", Method: "DELETE", Path: "/api/v1/customers/:id"},
+		{Effect: "allow", Role: "manager", Method: "*", Path: "/api/v1/reports*"},
+	}, policies)
+
+	_, err = ParsePolicies("deny agent DELETE")
+	assert.Error(t, err)
+	_, err = ParsePolicies("block agent DELETE /api/v1/customers/:id")
+	assert.Error(t, err)
+	_, err = ParsePolicies("deny agent DELETE api/v1/customers")
+	assert.Error(t, err)
+}
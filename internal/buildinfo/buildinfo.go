@@ -0,0 +1,95 @@
+// Package buildinfo identifies the running build, so logs, error reports
+// and GET /version all say which commit is deployed.
+//
+// Release builds set the commit and build time with ldflags:
+//
+//	go build -ldflags "-X github.com/SebbieMzingKe/customer-order-api/internal/buildinfo.Commit=$(git rev-parse HEAD) -X github.com/SebbieMzingKe/customer-order-api/internal/buildinfo.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them the VCS stamp Go embeds when building from a checkout is
+// used, and then VERCEL_GIT_COMMIT_SHA, since Vercel builds without ldflags
+// or the .git directory.
+package buildinfo
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set with -ldflags "-X ..."; see the package doc
+var (
+	Commit    string
+	BuildTime string
+)
+
+// Info describes the running build. Unknown values are empty.
+type Info struct {
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+	GoVersion string `json:"go_version"`
+	// Modified is set when the build had uncommitted changes
+	Modified bool `json:"modified"`
+}
+
+var (
+	once sync.Once
+	info Info
+)
+
+// Get returns the running build's info
+func Get() Info {
+	once.Do(func() {
+		info = read(Commit, BuildTime, os.Getenv)
+	})
+	return info
+}
+
+// read resolves the build info from the ldflags values, the embedded VCS
+// stamp and the environment, in that order
+func read(commit, buildTime string, getenv func(string) string) Info {
+	result := Info{Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if result.Commit == "" {
+					result.Commit = setting.Value
+				}
+			case "vcs.time":
+				if result.BuildTime == "" {
+					result.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				result.Modified = setting.Value == "true"
+			}
+		}
+	}
+
+	if result.Commit == "" {
+		result.Commit = getenv("VERCEL_GIT_COMMIT_SHA")
+	}
+	return result
+}
+
+// String formats the info for log lines, e.g.
+// "commit 1a2b3c4 built 2025-09-19T10:00:00Z with go1.24.2"
+func (i Info) String() string {
+	commit := i.Commit
+	if commit == "" {
+		commit = "unknown"
+	} else if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	if i.Modified {
+		commit += "-dirty"
+	}
+
+	buildTime := i.BuildTime
+	if buildTime == "" {
+		buildTime = "at an unknown time"
+	}
+	return fmt.Sprintf("commit %s built %s with %s", commit, buildTime, i.GoVersion)
+}
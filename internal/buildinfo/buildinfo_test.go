@@ -0,0 +1,56 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRead(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+
+	// test binaries carry no VCS stamp, so only ldflags and the environment apply
+	tests := []struct {
+		name           string
+		commit         string
+		buildTime      string
+		env            map[string]string
+		expectedCommit string
+	}{
+		{
+			name:           "ldflags",
+			commit:         "1a2b3c4d5e6f7a8b9c0d",
+			buildTime:      "2025-09-19T10:00:00Z",
+			env:            map[string]string{"VERCEL_GIT_COMMIT_SHA": "ffff"},
+			expectedCommit: "1a2b3c4d5e6f7a8b9c0d",
+		},
+		{
+			name:           "vercel",
+			env:            map[string]string{"VERCEL_GIT_COMMIT_SHA": "ffff"},
+			expectedCommit: "ffff",
+		},
+		{
+			name: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := read(tt.commit, tt.buildTime, env(tt.env))
+			assert.Equal(t, tt.expectedCommit, info.Commit)
+			assert.Equal(t, tt.buildTime, info.BuildTime)
+			assert.Equal(t, runtime.Version(), info.GoVersion)
+		})
+	}
+}
+
+func TestInfoString(t *testing.T) {
+	info := Info{Commit: "1a2b3c4d5e6f7a8b9c0d", BuildTime: "2025-09-19T10:00:00Z", GoVersion: "go1.24.2"}
+	assert.Equal(t, "commit 1a2b3c4d5e6f built 2025-09-19T10:00:00Z with go1.24.2", info.String())
+
+	info = Info{GoVersion: "go1.24.2", Modified: true}
+	assert.Equal(t, "commit unknown-dirty built at an unknown time with go1.24.2", info.String())
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// How a list's total is counted, as asked with ?include_total= and ?count=
+const (
+	CountExact     = "exact"
+	CountEstimated = "estimated"
+	CountNone      = "none"
+)
+
+// EstimateMinRows is the smallest estimate trusted as a total. Lists
+// estimated to be shorter are counted exactly, which is cheap for them.
+const EstimateMinRows = 10000
+
+var ErrInvalidCount = errors.New("include_total must be true or false, and count exact or estimated")
+
+// ParseCount reads the include_total and count query values. A missing
+// count is "", an exact count the client did not ask for.
+func ParseCount(includeTotal, count string) (string, error) {
+	if includeTotal != "" {
+		include, err := strconv.ParseBool(includeTotal)
+		if err != nil {
+			return "", ErrInvalidCount
+		}
+		if !include {
+			return CountNone, nil
+		}
+	}
+	switch count {
+	case "", CountExact, CountEstimated:
+		return count, nil
+	default:
+		return "", ErrInvalidCount
+	}
+}
+
+// Total is the number of rows a list matches and how it was counted
+type Total struct {
+	Rows     int64
+	Accuracy string
+}
+
+// Total counts the rows query matches as the page asks: exactly, not at
+// all, or from the Postgres planner's estimate, which comes from the
+// table statistics (pg_class.reltuples) and needs no scan. Estimates are
+// only used on Postgres and for lists of at least EstimateMinRows; others
+// are counted exactly. Count before paginating.
+func (p Page) Total(query *gorm.DB) (Total, error) {
+	switch p.Count {
+	case CountNone:
+		return Total{Accuracy: CountNone}, nil
+	case CountEstimated:
+		if query.Dialector.Name() == "postgres" {
+			// a failed estimate falls back to counting
+			if rows, err := estimateRows(query); err == nil && rows >= EstimateMinRows {
+				return Total{Rows: rows, Accuracy: CountEstimated}, nil
+			}
+		}
+	}
+
+	total := Total{Accuracy: p.Count}
+	if p.Count == CountEstimated {
+		total.Accuracy = CountExact
+	}
+	if err := query.Count(&total.Rows).Error; err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// MetaOf is the pagination meta for a page of returned items out of total.
+// Without an exact total, has_next is true when the page is full.
+func (p Page) MetaOf(total Total, returned int) models.PageMeta {
+	if total.Accuracy == CountNone {
+		return models.PageMeta{Page: p.Page, Limit: p.Limit, HasNext: returned == p.Limit, TotalAccuracy: CountNone}
+	}
+	meta := p.Meta(total.Rows)
+	meta.TotalAccuracy = total.Accuracy
+	if total.Accuracy == CountEstimated {
+		meta.HasNext = returned == p.Limit
+	}
+	return meta
+}
+
+// estimateRows asks the Postgres planner how many rows query returns
+func estimateRows(query *gorm.DB) (int64, error) {
+	stmt := query.Session(&gorm.Session{DryRun: true}).Find(&[]map[string]interface{}{}).Statement
+	rows, err := stmt.ConnPool.QueryContext(stmt.Context, "EXPLAIN (FORMAT JSON) "+stmt.SQL.String(), stmt.Vars...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	var plan []byte
+	if !rows.Next() {
+		return 0, fmt.Errorf("no plan returned: %w", rows.Err())
+	}
+	if err := rows.Scan(&plan); err != nil {
+		return 0, err
+	}
+	return planRows(plan)
+}
+
+// planRows reads the estimated rows of the top node of a JSON query plan
+func planRows(plan []byte) (int64, error) {
+	var plans []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &plans); err != nil {
+		return 0, fmt.Errorf("invalid plan: %w", err)
+	}
+	if len(plans) == 0 {
+		return 0, errors.New("empty plan")
+	}
+	return int64(plans[0].Plan.Rows), nil
+}
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCount(t *testing.T) {
+	tests := []struct {
+		name         string
+		includeTotal string
+		count        string
+		expected     string
+		expectError  bool
+	}{
+		{name: "defaults"},
+		{name: "exact", count: "exact", expected: CountExact},
+		{name: "estimated", count: "estimated", expected: CountEstimated},
+		{name: "without total", includeTotal: "false", expected: CountNone},
+		{name: "without total wins", includeTotal: "false", count: "estimated", expected: CountNone},
+		{name: "with total", includeTotal: "true", count: "estimated", expected: CountEstimated},
+		{name: "unknown count", count: "rough", expectError: true},
+		{name: "unknown include_total", includeTotal: "maybe", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, err := ParseCount(tt.includeTotal, tt.count)
+			if tt.expectError {
+				assert.ErrorIs(t, err, ErrInvalidCount)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, count)
+		})
+	}
+}
+
+func TestPageTotal(t *testing.T) {
+	db := setupTestDB(t)
+	for _, name := range []string{"Amina", "Brian", "Chanzu"} {
+		require.NoError(t, db.Create(&models.Rider{Name: name, Phone: "+2547" + name}).Error)
+	}
+	query := db.Model(&models.Rider{})
+
+	total, err := Page{Page: 1, Limit: 2}.Total(query)
+	require.NoError(t, err)
+	assert.Equal(t, Total{Rows: 3}, total)
+
+	total, err = Page{Page: 1, Limit: 2, Count: CountEstimated}.Total(query)
+	require.NoError(t, err)
+	assert.Equal(t, Total{Rows: 3, Accuracy: CountExact}, total, "only Postgres estimates")
+
+	total, err = Page{Page: 1, Limit: 2, Count: CountNone}.Total(query)
+	require.NoError(t, err)
+	assert.Equal(t, Total{Accuracy: CountNone}, total)
+}
+
+func TestPageMetaOf(t *testing.T) {
+	page := Page{Page: 2, Limit: 25}
+	assert.Equal(t, page.Meta(60), page.MetaOf(Total{Rows: 60}, 25))
+	assert.Equal(t, models.PageMeta{Total: 30, Page: 2, Limit: 25, TotalPages: 2, HasNext: true, TotalAccuracy: CountEstimated},
+		page.MetaOf(Total{Rows: 30, Accuracy: CountEstimated}, 25), "a full page may be followed by more than estimated")
+
+	meta, err := json.Marshal(page.MetaOf(Total{Accuracy: CountNone}, 10))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"page": 2, "limit": 25, "has_next": false, "total_accuracy": "none"}`, string(meta))
+
+	meta, err = json.Marshal(page.MetaOf(Total{Rows: 60, Accuracy: CountExact}, 25))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"total": 60, "page": 2, "limit": 25, "total_pages": 3, "has_next": true, "total_accuracy": "exact"}`, string(meta))
+}
+
+func TestPlanRows(t *testing.T) {
+	rows, err := planRows([]byte(`[{"Plan": {"Node Type": "Gather", "Plan Rows": 1523467, "Plans": [{"Node Type": "Seq Scan", "Plan Rows": 634778}]}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1523467), rows)
+
+	_, err = planRows([]byte(`[]`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,356 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidFilter is returned for filter expressions that do not parse or
+// use fields and values a list does not allow
+var ErrInvalidFilter = errors.New("invalid filter")
+
+const (
+	// MaxFilterLength caps the length of a filter expression
+	MaxFilterLength = 1000
+	// MaxFilterTerms caps the comparisons in a filter expression
+	MaxFilterTerms = 20
+)
+
+// FieldType is the kind of value a filterable field holds, which sets the
+// operators and values it takes
+type FieldType int
+
+const (
+	FilterString FieldType = iota
+	FilterNumber
+	// FilterMoney takes shillings and compares them with a column of cents
+	FilterMoney
+	FilterTime
+	FilterBool
+)
+
+// FilterField is a field a filter may compare, and the column it reads
+type FilterField struct {
+	Column string
+	Type   FieldType
+}
+
+// FilterFields maps the names a list's filters may use to their columns.
+// Only these columns ever reach the SQL, and values are always bound as
+// parameters.
+type FilterFields map[string]FilterField
+
+// Filter is a parsed filter expression, compiled to a WHERE clause
+type Filter struct {
+	sql  string
+	args []interface{}
+}
+
+// Scope narrows the query to the rows the filter matches. The zero Filter
+// matches every row.
+func (f Filter) Scope(db *gorm.DB) *gorm.DB {
+	if f.sql == "" {
+		return db
+	}
+	return db.Where(f.sql, f.args...)
+}
+
+// ParseFilter parses a filter expression over the given fields:
+//
+//	amount > 1000 AND (item ~ "laptop" OR status = pending)
+//
+// Comparisons take =, !=, >, >=, < and <=, and ~ for strings, which
+// matches case insensitively anywhere in the value. They combine with AND,
+// OR, NOT and parentheses; AND binds tighter than OR. Values are numbers,
+// true or false, RFC 3339 times or YYYY-MM-DD dates (covering the whole day
+// in UTC), and words or double quoted strings. An empty expression matches
+// every row.
+func ParseFilter(expr string, fields FilterFields) (Filter, error) {
+	if strings.TrimSpace(expr) == "" {
+		return Filter{}, nil
+	}
+	if len(expr) > MaxFilterLength {
+		return Filter{}, fmt.Errorf("%w: must be at most %d characters", ErrInvalidFilter, MaxFilterLength)
+	}
+
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return Filter{}, err
+	}
+	p := &filterParser{tokens: tokens, fields: fields}
+	sql, err := p.parseOr()
+	if err != nil {
+		return Filter{}, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return Filter{}, p.errorf(next, "unexpected %q", next.text)
+	}
+	return Filter{sql: sql, args: p.args}, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+)
+
+type filterToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_-.:+", r)
+}
+
+func lexFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenOpen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenClose, text: ")", pos: i})
+			i++
+		case r == '"':
+			start := i
+			var value strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				value.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated string at position %d", ErrInvalidFilter, start+1)
+			}
+			i++
+			tokens = append(tokens, filterToken{kind: tokenString, text: value.String(), pos: start})
+		case strings.ContainsRune("=!<>~", r):
+			start := i
+			i++
+			if i < len(runes) && runes[i] == '=' && r != '=' && r != '~' {
+				i++
+			}
+			op := string(runes[start:i])
+			if op == "!" {
+				return nil, fmt.Errorf("%w: unknown operator ! at position %d", ErrInvalidFilter, start+1)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op, pos: start})
+		case isWordRune(r):
+			start := i
+			for i < len(runes) && isWordRune(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: string(runes[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q at position %d", ErrInvalidFilter, r, i+1)
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEOF, pos: len(runes)}), nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	next   int
+	fields FilterFields
+	args   []interface{}
+	terms  int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.next]
+}
+
+func (p *filterParser) take() filterToken {
+	token := p.tokens[p.next]
+	if token.kind != tokenEOF {
+		p.next++
+	}
+	return token
+}
+
+func (p *filterParser) keyword(word string) bool {
+	token := p.peek()
+	if token.kind == tokenWord && strings.EqualFold(token.text, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) errorf(token filterToken, format string, args ...interface{}) error {
+	if token.kind == tokenEOF {
+		return fmt.Errorf("%w: %s at the end", ErrInvalidFilter, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("%w: %s at position %d", ErrInvalidFilter, fmt.Sprintf(format, args...), token.pos+1)
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return "", err
+	}
+	for p.keyword("AND") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " AND " + right + ")"
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (string, error) {
+	if p.keyword("NOT") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + operand, nil
+	}
+
+	if token := p.peek(); token.kind == tokenOpen {
+		p.take()
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if closing := p.take(); closing.kind != tokenClose {
+			return "", p.errorf(closing, "expected )")
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (string, error) {
+	name := p.take()
+	if name.kind != tokenWord {
+		return "", p.errorf(name, "expected a field")
+	}
+	field, ok := p.fields[name.text]
+	if !ok {
+		return "", p.errorf(name, "unknown field %q", name.text)
+	}
+
+	op := p.take()
+	if op.kind != tokenOperator {
+		return "", p.errorf(op, "expected an operator after %s", name.text)
+	}
+	value := p.take()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return "", p.errorf(value, "expected a value after %s %s", name.text, op.text)
+	}
+
+	p.terms++
+	if p.terms > MaxFilterTerms {
+		return "", p.errorf(name, "more than %d comparisons", MaxFilterTerms)
+	}
+	return p.compile(name.text, field, op, value)
+}
+
+// compile turns one comparison into SQL, binding its value
+func (p *filterParser) compile(name string, field FilterField, op, value filterToken) (string, error) {
+	column := field.Column
+	if op.text == "~" {
+		if field.Type != FilterString {
+			return "", p.errorf(op, "~ only applies to text fields")
+		}
+		p.args = append(p.args, "%"+EscapeLike(strings.ToLower(value.text))+"%")
+		return "LOWER(" + column + ") LIKE ? " + LikeEscape, nil
+	}
+
+	switch field.Type {
+	case FilterNumber:
+		n, err := strconv.ParseFloat(value.text, 64)
+		if err != nil || value.kind != tokenWord {
+			return "", p.errorf(value, "%s takes a number", name)
+		}
+		p.args = append(p.args, n)
+	case FilterMoney:
+		n, err := strconv.ParseFloat(value.text, 64)
+		if err != nil || value.kind != tokenWord {
+			return "", p.errorf(value, "%s takes a number", name)
+		}
+		p.args = append(p.args, int64(math.Round(n*100)))
+	case FilterBool:
+		b, err := strconv.ParseBool(value.text)
+		if err != nil || value.kind != tokenWord {
+			return "", p.errorf(value, "%s takes true or false", name)
+		}
+		if op.text != "=" && op.text != "!=" {
+			return "", p.errorf(op, "%s only takes = and !=", name)
+		}
+		p.args = append(p.args, b)
+	case FilterTime:
+		if t, err := time.Parse(time.RFC3339, value.text); err == nil {
+			p.args = append(p.args, t)
+			break
+		}
+		day, err := time.Parse(time.DateOnly, value.text)
+		if err != nil {
+			return "", p.errorf(value, "%s takes a RFC 3339 time or YYYY-MM-DD date", name)
+		}
+		return p.compileDay(column, op.text, day), nil
+	default:
+		p.args = append(p.args, value.text)
+	}
+	return column + " " + op.text + " ?", nil
+}
+
+// compileDay compares a time column with a whole day
+func (p *filterParser) compileDay(column, op string, day time.Time) string {
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case "=":
+		p.args = append(p.args, day, next)
+		return "(" + column + " >= ? AND " + column + " < ?)"
+	case "!=":
+		p.args = append(p.args, day, next)
+		return "(" + column + " < ? OR " + column + " >= ?)"
+	case ">":
+		p.args = append(p.args, next)
+		return column + " >= ?"
+	case "<=":
+		p.args = append(p.args, next)
+		return column + " < ?"
+	default:
+		p.args = append(p.args, day)
+		return column + " " + op + " ?"
+	}
+}
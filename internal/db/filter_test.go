@@ -0,0 +1,133 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+var testFilterFields = FilterFields{
+	"item":   {Column: "item", Type: FilterString},
+	"amount": {Column: "amount", Type: FilterMoney},
+	"status": {Column: "status", Type: FilterString},
+	"time":   {Column: "time", Type: FilterTime},
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		name          string
+		expr          string
+		expectedSQL   string
+		expectedArgs  []interface{}
+		expectedError string
+	}{
+		{name: "empty", expr: "  "},
+		{name: "comparison", expr: "amount>1000", expectedSQL: "amount > ?", expectedArgs: []interface{}{int64(100000)}},
+		{
+			name:         "contains",
+			expr:         `item ~ "Gaming 100%"`,
+			expectedSQL:  "LOWER(item) LIKE ? ESCAPE '!'",
+			expectedArgs: []interface{}{"%gaming 100!%%"},
+		},
+		{
+			name:         "and binds tighter than or",
+			expr:         "status = pending OR amount >= 5 and amount != 7",
+			expectedSQL:  "(status = ? OR (amount >= ? AND amount != ?))",
+			expectedArgs: []interface{}{"pending", int64(500), int64(700)},
+		},
+		{
+			name:         "parentheses and not",
+			expr:         `NOT (status = "cancelled" OR status = delivered) AND item ~ laptop`,
+			expectedSQL:  "(NOT (status = ? OR status = ?) AND LOWER(item) LIKE ? ESCAPE '!')",
+			expectedArgs: []interface{}{"cancelled", "delivered", "%laptop%"},
+		},
+		{
+			name:         "date covers the day",
+			expr:         "time = 2025-03-14",
+			expectedSQL:  "(time >= ? AND time < ?)",
+			expectedArgs: []interface{}{time.Date(2025, 3, 14, 0, 0, 0, 0, time.UTC), time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:         "after a date",
+			expr:         "time > 2025-03-14",
+			expectedSQL:  "time >= ?",
+			expectedArgs: []interface{}{time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:         "quoted value with escapes",
+			expr:         `item = "say \"hi\""`,
+			expectedSQL:  "item = ?",
+			expectedArgs: []interface{}{`say "hi"`},
+		},
+		{name: "unknown field", expr: "password = x", expectedError: `unknown field "password" at position 1`},
+		{name: "column injection", expr: "amount; DROP TABLE orders", expectedError: `unexpected ';' at position 7`},
+		{name: "value injection stays a value", expr: `item = "x' OR 1=1 --"`, expectedSQL: "item = ?", expectedArgs: []interface{}{"x' OR 1=1 --"}},
+		{name: "number field takes numbers", expr: "amount > lots", expectedError: "amount takes a number at position 10"},
+		{name: "contains on a number", expr: "amount ~ 5", expectedError: "~ only applies to text fields at position 8"},
+		{name: "invalid date", expr: "time < yesterday", expectedError: "time takes a RFC 3339 time or YYYY-MM-DD date at position 8"},
+		{name: "dangling and", expr: "amount > 5 AND", expectedError: "expected a field at the end"},
+		{name: "unclosed parenthesis", expr: "(amount > 5", expectedError: "expected ) at the end"},
+		{name: "missing value", expr: "amount >", expectedError: "expected a value after amount > at the end"},
+		{name: "trailing tokens", expr: "amount > 5 status = x", expectedError: `unexpected "status" at position 12`},
+		{name: "unterminated string", expr: `item = "laptop`, expectedError: "unterminated string at position 8"},
+		{name: "too many terms", expr: strings.Repeat("amount > 1 OR ", MaxFilterTerms) + "amount > 1", expectedError: "more than 20 comparisons"},
+		{name: "too long", expr: "item = " + strings.Repeat("x", MaxFilterLength), expectedError: "must be at most 1000 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseFilter(tt.expr, testFilterFields)
+			if tt.expectedError != "" {
+				assert.True(t, errors.Is(err, ErrInvalidFilter))
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, filter.sql)
+			assert.Equal(t, tt.expectedArgs, filter.args)
+		})
+	}
+}
+
+func TestFilterScope(t *testing.T) {
+	db := setupTestDB(t)
+
+	orders := []models.Order{
+		{Item: "Gaming laptop", Amount: models.Shillings(55000), Time: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC), Status: models.OrderStatusPending, CustomerID: 1},
+		{Item: "laptop bag", Amount: models.Shillings(800), Time: time.Date(2025, 3, 31, 18, 0, 0, 0, time.UTC), Status: models.OrderStatusDelivered, CustomerID: 1},
+		{Item: "phone", Amount: models.Shillings(1200), Time: time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC), Status: models.OrderStatusCancelled, CustomerID: 1},
+	}
+	for _, order := range orders {
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	tests := []struct {
+		expr          string
+		expectedItems []string
+	}{
+		{expr: "", expectedItems: []string{"Gaming laptop", "laptop bag", "phone"}},
+		{expr: `amount>1000 AND item~"LAPTOP"`, expectedItems: []string{"Gaming laptop"}},
+		{expr: "item ~ laptop AND NOT status = delivered OR amount > 1000", expectedItems: []string{"Gaming laptop", "phone"}},
+		{expr: "time <= 2025-03-31", expectedItems: []string{"Gaming laptop", "laptop bag"}},
+		{expr: "time > 2025-03-31T12:00:00Z AND time < 2025-04-01T12:00:00+03:00", expectedItems: []string{"laptop bag", "phone"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			filter, err := ParseFilter(tt.expr, testFilterFields)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			var items []string
+			assert.NoError(t, db.Model(&models.Order{}).Scopes(filter.Scope).Order("id").Pluck("item", &items).Error)
+			assert.Equal(t, tt.expectedItems, items)
+		})
+	}
+}
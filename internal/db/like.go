@@ -0,0 +1,19 @@
+package db
+
+import "strings"
+
+// LikeEscape is the ESCAPE clause of LIKE patterns made with EscapeLike:
+//
+//	db.Where("LOWER(item) LIKE ? "+LikeEscape, "%"+EscapeLike(text)+"%")
+//
+// ! is the escape character since backslash is treated differently by
+// Postgres, MySQL and SQLite.
+const LikeEscape = "ESCAPE '!'"
+
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// EscapeLike escapes the LIKE wildcards in s, so it only matches itself in
+// a pattern used with LikeEscape
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
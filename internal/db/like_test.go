@@ -0,0 +1,13 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "50!% off!!", EscapeLike("50% off!"))
+	assert.Equal(t, "cust!_001", EscapeLike("cust_001"))
+	assert.Equal(t, "laptop", EscapeLike("laptop"))
+}
@@ -0,0 +1,100 @@
+package db
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm"
+)
+
+type primaryKey struct{}
+
+// WithPrimary makes the queries run with ctx read from the primary rather
+// than a replica, so they see writes the replicas may not have yet
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// UsesPrimary reports whether WithPrimary was applied to ctx
+func UsesPrimary(ctx context.Context) bool {
+	primary, _ := ctx.Value(primaryKey{}).(bool)
+	return primary
+}
+
+// replicaRouter picks the connection each statement runs on
+type replicaRouter struct {
+	primary  gorm.ConnPool
+	replicas []gorm.ConnPool
+	next     atomic.Uint64
+}
+
+// UseReplicas sends reads to the replicas, in turn, and everything else to
+// the primary db was opened on. Reads stay on the primary inside
+// transactions, when they lock rows, and when their context comes from
+// WithPrimary. Register it after migrating, so the migrator reads the
+// schema it is changing.
+func UseReplicas(db *gorm.DB, replicas ...gorm.ConnPool) error {
+	if len(replicas) == 0 {
+		return nil
+	}
+	r := &replicaRouter{primary: db.ConnPool, replicas: replicas}
+
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register("replicas:query", r.read); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("replicas:row", r.read); err != nil {
+		return err
+	}
+	// a statement chained off one that read, such as a Count before an
+	// Update, would otherwise write to the replica it read from. Writes
+	// switch before their default transaction begins on the wrong one.
+	if err := callbacks.Create().Before("gorm:begin_transaction").Register("replicas:create", r.write); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:begin_transaction").Register("replicas:update", r.write); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:begin_transaction").Register("replicas:delete", r.write); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("replicas:raw", r.write); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *replicaRouter) read(db *gorm.DB) {
+	stmt := db.Statement
+	if r.inTransaction(db) || UsesPrimary(stmt.Context) {
+		return
+	}
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		stmt.ConnPool = r.primary
+		return
+	}
+	// raw SQL run with Scan or Row may write, e.g. UPDATE ... RETURNING
+	if sql := strings.TrimSpace(stmt.SQL.String()); sql != "" && !isSelect(sql) {
+		stmt.ConnPool = r.primary
+		return
+	}
+	stmt.ConnPool = r.replicas[r.next.Add(1)%uint64(len(r.replicas))]
+}
+
+func (r *replicaRouter) write(db *gorm.DB) {
+	if !r.inTransaction(db) {
+		db.Statement.ConnPool = r.primary
+	}
+}
+
+func (r *replicaRouter) inTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+func isSelect(sql string) bool {
+	word, _, _ := strings.Cut(sql, " ")
+	word = strings.ToUpper(word)
+	return word == "SELECT" || word == "WITH"
+}
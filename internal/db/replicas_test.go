@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestUseReplicas(t *testing.T) {
+	primary := setupTestDB(t)
+	replica := setupTestDB(t)
+	// the replica has not caught up with the primary's customer yet
+	primary.Create(&models.Customer{Name: "Wanjiru", Phone: "+254700000001", Code: "C-1"})
+	replicaConn, err := replica.DB()
+	assert.NoError(t, err)
+	assert.NoError(t, UseReplicas(primary, replicaConn))
+
+	ctx := context.Background()
+	count := func(db *gorm.DB) int64 {
+		var n int64
+		db.Model(&models.Customer{}).Count(&n)
+		return n
+	}
+
+	assert.Equal(t, int64(0), count(primary.WithContext(ctx)), "reads go to the replica")
+	assert.Equal(t, int64(1), count(primary.WithContext(WithPrimary(ctx))), "WithPrimary reads the primary")
+
+	primary.Transaction(func(tx *gorm.DB) error {
+		assert.Equal(t, int64(1), count(tx), "transactions stay on the primary")
+		return nil
+	})
+
+	// writes go to the primary, where the customer is
+	update := primary.WithContext(ctx).Model(&models.Customer{}).Where("name = ?", "Wanjiru").Update("name", "Wanjiru K")
+	assert.NoError(t, update.Error)
+	assert.Equal(t, int64(1), update.RowsAffected)
+
+	var customer models.Customer
+	primary.WithContext(WithPrimary(ctx)).First(&customer)
+	assert.Equal(t, "Wanjiru K", customer.Name)
+}
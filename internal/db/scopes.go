@@ -0,0 +1,104 @@
+// Package db holds GORM scopes for the filters list endpoints share, so
+// every handler paginates and filters the same way:
+//
+//	query.Scopes(db.ByCustomer(id), db.CreatedBetween(from, to), db.Paginate(page))
+package db
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	DefaultPageLimit = 10
+	MaxPageLimit     = 100
+	// MaxPage keeps offsets within what every database accepts
+	MaxPage = 100000
+)
+
+var (
+	ErrInvalidPage  = fmt.Errorf("page must be a whole number from 1 to %d", MaxPage)
+	ErrInvalidLimit = errors.New("limit must be a whole number from 1")
+)
+
+// Page is a requested page of a list, numbered from 1. Count is how its
+// total is counted, see ParseCount.
+type Page struct {
+	Page  int
+	Limit int
+	Count string
+}
+
+// ParsePage reads page and limit query values. Missing values fall back to
+// the first page of DefaultPageLimit, and limit is capped at MaxPageLimit.
+// Anything else that is not a positive number is rejected with
+// ErrInvalidPage or ErrInvalidLimit.
+func ParsePage(page, limit string) (Page, error) {
+	p := Page{Page: 1, Limit: DefaultPageLimit}
+
+	if page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 || n > MaxPage {
+			return p, ErrInvalidPage
+		}
+		p.Page = n
+	}
+	if limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return p, ErrInvalidLimit
+		}
+		p.Limit = min(n, MaxPageLimit)
+	}
+	return p, nil
+}
+
+// Meta is the pagination meta for a list of total items
+func (p Page) Meta(total int64) models.PageMeta {
+	pages := int((total + int64(p.Limit) - 1) / int64(p.Limit))
+	return models.PageMeta{Total: total, Page: p.Page, Limit: p.Limit, TotalPages: pages, HasNext: p.Page < pages}
+}
+
+// Paginate limits the query to the page. Count before applying it.
+func Paginate(p Page) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Offset((p.Page - 1) * p.Limit).Limit(p.Limit)
+	}
+}
+
+// ByCustomer keeps rows of one customer. A zero id keeps all rows, so an
+// optional ?customer_id= filter can be applied unconditionally.
+func ByCustomer(customerID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if customerID == 0 {
+			return db
+		}
+		return db.Where("customer_id = ?", customerID)
+	}
+}
+
+// CreatedBetween keeps rows created at or after from and before to. Either
+// bound may be zero to leave that side open.
+func CreatedBetween(from, to time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if !from.IsZero() {
+			db = db.Where("created_at >= ?", from)
+		}
+		if !to.IsZero() {
+			db = db.Where("created_at < ?", to)
+		}
+		return db
+	}
+}
+
+// NotDeleted excludes soft deleted rows. GORM already does this for models
+// with a DeletedAt field; use it on Unscoped or Table queries, where it
+// does not.
+func NotDeleted(db *gorm.DB) *gorm.DB {
+	return db.Where("deleted_at IS NULL")
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name          string
+		page          string
+		limit         string
+		expected      Page
+		expectedError error
+	}{
+		{name: "defaults", expected: Page{Page: 1, Limit: DefaultPageLimit}},
+		{name: "given", page: "3", limit: "25", expected: Page{Page: 3, Limit: 25}},
+		{name: "capped limit", page: "1", limit: "1000", expected: Page{Page: 1, Limit: MaxPageLimit}},
+		{name: "negative page", page: "-1", expectedError: ErrInvalidPage},
+		{name: "zero page", page: "0", expectedError: ErrInvalidPage},
+		{name: "page past the last allowed", page: "100001", expectedError: ErrInvalidPage},
+		{name: "non-numeric limit", limit: "abc", expectedError: ErrInvalidLimit},
+		{name: "zero limit", limit: "0", expectedError: ErrInvalidLimit},
+		{name: "fractional limit", limit: "2.5", expectedError: ErrInvalidLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := ParsePage(tt.page, tt.limit)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, page)
+		})
+	}
+}
+
+func TestPageMeta(t *testing.T) {
+	assert.Equal(t, models.PageMeta{Total: 42, Page: 1, Limit: 25, TotalPages: 2, HasNext: true}, Page{Page: 1, Limit: 25}.Meta(42))
+	assert.Equal(t, models.PageMeta{Total: 50, Page: 2, Limit: 25, TotalPages: 2, HasNext: false}, Page{Page: 2, Limit: 25}.Meta(50))
+	assert.Equal(t, models.PageMeta{Total: 0, Page: 1, Limit: 10, TotalPages: 0, HasNext: false}, Page{Page: 1, Limit: 10}.Meta(0))
+	assert.Equal(t, models.PageMeta{Total: 5, Page: 4, Limit: 10, TotalPages: 1, HasNext: false}, Page{Page: 4, Limit: 10}.Meta(5))
+}
+
+func TestScopes(t *testing.T) {
+	db := setupTestDB(t)
+
+	base := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		customerID := uint(1)
+		if i%2 == 1 {
+			customerID = 2
+		}
+		order := models.Order{Item: "item", Amount: models.Shillings(100), Time: base, CustomerID: customerID, CreatedAt: base.AddDate(0, 0, i)}
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+	db.Delete(&models.Order{}, 5)
+
+	ids := func(query *gorm.DB) []uint {
+		var orders []models.Order
+		query.Order("id ASC").Find(&orders)
+		ids := make([]uint, 0, len(orders))
+		for _, order := range orders {
+			ids = append(ids, order.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		name     string
+		query    *gorm.DB
+		expected []uint
+	}{
+		{name: "by customer", query: db.Scopes(ByCustomer(1)), expected: []uint{1, 3}},
+		{name: "no customer filter", query: db.Scopes(ByCustomer(0)), expected: []uint{1, 2, 3, 4}},
+		{name: "created between", query: db.Scopes(CreatedBetween(base.AddDate(0, 0, 1), base.AddDate(0, 0, 3))), expected: []uint{2, 3}},
+		{name: "created from", query: db.Scopes(CreatedBetween(base.AddDate(0, 0, 3), time.Time{})), expected: []uint{4}},
+		{name: "paginate", query: db.Scopes(Paginate(Page{Page: 2, Limit: 3})), expected: []uint{4}},
+		{name: "composed", query: db.Scopes(ByCustomer(2), CreatedBetween(base, time.Time{}), Paginate(Page{Page: 1, Limit: 1})), expected: []uint{2}},
+		{name: "not deleted unscoped", query: db.Unscoped().Scopes(NotDeleted), expected: []uint{1, 2, 3, 4}},
+		{name: "unscoped", query: db.Unscoped(), expected: []uint{1, 2, 3, 4, 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ids(tt.query))
+		})
+	}
+}
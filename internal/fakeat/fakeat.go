@@ -0,0 +1,294 @@
+// Package fakeat is an in-memory Africa's Talking messaging API for tests.
+// It accepts sends like the real API, records them, and can be told to
+// throttle, fail requests or reject numbers. It can also post delivery
+// reports and incoming messages to the API's callbacks.
+//
+//	at := fakeat.NewServer("testuser", "testapikey")
+//	defer at.Close()
+//	sms := services.NewSMSService("testuser", "testapikey", "").WithEndpoint(at.URL())
+package fakeat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recipient statuses Africa's Talking returns per number
+const (
+	StatusProcessed           = 100
+	StatusSent                = 101
+	StatusQueued              = 102
+	StatusRiskHold            = 401
+	StatusInvalidSenderID     = 402
+	StatusInvalidPhoneNumber  = 403
+	StatusUnsupportedNumber   = 404
+	StatusInsufficientBalance = 405
+	StatusUserInBlacklist     = 406
+	StatusCouldNotRoute       = 407
+	StatusInternalServerError = 500
+	StatusGatewayError        = 501
+	StatusRejectedByGateway   = 502
+)
+
+var statusNames = map[int]string{
+	StatusProcessed:           "Processed",
+	StatusSent:                "Success",
+	StatusQueued:              "Queued",
+	StatusRiskHold:            "RiskHold",
+	StatusInvalidSenderID:     "InvalidSenderId",
+	StatusInvalidPhoneNumber:  "InvalidPhoneNumber",
+	StatusUnsupportedNumber:   "UnsupportedNumberType",
+	StatusInsufficientBalance: "InsufficientBalance",
+	StatusUserInBlacklist:     "UserInBlacklist",
+	StatusCouldNotRoute:       "CouldNotRoute",
+	StatusInternalServerError: "InternalServerError",
+	StatusGatewayError:        "GatewayError",
+	StatusRejectedByGateway:   "RejectedByGateway",
+}
+
+// Message is one recipient of a send the server accepted
+type Message struct {
+	ID         string
+	Username   string
+	From       string
+	To         string
+	Text       string
+	StatusCode int
+	Status     string
+	SentAt     time.Time
+}
+
+// Server emulates https://api.africastalking.com/version1/messaging
+type Server struct {
+	username string
+	apiKey   string
+	server   *httptest.Server
+
+	mu         sync.Mutex
+	messages   []Message
+	requests   int
+	statuses   map[string]int
+	failures   []int
+	nextID     int
+	costPerSMS string
+}
+
+// NewServer starts a server accepting sends from username with apiKey
+func NewServer(username, apiKey string) *Server {
+	s := &Server{
+		username:   username,
+		apiKey:     apiKey,
+		statuses:   make(map[string]int),
+		costPerSMS: "KES 0.8000",
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// URL is the messaging endpoint to send to
+func (s *Server) URL() string {
+	return s.server.URL + "/version1/messaging"
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// RejectNumber answers sends to phone, as formatted by the client, with
+// the given recipient status code instead of success
+func (s *Server) RejectNumber(phone string, statusCode int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[phone] = statusCode
+}
+
+// FailRequests answers the next n requests with the HTTP status, e.g.
+// http.StatusTooManyRequests to throttle or 503 for an outage. Failed
+// requests send nothing.
+func (s *Server) FailRequests(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// Messages returns every recipient accepted so far, rejected ones included
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Requests counts the requests made to the endpoint, failed ones included
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Reset forgets the messages, requests and configured failures
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = nil
+	s.requests = 0
+	s.statuses = make(map[string]int)
+	s.failures = nil
+}
+
+type recipientResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Number     string `json:"number"`
+	Status     string `json:"status"`
+	Cost       string `json:"cost"`
+	MessageID  string `json:"messageId"`
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/version1/messaging" {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+
+	if len(s.failures) > 0 {
+		status := s.failures[0]
+		s.failures = s.failures[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("apikey") != s.apiKey || r.PostForm.Get("username") != s.username {
+		http.Error(w, "The supplied authentication is invalid", http.StatusUnauthorized)
+		return
+	}
+
+	text := r.PostForm.Get("message")
+	to := r.PostForm.Get("to")
+	if to == "" || text == "" {
+		writeJSON(w, http.StatusBadRequest, "Invalid request", nil)
+		return
+	}
+
+	var recipients []recipientResponse
+	sent := 0
+	for _, number := range strings.Split(to, ",") {
+		number = strings.TrimSpace(number)
+		code, rejected := s.statuses[number]
+		if !rejected {
+			code = StatusSent
+		}
+
+		recipient := recipientResponse{StatusCode: code, Number: number, Status: statusNames[code], Cost: "0"}
+		if !rejected {
+			s.nextID++
+			recipient.MessageID = fmt.Sprintf("ATXid_%d", s.nextID)
+			recipient.Cost = s.costPerSMS
+			sent++
+		}
+		recipients = append(recipients, recipient)
+		s.messages = append(s.messages, Message{
+			ID:         recipient.MessageID,
+			Username:   s.username,
+			From:       r.PostForm.Get("from"),
+			To:         number,
+			Text:       text,
+			StatusCode: code,
+			Status:     recipient.Status,
+			SentAt:     time.Now(),
+		})
+	}
+
+	writeJSON(w, http.StatusCreated, fmt.Sprintf("Sent to %d/%d", sent, len(recipients)), recipients)
+}
+
+func writeJSON(w http.ResponseWriter, status int, message string, recipients []recipientResponse) {
+	var body struct {
+		SMSMessageData struct {
+			Message    string              `json:"Message"`
+			Recipients []recipientResponse `json:"Recipients"`
+		} `json:"SMSMessageData"`
+	}
+	body.SMSMessageData.Message = message
+	body.SMSMessageData.Recipients = recipients
+	if body.SMSMessageData.Recipients == nil {
+		body.SMSMessageData.Recipients = []recipientResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// DeliveryReport is a delivery status Africa's Talking posts for a sent
+// message
+type DeliveryReport struct {
+	ID            string
+	Status        string // Success, Failed, Rejected, Buffered or Sent
+	PhoneNumber   string
+	NetworkCode   string
+	FailureReason string
+	RetryCount    int
+}
+
+// Deliver posts report to callbackURL as Africa's Talking would. The
+// callback's response status is returned.
+func (s *Server) Deliver(ctx context.Context, callbackURL string, report DeliveryReport) (int, error) {
+	form := url.Values{
+		"id":          {report.ID},
+		"status":      {report.Status},
+		"phoneNumber": {report.PhoneNumber},
+		"networkCode": {report.NetworkCode},
+		"retryCount":  {fmt.Sprint(report.RetryCount)},
+	}
+	if report.FailureReason != "" {
+		form.Set("failureReason", report.FailureReason)
+	}
+	return postForm(ctx, callbackURL, form)
+}
+
+// Inbound posts an incoming message from phone to callbackURL as Africa's
+// Talking would, and returns the callback's response status
+func (s *Server) Inbound(ctx context.Context, callbackURL, from, to, text string) (int, error) {
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("ATXid_%d", s.nextID)
+	s.mu.Unlock()
+
+	return postForm(ctx, callbackURL, url.Values{
+		"from": {from},
+		"to":   {to},
+		"text": {text},
+		"id":   {id},
+		"date": {time.Now().UTC().Format("2006-01-02 15:04:05")},
+	})
+}
+
+func postForm(ctx context.Context, callbackURL string, form url.Values) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,48 @@
+package fakeat
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCallbacks(t *testing.T) {
+	at := NewServer("testuser", "testapikey")
+	defer at.Close()
+
+	var received []url.Values
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		received = append(received, r.PostForm)
+	}))
+	defer receiver.Close()
+
+	status, err := at.Deliver(context.Background(), receiver.URL, DeliveryReport{
+		ID:            "ATXid_1",
+		Status:        "Failed",
+		PhoneNumber:   "+254740827150",
+		NetworkCode:   "63902",
+		FailureReason: "AbsentSubscriber",
+		RetryCount:    1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = at.Inbound(context.Background(), receiver.URL, "+254740827150", "22384", "STATUS 1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	require.Len(t, received, 2)
+	assert.Equal(t, "ATXid_1", received[0].Get("id"))
+	assert.Equal(t, "Failed", received[0].Get("status"))
+	assert.Equal(t, "AbsentSubscriber", received[0].Get("failureReason"))
+	assert.Equal(t, "1", received[0].Get("retryCount"))
+	assert.Equal(t, "+254740827150", received[1].Get("from"))
+	assert.Equal(t, "STATUS 1", received[1].Get("text"))
+	assert.NotEmpty(t, received[1].Get("id"))
+}
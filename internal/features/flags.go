@@ -0,0 +1,170 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const defaultCacheTTL = 30 * time.Second
+
+// Store reads feature flags from the database and caches them for a short
+// TTL, so checking a flag on the request path does not cost a query.
+// Changes made through Set are visible at once on this instance and within
+// one TTL on others.
+type Store struct {
+	db  *gorm.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.RWMutex
+	flags    map[string]models.FeatureFlag
+	loadedAt time.Time
+}
+
+func NewStore(db *gorm.DB, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	return &Store{
+		db:  db,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Enabled reports whether key is on for subject, usually the caller's user
+// id. Unknown flags are off, and so is every flag if the store cannot be read.
+func (s *Store) Enabled(ctx context.Context, key, subject string) bool {
+	flags, err := s.load(ctx)
+	if err != nil {
+		log.Printf("failed to load feature flags: %v", err)
+		return false
+	}
+
+	flag, ok := flags[key]
+	if !ok || !flag.Enabled {
+		return false
+	}
+
+	for _, allowed := range flag.Subjects {
+		if allowed == subject {
+			return true
+		}
+	}
+
+	if flag.RolloutPercent >= 100 {
+		return true
+	}
+	if flag.RolloutPercent <= 0 || subject == "" {
+		return false
+	}
+	return bucket(key, subject) < flag.RolloutPercent
+}
+
+// EnabledFor checks key for the authenticated user of a request
+func (s *Store) EnabledFor(c *gin.Context, key string) bool {
+	return s.Enabled(c.Request.Context(), key, middleware.CurrentSubject(c))
+}
+
+// Gate hides a route behind a flag, answering 404 while it is off for the
+// caller. It must run after AuthMiddleware to roll out per user.
+func (s *Store) Gate(key string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.EnabledFor(c, key) {
+			respond.AbortError(c, http.StatusNotFound, "not_found", "resource not found")
+			return
+		}
+		c.Next()
+	}
+}
+
+// List returns every flag, ordered by key
+func (s *Store) List(ctx context.Context) ([]models.FeatureFlag, error) {
+	var flags []models.FeatureFlag
+	if err := s.db.WithContext(ctx).Order("key ASC").Find(&flags).Error; err != nil {
+		return nil, err
+	}
+	return flags, nil
+}
+
+// Set creates or updates a flag and drops the cache
+func (s *Store) Set(ctx context.Context, key string, req models.UpdateFeatureFlagRequest) (models.FeatureFlag, error) {
+	db := s.db.WithContext(ctx)
+
+	var flag models.FeatureFlag
+	if err := db.Where(models.FeatureFlag{Key: key}).FirstOrInit(&flag).Error; err != nil {
+		return flag, fmt.Errorf("failed to load flag %s: %w", key, err)
+	}
+
+	if req.Description != nil {
+		flag.Description = *req.Description
+	}
+	if req.Enabled != nil {
+		flag.Enabled = *req.Enabled
+	}
+	if req.RolloutPercent != nil {
+		flag.RolloutPercent = *req.RolloutPercent
+	}
+	if req.Subjects != nil {
+		flag.Subjects = req.Subjects
+	}
+
+	if err := db.Save(&flag).Error; err != nil {
+		return flag, fmt.Errorf("failed to save flag %s: %w", key, err)
+	}
+
+	s.invalidate()
+	return flag, nil
+}
+
+func (s *Store) load(ctx context.Context) (map[string]models.FeatureFlag, error) {
+	s.mu.RLock()
+	if s.flags != nil && s.now().Sub(s.loadedAt) < s.ttl {
+		flags := s.flags
+		s.mu.RUnlock()
+		return flags, nil
+	}
+	s.mu.RUnlock()
+
+	list, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := make(map[string]models.FeatureFlag, len(list))
+	for _, flag := range list {
+		flags[flag.Key] = flag
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.loadedAt = s.now()
+	s.mu.Unlock()
+
+	return flags, nil
+}
+
+func (s *Store) invalidate() {
+	s.mu.Lock()
+	s.flags = nil
+	s.mu.Unlock()
+}
+
+// bucket places subject in one of 100 buckets per flag, so the same subject
+// stays in or out of a rollout as its percentage grows
+func bucket(key, subject string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key + ":" + subject))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,134 @@
+package features
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestStore(t *testing.T) *Store {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return NewStore(db, time.Minute)
+}
+
+func boolPtr(b bool) *bool { return &b }
+func intPtr(n int) *int    { return &n }
+
+func TestEnabled(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestStore(t)
+
+	store.Set(ctx, "off", models.UpdateFeatureFlagRequest{Enabled: boolPtr(false), RolloutPercent: intPtr(100)})
+	store.Set(ctx, "everyone", models.UpdateFeatureFlagRequest{Enabled: boolPtr(true), RolloutPercent: intPtr(100)})
+	store.Set(ctx, "allow-list", models.UpdateFeatureFlagRequest{Enabled: boolPtr(true), Subjects: []string{"user-1"}})
+
+	tests := []struct {
+		name     string
+		key      string
+		subject  string
+		expected bool
+	}{
+		{name: "unknown flag", key: "missing", subject: "user-1", expected: false},
+		{name: "disabled flag", key: "off", subject: "user-1", expected: false},
+		{name: "full rollout", key: "everyone", subject: "user-2", expected: true},
+		{name: "full rollout without subject", key: "everyone", subject: "", expected: true},
+		{name: "listed subject", key: "allow-list", subject: "user-1", expected: true},
+		{name: "unlisted subject", key: "allow-list", subject: "user-2", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, store.Enabled(ctx, tt.key, tt.subject))
+		})
+	}
+}
+
+func TestPercentageRollout(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestStore(t)
+
+	store.Set(ctx, "new-pricing", models.UpdateFeatureFlagRequest{Enabled: boolPtr(true), RolloutPercent: intPtr(25)})
+
+	enabled := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		if store.Enabled(ctx, "new-pricing", subject) {
+			enabled[subject] = true
+		}
+	}
+	assert.InDelta(t, 250, len(enabled), 60)
+
+	// raising the percentage keeps everyone already in the rollout
+	store.Set(ctx, "new-pricing", models.UpdateFeatureFlagRequest{RolloutPercent: intPtr(50)})
+	for subject := range enabled {
+		assert.True(t, store.Enabled(ctx, "new-pricing", subject), "subject %s dropped out", subject)
+	}
+}
+
+func TestEnabledUsesCache(t *testing.T) {
+	ctx := context.Background()
+	store := setupTestStore(t)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Set(ctx, "cached", models.UpdateFeatureFlagRequest{Enabled: boolPtr(true), RolloutPercent: intPtr(100)})
+	assert.True(t, store.Enabled(ctx, "cached", "user-1"))
+
+	// a change made by another instance is only seen once the cache expires
+	store.db.Model(&models.FeatureFlag{}).Where("key = ?", "cached").Update("enabled", false)
+	assert.True(t, store.Enabled(ctx, "cached", "user-1"))
+
+	now = now.Add(2 * time.Minute)
+	assert.False(t, store.Enabled(ctx, "cached", "user-1"))
+}
+
+func TestGate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := setupTestStore(t)
+
+	store.Set(ctx, "beta", models.UpdateFeatureFlagRequest{Enabled: boolPtr(true), Subjects: []string{"user-1"}})
+
+	tests := []struct {
+		name           string
+		subject        string
+		expectedStatus int
+	}{
+		{name: "subject in rollout", subject: "user-1", expectedStatus: http.StatusOK},
+		{name: "subject outside rollout", subject: "user-2", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/beta", func(c *gin.Context) {
+				middleware.SetCurrentUser(c, &models.Claims{Sub: tt.subject})
+				c.Next()
+			}, store.Gate("beta"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/beta", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
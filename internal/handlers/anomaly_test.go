@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnomalyCheck(t *testing.T) {
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	anomalies := services.NewAnomalyService(db, mockSMSService, []string{"+254700000000"}, services.AnomalyPolicy{Ratio: 10, MinHistory: 5})
+
+	regular := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	newcomer := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"}
+	db.Create(&regular)
+	db.Create(&newcomer)
+
+	for _, amount := range []float64{100, 110, 120, 130, 140} {
+		db.Create(&models.Order{Item: "groceries", Amount: models.Shillings(amount), Time: time.Now(), CustomerID: regular.ID})
+	}
+	giant := models.Order{Item: "television", Amount: models.Shillings(2000), Time: time.Now(), CustomerID: regular.ID}
+	db.Create(&giant)
+	// four times the usual, with the giant order in the history
+	db.Create(&models.Order{Item: "blender", Amount: models.Shillings(500), Time: time.Now(), CustomerID: regular.ID})
+
+	db.Create(&models.Order{Item: "bread", Amount: models.Shillings(50), Time: time.Now(), CustomerID: newcomer.ID})
+	db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(10000), Time: time.Now(), CustomerID: newcomer.ID})
+
+	flagged, err := anomalies.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, flagged, "customers without enough history are not checked")
+
+	var found []models.OrderAnomaly
+	db.Find(&found)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, giant.ID, found[0].OrderID)
+		assert.Equal(t, regular.ID, found[0].CustomerID)
+		assert.Equal(t, models.Shillings(120), found[0].TypicalAmount)
+		assert.InDelta(t, 2000.0/120, found[0].Ratio, 1e-9)
+		assert.NotNil(t, found[0].AlertedAt)
+	}
+	if assert.Len(t, mockSMSService.SentMessages, 1) {
+		assert.Equal(t, "+254700000000", mockSMSService.SentMessages[0].To)
+		assert.Contains(t, mockSMSService.SentMessages[0].Message, "order 6 for 2000.00")
+	}
+
+	var unchecked int64
+	db.Model(&models.Order{}).Where("amount_checked_at IS NULL").Count(&unchecked)
+	assert.Zero(t, unchecked)
+
+	// checked orders and sent alerts are not repeated
+	flagged, err = anomalies.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, flagged)
+	assert.Len(t, mockSMSService.SentMessages, 1)
+}
+
+func TestMigrateSkipsAmountCheckForExistingOrders(t *testing.T) {
+	db := testutil.DB(t)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID})
+
+	assert.NoError(t, db.Migrator().DropColumn(&models.Order{}, "amount_checked_at"))
+	assert.NoError(t, models.Migrate(db))
+
+	var unchecked int64
+	db.Model(&models.Order{}).Where("amount_checked_at IS NULL").Count(&unchecked)
+	assert.Zero(t, unchecked, "orders placed before the check existed are left alone")
+
+	db.Create(&models.Order{Item: "phone", Amount: models.Shillings(800), Time: time.Now(), CustomerID: customer.ID})
+	db.Model(&models.Order{}).Where("amount_checked_at IS NULL").Count(&unchecked)
+	assert.Equal(t, int64(1), unchecked)
+}
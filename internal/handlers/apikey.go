@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHandler lets admins issue and revoke partner API keys and report
+// their usage for billing
+type APIKeyHandler struct {
+	keys  *services.APIKeyStore
+	audit services.AuditRecorder
+}
+
+func NewAPIKeyHandler(keys *services.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{keys: keys}
+}
+
+// WithAudit records keys issued and revoked
+func (h *APIKeyHandler) WithAudit(audit services.AuditRecorder) *APIKeyHandler {
+	h.audit = audit
+	return h
+}
+
+// CreateAPIKey issues a key. The key is only ever shown in this response.
+func (h *APIKeyHandler) CreateAPIKey(c *gin.Context) {
+	var req models.CreateAPIKeyRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	// the scopes were checked when binding; this drops repeats
+	scopes, _ := models.ParseScope(strings.Join(req.Scopes, " "))
+	key := models.APIKey{Name: req.Name, MonthlyQuota: req.MonthlyQuota, Scopes: scopes, CreatedBy: middleware.CurrentUserEmail(c)}
+	if err := h.keys.Create(c.Request.Context(), &key); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to create api key")
+		return
+	}
+	h.record(c, models.AuditAPIKeyCreated, key)
+
+	respond.OK(c, http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) GetAPIKeys(c *gin.Context) {
+	keys, err := h.keys.List(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve api keys")
+		return
+	}
+	respond.OK(c, http.StatusOK, keys)
+}
+
+// RevokeAPIKey stops a key from being accepted. Revoking a revoked key
+// changes nothing.
+func (h *APIKeyHandler) RevokeAPIKey(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid api key id")
+		return
+	}
+
+	key, err := h.keys.Revoke(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			respond.Error(c, http.StatusNotFound, "api_key_not_found", "api key not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to revoke api key")
+		return
+	}
+	h.record(c, models.AuditAPIKeyRevoked, key)
+
+	respond.OK(c, http.StatusOK, key)
+}
+
+// GetUsage reports each key's requests per day in ?month= (YYYY-MM, default
+// the current month in UTC), optionally for one ?api_key_id=
+func (h *APIKeyHandler) GetUsage(c *gin.Context) {
+	month := time.Now().UTC()
+	if value := c.Query("month"); value != "" {
+		m, err := time.Parse(services.MonthLayout, value)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_month", "month must be in YYYY-MM format")
+			return
+		}
+		month = m
+	}
+
+	var keyID uint64
+	if value := c.Query("api_key_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid api key id")
+			return
+		}
+		keyID = id
+	}
+
+	usage, err := h.keys.Usage(c.Request.Context(), month, uint(keyID))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve api usage")
+		return
+	}
+	respond.OK(c, http.StatusOK, usage)
+}
+
+func (h *APIKeyHandler) record(c *gin.Context, eventType string, key models.APIKey) {
+	if h.audit == nil {
+		return
+	}
+	details := fmt.Sprintf("api_key=%d prefix=%s quota=%d", key.ID, key.Prefix, key.MonthlyQuota)
+	if len(key.Scopes) > 0 {
+		details += " scopes=" + strings.Join(key.Scopes, ",")
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArchiveOrders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	archiveService := services.NewArchiveService(db, 90*24*time.Hour)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	old := time.Now().AddDate(-1, 0, 0)
+	orders := []models.Order{
+		{Item: "laptop", Amount: models.Shillings(1000), Status: models.OrderStatusDelivered, CreatedAt: old},
+		{Item: "phone", Amount: models.Shillings(500), Status: models.OrderStatusCancelled, CreatedAt: old},
+		{Item: "tablet", Amount: models.Shillings(250), Status: models.OrderStatusPending, CreatedAt: old},
+		{Item: "mouse", Amount: models.Shillings(100), Status: models.OrderStatusDelivered, CreatedAt: time.Now()},
+	}
+	for _, order := range orders {
+		order.CustomerID = customer.ID
+		order.Time = order.CreatedAt
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	rider := models.Rider{Name: "Otieno", Phone: "+254711000001", Active: true}
+	db.Create(&rider)
+	db.Create(&models.DeliveryAssignment{OrderID: 1, RiderID: rider.ID, Status: models.AssignmentStatusDelivered})
+
+	moved, err := archiveService.ArchiveOrders(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	var assignments int64
+	db.Model(&models.DeliveryAssignment{}).Count(&assignments)
+	assert.Zero(t, assignments)
+
+	var remaining []models.Order
+	db.Unscoped().Order("id ASC").Find(&remaining)
+	assert.Len(t, remaining, 2)
+	assert.Equal(t, "tablet", remaining[0].Item)
+	assert.Equal(t, "mouse", remaining[1].Item)
+
+	// a second run has nothing left to move
+	moved, err = archiveService.ArchiveOrders(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	req, _ := http.NewRequest("GET", "/orders/archive", nil)
+	c.Request = req
+
+	handler.GetArchivedOrders(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var archived []models.ArchivedOrder
+	var meta models.PageMeta
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &archived, Meta: &meta})
+	assert.Equal(t, int64(2), meta.Total)
+	assert.Len(t, archived, 2)
+	for _, order := range archived {
+		assert.Equal(t, customer.ID, order.CustomerID)
+		assert.False(t, order.ArchivedAt.IsZero())
+		assert.WithinDuration(t, old, order.CreatedAt, time.Second)
+	}
+}
@@ -2,152 +2,251 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
-	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/oauth2"
 )
 
 type AuthHandler struct {
-	jwtSecret    []byte
-	provider     *oidc.Provider
-	Verifier     *oidc.IDTokenVerifier
-	oauth2Config *oauth2.Config
-	oidcEnabled  bool
-	redirectURI  string
-}
+	jwtSecret []byte
+
+	// OIDC providers in the order configured; the first is used when a
+	// login does not name one
+	providers []*oidcProvider
+	byName    map[string]*oidcProvider
 
-type Claims struct {
-	Email string `json:"email"`
-	Sub   string `json:"sub"`
-	Name  string `json:"name"`
-	Iss   string `json:"iss"`
-	Aud   string `json:"aud"`
-	Exp   int64  `json:"exp"`
-	Iat   int64  `json:"iat"`
-	jwt.RegisteredClaims
+	sessions   *services.SessionStore
+	identities *services.IdentityStore
+	audit      services.AuditRecorder
+	cookies    middleware.CookieConfig
+	tokens     middleware.TokenConfig
+	// noPasswords switches the password login off, see WithoutPasswordLogin
+	noPasswords bool
 }
 
 func NewAuthHandler() *AuthHandler {
 	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
 
 	h := &AuthHandler{
-		jwtSecret:   jwtSecret,
-		oidcEnabled: false,
-	}
-
-	providerURL := os.Getenv("OIDC_PROVIDER_URL")
-	clientID := os.Getenv("OIDC_CLIENT_ID")
-	clientSecret := os.Getenv("OIDC_CLIENT_SECRET")
-	redirectURI := os.Getenv("OIDC_REDIRECT_URI")
-
-	if providerURL != "" && clientID != "" && clientSecret != "" && redirectURI != "" {
-		ctx := context.Background()
-		provider, err := oidc.NewProvider(ctx, providerURL)
-		if err == nil {
-			verifier := provider.Verifier(&oidc.Config{ClientID: clientID})
-			oauth2Config := &oauth2.Config{
-				ClientID:     clientID,
-				ClientSecret: clientSecret,
-				Endpoint:     provider.Endpoint(),
-				Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
-				RedirectURL:  redirectURI,
-			}
-			h.provider = provider
-			h.Verifier = verifier
-			h.oauth2Config = oauth2Config
-			h.oidcEnabled = true
-			h.redirectURI = redirectURI
+		jwtSecret: jwtSecret,
+		byName:    map[string]*oidcProvider{},
+		tokens:    middleware.DefaultTokenConfig(),
+	}
+
+	retry, _ := time.ParseDuration(os.Getenv("OIDC_DISCOVERY_RETRY"))
+	if retry <= 0 {
+		retry = 10 * time.Second
+	}
+	configs, err := OIDCProvidersFromEnv()
+	if err != nil {
+		log.Printf("ignoring oidc providers: %v", err)
+	}
+	for _, config := range configs {
+		provider := newOIDCProvider(config, retry)
+		h.providers = append(h.providers, provider)
+		h.byName[config.Name] = provider
+	}
+
+	return h
+}
+
+// provider returns the provider a login or callback names, or the first
+// when it names none. ok is false for an unknown name, or when no provider
+// is configured.
+func (h *AuthHandler) provider(name string) (*oidcProvider, bool) {
+	if name == "" {
+		if len(h.providers) == 0 {
+			return nil, false
 		}
+		return h.providers[0], true
 	}
+	provider, ok := h.byName[strings.ToLower(name)]
+	return provider, ok
+}
+
+// OIDCConfigured reports whether OIDC settings were given, discovered or not
+func (h *AuthHandler) OIDCConfigured() bool {
+	return len(h.providers) > 0
+}
+
+// Health reports whether the OIDC providers could be discovered, as the
+// worst of them. A provider is pending until a login first needs it, and
+// unreachable while discovery keeps failing.
+func (h *AuthHandler) Health() services.ProviderHealth {
+	health := services.ProviderHealth{Healthy: true, State: "pending"}
+	for i, provider := range h.providers {
+		if i == 0 {
+			health = *provider.health.Load()
+			continue
+		}
+		health = worseOIDCHealth(health, *provider.health.Load())
+	}
+	return health
+}
+
+// Providers lists the OIDC providers staff can sign in with and the URL
+// that starts a login with each
+func (h *AuthHandler) Providers(c *gin.Context) {
+	providers := make([]gin.H, 0, len(h.providers))
+	for _, provider := range h.providers {
+		providers = append(providers, gin.H{
+			"name":      provider.config.Name,
+			"login_url": "/auth/login?provider=" + provider.config.Name,
+			"status":    provider.health.Load().State,
+		})
+	}
+	respond.OK(c, http.StatusOK, providers)
+}
+
+// WithIdentities maps each provider account to a local user, linking it by
+// email on its first login. Without it the provider's email is used as is.
+func (h *AuthHandler) WithIdentities(identities *services.IdentityStore) *AuthHandler {
+	h.identities = identities
+	return h
+}
+
+// WithSessions records every issued token as a session that can be listed
+// and revoked, and audits successful logins
+func (h *AuthHandler) WithSessions(sessions *services.SessionStore, audit services.AuditRecorder) *AuthHandler {
+	h.sessions = sessions
+	h.audit = audit
+	return h
+}
+
+// WithTokens issues and accepts tokens as cfg sets
+func (h *AuthHandler) WithTokens(cfg middleware.TokenConfig) *AuthHandler {
+	h.tokens = cfg.WithDefaults()
+	return h
+}
 
+// WithoutPasswordLogin refuses password logins. The password login checks
+// no credentials, so it must be off wherever a token's email grants
+// anything, such as once admins are configured; staff then sign in with
+// OIDC only.
+func (h *AuthHandler) WithoutPasswordLogin() *AuthHandler {
+	h.noPasswords = true
 	return h
 }
 
+// WithCookies also sets the token as an HttpOnly cookie on login, with a
+// CSRF token, for browser clients that should not keep it in storage
+func (h *AuthHandler) WithCookies(cfg middleware.CookieConfig) *AuthHandler {
+	h.cookies = cfg
+	return h
+}
+
+// Login redirects to the OIDC provider named by ?provider=, or the first
+// configured. Without ?provider= it falls back to a password login while
+// OIDC is not configured or its provider cannot be reached, unless password
+// logins are switched off.
 func (h *AuthHandler) Login(c *gin.Context) {
-	if h.oidcEnabled {
+	name := c.Query("provider")
+	provider, ok := h.provider(name)
+	if name != "" && !ok {
+		c.Set(middleware.LoginMethodKey, models.LoginMethodOIDC)
+		respond.Error(c, http.StatusBadRequest, "unknown_provider", fmt.Sprintf("unknown identity provider %q", name))
+		return
+	}
+	if ok && provider.ready(c.Request.Context()) {
+		c.Set(middleware.LoginMethodKey, models.LoginMethodOIDC)
 		state := "state-" + time.Now().Format("20060102150405")
-		authURL := h.oauth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline)
+		authURL := provider.oauth2Config.AuthCodeURL(state, oauth2.AccessTypeOffline)
 		c.Redirect(http.StatusFound, authURL)
 		return
 	}
+	if name != "" {
+		// a provider asked for by name does not fall back to passwords
+		c.Set(middleware.LoginMethodKey, models.LoginMethodOIDC)
+		respond.Error(c, http.StatusServiceUnavailable, "oidc_unavailable", "OIDC provider is unreachable, try again later")
+		return
+	}
+	c.Set(middleware.LoginMethodKey, models.LoginMethodPassword)
+	if h.noPasswords {
+		if ok {
+			respond.Error(c, http.StatusServiceUnavailable, "oidc_unavailable", "OIDC provider is unreachable, try again later")
+			return
+		}
+		respond.Error(c, http.StatusForbidden, "password_login_disabled", "password login is disabled, sign in with an identity provider")
+		return
+	}
 
 	var req models.LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: "invalid request",
-			Code:    http.StatusBadRequest,
-		})
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "invalid request")
 		return
 	}
 
 	if req.Email == "" || req.Password == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: "invalid request",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "invalid request")
 		return
 	}
 
 	if len(h.jwtSecret) == 0 {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "token generation failed",
-			Message: "token generation failed",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.Error(c, http.StatusInternalServerError, "token_generation_failed", "token generation failed")
 		return
 	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Email: req.Email,
-		Sub:   req.Email,
-		Name:  "Seb",
-		Iss:   "customer-order-api",
-		Aud:   "customer-order-api",
-		Exp:   expirationTime.Unix(),
-		Iat:   time.Now().Unix(),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "customer-order-api",
-			Subject:   req.Email,
-		},
+	scopes, err := models.ParseScope(req.Scope)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		return
+	}
+
+	claims := h.tokens.NewClaims(req.Email, req.Email, "Seb", time.Now())
+	claims.Scope = strings.Join(scopes, " ")
+
+	if err := h.startSession(c, claims, models.LoginMethodPassword, ""); err != nil {
+		respond.ServerError(c, err, "session_error", "failed to start session")
+		return
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString(h.jwtSecret)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "token generation failed",
-			Message: "token generation failed",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "token_generation_failed", "token generation failed")
 		return
 	}
 
 	response := models.AuthResponse{
 		AccessToken: tokenString,
-		ExpiresIn:   int64(24 * time.Hour / time.Second),
+		ExpiresIn:   int64(h.tokens.TTL / time.Second),
 		TokenType:   "Bearer",
+		Scope:       claims.Scope,
+	}
+	if !h.setCookies(c, &response, claims.ExpiresAt.Time) {
+		return
 	}
 
-	c.JSON(http.StatusOK, response)
+	respond.OK(c, http.StatusOK, response)
 }
 
+// Callback finishes an OIDC login with the provider in the path, or the
+// first configured on /auth/callback
 func (h *AuthHandler) Callback(c *gin.Context) {
-	if !h.oidcEnabled {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "oidc_not_configured",
-			Message: "OIDC provider not configured",
-			Code:    http.StatusBadRequest,
-		})
+	c.Set(middleware.LoginMethodKey, models.LoginMethodOIDC)
+	provider, ok := h.provider(c.Param("provider"))
+	if !ok {
+		if h.OIDCConfigured() {
+			respond.Error(c, http.StatusNotFound, "unknown_provider", fmt.Sprintf("unknown identity provider %q", c.Param("provider")))
+			return
+		}
+		respond.Error(c, http.StatusBadRequest, "oidc_not_configured", "OIDC provider not configured")
+		return
+	}
+	if !provider.ready(c.Request.Context()) {
+		respond.Error(c, http.StatusServiceUnavailable, "oidc_unavailable", "OIDC provider is unreachable, try again later")
 		return
 	}
 
@@ -155,110 +254,182 @@ func (h *AuthHandler) Callback(c *gin.Context) {
 	code := c.Query("code")
 	state := c.Query("state")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "missing code",
-			Message: "authorization code is required",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "missing_code", "authorization code is required")
 		return
 	}
 
-	token, err := h.oauth2Config.Exchange(ctx, code)
+	token, err := provider.oauth2Config.Exchange(ctx, code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "token_exchange_failed",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "token_exchange_failed", "failed to exchange the authorization code")
 		return
 	}
 
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok || rawIDToken == "" {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "id_token_missing",
-			Message: "no id_token in token response",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.Error(c, http.StatusInternalServerError, "id_token_missing", "no id_token in token response")
 		return
 	}
 
 	// Verify ID Token
-	idToken, err := h.Verifier.Verify(ctx, rawIDToken)
+	idToken, err := provider.verifier.Verify(ctx, rawIDToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error:   "invalid_id_token",
-			Message: err.Error(),
-			Code:    http.StatusUnauthorized,
-		})
+		respond.Error(c, http.StatusUnauthorized, "invalid_id_token", err.Error())
 		return
 	}
 
 	var oidcClaims struct {
-		Email string `json:"email"`
-		Sub   string `json:"sub"`
-		Name  string `json:"name"`
+		Email         string `json:"email"`
+		EmailVerified *bool  `json:"email_verified"`
+		Sub           string `json:"sub"`
+		Name          string `json:"name"`
+		// Azure AD leaves out email for accounts without a mailbox
+		PreferredUsername string `json:"preferred_username"`
 	}
 	if err := idToken.Claims(&oidcClaims); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "claims_parse_error",
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "claims_parse_error", "failed to read the id token claims")
 		return
 	}
+	email := oidcClaims.Email
+	if email == "" && strings.Contains(oidcClaims.PreferredUsername, "@") {
+		email = oidcClaims.PreferredUsername
+	}
+	if email == "" || (oidcClaims.EmailVerified != nil && !*oidcClaims.EmailVerified) {
+		respond.Error(c, http.StatusForbidden, "email_not_verified", "the identity provider did not return a verified email")
+		return
+	}
+
+	if h.identities != nil {
+		identity, created, err := h.identities.Resolve(c.Request.Context(), provider.config.Name, oidcClaims.Sub, email, oidcClaims.Name)
+		if err != nil {
+			respond.ServerError(c, err, "database_error", "failed to look up the user")
+			return
+		}
+		if created && h.audit != nil {
+			h.audit.Record(models.AuditEvent{
+				Type:      models.AuditIdentityLinked,
+				Actor:     identity.Email,
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				Details:   fmt.Sprintf("identity=%d provider=%s subject=%s", identity.ID, identity.Provider, identity.Subject),
+			})
+		}
+		email = identity.Email
+	}
 
-	expirationTime := time.Now().Add(24 * time.Hour)
-	claims := &Claims{
-		Email: oidcClaims.Email,
-		Sub:   oidcClaims.Sub,
-		Name:  oidcClaims.Name,
-		Iss:   "customer-order-api",
-		Aud:   "customer-order-api",
-		Exp:   expirationTime.Unix(),
-		Iat:   time.Now().Unix(),
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			Issuer:    "customer-order-api",
-			Subject:   oidcClaims.Sub,
-		},
+	claims := h.tokens.NewClaims(email, oidcClaims.Sub, oidcClaims.Name, time.Now())
+	if err := h.startSession(c, claims, models.LoginMethodOIDC, provider.config.Name); err != nil {
+		respond.ServerError(c, err, "session_error", "failed to start session")
+		return
 	}
+
 	localToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	localTokenString, err := localToken.SignedString(h.jwtSecret)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "token_generation_failed",
-			Message: "could not generate access token",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "token_generation_failed", "could not generate access token")
 		return
 	}
 
 	response := models.AuthResponse{
 		AccessToken: localTokenString,
-		ExpiresIn:   86400,
+		ExpiresIn:   int64(h.tokens.TTL / time.Second),
 		TokenType:   "Bearer",
 	}
+	if !h.setCookies(c, &response, claims.ExpiresAt.Time) {
+		return
+	}
 
 	// Return minimal response - redirect to frontend with token as fragment if neccessary/desired)
-	c.JSON(http.StatusOK, gin.H{
+	respond.OK(c, http.StatusOK, gin.H{
 		"auth":  response,
 		"state": state,
 	})
 }
 
-func (h *AuthHandler) UserInfo(c *gin.Context) {
-	claimsI, exists := c.Get("claims")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error:   "unauthorized",
-			Message: "no user info available",
-			Code:    http.StatusUnauthorized,
+// startSession records the login as a session and stamps its id on the
+// token as the jti claim. Without a session store tokens carry no jti and
+// cannot be revoked.
+func (h *AuthHandler) startSession(c *gin.Context, claims *models.Claims, method, provider string) error {
+	if h.sessions == nil {
+		return nil
+	}
+
+	session := models.Session{
+		UserEmail: claims.Email,
+		Subject:   claims.Sub,
+		Method:    method,
+		Provider:  provider,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		ExpiresAt: claims.ExpiresAt.Time,
+	}
+	if err := h.sessions.Create(c.Request.Context(), &session); err != nil {
+		return err
+	}
+	claims.ID = session.ID
+
+	if h.audit != nil {
+		details := fmt.Sprintf("method=%s session=%s", method, session.ID)
+		if provider != "" {
+			details += " provider=" + provider
+		}
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditLoginSucceeded,
+			Actor:     claims.Email,
+			IP:        session.IP,
+			UserAgent: session.UserAgent,
+			Details:   details,
 		})
+	}
+	return nil
+}
+
+// setCookies sets the session cookies when they are enabled, adding the
+// CSRF token to the response
+func (h *AuthHandler) setCookies(c *gin.Context, response *models.AuthResponse, expires time.Time) bool {
+	if !h.cookies.Enabled {
+		return true
+	}
+	csrfToken, err := middleware.SetSessionCookies(c, h.cookies, response.AccessToken, expires)
+	if err != nil {
+		respond.ServerError(c, err, "token_generation_failed", "token generation failed")
+		return false
+	}
+	response.CSRFToken = csrfToken
+	return true
+}
+
+// Logout ends the session making the request and clears the session
+// cookies
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if id := middleware.CurrentSessionID(c); id != "" && h.sessions != nil {
+		email := middleware.CurrentUserEmail(c)
+		err := h.sessions.Revoke(c.Request.Context(), email, id)
+		if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+			respond.ServerError(c, err, "database_error", "failed to end session")
+			return
+		}
+		if h.audit != nil {
+			h.audit.Record(models.AuditEvent{
+				Type:      models.AuditSessionRevoked,
+				Actor:     email,
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				Details:   "session=" + id + " logout",
+			})
+		}
+	}
+	middleware.ClearSessionCookies(c, h.cookies)
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "logged out"})
+}
+
+func (h *AuthHandler) UserInfo(c *gin.Context) {
+	userClaims, ok := middleware.CurrentUser(c)
+	if !ok {
+		respond.Error(c, http.StatusUnauthorized, "unauthorized", "no user info available")
 		return
 	}
-	userClaims := claimsI.(*models.Claims)
-	c.JSON(http.StatusOK, gin.H{
+	respond.OK(c, http.StatusOK, gin.H{
 		"sub":   userClaims.Sub,
 		"email": userClaims.Email,
 		"name":  userClaims.Name,
@@ -268,13 +439,8 @@ func (h *AuthHandler) UserInfo(c *gin.Context) {
 	})
 }
 
-func (h *AuthHandler) ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return h.jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
-		return nil, err
-	}
-	return claims, nil
+// ValidateToken returns the claims of a token the handler issued; see
+// middleware.ParseToken for what is checked
+func (h *AuthHandler) ValidateToken(tokenString string) (*models.Claims, error) {
+	return middleware.ParseToken(tokenString, h.jwtSecret, h.tokens)
 }
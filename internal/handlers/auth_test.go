@@ -0,0 +1,642 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserInfo(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewAuthHandler()
+
+	tests := []struct {
+		name           string
+		claims         interface{}
+		expectedStatus int
+		expectedEmail  string
+	}{
+		{name: "authenticated", claims: &models.Claims{Email: "seb@example.com", Sub: "seb"}, expectedStatus: http.StatusOK, expectedEmail: "seb@example.com"},
+		{name: "unauthenticated", expectedStatus: http.StatusUnauthorized},
+		{name: "claims of another type", claims: map[string]string{"email": "seb@example.com"}, expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/auth/userinfo", nil)
+			if claims, ok := tt.claims.(*models.Claims); ok {
+				middleware.SetCurrentUser(c, claims)
+			} else if tt.claims != nil {
+				c.Set("claims", tt.claims)
+			}
+
+			handler.UserInfo(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedEmail != "" {
+				var info map[string]interface{}
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &info})
+				assert.Equal(t, tt.expectedEmail, info["email"])
+			}
+		})
+	}
+}
+
+func TestLoginTokenExpires(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	handler := NewAuthHandler()
+
+	body, _ := json.Marshal(models.LoginRequest{Email: "seb@example.com", Password: "password"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.Login(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var auth models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &auth})
+
+	claims, err := handler.ValidateToken(auth.AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "seb@example.com", claims.Email)
+		assert.NotNil(t, claims.ExpiresAt, "the exp claim is checked on validation")
+	}
+
+	// a token for another audience is not accepted
+	other := NewAuthHandler().WithTokens(middleware.TokenConfig{TTL: 15 * time.Minute, Audience: "dashboard"})
+	_, err = other.ValidateToken(auth.AccessToken)
+	assert.ErrorIs(t, err, middleware.ErrTokenAudience)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	other.Login(c)
+
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &auth})
+	assert.Equal(t, int64(900), auth.ExpiresIn)
+	claims, err = other.ValidateToken(auth.AccessToken)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "dashboard", claims.Aud)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), claims.ExpiresAt.Time, time.Minute)
+	}
+}
+
+func TestLoginSetsSessionCookies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	db := testutil.DB(t)
+	sessions := services.NewSessionStore(db)
+	handler := NewAuthHandler().WithSessions(sessions, nil).WithCookies(middleware.CookieConfig{Enabled: true, SameSite: http.SameSiteLaxMode})
+
+	body, _ := json.Marshal(models.LoginRequest{Email: "seb@example.com", Password: "password"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.Login(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var auth models.AuthResponse
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &auth})
+
+	cookies := map[string]string{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	assert.Equal(t, auth.AccessToken, cookies[middleware.SessionCookie])
+	assert.NotEmpty(t, auth.CSRFToken)
+	assert.Equal(t, auth.CSRFToken, cookies[middleware.CSRFCookie])
+
+	claims, err := handler.ValidateToken(auth.AccessToken)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/auth/logout", nil)
+	middleware.SetCurrentUser(c, claims)
+	middleware.ActiveSession(sessions)(c)
+
+	handler.Logout(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	for _, cookie := range w.Result().Cookies() {
+		assert.Empty(t, cookie.Value, "cookie %s is cleared", cookie.Name)
+		assert.Negative(t, cookie.MaxAge)
+	}
+	assert.ErrorIs(t, sessions.Validate(c.Request.Context(), claims.ID), services.ErrSessionRevoked)
+}
+
+func TestOIDCDiscoveryIsLazyAndCached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var discoveries atomic.Int32
+	var issuer string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discoveries.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	t.Setenv("OIDC_PROVIDER_URL", issuer)
+	t.Setenv("OIDC_CLIENT_ID", "savannah")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_REDIRECT_URI", "https://api.example.com/auth/callback")
+
+	login := func(handler *AuthHandler) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/auth/login", nil)
+		handler.Login(c)
+		return w
+	}
+
+	handler := NewAuthHandler()
+	assert.Zero(t, discoveries.Load(), "nothing is discovered until a login needs it")
+
+	w := login(handler)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), issuer+"/authorize")
+	assert.Equal(t, int32(1), discoveries.Load())
+
+	login(handler)
+	w = login(NewAuthHandler())
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, int32(1), discoveries.Load(), "the discovery is reused by later logins and handlers")
+}
+
+func TestOIDCDiscoveryRetriesAfterOutage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var discoveries atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	var issuer string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		discoveries.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	t.Setenv("OIDC_PROVIDER_URL", issuer)
+	t.Setenv("OIDC_CLIENT_ID", "savannah")
+	t.Setenv("OIDC_CLIENT_SECRET", "secret")
+	t.Setenv("OIDC_REDIRECT_URI", "https://api.example.com/auth/callback")
+	t.Setenv("OIDC_DISCOVERY_RETRY", "1m")
+
+	handler := NewAuthHandler()
+	login := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/auth/callback?code=abc", nil)
+		handler.Callback(c)
+		return w
+	}
+	assert.Equal(t, "pending", handler.Health().State)
+
+	w := login()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "oidc_unavailable")
+	health := handler.Health()
+	assert.False(t, health.Healthy)
+	assert.Equal(t, "unreachable", health.State)
+	assert.Equal(t, 1, health.ConsecutiveFailures)
+	assert.NotNil(t, health.LastFailureAt)
+
+	down.Store(false)
+	login()
+	assert.Equal(t, int32(1), discoveries.Load(), "no retry before the delay")
+
+	// the retry delay has passed
+	p := handler.providers[0]
+	p.mu.Lock()
+	p.nextAttempt = time.Time{}
+	p.mu.Unlock()
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/auth/login", nil)
+	handler.Login(c)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, int32(2), discoveries.Load())
+	assert.Equal(t, services.ProviderHealth{Healthy: true, State: "ready"}, handler.Health())
+}
+
+func newDiscoveryServer(t *testing.T) *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                server.URL,
+			"authorization_endpoint":                server.URL + "/authorize",
+			"token_endpoint":                        server.URL + "/token",
+			"jwks_uri":                              server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCProvidersFromEnv(t *testing.T) {
+	for _, key := range []string{"OIDC_PROVIDER_URL", "OIDC_CLIENT_ID", "OIDC_CLIENT_SECRET", "OIDC_REDIRECT_URI"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("PUBLIC_BASE_URL", "https://api.example.com/")
+	t.Setenv("OIDC_PROVIDERS", "Google, microsoft,okta,google,bad name")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "google-secret")
+	t.Setenv("OIDC_MICROSOFT_ISSUER", "https://login.microsoftonline.com/tenant/v2.0")
+	t.Setenv("OIDC_MICROSOFT_CLIENT_ID", "microsoft-client")
+	t.Setenv("OIDC_MICROSOFT_CLIENT_SECRET", "microsoft-secret")
+	t.Setenv("OIDC_MICROSOFT_REDIRECT_URI", "https://staff.example.com/auth/callback/microsoft")
+	t.Setenv("OIDC_OKTA_ISSUER", "https://example.okta.com")
+
+	providers, err := OIDCProvidersFromEnv()
+	assert.Equal(t, []OIDCProviderConfig{
+		{Name: "google", Issuer: "https://accounts.google.com", ClientID: "google-client", ClientSecret: "google-secret", RedirectURI: "https://api.example.com/auth/callback/google"},
+		{Name: "microsoft", Issuer: "https://login.microsoftonline.com/tenant/v2.0", ClientID: "microsoft-client", ClientSecret: "microsoft-secret", RedirectURI: "https://staff.example.com/auth/callback/microsoft"},
+	}, providers)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "oidc provider okta is missing OIDC_OKTA_CLIENT_ID, OIDC_OKTA_CLIENT_SECRET")
+		assert.Contains(t, err.Error(), "oidc provider google is configured twice")
+		assert.Contains(t, err.Error(), `invalid oidc provider name "bad name"`)
+	}
+}
+
+func TestOIDCMultipleProviders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	google := newDiscoveryServer(t)
+	microsoft := newDiscoveryServer(t)
+	for _, key := range []string{"OIDC_PROVIDER_URL", "OIDC_CLIENT_ID", "OIDC_CLIENT_SECRET", "OIDC_REDIRECT_URI"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("PUBLIC_BASE_URL", "https://api.example.com")
+	t.Setenv("OIDC_PROVIDERS", "google,microsoft")
+	t.Setenv("OIDC_GOOGLE_ISSUER", google.URL)
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("OIDC_GOOGLE_CLIENT_SECRET", "google-secret")
+	t.Setenv("OIDC_MICROSOFT_ISSUER", microsoft.URL)
+	t.Setenv("OIDC_MICROSOFT_CLIENT_ID", "microsoft-client")
+	t.Setenv("OIDC_MICROSOFT_CLIENT_SECRET", "microsoft-secret")
+
+	handler := NewAuthHandler()
+	router := gin.New()
+	router.GET("/auth/login", handler.Login)
+	router.GET("/auth/providers", handler.Providers)
+	router.GET("/auth/callback/:provider", handler.Callback)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/auth/login")
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.True(t, strings.HasPrefix(w.Header().Get("Location"), google.URL+"/authorize"), "the first provider is the default")
+
+	w = get("/auth/login?provider=microsoft")
+	assert.Equal(t, http.StatusFound, w.Code)
+	location, _ := url.Parse(w.Header().Get("Location"))
+	assert.Equal(t, microsoft.URL+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	assert.Equal(t, "microsoft-client", location.Query().Get("client_id"))
+	assert.Equal(t, "https://api.example.com/auth/callback/microsoft", location.Query().Get("redirect_uri"))
+
+	w = get("/auth/login?provider=okta")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown_provider")
+
+	w = get("/auth/callback/okta?code=abc")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "unknown_provider")
+
+	var providers []map[string]string
+	w = get("/auth/providers")
+	assert.Equal(t, http.StatusOK, w.Code)
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &providers})
+	assert.Equal(t, []map[string]string{
+		{"name": "google", "login_url": "/auth/login?provider=google", "status": "ready"},
+		{"name": "microsoft", "login_url": "/auth/login?provider=microsoft", "status": "ready"},
+	}, providers)
+}
+
+func TestOIDCRetryDelay(t *testing.T) {
+	provider := &oidcProvider{retry: 10 * time.Second}
+	for failures, expected := range map[int]time.Duration{
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		3:  40 * time.Second,
+		5:  160 * time.Second,
+		6:  5 * time.Minute,
+		20: 5 * time.Minute,
+	} {
+		provider.failures = failures
+		assert.Equal(t, expected, provider.retryDelay(), "after %d failures", failures)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		requestBody    models.LoginRequest
+		oidcEnabled    bool
+		jwtSecret      string
+		expectedStatus int
+		expectedError  string
+		checkRedirect  bool
+	}{
+		{
+			name: "valid non-OIDC login",
+			requestBody: models.LoginRequest{
+				Email:    "test@example.com",
+				Password: "password123",
+			},
+			oidcEnabled:    false,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusOK,
+			expectedError:  "",
+		},
+		{
+			name: "OIDC redirect",
+			requestBody: models.LoginRequest{
+				Email:    "test@example.com",
+				Password: "password123",
+			},
+			oidcEnabled:    true,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusFound,
+			checkRedirect:  true,
+		},
+		{
+			name: "invalid request body",
+			requestBody: models.LoginRequest{
+				Email:    "",
+				Password: "password123",
+			},
+			oidcEnabled:    false,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name: "missing password",
+			requestBody: models.LoginRequest{
+				Email:    "test@example.com",
+				Password: "",
+			},
+			oidcEnabled:    false,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name: "token generation failure",
+			requestBody: models.LoginRequest{
+				Email:    "test@example.com",
+				Password: "password123",
+			},
+			oidcEnabled:    false,
+			jwtSecret:      "",
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "token_generation_failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Unsetenv("JWT_SECRET")
+			os.Unsetenv("OIDC_PROVIDER_URL")
+			os.Unsetenv("OIDC_CLIENT_ID")
+			os.Unsetenv("OIDC_CLIENT_SECRET")
+			os.Unsetenv("OIDC_REDIRECT_URI")
+
+			if tt.jwtSecret != "" {
+				os.Setenv("JWT_SECRET", tt.jwtSecret)
+			}
+			defer os.Unsetenv("JWT_SECRET")
+
+			var handler *AuthHandler
+
+			if tt.oidcEnabled {
+				httpmock.Activate()
+				defer httpmock.DeactivateAndReset()
+
+				httpmock.RegisterResponder("GET", "https://example.com/.well-known/openid-configuration",
+					httpmock.NewStringResponder(http.StatusOK, `{
+						"issuer": "https://example.com",
+						"authorization_endpoint": "https://example.com/auth",
+						"token_endpoint": "https://example.com/token",
+						"userinfo_endpoint": "https://example.com/userinfo",
+						"jwks_uri": "https://example.com/jwks"
+					}`))
+
+				os.Setenv("OIDC_PROVIDER_URL", "https://example.com")
+				os.Setenv("OIDC_CLIENT_ID", "test-client")
+				os.Setenv("OIDC_CLIENT_SECRET", "test-secret")
+				os.Setenv("OIDC_REDIRECT_URI", "https://app.example.com/callback")
+
+				handler = NewAuthHandler()
+
+				defer func() {
+					os.Unsetenv("OIDC_PROVIDER_URL")
+					os.Unsetenv("OIDC_CLIENT_ID")
+					os.Unsetenv("OIDC_CLIENT_SECRET")
+					os.Unsetenv("OIDC_REDIRECT_URI")
+				}()
+			} else {
+				handler = NewAuthHandler()
+			}
+
+			w := httptest.NewRecorder()
+			_, router := gin.CreateTestContext(w)
+
+			router.POST("/login", handler.Login)
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Contains(t, errorResponse.Error.Code, tt.expectedError)
+			} else if tt.checkRedirect {
+				redirectURL := w.Header().Get("Location")
+				assert.NotEmpty(t, redirectURL, "Location header should not be empty for redirect")
+				assert.Contains(t, redirectURL, "https://example.com")
+			} else {
+				var authResponse models.AuthResponse
+				err := json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &authResponse})
+				assert.NoError(t, err)
+				assert.NotEmpty(t, authResponse.AccessToken)
+				assert.Equal(t, "Bearer", authResponse.TokenType)
+				assert.Equal(t, int64(86400), authResponse.ExpiresIn)
+
+				claims, err := handler.ValidateToken(authResponse.AccessToken)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.requestBody.Email, claims.Email)
+				assert.Equal(t, "Seb", claims.Name)
+				assert.Equal(t, "customer-order-api", claims.Iss)
+			}
+		})
+	}
+}
+
+func TestCallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		queryParams    string
+		oidcEnabled    bool
+		jwtSecret      string
+		expectedStatus int
+		expectedError  string
+		setupMocks     func()
+	}{
+		{
+			name:           "OIDC not configured",
+			queryParams:    "code=authcode123&state=state-123",
+			oidcEnabled:    false,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "oidc_not_configured",
+			setupMocks:     func() {},
+		},
+		{
+			name:           "missing code",
+			queryParams:    "state=state-123",
+			oidcEnabled:    true,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "missing_code",
+			setupMocks: func() {
+				httpmock.RegisterResponder("GET", "https://example.com/.well-known/openid-configuration",
+					httpmock.NewStringResponder(http.StatusOK, `{
+						"issuer": "https://example.com",
+						"authorization_endpoint": "https://example.com/authorize",
+						"token_endpoint": "https://example.com/token",
+						"userinfo_endpoint": "https://example.com/userinfo",
+						"jwks_uri": "https://example.com/jwks"
+					}`))
+			},
+		},
+		{
+			name:           "token exchange failure",
+			queryParams:    "code=authcode123&state=state-123",
+			oidcEnabled:    true,
+			jwtSecret:      "test-secret",
+			expectedStatus: http.StatusInternalServerError,
+			expectedError:  "token_exchange_failed",
+			setupMocks: func() {
+				httpmock.RegisterResponder("GET", "https://example.com/.well-known/openid-configuration",
+					httpmock.NewStringResponder(http.StatusOK, `{
+						"issuer": "https://example.com",
+						"authorization_endpoint": "https://example.com/authorize",
+						"token_endpoint": "https://example.com/token",
+						"userinfo_endpoint": "https://example.com/userinfo",
+						"jwks_uri": "https://example.com/jwks"
+					}`))
+				httpmock.RegisterResponder("POST", "https://example.com/token",
+					httpmock.NewStringResponder(http.StatusBadRequest, `{"error": "invalid_grant"}`))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			os.Setenv("JWT_SECRET", tt.jwtSecret)
+			defer os.Unsetenv("JWT_SECRET")
+
+			if tt.oidcEnabled {
+				os.Setenv("OIDC_PROVIDER_URL", "https://example.com")
+				os.Setenv("OIDC_CLIENT_ID", "test-client")
+				os.Setenv("OIDC_CLIENT_SECRET", "test-secret")
+				os.Setenv("OIDC_REDIRECT_URI", "https://app.example.com/callback")
+				defer func() {
+					os.Unsetenv("OIDC_PROVIDER_URL")
+					os.Unsetenv("OIDC_CLIENT_ID")
+					os.Unsetenv("OIDC_CLIENT_SECRET")
+					os.Unsetenv("OIDC_REDIRECT_URI")
+				}()
+			}
+
+			tt.setupMocks()
+
+			handler := NewAuthHandler()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			req, _ := http.NewRequest("GET", "/callback?"+tt.queryParams, nil)
+			c.Request = req
+
+			handler.Callback(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.NoError(t, err)
+				assert.Contains(t, errorResponse.Error.Code, tt.expectedError)
+			}
+		})
+	}
+}
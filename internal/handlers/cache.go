@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// purgeCache evicts the CDN's copies of responses tagged with keys once a
+// change is committed. It runs after the response so a slow or failing CDN
+// never fails the change; the cache TTL bounds how stale a missed purge
+// leaves them.
+func purgeCache(c *gin.Context, purger services.CachePurger, keys ...string) {
+	if purger == nil || len(keys) == 0 {
+		return
+	}
+
+	ctx := context.WithoutCancel(c.Request.Context())
+	go func() {
+		if err := purger.Purge(ctx, keys...); err != nil {
+			log.Printf("failed to purge cache keys %v: %v", keys, err)
+		}
+	}()
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CampaignHandler serves the SMS campaigns admins send to tagged customers
+type CampaignHandler struct {
+	campaigns *services.CampaignService
+	audit     services.AuditRecorder
+}
+
+func NewCampaignHandler(campaigns *services.CampaignService) *CampaignHandler {
+	return &CampaignHandler{campaigns: campaigns}
+}
+
+// WithAudit records campaigns created and cancelled
+func (h *CampaignHandler) WithAudit(audit services.AuditRecorder) *CampaignHandler {
+	h.audit = audit
+	return h
+}
+
+// CreateCampaign schedules a campaign. Its recipients are listed and
+// texted by the campaign job from send_at, outside the quiet hours.
+func (h *CampaignHandler) CreateCampaign(c *gin.Context) {
+	var req models.CreateCampaignRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	campaign := models.Campaign{
+		Name:      strings.TrimSpace(req.Name),
+		Message:   strings.TrimSpace(req.Message),
+		Tags:      req.Tags,
+		CreatedBy: middleware.CurrentUserEmail(c),
+	}
+	if req.SendAt != nil {
+		campaign.SendAt = *req.SendAt
+	}
+	if err := h.campaigns.Create(c.Request.Context(), &campaign); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to create campaign")
+		return
+	}
+	h.record(c, models.AuditCampaignCreated, campaign)
+
+	respond.Created(c, fmt.Sprintf("/api/v1/campaigns/%d", campaign.ID), campaign.ID, campaign.UpdatedAt, campaign)
+}
+
+// GetCampaigns lists campaigns, newest first, with their delivery stats
+func (h *CampaignHandler) GetCampaigns(c *gin.Context) {
+	campaigns, err := h.campaigns.Campaigns(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve campaigns")
+		return
+	}
+	respond.OK(c, http.StatusOK, campaigns)
+}
+
+// GetCampaign returns a campaign with its recipients counted by status
+func (h *CampaignHandler) GetCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+	campaign, err := h.campaigns.Campaign(c.Request.Context(), id)
+	if err != nil {
+		campaignError(c, err, "failed to retrieve campaign")
+		return
+	}
+	respond.OK(c, http.StatusOK, campaign)
+}
+
+// CancelCampaign stops a campaign before its remaining recipients are
+// texted. Finished campaigns are 409.
+func (h *CampaignHandler) CancelCampaign(c *gin.Context) {
+	id, ok := campaignID(c)
+	if !ok {
+		return
+	}
+	campaign, err := h.campaigns.Cancel(c.Request.Context(), id)
+	if err != nil {
+		campaignError(c, err, "failed to cancel campaign")
+		return
+	}
+	h.record(c, models.AuditCampaignCancelled, campaign)
+
+	respond.OK(c, http.StatusOK, campaign)
+}
+
+func campaignID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid campaign id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func campaignError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrCampaignNotFound):
+		respond.Error(c, http.StatusNotFound, "campaign_not_found", "campaign not found")
+	case errors.Is(err, services.ErrCampaignFinished):
+		respond.Error(c, http.StatusConflict, "campaign_finished", "campaign has already finished")
+	default:
+		respond.ServerError(c, err, "database_error", message)
+	}
+}
+
+func (h *CampaignHandler) record(c *gin.Context, eventType string, campaign models.Campaign) {
+	if h.audit == nil {
+		return
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   fmt.Sprintf("campaign=%d name=%q tags=%s", campaign.ID, campaign.Name, strings.Join(campaign.Tags, ",")),
+	})
+}
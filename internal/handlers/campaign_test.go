@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaignRoutes(t *testing.T) {
+	r := apptest.NewRouter(t, apptest.Config())
+	admin := testutil.Token(t, apptest.Admin)
+	agent := testutil.Token(t, "agent@example.com")
+	offer := map[string]interface{}{"name": "March offer", "message": "Hi {first_name}, 10% off this week", "tags": []string{"vip"}, "send_at": "2030-03-10T07:00:00Z"}
+
+	var created models.Campaign
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "only admins send campaigns",
+			Request: testutil.NewRequest("POST", "/api/v1/campaigns").WithToken(agent).WithJSON(offer),
+			Status:  http.StatusForbidden,
+			Code:    "forbidden",
+		},
+		{
+			Name:    "needs a tag",
+			Request: testutil.NewRequest("POST", "/api/v1/campaigns").WithToken(admin).WithJSON(map[string]interface{}{"name": "Everyone", "message": "hi", "tags": []string{}}),
+			Status:  http.StatusBadRequest,
+		},
+		{
+			Name:    "invalid tag",
+			Request: testutil.NewRequest("POST", "/api/v1/campaigns").WithToken(admin).WithJSON(map[string]interface{}{"name": "Everyone", "message": "hi", "tags": []string{"not a tag!"}}),
+			Status:  http.StatusBadRequest,
+		},
+		{
+			Name:    "creates",
+			Request: testutil.NewRequest("POST", "/api/v1/campaigns").WithToken(admin).WithJSON(offer),
+			Status:  http.StatusCreated,
+			Check: func(t *testing.T, w *testutil.Response) {
+				w.Data(&created)
+				assert.Equal(t, models.CampaignScheduled, created.Status)
+				assert.Equal(t, apptest.Admin, created.CreatedBy)
+				assert.Equal(t, fmt.Sprintf("/api/v1/campaigns/%d", created.ID), w.Header().Get("Location"))
+			},
+		},
+	})
+
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "gets with stats",
+			Request: testutil.NewRequest("GET", fmt.Sprintf("/api/v1/campaigns/%d", created.ID)).WithToken(admin),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var got models.Campaign
+				w.Data(&got)
+				require.NotNil(t, got.Stats)
+				assert.Equal(t, models.CampaignStats{}, *got.Stats)
+			},
+		},
+		{
+			Name:    "not found",
+			Request: testutil.NewRequest("GET", "/api/v1/campaigns/999").WithToken(admin),
+			Status:  http.StatusNotFound,
+			Code:    "campaign_not_found",
+		},
+		{
+			Name:    "cancels",
+			Request: testutil.NewRequest("POST", fmt.Sprintf("/api/v1/campaigns/%d/cancel", created.ID)).WithToken(admin),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var got models.Campaign
+				w.Data(&got)
+				assert.Equal(t, models.CampaignCancelled, got.Status)
+			},
+		},
+		{
+			Name:    "cancelled already",
+			Request: testutil.NewRequest("POST", fmt.Sprintf("/api/v1/campaigns/%d/cancel", created.ID)).WithToken(admin),
+			Status:  http.StatusConflict,
+			Code:    "campaign_finished",
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The handler tests call handlers directly; these go through the whole
+// router to check that a request aborted by middleware never reaches one.
+func TestCustomerRoutesThroughMiddleware(t *testing.T) {
+	r := apptest.NewRouter(t, apptest.Config())
+	customer := testutil.NewCustomer(t).WithName("Sebbie Chanzu").WithPhone("+254740827150").Create(r.DB)
+	testutil.NewOrder(t).For(customer).WithItem("laptop").Create(r.DB)
+
+	admin := testutil.Token(t, apptest.Admin)
+	agent := testutil.Token(t, "agent@example.com")
+	reader := testutil.ScopedToken(t, "reader@example.com", models.ScopeCustomersRead)
+	newCustomer := map[string]string{"name": "Amina Hassan", "code": "CUST900", "phone": "+254711222333", "email": "amina@example.com"}
+
+	countCustomers := func(t *testing.T) int64 {
+		var count int64
+		require.NoError(t, r.DB.Model(&models.Customer{}).Count(&count).Error)
+		return count
+	}
+
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "no token",
+			Request: testutil.NewRequest("POST", "/api/v1/customers").WithJSON(newCustomer),
+			Status:  http.StatusUnauthorized,
+			Code:    "missing_token",
+			Check: func(t *testing.T, w *testutil.Response) {
+				assert.Equal(t, int64(1), countCustomers(t))
+			},
+		},
+		{
+			Name:    "expired token",
+			Request: testutil.NewRequest("GET", "/api/v1/customers").WithToken(testutil.ExpiredToken(t, "agent@example.com")),
+			Status:  http.StatusUnauthorized,
+			Code:    "invalid_token",
+		},
+		{
+			Name:    "token signed with another secret",
+			Request: testutil.NewRequest("GET", "/api/v1/customers").WithToken(testutil.Sign(t, testutil.Claims("agent@example.com", 0), "other-secret")),
+			Status:  http.StatusUnauthorized,
+			Code:    "invalid_token",
+		},
+		{
+			Name:    "read scope can't write",
+			Request: testutil.NewRequest("POST", "/api/v1/customers").WithToken(reader).WithJSON(newCustomer),
+			Status:  http.StatusForbidden,
+			Code:    "insufficient_scope",
+			Check: func(t *testing.T, w *testutil.Response) {
+				assert.Equal(t, int64(1), countCustomers(t))
+			},
+		},
+		{
+			Name:    "read scope can read",
+			Request: testutil.NewRequest("GET", "/api/v1/customers/by-code/"+customer.Code).WithToken(reader),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var got models.Customer
+				w.Data(&got)
+				assert.Equal(t, customer.ID, got.ID)
+			},
+		},
+		{
+			Name:    "only admins anonymize",
+			Request: testutil.NewRequest("POST", fmt.Sprintf("/api/v1/customers/%d/anonymize", customer.ID)).WithToken(agent),
+			Status:  http.StatusForbidden,
+			Code:    "forbidden",
+			Check: func(t *testing.T, w *testutil.Response) {
+				var stored models.Customer
+				require.NoError(t, r.DB.First(&stored, customer.ID).Error)
+				assert.Nil(t, stored.AnonymizedAt)
+			},
+		},
+		{
+			Name:    "invalid body",
+			Request: testutil.NewRequest("POST", "/api/v1/customers").WithToken(agent).WithJSON(`{"name": `),
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+		},
+		{
+			Name:    "creates",
+			Request: testutil.NewRequest("POST", "/api/v1/customers").WithToken(admin).WithJSON(newCustomer),
+			Status:  http.StatusCreated,
+			Check: func(t *testing.T, w *testutil.Response) {
+				assert.Equal(t, int64(2), countCustomers(t))
+				assert.NotEmpty(t, w.Header().Get("X-Request-ID"))
+			},
+		},
+	})
+}
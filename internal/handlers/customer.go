@@ -2,16 +2,34 @@ package handlers
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/store"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// maxEmbeddedOrders caps the orders embedded per customer in the customer
+// list. The rest are paged through GET /customers/:id/orders.
+const maxEmbeddedOrders = 20
+
+// ordersCountColumn selects the number of a customer's orders
+const ordersCountColumn = "(SELECT COUNT(*) FROM orders WHERE orders.customer_id = customers.id AND orders.deleted_at IS NULL)"
+
+var errEmailInUse = errors.New("email already in use")
+
 type CustomerHandler struct {
-	db *gorm.DB
+	db    *gorm.DB
+	audit services.AuditRecorder
 }
 
 func NewCustomerHandler(db *gorm.DB) *CustomerHandler {
@@ -20,223 +38,308 @@ func NewCustomerHandler(db *gorm.DB) *CustomerHandler {
 
 // CreateCustomer creates new customer
 func (h *CustomerHandler) CreateCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	var req models.CreateCustomerRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
 		return
 	}
 
-	var existingCustomer models.Customer
-	if err := h.db.Where("code = ?", req.Code).First(&existingCustomer).Error; err == nil {
-		c.JSON(http.StatusConflict, models.ErrorResponse{
-			Error:   "customer_exists",
-			Message: "customer with this code already exists",
-			Code:    http.StatusConflict,
-		})
+	if !checkCustomerDates(c, req.Birthday, req.OnboardedOn) {
 		return
 	}
 
 	customer := models.Customer{
-		Name:  req.Name,
-		Code:  req.Code,
-		Phone: req.Phone,
-		Email: req.Email,
+		Name:                 req.Name,
+		Code:                 req.Code,
+		Phone:                req.Phone,
+		Email:                req.Email,
+		DeliveryInstructions: req.DeliveryInstructions,
+		Birthday:             req.Birthday,
+		OnboardedOn:          req.OnboardedOn,
 	}
 
-	if err := h.db.Create(&customer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to create customer",
-			Code:    http.StatusInternalServerError,
-		})
+	if err := db.Create(&customer).Error; err != nil {
+		if constraint, ok := uniqueViolation(err); ok {
+			respondCustomerConflict(c, constraint)
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to create customer")
 		return
 	}
 
-	c.JSON(http.StatusCreated, customer)
+	respond.Created(c, fmt.Sprintf("/api/v1/customers/%d", customer.ID), customer.ID, customer.UpdatedAt, customer)
+}
+
+// checkCustomerDates refuses a birthday or onboarding date after today
+func checkCustomerDates(c *gin.Context, birthday, onboardedOn *models.Date) bool {
+	today := models.DateOf(time.Now())
+	if birthday != nil && *birthday > today {
+		respond.Error(c, http.StatusBadRequest, "invalid_date", "birthday must not be in the future")
+		return false
+	}
+	if onboardedOn != nil && *onboardedOn > today {
+		respond.Error(c, http.StatusBadRequest, "invalid_date", "onboarded_on must not be in the future")
+		return false
+	}
+	return true
 }
 
 func (h *CustomerHandler) GetCustomers(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset := (page - 1) * limit
+	db := h.db.WithContext(c.Request.Context())
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseFilter(c, customerFilterFields)
+	if !ok {
+		return
+	}
+
+	fields, err := customerFields.parse(c)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_fields", err.Error())
+		return
+	}
+
+	include, err := parseInclude(c, "orders")
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_include", err.Error())
+		return
+	}
 
 	var customers []models.Customer
-	var total int64
 
-	h.db.Model(&models.Customer{}).Count(&total)
+	query := db.Model(&models.Customer{}).Scopes(scopes.CreatedBetween(from, to), filter.Scope)
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve customers")
+		return
+	}
+
+	if fields != nil {
+		query = query.Select(customerFields.selectColumns(fields))
+	} else {
+		query = query.Select("customers.*", ordersCountColumn+" AS orders_count")
+	}
+	// notes are only listed on request; the single customer view shows them
+	if fields != nil && wantsField(fields, "notes") {
+		query = query.Preload("Notes", preloadNotes)
+	}
 
-	if err := h.db.Preload("Orders").Offset(offset).Limit(limit).Find(&customers).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve customers",
-			Code:    http.StatusInternalServerError,
-		})
+	if err := query.Scopes(scopes.Paginate(page)).Find(&customers).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve customers")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"customers": customers,
-		"total":     total,
-		"page":      page,
-		"limit":     limit,
-	})
+	// orders can run into the thousands per customer, so they are only
+	// embedded on request and capped
+	if include["orders"] || (fields != nil && wantsField(fields, "orders")) {
+		if err := embedRecentOrders(db, customers); err != nil {
+			respond.ServerError(c, err, "database_error", "failed to retrieve customers")
+			return
+		}
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, projectFields(customers, fields), page.MetaOf(total, len(customers)))
 }
 
 func (h *CustomerHandler) GetCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	id, err := strconv.ParseInt(c.Param("id"), 10, 32)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid customer id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return
+	}
+
+	fields, err := customerFields.parse(c)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_fields", err.Error())
 		return
 	}
 
+	query := db
+	if fields != nil {
+		query = query.Select(customerFields.selectColumns(fields))
+	}
+	if wantsField(fields, "orders") {
+		query = query.Preload("Orders")
+	}
+	if wantsField(fields, "notes") {
+		query = query.Preload("Notes", preloadNotes)
+	}
+
 	var customer models.Customer
 
-	if err := h.db.Preload("Orders").First(&customer, id).Error; err != nil {
+	if err := query.First(&customer, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "customer not found",
-				Message: "customer not found",
-				Code:    http.StatusNotFound,
-			})
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve customer",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
 		return
 	}
-	c.JSON(http.StatusOK, customer)
+	respond.OK(c, http.StatusOK, projectFields(customer, fields))
 }
 
 func (h *CustomerHandler) UpdateCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid customer id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
 		return
 	}
 
 	var req models.UpdateCustomerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+	if !checkCustomerDates(c, req.Birthday.Value, req.OnboardedOn.Value) {
 		return
 	}
 
 	var customer models.Customer
-	if err := h.db.First(&customer, id).Error; err != nil {
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, id).Error; err != nil {
+			return err
+		}
+
+		if req.Name != "" {
+			customer.Name = req.Name
+		}
+		if req.Phone != "" {
+			customer.Phone = req.Phone
+		}
+		if req.DeliveryInstructions != nil {
+			customer.DeliveryInstructions = *req.DeliveryInstructions
+		}
+		if req.Birthday.Set {
+			customer.Birthday = req.Birthday.Value
+		}
+		if req.OnboardedOn.Set {
+			customer.OnboardedOn = req.OnboardedOn.Value
+		}
+		if req.Email != "" {
+			customer.Email = req.Email
+
+			// deleted customers keep their email, as the unique index does
+			_, emailHash := models.CustomerHashes(customer.Phone, customer.Email)
+			var taken int64
+			err := tx.Unscoped().Model(&models.Customer{}).
+				Where("email_hash = ? AND id <> ?", emailHash, customer.ID).
+				Count(&taken).Error
+			if err != nil {
+				return err
+			}
+			if taken > 0 {
+				return errEmailInUse
+			}
+		}
+
+		return tx.Save(&customer).Error
+	})
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "customer not found",
-				Message: "customer not found",
-				Code:    http.StatusNotFound,
-			})
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve customer",
-			Code:    http.StatusInternalServerError,
-		})
-		return
-	}
-
-	if req.Name != "" {
-		customer.Name = req.Name
-	}
-	if req.Phone != "" {
-		customer.Phone = req.Phone
-	}
-	if req.Email != "" {
-		var existingCustomer models.Customer
-		if err := h.db.Where("email = ? AND id != ?", req.Email, id).First(&existingCustomer).Error; err == nil {
-			c.JSON(http.StatusConflict, models.ErrorResponse{
-				Error:   "email already in use",
-				Message: "email already in use",
-				Code:    http.StatusConflict,
-			})
+		if errors.Is(err, errEmailInUse) {
+			respond.Error(c, http.StatusConflict, "email_already_in_use", "email already in use")
 			return
-		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-				Error:   "database error",
-				Message: "failed to check email",
-				Code:    http.StatusInternalServerError,
-			})
+		}
+		// the index still catches a customer taking the email meanwhile
+		if constraint, ok := uniqueViolation(err); ok {
+			respondCustomerConflict(c, constraint)
 			return
 		}
-		customer.Email = req.Email
-	}
-
-	if err := h.db.Save(&customer).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to update customer",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "database_error", "failed to update customer")
 		return
 	}
 
-	c.JSON(http.StatusOK, customer)
+	respond.OK(c, http.StatusOK, customer)
 }
 
 func (h *CustomerHandler) DeleteCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid customer id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
 		return
 	}
 
-	var customer models.Customer
-	if err := h.db.First(&customer, id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "customer not found",
-				Message: "customer not found",
-				Code:    http.StatusNotFound,
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve customer",
-			Code:    http.StatusInternalServerError,
-		})
+	result := db.Delete(&models.Customer{}, id)
+	if result.Error != nil {
+		respond.ServerError(c, result.Error, "database_error", "failed to delete customer")
 		return
 	}
-
-	if err := h.db.Delete(&models.Customer{}, id).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to delete customer",
-			Code:    http.StatusInternalServerError,
-		})
+	if result.RowsAffected == 0 {
+		respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "customer deleted successfully"})
+	respond.OK(c, http.StatusOK, gin.H{"message": "customer deleted successfully"})
+}
+
+// embedRecentOrders attaches up to maxEmbeddedOrders of each customer's most
+// recent orders, newest first, in one query
+func embedRecentOrders(db *gorm.DB, customers []models.Customer) error {
+	if len(customers) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(customers))
+	for i, customer := range customers {
+		ids[i] = customer.ID
+	}
+
+	ranked := db.Model(&models.Order{}).
+		Select("orders.*, ROW_NUMBER() OVER (PARTITION BY customer_id ORDER BY created_at DESC, id DESC) AS order_rank").
+		Where("customer_id IN ?", ids)
+
+	var orders []models.Order
+	if err := db.Unscoped().Table("(?) AS ranked", ranked).
+		Where("order_rank <= ?", maxEmbeddedOrders).
+		Order("customer_id, order_rank").
+		Find(&orders).Error; err != nil {
+		return err
+	}
+
+	byCustomer := make(map[uint][]models.Order, len(customers))
+	for _, order := range orders {
+		byCustomer[order.CustomerID] = append(byCustomer[order.CustomerID], order)
+	}
+	for i := range customers {
+		customers[i].Orders = byCustomer[customers[i].ID]
+	}
+	return nil
+}
+
+func preloadNotes(db *gorm.DB) *gorm.DB {
+	return db.Order(store.NotesOrder)
+}
+
+// respondCustomerConflict maps a violated customer unique index to the
+// matching 409 response. The database enforces uniqueness, so there is no
+// read-before-write window for two requests to race through.
+func respondCustomerConflict(c *gin.Context, constraint string) {
+	if strings.Contains(constraint, "email") {
+		respond.Error(c, http.StatusConflict, "email_already_in_use", "email already in use")
+		return
+	}
+	respond.Error(c, http.StatusConflict, "customer_exists", "customer with this code already exists")
 }
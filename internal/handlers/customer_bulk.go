@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxBulkCustomers caps the customers one bulk operation may change
+const maxBulkCustomers = 1000
+
+var errTooManyCustomers = fmt.Errorf("more than %d customers match, narrow the filter", maxBulkCustomers)
+
+// BulkDeleteCustomers deletes the customers selected by id or filter in one
+// transaction, or reports which it would delete on a dry run
+func (h *CustomerHandler) BulkDeleteCustomers(c *gin.Context) {
+	h.bulkCustomers(c, false)
+}
+
+// BulkRestoreCustomers brings back deleted customers selected by id or
+// filter in one transaction, or reports which it would restore on a dry run
+func (h *CustomerHandler) BulkRestoreCustomers(c *gin.Context) {
+	h.bulkCustomers(c, true)
+}
+
+func (h *CustomerHandler) bulkCustomers(c *gin.Context, restore bool) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.BulkCustomerRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "either ids or filter is required")
+		return
+	}
+	if req.Filter != nil && *req.Filter == (models.BulkCustomerFilter{}) {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "filter must have at least one criterion")
+		return
+	}
+	if req.Filter != nil && req.Filter.CreatedFrom != nil && req.Filter.CreatedTo != nil && !req.Filter.CreatedFrom.Before(*req.Filter.CreatedTo) {
+		respond.Error(c, http.StatusBadRequest, "invalid_range", "created_from must be before created_to")
+		return
+	}
+
+	result := models.BulkCustomerResult{DryRun: req.DryRun, IDs: []uint{}}
+	err := services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		query := tx.Model(&models.Customer{})
+		if restore {
+			query = tx.Unscoped().Model(&models.Customer{}).Where("deleted_at IS NOT NULL")
+		}
+		if len(req.IDs) > 0 {
+			query = query.Where("id IN ?", req.IDs)
+		} else {
+			query = query.Scopes(bulkCustomerFilter(*req.Filter))
+		}
+
+		if err := query.Order("id").Limit(maxBulkCustomers+1).Pluck("id", &result.IDs).Error; err != nil {
+			return err
+		}
+		if len(result.IDs) > maxBulkCustomers {
+			return errTooManyCustomers
+		}
+		result.Affected = len(result.IDs)
+
+		if req.DryRun || len(result.IDs) == 0 {
+			return nil
+		}
+		if restore {
+			return tx.Unscoped().Model(&models.Customer{}).Where("id IN ?", result.IDs).Update("deleted_at", nil).Error
+		}
+		return tx.Where("id IN ?", result.IDs).Delete(&models.Customer{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, errTooManyCustomers) {
+			respond.Error(c, http.StatusBadRequest, "too_many_customers", err.Error())
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to update customers")
+		return
+	}
+
+	for _, id := range req.IDs {
+		if !slices.Contains(result.IDs, id) && !slices.Contains(result.NotFound, id) {
+			result.NotFound = append(result.NotFound, id)
+		}
+	}
+
+	if !req.DryRun && result.Affected > 0 && h.audit != nil {
+		eventType := models.AuditCustomersDeleted
+		if restore {
+			eventType = models.AuditCustomersRestored
+		}
+		h.audit.Record(models.AuditEvent{
+			Type:      eventType,
+			Actor:     middleware.CurrentUserEmail(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   fmt.Sprintf("customers %s", joinIDs(result.IDs)),
+		})
+	}
+
+	respond.OK(c, http.StatusOK, result)
+}
+
+// bulkCustomerFilter matches customers on every criterion of the filter.
+// Code prefixes are matched ignoring case, like codes themselves.
+func bulkCustomerFilter(filter models.BulkCustomerFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.CodePrefix != "" {
+			db = db.Where("LOWER(code) LIKE ? "+scopes.LikeEscape, scopes.EscapeLike(strings.ToLower(filter.CodePrefix))+"%")
+		}
+		if filter.NameContains != "" {
+			db = db.Where("LOWER(name) LIKE ? "+scopes.LikeEscape, "%"+scopes.EscapeLike(strings.ToLower(filter.NameContains))+"%")
+		}
+
+		var from, to time.Time
+		if filter.CreatedFrom != nil {
+			from = *filter.CreatedFrom
+		}
+		if filter.CreatedTo != nil {
+			to = *filter.CreatedTo
+		}
+		return db.Scopes(scopes.CreatedBetween(from, to))
+	}
+}
+
+func joinIDs(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ",")
+}
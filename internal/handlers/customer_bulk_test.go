@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkCustomers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name              string
+		restore           bool
+		body              interface{}
+		expectedStatus    int
+		expectedError     string
+		expectedIDs       []uint
+		expectedNotFound  []uint
+		expectedRemaining int64
+	}{
+		{
+			name:              "delete by ids",
+			body:              models.BulkCustomerRequest{IDs: []uint{1, 2, 99}},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{1, 2},
+			expectedNotFound:  []uint{99},
+			expectedRemaining: 2,
+		},
+		{
+			name:              "delete by code prefix ignoring case",
+			body:              models.BulkCustomerRequest{Filter: &models.BulkCustomerFilter{CodePrefix: "test"}},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{1, 2, 3},
+			expectedRemaining: 1,
+		},
+		{
+			name:              "dry run changes nothing",
+			body:              models.BulkCustomerRequest{Filter: &models.BulkCustomerFilter{CodePrefix: "TEST"}, DryRun: true},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{1, 2, 3},
+			expectedRemaining: 4,
+		},
+		{
+			name:              "like wildcards are literal",
+			body:              models.BulkCustomerRequest{Filter: &models.BulkCustomerFilter{NameContains: "%"}},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{},
+			expectedRemaining: 4,
+		},
+		{
+			name:              "restore by filter",
+			restore:           true,
+			body:              models.BulkCustomerRequest{Filter: &models.BulkCustomerFilter{NameContains: "test"}},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{5},
+			expectedRemaining: 5,
+		},
+		{
+			name:              "restore by ids skips customers that are not deleted",
+			restore:           true,
+			body:              models.BulkCustomerRequest{IDs: []uint{1, 5}},
+			expectedStatus:    http.StatusOK,
+			expectedIDs:       []uint{5},
+			expectedNotFound:  []uint{1},
+			expectedRemaining: 5,
+		},
+		{
+			name:           "ids and filter",
+			body:           models.BulkCustomerRequest{IDs: []uint{1}, Filter: &models.BulkCustomerFilter{CodePrefix: "TEST"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "neither ids nor filter",
+			body:           models.BulkCustomerRequest{DryRun: true},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "empty filter",
+			body:           map[string]interface{}{"filter": map[string]interface{}{}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "invalid id",
+			body:           map[string]interface{}{"ids": []int{0}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			handler := NewCustomerHandler(db)
+
+			for _, customer := range []models.Customer{
+				{Name: "Test One", Code: "TEST001", Phone: "+254711000001", Email: "one@example.com"},
+				{Name: "Test Two", Code: "TEST002", Phone: "+254711000002", Email: "two@example.com"},
+				{Name: "Test Three", Code: "test003", Phone: "+254711000003", Email: "three@example.com"},
+				{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+				{Name: "Test Four", Code: "TEST004", Phone: "+254711000004", Email: "four@example.com"},
+			} {
+				db.Create(&customer)
+			}
+			db.Delete(&models.Customer{}, 5)
+
+			jsonBody, _ := json.Marshal(tt.body)
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/admin/customers/bulk-delete", bytes.NewBuffer(jsonBody))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			if tt.restore {
+				handler.BulkRestoreCustomers(c)
+			} else {
+				handler.BulkDeleteCustomers(c)
+			}
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var result models.BulkCustomerResult
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &result})
+			assert.Equal(t, tt.expectedIDs, result.IDs)
+			assert.Equal(t, len(tt.expectedIDs), result.Affected)
+			assert.Equal(t, tt.expectedNotFound, result.NotFound)
+
+			var remaining int64
+			db.Model(&models.Customer{}).Count(&remaining)
+			assert.Equal(t, tt.expectedRemaining, remaining)
+		})
+	}
+}
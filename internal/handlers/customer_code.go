@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errCodeInUse = errors.New("code was used by another customer")
+	errSameCode  = errors.New("customer already has this code")
+)
+
+// ChangeCustomerCode gives a customer a new code, keeping the old one in
+// code_history so it still resolves. A customer may take back one of their
+// own old codes, but not one another customer used. Codes are compared
+// ignoring case, so changing only the case keeps no history.
+func (h *CustomerHandler) ChangeCustomerCode(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return
+	}
+
+	var req models.ChangeCustomerCodeRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+	code := req.Code
+
+	var customer models.Customer
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, id).Error; err != nil {
+			return err
+		}
+		if customer.Code == code {
+			return errSameCode
+		}
+
+		if strings.EqualFold(customer.Code, code) {
+			// only the case changes, so the old spelling is not an old code
+			return tx.Model(&customer).Update("code", code).Error
+		}
+
+		var previous models.CustomerCodeChange
+		err := tx.Where("LOWER(old_code) = ?", strings.ToLower(code)).First(&previous).Error
+		switch {
+		case err == nil && previous.CustomerID != customer.ID:
+			return errCodeInUse
+		case err == nil:
+			// taking back an old code; it is current again, not history
+			if err := tx.Delete(&previous).Error; err != nil {
+				return err
+			}
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		change := models.CustomerCodeChange{
+			CustomerID: customer.ID,
+			OldCode:    customer.Code,
+			NewCode:    code,
+			ChangedBy:  middleware.CurrentUserEmail(c),
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return err
+		}
+		return tx.Model(&customer).Update("code", code).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return
+		}
+		if errors.Is(err, errSameCode) {
+			respond.Error(c, http.StatusBadRequest, "invalid_request", "customer already has this code")
+			return
+		}
+		if errors.Is(err, errCodeInUse) {
+			respond.Error(c, http.StatusConflict, "code_in_use", "code was previously used by another customer")
+			return
+		}
+		if constraint, ok := uniqueViolation(err); ok {
+			respondCustomerConflict(c, constraint)
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to change customer code")
+		return
+	}
+
+	h.record(c, models.AuditCustomerCodeChanged, customer.ID)
+
+	respond.OK(c, http.StatusOK, customer)
+}
+
+// GetCustomerByCode finds a customer by their current code or, failing
+// that, a code they used to have, ignoring case. Old codes are reported in
+// meta as resolved_from.
+func (h *CustomerHandler) GetCustomerByCode(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+	code := c.Param("code")
+
+	var customer models.Customer
+	err := db.Where("LOWER(code) = ?", strings.ToLower(code)).First(&customer).Error
+	if err == nil {
+		respond.OK(c, http.StatusOK, customer)
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return
+	}
+
+	var previous models.CustomerCodeChange
+	err = db.Where("LOWER(old_code) = ?", strings.ToLower(code)).First(&previous).Error
+	if err == nil {
+		err = db.First(&customer, previous.CustomerID).Error
+	}
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, customer, gin.H{"resolved_from": code})
+}
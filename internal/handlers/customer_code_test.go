@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangeCustomerCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	db.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+	db.Create(&models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"})
+
+	// the cases run in order against the same customers
+	tests := []struct {
+		name           string
+		customerID     string
+		code           string
+		expectedStatus int
+		expectedError  string
+		expectedCode   string
+		expectedOld    []string
+	}{
+		{
+			name:           "change code",
+			customerID:     "1",
+			code:           "WHOLESALE01",
+			expectedStatus: http.StatusOK,
+			expectedCode:   "WHOLESALE01",
+			expectedOld:    []string{"CUST001"},
+		},
+		{
+			name:           "another customer's old code",
+			customerID:     "2",
+			code:           "CUST001",
+			expectedStatus: http.StatusConflict,
+			expectedError:  "code_in_use",
+		},
+		{
+			name:           "another customer's old code in another case",
+			customerID:     "2",
+			code:           " cust001 ",
+			expectedStatus: http.StatusConflict,
+			expectedError:  "code_in_use",
+		},
+		{
+			name:           "another customer's current code in another case",
+			customerID:     "2",
+			code:           "wholesale01",
+			expectedStatus: http.StatusConflict,
+			expectedError:  "customer_exists",
+		},
+		{
+			name:           "another customer's current code",
+			customerID:     "2",
+			code:           "WHOLESALE01",
+			expectedStatus: http.StatusConflict,
+			expectedError:  "customer_exists",
+		},
+		{
+			name:           "same code",
+			customerID:     "1",
+			code:           "WHOLESALE01",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "take back own old code",
+			customerID:     "1",
+			code:           "CUST001",
+			expectedStatus: http.StatusOK,
+			expectedCode:   "CUST001",
+			expectedOld:    []string{"WHOLESALE01"},
+		},
+		{
+			name:           "change case only",
+			customerID:     "1",
+			code:           "Cust001",
+			expectedStatus: http.StatusOK,
+			expectedCode:   "Cust001",
+			expectedOld:    []string{"WHOLESALE01"},
+		},
+		{
+			name:           "blank code",
+			customerID:     "1",
+			code:           "   ",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "non-existent customer",
+			customerID:     "999",
+			code:           "NEW999",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+		},
+		{
+			name:           "invalid customer ID",
+			customerID:     "abc",
+			code:           "NEW999",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(models.ChangeCustomerCodeRequest{Code: tt.code})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/customers/"+tt.customerID+"/change-code", bytes.NewBuffer(jsonBody))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}}
+			middleware.SetCurrentUser(c, &models.Claims{Email: "manager@example.com"})
+
+			handler.ChangeCustomerCode(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var customer models.Customer
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customer})
+			assert.Equal(t, tt.expectedCode, customer.Code)
+
+			var history []models.CustomerCodeChange
+			db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&history)
+			var old []string
+			for _, change := range history {
+				old = append(old, change.OldCode)
+				assert.Equal(t, "manager@example.com", change.ChangedBy)
+			}
+			assert.Equal(t, tt.expectedOld, old)
+		})
+	}
+}
+
+func TestGetCustomerByCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "WHOLESALE01", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	db.Create(&models.CustomerCodeChange{CustomerID: customer.ID, OldCode: "CUST001", NewCode: "WHOLESALE01"})
+
+	tests := []struct {
+		name             string
+		code             string
+		expectedStatus   int
+		expectedError    string
+		expectedResolved string
+	}{
+		{name: "current code", code: "WHOLESALE01", expectedStatus: http.StatusOK},
+		{name: "old code", code: "CUST001", expectedStatus: http.StatusOK, expectedResolved: "CUST001"},
+		{name: "current code in another case", code: "wholesale01", expectedStatus: http.StatusOK},
+		{name: "old code in another case", code: "cust001", expectedStatus: http.StatusOK, expectedResolved: "cust001"},
+		{name: "unknown code", code: "CUST404", expectedStatus: http.StatusNotFound, expectedError: "customer_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/customers/by-code/"+tt.code, nil)
+			c.Params = []gin.Param{{Key: "code", Value: tt.code}}
+
+			handler.GetCustomerByCode(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var found models.Customer
+			var meta map[string]string
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &found, Meta: &meta})
+			assert.Equal(t, customer.ID, found.ID)
+			assert.Equal(t, "WHOLESALE01", found.Code)
+			assert.Equal(t, tt.expectedResolved, meta["resolved_from"])
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDuplicates lists clusters of customers that are likely the same person,
+// most confident first, with the customer a merge should keep. Matches below
+// ?min_confidence= (default 0.5) are left out.
+func (h *CustomerHandler) GetDuplicates(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	minConfidence := services.DefaultDuplicateConfidence
+	if value := c.Query("min_confidence"); value != "" {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f <= 0 || f > 1 {
+			respond.Error(c, http.StatusBadRequest, "invalid_confidence", "min_confidence must be a number above 0 and at most 1")
+			return
+		}
+		minConfidence = f
+	}
+
+	clusters, err := services.NewDuplicateFinder(h.db).Find(c.Request.Context(), minConfidence)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to find duplicate customers")
+		return
+	}
+
+	start := min((page.Page-1)*page.Limit, len(clusters))
+	end := min(start+page.Limit, len(clusters))
+	respond.OKWithMeta(c, http.StatusOK, clusters[start:end], page.Meta(int64(len(clusters))))
+}
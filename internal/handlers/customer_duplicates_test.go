@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	r := gin.New()
+	r.GET("/admin/customers/duplicates", handler.GetDuplicates)
+
+	anonymized := time.Now()
+	for _, customer := range []*models.Customer{
+		{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbie.chanzu@gmail.com"},
+		{Name: "Sebbie Chanzu", Code: "CUST002", Phone: "0740 827 150", Email: "sebbiechanzu+shop@googlemail.com"},
+		{Name: "Sebie Chanzu", Code: "CUST003", Phone: "0711000001", Email: "other@example.com"},
+		{Name: "Amina Hassan", Code: "CUST004", Phone: "0722000002", Email: "amina@example.com"},
+		{Name: "A. Hassan", Code: "CUST005", Phone: "254722000002", Email: "hassan@example.com"},
+		{Name: "Amina Hassan", Code: "CUST006", Phone: "0722000002", AnonymizedAt: &anonymized},
+	} {
+		require.NoError(t, db.Create(customer).Error)
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: 2}).Error)
+	}
+
+	get := func(path string) (int, []models.DuplicateCluster) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(w, req)
+		var clusters []models.DuplicateCluster
+		json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &clusters})
+		return w.Code, clusters
+	}
+
+	status, clusters := get("/admin/customers/duplicates")
+	assert.Equal(t, http.StatusOK, status)
+	require.Len(t, clusters, 2)
+
+	assert.Equal(t, []uint{1, 2}, clusters[0].CustomerIDs)
+	assert.Equal(t, uint(2), clusters[0].KeepID, "the customer with orders is kept")
+	assert.InDelta(t, 0.99, clusters[0].Confidence, 0.01)
+	require.Len(t, clusters[0].Matches, 1)
+	assert.Equal(t, []string{models.DuplicateByPhone, models.DuplicateByEmail, models.DuplicateByName}, clusters[0].Matches[0].Reasons)
+	assert.Equal(t, float64(1), clusters[0].Matches[0].NameSimilarity)
+	if assert.NotNil(t, clusters[0].Customers[1].OrdersCount) {
+		assert.Equal(t, int64(2), *clusters[0].Customers[1].OrdersCount)
+	}
+
+	// the anonymized customer is left out
+	assert.Equal(t, []uint{4, 5}, clusters[1].CustomerIDs)
+	assert.Equal(t, uint(4), clusters[1].KeepID, "the oldest customer is kept")
+	assert.Equal(t, 0.9, clusters[1].Confidence)
+	assert.Equal(t, []string{models.DuplicateByPhone}, clusters[1].Matches[0].Reasons)
+
+	// a similar name alone is weak evidence
+	_, clusters = get("/admin/customers/duplicates?min_confidence=0.3")
+	require.Len(t, clusters, 2)
+	assert.Equal(t, []uint{1, 2, 3}, clusters[1].CustomerIDs)
+	assert.Equal(t, 0.4, clusters[1].Confidence)
+	assert.Len(t, clusters[1].Matches, 3)
+
+	_, clusters = get("/admin/customers/duplicates?min_confidence=0.95")
+	assert.Len(t, clusters, 1)
+
+	status, _ = get("/admin/customers/duplicates?min_confidence=2")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetCustomerOrders lists the orders of the customer in the path, with the
+// same pagination and filters as GetOrders
+func (h *OrderHandler) GetCustomerOrders(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	customerID, ok := h.pathCustomerID(c, db)
+	if !ok {
+		return
+	}
+
+	h.listOrders(c, db, customerID)
+}
+
+// CreateCustomerOrder places an order for the customer in the path
+func (h *OrderHandler) CreateCustomerOrder(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	customerID, ok := h.pathCustomerID(c, db)
+	if !ok {
+		return
+	}
+
+	var req models.CreateCustomerOrderRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	h.createOrder(c, models.CreateOrderRequest{
+		Item:                 req.Item,
+		Amount:               req.Amount,
+		Time:                 req.Time,
+		CustomerID:           customerID,
+		ProductID:            req.ProductID,
+		Quantity:             req.Quantity,
+		Priority:             req.Priority,
+		DeliveryInstructions: req.DeliveryInstructions,
+		PromoCode:            req.PromoCode,
+	})
+}
+
+// pathCustomerID reads :id and checks the customer exists
+func (h *OrderHandler) pathCustomerID(c *gin.Context, db *gorm.DB) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil || id == 0 {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return 0, false
+	}
+
+	var customer models.Customer
+	if err := db.Select("id").First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return 0, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return 0, false
+	}
+	return customer.ID, true
+}
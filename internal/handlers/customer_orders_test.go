@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetCustomerOrders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	sebbie := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	jane := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"}
+	db.Create(&sebbie)
+	db.Create(&jane)
+
+	db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: sebbie.ID})
+	db.Create(&models.Order{Item: "phone", Amount: models.Shillings(800), Time: time.Now(), CustomerID: sebbie.ID})
+	db.Create(&models.Order{Item: "tablet", Amount: models.Shillings(600), Time: time.Now(), CustomerID: sebbie.ID, CreatedAt: time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)})
+	db.Create(&models.Order{Item: "charger", Amount: models.Shillings(50), Time: time.Now(), CustomerID: jane.ID})
+
+	tests := []struct {
+		name           string
+		customerID     string
+		query          string
+		expectedStatus int
+		expectedError  string
+		expectedTotal  int
+		expectedCount  int
+	}{
+		{name: "customer's orders", customerID: "1", expectedStatus: http.StatusOK, expectedTotal: 3},
+		{name: "another customer's orders", customerID: "2", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "query customer_id is ignored", customerID: "2", query: "customer_id=1", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "filter by created date", customerID: "1", query: "created_from=2025-09-01&created_to=2025-09-01", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "paginate", customerID: "1", query: "page=2&limit=2", expectedStatus: http.StatusOK, expectedTotal: 3, expectedCount: 1},
+		{name: "invalid created range", customerID: "1", query: "created_from=2025-09-02&created_to=2025-09-01", expectedStatus: http.StatusBadRequest, expectedError: "invalid_range"},
+		{name: "non-existent customer", customerID: "999", expectedStatus: http.StatusNotFound, expectedError: "customer_not_found"},
+		{name: "invalid customer id", customerID: "abc", expectedStatus: http.StatusBadRequest, expectedError: "invalid_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/customers/"+tt.customerID+"/orders?"+tt.query, nil)
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}}
+
+			handler.GetCustomerOrders(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var orders []models.Order
+			var meta models.PageMeta
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &orders, Meta: &meta})
+
+			expectedCount := tt.expectedTotal
+			if tt.expectedCount != 0 {
+				expectedCount = tt.expectedCount
+			}
+			assert.Len(t, orders, expectedCount)
+			assert.Equal(t, int64(tt.expectedTotal), meta.Total)
+			for _, order := range orders {
+				assert.Equal(t, tt.customerID, strconv.Itoa(int(order.CustomerID)))
+			}
+		})
+	}
+}
+
+func TestCreateCustomerOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	tests := []struct {
+		name           string
+		customerID     string
+		body           interface{}
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "create order",
+			customerID:     "1",
+			body:           models.CreateCustomerOrderRequest{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), Priority: models.OrderPriorityExpress},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "body customer_id is ignored",
+			customerID:     "1",
+			body:           map[string]interface{}{"item": "phone", "amount": 800, "time": time.Now(), "customer_id": 999},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "missing item",
+			customerID:     "1",
+			body:           map[string]interface{}{"amount": 800, "time": time.Now()},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "non-existent customer",
+			customerID:     "999",
+			body:           models.CreateCustomerOrderRequest{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now()},
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+		},
+		{
+			name:           "invalid customer id",
+			customerID:     "abc",
+			body:           models.CreateCustomerOrderRequest{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now()},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jsonBody, _ := json.Marshal(tt.body)
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/customers/"+tt.customerID+"/orders", bytes.NewBuffer(jsonBody))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}}
+
+			handler.CreateCustomerOrder(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var order models.Order
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+			assert.NotZero(t, order.ID)
+			assert.Equal(t, customer.ID, order.CustomerID)
+			assert.Equal(t, 1, order.Quantity)
+		})
+	}
+}
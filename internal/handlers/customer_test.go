@@ -3,30 +3,20 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("failed to connect to test database: %v", err)
-	}
-
-	err = db.AutoMigrate(&models.Customer{}, &models.Order{})
-	if err != nil {
-		t.Fatalf("failed to migrate test database: %v", err)
-	}
-	return db
-}
-
 func TestCreateCustomer(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -57,6 +47,72 @@ func TestCreateCustomer(t *testing.T) {
 			expectedStatus: http.StatusConflict,
 			expectedError:  "customer_exists",
 		},
+		{
+			name: "duplicate customer email",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  "CUST002",
+				Phone: "+254740827150",
+				Email: "sebbievilar2@gmail.com",
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "email_already_in_use",
+		},
+		{
+			name: "duplicate customer code in another case",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  " cust001 ",
+				Phone: "+254740827150",
+				Email: "different@gmail.com",
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "customer_exists",
+		},
+		{
+			name: "duplicate customer email in another case",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  "CUST002",
+				Phone: "+254740827150",
+				Email: " SebbieVilar2@Gmail.com",
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "email_already_in_use",
+		},
+		{
+			name: "blank code",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  "   ",
+				Phone: "+254740827150",
+				Email: "sebbievilar2@gmail.com",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name: "phone not kenyan",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  "CUST001",
+				Phone: "+255740827150",
+				Email: "sebbievilar2@gmail.com",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_phone",
+		},
+		{
+			name: "malformed code",
+			requestBody: models.CreateCustomerRequest{
+				Name:  "Sebbie Mzing",
+				Code:  "001-CUST",
+				Phone: "+254740827150",
+				Email: "sebbievilar2@gmail.com",
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_customer_code",
+		},
 		{
 			name: "missing required fields",
 			requestBody: models.CreateCustomerRequest{
@@ -66,16 +122,16 @@ func TestCreateCustomer(t *testing.T) {
 				Email: "sebbievilar2@gmail.com",
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid request",
+			expectedError:  "invalid_request",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db := setupTestDB(t)
+			db := testutil.DB(t)
 			handler := NewCustomerHandler(db)
 
-			if tt.name == "duplicate customer code" {
+			if strings.HasPrefix(tt.name, "duplicate") {
 				customer := models.Customer{
 					Name:  "Sebbie Mzing",
 					Code:  "CUST001",
@@ -100,12 +156,12 @@ func TestCreateCustomer(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else {
 				var customer models.Customer
-				json.Unmarshal(w.Body.Bytes(), &customer)
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customer})
 				assert.Equal(t, tt.requestBody.Name, customer.Name)
 				assert.Equal(t, tt.requestBody.Code, customer.Code)
 				assert.Equal(t, tt.requestBody.Phone, customer.Phone)
@@ -115,6 +171,53 @@ func TestCreateCustomer(t *testing.T) {
 	}
 }
 
+func TestCreateCustomerNormalizes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	jsonBody, _ := json.Marshal(models.CreateCustomerRequest{Name: "Sebbie Mzing", Code: " CUST001\t", Phone: "+254740827150", Email: "  Sebbie.Vilar2@Gmail.COM "})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/customers", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.CreateCustomer(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var customer models.Customer
+	db.First(&customer)
+	assert.Equal(t, fmt.Sprintf("/api/v1/customers/%d", customer.ID), w.Header().Get("Location"))
+	assert.Equal(t, "CUST001", customer.Code)
+	assert.Equal(t, "sebbie.vilar2@gmail.com", customer.Email)
+}
+
+func TestMigrateDeduplicatesCustomerCodes(t *testing.T) {
+	db := testutil.DB(t)
+
+	// codes written before they were compared ignoring case
+	db.Exec("DROP INDEX idx_customers_code_ci")
+	for _, code := range []string{"CUST001", "cust001", "CUST002 ", "CUST002"} {
+		db.Exec("INSERT INTO customers (name, code, phone, phone_hash) VALUES ('Sebbie Chanzu', ?, '+254740827150', '')", code)
+	}
+
+	assert.NoError(t, models.Migrate(db))
+
+	var codes []string
+	db.Model(&models.Customer{}).Order("id ASC").Pluck("code", &codes)
+	assert.Equal(t, []string{"CUST001", "cust001-2", "CUST002", "CUST002-4"}, codes)
+
+	var renames int64
+	db.Model(&models.AuditEvent{}).Where("type = ? AND actor = ?", models.AuditCustomerCodeChanged, "migration").Count(&renames)
+	assert.Equal(t, int64(2), renames)
+
+	err := db.Create(&models.Customer{Name: "Jane Wanjiku", Code: "cust002", Phone: "+254711000002"}).Error
+	_, conflict := uniqueViolation(err)
+	assert.True(t, conflict, "the case-insensitive index is in place")
+}
+
 func TestGetCustomer(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -136,20 +239,20 @@ func TestGetCustomer(t *testing.T) {
 			customerID:     "invalid",
 			setupCustomer:  false,
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent customer",
 			customerID:     "999",
 			setupCustomer:  false,
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "customer not found",
+			expectedError:  "customer_not_found",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db := setupTestDB(t)
+			db := testutil.DB(t)
 			handler := NewCustomerHandler(db)
 
 			if tt.setupCustomer {
@@ -176,12 +279,12 @@ func TestGetCustomer(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else {
 				var customer models.Customer
-				json.Unmarshal(w.Body.Bytes(), &customer)
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customer})
 				assert.Equal(t, "Sebbie Chanzu", customer.Name)
 				assert.Equal(t, "CUST001", customer.Code)
 				assert.Equal(t, "+254740827150", customer.Phone)
@@ -193,7 +296,7 @@ func TestGetCustomer(t *testing.T) {
 
 func TestGetCustomers(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	handler := NewCustomerHandler(db)
 
 	customers := []models.Customer{
@@ -226,15 +329,140 @@ func TestGetCustomers(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 
-	var response map[string]interface{}
-	json.Unmarshal(w.Body.Bytes(), &response)
-	assert.Contains(t, response, "customers")
-	assert.Contains(t, response, "total")
-	assert.Equal(t, float64(2), response["total"])
-
-	customerList, ok := response["customers"].([]interface{})
-	assert.True(t, ok)
+	var customerList []models.Customer
+	var meta models.PageMeta
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customerList, Meta: &meta})
+	assert.Equal(t, int64(2), meta.Total)
+	assert.Equal(t, 1, meta.Page)
+	assert.Equal(t, 1, meta.TotalPages)
+	assert.False(t, meta.HasNext)
 	assert.Len(t, customerList, 2)
+
+	tests := []struct {
+		name             string
+		query            string
+		expectedStatus   int
+		expectedHasNext  bool
+		expectedCustomer int
+		withoutTotal     bool
+	}{
+		{name: "first of two pages", query: "page=1&limit=1", expectedStatus: http.StatusOK, expectedHasNext: true, expectedCustomer: 1},
+		{name: "last page", query: "page=2&limit=1", expectedStatus: http.StatusOK, expectedCustomer: 1},
+		{name: "past the last page", query: "page=3&limit=1", expectedStatus: http.StatusOK},
+		{name: "negative page", query: "page=-1", expectedStatus: http.StatusBadRequest},
+		{name: "non-numeric limit", query: "limit=ten", expectedStatus: http.StatusBadRequest},
+		{name: "zero limit", query: "limit=0", expectedStatus: http.StatusBadRequest},
+		{name: "without the total", query: "page=1&limit=1&include_total=false", expectedStatus: http.StatusOK, expectedHasNext: true, expectedCustomer: 1, withoutTotal: true},
+		{name: "estimated total", query: "page=2&limit=1&count=estimated", expectedStatus: http.StatusOK, expectedCustomer: 1},
+		{name: "unknown count", query: "count=roughly", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/customers?"+tt.query, nil)
+
+			handler.GetCustomers(c)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedStatus != http.StatusOK {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, "invalid_pagination", errorResponse.Error.Code)
+				return
+			}
+
+			var customers []models.Customer
+			var meta models.PageMeta
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customers, Meta: &meta})
+			assert.Len(t, customers, tt.expectedCustomer)
+			assert.Equal(t, tt.expectedHasNext, meta.HasNext)
+			if tt.withoutTotal {
+				assert.Equal(t, "none", meta.TotalAccuracy)
+				assert.NotContains(t, w.Body.String(), `"total"`)
+				return
+			}
+			assert.Equal(t, 2, meta.TotalPages)
+		})
+	}
+}
+
+func TestGetCustomersEmbedsOrdersOnRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	sebbie := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	jane := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"}
+	db.Create(&sebbie)
+	db.Create(&jane)
+
+	start := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < maxEmbeddedOrders+5; i++ {
+		db.Create(&models.Order{Item: fmt.Sprintf("item %d", i), Amount: models.Shillings(100), Time: start, CustomerID: sebbie.ID, CreatedAt: start.Add(time.Duration(i) * time.Hour)})
+	}
+	cancelled := models.Order{Item: "cancelled", Amount: models.Shillings(100), Time: start, CustomerID: jane.ID}
+	db.Create(&cancelled)
+	db.Delete(&cancelled)
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedError  string
+		expectOrders   bool
+		expectCount    bool
+	}{
+		{name: "counts by default", expectedStatus: http.StatusOK, expectCount: true},
+		{name: "include orders", query: "include=orders", expectedStatus: http.StatusOK, expectOrders: true, expectCount: true},
+		{name: "fields with orders", query: "fields=code,orders", expectedStatus: http.StatusOK, expectOrders: true},
+		{name: "fields with orders_count", query: "fields=code,orders_count", expectedStatus: http.StatusOK, expectCount: true},
+		{name: "unknown include", query: "include=notes", expectedStatus: http.StatusBadRequest, expectedError: "invalid_include"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/customers?"+tt.query, nil)
+
+			handler.GetCustomers(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var customers []models.Customer
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &customers})
+			if !assert.Len(t, customers, 2) {
+				return
+			}
+
+			if tt.expectOrders {
+				if assert.Len(t, customers[0].Orders, maxEmbeddedOrders, "embedded orders are capped") {
+					assert.Equal(t, fmt.Sprintf("item %d", maxEmbeddedOrders+4), customers[0].Orders[0].Item, "newest first")
+				}
+				assert.Empty(t, customers[1].Orders, "deleted orders are not embedded")
+			} else {
+				assert.Nil(t, customers[0].Orders)
+			}
+
+			if tt.expectCount {
+				if assert.NotNil(t, customers[0].OrdersCount) && assert.NotNil(t, customers[1].OrdersCount) {
+					assert.Equal(t, int64(maxEmbeddedOrders+5), *customers[0].OrdersCount)
+					assert.Equal(t, int64(0), *customers[1].OrdersCount, "deleted orders are not counted")
+				}
+			} else {
+				assert.Nil(t, customers[0].OrdersCount)
+			}
+		})
+	}
 }
 
 func TestUpdateCustomer(t *testing.T) {
@@ -283,7 +511,7 @@ func TestUpdateCustomer(t *testing.T) {
 			requestBody:    models.UpdateCustomerRequest{Name: "Updated"},
 			setupCustomer:  false,
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent customer",
@@ -291,7 +519,7 @@ func TestUpdateCustomer(t *testing.T) {
 			requestBody:    models.UpdateCustomerRequest{Name: "Updated"},
 			setupCustomer:  false,
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "customer not found",
+			expectedError:  "customer_not_found",
 		},
 		{
 			name:       "email conflict on update",
@@ -302,13 +530,13 @@ func TestUpdateCustomer(t *testing.T) {
 			},
 			setupCustomer:  true,
 			expectedStatus: http.StatusConflict,
-			expectedError:  "email already in use",
+			expectedError:  "email_already_in_use",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db := setupTestDB(t)
+			db := testutil.DB(t)
 			handler := NewCustomerHandler(db)
 
 			if tt.setupCustomer {
@@ -352,9 +580,9 @@ func TestUpdateCustomer(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code, "status code mismatch")
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error, "error key mismatch")
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code, "error key mismatch")
 			} else {
 				var updatedCustomer models.Customer
 				db.First(&updatedCustomer, tt.customerID)
@@ -366,6 +594,55 @@ func TestUpdateCustomer(t *testing.T) {
 	}
 }
 
+func TestCustomerDates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	serve := func(method, id, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(method, "/customers/"+id, strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		if id != "" {
+			c.Params = gin.Params{{Key: "id", Value: id}}
+			handler.UpdateCustomer(c)
+		} else {
+			handler.CreateCustomer(c)
+		}
+		return w
+	}
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var body models.ErrorEnvelope
+		json.Unmarshal(w.Body.Bytes(), &body)
+		return body.Error.Code
+	}
+
+	w := serve(http.MethodPost, "", `{"name": "Sebbie Chanzu", "code": "CUST001", "phone": "+254740827150", "email": "sebbievilar2@gmail.com", "birthday": "1990-03-10", "onboarded_on": "2023-06-01"}`)
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var customer models.Customer
+	db.First(&customer)
+	if assert.NotNil(t, customer.Birthday) && assert.NotNil(t, customer.OnboardedOn) {
+		assert.Equal(t, models.Date("1990-03-10"), *customer.Birthday)
+		assert.Equal(t, models.Date("2023-06-01"), *customer.OnboardedOn)
+	}
+
+	w = serve(http.MethodPut, "1", `{"birthday": null, "name": "Sebbie Mzing"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	customer = models.Customer{}
+	db.First(&customer)
+	assert.Nil(t, customer.Birthday, "null clears it")
+	assert.NotNil(t, customer.OnboardedOn, "left out keeps it")
+
+	w = serve(http.MethodPut, "1", `{"birthday": "10/03/1990"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_request", errorCode(w))
+
+	w = serve(http.MethodPut, "1", `{"onboarded_on": "`+time.Now().AddDate(0, 0, 2).Format(models.DateLayout)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "invalid_date", errorCode(w))
+}
+
 func TestDeleteCustomer(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
@@ -387,20 +664,20 @@ func TestDeleteCustomer(t *testing.T) {
 			customerID:     "invalid",
 			setupCustomer:  false,
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent customer",
 			customerID:     "999",
 			setupCustomer:  false,
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "customer not found",
+			expectedError:  "customer_not_found",
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db := setupTestDB(t)
+			db := testutil.DB(t)
 			handler := NewCustomerHandler(db)
 
 			if tt.setupCustomer {
@@ -427,12 +704,12 @@ func TestDeleteCustomer(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else {
 				var response map[string]interface{}
-				json.Unmarshal(w.Body.Bytes(), &response)
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
 				assert.Equal(t, "customer deleted successfully", response["message"])
 
 				var dbCustomer models.Customer
@@ -443,3 +720,79 @@ func TestDeleteCustomer(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCustomerWithFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		fields         string
+		expectedStatus int
+		expectedKeys   []string
+		expectedError  string
+	}{
+		{
+			name:           "subset of fields",
+			fields:         "name,phone",
+			expectedStatus: http.StatusOK,
+			expectedKeys:   []string{"name", "phone"},
+		},
+		{
+			name:           "fields with embedded orders",
+			fields:         "code,orders",
+			expectedStatus: http.StatusOK,
+			expectedKeys:   []string{"code", "orders"},
+		},
+		{
+			name:           "unknown field",
+			fields:         "name,password",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_fields",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			handler := NewCustomerHandler(db)
+
+			customer := models.Customer{
+				Name:  "Sebbie Chanzu",
+				Code:  "CUST001",
+				Phone: "+254740827150",
+				Email: "sebbievilar2@gmail.com",
+				Orders: []models.Order{
+					{Item: "laptop", Amount: models.Shillings(1500.00), Time: time.Now()},
+				},
+			}
+			if err := db.Create(&customer).Error; err != nil {
+				t.Fatalf("failed to create customer: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			req, _ := http.NewRequest("GET", "/customers/1?fields="+tt.fields, nil)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+			handler.GetCustomer(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+			assert.Len(t, response, len(tt.expectedKeys))
+			for _, key := range tt.expectedKeys {
+				assert.Contains(t, response, key)
+			}
+		})
+	}
+}
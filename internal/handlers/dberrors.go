@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pgUniqueViolation is the Postgres SQLSTATE for a unique constraint violation
+const pgUniqueViolation = "23505"
+
+// mysqlDuplicateEntry is the MySQL error number for a unique key violation
+const mysqlDuplicateEntry = 1062
+
+// uniqueViolation reports whether err was caused by a unique constraint and
+// returns whatever names the constraint: the index name on Postgres and
+// MySQL, or the table.column list on SQLite.
+func uniqueViolation(err error) (string, bool) {
+	if err == nil {
+		return "", false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return pgErr.ConstraintName, true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		// "Duplicate entry 'x' for key 'customers.idx_customers_email'"; the
+		// entry itself is user input, so only the key name is returned
+		if i := strings.LastIndex(mysqlErr.Message, "for key '"); i >= 0 {
+			return strings.TrimSuffix(mysqlErr.Message[i+len("for key '"):], "'"), true
+		}
+		return "", true
+	}
+
+	if msg := err.Error(); strings.Contains(msg, "UNIQUE constraint failed") {
+		return msg, true
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name               string
+		err                error
+		expectedConstraint string
+		expectedOK         bool
+	}{
+		{
+			name:               "postgres unique violation",
+			err:                fmt.Errorf("create: %w", &pgconn.PgError{Code: "23505", ConstraintName: "idx_customers_email"}),
+			expectedConstraint: "idx_customers_email",
+			expectedOK:         true,
+		},
+		{
+			name:       "other postgres error",
+			err:        &pgconn.PgError{Code: "23502", ConstraintName: "customers_name_not_null"},
+			expectedOK: false,
+		},
+		{
+			name:               "mysql duplicate entry",
+			err:                &mysql.MySQLError{Number: 1062, Message: "Duplicate entry 'email@example.com' for key 'customers.idx_customers_code'"},
+			expectedConstraint: "customers.idx_customers_code",
+			expectedOK:         true,
+		},
+		{
+			name:       "other mysql error",
+			err:        &mysql.MySQLError{Number: 1048, Message: "Column 'name' cannot be null"},
+			expectedOK: false,
+		},
+		{
+			name:               "sqlite unique violation",
+			err:                errors.New("UNIQUE constraint failed: customers.code"),
+			expectedConstraint: "UNIQUE constraint failed: customers.code",
+			expectedOK:         true,
+		},
+		{
+			name:       "nil error",
+			err:        nil,
+			expectedOK: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			constraint, ok := uniqueViolation(tt.err)
+
+			assert.Equal(t, tt.expectedOK, ok)
+			assert.Equal(t, tt.expectedConstraint, constraint)
+		})
+	}
+}
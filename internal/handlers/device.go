@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DeviceHandler serves the devices push notifications are sent to, and
+// the acknowledgements the app sends back once one is shown
+type DeviceHandler struct {
+	db *gorm.DB
+}
+
+func NewDeviceHandler(db *gorm.DB) *DeviceHandler {
+	return &DeviceHandler{db: db}
+}
+
+// RegisterDevice registers a device for the customer. Registering a token
+// again, for example after the app is signed in to another account, moves
+// it to this customer.
+func (h *DeviceHandler) RegisterDevice(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+
+	var req models.RegisterDeviceRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	device := models.DeviceToken{
+		CustomerID: customer.ID,
+		Token:      strings.TrimSpace(req.Token),
+		Platform:   req.Platform,
+	}
+	if device.Token == "" {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "token must not be blank")
+		return
+	}
+
+	db := h.db.WithContext(c.Request.Context())
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "token"}},
+		DoUpdates: clause.AssignmentColumns([]string{"customer_id", "platform", "updated_at"}),
+	}).Create(&device).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to register device")
+		return
+	}
+	// the id is not returned on conflict by every driver
+	if err := db.Where("token = ?", device.Token).First(&device).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve device")
+		return
+	}
+
+	respond.OK(c, http.StatusCreated, device)
+}
+
+func (h *DeviceHandler) GetDevices(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+
+	var devices []models.DeviceToken
+	err := h.db.WithContext(c.Request.Context()).
+		Where("customer_id = ?", customer.ID).Order("id ASC").Find(&devices).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve devices")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, devices, gin.H{"total": len(devices)})
+}
+
+func (h *DeviceHandler) DeleteDevice(c *gin.Context) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return
+	}
+	deviceID, err := strconv.ParseUint(c.Param("deviceId"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid device id")
+		return
+	}
+
+	result := h.db.WithContext(c.Request.Context()).
+		Where("id = ? AND customer_id = ?", deviceID, customerID).Delete(&models.DeviceToken{})
+	if result.Error != nil {
+		respond.ServerError(c, result.Error, "database_error", "failed to delete device")
+		return
+	}
+	if result.RowsAffected == 0 {
+		respond.Error(c, http.StatusNotFound, "device_not_found", "device not found")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "device deleted successfully"})
+}
+
+// AcknowledgePush records that the app showed a push, so it is not texted.
+// Acknowledging twice is fine; acknowledging one already texted is a
+// conflict.
+func (h *DeviceHandler) AcknowledgePush(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid notification id")
+		return
+	}
+
+	db := h.db.WithContext(c.Request.Context())
+	err = db.Model(&models.PushNotification{}).
+		Where("id = ? AND status = ?", id, models.PushStatusPending).
+		Updates(map[string]interface{}{"status": models.PushStatusDelivered, "delivered_at": time.Now()}).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to acknowledge notification")
+		return
+	}
+
+	var push models.PushNotification
+	if err := db.First(&push, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "notification_not_found", "notification not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve notification")
+		return
+	}
+	if push.Status != models.PushStatusDelivered {
+		respond.Error(c, http.StatusConflict, "notification_settled", "notification was already "+push.Status)
+		return
+	}
+
+	respond.OK(c, http.StatusOK, push)
+}
+
+func (h *DeviceHandler) findCustomer(c *gin.Context) (models.Customer, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return models.Customer{}, false
+	}
+
+	var customer models.Customer
+	if err := h.db.WithContext(c.Request.Context()).First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return customer, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return customer, false
+	}
+	return customer, true
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDevices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewDeviceHandler(db)
+
+	r := gin.New()
+	r.POST("/customers/:id/devices", handler.RegisterDevice)
+	r.GET("/customers/:id/devices", handler.GetDevices)
+	r.DELETE("/customers/:id/devices/:deviceId", handler.DeleteDevice)
+
+	for _, customer := range []models.Customer{
+		{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+		{Name: "Jane Doe", Code: "CUST002", Phone: "+254740827151", Email: "jane@example.com"},
+	} {
+		if err := db.Create(&customer).Error; err != nil {
+			t.Fatalf("failed to create customer: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "register device",
+			method:         "POST",
+			path:           "/customers/1/devices",
+			body:           `{"token": "token-a", "platform": "android"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "register second device",
+			method:         "POST",
+			path:           "/customers/1/devices",
+			body:           `{"token": "token-b", "platform": "ios"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "token moves to the customer registering it",
+			method:         "POST",
+			path:           "/customers/2/devices",
+			body:           `{"token": "token-b", "platform": "ios"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "unknown platform",
+			method:         "POST",
+			path:           "/customers/1/devices",
+			body:           `{"token": "token-c", "platform": "symbian"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "unknown customer",
+			method:         "POST",
+			path:           "/customers/99/devices",
+			body:           `{"token": "token-c", "platform": "web"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+		},
+		{
+			name:           "device of another customer",
+			method:         "DELETE",
+			path:           "/customers/1/devices/2",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "device_not_found",
+		},
+		{
+			name:           "delete device",
+			method:         "DELETE",
+			path:           "/customers/2/devices/2",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/customers/1/devices", nil)
+	r.ServeHTTP(w, req)
+
+	var devices []models.DeviceToken
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &devices})
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, "token-a", devices[0].Token)
+	}
+}
+
+func TestPushNotifications(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	sms := services.NewMockSMSService()
+	push := services.NewMockPushService()
+	notifier := services.NewPushNotifier(db, push, sms, services.PushPolicy{FallbackAfter: 10 * time.Minute})
+	handler := NewDeviceHandler(db)
+
+	r := gin.New()
+	r.POST("/notifications/:id/delivered", handler.AcknowledgePush)
+
+	customers := []models.Customer{
+		{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+		{Name: "Jane Doe", Code: "CUST002", Phone: "+254740827151", Email: "jane@example.com"},
+		{Name: "John Doe", Code: "CUST003", Phone: "+254740827152", Email: "john@example.com"},
+	}
+	for i := range customers {
+		if err := db.Create(&customers[i]).Error; err != nil {
+			t.Fatalf("failed to create customer: %v", err)
+		}
+	}
+	db.Create(&models.DeviceToken{CustomerID: customers[0].ID, Token: "token-a", Platform: models.DevicePlatformAndroid})
+	db.Create(&models.DeviceToken{CustomerID: customers[1].ID, Token: "token-stale", Platform: models.DevicePlatformIOS})
+	push.Invalid["token-stale"] = true
+
+	notify := func(customer models.Customer) {
+		err := notifier.Notify(context.Background(), services.Notification{
+			CustomerID: customer.ID,
+			Phone:      customer.Phone,
+			Title:      "Order received",
+			Message:    "hello " + customer.Name,
+		})
+		assert.NoError(t, err)
+	}
+
+	// a customer with a device is pushed to and not texted
+	notify(customers[0])
+	assert.Len(t, push.Sent, 1)
+	assert.Empty(t, sms.SentMessages)
+
+	// a customer whose only token is stale is texted straight away
+	notify(customers[1])
+	if assert.Len(t, sms.SentMessages, 1) {
+		assert.Equal(t, customers[1].Phone, sms.SentMessages[0].To)
+	}
+	var stale int64
+	db.Model(&models.DeviceToken{}).Where("token = ?", "token-stale").Count(&stale)
+	assert.Zero(t, stale, "a stale token is forgotten")
+
+	// a customer without devices is texted
+	notify(customers[2])
+	assert.Len(t, sms.SentMessages, 2)
+
+	// the first push is acknowledged, a second one is not
+	ackPath := "/notifications/" + push.Sent[0].Message.Data["notification_id"] + "/delivered"
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", ackPath, nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	notify(customers[0])
+	assert.Len(t, push.Sent, 2)
+
+	texted, err := notifier.FallBack(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, texted, "pushes are given time to be acknowledged")
+
+	// once the delay passes only the unacknowledged push is texted
+	db.Model(&models.PushNotification{}).Where("1 = 1").Update("sent_at", time.Now().Add(-time.Hour))
+	texted, err = notifier.FallBack(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, texted)
+	if assert.Len(t, sms.SentMessages, 3) {
+		assert.Equal(t, customers[0].Phone, sms.SentMessages[2].To)
+	}
+
+	var pushes []models.PushNotification
+	db.Order("id ASC").Find(&pushes)
+	if assert.Len(t, pushes, 3) {
+		assert.Equal(t, models.PushStatusDelivered, pushes[0].Status)
+		assert.Equal(t, models.PushStatusFellBack, pushes[1].Status)
+		assert.Equal(t, models.PushStatusFellBack, pushes[2].Status)
+	}
+
+	// a push already texted can no longer be acknowledged
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/notifications/"+strconv.Itoa(int(pushes[2].ID))+"/delivered", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/notifications/99/delivered", nil)
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
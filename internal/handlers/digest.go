@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DigestHandler lets admins look at the orders digests emailed so far and
+// email one without waiting for the daily job
+type DigestHandler struct {
+	db      *gorm.DB
+	digests *services.DigestService
+	audit   services.AuditRecorder
+}
+
+func NewDigestHandler(db *gorm.DB, digests *services.DigestService) *DigestHandler {
+	return &DigestHandler{db: db, digests: digests}
+}
+
+// WithAudit records digests sent by admins
+func (h *DigestHandler) WithAudit(audit services.AuditRecorder) *DigestHandler {
+	h.audit = audit
+	return h
+}
+
+// GetDigests lists past digests newest first, without their orders,
+// filtered by ?status=
+func (h *DigestHandler) GetDigests(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.OrderDigest{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve digests")
+		return
+	}
+
+	var digests []models.OrderDigest
+	if err := query.Omit("orders").Order("created_at DESC, id DESC").Scopes(scopes.Paginate(page)).Find(&digests).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve digests")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, digests, page.MetaOf(total, len(digests)))
+}
+
+// GetDigest returns a digest with its orders, or its attachment with
+// ?format=csv or pdf
+func (h *DigestHandler) GetDigest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid digest id")
+		return
+	}
+
+	var digest models.OrderDigest
+	if err := h.db.WithContext(c.Request.Context()).First(&digest, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "digest_not_found", "digest not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve digest")
+		return
+	}
+
+	var body bytes.Buffer
+	var contentType string
+	switch format := c.Query("format"); format {
+	case "", "json":
+		respond.OK(c, http.StatusOK, digest)
+		return
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		err = services.WriteDigestCSV(&body, digest, h.digests.Location())
+	case "pdf":
+		contentType = "application/pdf"
+		err = services.WriteDigestPDF(&body, digest, h.digests.Location())
+	default:
+		respond.Error(c, http.StatusBadRequest, "invalid_format", "format must be json, csv or pdf")
+		return
+	}
+	if err != nil {
+		respond.ServerError(c, err, "internal_error", "failed to render digest")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "digest-"+digest.Day+"."+c.Query("format")))
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+// SendDigest emails the digest of a day, yesterday by default, at once.
+// It is recorded whether or not the email goes out.
+func (h *DigestHandler) SendDigest(c *gin.Context) {
+	if !h.digests.Configured() {
+		respond.Error(c, http.StatusServiceUnavailable, "email_not_configured", "email is not configured")
+		return
+	}
+	var req models.SendDigestRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+	day := h.digests.Yesterday()
+	if req.Day != "" {
+		day, _ = time.ParseInLocation(services.DayLayout, req.Day, h.digests.Location())
+	}
+
+	digest, err := h.digests.Send(c.Request.Context(), day, req.Recipients, middleware.CurrentUserEmail(c))
+	switch {
+	case errors.Is(err, services.ErrNoDigestRecipients):
+		respond.Error(c, http.StatusBadRequest, "no_recipients", "no recipients given and DIGEST_RECIPIENTS is not set")
+		return
+	case err != nil && digest.Status == models.DigestFailed:
+		respond.Error(c, http.StatusBadGateway, "email_failed", "failed to email digest")
+		return
+	case err != nil:
+		respond.ServerError(c, err, "database_error", "failed to send digest")
+		return
+	}
+
+	if h.audit != nil {
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditDigestSent,
+			Actor:     middleware.CurrentUserEmail(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   fmt.Sprintf("digest=%d day=%s recipients=%d", digest.ID, digest.Day, len(digest.Recipients)),
+		})
+	}
+	respond.Created(c, fmt.Sprintf("/api/v1/admin/digests/%d", digest.ID), digest.ID, digest.CreatedAt, digest)
+}
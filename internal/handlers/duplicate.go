@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// DuplicateOrder places a new order for the same customer and item as an
+// existing one, timed now unless overridden, for repeat purchases. Stock,
+// tax, SLA and notifications are handled as for any new order.
+func (h *OrderHandler) DuplicateOrder(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var req models.DuplicateOrderRequest
+	if c.Request.ContentLength != 0 {
+		if err := respond.BindJSON(c, &req); err != nil {
+			respond.BindError(c, err)
+			return
+		}
+	}
+
+	var source models.Order
+	if err := db.First(&source, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve order")
+		return
+	}
+
+	// the copy is placed at full price, as its promo code is not copied
+	fullPrice := source.Amount + source.DiscountAmount
+	order := models.Order{
+		Item:                 source.Item,
+		Amount:               fullPrice,
+		Time:                 time.Now(),
+		CustomerID:           source.CustomerID,
+		ProductID:            source.ProductID,
+		Quantity:             source.Quantity,
+		Priority:             source.Priority,
+		DeliveryInstructions: source.DeliveryInstructions,
+	}
+
+	if req.Item != "" {
+		order.Item = req.Item
+	}
+	if req.Quantity != 0 && req.Quantity != source.Quantity {
+		order.Quantity = req.Quantity
+		if source.Quantity > 0 {
+			order.Amount = fullPrice.Scale(float64(req.Quantity) / float64(source.Quantity))
+		}
+	}
+	if req.Amount != nil {
+		order.Amount = *req.Amount
+	}
+	if req.Priority != "" {
+		order.Priority = req.Priority
+	}
+	if req.Time != nil {
+		order.Time = *req.Time
+	}
+
+	h.placeOrder(c, order, nil)
+}
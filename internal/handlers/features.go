@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/features"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+type FeatureHandler struct {
+	flags *features.Store
+}
+
+func NewFeatureHandler(flags *features.Store) *FeatureHandler {
+	return &FeatureHandler{flags: flags}
+}
+
+func (h *FeatureHandler) GetFeatureFlags(c *gin.Context) {
+	flags, err := h.flags.List(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve feature flags")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, flags, gin.H{"total": len(flags)})
+}
+
+// UpdateFeatureFlag creates the flag if needed and applies the given fields
+func (h *FeatureHandler) UpdateFeatureFlag(c *gin.Context) {
+	key := c.Param("key")
+	if len(key) > 100 {
+		respond.Error(c, http.StatusBadRequest, "invalid_key", "flag key must be at most 100 characters")
+		return
+	}
+
+	var req models.UpdateFeatureFlagRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	flag, err := h.flags.Set(c.Request.Context(), key, req)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to update feature flag")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, flag)
+}
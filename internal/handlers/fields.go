@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fieldSpec describes which fields a resource exposes to ?fields= projections.
+// relations maps a preloadable field to the column the preload depends on,
+// and computed maps a field to the SQL expression it is selected as.
+type fieldSpec struct {
+	columns   []string
+	relations map[string]string
+	computed  map[string]string
+}
+
+var customerFields = fieldSpec{
+	columns:   []string{"id", "name", "code", "phone", "email", "delivery_instructions", "birthday", "onboarded_on", "created_at", "updated_at", "anonymized_at", "last_order_at", "marketing_opt_out_at"},
+	relations: map[string]string{"orders": "id", "notes": "id"},
+	computed:  map[string]string{"orders_count": ordersCountColumn},
+}
+
+var orderFields = fieldSpec{
+	columns:   []string{"id", "number", "item", "amount", "tax_rate", "tax_inclusive", "net_amount", "tax_amount", "gross_amount", "promo_code", "discount_amount", "time", "status", "estimated_delivery_at", "product_id", "quantity", "priority", "sla_deadline", "sla_breached_at", "delivery_instructions", "customer_id", "created_at", "updated_at"},
+	relations: map[string]string{"customer": "customer_id"},
+}
+
+// parse reads the comma separated ?fields= parameter. A nil result means
+// the parameter was not given and every field should be returned.
+func (s fieldSpec) parse(c *gin.Context) ([]string, error) {
+	raw, ok := c.GetQuery("fields")
+	if !ok {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !s.allows(field) {
+			return nil, fmt.Errorf("unknown field: %s", field)
+		}
+		fields = append(fields, field)
+	}
+
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("fields must not be empty")
+	}
+	return fields, nil
+}
+
+func (s fieldSpec) allows(field string) bool {
+	if _, ok := s.relations[field]; ok {
+		return true
+	}
+	if _, ok := s.computed[field]; ok {
+		return true
+	}
+	for _, column := range s.columns {
+		if column == field {
+			return true
+		}
+	}
+	return false
+}
+
+// selectColumns returns the SQL columns needed to serve the requested fields,
+// always including the primary key and any keys required by preloads.
+func (s fieldSpec) selectColumns(fields []string) []string {
+	columns := []string{"id"}
+	seen := map[string]bool{"id": true}
+
+	add := func(column string) {
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+
+	for _, field := range fields {
+		if fk, ok := s.relations[field]; ok {
+			add(fk)
+			continue
+		}
+		if expr, ok := s.computed[field]; ok {
+			add(expr + " AS " + field)
+			continue
+		}
+		add(field)
+	}
+	return columns
+}
+
+// parseInclude reads the comma separated ?include= parameter, which opts in
+// to embedding the named relations. Only allowed relations may be named.
+func parseInclude(c *gin.Context, allowed ...string) (map[string]bool, error) {
+	include := map[string]bool{}
+	for _, name := range strings.Split(c.Query("include"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(allowed, name) {
+			return nil, fmt.Errorf("unknown include: %s", name)
+		}
+		include[name] = true
+	}
+	return include, nil
+}
+
+// wantsField reports whether field should be loaded for the given projection
+func wantsField(fields []string, field string) bool {
+	if fields == nil {
+		return true
+	}
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// projectFields trims v (a struct or slice of structs) down to the requested
+// JSON keys. It returns v unchanged when no projection was requested.
+func projectFields(v interface{}, fields []string) interface{} {
+	if fields == nil {
+		return v
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return v
+	}
+
+	switch value := decoded.(type) {
+	case []interface{}:
+		for i, item := range value {
+			value[i] = pickKeys(item, fields)
+		}
+		return value
+	default:
+		return pickKeys(value, fields)
+	}
+}
+
+func pickKeys(v interface{}, fields []string) interface{} {
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+
+	picked := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := object[field]; ok {
+			picked[field] = value
+		}
+	}
+	return picked
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// every field a response has can be asked for with ?fields=, so a column
+// added to a model must be added to its fieldSpec too
+func TestFieldSpecsCoverModels(t *testing.T) {
+	for name, tc := range map[string]struct {
+		model interface{}
+		spec  fieldSpec
+	}{
+		"order":    {models.Order{}, orderFields},
+		"customer": {models.Customer{}, customerFields},
+	} {
+		t.Run(name, func(t *testing.T) {
+			typ := reflect.TypeOf(tc.model)
+			for i := 0; i < typ.NumField(); i++ {
+				field, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+				if field == "" || field == "-" {
+					continue
+				}
+				assert.True(t, tc.spec.allows(field), "?fields= does not allow %s", field)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// parsePage reads the ?page= and ?limit= of a list, and how to count its
+// total from ?include_total= and ?count=
+func parsePage(c *gin.Context) (scopes.Page, bool) {
+	page, err := scopes.ParsePage(c.Query("page"), c.Query("limit"))
+	if err == nil {
+		page.Count, err = scopes.ParseCount(c.Query("include_total"), c.Query("count"))
+	}
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_pagination", err.Error())
+		return page, false
+	}
+	return page, true
+}
+
+// parseCustomerFilter reads the optional ?customer_id= list filter; zero
+// means no filter
+func parseCustomerFilter(c *gin.Context) (uint, bool) {
+	raw := c.Query("customer_id")
+	if raw == "" {
+		return 0, true
+	}
+
+	id, err := strconv.ParseUint(raw, 10, 32)
+	if err != nil || id == 0 {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseCreatedRange reads the optional ?created_from= and ?created_to= list
+// filters, as RFC 3339 times or YYYY-MM-DD dates. A created_to date
+// includes the whole day.
+func parseCreatedRange(c *gin.Context) (time.Time, time.Time, bool) {
+	return parseTimeRange(c, "created_from", "created_to")
+}
+
+// parseTimeRange reads an optional range from the fromParam and toParam
+// query parameters, like parseCreatedRange
+func parseTimeRange(c *gin.Context, fromParam, toParam string) (time.Time, time.Time, bool) {
+	var from, to time.Time
+
+	if raw := c.Query(fromParam); raw != "" {
+		parsed, _, err := parseTimeOrDate(raw)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_range", fromParam+" must be a RFC 3339 time or YYYY-MM-DD date")
+			return from, to, false
+		}
+		from = parsed
+	}
+
+	if raw := c.Query(toParam); raw != "" {
+		parsed, isDate, err := parseTimeOrDate(raw)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_range", toParam+" must be a RFC 3339 time or YYYY-MM-DD date")
+			return from, to, false
+		}
+		if isDate {
+			parsed = parsed.AddDate(0, 0, 1)
+		}
+		to = parsed
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		respond.Error(c, http.StatusBadRequest, "invalid_range", fromParam+" must be before "+toParam)
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// Fields the ?filter= expressions of each list may use
+var (
+	orderFilterFields = scopes.FilterFields{
+		"id":          {Column: "id", Type: scopes.FilterNumber},
+		"item":        {Column: "item", Type: scopes.FilterString},
+		"amount":      {Column: "amount", Type: scopes.FilterMoney},
+		"quantity":    {Column: "quantity", Type: scopes.FilterNumber},
+		"status":      {Column: "status", Type: scopes.FilterString},
+		"priority":    {Column: "priority", Type: scopes.FilterString},
+		"customer_id": {Column: "customer_id", Type: scopes.FilterNumber},
+		"product_id":  {Column: "product_id", Type: scopes.FilterNumber},
+		"time":        {Column: "time", Type: scopes.FilterTime},
+		"created_at":  {Column: "created_at", Type: scopes.FilterTime},
+	}
+	archivedOrderFilterFields = scopes.FilterFields{
+		"id":          {Column: "id", Type: scopes.FilterNumber},
+		"item":        {Column: "item", Type: scopes.FilterString},
+		"amount":      {Column: "amount", Type: scopes.FilterMoney},
+		"quantity":    {Column: "quantity", Type: scopes.FilterNumber},
+		"status":      {Column: "status", Type: scopes.FilterString},
+		"customer_id": {Column: "customer_id", Type: scopes.FilterNumber},
+		"product_id":  {Column: "product_id", Type: scopes.FilterNumber},
+		"time":        {Column: "time", Type: scopes.FilterTime},
+		"created_at":  {Column: "created_at", Type: scopes.FilterTime},
+		"archived_at": {Column: "archived_at", Type: scopes.FilterTime},
+	}
+	// phone and email are encrypted at rest, so they cannot be filtered on
+	customerFilterFields = scopes.FilterFields{
+		"id":         {Column: "id", Type: scopes.FilterNumber},
+		"name":       {Column: "name", Type: scopes.FilterString},
+		"code":       {Column: "code", Type: scopes.FilterString},
+		"created_at": {Column: "created_at", Type: scopes.FilterTime},
+	}
+	productFilterFields = scopes.FilterFields{
+		"id":                  {Column: "id", Type: scopes.FilterNumber},
+		"name":                {Column: "name", Type: scopes.FilterString},
+		"sku":                 {Column: "sku", Type: scopes.FilterString},
+		"price":               {Column: "price", Type: scopes.FilterMoney},
+		"stock_quantity":      {Column: "stock_quantity", Type: scopes.FilterNumber},
+		"low_stock_threshold": {Column: "low_stock_threshold", Type: scopes.FilterNumber},
+		"created_at":          {Column: "created_at", Type: scopes.FilterTime},
+	}
+)
+
+// parseFilter reads the optional ?filter= expression over the given fields
+func parseFilter(c *gin.Context, fields scopes.FilterFields) (scopes.Filter, bool) {
+	filter, err := scopes.ParseFilter(c.Query("filter"), fields)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_filter", err.Error())
+		return filter, false
+	}
+	return filter, true
+}
+
+// orderFilters narrow order lists by when the order was placed, its amount
+// and its item, and by a ?filter= expression
+type orderFilters struct {
+	placedFrom, placedTo time.Time
+	minAmount, maxAmount *models.Money
+	item                 string
+	expression           scopes.Filter
+}
+
+// parseOrderFilters reads ?from= and ?to= (the order time, in the formats
+// parseCreatedRange takes), ?min_amount= and ?max_amount= (inclusive),
+// ?item=, matched case insensitively anywhere in the item, and ?filter=
+// over fields
+func parseOrderFilters(c *gin.Context, fields scopes.FilterFields) (orderFilters, bool) {
+	var filters orderFilters
+
+	var ok bool
+	filters.placedFrom, filters.placedTo, ok = parseTimeRange(c, "from", "to")
+	if !ok {
+		return filters, false
+	}
+
+	for _, bound := range []struct {
+		param string
+		value **models.Money
+	}{
+		{"min_amount", &filters.minAmount},
+		{"max_amount", &filters.maxAmount},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		amount, err := strconv.ParseFloat(raw, 64)
+		if err != nil || amount < 0 || math.IsInf(amount, 0) || math.IsNaN(amount) {
+			respond.Error(c, http.StatusBadRequest, "invalid_range", bound.param+" must be a non-negative number")
+			return filters, false
+		}
+		value := models.Shillings(amount)
+		*bound.value = &value
+	}
+	if filters.minAmount != nil && filters.maxAmount != nil && *filters.minAmount > *filters.maxAmount {
+		respond.Error(c, http.StatusBadRequest, "invalid_range", "min_amount must not be above max_amount")
+		return filters, false
+	}
+
+	filters.item = strings.TrimSpace(c.Query("item"))
+	filters.expression, ok = parseFilter(c, fields)
+	return filters, ok
+}
+
+// scope applies the filters to a query on orders or archived orders
+func (f orderFilters) scope(db *gorm.DB) *gorm.DB {
+	if !f.placedFrom.IsZero() {
+		db = db.Where("time >= ?", f.placedFrom)
+	}
+	if !f.placedTo.IsZero() {
+		db = db.Where("time < ?", f.placedTo)
+	}
+	if f.minAmount != nil {
+		db = db.Where("amount >= ?", *f.minAmount)
+	}
+	if f.maxAmount != nil {
+		db = db.Where("amount <= ?", *f.maxAmount)
+	}
+	if f.item != "" {
+		db = db.Where("LOWER(item) LIKE ? "+scopes.LikeEscape, "%"+scopes.EscapeLike(strings.ToLower(f.item))+"%")
+	}
+	return f.expression.Scope(db)
+}
+
+func parseTimeOrDate(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse(time.DateOnly, raw)
+	return t, true, err
+}
+
+// parseSLAFilter reads ?sla=, which may only be breached
+func parseSLAFilter(c *gin.Context) (bool, bool) {
+	sla := c.Query("sla")
+	if sla != "" && sla != "breached" {
+		respond.Error(c, http.StatusBadRequest, "invalid_sla_filter", "sla must be breached")
+		return false, false
+	}
+	return sla == "breached", true
+}
+
+// slaBreached narrows orders to those that missed their SLA, including
+// orders past their deadline that the checker has not flagged yet
+func slaBreached(db *gorm.DB) *gorm.DB {
+	return db.Where("(sla_breached_at IS NOT NULL OR (sla_deadline < ? AND status IN ?))",
+		time.Now(), services.SLAOpenStatuses)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type HealthHandler struct {
+	db        *gorm.DB
+	providers map[string]services.ProviderHealthChecker
+}
+
+func NewHealthHandler(db *gorm.DB, providers map[string]services.ProviderHealthChecker) *HealthHandler {
+	return &HealthHandler{
+		db:        db,
+		providers: providers,
+	}
+}
+
+// Ready reports whether the API can serve traffic. A database failure makes
+// the service unavailable; an unhealthy external provider only degrades it,
+// since notifications are sent asynchronously.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	status := "ready"
+	code := http.StatusOK
+	checks := gin.H{}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	if err := h.pingDB(ctx); err != nil {
+		status = "unavailable"
+		code = http.StatusServiceUnavailable
+		checks["database"] = gin.H{"healthy": false, "error": err.Error()}
+	} else {
+		checks["database"] = gin.H{"healthy": true}
+	}
+
+	for name, provider := range h.providers {
+		health := provider.Health()
+		if !health.Healthy && status == "ready" {
+			status = "degraded"
+		}
+		checks[name] = health
+	}
+
+	report := gin.H{
+		"status": status,
+		"checks": checks,
+		"build":  buildinfo.Get(),
+	}
+	if code != http.StatusOK {
+		respond.ErrorWithDetails(c, code, "unavailable", "service unavailable", report)
+		return
+	}
+	respond.OK(c, code, report)
+}
+
+func (h *HealthHandler) pingDB(ctx context.Context) error {
+	sqlDB, err := h.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// Version reports which build is serving, so a deployment can be checked
+// without access to its logs
+func (h *HealthHandler) Version(c *gin.Context) {
+	respond.OK(c, http.StatusOK, buildinfo.Get())
+}
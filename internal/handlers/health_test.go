@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubProvider struct {
+	health services.ProviderHealth
+}
+
+func (s stubProvider) Health() services.ProviderHealth {
+	return s.health
+}
+
+func TestReady(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		provider       stubProvider
+		expectedStatus string
+	}{
+		{
+			name:           "all dependencies healthy",
+			provider:       stubProvider{services.ProviderHealth{Healthy: true, State: services.CircuitClosed}},
+			expectedStatus: "ready",
+		},
+		{
+			name:           "sms provider circuit open",
+			provider:       stubProvider{services.ProviderHealth{Healthy: false, State: services.CircuitOpen}},
+			expectedStatus: "degraded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			handler := NewHealthHandler(db, map[string]services.ProviderHealthChecker{
+				"sms_provider": tt.provider,
+			})
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/health/ready", nil)
+
+			handler.Ready(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+			assert.Equal(t, tt.expectedStatus, response["status"])
+			assert.Contains(t, response["checks"], "sms_provider")
+			assert.Contains(t, response["checks"], "database")
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthHandler(testutil.DB(t), nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/version", nil)
+
+	handler.Version(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response buildinfo.Info
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+	assert.Equal(t, runtime.Version(), response.GoVersion)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// IdentityHandler lets admins see which identity provider accounts sign in
+// as which user, and move an account to another user
+type IdentityHandler struct {
+	identities *services.IdentityStore
+	audit      services.AuditRecorder
+}
+
+func NewIdentityHandler(identities *services.IdentityStore) *IdentityHandler {
+	return &IdentityHandler{identities: identities}
+}
+
+// WithAudit records identities moved to another user
+func (h *IdentityHandler) WithAudit(audit services.AuditRecorder) *IdentityHandler {
+	h.audit = audit
+	return h
+}
+
+// GetIdentities lists linked identities, optionally those of ?email=
+func (h *IdentityHandler) GetIdentities(c *gin.Context) {
+	identities, err := h.identities.List(c.Request.Context(), c.Query("email"))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve identities")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, identities, gin.H{"total": len(identities)})
+}
+
+// UpdateIdentity points an identity at another user, e.g. to make a
+// person's Azure AD account sign in as the user their Google account made
+func (h *IdentityHandler) UpdateIdentity(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid identity id")
+		return
+	}
+	var req models.UpdateUserIdentityRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	identity, err := h.identities.Relink(c.Request.Context(), uint(id), req.Email)
+	if err != nil {
+		if errors.Is(err, services.ErrIdentityNotFound) {
+			respond.Error(c, http.StatusNotFound, "identity_not_found", "identity not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to update identity")
+		return
+	}
+	if h.audit != nil {
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditIdentityRelinked,
+			Actor:     middleware.CurrentUserEmail(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   fmt.Sprintf("identity=%d provider=%s subject=%s email=%s", identity.ID, identity.Provider, identity.Subject, identity.Email),
+		})
+	}
+
+	respond.OK(c, http.StatusOK, identity)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+// reserveStock atomically takes quantity units of a product out of stock.
+// The conditional update keeps concurrent orders from overselling.
+func reserveStock(tx *gorm.DB, productID uint, quantity int) (models.Product, error) {
+	var product models.Product
+
+	result := tx.Model(&models.Product{}).
+		Where("id = ? AND stock_quantity >= ?", productID, quantity).
+		Update("stock_quantity", gorm.Expr("stock_quantity - ?", quantity))
+	if result.Error != nil {
+		return product, result.Error
+	}
+
+	if err := tx.First(&product, productID).Error; err != nil {
+		return product, err
+	}
+
+	if result.RowsAffected == 0 {
+		return product, errInsufficientStock
+	}
+	return product, nil
+}
+
+// restoreStock puts quantity units of a product back into stock
+func restoreStock(tx *gorm.DB, productID uint, quantity int) error {
+	return tx.Model(&models.Product{}).
+		Where("id = ?", productID).
+		Update("stock_quantity", gorm.Expr("stock_quantity + ?", quantity)).Error
+}
+
+func (h *OrderHandler) sendLowStockAlert(ctx context.Context, product models.Product) error {
+	message := fmt.Sprintf("low stock alert: %s (sku %s) has %d units left",
+		product.Name, product.SKU, product.StockQuantity)
+
+	result, err := h.smsService.SendBulkSMS(ctx, h.adminPhones, message)
+	if err != nil {
+		log.Printf("failed to send low stock alert for product %s: %v", product.SKU, err)
+		return err
+	}
+
+	log.Printf("low stock alert sent for product %s to %d of %d admins", product.SKU, result.SentCount(), len(result.Recipients))
+	return nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/jobs"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// JobHandler lets admins see how background jobs are doing and run one
+// without waiting for its interval
+type JobHandler struct {
+	db        *gorm.DB
+	scheduler *jobs.Scheduler
+	history   *services.JobHistory
+	audit     services.AuditRecorder
+}
+
+func NewJobHandler(db *gorm.DB, scheduler *jobs.Scheduler) *JobHandler {
+	return &JobHandler{db: db, scheduler: scheduler, history: services.NewJobHistory(db)}
+}
+
+// WithAudit records jobs run by admins
+func (h *JobHandler) WithAudit(audit services.AuditRecorder) *JobHandler {
+	h.audit = audit
+	return h
+}
+
+// GetJobs lists the registered jobs with their last run, from any
+// instance, and when this instance runs them next
+func (h *JobHandler) GetJobs(c *gin.Context) {
+	last, err := h.history.Last(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve jobs")
+		return
+	}
+
+	statuses := h.scheduler.Jobs()
+	result := make([]models.JobStatus, 0, len(statuses))
+	for _, status := range statuses {
+		result = append(result, jobStatus(status, last))
+	}
+	respond.OKWithMeta(c, http.StatusOK, result, gin.H{"total": len(result)})
+}
+
+// RunJob starts a run of the job in the background. GET /jobs/:name/runs
+// shows how it went.
+func (h *JobHandler) RunJob(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.scheduler.RunNow(name); err != nil {
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			respond.Error(c, http.StatusNotFound, "job_not_found", "job not found")
+		case errors.Is(err, jobs.ErrJobRunning):
+			respond.Error(c, http.StatusConflict, "job_running", "job is already running")
+		default:
+			respond.ServerError(c, err, "internal_error", "failed to run job")
+		}
+		return
+	}
+
+	if h.audit != nil {
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditJobTriggered,
+			Actor:     middleware.CurrentUserEmail(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   "job=" + name,
+		})
+	}
+
+	for _, status := range h.scheduler.Jobs() {
+		if status.Name == name {
+			respond.OK(c, http.StatusAccepted, jobStatus(status, nil))
+			return
+		}
+	}
+}
+
+// GetJobRuns lists the runs of a job newest first, filtered by ?status=
+func (h *JobHandler) GetJobRuns(c *gin.Context) {
+	name := c.Param("name")
+	if !h.registered(name) {
+		respond.Error(c, http.StatusNotFound, "job_not_found", "job not found")
+		return
+	}
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.JobRun{}).Where("job = ?", name)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve job runs")
+		return
+	}
+
+	var runs []models.JobRun
+	if err := query.Order("started_at DESC, id DESC").Scopes(scopes.Paginate(page)).Find(&runs).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve job runs")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, runs, page.MetaOf(total, len(runs)))
+}
+
+func (h *JobHandler) registered(name string) bool {
+	for _, status := range h.scheduler.Jobs() {
+		if status.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func jobStatus(status jobs.Status, last map[string]models.JobRun) models.JobStatus {
+	result := models.JobStatus{
+		Name:            status.Name,
+		IntervalSeconds: int64(status.Interval.Seconds()),
+		Scheduled:       !status.NextRunAt.IsZero(),
+		Running:         status.Running,
+	}
+	if result.Scheduled {
+		next := status.NextRunAt
+		result.NextRunAt = &next
+	}
+	if run, ok := last[status.Name]; ok {
+		result.LastRun = &run
+	}
+	return result
+}
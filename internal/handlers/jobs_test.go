@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/jobs"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+
+	scheduler := jobs.NewScheduler().WithHistory(services.NewJobHistory(db))
+	scheduler.Register(jobs.Job{Name: "order_archival", Interval: time.Hour, Run: func(ctx context.Context) error {
+		return errors.New("database is read only")
+	}})
+	scheduler.Register(jobs.Job{Name: "quote_expiry", Interval: time.Minute, Run: func(ctx context.Context) error {
+		return nil
+	}})
+	handler := NewJobHandler(db, scheduler)
+
+	router := gin.New()
+	router.GET("/admin/jobs", handler.GetJobs)
+	router.POST("/admin/jobs/:name/run", handler.RunJob)
+	router.GET("/admin/jobs/:name/runs", handler.GetJobRuns)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/jobs/order_archival/run", nil))
+	assert.Equal(t, http.StatusAccepted, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/admin/jobs/missing/run", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// the run finishes in the background
+	scheduler.Stop()
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/jobs", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var statuses []models.JobStatus
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &statuses})
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "order_archival", statuses[0].Name)
+		assert.Equal(t, int64(3600), statuses[0].IntervalSeconds)
+		assert.False(t, statuses[0].Scheduled)
+		assert.Nil(t, statuses[0].NextRunAt)
+		if assert.NotNil(t, statuses[0].LastRun) {
+			assert.Equal(t, models.JobRunFailed, statuses[0].LastRun.Status)
+			assert.Equal(t, jobs.TriggerManual, statuses[0].LastRun.Trigger)
+			assert.Equal(t, "database is read only", statuses[0].LastRun.Error)
+			assert.NotNil(t, statuses[0].LastRun.FinishedAt)
+		}
+		assert.Nil(t, statuses[1].LastRun, "quote_expiry never ran")
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/jobs/order_archival/runs?status=failed", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var runs []models.JobRun
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &runs})
+	assert.Len(t, runs, 1)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/admin/jobs/missing/runs", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxShipmentBody caps the courier payloads read
+const maxShipmentBody = 1 << 20
+
+// Results of each shipment update in a webhook
+const (
+	shipmentApplied   = "applied"
+	shipmentRecorded  = "recorded"
+	shipmentDuplicate = "duplicate"
+	shipmentNoOrder   = "order_not_found"
+)
+
+// LogisticsHandler takes shipment status webhooks from couriers, moving
+// orders along and telling customers
+type LogisticsHandler struct {
+	db       *gorm.DB
+	adapters map[string]services.LogisticsAdapter
+	notifier services.NotificationService
+	purger   services.CachePurger
+}
+
+func NewLogisticsHandler(db *gorm.DB, smsService services.SMSServiceInterface) *LogisticsHandler {
+	return &LogisticsHandler{
+		db:       db,
+		adapters: services.LogisticsAdapters(),
+		notifier: services.NewSMSNotifier(smsService),
+	}
+}
+
+// WithNotifier tells customers through notifier instead of by SMS
+func (h *LogisticsHandler) WithNotifier(notifier services.NotificationService) *LogisticsHandler {
+	h.notifier = notifier
+	return h
+}
+
+// WithCachePurger purges cached tracking pages of orders that move
+func (h *LogisticsHandler) WithCachePurger(purger services.CachePurger) *LogisticsHandler {
+	h.purger = purger
+	return h
+}
+
+type shipmentResult struct {
+	EventID string `json:"event_id"`
+	OrderID uint   `json:"order_id"`
+	Result  string `json:"result"`
+}
+
+// ShipmentStatus applies a courier's shipment updates, parsed by the
+// adapter named in ?format=. Every update is recorded; those that move the
+// order on change its status and notify the customer. It must be routed
+// behind a middleware.CallbackVerifier.
+func (h *LogisticsHandler) ShipmentStatus(c *gin.Context) {
+	format := c.Query("format")
+	adapter, ok := h.adapters[format]
+	if !ok {
+		respond.Error(c, http.StatusBadRequest, "unknown_format", fmt.Sprintf("unknown shipment format %q", format))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxShipmentBody+1))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "failed to read body")
+		return
+	}
+	if len(body) > maxShipmentBody {
+		respond.Error(c, http.StatusRequestEntityTooLarge, "payload_too_large", "shipment update is too large")
+		return
+	}
+
+	updates, err := adapter.Parse(body)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+
+	results := make([]shipmentResult, 0, len(updates))
+	for _, update := range updates {
+		result, order, err := h.applyUpdate(c.Request.Context(), format, update)
+		if err != nil {
+			log.Printf("failed to apply %s shipment event %s: %v", format, update.EventID, err)
+			// the courier retries, and events already applied are skipped then
+			respond.ServerError(c, err, "database_error", "failed to apply shipment update")
+			return
+		}
+		results = append(results, shipmentResult{EventID: update.EventID, OrderID: update.OrderID, Result: result})
+
+		if result == shipmentApplied {
+			purgeCache(c, h.purger, services.OrderCacheKey(order.ID))
+			go h.notifyCustomer(context.WithoutCancel(c.Request.Context()), order, update)
+		}
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"results": results})
+}
+
+// applyUpdate records the update and moves the order on when it should
+func (h *LogisticsHandler) applyUpdate(ctx context.Context, format string, update services.ShipmentUpdate) (string, models.Order, error) {
+	result := shipmentRecorded
+	var order models.Order
+	err := services.WithTx(ctx, h.db.WithContext(ctx), func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Customer").First(&order, update.OrderID).Error; err != nil {
+			return err
+		}
+
+		occurredAt := update.OccurredAt
+		if occurredAt.IsZero() {
+			occurredAt = time.Now()
+		}
+		event := models.ShipmentEvent{
+			OrderID:        order.ID,
+			Provider:       format,
+			EventID:        update.EventID,
+			Event:          update.Event,
+			Status:         update.Status,
+			TrackingNumber: update.TrackingNumber,
+			OccurredAt:     occurredAt,
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		if !services.AdvancesOrder(order.Status, update.Status) {
+			return nil
+		}
+		actor := "logistics:" + format
+		revision := models.OrderRevision{
+			OrderID:  order.ID,
+			Field:    "status",
+			OldValue: order.Status,
+			NewValue: update.Status,
+			Actor:    actor,
+		}
+		before := order
+		if err := tx.Model(&order).Update("status", update.Status).Error; err != nil {
+			return err
+		}
+		if err := services.AppendOrderEvents(tx, before, services.OrderStatusEvent(update.Status, actor)); err != nil {
+			return err
+		}
+		result = shipmentApplied
+		return tx.Create(&revision).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return shipmentNoOrder, order, nil
+	}
+	if _, ok := uniqueViolation(err); ok {
+		return shipmentDuplicate, order, nil
+	}
+	return result, order, err
+}
+
+func (h *LogisticsHandler) notifyCustomer(ctx context.Context, order models.Order, update services.ShipmentUpdate) {
+	message := fmt.Sprintf("hello %s, your order %s (%s) has been %s", order.Customer.Name, order.Reference(), order.Item, order.Status)
+	if order.Status == models.OrderStatusShipped && update.TrackingNumber != "" {
+		message += fmt.Sprintf(". courier tracking number: %s", update.TrackingNumber)
+	}
+
+	notification := services.Notification{
+		CustomerID: order.CustomerID,
+		OrderID:    &order.ID,
+		Phone:      order.Customer.Phone,
+		Title:      "Order " + order.Status,
+		Message:    message,
+	}
+	if err := h.notifier.Notify(ctx, notification); err != nil {
+		log.Printf("failed to notify customer of order %d: %v", order.ID, err)
+	}
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShipmentStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	notifier := services.NewMockNotifier()
+	purger := services.NewMockCachePurger()
+	handler := NewLogisticsHandler(db, services.NewMockSMSService()).WithNotifier(notifier).WithCachePurger(purger)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), Status: models.OrderStatusConfirmed, CustomerID: customer.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		format          string
+		body            string
+		expectedStatus  int
+		expectedError   string
+		expectedResults []string
+		expectedOrder   string
+	}{
+		{
+			name:            "picked up ships the order",
+			format:          "status",
+			body:            `{"event_id": "evt_1", "reference": "1", "tracking_number": "TRK1", "status": "PICKED_UP", "timestamp": "2025-09-19T10:00:00Z"}`,
+			expectedStatus:  http.StatusOK,
+			expectedResults: []string{shipmentApplied},
+			expectedOrder:   models.OrderStatusShipped,
+		},
+		{
+			name:            "retried webhook",
+			format:          "status",
+			body:            `{"event_id": "evt_1", "reference": "1", "tracking_number": "TRK1", "status": "PICKED_UP", "timestamp": "2025-09-19T10:00:00Z"}`,
+			expectedStatus:  http.StatusOK,
+			expectedResults: []string{shipmentDuplicate},
+			expectedOrder:   models.OrderStatusShipped,
+		},
+		{
+			name:            "events are applied in turn and never move the order back",
+			format:          "events",
+			body:            `{"shipment": {"id": "SHP1", "merchant_reference": "1"}, "events": [{"id": "e1", "type": "delivered", "occurred_at": "2025-09-19T12:00:00Z"}, {"id": "e2", "type": "in_transit", "occurred_at": "2025-09-19T11:00:00Z"}]}`,
+			expectedStatus:  http.StatusOK,
+			expectedResults: []string{shipmentApplied, shipmentRecorded},
+			expectedOrder:   models.OrderStatusDelivered,
+		},
+		{
+			name:            "unknown order",
+			format:          "status",
+			body:            `{"event_id": "evt_2", "reference": "999", "status": "DELIVERED"}`,
+			expectedStatus:  http.StatusOK,
+			expectedResults: []string{shipmentNoOrder},
+			expectedOrder:   models.OrderStatusDelivered,
+		},
+		{
+			name:           "unknown format",
+			format:         "xml",
+			body:           `{}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "unknown_format",
+		},
+		{
+			name:           "malformed payload",
+			format:         "status",
+			body:           `{"reference": "1"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/integrations/3pl/status?format="+tt.format, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.ShipmentStatus(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var response struct {
+				Results []shipmentResult `json:"results"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+			var results []string
+			for _, result := range response.Results {
+				results = append(results, result.Result)
+			}
+			assert.Equal(t, tt.expectedResults, results)
+
+			var stored models.Order
+			db.First(&stored, order.ID)
+			assert.Equal(t, tt.expectedOrder, stored.Status)
+		})
+	}
+
+	var events int64
+	db.Model(&models.ShipmentEvent{}).Where("order_id = ?", order.ID).Count(&events)
+	assert.Equal(t, int64(3), events)
+
+	var revisions []models.OrderRevision
+	db.Where("order_id = ?", order.ID).Order("id").Find(&revisions)
+	if assert.Len(t, revisions, 2) {
+		assert.Equal(t, "logistics:status", revisions[0].Actor)
+		assert.Equal(t, models.OrderStatusShipped, revisions[0].NewValue)
+		assert.Equal(t, "logistics:events", revisions[1].Actor)
+		assert.Equal(t, models.OrderStatusDelivered, revisions[1].NewValue)
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(notifier.Sent()) == 2
+	}, time.Second, 10*time.Millisecond)
+	var messages []string
+	for _, notification := range notifier.Sent() {
+		assert.Equal(t, "+254740827150", notification.Phone)
+		messages = append(messages, notification.Message)
+	}
+	assert.ElementsMatch(t, []string{
+		"hello Sebbie Chanzu, your order 1 (laptop) has been shipped. courier tracking number: TRK1",
+		"hello Sebbie Chanzu, your order 1 (laptop) has been delivered",
+	}, messages)
+	assert.Eventually(t, func() bool {
+		return len(purger.Purged()) == 2
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/migrations"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// MigrationHandler lets admins follow schema changes in progress
+type MigrationHandler struct {
+	backfills *migrations.Runner
+}
+
+func NewMigrationHandler(db *gorm.DB) *MigrationHandler {
+	return &MigrationHandler{backfills: migrations.NewRunner(db, migrations.Backfills()...)}
+}
+
+// GetBackfills reports how far each schema backfill has got
+func (h *MigrationHandler) GetBackfills(c *gin.Context) {
+	progress, err := h.backfills.Progress(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve backfills")
+		return
+	}
+	respond.OK(c, http.StatusOK, progress)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/store"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NoteHandler serves the notes account managers keep on customers. Notes
+// are attributed to the signed in user and only they may change them.
+type NoteHandler struct {
+	notes store.NoteStore
+}
+
+func NewNoteHandler(db *gorm.DB) *NoteHandler {
+	return NewNoteHandlerWithStore(store.NewNoteStore(db))
+}
+
+// NewNoteHandlerWithStore serves notes kept in notes, such as a
+// store.MemoryNoteStore in tests
+func NewNoteHandlerWithStore(notes store.NoteStore) *NoteHandler {
+	return &NoteHandler{notes: notes}
+}
+
+func (h *NoteHandler) CreateNote(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateCustomerNoteRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	note := models.CustomerNote{
+		CustomerID: customer.ID,
+		Author:     middleware.CurrentUserEmail(c),
+		Text:       strings.TrimSpace(req.Text),
+		Pinned:     req.Pinned,
+	}
+	if note.Text == "" {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "text must not be blank")
+		return
+	}
+
+	if err := h.notes.Create(c.Request.Context(), &note); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to create note")
+		return
+	}
+
+	respond.OK(c, http.StatusCreated, note)
+}
+
+func (h *NoteHandler) GetNotes(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+
+	notes, err := h.notes.Notes(c.Request.Context(), customer.ID)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve notes")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, notes, gin.H{"total": len(notes)})
+}
+
+func (h *NoteHandler) UpdateNote(c *gin.Context) {
+	note, ok := h.findOwnNote(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateCustomerNoteRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	if req.Text != nil {
+		note.Text = strings.TrimSpace(*req.Text)
+		if note.Text == "" {
+			respond.Error(c, http.StatusBadRequest, "invalid_request", "text must not be blank")
+			return
+		}
+	}
+	if req.Pinned != nil {
+		note.Pinned = *req.Pinned
+	}
+
+	if err := h.notes.Save(c.Request.Context(), &note); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to update note")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, note)
+}
+
+func (h *NoteHandler) DeleteNote(c *gin.Context) {
+	note, ok := h.findOwnNote(c)
+	if !ok {
+		return
+	}
+
+	if err := h.notes.Delete(c.Request.Context(), &note); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to delete note")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "note deleted successfully"})
+}
+
+// SearchNotes finds notes containing ?q= (case insensitive) across all
+// customers, optionally narrowed by ?customer_id=, ?author= and the
+// created range
+func (h *NoteHandler) SearchNotes(c *gin.Context) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		respond.Error(c, http.StatusBadRequest, "invalid_query", "q is required")
+		return
+	}
+
+	customerID, ok := parseCustomerFilter(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+
+	search := store.NoteSearch{
+		Text:        q,
+		CustomerID:  customerID,
+		Author:      c.Query("author"),
+		CreatedFrom: from,
+		CreatedTo:   to,
+	}
+	notes, total, err := h.notes.Search(c.Request.Context(), search, page)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to search notes")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, notes, page.Meta(total))
+}
+
+func (h *NoteHandler) findCustomer(c *gin.Context) (models.Customer, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return models.Customer{}, false
+	}
+
+	customer, err := h.notes.Customer(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return customer, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return customer, false
+	}
+	return customer, true
+}
+
+// findOwnNote loads the note named by :id and :noteId, refusing notes
+// written by someone else
+func (h *NoteHandler) findOwnNote(c *gin.Context) (models.CustomerNote, bool) {
+	customerID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return models.CustomerNote{}, false
+	}
+	noteID, err := strconv.ParseUint(c.Param("noteId"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid note id")
+		return models.CustomerNote{}, false
+	}
+
+	note, err := h.notes.Note(c.Request.Context(), uint(customerID), uint(noteID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "note_not_found", "note not found")
+			return note, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve note")
+		return note, false
+	}
+
+	if !strings.EqualFold(note.Author, middleware.CurrentUserEmail(c)) {
+		respond.Error(c, http.StatusForbidden, "forbidden", "only the author can change a note")
+		return note, false
+	}
+	return note, true
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/store"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomerNotes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewNoteHandler(db)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		customerID     string
+		noteID         string
+		user           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "create note",
+			method:         "POST",
+			customerID:     "1",
+			user:           "manager@example.com",
+			body:           `{"text": "Called about the late laptop delivery"}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "create pinned note",
+			method:         "POST",
+			customerID:     "1",
+			user:           "other@example.com",
+			body:           `{"text": "Prefers SMS over calls", "pinned": true}`,
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "blank text",
+			method:         "POST",
+			customerID:     "1",
+			user:           "manager@example.com",
+			body:           `{"text": "   "}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+		{
+			name:           "customer not found",
+			method:         "POST",
+			customerID:     "999",
+			user:           "manager@example.com",
+			body:           `{"text": "hello"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+		},
+		{
+			name:           "author updates note",
+			method:         "PUT",
+			customerID:     "1",
+			noteID:         "1",
+			user:           "manager@example.com",
+			body:           `{"text": "Called about the late laptop delivery, refund agreed"}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "someone else cannot update",
+			method:         "PUT",
+			customerID:     "1",
+			noteID:         "1",
+			user:           "other@example.com",
+			body:           `{"pinned": true}`,
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "forbidden",
+		},
+		{
+			name:           "note of another customer",
+			method:         "DELETE",
+			customerID:     "2",
+			noteID:         "1",
+			user:           "manager@example.com",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "note_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest(tt.method, "/customers/"+tt.customerID+"/notes", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}, {Key: "noteId", Value: tt.noteID}}
+			middleware.SetCurrentUser(c, &models.Claims{Email: tt.user})
+
+			switch tt.method {
+			case "POST":
+				handler.CreateNote(c)
+			case "PUT":
+				handler.UpdateNote(c)
+			case "DELETE":
+				handler.DeleteNote(c)
+			}
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var note models.CustomerNote
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &note})
+			assert.Equal(t, tt.user, note.Author)
+			assert.Equal(t, customer.ID, note.CustomerID)
+		})
+	}
+
+	// pinned notes come first
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/customers/1/notes", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+	handler.GetNotes(c)
+
+	var notes []models.CustomerNote
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &notes})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, notes, 2)
+	assert.True(t, notes[0].Pinned)
+	assert.Equal(t, "Called about the late laptop delivery, refund agreed", notes[1].Text)
+
+	// and are shown with the customer
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/customers/1", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+	NewCustomerHandler(db).GetCustomer(c)
+
+	var withNotes models.Customer
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &withNotes})
+	assert.Len(t, withNotes.Notes, 2)
+	assert.True(t, withNotes.Notes[0].Pinned)
+}
+
+func TestSearchNotes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	notes := store.NewMemoryNoteStore()
+	handler := NewNoteHandlerWithStore(notes)
+
+	ctx := context.Background()
+	notes.Create(ctx, &models.CustomerNote{CustomerID: 1, Author: "manager@example.com", Text: "Refund agreed after call"})
+	notes.Create(ctx, &models.CustomerNote{CustomerID: 2, Author: "other@example.com", Text: "asked about REFUND policy"})
+	notes.Create(ctx, &models.CustomerNote{CustomerID: 2, Author: "other@example.com", Text: "100% happy with delivery"})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedTotal  int64
+	}{
+		{name: "case insensitive", query: "q=refund", expectedStatus: http.StatusOK, expectedTotal: 2},
+		{name: "by customer", query: "q=refund&customer_id=2", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "by author", query: "q=refund&author=manager@example.com", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "wildcards are literal", query: "q=%25", expectedStatus: http.StatusOK, expectedTotal: 1},
+		{name: "query required", query: "", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/notes?"+tt.query, nil)
+
+			handler.SearchNotes(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var notes []models.CustomerNote
+			var meta models.PageMeta
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &notes, Meta: &meta})
+			assert.Equal(t, tt.expectedTotal, meta.Total)
+			assert.Len(t, notes, int(tt.expectedTotal))
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultResendLimit  = 3
+	defaultResendWindow = time.Hour
+)
+
+// WithResendLimit caps manual notification resends to limit per order
+// within window
+func (h *OrderHandler) WithResendLimit(limit int, window time.Duration) *OrderHandler {
+	if limit > 0 {
+		h.resendLimit = limit
+	}
+	if window > 0 {
+		h.resendWindow = window
+	}
+	return h
+}
+
+// ResendOrderNotification sends the order confirmation SMS again, to the
+// customer or to an alternate number, and records the attempt
+func (h *OrderHandler) ResendOrderNotification(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var req models.ResendNotificationRequest
+	if c.Request.ContentLength != 0 {
+		if err := respond.BindJSON(c, &req); err != nil {
+			respond.BindError(c, err)
+			return
+		}
+	}
+
+	var order models.Order
+	if err := db.Preload("Customer").First(&order, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve order")
+		return
+	}
+
+	// failed confirmations recorded by the system do not count towards the limit
+	since := time.Now().Add(-h.resendWindow)
+	var recent []models.NotificationAttempt
+	err = db.Where("order_id = ? AND requested_by <> ? AND created_at >= ?", order.ID, models.NotificationRequestedBySystem, since).
+		Order("created_at ASC").Find(&recent).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to check previous resends")
+		return
+	}
+	if len(recent) >= h.resendLimit {
+		retryAfter := time.Until(recent[0].CreatedAt.Add(h.resendWindow))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		respond.Error(c, http.StatusTooManyRequests, "resend_limit_reached", fmt.Sprintf("at most %d resends per order every %s", h.resendLimit, h.resendWindow))
+		return
+	}
+
+	recipient := order.Customer.Phone
+	if req.Phone != "" {
+		recipient = req.Phone
+	}
+
+	attempt := models.NotificationAttempt{
+		OrderID:     order.ID,
+		Recipient:   recipient,
+		Status:      models.NotificationStatusSent,
+		RequestedBy: middleware.CurrentUserEmail(c),
+	}
+
+	sendErr := h.smsService.SendSMS(c.Request.Context(), recipient, h.orderNotificationMessage(order.Customer, order))
+	if sendErr != nil {
+		attempt.Status = models.NotificationStatusFailed
+		attempt.Error = sendErr.Error()
+	}
+
+	if err := db.Create(&attempt).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to record notification attempt")
+		return
+	}
+
+	if sendErr != nil {
+		respond.Error(c, http.StatusBadGateway, "sms_failed", "failed to resend order notification")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, attempt)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingSMSService struct{}
+
+func (failingSMSService) SendSMS(ctx context.Context, to, message string) error {
+	return errors.New("provider unavailable")
+}
+
+func (failingSMSService) SendBulkSMS(ctx context.Context, recipients []string, message string) (services.BulkSMSResult, error) {
+	return services.BulkSMSResult{}, errors.New("provider unavailable")
+}
+
+func TestResendOrderNotification(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	handler := NewOrderHandler(db, mockSMSService).WithResendLimit(2, time.Hour)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		orderID           string
+		body              string
+		expectedStatus    int
+		expectedError     string
+		expectedRecipient string
+	}{
+		{
+			name:              "resend to customer",
+			orderID:           "1",
+			expectedStatus:    http.StatusOK,
+			expectedRecipient: "+254740827150",
+		},
+		{
+			name:              "resend to alternate number",
+			orderID:           "1",
+			body:              `{"phone": "+254711111111"}`,
+			expectedStatus:    http.StatusOK,
+			expectedRecipient: "+254711111111",
+		},
+		{
+			name:           "resend limit reached",
+			orderID:        "1",
+			expectedStatus: http.StatusTooManyRequests,
+			expectedError:  "resend_limit_reached",
+		},
+		{
+			name:           "order not found",
+			orderID:        "999",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "order_not_found",
+		},
+		{
+			name:           "invalid phone",
+			orderID:        "1",
+			body:           `{"phone": "123"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			req, _ := http.NewRequest("POST", "/orders/"+tt.orderID+"/notifications/resend", bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+			c.Params = []gin.Param{{Key: "id", Value: tt.orderID}}
+			middleware.SetCurrentUser(c, &models.Claims{Email: "admin@example.com"})
+
+			handler.ResendOrderNotification(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				if tt.expectedStatus == http.StatusTooManyRequests {
+					assert.NotEmpty(t, w.Header().Get("Retry-After"))
+				}
+			} else {
+				var attempt models.NotificationAttempt
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &attempt})
+				assert.Equal(t, tt.expectedRecipient, attempt.Recipient)
+				assert.Equal(t, models.NotificationStatusSent, attempt.Status)
+				assert.Equal(t, "admin@example.com", attempt.RequestedBy)
+
+				last := mockSMSService.SentMessages[len(mockSMSService.SentMessages)-1]
+				assert.Equal(t, tt.expectedRecipient, last.To)
+				assert.Contains(t, last.Message, "laptop")
+			}
+		})
+	}
+}
+
+func TestResendOrderNotificationRecordsFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, failingSMSService{})
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID}
+	db.Create(&order)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/orders/1/notifications/resend", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+	handler.ResendOrderNotification(c)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+
+	var attempt models.NotificationAttempt
+	db.Where("order_id = ?", order.ID).First(&attempt)
+	assert.Equal(t, models.NotificationStatusFailed, attempt.Status)
+	assert.Equal(t, "provider unavailable", attempt.Error)
+}
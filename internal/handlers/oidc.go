@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// DefaultOIDCProvider names the provider set with OIDC_PROVIDER_URL and
+// friends, from before several could be configured
+const DefaultOIDCProvider = "default"
+
+var oidcProviderName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// OIDCProviderConfig is one identity provider staff can sign in with
+type OIDCProviderConfig struct {
+	// Name picks the provider in /auth/login?provider= and its callback,
+	// /auth/callback/{name}
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+}
+
+// OIDCProvidersFromEnv reads the providers listed in OIDC_PROVIDERS, e.g.
+// "google,microsoft", each from OIDC_<NAME>_ISSUER, _CLIENT_ID,
+// _CLIENT_SECRET and _REDIRECT_URI. The redirect URI defaults to
+// PUBLIC_BASE_URL/auth/callback/<name>. A provider set the old way, with
+// OIDC_PROVIDER_URL, comes first as "default". Providers missing settings
+// are left out and reported in the error.
+func OIDCProvidersFromEnv() ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+	var errs []error
+
+	legacy := OIDCProviderConfig{
+		Name:         DefaultOIDCProvider,
+		Issuer:       os.Getenv("OIDC_PROVIDER_URL"),
+		ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURI:  os.Getenv("OIDC_REDIRECT_URI"),
+	}
+	if unset := legacy.unset("OIDC_PROVIDER_URL", "OIDC_CLIENT_ID", "OIDC_CLIENT_SECRET", "OIDC_REDIRECT_URI"); len(unset) == 0 {
+		providers = append(providers, legacy)
+	} else if len(unset) < 4 {
+		errs = append(errs, fmt.Errorf("oidc provider %s is missing %s", legacy.Name, strings.Join(unset, ", ")))
+	}
+
+	seen := map[string]bool{DefaultOIDCProvider: len(providers) > 0}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !oidcProviderName.MatchString(name) {
+			errs = append(errs, fmt.Errorf("invalid oidc provider name %q", name))
+			continue
+		}
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("oidc provider %s is configured twice", name))
+			continue
+		}
+		seen[name] = true
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURI:  os.Getenv(prefix + "REDIRECT_URI"),
+		}
+		if provider.RedirectURI == "" {
+			if base := strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"); base != "" {
+				provider.RedirectURI = base + "/auth/callback/" + name
+			}
+		}
+		if unset := provider.unset(prefix+"ISSUER", prefix+"CLIENT_ID", prefix+"CLIENT_SECRET", prefix+"REDIRECT_URI"); len(unset) > 0 {
+			errs = append(errs, fmt.Errorf("oidc provider %s is missing %s", name, strings.Join(unset, ", ")))
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers, errors.Join(errs...)
+}
+
+// unset returns the names of the settings that are empty, given in the
+// order Issuer, ClientID, ClientSecret, RedirectURI
+func (p OIDCProviderConfig) unset(names ...string) []string {
+	var unset []string
+	for i, value := range []string{p.Issuer, p.ClientID, p.ClientSecret, p.RedirectURI} {
+		if value == "" {
+			unset = append(unset, names[i])
+		}
+	}
+	return unset
+}
+
+const (
+	// oidcDiscoveryTimeout bounds how long a login waits on an unreachable
+	// provider before falling back to passwords
+	oidcDiscoveryTimeout = 5 * time.Second
+	oidcMaxRetry         = 5 * time.Minute
+)
+
+// oidcProviders caches discovered providers by issuer URL for the life of
+// the process. Discovery is a round trip to the provider that neither
+// start up nor a second router should wait on.
+var oidcProviders sync.Map
+
+func discoverOIDCProvider(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	if provider, ok := oidcProviders.Load(issuer); ok {
+		return provider.(*oidc.Provider), nil
+	}
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := oidcProviders.LoadOrStore(issuer, provider)
+	return actual.(*oidc.Provider), nil
+}
+
+// oidcProvider is a configured identity provider, discovered on first use
+type oidcProvider struct {
+	config OIDCProviderConfig
+
+	mu           sync.Mutex
+	enabled      bool
+	verifier     *oidc.IDTokenVerifier
+	oauth2Config *oauth2.Config
+
+	// after a failed discovery the next waits retry, doubling with each
+	// further failure up to oidcMaxRetry
+	retry       time.Duration
+	failures    int
+	nextAttempt time.Time
+	health      atomic.Pointer[services.ProviderHealth]
+}
+
+func newOIDCProvider(config OIDCProviderConfig, retry time.Duration) *oidcProvider {
+	p := &oidcProvider{config: config, retry: retry}
+	p.health.Store(&services.ProviderHealth{Healthy: true, State: "pending"})
+	return p
+}
+
+// ready discovers the provider the first time it is needed. A failed
+// discovery is retried by the first login after the retry delay, so an
+// outage at start does not disable the provider for good, nor does every
+// login wait on it while it is down.
+func (p *oidcProvider) ready(ctx context.Context) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.enabled {
+		return true
+	}
+	if time.Now().Before(p.nextAttempt) {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oidcDiscoveryTimeout)
+	defer cancel()
+	provider, err := discoverOIDCProvider(ctx, p.config.Issuer)
+	if err != nil {
+		p.failures++
+		failedAt := time.Now()
+		delay := p.retryDelay()
+		p.nextAttempt = failedAt.Add(delay)
+		p.health.Store(&services.ProviderHealth{
+			Healthy:             false,
+			State:               "unreachable",
+			ConsecutiveFailures: p.failures,
+			LastFailureAt:       &failedAt,
+		})
+		log.Printf("oidc discovery of %s failed %d times, retrying in %s: %v", p.config.Name, p.failures, delay, err)
+		return false
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.config.ClientID})
+	p.oauth2Config = &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		RedirectURL:  p.config.RedirectURI,
+	}
+	p.enabled = true
+	p.failures = 0
+	p.health.Store(&services.ProviderHealth{Healthy: true, State: "ready"})
+	return true
+}
+
+func (p *oidcProvider) retryDelay() time.Duration {
+	delay := p.retry
+	for i := 1; i < p.failures && delay < oidcMaxRetry; i++ {
+		delay *= 2
+	}
+	return min(delay, oidcMaxRetry)
+}
+
+// oidcHealthRank orders provider states from best to worst, so the
+// handler reports the worst of its providers
+var oidcHealthRank = map[string]int{"ready": 0, "pending": 1, "unreachable": 2}
+
+func worseOIDCHealth(a, b services.ProviderHealth) services.ProviderHealth {
+	if oidcHealthRank[b.State] > oidcHealthRank[a.State] {
+		return b
+	}
+	return a
+}
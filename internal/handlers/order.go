@@ -1,280 +1,630 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
 	"github.com/SebbieMzingKe/customer-order-api/internal/services"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var errCustomerNotFound = errors.New("customer not found")
+
 type OrderHandler struct {
-	db         *gorm.DB
-	smsService services.SMSServiceInterface
+	db          *gorm.DB
+	smsService  services.SMSServiceInterface
+	notifier    services.NotificationService
+	tracking    *services.TrackingService
+	adminPhones []string
+
+	resendLimit  int
+	resendWindow time.Duration
+	sla          services.SLAPolicy
+	tax          services.TaxPolicy
+	numbers      services.OrderNumberPolicy
+	smsLength    services.SMSLengthPolicy
+	sagas        *services.SagaCoordinator
+	promos       *services.PromoCodeService
+	purger       services.CachePurger
+	quoteHold    time.Duration
 }
 
 func NewOrderHandler(db *gorm.DB, smsService services.SMSServiceInterface) *OrderHandler {
 	return &OrderHandler{
-		db:         db,
-		smsService: smsService,
+		db:           db,
+		smsService:   smsService,
+		notifier:     services.NewSMSNotifier(smsService),
+		resendLimit:  defaultResendLimit,
+		resendWindow: defaultResendWindow,
+		sla:          services.DefaultSLAPolicy(),
+		tax:          services.DefaultTaxPolicy(),
+		numbers:      services.DefaultOrderNumberPolicy(),
+		sagas:        services.NewSagaCoordinator(db),
+		promos:       services.NewPromoCodeService(db),
+		quoteHold:    services.DefaultQuoteHold,
 	}
 }
 
+// WithTaxPolicy sets the VAT applied to new orders
+func (h *OrderHandler) WithTaxPolicy(policy services.TaxPolicy) *OrderHandler {
+	h.tax = policy
+	return h
+}
+
+// WithOrderNumbers sets how new orders are numbered
+func (h *OrderHandler) WithOrderNumbers(policy services.OrderNumberPolicy) *OrderHandler {
+	h.numbers = policy.WithDefaults()
+	return h
+}
+
+// WithSMSLengthPolicy sends the short order confirmation when the full one
+// would take more segments than the policy allows
+func (h *OrderHandler) WithSMSLengthPolicy(policy services.SMSLengthPolicy) *OrderHandler {
+	h.smsLength = policy
+	return h
+}
+
+// WithSLAPolicy sets the shipping deadlines given to new orders
+func (h *OrderHandler) WithSLAPolicy(policy services.SLAPolicy) *OrderHandler {
+	h.sla = policy.WithDefaults()
+	return h
+}
+
+// WithLowStockAlerts sends an SMS to the given admin numbers whenever an
+// order takes a product to or below its low stock threshold
+func (h *OrderHandler) WithLowStockAlerts(adminPhones []string) *OrderHandler {
+	h.adminPhones = adminPhones
+	return h
+}
+
+// WithNotifier sends order notifications through notifier instead of
+// texting them
+func (h *OrderHandler) WithNotifier(notifier services.NotificationService) *OrderHandler {
+	h.notifier = notifier
+	return h
+}
+
+// WithCachePurger purges the CDN's copies of tracking pages and catalog
+// entries the order changes
+func (h *OrderHandler) WithCachePurger(purger services.CachePurger) *OrderHandler {
+	h.purger = purger
+	return h
+}
+
+// WithTracking enables tracking links in order confirmation messages
+func (h *OrderHandler) WithTracking(tracking *services.TrackingService) *OrderHandler {
+	h.tracking = tracking
+	return h
+}
+
 func (h *OrderHandler) CreateOrder(c *gin.Context) {
 	var req models.CreateOrderRequest
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
 		return
 	}
 
+	h.createOrder(c, req)
+}
+
+// createOrder validates an order request and places it for its customer
+func (h *OrderHandler) createOrder(c *gin.Context, req models.CreateOrderRequest) {
 	if req.Item == "" || req.Amount <= 0 || req.CustomerID == 0 {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: "missing or invalid fields",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "missing or invalid fields")
 		return
 	}
 
-	var customer models.Customer
+	quantity := req.Quantity
+	if quantity == 0 {
+		quantity = 1
+	}
 
-	if err := h.db.First(&customer, req.CustomerID).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "customer not found",
-				Message: "customer not found",
-				Code:    http.StatusNotFound,
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to verify customer",
-			Code:    http.StatusInternalServerError,
-		})
-		return
+	priority := req.Priority
+	if priority == "" {
+		priority = models.OrderPriorityNormal
 	}
 
 	order := models.Order{
-		Item:       req.Item,
-		Amount:     req.Amount,
-		Time:       req.Time,
-		CustomerID: req.CustomerID,
-	}
-
-	if err := h.db.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to create order",
-			Code:    http.StatusInternalServerError,
-		})
+		Item:                 req.Item,
+		Amount:               req.Amount,
+		Time:                 req.Time,
+		CustomerID:           req.CustomerID,
+		ProductID:            req.ProductID,
+		Quantity:             quantity,
+		Priority:             priority,
+		DeliveryInstructions: req.DeliveryInstructions,
+	}
+	if req.PromoCode != "" {
+		order.PromoCode = &req.PromoCode
+	}
+	h.placeOrder(c, order, nil)
+}
+
+// placeOrder inserts a new order for its customer, taking its stock, and
+// starts the saga that sends its notifications. The customer is checked in
+// the same transaction, so an order is never left without one, and gives
+// the order its delivery instructions if it has none. An order with a promo
+// code has its discount taken off and the code's use recorded in that
+// transaction too. An order confirming a quote claims it in that
+// transaction instead, keeping the quote's stock and price. It writes the
+// response.
+func (h *OrderHandler) placeOrder(c *gin.Context, order models.Order, quote *models.Quote) {
+	db := h.db.WithContext(c.Request.Context())
+
+	deadline := h.sla.Deadline(order.Priority, time.Now())
+	order.Status = models.OrderStatusPending
+	order.SLADeadline = &deadline
+	if quote == nil {
+		h.tax.Apply(&order)
+	} else {
+		services.RecalculateTax(&order)
+	}
+
+	var customer models.Customer
+	var product models.Product
+	var redemption models.PromoRedemption
+	err := services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&customer, order.CustomerID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errCustomerNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if order.DeliveryInstructions == "" {
+			order.DeliveryInstructions = customer.DeliveryInstructions
+		}
+		if order.PromoCode != nil {
+			if redemption, err = h.promos.Apply(tx, *order.PromoCode, &order); err != nil {
+				return err
+			}
+			h.tax.Apply(&order)
+		}
+
+		switch {
+		case quote != nil:
+			if err := claimQuote(tx, quote); err != nil {
+				return err
+			}
+			// the stock was taken when the quote was made
+			if order.ProductID != nil {
+				if err := tx.Unscoped().First(&product, *order.ProductID).Error; err != nil {
+					return err
+				}
+			}
+		case order.ProductID != nil:
+			if product, err = reserveStock(tx, *order.ProductID, order.Quantity); err != nil {
+				return err
+			}
+		}
+		if err := h.numbers.CreateOrder(tx, &order, time.Now()); err != nil {
+			return err
+		}
+		if order.PromoCode != nil {
+			redemption.OrderID = order.ID
+			if err := tx.Create(&redemption).Error; err != nil {
+				return err
+			}
+		}
+		if err := services.AppendOrderEvents(tx, order, services.OrderCreatedEvent(order, middleware.CurrentUserEmail(c))); err != nil {
+			return err
+		}
+		if quote != nil {
+			return tx.Model(quote).Update("order_id", order.ID).Error
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errCustomerNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return
+		}
+		if errors.Is(err, errInsufficientStock) {
+			respond.Error(c, http.StatusConflict, "insufficient_stock", fmt.Sprintf("only %d units of %s in stock", product.StockQuantity, product.Name))
+			return
+		}
+		if errors.Is(err, errQuoteExpired) {
+			respond.Error(c, http.StatusGone, "quote_expired", "quote has expired")
+			return
+		}
+		if errors.Is(err, errQuoteNotHeld) {
+			respond.Error(c, http.StatusConflict, "quote_not_held", fmt.Sprintf("quote is %s", quote.Status))
+			return
+		}
+		if promoCodeError(c, err) {
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "product_not_found", "product not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to create order")
 		return
 	}
 
 	order.Customer = customer
 
-	go h.sendOrderNotification(customer, order)
+	// the steps after the commit run as a saga, so a confirmation that fails
+	// is recorded for resending instead of only being logged
+	actions := []services.SagaAction{
+		{Name: services.SagaStepCreateOrder, Critical: true},
+		{Name: services.SagaStepNotifyCustomer, Run: func(ctx context.Context) error {
+			return h.sendOrderNotification(ctx, customer, order)
+		}},
+	}
+	if order.ProductID != nil && product.IsLowStock() && len(h.adminPhones) > 0 {
+		actions = append(actions, services.SagaAction{Name: services.SagaStepLowStockAlert, Run: func(ctx context.Context) error {
+			return h.sendLowStockAlert(ctx, product)
+		}})
+	}
+
+	// notifications outlive the request, so keep its values but not its cancellation
+	notifyCtx := context.WithoutCancel(c.Request.Context())
+	go h.runOrderSaga(notifyCtx, order.ID, actions)
 
-	c.JSON(http.StatusCreated, order)
+	if order.ProductID != nil {
+		purgeCache(c, h.purger, services.ProductCacheKey(*order.ProductID))
+	}
+	respond.Created(c, fmt.Sprintf("/api/v1/orders/%d", order.ID), order.ID, order.UpdatedAt, order)
 }
 
 func (h *OrderHandler) GetOrders(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	customerID := c.Query("customer_id")
-	if page < 1 {
-		page = 1
+	db := h.db.WithContext(c.Request.Context())
+
+	customerID, ok := parseCustomerFilter(c)
+	if !ok {
+		return
+	}
+
+	h.listOrders(c, db, customerID)
+}
+
+// listOrders responds with a page of orders, narrowed to one customer when
+// customerID is set and by the list filters in the query
+func (h *OrderHandler) listOrders(c *gin.Context, db *gorm.DB, customerID uint) {
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filters, ok := parseOrderFilters(c, orderFilterFields)
+	if !ok {
+		return
+	}
+
+	breached, ok := parseSLAFilter(c)
+	if !ok {
+		return
+	}
+
+	fields, err := orderFields.parse(c)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_fields", err.Error())
+		return
 	}
-	offset := (page - 1) * limit
 
 	var orders []models.Order
-	var total int64
-	query := h.db.Model(&models.Order{})
+	query := db.Model(&models.Order{}).Scopes(scopes.ByCustomer(customerID), scopes.CreatedBetween(from, to), filters.scope)
+	if breached {
+		query = query.Scopes(slaBreached)
+	}
 
-	if customerID != "" {
-		query = query.Where("customer_id = ?", customerID)
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve orders")
+		return
 	}
 
-	query.Count(&total)
+	if fields != nil {
+		query = query.Select(orderFields.selectColumns(fields))
+	}
 
-	if err := query.Preload("Customer").Offset(offset).Limit(limit).Find(&orders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve orders",
-			Code:    http.StatusInternalServerError,
-		})
+	if err := query.Scopes(scopes.Paginate(page)).Find(&orders).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve orders")
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"orders": orders,
-		"total":  total,
-		"page":   page,
-		"limit":  limit,
-	})
+
+	result := make([]models.OrderSummary, len(orders))
+	for i, order := range orders {
+		result[i].Order = order
+	}
+	if wantsField(fields, "customer") {
+		if err := summarizeCustomers(db, result); err != nil {
+			respond.ServerError(c, err, "database_error", "failed to retrieve orders")
+			return
+		}
+	}
+	respond.OKWithMeta(c, http.StatusOK, projectFields(result, fields), page.MetaOf(total, len(result)))
+}
+
+// summarizeCustomers loads the id, name, code and phone of the customers of
+// orders in one query, rather than preloading every customer in full
+func summarizeCustomers(db *gorm.DB, orders []models.OrderSummary) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.CustomerID)
+	}
+
+	var customers []models.CustomerSummary
+	err := db.Model(&models.Customer{}).Select("id", "name", "code", "phone").
+		Where("id IN ?", ids).Find(&customers).Error
+	if err != nil {
+		return err
+	}
+
+	byID := make(map[uint]*models.CustomerSummary, len(customers))
+	for i := range customers {
+		byID[customers[i].ID] = &customers[i]
+	}
+	for i := range orders {
+		orders[i].Customer = byID[orders[i].CustomerID]
+	}
+	return nil
 }
 
 func (h *OrderHandler) GetOrder(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid order id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
 		return
 	}
 
+	h.getOrder(c, "id = ?", id)
+}
+
+// GetOrderByNumber looks an order up by the number its customer was
+// texted, in any case
+func (h *OrderHandler) GetOrderByNumber(c *gin.Context) {
+	h.getOrder(c, "number = ?", services.NormalizeOrderNumber(c.Param("number")))
+}
+
+// getOrder responds with the order matching the condition, with the fields
+// asked for
+func (h *OrderHandler) getOrder(c *gin.Context, condition string, value interface{}) {
+	db := h.db.WithContext(c.Request.Context())
+
+	fields, err := orderFields.parse(c)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_fields", err.Error())
+		return
+	}
+
+	query := db
+	if fields != nil {
+		query = query.Select(orderFields.selectColumns(fields))
+	}
+	if wantsField(fields, "customer") {
+		query = query.Preload("Customer")
+	}
+
 	var order models.Order
-	if err := h.db.Preload("Customer").First(&order, id).Error; err != nil {
+	if err := query.Where(condition, value).First(&order).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "order not found",
-				Message: "order not found",
-				Code:    http.StatusNotFound,
-			})
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve order",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "database_error", "failed to retrieve order")
+		return
+	}
+	respond.OK(c, http.StatusOK, projectFields(order, fields))
+}
+
+// GetArchivedOrders lists orders moved to cold storage by the archival job
+func (h *OrderHandler) GetArchivedOrders(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	customerID, ok := parseCustomerFilter(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filters, ok := parseOrderFilters(c, archivedOrderFilterFields)
+	if !ok {
+		return
+	}
+
+	var orders []models.ArchivedOrder
+	query := db.Model(&models.ArchivedOrder{}).Scopes(scopes.ByCustomer(customerID), scopes.CreatedBetween(from, to), filters.scope)
+
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve archived orders")
+		return
+	}
+
+	if err := query.Order("created_at DESC").Scopes(scopes.Paginate(page)).Find(&orders).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve archived orders")
 		return
 	}
-	c.JSON(http.StatusOK, order)
+	respond.OKWithMeta(c, http.StatusOK, orders, page.MetaOf(total, len(orders)))
 }
 
 func (h *OrderHandler) UpdateOrder(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid order id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
 		return
 	}
 
 	var req models.UpdateOrderRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := respond.BindJSON(c, &req); err != nil {
 		log.Println("JSON bind error:", err)
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		})
+		respond.BindError(c, err)
 		return
 	}
 
-	if req.Amount < 0 {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid request",
-			Message: "amount cannot be negative",
-			Code:    http.StatusBadRequest,
-		})
+	if req.Amount != nil && *req.Amount < 0 {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "amount cannot be negative")
 		return
 	}
 
 	var order models.Order
-	if err := h.db.First(&order, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "order not found",
-				Message: "order not found",
-				Code:    http.StatusNotFound,
-			})
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		// locked so two requests cannot both restock a cancellation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return err
+		}
+		before := order
+
+		if req.Item != nil {
+			order.Item = *req.Item
+		}
+		if req.Amount != nil {
+			order.Amount = *req.Amount
+			services.RecalculateTax(&order)
+		}
+		if req.Time != nil {
+			order.Time = *req.Time
+		}
+		wasCancelled := order.Status == models.OrderStatusCancelled
+		if req.Status != nil {
+			order.Status = *req.Status
+		}
+		if req.EstimatedDeliveryAt.Set {
+			order.EstimatedDeliveryAt = req.EstimatedDeliveryAt.Value
+		}
+		if req.DeliveryInstructions != nil {
+			order.DeliveryInstructions = *req.DeliveryInstructions
+		}
+		isCancelled := order.Status == models.OrderStatusCancelled
+
+		if order.ProductID != nil && wasCancelled != isCancelled {
+			if isCancelled {
+				if err := restoreStock(tx, *order.ProductID, order.Quantity); err != nil {
+					return err
+				}
+			} else if _, err := reserveStock(tx, *order.ProductID, order.Quantity); err != nil {
+				return err
+			}
+		}
+		if err := tx.Save(&order).Error; err != nil {
+			return err
+		}
+
+		actor := middleware.CurrentUserEmail(c)
+		if err := services.AppendOrderEvents(tx, before, services.OrderChangeEvents(before, order, actor)...); err != nil {
+			return err
+		}
+		if revisions := orderRevisions(before, order, actor); len(revisions) > 0 {
+			return tx.Create(&revisions).Error
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		if errors.Is(err, errInsufficientStock) {
+			respond.Error(c, http.StatusConflict, "insufficient_stock", "not enough stock to reinstate this order")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve order",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "database_error", "failed to update order")
 		return
 	}
 
-	if req.Item != "" {
-		order.Item = req.Item
-	}
-	if req.Amount > 0 {
-		order.Amount = req.Amount
-	}
-	if !req.Time.IsZero() {
-		order.Time = req.Time
-	}
-
-	if err := h.db.Save(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to update order",
-			Code:    http.StatusInternalServerError,
-		})
-		return
+	keys := []string{services.OrderCacheKey(order.ID)}
+	if order.ProductID != nil {
+		keys = append(keys, services.ProductCacheKey(*order.ProductID))
 	}
+	purgeCache(c, h.purger, keys...)
 
-	h.db.Preload("Customer").First(&order, order.ID)
-	c.JSON(http.StatusOK, order)
+	db.Preload("Customer").First(&order, order.ID)
+	respond.OK(c, http.StatusOK, order)
 }
 
 func (h *OrderHandler) DeleteOrder(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error:   "invalid id",
-			Message: "invalid order id",
-			Code:    http.StatusBadRequest,
-		})
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
 		return
 	}
 
-	var order models.Order
-	if err := h.db.First(&order, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error:   "order not found",
-				Message: "order not found",
-				Code:    http.StatusNotFound,
-			})
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&order).Error; err != nil {
+			return err
+		}
+		return services.AppendOrderEvents(tx, order, services.OrderDeletedEvent(middleware.CurrentUserEmail(c)))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to retrieve order",
-			Code:    http.StatusInternalServerError,
-		})
+		respond.ServerError(c, err, "database_error", "failed to delete order")
 		return
 	}
 
-	if err := h.db.Delete(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error:   "database error",
-			Message: "failed to delete order",
-			Code:    http.StatusInternalServerError,
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{"message": "order deleted successfully"})
+	purgeCache(c, h.purger, services.OrderCacheKey(uint(id)))
+	respond.OK(c, http.StatusOK, gin.H{"message": "order deleted successfully"})
 }
 
-func (h *OrderHandler) sendOrderNotification(customer models.Customer, order models.Order) {
-	message := fmt.Sprintf("hello %s, your order for %s (amount: ksh %.2f) has been received. order time: %s. thank you for your business",
-		customer.Name, order.Item, order.Amount, order.Time.Format("2006-01-02 15:04:05"))
+func (h *OrderHandler) runOrderSaga(ctx context.Context, orderID uint, actions []services.SagaAction) {
+	saga, err := h.sagas.Run(ctx, models.SagaKindOrderCreation, orderID, actions)
+	if err != nil {
+		log.Printf("order %d saga %d ended %s: %v", orderID, saga.ID, saga.Status, err)
+	}
+}
 
-	if err := h.smsService.SendSMS(customer.Phone, message); err != nil {
-		log.Printf("failed to send sms to customer %s: %v", customer.Name, err)
-		return
+func (h *OrderHandler) sendOrderNotification(ctx context.Context, customer models.Customer, order models.Order) error {
+	notification := services.Notification{
+		CustomerID: customer.ID,
+		OrderID:    &order.ID,
+		Phone:      customer.Phone,
+		Title:      "Order received",
+		Message:    h.orderNotificationMessage(customer, order),
+	}
+	if err := h.notifier.Notify(ctx, notification); err != nil {
+		log.Printf("failed to notify customer %s: %v", customer.Name, err)
+		return err
 	}
 
-	log.Printf("sms sent successfully to customer %s", customer.Name)
+	log.Printf("notification sent successfully to customer %s", customer.Name)
+	return nil
+}
+
+func (h *OrderHandler) orderNotificationMessage(customer models.Customer, order models.Order) string {
+	message := fmt.Sprintf("hello %s, your order %s for %s (amount: ksh %s) has been received. order time: %s. thank you for your business",
+		customer.Name, order.Reference(), order.Item, order.Amount, order.Time.Format("2006-01-02 15:04:05"))
+	short := fmt.Sprintf("order %s received: %s, ksh %s", order.Reference(), order.Item, order.Amount)
+	if h.tracking != nil {
+		link := h.tracking.TrackingURL(order.ID)
+		message += fmt.Sprintf(". track your order: %s", link)
+		short += fmt.Sprintf(". track: %s", link)
+	}
+	return h.smsLength.Choose(message, short)
 }
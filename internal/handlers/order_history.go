@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetOrderHistory lists the changes made to an order through UpdateOrder,
+// oldest first
+func (h *OrderHandler) GetOrderHistory(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	// a deleted order's history is what a dispute about it needs
+	if err := db.Unscoped().Select("id").First(&models.Order{}, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve order")
+		return
+	}
+
+	var revisions []models.OrderRevision
+	if err := db.Where("order_id = ?", id).Order("created_at ASC, id ASC").Find(&revisions).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve order history")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, revisions, gin.H{"total": len(revisions)})
+}
+
+// GetOrderEvents lists the events of an order in sequence, from it being
+// created to it being deleted. Replaying them gives the order as it is.
+func (h *OrderHandler) GetOrderEvents(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var events []models.OrderEvent
+	if err := db.Where("order_id = ?", id).Order("sequence ASC").Find(&events).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve order events")
+		return
+	}
+	// archived orders no longer have a row, but keep their events
+	if len(events) == 0 {
+		if err := db.Unscoped().Select("id").First(&models.Order{}, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+				return
+			}
+			respond.ServerError(c, err, "database_error", "failed to retrieve order")
+			return
+		}
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, events, gin.H{"total": len(events)})
+}
+
+// orderRevisions returns a revision for each field that differs between
+// before and after
+func orderRevisions(before, after models.Order, actor string) []models.OrderRevision {
+	var revisions []models.OrderRevision
+	add := func(field, oldValue, newValue string) {
+		if oldValue == newValue {
+			return
+		}
+		revisions = append(revisions, models.OrderRevision{
+			OrderID:  after.ID,
+			Field:    field,
+			OldValue: oldValue,
+			NewValue: newValue,
+			Actor:    actor,
+		})
+	}
+
+	add("item", before.Item, after.Item)
+	add("amount", formatAmount(before.Amount), formatAmount(after.Amount))
+	add("time", formatRevisionTime(&before.Time), formatRevisionTime(&after.Time))
+	add("status", before.Status, after.Status)
+	add("estimated_delivery_at", formatRevisionTime(before.EstimatedDeliveryAt), formatRevisionTime(after.EstimatedDeliveryAt))
+	add("delivery_instructions", before.DeliveryInstructions, after.DeliveryInstructions)
+	return revisions
+}
+
+func formatAmount(amount models.Money) string {
+	return strconv.FormatFloat(amount.Float(), 'f', -1, 64)
+}
+
+func formatRevisionTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOrderHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	placed := time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: placed, Status: models.OrderStatusPending, CustomerID: customer.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	update := func(actor string, body models.UpdateOrderRequest) {
+		jsonBody, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("PUT", "/orders/1", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "id", Value: "1"}}
+		middleware.SetCurrentUser(c, &models.Claims{Email: actor})
+
+		handler.UpdateOrder(c)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	update("clerk@example.com", models.UpdateOrderRequest{Item: ptr("laptop"), Amount: ptr(models.Shillings(1200))})
+	update("manager@example.com", models.UpdateOrderRequest{Status: ptr(models.OrderStatusConfirmed)})
+	// nothing changes, so nothing is recorded
+	update("manager@example.com", models.UpdateOrderRequest{Item: ptr("laptop")})
+
+	tests := []struct {
+		name              string
+		orderID           string
+		expectedStatus    int
+		expectedError     string
+		expectedRevisions []models.OrderRevision
+	}{
+		{
+			name:           "changed fields with their actors",
+			orderID:        "1",
+			expectedStatus: http.StatusOK,
+			expectedRevisions: []models.OrderRevision{
+				{Field: "amount", OldValue: "1500", NewValue: "1200", Actor: "clerk@example.com"},
+				{Field: "status", OldValue: models.OrderStatusPending, NewValue: models.OrderStatusConfirmed, Actor: "manager@example.com"},
+			},
+		},
+		{
+			name:           "non-existent order",
+			orderID:        "999",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "order_not_found",
+		},
+		{
+			name:           "invalid order id",
+			orderID:        "abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_id",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/orders/"+tt.orderID+"/history", nil)
+			c.Params = []gin.Param{{Key: "id", Value: tt.orderID}}
+
+			handler.GetOrderHistory(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+
+			var revisions []models.OrderRevision
+			var meta map[string]interface{}
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &revisions, Meta: &meta})
+			assert.Equal(t, float64(len(tt.expectedRevisions)), meta["total"])
+			if assert.Len(t, revisions, len(tt.expectedRevisions)) {
+				for i, expected := range tt.expectedRevisions {
+					assert.Equal(t, order.ID, revisions[i].OrderID)
+					assert.Equal(t, expected.Field, revisions[i].Field)
+					assert.Equal(t, expected.OldValue, revisions[i].OldValue)
+					assert.Equal(t, expected.NewValue, revisions[i].NewValue)
+					assert.Equal(t, expected.Actor, revisions[i].Actor)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderRevisions(t *testing.T) {
+	placed := time.Date(2025, 9, 1, 9, 0, 0, 0, time.FixedZone("EAT", 3*60*60))
+	eta := time.Date(2025, 9, 2, 12, 0, 0, 0, time.UTC)
+	before := models.Order{ID: 7, Item: "laptop", Amount: models.Shillings(1500), Time: placed, Status: models.OrderStatusPending}
+	after := before
+	after.Time = placed.Add(time.Hour)
+	after.EstimatedDeliveryAt = &eta
+
+	revisions := orderRevisions(before, after, "clerk@example.com")
+
+	assert.Equal(t, []models.OrderRevision{
+		{OrderID: 7, Field: "time", OldValue: "2025-09-01T06:00:00Z", NewValue: "2025-09-01T07:00:00Z", Actor: "clerk@example.com"},
+		{OrderID: 7, Field: "estimated_delivery_at", OldValue: "", NewValue: "2025-09-02T12:00:00Z", Actor: "clerk@example.com"},
+	}, revisions)
+	assert.Empty(t, orderRevisions(before, before, "clerk@example.com"))
+}
+
+func TestGetOrderEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	// placed before the event log, so it has no history yet
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), Status: models.OrderStatusPending, CustomerID: customer.ID, Quantity: 1}
+	db.Create(&order)
+
+	call := func(method string, handle gin.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(method, "/orders/1", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "id", Value: "1"}}
+		middleware.SetCurrentUser(c, &models.Claims{Email: "clerk@example.com"})
+		handle(c)
+		return w
+	}
+	assert.Equal(t, http.StatusOK, call("PUT", handler.UpdateOrder, models.UpdateOrderRequest{Amount: ptr(models.Shillings(1200))}).Code)
+	assert.Equal(t, http.StatusOK, call("PUT", handler.UpdateOrder, models.UpdateOrderRequest{Status: ptr(models.OrderStatusCancelled)}).Code)
+
+	// the order as it stands is what its events replay to
+	var current models.Order
+	db.First(&current, order.ID)
+	replayed, err := services.NewOrderProjection(db).Rebuild(context.Background(), order.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, current.Amount, replayed.Amount)
+	assert.Equal(t, current.GrossAmount, replayed.GrossAmount)
+	assert.Equal(t, models.OrderStatusCancelled, replayed.Status)
+	assert.Equal(t, 3, current.EventSequence)
+
+	assert.Equal(t, http.StatusOK, call("DELETE", handler.DeleteOrder, nil).Code)
+
+	w := call("GET", handler.GetOrderEvents, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var events []models.OrderEvent
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &events})
+	if assert.Len(t, events, 4) {
+		assert.Equal(t, models.OrderEventCreated, events[0].Type)
+		assert.Equal(t, "backfill", events[0].Actor)
+		assert.Equal(t, models.Shillings(1500), *events[0].Data.Amount)
+		assert.Equal(t, models.OrderEventAmountChanged, events[1].Type)
+		assert.Equal(t, models.Shillings(1200), *events[1].Data.Amount)
+		assert.Equal(t, models.OrderEventCancelled, events[2].Type)
+		assert.Equal(t, models.OrderEventDeleted, events[3].Type)
+		assert.Equal(t, "clerk@example.com", events[3].Actor)
+		for i, event := range events {
+			assert.Equal(t, i+1, event.Sequence)
+		}
+	}
+
+	// events cannot be rewritten
+	var stored models.OrderEvent
+	db.First(&stored, "order_id = ? AND sequence = ?", order.ID, 2)
+	assert.ErrorIs(t, db.Model(&stored).Update("actor", "someone@example.com").Error, models.ErrOrderEventImmutable)
+	assert.ErrorIs(t, db.Delete(&stored).Error, models.ErrOrderEventImmutable)
+
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/orders/999/events", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "999"}}
+	handler.GetOrderEvents(c)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOrderProjection(t *testing.T) {
+	db := testutil.DB(t)
+	projection := services.NewOrderProjection(db)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), Status: models.OrderStatusPending, CustomerID: customer.ID, Quantity: 1}
+	db.Create(&order)
+
+	// older orders get a history holding their current state
+	projected, err := projection.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, projected)
+	var count int64
+	db.Model(&models.OrderEvent{}).Where("order_id = ?", order.ID).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// an event the row has not caught up with is projected onto it
+	shipped := models.OrderStatusShipped
+	db.Create(&models.OrderEvent{OrderID: order.ID, Sequence: 2, Type: models.OrderEventStatusChanged, Data: models.OrderEventData{Status: &shipped}, Actor: "import"})
+
+	projected, err = projection.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, projected)
+	var current models.Order
+	db.First(&current, order.ID)
+	assert.Equal(t, models.OrderStatusShipped, current.Status)
+	assert.Equal(t, 2, current.EventSequence)
+	assert.Equal(t, models.Shillings(1500), current.Amount)
+
+	projected, err = projection.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, projected)
+}
@@ -3,21 +3,28 @@ package handlers
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/SebbieMzingKe/customer-order-api/internal/models"
 	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/gorm"
 )
 
+func ptr[T any](v T) *T { return &v }
+
 func TestCreateOrder(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	mockSMSService := services.NewMockSMSService()
 	handler := NewOrderHandler(db, mockSMSService)
 
@@ -41,7 +48,7 @@ func TestCreateOrder(t *testing.T) {
 			name: "valid order creation",
 			requestBody: models.CreateOrderRequest{
 				Item:       "laptop",
-				Amount:     1500.00,
+				Amount:     models.Shillings(1500.00),
 				Time:       time.Now(),
 				CustomerID: uint(customer.ID),
 			},
@@ -51,12 +58,34 @@ func TestCreateOrder(t *testing.T) {
 			name: "invalid customer id",
 			requestBody: models.CreateOrderRequest{
 				Item:       "phone",
-				Amount:     800.00,
+				Amount:     models.Shillings(800.00),
 				Time:       time.Now(),
 				CustomerID: 999,
 			},
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "customer not found",
+			expectedError:  "customer_not_found",
+		},
+		{
+			name: "amount over the limit",
+			requestBody: models.CreateOrderRequest{
+				Item:       "tractor",
+				Amount:     models.Shillings(50_000_000),
+				Time:       time.Now(),
+				CustomerID: uint(customer.ID),
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "amount_too_large",
+		},
+		{
+			name: "time too far in the future",
+			requestBody: models.CreateOrderRequest{
+				Item:       "phone",
+				Amount:     models.Shillings(800.00),
+				Time:       time.Now().Add(48 * time.Hour),
+				CustomerID: uint(customer.ID),
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "order_time_out_of_range",
 		},
 		{
 			name: "missing required fields",
@@ -65,18 +94,18 @@ func TestCreateOrder(t *testing.T) {
 				CustomerID: uint(customer.ID),
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid request",
+			expectedError:  "invalid_request",
 		},
 		{
 			name: "negative amount",
 			requestBody: models.CreateOrderRequest{
 				Item:       "item",
-				Amount:     -100.00,
+				Amount:     models.Shillings(-100.00),
 				Time:       time.Now(),
 				CustomerID: uint(customer.ID),
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid request",
+			expectedError:  "invalid_request",
 		},
 	}
 
@@ -96,10 +125,13 @@ func TestCreateOrder(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else if tt.expectedStatus == http.StatusCreated {
+				var order models.Order
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+				assert.Equal(t, fmt.Sprintf("/api/v1/orders/%d", order.ID), w.Header().Get("Location"))
 				assert.Len(t, mockSMSService.SentMessages, 0)
 
 				if len(mockSMSService.SentMessages) > 0 {
@@ -115,7 +147,7 @@ func TestCreateOrder(t *testing.T) {
 
 func TestGetOrder(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	mockSMSService := services.NewMockSMSService()
 	handler := NewOrderHandler(db, mockSMSService)
 
@@ -131,7 +163,7 @@ func TestGetOrder(t *testing.T) {
 
 	order := models.Order{
 		Item:       "laptop",
-		Amount:     1500.00,
+		Amount:     models.Shillings(1500.00),
 		Time:       time.Now(),
 		CustomerID: customer.ID,
 	}
@@ -154,13 +186,13 @@ func TestGetOrder(t *testing.T) {
 			name:           "invalid order id",
 			orderID:        "invalid",
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent order",
 			orderID:        "999",
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "order not found",
+			expectedError:  "order_not_found",
 		},
 	}
 
@@ -178,17 +210,67 @@ func TestGetOrder(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			}
 		})
 	}
 }
 
+func TestGetOrderByNumber(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService()).
+		WithOrderNumbers(services.OrderNumberPolicy{Prefix: "SAV", Scheme: services.OrderNumberGapless})
+
+	r := gin.New()
+	r.POST("/orders", handler.CreateOrder)
+	r.GET("/orders/by-number/:number", handler.GetOrderByNumber)
+
+	customer := testutil.NewCustomer(t).Create(db)
+	w := testutil.NewRequest("POST", "/orders").WithJSON(models.CreateOrderRequest{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID}).Serve(t, r)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var created models.Order
+	w.Data(&created)
+	require.NotNil(t, created.Number)
+	number := fmt.Sprintf("SAV-%d-000001", time.Now().UTC().Year())
+	assert.Equal(t, number, *created.Number)
+
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "by number",
+			Request: testutil.NewRequest("GET", "/orders/by-number/"+number),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var order models.Order
+				w.Data(&order)
+				assert.Equal(t, created.ID, order.ID)
+			},
+		},
+		{
+			Name:    "in any case",
+			Request: testutil.NewRequest("GET", "/orders/by-number/"+strings.ToLower(number)+"?fields=number,item"),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var order map[string]interface{}
+				w.Data(&order)
+				assert.Equal(t, map[string]interface{}{"number": number, "item": "laptop"}, order)
+			},
+		},
+		{
+			Name:    "unknown number",
+			Request: testutil.NewRequest("GET", "/orders/by-number/SAV-1999-000001"),
+			Status:  http.StatusNotFound,
+			Code:    "order_not_found",
+		},
+	})
+}
+
 func TestGetOrders(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	mockSMSService := services.NewMockSMSService()
 	handler := NewOrderHandler(db, mockSMSService)
 
@@ -203,9 +285,9 @@ func TestGetOrders(t *testing.T) {
 	}
 
 	orders := []models.Order{
-		{Item: "laptop", Amount: 1500.00, Time: time.Now(), CustomerID: customer.ID},
-		{Item: "phone", Amount: 800.00, Time: time.Now(), CustomerID: customer.ID},
-		{Item: "tablet", Amount: 600.00, Time: time.Now(), CustomerID: customer.ID},
+		{Item: "Gaming laptop", Amount: models.Shillings(55000.00), Time: time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC), CustomerID: customer.ID},
+		{Item: "phone", Amount: models.Shillings(800.00), Time: time.Date(2025, 3, 31, 18, 0, 0, 0, time.UTC), CustomerID: customer.ID},
+		{Item: "tablet 100%", Amount: models.Shillings(50000.00), Time: time.Date(2025, 4, 1, 8, 0, 0, 0, time.UTC), CustomerID: customer.ID, CreatedAt: time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)},
 	}
 
 	for _, order := range orders {
@@ -218,6 +300,7 @@ func TestGetOrders(t *testing.T) {
 		name           string
 		query          string
 		expectedTotal  int
+		expectedCount  int
 		expectedStatus int
 	}{
 		{
@@ -232,6 +315,108 @@ func TestGetOrders(t *testing.T) {
 			expectedTotal:  3,
 			expectedStatus: http.StatusOK,
 		},
+		{
+			name:           "filter orders by another customer",
+			query:          "customer_id=2",
+			expectedTotal:  0,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter orders by created date",
+			query:          "created_from=2025-09-01&created_to=2025-09-01",
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "paginate orders",
+			query:          "page=2&limit=2",
+			expectedTotal:  3,
+			expectedCount:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid customer id",
+			query:          "customer_id=abc",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid created range",
+			query:          "created_from=2025-09-02&created_to=2025-09-01",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "filter orders by order date",
+			query:          "from=2025-03-01&to=2025-03-31",
+			expectedTotal:  2,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter orders by order time",
+			query:          "from=2025-03-31T12:00:00Z",
+			expectedTotal:  2,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "orders of 50k or more in march",
+			query:          "min_amount=50000&from=2025-03-01&to=2025-03-31",
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter orders by amount range",
+			query:          "min_amount=800&max_amount=50000",
+			expectedTotal:  2,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter orders by item",
+			query:          "item=LAPTOP",
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "item wildcards are matched literally",
+			query:          "item=%25",
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "invalid order range",
+			query:          "from=2025-04-01&to=2025-03-01",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid amount",
+			query:          "min_amount=lots",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid amount range",
+			query:          "min_amount=100&max_amount=10",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "filter expression",
+			query:          "filter=" + url.QueryEscape(`amount>1000 AND item~"laptop"`),
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter expression with other filters",
+			query:          "from=2025-03-20&filter=" + url.QueryEscape(`amount <= 1000 OR time = 2025-03-14`),
+			expectedTotal:  1,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "filter on an unknown field",
+			query:          "filter=" + url.QueryEscape(`sla_escalated_at > 2025-01-01`),
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "malformed filter",
+			query:          "filter=" + url.QueryEscape(`amount > 1000 AND`),
+			expectedStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tt := range tests {
@@ -246,19 +431,26 @@ func TestGetOrders(t *testing.T) {
 
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
-			var response map[string]interface{}
-			json.Unmarshal(w.Body.Bytes(), &response)
+			var orders []models.Order
+			var meta models.PageMeta
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &orders, Meta: &meta})
 
-			assert.Contains(t, response, "orders")
-			assert.Contains(t, response, "total")
-			assert.Equal(t, float64(tt.expectedTotal), response["total"])
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			expectedCount := tt.expectedTotal
+			if tt.expectedCount != 0 {
+				expectedCount = tt.expectedCount
+			}
+			assert.Len(t, orders, expectedCount)
+			assert.Equal(t, int64(tt.expectedTotal), meta.Total)
 		})
 	}
 }
 
 func TestUpdateOrder(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	mockSMSService := services.NewMockSMSService()
 	handler := NewOrderHandler(db, mockSMSService)
 
@@ -274,10 +466,11 @@ func TestUpdateOrder(t *testing.T) {
 
 	order := models.Order{
 		Item:       "laptop",
-		Amount:     1500.00,
+		Amount:     models.Shillings(1500.00),
 		Time:       time.Now(),
 		CustomerID: customer.ID,
 	}
+	services.DefaultTaxPolicy().Apply(&order)
 	if err := db.Create(&order).Error; err != nil {
 		t.Fatalf("failed to create order: %v", err)
 	}
@@ -289,55 +482,73 @@ func TestUpdateOrder(t *testing.T) {
 		expectedStatus int
 		expectedError  string
 		expectedItem   string
-		expectedAmount float64
+		expectedAmount models.Money
+		expectedTax    models.Money
 		expectedTime   time.Time
 	}{
 		{
 			name:    "valid full update",
 			orderID: "1",
 			requestBody: models.UpdateOrderRequest{
-				Item:   "phone",
-				Amount: 800.00,
-				Time:   time.Now().Add(1 * time.Hour),
+				Item:   ptr("phone"),
+				Amount: ptr(models.Shillings(800.00)),
+				Time:   ptr(time.Now().Add(1 * time.Hour)),
 			},
 			expectedStatus: http.StatusOK,
 			expectedItem:   "phone",
-			expectedAmount: 800.00,
+			expectedAmount: models.Shillings(800.00),
+			expectedTax:    models.Shillings(110.34),
 			expectedTime:   time.Now().Add(1 * time.Hour).Truncate(time.Second),
 		},
 		{
 			name:    "valid partial update",
 			orderID: "1",
 			requestBody: models.UpdateOrderRequest{
-				Item:   "tablet",
-				Amount: 0,
-				Time:   time.Time{},
+				Item: ptr("tablet"),
 			},
 			expectedStatus: http.StatusOK,
 			expectedItem:   "tablet",
-			expectedAmount: 800.00,
+			expectedAmount: models.Shillings(800.00),
+			expectedTax:    models.Shillings(110.34),
+			expectedTime:   time.Now().Add(1 * time.Hour).Truncate(time.Second),
+		},
+		{
+			name:           "amount set to zero",
+			orderID:        "1",
+			requestBody:    models.UpdateOrderRequest{Amount: ptr(models.Money(0))},
+			expectedStatus: http.StatusOK,
+			expectedItem:   "tablet",
+			expectedAmount: 0,
+			expectedTax:    0,
 			expectedTime:   time.Now().Add(1 * time.Hour).Truncate(time.Second),
 		},
+		{
+			name:           "empty item",
+			orderID:        "1",
+			requestBody:    models.UpdateOrderRequest{Item: ptr("")},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
 		{
 			name:           "invalid order id",
 			orderID:        "invalid",
-			requestBody:    models.UpdateOrderRequest{Item: "phone"},
+			requestBody:    models.UpdateOrderRequest{Item: ptr("phone")},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent order",
 			orderID:        "999",
-			requestBody:    models.UpdateOrderRequest{Item: "phone"},
+			requestBody:    models.UpdateOrderRequest{Item: ptr("phone")},
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "order not found",
+			expectedError:  "order_not_found",
 		},
 		{
 			name:           "invalid request body",
 			orderID:        "1",
-			requestBody:    models.UpdateOrderRequest{Amount: -100.00},
+			requestBody:    models.UpdateOrderRequest{Amount: ptr(models.Shillings(-100.00))},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid request",
+			expectedError:  "invalid_request",
 		},
 	}
 
@@ -357,14 +568,16 @@ func TestUpdateOrder(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else {
 				var updatedOrder models.Order
-				json.Unmarshal(w.Body.Bytes(), &updatedOrder)
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &updatedOrder})
 				assert.Equal(t, tt.expectedItem, updatedOrder.Item)
 				assert.Equal(t, tt.expectedAmount, updatedOrder.Amount)
+				assert.Equal(t, tt.expectedTax, updatedOrder.TaxAmount)
+				assert.Equal(t, tt.expectedAmount, updatedOrder.NetAmount+updatedOrder.TaxAmount)
 				assert.WithinDuration(t, tt.expectedTime, updatedOrder.Time, time.Second)
 
 				var dbOrder models.Order
@@ -378,9 +591,75 @@ func TestUpdateOrder(t *testing.T) {
 	}
 }
 
+func TestUpdateOrderZeroValues(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	eta := time.Date(2025, 9, 21, 13, 0, 0, 0, time.UTC)
+	order := models.Order{
+		Item:                 "laptop",
+		Amount:               models.Shillings(1500),
+		Time:                 time.Now(),
+		CustomerID:           customer.ID,
+		Status:               models.OrderStatusPending,
+		EstimatedDeliveryAt:  &eta,
+		DeliveryInstructions: "leave at the gate",
+	}
+	services.DefaultTaxPolicy().Apply(&order)
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	update := func(body string) models.Order {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("PUT", "/orders/1", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Params = []gin.Param{{Key: "id", Value: "1"}}
+		handler.UpdateOrder(c)
+		assert.Equal(t, http.StatusOK, w.Code, body)
+
+		var updated models.Order
+		if err := db.First(&updated, order.ID).Error; err != nil {
+			t.Fatalf("failed to load order: %v", err)
+		}
+		return updated
+	}
+
+	// fields left out or null keep their values
+	updated := update(`{"item": null, "amount": null}`)
+	assert.Equal(t, "laptop", updated.Item)
+	assert.Equal(t, models.Shillings(1500), updated.Amount)
+	assert.NotNil(t, updated.EstimatedDeliveryAt)
+
+	updated = update(`{"amount": 0}`)
+	assert.Equal(t, models.Money(0), updated.Amount)
+	assert.Equal(t, models.Money(0), updated.TaxAmount)
+	assert.Equal(t, models.Money(0), updated.GrossAmount)
+
+	updated = update(`{"estimated_delivery_at": null, "delivery_instructions": ""}`)
+	assert.Nil(t, updated.EstimatedDeliveryAt)
+	assert.Empty(t, updated.DeliveryInstructions)
+	assert.Equal(t, "laptop", updated.Item)
+
+	// a retried update changes the order once
+	var revisions int64
+	db.Model(&models.OrderRevision{}).Where("order_id = ?", order.ID).Count(&revisions)
+	update(`{"amount": 0, "estimated_delivery_at": null}`)
+	var after int64
+	db.Model(&models.OrderRevision{}).Where("order_id = ?", order.ID).Count(&after)
+	assert.Equal(t, revisions, after)
+	assert.Equal(t, int64(3), revisions, "amount, estimated delivery and instructions were each changed once")
+}
+
 func TestDeleteOrder(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-	db := setupTestDB(t)
+	db := testutil.DB(t)
 	mockSMSService := services.NewMockSMSService()
 	handler := NewOrderHandler(db, mockSMSService)
 
@@ -396,7 +675,7 @@ func TestDeleteOrder(t *testing.T) {
 
 	order := models.Order{
 		Item:       "laptop",
-		Amount:     1500.00,
+		Amount:     models.Shillings(1500.00),
 		Time:       time.Now(),
 		CustomerID: customer.ID,
 	}
@@ -419,13 +698,13 @@ func TestDeleteOrder(t *testing.T) {
 			name:           "invalid order id",
 			orderID:        "invalid",
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "invalid id",
+			expectedError:  "invalid_id",
 		},
 		{
 			name:           "non-existent order",
 			orderID:        "999",
 			expectedStatus: http.StatusNotFound,
-			expectedError:  "order not found",
+			expectedError:  "order_not_found",
 		},
 	}
 
@@ -443,12 +722,12 @@ func TestDeleteOrder(t *testing.T) {
 			assert.Equal(t, tt.expectedStatus, w.Code)
 
 			if tt.expectedError != "" {
-				var errorResponse models.ErrorResponse
+				var errorResponse models.ErrorEnvelope
 				json.Unmarshal(w.Body.Bytes(), &errorResponse)
-				assert.Equal(t, tt.expectedError, errorResponse.Error)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
 			} else {
 				var response map[string]interface{}
-				json.Unmarshal(w.Body.Bytes(), &response)
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
 				assert.Equal(t, "order deleted successfully", response["message"])
 
 				var dbOrder models.Order
@@ -459,3 +738,397 @@ func TestDeleteOrder(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrdersWithFields(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{
+		Name:  "Sebbie Chanzu",
+		Code:  "CUST001",
+		Phone: "+254740827150",
+		Email: "sebbievilar2@gmail.com",
+	}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500.00), Time: time.Now(), CustomerID: customer.ID}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "/orders?fields=item,amount", nil)
+	c.Request = req
+
+	handler.GetOrders(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var orderList []interface{}
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &orderList})
+	assert.Len(t, orderList, 1)
+
+	projected := orderList[0].(map[string]interface{})
+	assert.Len(t, projected, 2)
+	assert.Equal(t, "laptop", projected["item"])
+	assert.Equal(t, 1500.00, projected["amount"])
+	assert.NotContains(t, projected, "customer")
+}
+
+func TestGetOrdersCustomerSummary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	useTestKeyring(t, "k1")
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customers := []models.Customer{
+		{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+		{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"},
+	}
+	for i := range customers {
+		db.Create(&customers[i])
+	}
+	for _, customer := range customers {
+		db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID})
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/orders", nil)
+	handler.GetOrders(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var orderList []map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &orderList})
+	if assert.Len(t, orderList, 2) {
+		for i, order := range orderList {
+			assert.Equal(t, map[string]interface{}{
+				"id":    float64(customers[i].ID),
+				"name":  customers[i].Name,
+				"code":  customers[i].Code,
+				"phone": customers[i].Phone,
+			}, order["customer"])
+		}
+	}
+}
+
+func TestCreateOrderDeliveryInstructions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{
+		Name:                 "Sebbie Chanzu",
+		Code:                 "CUST001",
+		Phone:                "+254740827150",
+		Email:                "sebbievilar2@gmail.com",
+		DeliveryInstructions: "call on arrival, gate 3",
+	}
+	db.Create(&customer)
+
+	tests := []struct {
+		name         string
+		instructions string
+		expected     string
+	}{
+		{name: "inherits the customer default", expected: "call on arrival, gate 3"},
+		{name: "keeps its own", instructions: "leave at reception", expected: "leave at reception"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body, _ := json.Marshal(models.CreateOrderRequest{
+				Item:                 "laptop",
+				Amount:               models.Shillings(1500),
+				Time:                 time.Now(),
+				CustomerID:           customer.ID,
+				DeliveryInstructions: tt.instructions,
+			})
+			c.Request, _ = http.NewRequest("POST", "/orders", bytes.NewBuffer(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.CreateOrder(c)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			var order models.Order
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+			assert.Equal(t, tt.expected, order.DeliveryInstructions)
+
+			var stored models.Order
+			db.First(&stored, order.ID)
+			assert.Equal(t, tt.expected, stored.DeliveryInstructions)
+		})
+	}
+}
+
+func TestCreateOrderWithInventory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		quantity       int
+		productID      uint
+		expectedStatus int
+		expectedError  string
+		expectedStock  int
+	}{
+		{
+			name:           "order within stock",
+			quantity:       3,
+			productID:      1,
+			expectedStatus: http.StatusCreated,
+			expectedStock:  2,
+		},
+		{
+			name:           "order exceeding stock",
+			quantity:       6,
+			productID:      1,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "insufficient_stock",
+			expectedStock:  5,
+		},
+		{
+			name:           "unknown product",
+			quantity:       1,
+			productID:      999,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "product_not_found",
+			expectedStock:  5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			mockSMSService := services.NewMockSMSService()
+			handler := NewOrderHandler(db, mockSMSService)
+
+			customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+			if err := db.Create(&customer).Error; err != nil {
+				t.Fatalf("failed to create customer: %v", err)
+			}
+			product := models.Product{Name: "Laptop", SKU: "SKU001", Price: models.Shillings(1500.00), StockQuantity: 5}
+			if err := db.Create(&product).Error; err != nil {
+				t.Fatalf("failed to create product: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			productID := tt.productID
+			jsonBody, _ := json.Marshal(models.CreateOrderRequest{
+				Item:       "laptop",
+				Amount:     models.Shillings(1500.00),
+				Time:       time.Now(),
+				CustomerID: customer.ID,
+				ProductID:  &productID,
+				Quantity:   tt.quantity,
+			})
+			req, _ := http.NewRequest("POST", "/orders", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+
+			handler.CreateOrder(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+
+				var count int64
+				db.Model(&models.Order{}).Count(&count)
+				assert.Equal(t, int64(0), count)
+			}
+
+			db.First(&product, product.ID)
+			assert.Equal(t, tt.expectedStock, product.StockQuantity)
+		})
+	}
+}
+
+func TestCancelOrderRestoresStock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	purger := services.NewMockCachePurger()
+	handler := NewOrderHandler(db, services.NewMockSMSService()).WithCachePurger(purger)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	product := models.Product{Name: "Laptop", SKU: "SKU001", StockQuantity: 2}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500.00), Time: time.Now(), CustomerID: customer.ID, ProductID: &product.ID, Quantity: 3}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	jsonBody, _ := json.Marshal(models.UpdateOrderRequest{Status: ptr(models.OrderStatusCancelled)})
+	req, _ := http.NewRequest(http.MethodPut, "/orders/1", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	c.Request = req
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	handler.UpdateOrder(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	db.First(&product, product.ID)
+	assert.Equal(t, 5, product.StockQuantity)
+
+	// the tracking page and the product's catalog entries are now stale
+	assert.Eventually(t, func() bool {
+		return len(purger.Purged()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"order-1", "product-1"}, purger.Purged())
+}
+
+func TestDuplicateOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name             string
+		orderID          string
+		body             string
+		expectedStatus   int
+		expectedError    string
+		expectedItem     string
+		expectedAmount   models.Money
+		expectedQuantity int
+		expectedPriority string
+		expectedStock    int
+	}{
+		{
+			name:             "copy as is",
+			orderID:          "1",
+			expectedStatus:   http.StatusCreated,
+			expectedItem:     "laptop",
+			expectedAmount:   models.Shillings(3000),
+			expectedQuantity: 2,
+			expectedPriority: models.OrderPriorityExpress,
+			expectedStock:    3,
+		},
+		{
+			name:             "quantity scales the amount",
+			orderID:          "1",
+			body:             `{"quantity": 3}`,
+			expectedStatus:   http.StatusCreated,
+			expectedItem:     "laptop",
+			expectedAmount:   models.Shillings(4500),
+			expectedQuantity: 3,
+			expectedPriority: models.OrderPriorityExpress,
+			expectedStock:    2,
+		},
+		{
+			name:             "overrides",
+			orderID:          "1",
+			body:             `{"item": "laptop sleeve", "amount": 100, "priority": "normal"}`,
+			expectedStatus:   http.StatusCreated,
+			expectedItem:     "laptop sleeve",
+			expectedAmount:   models.Shillings(100),
+			expectedQuantity: 2,
+			expectedPriority: models.OrderPriorityNormal,
+			expectedStock:    3,
+		},
+		{
+			name:           "not enough stock",
+			orderID:        "1",
+			body:           `{"quantity": 10}`,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "insufficient_stock",
+			expectedStock:  5,
+		},
+		{
+			name:           "invalid priority",
+			orderID:        "1",
+			body:           `{"priority": "urgent"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+			expectedStock:  5,
+		},
+		{
+			name:           "non-existent order",
+			orderID:        "999",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "order_not_found",
+			expectedStock:  5,
+		},
+		{
+			name:           "invalid order ID",
+			orderID:        "abc",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_id",
+			expectedStock:  5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			handler := NewOrderHandler(db, services.NewMockSMSService())
+
+			customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+			if err := db.Create(&customer).Error; err != nil {
+				t.Fatalf("failed to create customer: %v", err)
+			}
+			product := models.Product{Name: "Laptop", SKU: "SKU001", Price: models.Shillings(1500.00), StockQuantity: 5}
+			if err := db.Create(&product).Error; err != nil {
+				t.Fatalf("failed to create product: %v", err)
+			}
+			lastWeek := time.Now().AddDate(0, 0, -7)
+			source := models.Order{Item: "laptop", Amount: models.Shillings(3000), Time: lastWeek, Status: models.OrderStatusDelivered,
+				CustomerID: customer.ID, ProductID: &product.ID, Quantity: 2, Priority: models.OrderPriorityExpress}
+			if err := db.Create(&source).Error; err != nil {
+				t.Fatalf("failed to create order: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			req, _ := http.NewRequest("POST", "/orders/"+tt.orderID+"/duplicate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+			c.Params = gin.Params{{Key: "id", Value: tt.orderID}}
+
+			handler.DuplicateOrder(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			db.First(&product, product.ID)
+			assert.Equal(t, tt.expectedStock, product.StockQuantity)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var order models.Order
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+			assert.NotEqual(t, source.ID, order.ID)
+			assert.Equal(t, customer.ID, order.CustomerID)
+			assert.Equal(t, tt.expectedItem, order.Item)
+			assert.Equal(t, tt.expectedAmount, order.Amount)
+			assert.Equal(t, tt.expectedQuantity, order.Quantity)
+			assert.Equal(t, tt.expectedPriority, order.Priority)
+			assert.Equal(t, models.OrderStatusPending, order.Status)
+			assert.WithinDuration(t, time.Now(), order.Time, time.Minute)
+			assert.Equal(t, tt.expectedAmount, order.GrossAmount)
+		})
+	}
+}
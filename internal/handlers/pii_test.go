@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// useTestKeyring turns on PII encryption for the rest of the test. Each
+// key is derived from its id, so a key keeps its value across calls.
+func useTestKeyring(t *testing.T, primary string, ids ...string) *pii.Keyring {
+	keys := map[string][]byte{}
+	for _, id := range append([]string{primary}, ids...) {
+		keys[id] = bytes.Repeat([]byte(id[len(id)-1:]), 32)
+	}
+	keyring, err := pii.NewKeyring(primary, keys, bytes.Repeat([]byte{9}, 32))
+	if err != nil {
+		t.Fatalf("failed to build keyring: %v", err)
+	}
+	pii.SetKeyring(keyring)
+	t.Cleanup(func() { pii.SetKeyring(nil) })
+	return keyring
+}
+
+type storedContact struct {
+	Phone string
+	Email string
+}
+
+func TestCustomerPIIEncryptedAtRest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	useTestKeyring(t, "k1")
+	handler := NewCustomerHandler(db)
+
+	create := func(code, email string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(models.CreateCustomerRequest{Name: "Sebbie Chanzu", Code: code, Phone: "0740827150", Email: email})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/customers", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.CreateCustomer(c)
+		return w
+	}
+
+	w := create("CUST001", "sebbievilar2@gmail.com")
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var stored storedContact
+	db.Table("customers").Select("phone, email").Where("code = ?", "CUST001").Scan(&stored)
+	assert.True(t, pii.IsEncrypted(stored.Phone))
+	assert.True(t, pii.IsEncrypted(stored.Email))
+	assert.NotContains(t, stored.Email, "sebbievilar2")
+
+	var customer models.Customer
+	db.First(&customer, "code = ?", "CUST001")
+	assert.Equal(t, "0740827150", customer.Phone)
+	assert.Equal(t, "sebbievilar2@gmail.com", customer.Email)
+
+	// uniqueness holds even though the ciphertexts differ
+	w = create("CUST002", "sebbievilar2@gmail.com")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var errorResponse models.ErrorEnvelope
+	json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.Equal(t, "email_already_in_use", errorResponse.Error.Code)
+
+	// inbound texts still find the customer by phone
+	sms := NewSMSCallbackHandler(db, services.NewMockSMSService())
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	form := url.Values{"from": {"+254740827150"}, "text": {"hello"}}
+	c.Request, _ = http.NewRequest("POST", "/callbacks/sms/inbound", strings.NewReader(form.Encode()))
+	c.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	sms.InboundSMS(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var message models.SMSMessage
+	db.First(&message)
+	if assert.NotNil(t, message.CustomerID) {
+		assert.Equal(t, customer.ID, *message.CustomerID)
+	}
+
+	// the pseudonymous email written on anonymization is encrypted too
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/customers/1/anonymize", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+	handler.AnonymizeCustomer(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	db.Table("customers").Select("phone, email").Where("id = ?", customer.ID).Scan(&stored)
+	assert.Empty(t, stored.Phone)
+	assert.True(t, pii.IsEncrypted(stored.Email))
+
+	db.First(&customer, customer.ID)
+	assert.True(t, strings.HasSuffix(customer.Email, "@anonymized.invalid"))
+	assert.Equal(t, pii.BlindIndex(customer.Email), *customer.EmailHash)
+	assert.Equal(t, pii.BlindIndex(""), customer.PhoneHash)
+}
+
+func TestBackfillCustomerPII(t *testing.T) {
+	db := testutil.DB(t)
+
+	// rows written before encryption, without blind indexes
+	db.Exec("INSERT INTO customers (name, code, phone, email, phone_hash) VALUES (?, ?, ?, ?, '')",
+		"Sebbie Chanzu", "CUST001", "+254740827150", "sebbievilar2@gmail.com")
+	db.Exec("INSERT INTO customers (name, code, phone, email, phone_hash) VALUES (?, ?, ?, ?, '')",
+		"Jane Wanjiku", "CUST002", "+254711000002", "")
+
+	// plain text mode only fills in the blind indexes
+	n, err := services.BackfillCustomerPII(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var stored storedContact
+	db.Table("customers").Select("phone, email").Where("code = ?", "CUST001").Scan(&stored)
+	assert.Equal(t, "+254740827150", stored.Phone)
+
+	useTestKeyring(t, "k1")
+	n, err = services.BackfillCustomerPII(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	db.Table("customers").Select("phone, email").Where("code = ?", "CUST001").Scan(&stored)
+	assert.True(t, strings.HasPrefix(stored.Phone, "enc:v1:k1:"))
+	assert.True(t, strings.HasPrefix(stored.Email, "enc:v1:k1:"))
+
+	var jane storedContact
+	db.Table("customers").Select("phone, email").Where("code = ?", "CUST002").Scan(&jane)
+	assert.Empty(t, jane.Email)
+
+	// nothing left to do
+	n, err = services.BackfillCustomerPII(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+
+	// rotate: k2 becomes primary and k1 is kept to read old rows
+	useTestKeyring(t, "k2", "k1")
+	n, err = services.BackfillCustomerPII(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	db.Table("customers").Select("phone, email").Where("code = ?", "CUST001").Scan(&stored)
+	assert.True(t, strings.HasPrefix(stored.Phone, "enc:v1:k2:"))
+
+	var customer models.Customer
+	db.First(&customer, "code = ?", "CUST001")
+	assert.Equal(t, "+254740827150", customer.Phone)
+	assert.Equal(t, "sebbievilar2@gmail.com", customer.Email)
+
+	var found int64
+	db.Model(&models.Customer{}).Where("phone_hash = ?", pii.BlindIndex("+254740827150")).Count(&found)
+	assert.Equal(t, int64(1), found)
+
+	n, err = services.BackfillCustomerPII(context.Background(), db, true)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n, "all rewrites every customer")
+}
+
+func TestBackfillNormalizesEmails(t *testing.T) {
+	db := testutil.DB(t)
+
+	insert := func(code, email string) {
+		db.Exec("INSERT INTO customers (name, code, phone, phone_hash, email, email_hash) VALUES (?, ?, ?, ?, ?, ?)",
+			"Sebbie Chanzu", code, "+254740827150", pii.BlindIndex("+254740827150"), email, pii.BlindIndex(email))
+	}
+	insert("CUST001", "sebbie@example.com")
+	insert("CUST002", "SEBBIE@Example.com")
+	insert("CUST003", " Jane@Example.com")
+
+	n, err := services.BackfillCustomerPII(context.Background(), db, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	var emails []string
+	db.Table("customers").Order("id ASC").Pluck("email", &emails)
+	assert.Equal(t, []string{"sebbie@example.com", "SEBBIE@Example.com", "jane@example.com"}, emails, "a clashing email is left as it is")
+
+	var found int64
+	db.Model(&models.Customer{}).Where("email_hash = ?", pii.BlindIndex("jane@example.com")).Count(&found)
+	assert.Equal(t, int64(1), found)
+}
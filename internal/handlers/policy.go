@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/authz"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PolicyHandler lets admins change which roles may call which routes, and
+// who has which role
+type PolicyHandler struct {
+	policies *authz.Store
+	audit    services.AuditRecorder
+}
+
+func NewPolicyHandler(policies *authz.Store) *PolicyHandler {
+	return &PolicyHandler{policies: policies}
+}
+
+// WithAudit records policy and role changes
+func (h *PolicyHandler) WithAudit(audit services.AuditRecorder) *PolicyHandler {
+	h.audit = audit
+	return h
+}
+
+func (h *PolicyHandler) GetPolicies(c *gin.Context) {
+	policies, err := h.policies.List(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve policies")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, policies, gin.H{"total": len(policies)})
+}
+
+func (h *PolicyHandler) CreatePolicy(c *gin.Context) {
+	var req models.CreatePolicyRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	policy := models.Policy{
+		Role:        req.Role,
+		Method:      req.Method,
+		Path:        req.Path,
+		Effect:      req.Effect,
+		Description: req.Description,
+		CreatedBy:   middleware.CurrentUserEmail(c),
+	}
+	if err := h.policies.Create(c.Request.Context(), &policy); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to create policy")
+		return
+	}
+	h.record(c, models.AuditPolicyCreated, policyDetails(policy))
+
+	respond.OK(c, http.StatusCreated, policy)
+}
+
+// DeletePolicy removes a policy kept in the database. Policies set in
+// AUTHZ_POLICIES are changed there.
+func (h *PolicyHandler) DeletePolicy(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid policy id")
+		return
+	}
+
+	policy, err := h.policies.Delete(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, authz.ErrPolicyNotFound) {
+			respond.Error(c, http.StatusNotFound, "policy_not_found", "policy not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to delete policy")
+		return
+	}
+	h.record(c, models.AuditPolicyDeleted, policyDetails(policy))
+
+	respond.OK(c, http.StatusOK, policy)
+}
+
+func (h *PolicyHandler) GetRoles(c *gin.Context) {
+	roles, err := h.policies.ListRoles(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve roles")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, roles, gin.H{"total": len(roles)})
+}
+
+// AssignRole gives the user with the email in the path a role, replacing
+// any they had
+func (h *PolicyHandler) AssignRole(c *gin.Context) {
+	var req models.AssignRoleRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	role, err := h.policies.AssignRole(c.Request.Context(), c.Param("email"), req.Role, middleware.CurrentUserEmail(c))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to assign role")
+		return
+	}
+	h.record(c, models.AuditRoleAssigned, fmt.Sprintf("email=%s role=%s", role.Email, role.Role))
+
+	respond.OK(c, http.StatusOK, role)
+}
+
+// RemoveRole puts the user back to the user role
+func (h *PolicyHandler) RemoveRole(c *gin.Context) {
+	role, err := h.policies.RemoveRole(c.Request.Context(), c.Param("email"))
+	if err != nil {
+		if errors.Is(err, authz.ErrRoleNotFound) {
+			respond.Error(c, http.StatusNotFound, "role_not_found", "user has no role assigned")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to remove role")
+		return
+	}
+	h.record(c, models.AuditRoleRemoved, fmt.Sprintf("email=%s role=%s", role.Email, role.Role))
+
+	respond.OK(c, http.StatusOK, role)
+}
+
+func (h *PolicyHandler) record(c *gin.Context, eventType, details string) {
+	if h.audit == nil {
+		return
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
+
+func policyDetails(policy models.Policy) string {
+	return fmt.Sprintf("policy=%d %s %s %s %s", policy.ID, policy.Effect, policy.Role, policy.Method, policy.Path)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const anonymizedName = "anonymized customer"
+
+var errAlreadyAnonymized = errors.New("customer has already been anonymized")
+
+// WithAudit records anonymization and export requests
+func (h *CustomerHandler) WithAudit(audit services.AuditRecorder) *CustomerHandler {
+	h.audit = audit
+	return h
+}
+
+// AnonymizeCustomer irreversibly erases a customer's name, phone, email and
+// birthday, along with the phone numbers and texts of their SMS history,
+// the texts of their push notifications, their devices and any notes kept
+// about them. Orders are kept and stay linked to the customer, whose code
+// becomes a pseudonym, but lose their delivery instructions, in their
+// history and events too.
+func (h *CustomerHandler) AnonymizeCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	customer, ok := h.findCustomerForPrivacy(c, db)
+	if !ok {
+		return
+	}
+
+	if customer.AnonymizedAt != nil {
+		respond.Error(c, http.StatusConflict, "customer_anonymized", "customer has already been anonymized")
+		return
+	}
+
+	pseudonym, err := newPseudonym()
+	if err != nil {
+		respond.ServerError(c, err, "anonymization_failed", "failed to generate pseudonym")
+		return
+	}
+
+	now := time.Now()
+	anonymized := models.Customer{
+		Name:         anonymizedName,
+		Code:         pseudonym,
+		Email:        pseudonym + "@anonymized.invalid",
+		AnonymizedAt: &now,
+	}
+	anonymized.PhoneHash, anonymized.EmailHash = models.CustomerHashes(anonymized.Phone, anonymized.Email)
+
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		// a struct update, unlike a map, goes through the pii serializer.
+		// The condition keeps a concurrent request from anonymizing twice.
+		result := tx.Unscoped().Model(&customer).Where("anonymized_at IS NULL").
+			Select("name", "code", "phone", "phone_hash", "email", "email_hash", "delivery_instructions", "birthday", "anonymized_at").
+			Updates(&anonymized)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errAlreadyAnonymized
+		}
+
+		// instructions often say where the customer lives
+		if err := services.EraseDeliveryInstructions(tx, customer.ID); err != nil {
+			return err
+		}
+
+		err := tx.Where("customer_id = ?", customer.ID).Delete(&models.CustomerNote{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("customer_id = ?", customer.ID).Delete(&models.CustomerCodeChange{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.SMSMessage{}).
+			Where("customer_id = ?", customer.ID).
+			Updates(map[string]interface{}{"phone": "", "body": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("customer_id = ?", customer.ID).Delete(&models.DeviceToken{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.PushNotification{}).
+			Where("customer_id = ?", customer.ID).
+			Updates(map[string]interface{}{"title": "", "body": ""}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.NotificationAttempt{}).
+			Where("order_id IN (?)", tx.Unscoped().Model(&models.Order{}).Select("id").Where("customer_id = ?", customer.ID)).
+			Update("recipient", "").Error
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadyAnonymized) {
+			respond.Error(c, http.StatusConflict, "customer_anonymized", "customer has already been anonymized")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to anonymize customer")
+		return
+	}
+
+	h.record(c, models.AuditCustomerAnonymized, customer.ID)
+
+	respond.OK(c, http.StatusOK, gin.H{
+		"message":       "customer anonymized successfully",
+		"id":            customer.ID,
+		"code":          pseudonym,
+		"anonymized_at": now,
+	})
+}
+
+// ExportCustomer returns everything held about a customer, including
+// soft-deleted records and archived orders
+func (h *CustomerHandler) ExportCustomer(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	customer, ok := h.findCustomerForPrivacy(c, db)
+	if !ok {
+		return
+	}
+
+	export := models.CustomerExport{
+		Customer:   customer,
+		ExportedAt: time.Now(),
+	}
+
+	err := db.Unscoped().Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.Orders).Error
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.ArchivedOrders).Error
+	}
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.SMSMessages).Error
+	}
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.Devices).Error
+	}
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.PushNotifications).Error
+	}
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.Notes).Error
+	}
+	if err == nil {
+		err = db.Where("customer_id = ?", customer.ID).Order("id ASC").Find(&export.CodeHistory).Error
+	}
+	if err == nil {
+		orderIDs := db.Unscoped().Model(&models.Order{}).Select("id").Where("customer_id = ?", customer.ID)
+		err = db.Where("order_id IN (?)", orderIDs).Order("id ASC").Find(&export.NotificationAttempts).Error
+	}
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to export customer data")
+		return
+	}
+
+	h.record(c, models.AuditCustomerExported, customer.ID)
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=customer-%d.json", customer.ID))
+	respond.OK(c, http.StatusOK, export)
+}
+
+// findCustomerForPrivacy loads the customer named by :id, including soft
+// deleted ones, since erasure and access requests apply to them too
+func (h *CustomerHandler) findCustomerForPrivacy(c *gin.Context, db *gorm.DB) (models.Customer, bool) {
+	var customer models.Customer
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return customer, false
+	}
+
+	if err := db.Unscoped().First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return customer, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return customer, false
+	}
+
+	return customer, true
+}
+
+func (h *CustomerHandler) record(c *gin.Context, eventType string, customerID uint) {
+	if h.audit == nil {
+		return
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   fmt.Sprintf("customer %d", customerID),
+	})
+}
+
+func newPseudonym() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "anon-" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizeErasesInstructionsFromOrderHistory(t *testing.T) {
+	r := apptest.NewRouter(t, apptest.Config())
+	admin := testutil.Token(t, apptest.Admin)
+	customer := testutil.NewCustomer(t).WithPhone("+254740827150").Create(r.DB)
+
+	var order models.Order
+	testutil.NewRequest("POST", "/api/v1/orders").WithToken(admin).WithJSON(map[string]interface{}{
+		"item": "laptop", "amount": 1500, "time": time.Now().Add(-time.Minute), "customer_id": customer.ID,
+		"delivery_instructions": "green gate behind Kilimani Mall",
+	}).Serve(t, r).Data(&order)
+	require.NotZero(t, order.ID)
+	w := testutil.NewRequest("PUT", fmt.Sprintf("/api/v1/orders/%d", order.ID)).WithToken(admin).
+		WithJSON(map[string]string{"delivery_instructions": "flat 4B, call from the gate"}).Serve(t, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	history := testutil.NewRequest("GET", fmt.Sprintf("/api/v1/orders/%d/history", order.ID)).WithToken(admin)
+	events := testutil.NewRequest("GET", fmt.Sprintf("/api/v1/orders/%d/events", order.ID)).WithToken(admin)
+	require.Contains(t, history.Serve(t, r).Body.String(), "flat 4B")
+	require.Contains(t, events.Serve(t, r).Body.String(), "Kilimani Mall")
+
+	w = testutil.NewRequest("POST", fmt.Sprintf("/api/v1/customers/%d/anonymize", customer.ID)).WithToken(admin).Serve(t, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, req := range []*testutil.Request{history, events} {
+		body := req.Serve(t, r).Body.String()
+		assert.NotContains(t, body, "Kilimani Mall")
+		assert.NotContains(t, body, "flat 4B")
+	}
+
+	// the events still replay to the order as it is
+	rebuilt, err := services.NewOrderProjection(r.DB).Rebuild(t.Context(), order.ID)
+	require.NoError(t, err)
+	assert.Empty(t, rebuilt.DeliveryInstructions)
+	assert.Equal(t, "laptop", rebuilt.Item)
+}
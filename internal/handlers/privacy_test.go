@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizeCustomer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID}
+	db.Create(&order)
+	db.Create(&models.SMSMessage{CustomerID: &customer.ID, Direction: models.SMSDirectionInbound, Phone: customer.Phone, Body: "STATUS 1"})
+	db.Create(&models.NotificationAttempt{OrderID: order.ID, Recipient: customer.Phone, Status: models.NotificationStatusSent})
+	db.Create(&models.CustomerNote{CustomerID: customer.ID, Author: "manager@example.com", Text: "called Sebbie on +254740827150"})
+	db.Create(&models.CustomerCodeChange{CustomerID: customer.ID, OldCode: "SEBBIE01", NewCode: customer.Code})
+
+	tests := []struct {
+		name           string
+		customerID     string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "anonymize customer",
+			customerID:     "1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "already anonymized",
+			customerID:     "1",
+			expectedStatus: http.StatusConflict,
+			expectedError:  "customer_anonymized",
+		},
+		{
+			name:           "customer not found",
+			customerID:     "999",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/customers/"+tt.customerID+"/anonymize", nil)
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}}
+
+			handler.AnonymizeCustomer(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+			}
+		})
+	}
+
+	var anonymized models.Customer
+	db.First(&anonymized, customer.ID)
+	assert.Equal(t, anonymizedName, anonymized.Name)
+	assert.Empty(t, anonymized.Phone)
+	assert.NotContains(t, anonymized.Email, "sebbie")
+	assert.True(t, strings.HasPrefix(anonymized.Code, "anon-"))
+	assert.NotNil(t, anonymized.AnonymizedAt)
+
+	// order history is kept and still linked to the customer
+	var kept models.Order
+	db.First(&kept, order.ID)
+	assert.Equal(t, customer.ID, kept.CustomerID)
+	assert.Equal(t, "laptop", kept.Item)
+
+	var message models.SMSMessage
+	db.Where("customer_id = ?", customer.ID).First(&message)
+	assert.Empty(t, message.Phone)
+	assert.Empty(t, message.Body)
+
+	var attempt models.NotificationAttempt
+	db.Where("order_id = ?", order.ID).First(&attempt)
+	assert.Empty(t, attempt.Recipient)
+
+	var notes int64
+	db.Model(&models.CustomerNote{}).Where("customer_id = ?", customer.ID).Count(&notes)
+	assert.Zero(t, notes)
+
+	var codes int64
+	db.Model(&models.CustomerCodeChange{}).Where("customer_id = ?", customer.ID).Count(&codes)
+	assert.Zero(t, codes)
+}
+
+func TestExportCustomer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewCustomerHandler(db)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), CustomerID: customer.ID}
+	db.Create(&order)
+	db.Create(&models.ArchivedOrder{ID: 99, Item: "phone", Amount: models.Shillings(500), Time: time.Now(), Status: models.OrderStatusDelivered, CustomerID: customer.ID, ArchivedAt: time.Now()})
+	db.Create(&models.SMSMessage{CustomerID: &customer.ID, Direction: models.SMSDirectionInbound, Phone: customer.Phone, Body: "STATUS 1"})
+	db.Create(&models.CustomerCodeChange{CustomerID: customer.ID, OldCode: "SEBBIE01", NewCode: customer.Code})
+	// soft-deleted customers can still be exported
+	db.Delete(&customer)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/customers/1/export", nil)
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+	handler.ExportCustomer(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "customer-1.json")
+
+	var export models.CustomerExport
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &export})
+	assert.Equal(t, "sebbievilar2@gmail.com", export.Customer.Email)
+	assert.Len(t, export.Orders, 1)
+	assert.Len(t, export.ArchivedOrders, 1)
+	assert.Len(t, export.SMSMessages, 1)
+	assert.Empty(t, export.NotificationAttempts)
+	assert.Len(t, export.CodeHistory, 1)
+}
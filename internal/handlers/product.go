@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ProductHandler struct {
+	db     *gorm.DB
+	cache  services.CachePolicy
+	purger services.CachePurger
+}
+
+func NewProductHandler(db *gorm.DB) *ProductHandler {
+	return &ProductHandler{db: db, cache: services.DefaultCachePolicy()}
+}
+
+// WithCachePolicy sets how long the CDN may keep catalog responses
+func (h *ProductHandler) WithCachePolicy(policy services.CachePolicy) *ProductHandler {
+	h.cache = policy.WithDefaults()
+	return h
+}
+
+// WithCachePurger purges the CDN's copies of catalog responses a product
+// change affects
+func (h *ProductHandler) WithCachePurger(purger services.CachePurger) *ProductHandler {
+	h.purger = purger
+	return h
+}
+
+// CreateProduct creates a new stocked product
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.CreateProductRequest
+
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	product := models.Product{
+		Name:              req.Name,
+		SKU:               req.SKU,
+		Price:             req.Price,
+		StockQuantity:     req.StockQuantity,
+		LowStockThreshold: req.LowStockThreshold,
+	}
+
+	if err := db.Create(&product).Error; err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			respond.Error(c, http.StatusConflict, "product_exists", "product with this sku already exists")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to create product")
+		return
+	}
+
+	purgeCache(c, h.purger, services.CatalogCacheKey)
+	respond.OK(c, http.StatusCreated, product)
+}
+
+func (h *ProductHandler) GetProducts(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseFilter(c, productFilterFields)
+	if !ok {
+		return
+	}
+
+	var products []models.Product
+
+	query := db.Model(&models.Product{}).Scopes(filter.Scope)
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve products")
+		return
+	}
+
+	if err := query.Scopes(scopes.Paginate(page)).Find(&products).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve products")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, products, page.MetaOf(total, len(products)))
+}
+
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid product id")
+		return
+	}
+
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "product_not_found", "product not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve product")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, product)
+}
+
+// UpdateProduct updates product details, including restocking
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid product id")
+		return
+	}
+
+	var req models.UpdateProductRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "product_not_found", "product not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve product")
+		return
+	}
+
+	if req.Name != "" {
+		product.Name = req.Name
+	}
+	if req.Price != nil {
+		product.Price = *req.Price
+	}
+	if req.StockQuantity != nil {
+		product.StockQuantity = *req.StockQuantity
+	}
+	if req.LowStockThreshold != nil {
+		product.LowStockThreshold = *req.LowStockThreshold
+	}
+
+	if err := db.Save(&product).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to update product")
+		return
+	}
+
+	purgeCache(c, h.purger, services.ProductCacheKey(product.ID))
+	respond.OK(c, http.StatusOK, product)
+}
+
+// GetLowStockProducts lists products at or below their low stock threshold
+func (h *ProductHandler) GetLowStockProducts(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var products []models.Product
+
+	if err := db.Where("stock_quantity <= low_stock_threshold").Order("stock_quantity ASC").Find(&products).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve low stock products")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, products, gin.H{"total": len(products)})
+}
+
+// GetCatalog is the public, CDN cached product list. Every page is tagged
+// with the catalog key and the key of each product on it, so adding a
+// product or changing one on the page evicts it.
+func (h *ProductHandler) GetCatalog(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	var products []models.Product
+
+	total, err := page.Total(db.Model(&models.Product{}))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve products")
+		return
+	}
+	if err := db.Order("id ASC").Scopes(scopes.Paginate(page)).Find(&products).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve products")
+		return
+	}
+
+	catalog := make([]models.CatalogProduct, len(products))
+	keys := []string{services.CatalogCacheKey}
+	for i, product := range products {
+		catalog[i] = product.ToCatalogProduct()
+		keys = append(keys, services.ProductCacheKey(product.ID))
+	}
+
+	middleware.CachePublicly(c, h.cache.CatalogTTL, keys...)
+	respond.OKWithMeta(c, http.StatusOK, catalog, page.MetaOf(total, len(catalog)))
+}
+
+// GetCatalogProduct is the public, CDN cached view of one product
+func (h *ProductHandler) GetCatalogProduct(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid product id")
+		return
+	}
+
+	var product models.Product
+	if err := db.First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "product_not_found", "product not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve product")
+		return
+	}
+
+	middleware.CachePublicly(c, h.cache.CatalogTTL, services.ProductCacheKey(product.ID))
+	respond.OK(c, http.StatusOK, product.ToCatalogProduct())
+}
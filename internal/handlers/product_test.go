@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateProduct(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		requestBody    models.CreateProductRequest
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "valid product creation",
+			requestBody: models.CreateProductRequest{
+				Name:              "Laptop",
+				SKU:               "SKU001",
+				Price:             models.Shillings(1500.00),
+				StockQuantity:     10,
+				LowStockThreshold: 2,
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name: "duplicate sku",
+			requestBody: models.CreateProductRequest{
+				Name: "Another Laptop",
+				SKU:  "SKU001",
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  "product_exists",
+		},
+		{
+			name: "negative stock",
+			requestBody: models.CreateProductRequest{
+				Name:          "Laptop",
+				SKU:           "SKU002",
+				StockQuantity: -1,
+			},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			handler := NewProductHandler(db)
+
+			if tt.name == "duplicate sku" {
+				if err := db.Create(&models.Product{Name: "Laptop", SKU: "SKU001"}).Error; err != nil {
+					t.Fatalf("failed to create product: %v", err)
+				}
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			jsonBody, _ := json.Marshal(tt.requestBody)
+			req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(jsonBody))
+			req.Header.Set("Content-Type", "application/json")
+			c.Request = req
+
+			handler.CreateProduct(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+			} else {
+				var product models.Product
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &product})
+				assert.Equal(t, tt.requestBody.SKU, product.SKU)
+				assert.Equal(t, tt.requestBody.StockQuantity, product.StockQuantity)
+			}
+		})
+	}
+}
+
+func TestGetLowStockProducts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewProductHandler(db)
+
+	products := []models.Product{
+		{Name: "Laptop", SKU: "SKU001", StockQuantity: 1, LowStockThreshold: 2},
+		{Name: "Phone", SKU: "SKU002", StockQuantity: 50, LowStockThreshold: 5},
+		{Name: "Tablet", SKU: "SKU003", StockQuantity: 5, LowStockThreshold: 5},
+	}
+	for _, product := range products {
+		if err := db.Create(&product).Error; err != nil {
+			t.Fatalf("failed to create product: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	req, _ := http.NewRequest("GET", "/products/low-stock", nil)
+	c.Request = req
+
+	handler.GetLowStockProducts(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var lowStock []models.Product
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &lowStock})
+	assert.Len(t, lowStock, 2)
+	assert.Equal(t, "SKU001", lowStock[0].SKU)
+	assert.Equal(t, "SKU003", lowStock[1].SKU)
+}
+
+func TestGetCatalog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewProductHandler(db)
+
+	products := []models.Product{
+		{Name: "Laptop", SKU: "SKU001", Price: models.Shillings(1500), StockQuantity: 3, LowStockThreshold: 2},
+		{Name: "Phone", SKU: "SKU002", Price: models.Shillings(800), StockQuantity: 0},
+	}
+	for i := range products {
+		if err := db.Create(&products[i]).Error; err != nil {
+			t.Fatalf("failed to create product: %v", err)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/catalog/products", nil)
+
+	handler.GetCatalog(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "public, max-age=0, s-maxage=300", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "products product-1 product-2", w.Header().Get("Surrogate-Key"))
+	assert.NotContains(t, w.Body.String(), "stock_quantity")
+
+	var catalog []models.CatalogProduct
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &catalog})
+	assert.Len(t, catalog, 2)
+	assert.True(t, catalog[0].InStock)
+	assert.False(t, catalog[1].InStock)
+
+	tests := []struct {
+		name           string
+		id             string
+		expectedStatus int
+		expectedKey    string
+	}{
+		{name: "product", id: "2", expectedStatus: http.StatusOK, expectedKey: "product-2"},
+		{name: "missing product", id: "99", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/catalog/products/"+tt.id, nil)
+			c.Params = []gin.Param{{Key: "id", Value: tt.id}}
+
+			handler.WithCachePolicy(services.CachePolicy{CatalogTTL: time.Minute}).GetCatalogProduct(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedKey, w.Header().Get("Surrogate-Key"))
+		})
+	}
+}
+
+func TestProductChangesPurgeCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	purger := services.NewMockCachePurger()
+	handler := NewProductHandler(db).WithCachePurger(purger)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	body, _ := json.Marshal(models.CreateProductRequest{Name: "Laptop", SKU: "SKU001", Price: models.Shillings(1500)})
+	c.Request, _ = http.NewRequest("POST", "/products", bytes.NewBuffer(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.CreateProduct(c)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("PUT", "/products/1", bytes.NewBufferString(`{"price": 1400}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+	handler.UpdateProduct(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Eventually(t, func() bool {
+		return len(purger.Purged()) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"products", "product-1"}, purger.Purged())
+}
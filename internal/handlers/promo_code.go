@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PromoCodeHandler lets admins manage the promo codes customers place
+// orders with
+type PromoCodeHandler struct {
+	promos *services.PromoCodeService
+	audit  services.AuditRecorder
+}
+
+func NewPromoCodeHandler(promos *services.PromoCodeService) *PromoCodeHandler {
+	return &PromoCodeHandler{promos: promos}
+}
+
+// WithAudit records codes created, changed and deleted
+func (h *PromoCodeHandler) WithAudit(audit services.AuditRecorder) *PromoCodeHandler {
+	h.audit = audit
+	return h
+}
+
+// CreatePromoCode adds an active code. Codes are stored in upper case, and
+// one already taken is 409.
+func (h *PromoCodeHandler) CreatePromoCode(c *gin.Context) {
+	var req models.CreatePromoCodeRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	promo := models.PromoCode{
+		Code:           req.Code,
+		Description:    strings.TrimSpace(req.Description),
+		Type:           req.Type,
+		MinAmount:      req.MinAmount,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		MaxRedemptions: req.MaxRedemptions,
+		MaxPerCustomer: req.MaxPerCustomer,
+		CreatedBy:      middleware.CurrentUserEmail(c),
+	}
+	if promo.Type == models.PromoCodePercentage {
+		promo.PercentOff = req.PercentOff
+	} else {
+		promo.AmountOff = req.AmountOff
+	}
+	if err := h.promos.Create(c.Request.Context(), &promo); err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			respond.Error(c, http.StatusConflict, "promo_code_taken", "promo code already exists")
+			return
+		}
+		promoCodeAdminError(c, err, "failed to create promo code")
+		return
+	}
+	h.record(c, models.AuditPromoCodeCreated, promo)
+
+	respond.Created(c, fmt.Sprintf("/api/v1/admin/promo-codes/%d", promo.ID), promo.ID, promo.UpdatedAt, promo)
+}
+
+// GetPromoCodes lists codes, newest first, with how often each was used
+func (h *PromoCodeHandler) GetPromoCodes(c *gin.Context) {
+	promos, err := h.promos.PromoCodes(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve promo codes")
+		return
+	}
+	respond.OK(c, http.StatusOK, promos)
+}
+
+func (h *PromoCodeHandler) GetPromoCode(c *gin.Context) {
+	id, ok := promoCodeID(c)
+	if !ok {
+		return
+	}
+	promo, err := h.promos.PromoCode(c.Request.Context(), id)
+	if err != nil {
+		promoCodeAdminError(c, err, "failed to retrieve promo code")
+		return
+	}
+	respond.OK(c, http.StatusOK, promo)
+}
+
+func (h *PromoCodeHandler) UpdatePromoCode(c *gin.Context) {
+	id, ok := promoCodeID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdatePromoCodeRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	promo, err := h.promos.Update(c.Request.Context(), id, req)
+	if err != nil {
+		promoCodeAdminError(c, err, "failed to update promo code")
+		return
+	}
+	h.record(c, models.AuditPromoCodeUpdated, promo)
+
+	respond.OK(c, http.StatusOK, promo)
+}
+
+// DeletePromoCode stops a code being used. Its name stays taken.
+func (h *PromoCodeHandler) DeletePromoCode(c *gin.Context) {
+	id, ok := promoCodeID(c)
+	if !ok {
+		return
+	}
+	promo, err := h.promos.Delete(c.Request.Context(), id)
+	if err != nil {
+		promoCodeAdminError(c, err, "failed to delete promo code")
+		return
+	}
+	h.record(c, models.AuditPromoCodeDeleted, promo)
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "promo code deleted successfully"})
+}
+
+func promoCodeID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid promo code id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func promoCodeAdminError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrPromoCodeNotFound):
+		respond.Error(c, http.StatusNotFound, "promo_code_not_found", "promo code not found")
+	case errors.Is(err, services.ErrInvalidPromoWindow):
+		respond.Error(c, http.StatusBadRequest, "invalid_promo_window", "ends_at must be after starts_at")
+	default:
+		respond.ServerError(c, err, "database_error", message)
+	}
+}
+
+// promoCodeError answers an order whose promo code could not be applied,
+// reporting whether err was such an error
+func promoCodeError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrPromoCodeNotFound):
+		respond.Error(c, http.StatusUnprocessableEntity, "promo_code_not_found", "promo code not found")
+	case errors.Is(err, services.ErrPromoCodeNotActive):
+		respond.Error(c, http.StatusUnprocessableEntity, "promo_code_not_active", "promo code is not active")
+	case errors.Is(err, services.ErrPromoCodeMinAmount):
+		respond.Error(c, http.StatusUnprocessableEntity, "promo_code_min_amount", err.Error())
+	case errors.Is(err, services.ErrPromoCodeUsedUp):
+		respond.Error(c, http.StatusConflict, "promo_code_used_up", "promo code has been used up")
+	case errors.Is(err, services.ErrPromoCodeAlreadyUsed):
+		respond.Error(c, http.StatusConflict, "promo_code_already_used", "customer has already used this promo code")
+	default:
+		return false
+	}
+	return true
+}
+
+func (h *PromoCodeHandler) record(c *gin.Context, eventType string, promo models.PromoCode) {
+	if h.audit == nil {
+		return
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   fmt.Sprintf("promo_code=%d code=%s type=%s active=%t", promo.ID, promo.Code, promo.Type, promo.Active),
+	})
+}
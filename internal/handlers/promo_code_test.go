@@ -0,0 +1,145 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil/apptest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromoCodeRoutes(t *testing.T) {
+	r := apptest.NewRouter(t, apptest.Config())
+	admin := testutil.Token(t, apptest.Admin)
+	agent := testutil.Token(t, "agent@example.com")
+	christmas := map[string]interface{}{"code": "xmas25", "type": "percentage", "percent_off": 25, "min_amount": 1000, "max_per_customer": 1}
+
+	var created models.PromoCode
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "only admins manage codes",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(agent).WithJSON(christmas),
+			Status:  http.StatusForbidden,
+			Code:    "forbidden",
+		},
+		{
+			Name:    "percentage needs percent_off",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(admin).WithJSON(map[string]interface{}{"code": "XMAS25", "type": "percentage", "amount_off": 100}),
+			Status:  http.StatusBadRequest,
+		},
+		{
+			Name:    "invalid code",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(admin).WithJSON(map[string]interface{}{"code": "XMAS 25", "type": "fixed", "amount_off": 100}),
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_promo_code",
+		},
+		{
+			Name:    "ends before it starts",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(admin).WithJSON(map[string]interface{}{"code": "LATE", "type": "fixed", "amount_off": 100, "starts_at": "2030-12-26T00:00:00Z", "ends_at": "2030-12-01T00:00:00Z"}),
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_promo_window",
+		},
+		{
+			Name:    "creates",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(admin).WithJSON(christmas),
+			Status:  http.StatusCreated,
+			Check: func(t *testing.T, w *testutil.Response) {
+				w.Data(&created)
+				assert.Equal(t, "XMAS25", created.Code)
+				assert.True(t, created.Active)
+				assert.Equal(t, apptest.Admin, created.CreatedBy)
+				assert.Equal(t, fmt.Sprintf("/api/v1/admin/promo-codes/%d", created.ID), w.Header().Get("Location"))
+			},
+		},
+		{
+			Name:    "taken",
+			Request: testutil.NewRequest("POST", "/api/v1/admin/promo-codes").WithToken(admin).WithJSON(map[string]interface{}{"code": "Xmas25", "type": "fixed", "amount_off": 100}),
+			Status:  http.StatusConflict,
+			Code:    "promo_code_taken",
+		},
+	})
+
+	customer := testutil.NewCustomer(t).WithPhone("+254740827150").Create(r.DB)
+	order := func(code string, amount float64) *testutil.Request {
+		return testutil.NewRequest("POST", "/api/v1/orders").WithToken(agent).WithJSON(map[string]interface{}{
+			"item": "hamper", "amount": amount, "time": time.Now().Add(-time.Minute), "customer_id": customer.ID, "promo_code": code,
+		})
+	}
+
+	var placed models.Order
+	testutil.Run(t, r, []testutil.Case{
+		{Name: "unknown code", Request: order("NOPE25", 2000), Status: http.StatusUnprocessableEntity, Code: "promo_code_not_found"},
+		{Name: "below the minimum", Request: order("xmas25", 999), Status: http.StatusUnprocessableEntity, Code: "promo_code_min_amount"},
+		{
+			Name:    "takes the discount off before tax",
+			Request: order("xmas25", 2000),
+			Status:  http.StatusCreated,
+			Check: func(t *testing.T, w *testutil.Response) {
+				w.Data(&placed)
+				assert.Equal(t, models.Shillings(1500), placed.Amount)
+				assert.Equal(t, models.Shillings(500), placed.DiscountAmount)
+				assert.Equal(t, "XMAS25", *placed.PromoCode)
+				assert.Equal(t, models.Shillings(1500), placed.GrossAmount)
+				assert.Equal(t, placed.GrossAmount, placed.NetAmount+placed.TaxAmount)
+			},
+		},
+		{Name: "once per customer", Request: order("XMAS25", 2000), Status: http.StatusConflict, Code: "promo_code_already_used"},
+		{
+			Name:    "duplicates are placed at full price",
+			Request: testutil.NewRequest("POST", "/api/v1/orders/1/duplicate").WithToken(agent),
+			Status:  http.StatusCreated,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var duplicate models.Order
+				w.Data(&duplicate)
+				assert.Equal(t, models.Shillings(2000), duplicate.Amount)
+				assert.Nil(t, duplicate.PromoCode)
+			},
+		},
+	})
+
+	var redemption models.PromoRedemption
+	require.NoError(t, r.DB.First(&redemption).Error)
+	assert.Equal(t, placed.ID, redemption.OrderID)
+	assert.Equal(t, models.Shillings(500), redemption.Discount)
+
+	off := false
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "counts uses",
+			Request: testutil.NewRequest("GET", fmt.Sprintf("/api/v1/admin/promo-codes/%d", created.ID)).WithToken(admin),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var got models.PromoCode
+				w.Data(&got)
+				assert.Equal(t, 1, got.Redemptions)
+			},
+		},
+		{
+			Name:    "switches off",
+			Request: testutil.NewRequest("PUT", fmt.Sprintf("/api/v1/admin/promo-codes/%d", created.ID)).WithToken(admin).WithJSON(models.UpdatePromoCodeRequest{Active: &off}),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *testutil.Response) {
+				var got models.PromoCode
+				w.Data(&got)
+				assert.False(t, got.Active)
+			},
+		},
+		{Name: "switched off", Request: order("XMAS25", 2000), Status: http.StatusUnprocessableEntity, Code: "promo_code_not_active"},
+		{
+			Name:    "deletes",
+			Request: testutil.NewRequest("DELETE", fmt.Sprintf("/api/v1/admin/promo-codes/%d", created.ID)).WithToken(admin),
+			Status:  http.StatusOK,
+		},
+		{
+			Name:    "not found",
+			Request: testutil.NewRequest("GET", fmt.Sprintf("/api/v1/admin/promo-codes/%d", created.ID)).WithToken(admin),
+			Status:  http.StatusNotFound,
+			Code:    "promo_code_not_found",
+		},
+	})
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	errQuoteExpired = errors.New("quote has expired")
+	errQuoteNotHeld = errors.New("quote is no longer held")
+)
+
+// WithQuoteHold sets how long quotes hold their stock and price unless
+// the request asks otherwise
+func (h *OrderHandler) WithQuoteHold(hold time.Duration) *OrderHandler {
+	if hold > 0 {
+		h.quoteHold = hold
+	}
+	return h
+}
+
+// CreateQuote prices an item for a customer and holds its stock and price
+// until the quote expires. Products are priced from the catalog; other
+// items at the amount given.
+func (h *OrderHandler) CreateQuote(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.CreateQuoteRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+	if req.ProductID == nil && (req.Item == "" || req.Amount <= 0) {
+		respond.Error(c, http.StatusBadRequest, "invalid_request", "item and amount are required without a product_id")
+		return
+	}
+
+	quote := models.Quote{
+		CustomerID: req.CustomerID,
+		ProductID:  req.ProductID,
+		Item:       req.Item,
+		Quantity:   req.Quantity,
+		Amount:     req.Amount,
+		Priority:   req.Priority,
+		Status:     models.QuoteStatusHeld,
+		ExpiresAt:  time.Now().Add(h.quoteHold),
+	}
+	if quote.Quantity == 0 {
+		quote.Quantity = 1
+	}
+	if quote.Priority == "" {
+		quote.Priority = models.OrderPriorityNormal
+	}
+	if req.HoldMinutes > 0 {
+		quote.ExpiresAt = time.Now().Add(time.Duration(req.HoldMinutes) * time.Minute)
+	}
+
+	var product models.Product
+	err := services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&models.Customer{}, quote.CustomerID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errCustomerNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if quote.ProductID != nil {
+			if product, err = reserveStock(tx, *quote.ProductID, quote.Quantity); err != nil {
+				return err
+			}
+			quote.Amount = product.Price.Times(quote.Quantity)
+			if quote.Item == "" {
+				quote.Item = product.Name
+			}
+		}
+		quote.UnitPrice = quote.Amount.Scale(1 / float64(quote.Quantity))
+		h.priceQuote(&quote)
+		return tx.Create(&quote).Error
+	})
+	if err != nil {
+		if errors.Is(err, errCustomerNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return
+		}
+		if errors.Is(err, errInsufficientStock) {
+			respond.Error(c, http.StatusConflict, "insufficient_stock", fmt.Sprintf("only %d units of %s in stock", product.StockQuantity, product.Name))
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "product_not_found", "product not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to create quote")
+		return
+	}
+
+	respond.Created(c, fmt.Sprintf("/api/v1/quotes/%d", quote.ID), quote.ID, quote.UpdatedAt, quote)
+}
+
+// priceQuote applies the current tax policy to the quote, as placing the
+// order now would
+func (h *OrderHandler) priceQuote(quote *models.Quote) {
+	order := models.Order{Amount: quote.Amount}
+	h.tax.Apply(&order)
+	quote.TaxRate = order.TaxRate
+	quote.TaxInclusive = order.TaxInclusive
+	quote.NetAmount = order.NetAmount
+	quote.TaxAmount = order.TaxAmount
+	quote.GrossAmount = order.GrossAmount
+}
+
+func (h *OrderHandler) GetQuote(c *gin.Context) {
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+	respond.OK(c, http.StatusOK, quote)
+}
+
+// ConfirmQuote places the quote's order at the quoted price, with the stock
+// it held. The quote is claimed in the order's transaction, so it is
+// confirmed into exactly one order.
+func (h *OrderHandler) ConfirmQuote(c *gin.Context) {
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+
+	h.placeOrder(c, models.Order{
+		Item:         quote.Item,
+		Amount:       quote.Amount,
+		TaxRate:      quote.TaxRate,
+		TaxInclusive: quote.TaxInclusive,
+		Time:         time.Now(),
+		CustomerID:   quote.CustomerID,
+		ProductID:    quote.ProductID,
+		Quantity:     quote.Quantity,
+		Priority:     quote.Priority,
+	}, &quote)
+}
+
+// CancelQuote releases a held quote's stock
+func (h *OrderHandler) CancelQuote(c *gin.Context) {
+	quote, ok := h.findQuote(c)
+	if !ok {
+		return
+	}
+
+	var released bool
+	err := services.WithTx(c.Request.Context(), h.db, func(tx *gorm.DB) error {
+		var err error
+		released, err = services.ReleaseQuote(tx, quote, models.QuoteStatusCancelled)
+		return err
+	})
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to cancel quote")
+		return
+	}
+	if !released {
+		respond.Error(c, http.StatusConflict, "quote_not_held", fmt.Sprintf("quote is %s", quote.Status))
+		return
+	}
+
+	quote.Status = models.QuoteStatusCancelled
+	respond.OK(c, http.StatusOK, quote)
+}
+
+func (h *OrderHandler) findQuote(c *gin.Context) (models.Quote, bool) {
+	var quote models.Quote
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid quote id")
+		return quote, false
+	}
+
+	if err := h.db.WithContext(c.Request.Context()).First(&quote, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "quote_not_found", "quote not found")
+			return quote, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve quote")
+		return quote, false
+	}
+	return quote, true
+}
+
+// claimQuote marks a held quote confirmed. It fails with errQuoteExpired
+// once the quote's time is up, even before the expiry job releases it, and
+// with errQuoteNotHeld when it was confirmed or cancelled already.
+func claimQuote(tx *gorm.DB, quote *models.Quote) error {
+	now := time.Now()
+	res := tx.Model(&models.Quote{}).
+		Where("id = ? AND status = ? AND expires_at > ?", quote.ID, models.QuoteStatusHeld, now).
+		Updates(map[string]interface{}{"status": models.QuoteStatusConfirmed, "confirmed_at": now})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 1 {
+		quote.Status = models.QuoteStatusConfirmed
+		quote.ConfirmedAt = &now
+		return nil
+	}
+
+	if err := tx.First(quote, quote.ID).Error; err != nil {
+		return err
+	}
+	if quote.Status == models.QuoteStatusExpired || quote.Status == models.QuoteStatusHeld {
+		return errQuoteExpired
+	}
+	return errQuoteNotHeld
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupQuoteRouter(t *testing.T) (*gin.Engine, *OrderHandler) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewOrderHandler(db, services.NewMockSMSService())
+
+	r := gin.New()
+	r.POST("/quotes", handler.CreateQuote)
+	r.GET("/quotes/:id", handler.GetQuote)
+	r.POST("/quotes/:id/confirm", handler.ConfirmQuote)
+	r.DELETE("/quotes/:id", handler.CancelQuote)
+
+	require.NoError(t, db.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}).Error)
+	require.NoError(t, db.Create(&models.Product{Name: "Laptop", SKU: "LAP-001", Price: models.Shillings(1500), StockQuantity: 5}).Error)
+	return r, handler
+}
+
+func quoteRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func stock(t *testing.T, handler *OrderHandler) int {
+	var product models.Product
+	require.NoError(t, handler.db.First(&product, 1).Error)
+	return product.StockQuantity
+}
+
+func TestCreateQuote(t *testing.T) {
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+		expectedAmount models.Money
+		expectedStock  int
+	}{
+		{
+			name:           "product priced from the catalog",
+			body:           `{"customer_id": 1, "product_id": 1, "quantity": 2}`,
+			expectedStatus: http.StatusCreated,
+			expectedAmount: models.Shillings(3000),
+			expectedStock:  3,
+		},
+		{
+			name:           "item at a given amount",
+			body:           `{"customer_id": 1, "item": "delivery", "amount": 250}`,
+			expectedStatus: http.StatusCreated,
+			expectedAmount: models.Shillings(250),
+			expectedStock:  5,
+		},
+		{
+			name:           "item without amount",
+			body:           `{"customer_id": 1, "item": "delivery"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+			expectedStock:  5,
+		},
+		{
+			name:           "more than in stock",
+			body:           `{"customer_id": 1, "product_id": 1, "quantity": 6}`,
+			expectedStatus: http.StatusConflict,
+			expectedError:  "insufficient_stock",
+			expectedStock:  5,
+		},
+		{
+			name:           "unknown customer",
+			body:           `{"customer_id": 99, "product_id": 1}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "customer_not_found",
+			expectedStock:  5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, handler := setupQuoteRouter(t)
+
+			w := quoteRequest(r, "POST", "/quotes", tt.body)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStock, stock(t, handler))
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var quote models.Quote
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &quote})
+			assert.Equal(t, models.QuoteStatusHeld, quote.Status)
+			assert.Equal(t, tt.expectedAmount, quote.Amount)
+			assert.Equal(t, tt.expectedAmount, quote.GrossAmount)
+			assert.Equal(t, quote.GrossAmount, quote.NetAmount+quote.TaxAmount)
+			assert.WithinDuration(t, time.Now().Add(services.DefaultQuoteHold), quote.ExpiresAt, time.Minute)
+		})
+	}
+}
+
+func TestConfirmQuote(t *testing.T) {
+	r, handler := setupQuoteRouter(t)
+
+	w := quoteRequest(r, "POST", "/quotes", `{"customer_id": 1, "product_id": 1, "quantity": 2, "hold_minutes": 30}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var quote models.Quote
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &quote})
+
+	// the catalog price goes up after the quote
+	require.NoError(t, handler.db.Model(&models.Product{}).Where("id = 1").Update("price", 1800).Error)
+	handler.WithTaxPolicy(services.TaxPolicy{RatePercent: 20, Inclusive: false})
+
+	w = quoteRequest(r, "POST", fmt.Sprintf("/quotes/%d/confirm", quote.ID), "")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var order models.Order
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+	assert.Equal(t, models.Shillings(3000), order.Amount)
+	assert.Equal(t, quote.GrossAmount, order.GrossAmount)
+	assert.Equal(t, quote.TaxAmount, order.TaxAmount)
+	assert.Equal(t, 2, order.Quantity)
+	// the stock held by the quote is not taken again
+	assert.Equal(t, 3, stock(t, handler))
+
+	w = quoteRequest(r, "GET", fmt.Sprintf("/quotes/%d", quote.ID), "")
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &quote})
+	assert.Equal(t, models.QuoteStatusConfirmed, quote.Status)
+	if assert.NotNil(t, quote.OrderID) {
+		assert.Equal(t, order.ID, *quote.OrderID)
+	}
+
+	// a quote is confirmed into one order only
+	w = quoteRequest(r, "POST", fmt.Sprintf("/quotes/%d/confirm", quote.ID), "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = quoteRequest(r, "DELETE", fmt.Sprintf("/quotes/%d", quote.ID), "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var orders int64
+	handler.db.Model(&models.Order{}).Count(&orders)
+	assert.Equal(t, int64(1), orders)
+}
+
+func TestQuoteExpiry(t *testing.T) {
+	r, handler := setupQuoteRouter(t)
+
+	w := quoteRequest(r, "POST", "/quotes", `{"customer_id": 1, "product_id": 1, "quantity": 2}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var quote models.Quote
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &quote})
+	require.NoError(t, handler.db.Model(&quote).Update("expires_at", time.Now().Add(-time.Second)).Error)
+
+	w = quoteRequest(r, "POST", fmt.Sprintf("/quotes/%d/confirm", quote.ID), "")
+	assert.Equal(t, http.StatusGone, w.Code)
+	assert.Equal(t, 3, stock(t, handler), "stock is held until the expiry job runs")
+
+	expired, err := services.ExpireQuotes(context.Background(), handler.db)
+	require.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	assert.Equal(t, 5, stock(t, handler))
+
+	w = quoteRequest(r, "POST", fmt.Sprintf("/quotes/%d/confirm", quote.ID), "")
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestCancelQuote(t *testing.T) {
+	r, handler := setupQuoteRouter(t)
+
+	w := quoteRequest(r, "POST", "/quotes", `{"customer_id": 1, "product_id": 1, "quantity": 2}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var quote models.Quote
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &quote})
+
+	w = quoteRequest(r, "DELETE", fmt.Sprintf("/quotes/%d", quote.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 5, stock(t, handler))
+
+	w = quoteRequest(r, "POST", fmt.Sprintf("/quotes/%d/confirm", quote.ID), "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = quoteRequest(r, "GET", "/quotes/99", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
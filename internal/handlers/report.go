@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type ReportHandler struct {
+	reports *services.ReportService
+	winBack *services.WinBackService
+}
+
+func NewReportHandler(reports *services.ReportService) *ReportHandler {
+	return &ReportHandler{reports: reports}
+}
+
+// WithWinBack enables the win-back campaign report
+func (h *ReportHandler) WithWinBack(winBack *services.WinBackService) *ReportHandler {
+	h.winBack = winBack
+	return h
+}
+
+func (h *ReportHandler) GetDailyReport(c *gin.Context) {
+	h.series(c, services.ReportDaily, 0, 0, -30)
+}
+
+func (h *ReportHandler) GetWeeklyReport(c *gin.Context) {
+	h.series(c, services.ReportWeekly, 0, 0, -7*12)
+}
+
+func (h *ReportHandler) GetMonthlyReport(c *gin.Context) {
+	h.series(c, services.ReportMonthly, 0, -12, 0)
+}
+
+// GetVATReport totals VAT per month, for the last 12 months by default
+func (h *ReportHandler) GetVATReport(c *gin.Context) {
+	from, to, ok := h.parseRange(c, 0, -11, 0)
+	if !ok {
+		return
+	}
+
+	points, err := h.reports.VATSummary(c.Request.Context(), from, to)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to build vat report")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, points, gin.H{
+		"from": from.Format(services.DayLayout),
+		"to":   to.Format(services.DayLayout),
+	})
+}
+
+// GetOrderHeatmap counts orders by weekday and hour, for the last 4 weeks
+// by default
+func (h *ReportHandler) GetOrderHeatmap(c *gin.Context) {
+	from, to, ok := h.parseRange(c, 0, 0, -27)
+	if !ok {
+		return
+	}
+
+	cells, err := h.reports.OrderHeatmap(c.Request.Context(), from, to)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to build order heatmap")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, cells, gin.H{
+		"from":     from.Format(services.DayLayout),
+		"to":       to.Format(services.DayLayout),
+		"timezone": h.reports.Location().String(),
+	})
+}
+
+// GetWinBackReport counts the win-back messages sent in a period, the last
+// 90 days by default, and lists the customers who ordered again after one
+func (h *ReportHandler) GetWinBackReport(c *gin.Context) {
+	if h.winBack == nil {
+		respond.Error(c, http.StatusNotFound, "not_found", "resource not found")
+		return
+	}
+	from, to, ok := h.parseRange(c, 0, 0, -89)
+	if !ok {
+		return
+	}
+
+	report, err := h.winBack.Report(c.Request.Context(), from, to)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to build win-back report")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, report, gin.H{
+		"from": from.Format(services.DayLayout),
+		"to":   to.Format(services.DayLayout),
+	})
+}
+
+// GetOrderTotals counts and sums orders per customer, item or day, taking
+// the same filters as the order list so the figures match it
+func (h *ReportHandler) GetOrderTotals(c *gin.Context) {
+	groupBy := c.Query("group_by")
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+
+	customerID, ok := parseCustomerFilter(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filters, ok := parseOrderFilters(c, orderFilterFields)
+	if !ok {
+		return
+	}
+
+	totals, total, err := h.reports.OrderTotals(c.Request.Context(), groupBy, page,
+		scopes.ByCustomer(customerID), scopes.CreatedBetween(from, to), filters.scope)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidGrouping) {
+			respond.Error(c, http.StatusBadRequest, "invalid_group_by", err.Error())
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to total orders")
+		return
+	}
+
+	meta := page.Meta(total)
+	respond.OKWithMeta(c, http.StatusOK, totals, gin.H{
+		"total":       meta.Total,
+		"page":        meta.Page,
+		"limit":       meta.Limit,
+		"total_pages": meta.TotalPages,
+		"has_next":    meta.HasNext,
+		"group_by":    groupBy,
+		"timezone":    h.reports.Location().String(),
+	})
+}
+
+// RefreshReports rebuilds the daily aggregates for a date range, e.g. after
+// backfilling or correcting historical orders
+func (h *ReportHandler) RefreshReports(c *gin.Context) {
+	from, to, ok := h.parseRange(c, 0, 0, -1)
+	if !ok {
+		return
+	}
+
+	if err := h.reports.RefreshDailyStats(c.Request.Context(), from, to); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to refresh reports")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{
+		"message": "reports refreshed",
+		"from":    from.Format(services.DayLayout),
+		"to":      to.Format(services.DayLayout),
+	})
+}
+
+func (h *ReportHandler) series(c *gin.Context, period string, years, months, days int) {
+	from, to, ok := h.parseRange(c, years, months, days)
+	if !ok {
+		return
+	}
+
+	points, err := h.reports.Series(c.Request.Context(), period, from, to)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to build report")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, points, gin.H{
+		"period": period,
+		"from":   from.Format(services.DayLayout),
+		"to":     to.Format(services.DayLayout),
+	})
+}
+
+// parseRange reads ?from= and ?to= (YYYY-MM-DD). to defaults to today and
+// from defaults to to shifted by the given offset.
+func (h *ReportHandler) parseRange(c *gin.Context, years, months, days int) (time.Time, time.Time, bool) {
+	location := h.reports.Location()
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := time.ParseInLocation(services.DayLayout, raw, location)
+		if err != nil {
+			h.invalidRange(c, "to must be a date in YYYY-MM-DD format")
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+
+	from := to.AddDate(years, months, days)
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.ParseInLocation(services.DayLayout, raw, location)
+		if err != nil {
+			h.invalidRange(c, "from must be a date in YYYY-MM-DD format")
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		h.invalidRange(c, "from must not be after to")
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+func (h *ReportHandler) invalidRange(c *gin.Context, message string) {
+	respond.Error(c, http.StatusBadRequest, "invalid_range", message)
+}
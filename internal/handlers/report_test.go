@@ -0,0 +1,429 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReports(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	reportService := services.NewReportService(db, time.UTC)
+	handler := NewReportHandler(reportService)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	// Monday 1st and Tuesday 2nd of September, then the following Monday
+	orders := []models.Order{
+		{Item: "laptop", Amount: models.Shillings(1000), Time: time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC), Status: models.OrderStatusPending},
+		{Item: "phone", Amount: models.Shillings(500), Time: time.Date(2025, 9, 1, 15, 0, 0, 0, time.UTC), Status: models.OrderStatusDelivered},
+		{Item: "tablet", Amount: models.Shillings(250), Time: time.Date(2025, 9, 2, 10, 0, 0, 0, time.UTC), Status: models.OrderStatusPending},
+		{Item: "mouse", Amount: models.Shillings(100), Time: time.Date(2025, 9, 2, 11, 0, 0, 0, time.UTC), Status: models.OrderStatusCancelled},
+		{Item: "monitor", Amount: models.Shillings(300), Time: time.Date(2025, 9, 8, 12, 0, 0, 0, time.UTC), Status: models.OrderStatusPending},
+	}
+	for _, order := range orders {
+		order.CustomerID = customer.ID
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	from := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 9, 8, 0, 0, 0, 0, time.UTC)
+	if err := reportService.RefreshDailyStats(context.Background(), from, to); err != nil {
+		t.Fatalf("failed to refresh stats: %v", err)
+	}
+	// refreshing again must update rows in place rather than duplicate them
+	if err := reportService.RefreshDailyStats(context.Background(), from, to); err != nil {
+		t.Fatalf("failed to refresh stats: %v", err)
+	}
+
+	var statCount int64
+	db.Model(&models.DailyOrderStat{}).Count(&statCount)
+	assert.Equal(t, int64(8), statCount)
+
+	tests := []struct {
+		name           string
+		handle         gin.HandlerFunc
+		query          string
+		expectedStatus int
+		expectedSeries []models.ReportPoint
+	}{
+		{
+			name:           "daily series",
+			handle:         handler.GetDailyReport,
+			query:          "from=2025-09-01&to=2025-09-02",
+			expectedStatus: http.StatusOK,
+			expectedSeries: []models.ReportPoint{
+				{PeriodStart: "2025-09-01", OrdersCount: 2, Revenue: models.Shillings(1500)},
+				{PeriodStart: "2025-09-02", OrdersCount: 1, Revenue: models.Shillings(250)},
+			},
+		},
+		{
+			name:           "weekly series",
+			handle:         handler.GetWeeklyReport,
+			query:          "from=2025-09-01&to=2025-09-14",
+			expectedStatus: http.StatusOK,
+			expectedSeries: []models.ReportPoint{
+				{PeriodStart: "2025-09-01", OrdersCount: 3, Revenue: models.Shillings(1750)},
+				{PeriodStart: "2025-09-08", OrdersCount: 1, Revenue: models.Shillings(300)},
+			},
+		},
+		{
+			name:           "monthly series",
+			handle:         handler.GetMonthlyReport,
+			query:          "from=2025-09-01&to=2025-09-30",
+			expectedStatus: http.StatusOK,
+			expectedSeries: []models.ReportPoint{
+				{PeriodStart: "2025-09-01", OrdersCount: 4, Revenue: models.Shillings(2050)},
+			},
+		},
+		{
+			name:           "invalid range",
+			handle:         handler.GetDailyReport,
+			query:          "from=2025-09-10&to=2025-09-01",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/reports?"+tt.query, nil)
+
+			tt.handle(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedSeries == nil {
+				return
+			}
+
+			var series []models.ReportPoint
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &series})
+			assert.Len(t, series, len(tt.expectedSeries))
+			for i, expected := range tt.expectedSeries {
+				assert.Equal(t, expected.PeriodStart, series[i].PeriodStart)
+				assert.Equal(t, expected.OrdersCount, series[i].OrdersCount)
+				assert.Equal(t, expected.Revenue, series[i].Revenue)
+			}
+		})
+	}
+}
+
+func TestVATReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	reportService := services.NewReportService(db, time.UTC)
+	handler := NewReportHandler(reportService)
+	orderHandler := NewOrderHandler(db, services.NewMockSMSService()).WithTaxPolicy(services.DefaultTaxPolicy())
+	// the orders are placed on fixed dates, outside the default time window
+	validation.SetLimits(validation.Limits{OrderTimePast: 100 * 365 * 24 * time.Hour})
+	t.Cleanup(func() { validation.SetLimits(validation.DefaultLimits()) })
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	for _, body := range []string{
+		`{"item": "laptop", "amount": 1160, "time": "2025-09-01T09:00:00Z", "customer_id": 1}`,
+		`{"item": "phone", "amount": 580, "time": "2025-09-30T23:00:00Z", "customer_id": 1}`,
+		`{"item": "tablet", "amount": 232, "time": "2025-10-02T10:00:00Z", "customer_id": 1}`,
+		`{"item": "mouse", "amount": 116, "time": "2025-10-03T10:00:00Z", "customer_id": 1}`,
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/orders", strings.NewReader(body))
+		c.Request.Header.Set("Content-Type", "application/json")
+		orderHandler.CreateOrder(c)
+		if !assert.Equal(t, http.StatusCreated, w.Code) {
+			return
+		}
+	}
+
+	var laptop models.Order
+	db.Where("item = ?", "laptop").First(&laptop)
+	assert.Equal(t, models.Shillings(1000), laptop.NetAmount)
+	assert.Equal(t, models.Shillings(160), laptop.TaxAmount)
+	assert.Equal(t, models.Shillings(1160), laptop.GrossAmount)
+
+	db.Model(&models.Order{}).Where("item = ?", "mouse").Update("status", models.OrderStatusCancelled)
+	db.Create(&models.ArchivedOrder{ID: 100, Item: "desk", Amount: models.Shillings(116), NetAmount: models.Shillings(100), TaxAmount: models.Shillings(16), GrossAmount: models.Shillings(116),
+		Time: time.Date(2025, 10, 5, 0, 0, 0, 0, time.UTC), Status: models.OrderStatusDelivered, CustomerID: customer.ID, ArchivedAt: time.Now()})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/reports/vat?from=2025-08-15&to=2025-10-31", nil)
+
+	handler.GetVATReport(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var points []models.VATReportPoint
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &points})
+	assert.Equal(t, []models.VATReportPoint{
+		{Month: "2025-08"},
+		{Month: "2025-09", OrdersCount: 2, NetAmount: models.Shillings(1500), TaxAmount: models.Shillings(240), GrossAmount: models.Shillings(1740)},
+		{Month: "2025-10", OrdersCount: 2, NetAmount: models.Shillings(300), TaxAmount: models.Shillings(48), GrossAmount: models.Shillings(348)},
+	}, points)
+}
+
+func TestBackfillOrderTax(t *testing.T) {
+	db := testutil.DB(t)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	untaxed := models.Order{Item: "laptop", Amount: models.Shillings(1160), Time: time.Now(), CustomerID: customer.ID}
+	taxed := models.Order{Item: "phone", Amount: models.Shillings(500), Time: time.Now(), CustomerID: customer.ID}
+	services.TaxPolicy{RatePercent: 0, Inclusive: true}.Apply(&taxed)
+	db.Create(&untaxed)
+	db.Create(&taxed)
+
+	updated, err := services.BackfillOrderTax(context.Background(), db, services.DefaultTaxPolicy())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), updated)
+
+	db.First(&untaxed, untaxed.ID)
+	assert.Equal(t, models.Shillings(160), untaxed.TaxAmount)
+	assert.True(t, untaxed.TaxInclusive)
+
+	db.First(&taxed, taxed.ID)
+	assert.Equal(t, models.Shillings(0), taxed.TaxAmount)
+
+	// nothing is left to backfill
+	updated, err = services.BackfillOrderTax(context.Background(), db, services.DefaultTaxPolicy())
+	assert.NoError(t, err)
+	assert.Zero(t, updated)
+}
+
+func TestOrderHeatmap(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	handler := NewReportHandler(services.NewReportService(db, nairobi))
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	// 06:30 UTC on Monday 1st September is 09:30 in Nairobi, and 22:15 UTC
+	// on Sunday 7th is 01:15 on Monday 8th
+	for _, order := range []models.Order{
+		{Item: "laptop", Amount: models.Shillings(1000), Time: time.Date(2025, 9, 1, 6, 30, 0, 0, time.UTC), Status: models.OrderStatusPending},
+		{Item: "phone", Amount: models.Shillings(500), Time: time.Date(2025, 9, 1, 6, 45, 0, 0, time.UTC), Status: models.OrderStatusDelivered},
+		{Item: "mouse", Amount: models.Shillings(100), Time: time.Date(2025, 9, 1, 6, 50, 0, 0, time.UTC), Status: models.OrderStatusCancelled},
+		{Item: "tablet", Amount: models.Shillings(250), Time: time.Date(2025, 9, 7, 22, 15, 0, 0, time.UTC), Status: models.OrderStatusPending},
+		{Item: "monitor", Amount: models.Shillings(300), Time: time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC), Status: models.OrderStatusPending},
+	} {
+		order.CustomerID = customer.ID
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+	db.Create(&models.ArchivedOrder{ID: 100, Item: "desk", Amount: models.Shillings(116), Time: time.Date(2025, 9, 1, 7, 0, 0, 0, time.UTC),
+		Status: models.OrderStatusDelivered, CustomerID: customer.ID, ArchivedAt: time.Now()})
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCounts map[string]int64
+	}{
+		{
+			name:           "buckets in the report timezone",
+			query:          "from=2025-09-01&to=2025-09-08",
+			expectedStatus: http.StatusOK,
+			expectedCounts: map[string]int64{"monday 9": 2, "monday 10": 1, "monday 1": 1},
+		},
+		{
+			name:           "range excludes other days",
+			query:          "from=2025-09-20&to=2025-09-20",
+			expectedStatus: http.StatusOK,
+			expectedCounts: map[string]int64{"saturday 15": 1},
+		},
+		{
+			name:           "invalid range",
+			query:          "from=2025-09-08&to=2025-09-01",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/reports/orders/heatmap?"+tt.query, nil)
+
+			handler.GetOrderHeatmap(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var cells []models.HeatmapCell
+			var meta map[string]string
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &cells, Meta: &meta})
+			assert.Len(t, cells, 7*24)
+			assert.Equal(t, models.HeatmapCell{Weekday: "monday", Hour: 0}, cells[0])
+			assert.Equal(t, "Africa/Nairobi", meta["timezone"])
+
+			counts := map[string]int64{}
+			for _, cell := range cells {
+				if cell.OrdersCount > 0 {
+					counts[cell.Weekday+" "+strconv.Itoa(cell.Hour)] = cell.OrdersCount
+				}
+			}
+			assert.Equal(t, tt.expectedCounts, counts)
+		})
+	}
+}
+
+func TestGetOrderTotals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	if err != nil {
+		t.Fatalf("failed to load timezone: %v", err)
+	}
+	handler := NewReportHandler(services.NewReportService(db, nairobi))
+
+	customers := []models.Customer{
+		{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"},
+		{Name: "Jane Doe", Code: "CUST002", Phone: "+254700000001", Email: "jane@example.com"},
+	}
+	for i := range customers {
+		if err := db.Create(&customers[i]).Error; err != nil {
+			t.Fatalf("failed to create customer: %v", err)
+		}
+	}
+
+	// the third order is on the 1st in UTC but the 2nd in Nairobi
+	orders := []models.Order{
+		{Item: "laptop", Amount: models.Shillings(1000), Time: time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC), CustomerID: customers[0].ID},
+		{Item: "phone", Amount: models.Shillings(300), Time: time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC), CustomerID: customers[0].ID},
+		{Item: "laptop", Amount: models.Shillings(1200), Time: time.Date(2025, 3, 1, 22, 30, 0, 0, time.UTC), CustomerID: customers[1].ID},
+		{Item: "mouse", Amount: models.Shillings(50), Time: time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC), CustomerID: customers[1].ID},
+	}
+	for i := range orders {
+		if err := db.Create(&orders[i]).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedError  string
+		expectedTotals []models.OrderTotal
+		expectedGroups int64
+	}{
+		{
+			name:           "by customer",
+			query:          "group_by=customer",
+			expectedStatus: http.StatusOK,
+			expectedTotals: []models.OrderTotal{
+				{Group: strconv.Itoa(int(customers[0].ID)), OrdersCount: 2, TotalAmount: models.Shillings(1300)},
+				{Group: strconv.Itoa(int(customers[1].ID)), OrdersCount: 2, TotalAmount: models.Shillings(1250)},
+			},
+			expectedGroups: 2,
+		},
+		{
+			name:           "by item",
+			query:          "group_by=item",
+			expectedStatus: http.StatusOK,
+			expectedTotals: []models.OrderTotal{
+				{Group: "laptop", OrdersCount: 2, TotalAmount: models.Shillings(2200)},
+				{Group: "phone", OrdersCount: 1, TotalAmount: models.Shillings(300)},
+				{Group: "mouse", OrdersCount: 1, TotalAmount: models.Shillings(50)},
+			},
+			expectedGroups: 3,
+		},
+		{
+			name:           "by day in the report timezone",
+			query:          "group_by=day",
+			expectedStatus: http.StatusOK,
+			expectedTotals: []models.OrderTotal{
+				{Group: "2025-03-01", OrdersCount: 2, TotalAmount: models.Shillings(1300)},
+				{Group: "2025-03-02", OrdersCount: 1, TotalAmount: models.Shillings(1200)},
+				{Group: "2025-03-03", OrdersCount: 1, TotalAmount: models.Shillings(50)},
+			},
+			expectedGroups: 3,
+		},
+		{
+			name:           "paginated",
+			query:          "group_by=item&page=2&limit=2",
+			expectedStatus: http.StatusOK,
+			expectedTotals: []models.OrderTotal{
+				{Group: "mouse", OrdersCount: 1, TotalAmount: models.Shillings(50)},
+			},
+			expectedGroups: 3,
+		},
+		{
+			name:           "filtered like the order list",
+			query:          "group_by=item&min_amount=500",
+			expectedStatus: http.StatusOK,
+			expectedTotals: []models.OrderTotal{
+				{Group: "laptop", OrdersCount: 2, TotalAmount: models.Shillings(2200)},
+			},
+			expectedGroups: 1,
+		},
+		{
+			name:           "missing group_by",
+			query:          "",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_group_by",
+		},
+		{
+			name:           "unknown group_by",
+			query:          "group_by=status",
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_group_by",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/orders/totals?"+tt.query, nil)
+
+			handler.GetOrderTotals(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var totals []models.OrderTotal
+			var meta models.PageMeta
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &totals, Meta: &meta})
+			assert.Equal(t, tt.expectedGroups, meta.Total)
+			assert.Equal(t, tt.expectedTotals, totals)
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RiderHandler manages delivery riders and the orders assigned to them
+type RiderHandler struct {
+	db         *gorm.DB
+	smsService services.SMSServiceInterface
+	purger     services.CachePurger
+	smsLength  services.SMSLengthPolicy
+}
+
+func NewRiderHandler(db *gorm.DB, smsService services.SMSServiceInterface) *RiderHandler {
+	return &RiderHandler{db: db, smsService: smsService}
+}
+
+// WithCachePurger purges the CDN's copies of tracking pages when a delivery
+// moves their order on
+func (h *RiderHandler) WithCachePurger(purger services.CachePurger) *RiderHandler {
+	h.purger = purger
+	return h
+}
+
+// WithSMSLengthPolicy sends riders the short assignment text when the full
+// one would take more segments than the policy allows
+func (h *RiderHandler) WithSMSLengthPolicy(policy services.SMSLengthPolicy) *RiderHandler {
+	h.smsLength = policy
+	return h
+}
+
+var (
+	errOrderClosed       = errors.New("order is delivered or cancelled")
+	errRiderNotFound     = errors.New("rider not found")
+	errRiderInactive     = errors.New("rider is not active")
+	errInvalidTransition = errors.New("invalid assignment transition")
+)
+
+func (h *RiderHandler) CreateRider(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.CreateRiderRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	rider := models.Rider{Name: req.Name, Phone: req.Phone, Active: true}
+	if err := db.Create(&rider).Error; err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			respond.Error(c, http.StatusConflict, "rider_exists", "rider with this phone already exists")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to create rider")
+		return
+	}
+
+	respond.OK(c, http.StatusCreated, rider)
+}
+
+// GetRiders lists riders, only active ones with ?active=true
+func (h *RiderHandler) GetRiders(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	query := db.Model(&models.Rider{})
+	if active := c.Query("active"); active != "" {
+		want, err := strconv.ParseBool(active)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_query", "active must be true or false")
+			return
+		}
+		query = query.Where("active = ?", want)
+	}
+
+	var riders []models.Rider
+	if err := query.Order("name ASC").Find(&riders).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve riders")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, riders, gin.H{"total": len(riders)})
+}
+
+func (h *RiderHandler) GetRider(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	rider, ok := h.findRider(c, db)
+	if !ok {
+		return
+	}
+
+	respond.OK(c, http.StatusOK, rider)
+}
+
+func (h *RiderHandler) UpdateRider(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.UpdateRiderRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	rider, ok := h.findRider(c, db)
+	if !ok {
+		return
+	}
+
+	if req.Name != "" {
+		rider.Name = req.Name
+	}
+	if req.Phone != "" {
+		rider.Phone = req.Phone
+	}
+	if req.Active != nil {
+		rider.Active = *req.Active
+	}
+
+	if err := db.Save(&rider).Error; err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			respond.Error(c, http.StatusConflict, "rider_exists", "rider with this phone already exists")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to update rider")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, rider)
+}
+
+// GetRiderOrders returns the rider's manifest: their open assignments with
+// the order and customer, oldest first
+func (h *RiderHandler) GetRiderOrders(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	rider, ok := h.findRider(c, db)
+	if !ok {
+		return
+	}
+
+	var assignments []models.DeliveryAssignment
+	err := db.Preload("Order.Customer").
+		Where("rider_id = ? AND status IN ?", rider.ID, models.AssignmentOpenStatuses).
+		Order("created_at ASC, id ASC").
+		Find(&assignments).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve manifest")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, assignments, gin.H{"total": len(assignments)})
+}
+
+// AssignOrder hands an order to a rider, cancelling any open assignment to
+// another rider, and texts the rider the order details and customer phone
+func (h *RiderHandler) AssignOrder(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var req models.AssignOrderRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	assignment := models.DeliveryAssignment{
+		OrderID:    uint(orderID),
+		RiderID:    req.RiderID,
+		Status:     models.AssignmentStatusAssigned,
+		AssignedBy: middleware.CurrentUserEmail(c),
+	}
+	var rider models.Rider
+	var order models.Order
+
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&rider, req.RiderID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errRiderNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !rider.Active {
+			return errRiderInactive
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Customer").First(&order, orderID).Error; err != nil {
+			return err
+		}
+		if order.Status == models.OrderStatusDelivered || order.Status == models.OrderStatusCancelled {
+			return errOrderClosed
+		}
+
+		now := time.Now()
+		err = tx.Model(&models.DeliveryAssignment{}).
+			Where("order_id = ? AND status IN ?", orderID, models.AssignmentOpenStatuses).
+			Updates(map[string]interface{}{"status": models.AssignmentStatusCancelled, "completed_at": now}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&assignment).Error
+	})
+	if err != nil {
+		if errors.Is(err, errRiderNotFound) {
+			respond.Error(c, http.StatusNotFound, "rider_not_found", "rider not found")
+			return
+		}
+		if errors.Is(err, errRiderInactive) {
+			respond.Error(c, http.StatusConflict, "rider_inactive", "rider is not active")
+			return
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		if errors.Is(err, errOrderClosed) {
+			respond.Error(c, http.StatusConflict, "order_closed", "delivered or cancelled orders cannot be assigned")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to assign order")
+		return
+	}
+
+	// the assignment stands even if the text fails; notified_at stays empty
+	// so dispatch can call the rider instead
+	if err := h.smsService.SendSMS(c.Request.Context(), rider.Phone, h.riderAssignmentMessage(order)); err != nil {
+		log.Printf("failed to notify rider %d of order %d: %v", rider.ID, orderID, err)
+	} else {
+		now := time.Now()
+		if err := db.Model(&assignment).Update("notified_at", now).Error; err != nil {
+			log.Printf("failed to record rider notification for order %d: %v", orderID, err)
+		}
+		assignment.NotifiedAt = &now
+	}
+
+	assignment.Order = &order
+	assignment.Rider = &rider
+	respond.OK(c, http.StatusCreated, assignment)
+}
+
+// GetOrderAssignments lists every assignment of an order, newest first
+func (h *RiderHandler) GetOrderAssignments(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var assignments []models.DeliveryAssignment
+	if err := db.Preload("Rider").Where("order_id = ?", orderID).Order("created_at DESC, id DESC").Find(&assignments).Error; err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve assignments")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, assignments, gin.H{"total": len(assignments)})
+}
+
+// UpdateAssignment moves the order's open assignment on. Picking up ships
+// the order and delivering completes it; a failed or cancelled delivery
+// leaves the order free to be assigned again.
+func (h *RiderHandler) UpdateAssignment(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+		return
+	}
+
+	var req models.UpdateAssignmentRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	var assignment models.DeliveryAssignment
+	var from string
+	err = services.WithTx(c.Request.Context(), db, func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND status IN ?", orderID, models.AssignmentOpenStatuses).
+			First(&assignment).Error
+		if err != nil {
+			return err
+		}
+
+		from = assignment.Status
+		if req.Status == models.AssignmentStatusPickedUp && from != models.AssignmentStatusAssigned {
+			return errInvalidTransition
+		}
+
+		now := time.Now()
+		assignment.Status = req.Status
+		orderStatus := ""
+		switch req.Status {
+		case models.AssignmentStatusPickedUp:
+			assignment.PickedUpAt = &now
+			orderStatus = models.OrderStatusShipped
+		case models.AssignmentStatusDelivered:
+			assignment.CompletedAt = &now
+			orderStatus = models.OrderStatusDelivered
+		default:
+			assignment.CompletedAt = &now
+		}
+
+		if err := tx.Save(&assignment).Error; err != nil {
+			return err
+		}
+		if orderStatus == "" {
+			return nil
+		}
+		var order models.Order
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// the order was deleted while out for delivery
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		before := order
+		if err := tx.Model(&order).Update("status", orderStatus).Error; err != nil {
+			return err
+		}
+		return services.AppendOrderEvents(tx, before, services.OrderStatusEvent(orderStatus, middleware.CurrentUserEmail(c)))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "assignment_not_found", "order has no open assignment")
+			return
+		}
+		if errors.Is(err, errInvalidTransition) {
+			respond.Error(c, http.StatusConflict, "invalid_transition", fmt.Sprintf("cannot move assignment from %s to %s", from, req.Status))
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to update assignment")
+		return
+	}
+
+	purgeCache(c, h.purger, services.OrderCacheKey(uint(orderID)))
+	respond.OK(c, http.StatusOK, assignment)
+}
+
+func (h *RiderHandler) findRider(c *gin.Context, db *gorm.DB) (models.Rider, bool) {
+	var rider models.Rider
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid rider id")
+		return rider, false
+	}
+
+	if err := db.First(&rider, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "rider_not_found", "rider not found")
+			return rider, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve rider")
+		return rider, false
+	}
+	return rider, true
+}
+
+// riderAssignmentMessage falls back to leaving out the item, which the rider
+// sees at pickup, but never the phone or instructions
+func (h *RiderHandler) riderAssignmentMessage(order models.Order) string {
+	message := fmt.Sprintf("new delivery: order %s, %d x %s (ksh %s). customer: %s, phone: %s",
+		order.Reference(), order.Quantity, order.Item, order.Amount, order.Customer.Name, order.Customer.Phone)
+	short := fmt.Sprintf("delivery: order %s, phone: %s", order.Reference(), order.Customer.Phone)
+	if order.DeliveryInstructions != "" {
+		message += ". instructions: " + order.DeliveryInstructions
+		short += ". instructions: " + order.DeliveryInstructions
+	}
+	return h.smsLength.Choose(message, short)
+}
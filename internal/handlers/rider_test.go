@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateRider(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewRiderHandler(db, services.NewMockSMSService())
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "create rider", body: `{"name": "Otieno", "phone": "+254711000001"}`, expectedStatus: http.StatusCreated},
+		{name: "duplicate phone", body: `{"name": "Wanjiku", "phone": "+254711000001"}`, expectedStatus: http.StatusConflict, expectedError: "rider_exists"},
+		{name: "missing phone", body: `{"name": "Wanjiku"}`, expectedStatus: http.StatusBadRequest, expectedError: "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/riders", bytes.NewBufferString(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.CreateRider(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var rider models.Rider
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &rider})
+			assert.True(t, rider.Active)
+		})
+	}
+}
+
+func TestAssignOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	handler := NewRiderHandler(db, mockSMSService)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	order := models.Order{Item: "Laptop", Amount: models.Shillings(1200), Quantity: 1, Time: time.Now(), Status: models.OrderStatusConfirmed, CustomerID: customer.ID, DeliveryInstructions: "call on arrival, gate 3"}
+	db.Create(&order)
+	delivered := models.Order{Item: "Mouse", Amount: models.Shillings(20), Quantity: 1, Time: time.Now(), Status: models.OrderStatusDelivered, CustomerID: customer.ID}
+	db.Create(&delivered)
+
+	first := models.Rider{Name: "Otieno", Phone: "+254711000001", Active: true}
+	second := models.Rider{Name: "Wanjiku", Phone: "+254711000002", Active: true}
+	inactive := models.Rider{Name: "Kamau", Phone: "+254711000003", Active: true}
+	db.Create(&first)
+	db.Create(&second)
+	db.Create(&inactive)
+	db.Model(&inactive).Update("active", false)
+
+	tests := []struct {
+		name           string
+		orderID        uint
+		riderID        uint
+		expectedStatus int
+		expectedError  string
+	}{
+		{name: "assign order", orderID: order.ID, riderID: first.ID, expectedStatus: http.StatusCreated},
+		{name: "reassign order", orderID: order.ID, riderID: second.ID, expectedStatus: http.StatusCreated},
+		{name: "inactive rider", orderID: order.ID, riderID: inactive.ID, expectedStatus: http.StatusConflict, expectedError: "rider_inactive"},
+		{name: "rider not found", orderID: order.ID, riderID: 999, expectedStatus: http.StatusNotFound, expectedError: "rider_not_found"},
+		{name: "order not found", orderID: 999, riderID: first.ID, expectedStatus: http.StatusNotFound, expectedError: "order_not_found"},
+		{name: "delivered order", orderID: delivered.ID, riderID: first.ID, expectedStatus: http.StatusConflict, expectedError: "order_closed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockSMSService.SentMessages = nil
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body, _ := json.Marshal(models.AssignOrderRequest{RiderID: tt.riderID})
+			c.Request, _ = http.NewRequest("POST", "/orders/1/assignment", bytes.NewBuffer(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(tt.orderID)}}
+			middleware.SetCurrentUser(c, &models.Claims{Email: "dispatch@example.com"})
+
+			handler.AssignOrder(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				assert.Empty(t, mockSMSService.SentMessages)
+				return
+			}
+
+			var assignment models.DeliveryAssignment
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &assignment})
+			assert.Equal(t, models.AssignmentStatusAssigned, assignment.Status)
+			assert.Equal(t, "dispatch@example.com", assignment.AssignedBy)
+			assert.NotNil(t, assignment.NotifiedAt)
+
+			if assert.Len(t, mockSMSService.SentMessages, 1) {
+				assert.Contains(t, mockSMSService.SentMessages[0].To, "+25471100000")
+				assert.Contains(t, mockSMSService.SentMessages[0].Message, "Laptop")
+				assert.Contains(t, mockSMSService.SentMessages[0].Message, customer.Phone)
+				assert.Contains(t, mockSMSService.SentMessages[0].Message, "instructions: call on arrival, gate 3")
+			}
+		})
+	}
+
+	// reassigning cancelled the first rider's assignment
+	var assignments []models.DeliveryAssignment
+	db.Where("order_id = ?", order.ID).Order("id ASC").Find(&assignments)
+	if assert.Len(t, assignments, 2) {
+		assert.Equal(t, models.AssignmentStatusCancelled, assignments[0].Status)
+		assert.Equal(t, first.ID, assignments[0].RiderID)
+		assert.Equal(t, models.AssignmentStatusAssigned, assignments[1].Status)
+		assert.Equal(t, second.ID, assignments[1].RiderID)
+	}
+}
+
+func TestRiderManifestAndAssignmentStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewRiderHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+	rider := models.Rider{Name: "Otieno", Phone: "+254711000001", Active: true}
+	db.Create(&rider)
+
+	var orders []models.Order
+	for _, item := range []string{"Laptop", "Phone"} {
+		order := models.Order{Item: item, Amount: models.Shillings(100), Quantity: 1, Time: time.Now(), Status: models.OrderStatusConfirmed, CustomerID: customer.ID}
+		db.Create(&order)
+		db.Create(&models.DeliveryAssignment{OrderID: order.ID, RiderID: rider.ID, Status: models.AssignmentStatusAssigned})
+		orders = append(orders, order)
+	}
+
+	manifest := func() []models.DeliveryAssignment {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("GET", "/riders/1/orders", nil)
+		c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(rider.ID)}}
+		handler.GetRiderOrders(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var assignments []models.DeliveryAssignment
+		json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &assignments})
+		return assignments
+	}
+
+	assignments := manifest()
+	if assert.Len(t, assignments, 2) {
+		assert.Equal(t, "Laptop", assignments[0].Order.Item)
+		assert.Equal(t, customer.Phone, assignments[0].Order.Customer.Phone)
+	}
+
+	tests := []struct {
+		name                string
+		orderID             uint
+		status              string
+		expectedStatus      int
+		expectedError       string
+		expectedOrderStatus string
+	}{
+		{name: "picked up", orderID: orders[0].ID, status: "picked_up", expectedStatus: http.StatusOK, expectedOrderStatus: models.OrderStatusShipped},
+		{name: "picked up twice", orderID: orders[0].ID, status: "picked_up", expectedStatus: http.StatusConflict, expectedError: "invalid_transition"},
+		{name: "delivered", orderID: orders[0].ID, status: "delivered", expectedStatus: http.StatusOK, expectedOrderStatus: models.OrderStatusDelivered},
+		{name: "no open assignment", orderID: orders[0].ID, status: "failed", expectedStatus: http.StatusNotFound, expectedError: "assignment_not_found"},
+		{name: "unknown status", orderID: orders[1].ID, status: "lost", expectedStatus: http.StatusBadRequest, expectedError: "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			body, _ := json.Marshal(models.UpdateAssignmentRequest{Status: tt.status})
+			c.Request, _ = http.NewRequest("PUT", "/orders/1/assignment", bytes.NewBuffer(body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = []gin.Param{{Key: "id", Value: fmt.Sprint(tt.orderID)}}
+
+			handler.UpdateAssignment(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var order models.Order
+			db.First(&order, tt.orderID)
+			assert.Equal(t, tt.expectedOrderStatus, order.Status)
+		})
+	}
+
+	// the delivered order has left the manifest
+	assignments = manifest()
+	if assert.Len(t, assignments, 1) {
+		assert.Equal(t, "Phone", assignments[0].Order.Item)
+	}
+}
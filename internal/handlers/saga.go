@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SagaHandler lets admins see how the steps after order creation went and
+// roll an order back
+type SagaHandler struct {
+	db    *gorm.DB
+	sagas *services.SagaCoordinator
+	audit services.AuditRecorder
+}
+
+func NewSagaHandler(db *gorm.DB) *SagaHandler {
+	return &SagaHandler{db: db, sagas: services.NewSagaCoordinator(db)}
+}
+
+// WithAudit records sagas compensated by admins
+func (h *SagaHandler) WithAudit(audit services.AuditRecorder) *SagaHandler {
+	h.audit = audit
+	return h
+}
+
+// GetSagas lists sagas newest first, filtered by ?status= and ?order_id=
+func (h *SagaHandler) GetSagas(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	page, ok := parsePage(c)
+	if !ok {
+		return
+	}
+	query := db.Model(&models.Saga{})
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		id, err := strconv.ParseUint(orderID, 10, 32)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid order id")
+			return
+		}
+		query = query.Where("order_id = ?", id)
+	}
+
+	total, err := page.Total(query)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve sagas")
+		return
+	}
+
+	var sagas []models.Saga
+	err = query.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Order("created_at DESC, id DESC").Scopes(scopes.Paginate(page)).Find(&sagas).Error
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve sagas")
+		return
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, sagas, page.MetaOf(total, len(sagas)))
+}
+
+func (h *SagaHandler) GetSaga(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid saga id")
+		return
+	}
+
+	saga, err := h.sagas.Get(c.Request.Context(), uint(id))
+	if err != nil {
+		if errors.Is(err, services.ErrSagaNotFound) {
+			respond.Error(c, http.StatusNotFound, "saga_not_found", "saga not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve saga")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, saga)
+}
+
+// CompensateSaga undoes a finished saga; for order creation the order is
+// cancelled and restocked. Compensations that failed before are retried.
+func (h *SagaHandler) CompensateSaga(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid saga id")
+		return
+	}
+
+	saga, err := h.sagas.Compensate(c.Request.Context(), uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSagaNotFound):
+			respond.Error(c, http.StatusNotFound, "saga_not_found", "saga not found")
+		case errors.Is(err, services.ErrSagaNotCompensable):
+			respond.Error(c, http.StatusConflict, "saga_not_compensable", fmt.Sprintf("saga is %s", saga.Status))
+		default:
+			respond.ServerError(c, err, "database_error", "failed to compensate saga")
+		}
+		return
+	}
+
+	if h.audit != nil {
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditSagaCompensated,
+			Actor:     middleware.CurrentUserEmail(c),
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   fmt.Sprintf("saga=%d order=%d status=%s", saga.ID, saga.OrderID, saga.Status),
+		})
+	}
+
+	respond.OK(c, http.StatusOK, saga)
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// seedSagaOrder creates an order for two units of a product, with the stock
+// already taken as CreateOrder would
+func seedSagaOrder(t *testing.T, db *gorm.DB) (models.Order, models.Product) {
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+	product := models.Product{Name: "Laptop", SKU: "SKU001", Price: models.Shillings(500), StockQuantity: 8}
+	if err := db.Create(&product).Error; err != nil {
+		t.Fatalf("failed to create product: %v", err)
+	}
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1000), Time: time.Now(), Status: models.OrderStatusPending,
+		CustomerID: customer.ID, ProductID: &product.ID, Quantity: 2}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+	return order, product
+}
+
+func TestSagaCoordinatorRun(t *testing.T) {
+	errSMS := errors.New("sms provider unavailable")
+	succeed := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errSMS }
+
+	tests := []struct {
+		name            string
+		notify          func(context.Context) error
+		alert           func(context.Context) error
+		alertCritical   bool
+		expectedStatus  string
+		expectedSteps   []string
+		expectedOrder   string
+		expectedStock   int
+		expectedAttempt bool
+	}{
+		{
+			name:           "every step succeeds",
+			notify:         succeed,
+			alert:          succeed,
+			expectedStatus: models.SagaStatusCompleted,
+			expectedSteps:  []string{models.SagaStepDone, models.SagaStepDone, models.SagaStepDone},
+			expectedOrder:  models.OrderStatusPending,
+			expectedStock:  8,
+		},
+		{
+			name:            "failed confirmation is recorded for resending",
+			notify:          fail,
+			alert:           succeed,
+			expectedStatus:  models.SagaStatusPartiallyFailed,
+			expectedSteps:   []string{models.SagaStepDone, models.SagaStepCompensated, models.SagaStepDone},
+			expectedOrder:   models.OrderStatusPending,
+			expectedStock:   8,
+			expectedAttempt: true,
+		},
+		{
+			name:           "failed alert has nothing to compensate",
+			notify:         succeed,
+			alert:          fail,
+			expectedStatus: models.SagaStatusPartiallyFailed,
+			expectedSteps:  []string{models.SagaStepDone, models.SagaStepDone, models.SagaStepFailed},
+			expectedOrder:  models.OrderStatusPending,
+			expectedStock:  8,
+		},
+		{
+			name:           "failed critical step cancels and restocks the order",
+			notify:         succeed,
+			alert:          fail,
+			alertCritical:  true,
+			expectedStatus: models.SagaStatusCompensated,
+			expectedSteps:  []string{models.SagaStepCompensated, models.SagaStepDone, models.SagaStepFailed},
+			expectedOrder:  models.OrderStatusCancelled,
+			expectedStock:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+			order, product := seedSagaOrder(t, db)
+			coordinator := services.NewSagaCoordinator(db)
+
+			saga, err := coordinator.Run(context.Background(), models.SagaKindOrderCreation, order.ID, []services.SagaAction{
+				{Name: services.SagaStepCreateOrder, Critical: true},
+				{Name: services.SagaStepNotifyCustomer, Run: tt.notify},
+				{Name: services.SagaStepLowStockAlert, Critical: tt.alertCritical, Run: tt.alert},
+			})
+			if tt.expectedStatus == models.SagaStatusCompleted {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errSMS)
+			}
+
+			stored, err := coordinator.Get(context.Background(), saga.ID)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedStatus, stored.Status)
+			var steps []string
+			for _, step := range stored.Steps {
+				steps = append(steps, step.Status)
+			}
+			assert.Equal(t, tt.expectedSteps, steps)
+
+			db.First(&order, order.ID)
+			assert.Equal(t, tt.expectedOrder, order.Status)
+			db.First(&product, product.ID)
+			assert.Equal(t, tt.expectedStock, product.StockQuantity)
+
+			var attempts []models.NotificationAttempt
+			db.Find(&attempts)
+			if tt.expectedAttempt {
+				assert.Len(t, attempts, 1)
+				assert.Equal(t, models.NotificationStatusFailed, attempts[0].Status)
+				assert.Equal(t, models.NotificationRequestedBySystem, attempts[0].RequestedBy)
+				assert.Equal(t, "+254740827150", attempts[0].Recipient)
+			} else {
+				assert.Empty(t, attempts)
+			}
+		})
+	}
+}
+
+func TestSagaRecover(t *testing.T) {
+	db := testutil.DB(t)
+	order, _ := seedSagaOrder(t, db)
+	coordinator := services.NewSagaCoordinator(db)
+
+	// a saga whose process stopped before the confirmation was sent
+	saga := models.Saga{Kind: models.SagaKindOrderCreation, OrderID: order.ID, Status: models.SagaStatusRunning, Steps: []models.SagaStep{
+		{Position: 0, Name: services.SagaStepCreateOrder, Critical: true, Status: models.SagaStepDone},
+		{Position: 1, Name: services.SagaStepNotifyCustomer, Status: models.SagaStepPending},
+	}}
+	db.Create(&saga)
+
+	recovered, err := coordinator.Recover(context.Background(), time.Minute)
+	assert.NoError(t, err)
+	assert.Zero(t, recovered, "recent sagas are still in progress")
+
+	db.Model(&saga).UpdateColumn("updated_at", time.Now().Add(-time.Hour))
+
+	recovered, err = coordinator.Recover(context.Background(), time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recovered)
+
+	stored, _ := coordinator.Get(context.Background(), saga.ID)
+	assert.Equal(t, models.SagaStatusPartiallyFailed, stored.Status)
+	assert.Equal(t, models.SagaStepCompensated, stored.Steps[1].Status)
+	assert.Equal(t, "interrupted before completion", stored.Steps[1].Error)
+
+	var attempts int64
+	db.Model(&models.NotificationAttempt{}).Where("order_id = ? AND status = ?", order.ID, models.NotificationStatusFailed).Count(&attempts)
+	assert.Equal(t, int64(1), attempts)
+}
+
+func TestCompensateSaga(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	order, product := seedSagaOrder(t, db)
+	handler := NewSagaHandler(db)
+
+	saga, err := services.NewSagaCoordinator(db).Run(context.Background(), models.SagaKindOrderCreation, order.ID, []services.SagaAction{
+		{Name: services.SagaStepCreateOrder, Critical: true},
+	})
+	assert.NoError(t, err)
+
+	compensate := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest("POST", "/admin/sagas/"+id+"/compensate", nil)
+		c.Params = gin.Params{{Key: "id", Value: id}}
+		middleware.SetCurrentUser(c, &models.Claims{Email: "admin@example.com"})
+		handler.CompensateSaga(c)
+		return w
+	}
+
+	w := compensate(fmt.Sprint(saga.ID))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var compensated models.Saga
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &compensated})
+	assert.Equal(t, models.SagaStatusCompensated, compensated.Status)
+
+	db.First(&order, order.ID)
+	assert.Equal(t, models.OrderStatusCancelled, order.Status)
+	db.First(&product, product.ID)
+	assert.Equal(t, 10, product.StockQuantity)
+
+	tests := []struct {
+		name          string
+		id            string
+		expectedCode  int
+		expectedError string
+	}{
+		{name: "already compensated", id: fmt.Sprint(saga.ID), expectedCode: http.StatusConflict, expectedError: "saga_not_compensable"},
+		{name: "unknown saga", id: "999", expectedCode: http.StatusNotFound, expectedError: "saga_not_found"},
+		{name: "invalid id", id: "abc", expectedCode: http.StatusBadRequest, expectedError: "invalid_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := compensate(tt.id)
+			assert.Equal(t, tt.expectedCode, w.Code)
+			var response models.ErrorEnvelope
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, tt.expectedError, response.Error.Code)
+		})
+	}
+
+	// stock is only restored once
+	db.First(&product, product.ID)
+	assert.Equal(t, 10, product.StockQuantity)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/validation"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// SegmentHandler serves the tags that put customers in segments, and the
+// syncs admins set up to send each segment to a marketing platform
+type SegmentHandler struct {
+	db       *gorm.DB
+	segments *services.SegmentService
+	audit    services.AuditRecorder
+}
+
+func NewSegmentHandler(db *gorm.DB, segments *services.SegmentService) *SegmentHandler {
+	return &SegmentHandler{db: db, segments: segments}
+}
+
+// WithAudit records syncs created, changed, deleted and run by hand
+func (h *SegmentHandler) WithAudit(audit services.AuditRecorder) *SegmentHandler {
+	h.audit = audit
+	return h
+}
+
+func (h *SegmentHandler) GetCustomerTags(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+	tags, err := h.segments.Tags(c.Request.Context(), customer.ID)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve tags")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, tags, gin.H{"total": len(tags)})
+}
+
+// TagCustomer adds tags to a customer, returning all of their tags
+func (h *SegmentHandler) TagCustomer(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+	var req models.TagCustomerRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	tags, err := h.segments.Tag(c.Request.Context(), customer.ID, req.Tags, middleware.CurrentUserEmail(c))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to tag customer")
+		return
+	}
+	respond.OKWithMeta(c, http.StatusOK, tags, gin.H{"total": len(tags)})
+}
+
+func (h *SegmentHandler) UntagCustomer(c *gin.Context) {
+	customer, ok := h.findCustomer(c)
+	if !ok {
+		return
+	}
+	tag := c.Param("tag")
+	if !validation.IsSegmentTag(tag) {
+		respond.Error(c, http.StatusBadRequest, "invalid_tag", "invalid tag")
+		return
+	}
+
+	removed, err := h.segments.Untag(c.Request.Context(), customer.ID, tag)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to untag customer")
+		return
+	}
+	if !removed {
+		respond.Error(c, http.StatusNotFound, "tag_not_found", "customer does not have this tag")
+		return
+	}
+	respond.OK(c, http.StatusOK, gin.H{"message": "tag removed successfully"})
+}
+
+// CreateSegmentSync starts syncing a tag's customers to a platform. They
+// are first sent by the next scheduled run, or at once with RunSegmentSync.
+func (h *SegmentHandler) CreateSegmentSync(c *gin.Context) {
+	var req models.CreateSegmentSyncRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	sync := models.SegmentSync{
+		Tag:       req.Tag,
+		Platform:  req.Platform,
+		Audience:  strings.TrimSpace(req.Audience),
+		Segment:   strings.TrimSpace(req.Segment),
+		Fields:    req.Fields,
+		CreatedBy: middleware.CurrentUserEmail(c),
+	}
+	if err := h.segments.CreateSync(c.Request.Context(), &sync); err != nil {
+		segmentSyncError(c, err, "failed to create segment sync")
+		return
+	}
+	h.record(c, models.AuditSegmentSyncCreated, sync)
+
+	respond.Created(c, fmt.Sprintf("/api/v1/admin/segment-syncs/%d", sync.ID), sync.ID, sync.UpdatedAt, sync)
+}
+
+func (h *SegmentHandler) GetSegmentSyncs(c *gin.Context) {
+	syncs, err := h.segments.Syncs(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve segment syncs")
+		return
+	}
+	respond.OK(c, http.StatusOK, syncs)
+}
+
+// GetSegmentSync returns a sync with the outcome of its last run
+func (h *SegmentHandler) GetSegmentSync(c *gin.Context) {
+	id, ok := segmentSyncID(c)
+	if !ok {
+		return
+	}
+	sync, err := h.segments.Sync(c.Request.Context(), id)
+	if err != nil {
+		segmentSyncError(c, err, "failed to retrieve segment sync")
+		return
+	}
+	respond.OK(c, http.StatusOK, sync)
+}
+
+func (h *SegmentHandler) UpdateSegmentSync(c *gin.Context) {
+	id, ok := segmentSyncID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateSegmentSyncRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	sync, err := h.segments.UpdateSync(c.Request.Context(), id, req)
+	if err != nil {
+		segmentSyncError(c, err, "failed to update segment sync")
+		return
+	}
+	h.record(c, models.AuditSegmentSyncUpdated, sync)
+
+	respond.OK(c, http.StatusOK, sync)
+}
+
+func (h *SegmentHandler) DeleteSegmentSync(c *gin.Context) {
+	id, ok := segmentSyncID(c)
+	if !ok {
+		return
+	}
+	sync, err := h.segments.DeleteSync(c.Request.Context(), id)
+	if err != nil {
+		segmentSyncError(c, err, "failed to delete segment sync")
+		return
+	}
+	h.record(c, models.AuditSegmentSyncDeleted, sync)
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "segment sync deleted successfully"})
+}
+
+// RunSegmentSync sends a sync's changes now and returns its outcome. A
+// platform failing is 502, with the sync recording the error.
+func (h *SegmentHandler) RunSegmentSync(c *gin.Context) {
+	id, ok := segmentSyncID(c)
+	if !ok {
+		return
+	}
+	sync, err := h.segments.Run(c.Request.Context(), id)
+	if errors.Is(err, services.ErrSegmentSyncNotFound) {
+		segmentSyncError(c, err, "failed to run segment sync")
+		return
+	}
+	h.record(c, models.AuditSegmentSyncTriggered, sync)
+	if err != nil {
+		if sync.LastStatus == models.SegmentSyncFailed {
+			respond.Error(c, http.StatusBadGateway, "segment_sync_failed", sync.LastError)
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to run segment sync")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, sync)
+}
+
+func segmentSyncID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid segment sync id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func segmentSyncError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrSegmentSyncNotFound):
+		respond.Error(c, http.StatusNotFound, "segment_sync_not_found", "segment sync not found")
+	case errors.Is(err, services.ErrPlatformNotConfigured):
+		respond.Error(c, http.StatusUnprocessableEntity, "platform_not_configured", "no credentials are configured for this marketing platform")
+	default:
+		respond.ServerError(c, err, "database_error", message)
+	}
+}
+
+func (h *SegmentHandler) record(c *gin.Context, eventType string, sync models.SegmentSync) {
+	if h.audit == nil {
+		return
+	}
+	details := fmt.Sprintf("segment_sync=%d tag=%s platform=%s segment=%s active=%t", sync.ID, sync.Tag, sync.Platform, sync.Segment, sync.Active)
+	if eventType == models.AuditSegmentSyncTriggered && sync.LastStatus != "" {
+		details += " status=" + sync.LastStatus
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
+
+func (h *SegmentHandler) findCustomer(c *gin.Context) (models.Customer, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return models.Customer{}, false
+	}
+
+	var customer models.Customer
+	if err := h.db.WithContext(c.Request.Context()).First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return customer, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return customer, false
+	}
+	return customer, true
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SessionHandler lets users see and revoke their own active sessions
+type SessionHandler struct {
+	sessions *services.SessionStore
+	audit    services.AuditRecorder
+}
+
+func NewSessionHandler(sessions *services.SessionStore) *SessionHandler {
+	return &SessionHandler{sessions: sessions}
+}
+
+// WithAudit records revoked sessions
+func (h *SessionHandler) WithAudit(audit services.AuditRecorder) *SessionHandler {
+	h.audit = audit
+	return h
+}
+
+// GetSessions lists the signed in user's active sessions, marking the one
+// making the request as current
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	sessions, err := h.sessions.Active(c.Request.Context(), middleware.CurrentUserEmail(c))
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve sessions")
+		return
+	}
+
+	current := middleware.CurrentSessionID(c)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current
+	}
+
+	respond.OKWithMeta(c, http.StatusOK, sessions, gin.H{"total": len(sessions)})
+}
+
+// RevokeSession ends one of the signed in user's sessions; its token is
+// rejected from then on
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	email := middleware.CurrentUserEmail(c)
+	id := c.Param("id")
+
+	if err := h.sessions.Revoke(c.Request.Context(), email, id); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			respond.Error(c, http.StatusNotFound, "session_not_found", "session not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to revoke session")
+		return
+	}
+
+	if h.audit != nil {
+		h.audit.Record(models.AuditEvent{
+			Type:      models.AuditSessionRevoked,
+			Actor:     email,
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+			Details:   "session=" + id,
+		})
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "session revoked"})
+}
@@ -0,0 +1,46 @@
+package handlers_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil/apptest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoLinksWithoutSigningSecret(t *testing.T) {
+	cfg := apptest.Config()
+	cfg.TrackingSecret = ""
+	r := apptest.NewRouter(t, cfg)
+	admin := testutil.Token(t, apptest.Admin)
+	customer := testutil.NewCustomer(t).WithPhone("+254740827150").Create(r.DB)
+	order := testutil.NewOrder(t).For(customer).Create(r.DB)
+
+	// a link signed with the empty key anyone could compute
+	mac := hmac.New(sha256.New, nil)
+	payload := fmt.Sprintf("%d.%d", order.ID, time.Now().Add(time.Hour).Unix())
+	mac.Write([]byte(payload))
+	forged := payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	testutil.Run(t, r, []testutil.Case{
+		{
+			Name:    "forged tracking link",
+			Request: testutil.NewRequest("GET", "/track/"+forged),
+			Status:  http.StatusNotFound,
+			Code:    "tracking_link_not_found",
+		},
+		{
+			Name:    "statement links are not issued",
+			Request: testutil.NewRequest("POST", fmt.Sprintf("/api/v1/customers/%d/statement/send", customer.ID)).WithToken(admin),
+			Status:  http.StatusServiceUnavailable,
+			Code:    "statement_links_not_configured",
+		},
+	})
+	assert.Empty(t, r.SMS.SentMessages)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateOrderSetsSLADeadline(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	policy := services.SLAPolicy{Normal: 72 * time.Hour, Express: 24 * time.Hour}
+	handler := NewOrderHandler(db, services.NewMockSMSService()).WithSLAPolicy(policy)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	tests := []struct {
+		name             string
+		priority         string
+		expectedPriority string
+		expectedWithin   time.Duration
+	}{
+		{name: "default priority", priority: "", expectedPriority: models.OrderPriorityNormal, expectedWithin: 72 * time.Hour},
+		{name: "express priority", priority: "express", expectedPriority: models.OrderPriorityExpress, expectedWithin: 24 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			jsonBody, _ := json.Marshal(models.CreateOrderRequest{
+				Item:       "laptop",
+				Amount:     models.Shillings(1500),
+				Time:       time.Now(),
+				CustomerID: customer.ID,
+				Priority:   tt.priority,
+			})
+			c.Request, _ = http.NewRequest("POST", "/orders", bytes.NewBuffer(jsonBody))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			handler.CreateOrder(c)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var order models.Order
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &order})
+			assert.Equal(t, tt.expectedPriority, order.Priority)
+			if assert.NotNil(t, order.SLADeadline) {
+				assert.WithinDuration(t, time.Now().Add(tt.expectedWithin), *order.SLADeadline, time.Minute)
+			}
+		})
+	}
+}
+
+func TestSLACheckAndBreachedFilter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	slaService := services.NewSLAService(db, mockSMSService, []string{"+254700000000"}, services.SLAPolicy{EscalateBefore: 4 * time.Hour})
+	handler := NewOrderHandler(db, mockSMSService)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	past := time.Now().Add(-time.Hour)
+	soon := time.Now().Add(2 * time.Hour)
+	later := time.Now().Add(48 * time.Hour)
+	orders := []models.Order{
+		{Item: "overdue", Status: models.OrderStatusPending, Priority: models.OrderPriorityNormal, SLADeadline: &past},
+		{Item: "shipped late", Status: models.OrderStatusShipped, Priority: models.OrderPriorityNormal, SLADeadline: &past},
+		{Item: "express due soon", Status: models.OrderStatusConfirmed, Priority: models.OrderPriorityExpress, SLADeadline: &soon},
+		{Item: "normal due soon", Status: models.OrderStatusPending, Priority: models.OrderPriorityNormal, SLADeadline: &soon},
+		{Item: "on track", Status: models.OrderStatusPending, Priority: models.OrderPriorityExpress, SLADeadline: &later},
+	}
+	for _, order := range orders {
+		order.Amount = 100
+		order.Time = time.Now()
+		order.CustomerID = customer.ID
+		if err := db.Create(&order).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+
+	// before the checker runs the filter already finds the overdue order
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/orders?sla=breached", nil)
+	handler.GetOrders(c)
+
+	var listed []models.Order
+	var meta models.PageMeta
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &listed, Meta: &meta})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(1), meta.Total)
+	assert.Equal(t, "overdue", listed[0].Item)
+
+	breached, escalated, err := slaService.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), breached)
+	assert.Equal(t, 1, escalated)
+	assert.Len(t, mockSMSService.SentMessages, 1)
+	assert.Contains(t, mockSMSService.SentMessages[0].Message, "express order 3")
+
+	// a second check neither re-flags nor re-escalates
+	breached, escalated, err = slaService.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), breached)
+	assert.Equal(t, 0, escalated)
+	assert.Len(t, mockSMSService.SentMessages, 1)
+
+	// a flagged order stays breached after it ships
+	db.Model(&models.Order{}).Where("item = ?", "overdue").Update("status", models.OrderStatusShipped)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/listed?sla=breached", nil)
+	handler.GetOrders(c)
+
+	listed = nil
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &listed, Meta: &meta})
+	assert.Equal(t, int64(1), meta.Total)
+	assert.NotNil(t, listed[0].SLABreachedAt)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/listed?sla=late", nil)
+	handler.GetOrders(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
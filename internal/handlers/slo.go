@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type SLOHandler struct {
+	tracker      *services.SLOTracker
+	outbound     *services.OutboundMetrics
+	load         *services.LoadMonitor
+	metricsToken string
+}
+
+func NewSLOHandler(tracker *services.SLOTracker) *SLOHandler {
+	return &SLOHandler{tracker: tracker}
+}
+
+// WithMetricsToken requires scrapes of /metrics to send
+// "Authorization: Bearer <token>"
+func (h *SLOHandler) WithMetricsToken(token string) *SLOHandler {
+	h.metricsToken = token
+	return h
+}
+
+// WithOutboundMetrics adds the counts of calls made to providers to
+// /metrics
+func (h *SLOHandler) WithOutboundMetrics(metrics *services.OutboundMetrics) *SLOHandler {
+	h.outbound = metrics
+	return h
+}
+
+// WithLoadMonitor adds the requests in flight and those shed to /metrics
+func (h *SLOHandler) WithLoadMonitor(monitor *services.LoadMonitor) *SLOHandler {
+	h.load = monitor
+	return h
+}
+
+// GetSLO summarizes the current month's error budgets
+func (h *SLOHandler) GetSLO(c *gin.Context) {
+	respond.OK(c, http.StatusOK, h.tracker.Report())
+}
+
+// Metrics serves the SLO metrics for Prometheus to scrape
+func (h *SLOHandler) Metrics(c *gin.Context) {
+	if h.metricsToken != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.metricsToken)) != 1 {
+			respond.Error(c, http.StatusUnauthorized, "unauthorized", "invalid metrics token")
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := h.tracker.WriteMetrics(c.Writer); err != nil {
+		return
+	}
+	if h.load != nil {
+		h.load.WriteMetrics(c.Writer)
+	}
+	if h.outbound != nil {
+		h.outbound.WriteMetrics(c.Writer)
+	}
+}
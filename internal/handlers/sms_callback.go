@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const smsHelpMessage = "send STATUS followed by your order number to check an order, e.g. STATUS ORD-2025-000123"
+
+type SMSCallbackHandler struct {
+	db         *gorm.DB
+	smsService services.SMSServiceInterface
+	campaigns  *services.CampaignService
+}
+
+func NewSMSCallbackHandler(db *gorm.DB, smsService services.SMSServiceInterface) *SMSCallbackHandler {
+	return &SMSCallbackHandler{
+		db:         db,
+		smsService: smsService,
+	}
+}
+
+// WithCampaigns applies delivery reports to the campaign messages they are
+// about
+func (h *SMSCallbackHandler) WithCampaigns(campaigns *services.CampaignService) *SMSCallbackHandler {
+	h.campaigns = campaigns
+	return h
+}
+
+// InboundSMS receives an incoming message from Africa's Talking, stores it
+// against the matching customer and answers keyword commands by SMS. It
+// must be routed behind a middleware.CallbackVerifier.
+func (h *SMSCallbackHandler) InboundSMS(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var req models.InboundSMSRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	var customer models.Customer
+	found := true
+	if err := db.Where("phone_hash IN ?", phoneHashes(req.From)).First(&customer).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.ServerError(c, err, "database_error", "failed to look up sender")
+			return
+		}
+		found = false
+	}
+
+	message := models.SMSMessage{
+		Direction: models.SMSDirectionInbound,
+		Phone:     req.From,
+		Body:      req.Text,
+	}
+	if found {
+		message.CustomerID = &customer.ID
+	}
+	if req.ID != "" {
+		message.ProviderMessageID = &req.ID
+	}
+
+	if err := db.Create(&message).Error; err != nil {
+		// the provider retries callbacks it thinks failed, so a repeat is not an error
+		if _, ok := uniqueViolation(err); ok {
+			respond.OK(c, http.StatusOK, gin.H{"message": "already received"})
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to store message")
+		return
+	}
+
+	// unknown senders are recorded but never answered
+	if found {
+		reply := h.commandReply(db, customer, req.Text)
+		go h.sendReply(context.WithoutCancel(c.Request.Context()), customer, req.From, reply)
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "received"})
+}
+
+// DeliveryReport receives the status of a sent message from Africa's
+// Talking. Reports of messages that are not a campaign's are acknowledged
+// and dropped. It must be routed behind a middleware.CallbackVerifier.
+func (h *SMSCallbackHandler) DeliveryReport(c *gin.Context) {
+	var req models.SMSDeliveryReportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+	if h.campaigns == nil {
+		respond.OK(c, http.StatusOK, gin.H{"message": "received"})
+		return
+	}
+
+	if _, err := h.campaigns.RecordDelivery(c.Request.Context(), req); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to record delivery report")
+		return
+	}
+	respond.OK(c, http.StatusOK, gin.H{"message": "received"})
+}
+
+// commandReply answers a keyword command such as "STATUS 123"
+func (h *SMSCallbackHandler) commandReply(db *gorm.DB, customer models.Customer, text string) string {
+	words := strings.Fields(strings.ToUpper(text))
+	if len(words) > 0 && (words[0] == "STOP" || words[0] == "UNSUBSCRIBE" || words[0] == "START") {
+		return h.marketingReply(db, customer, words[0] == "START")
+	}
+	if len(words) < 2 || words[0] != "STATUS" {
+		return smsHelpMessage
+	}
+
+	// the order's number, or its id for orders placed before numbering
+	reference := strings.TrimPrefix(words[1], "#")
+	query := db.Where("number = ?", services.NormalizeOrderNumber(reference))
+	if orderID, err := strconv.ParseUint(reference, 10, 32); err == nil {
+		query = db.Where("id = ?", orderID)
+	} else if !strings.Contains(reference, "-") {
+		return smsHelpMessage
+	}
+
+	var order models.Order
+	if err := query.Where("customer_id = ?", customer.ID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Sprintf("order %s not found", reference)
+		}
+		log.Printf("failed to look up order %s for sms status: %v", reference, err)
+		return "sorry, we could not check your order right now. please try again later"
+	}
+
+	reply := fmt.Sprintf("order %s (%s) is %s", order.Reference(), order.Item, order.Status)
+	if order.EstimatedDeliveryAt != nil {
+		reply += fmt.Sprintf(". estimated delivery: %s", order.EstimatedDeliveryAt.Format("2006-01-02"))
+	}
+	return reply
+}
+
+// marketingReply opts the customer out of marketing texts such as win-back
+// campaigns, or back in. Order updates are still sent either way.
+func (h *SMSCallbackHandler) marketingReply(db *gorm.DB, customer models.Customer, optIn bool) string {
+	var optedOutAt interface{}
+	if !optIn {
+		optedOutAt = time.Now()
+	}
+	err := db.Model(&models.Customer{}).Where("id = ?", customer.ID).UpdateColumn("marketing_opt_out_at", optedOutAt).Error
+	if err != nil {
+		log.Printf("failed to update marketing opt out of customer %d: %v", customer.ID, err)
+		return "sorry, we could not update your preferences right now. please try again later"
+	}
+	if optIn {
+		return "you will receive our offers again. reply STOP to opt out"
+	}
+	return "you will no longer receive offers from us. reply START to opt back in"
+}
+
+func (h *SMSCallbackHandler) sendReply(ctx context.Context, customer models.Customer, to, reply string) {
+	if err := h.smsService.SendSMS(ctx, to, reply); err != nil {
+		log.Printf("failed to send sms reply to customer %s: %v", customer.Name, err)
+		return
+	}
+	if logger, ok := h.smsService.(services.SMSMessageLogger); ok && logger.LogsMessages() {
+		// the service stored it already
+		return
+	}
+
+	message := models.SMSMessage{
+		CustomerID: &customer.ID,
+		Direction:  models.SMSDirectionOutbound,
+		Phone:      to,
+		Body:       reply,
+	}
+	if err := h.db.WithContext(ctx).Create(&message).Error; err != nil {
+		log.Printf("failed to store sms reply to customer %s: %v", customer.Name, err)
+	}
+}
+
+// phoneHashes returns the blind indexes of every way the number may have
+// been stored, since phone numbers are encrypted
+func phoneHashes(phone string) []string {
+	variants := phoneVariants(phone)
+	hashes := make([]string, len(variants))
+	for i, variant := range variants {
+		hashes[i] = pii.BlindIndex(variant)
+	}
+	return hashes
+}
+
+// phoneVariants lists the ways a Kenyan number may have been stored, since
+// customer phones are saved as entered
+func phoneVariants(phone string) []string {
+	phone = strings.TrimSpace(phone)
+	local := strings.TrimPrefix(strings.TrimPrefix(phone, "+"), "254")
+	local = strings.TrimPrefix(local, "0")
+
+	return []string{phone, "+254" + local, "254" + local, "0" + local}
+}
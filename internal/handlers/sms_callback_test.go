@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/fakeat"
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInboundSMS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewSMSCallbackHandler(db, services.NewMockSMSService())
+	verifier := middleware.NewCallbackVerifier("sms", middleware.CallbackConfig{Token: "callback-secret"})
+	r := gin.New()
+	r.POST("/callbacks/sms/inbound", verifier.Middleware(), handler.InboundSMS)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "0740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		token            string
+		form             url.Values
+		expectedStatus   int
+		expectedError    string
+		expectedMessage  string
+		expectedCustomer bool
+	}{
+		{
+			name:             "known sender",
+			token:            "callback-secret",
+			form:             url.Values{"from": {"+254740827150"}, "text": {"STATUS 1"}, "id": {"ATXid_1"}},
+			expectedStatus:   http.StatusOK,
+			expectedMessage:  "received",
+			expectedCustomer: true,
+		},
+		{
+			name:            "repeated callback",
+			token:           "callback-secret",
+			form:            url.Values{"from": {"+254740827150"}, "text": {"STATUS 1"}, "id": {"ATXid_1"}},
+			expectedStatus:  http.StatusOK,
+			expectedMessage: "already received",
+		},
+		{
+			name:            "unknown sender",
+			token:           "callback-secret",
+			form:            url.Values{"from": {"+254700000000"}, "text": {"hello"}, "id": {"ATXid_2"}},
+			expectedStatus:  http.StatusOK,
+			expectedMessage: "received",
+		},
+		{
+			name:           "wrong token",
+			token:          "guess",
+			form:           url.Values{"from": {"+254740827150"}, "text": {"STATUS 1"}, "id": {"ATXid_3"}},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "missing sender",
+			token:          "callback-secret",
+			form:           url.Values{"text": {"STATUS 1"}},
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/callbacks/sms/inbound?token="+tt.token, strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				return
+			}
+
+			var response map[string]string
+			json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+			assert.Equal(t, tt.expectedMessage, response["message"])
+
+			if tt.expectedMessage == "received" {
+				var stored models.SMSMessage
+				db.Where("provider_message_id = ?", tt.form.Get("id")).First(&stored)
+				assert.Equal(t, models.SMSDirectionInbound, stored.Direction)
+				assert.Equal(t, tt.expectedCustomer, stored.CustomerID != nil)
+			}
+		})
+	}
+
+	var inboundCount int64
+	db.Model(&models.SMSMessage{}).Where("direction = ?", models.SMSDirectionInbound).Count(&inboundCount)
+	assert.Equal(t, int64(2), inboundCount)
+}
+
+func TestInboundSMSFakeAT(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	handler := NewSMSCallbackHandler(db, services.NewMockSMSService())
+	verifier := middleware.NewCallbackVerifier("sms", middleware.CallbackConfig{Token: "callback-secret"})
+	r := gin.New()
+	r.POST("/callbacks/sms/inbound", verifier.Middleware(), handler.InboundSMS)
+	api := httptest.NewServer(r)
+	defer api.Close()
+
+	at := fakeat.NewServer("testuser", "testapikey")
+	defer at.Close()
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "0740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	status, err := at.Inbound(context.Background(), api.URL+"/callbacks/sms/inbound?token=callback-secret", "+254740827150", "22384", "STATUS 1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, err = at.Inbound(context.Background(), api.URL+"/callbacks/sms/inbound", "+254740827150", "22384", "STATUS 1")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	var stored []models.SMSMessage
+	db.Where("direction = ?", models.SMSDirectionInbound).Find(&stored)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, "STATUS 1", stored[0].Body)
+		assert.NotNil(t, stored[0].ProviderMessageID)
+		if assert.NotNil(t, stored[0].CustomerID) {
+			assert.Equal(t, customer.ID, *stored[0].CustomerID)
+		}
+	}
+}
+
+func TestSMSCommandReply(t *testing.T) {
+	db := testutil.DB(t)
+	handler := NewSMSCallbackHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	other := models.Customer{Name: "Jane Doe", Code: "CUST002", Phone: "+254711111111", Email: "jane@example.com"}
+	db.Create(&customer)
+	db.Create(&other)
+
+	eta := time.Date(2025, 9, 25, 12, 0, 0, 0, time.UTC)
+	order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: time.Now(), Status: models.OrderStatusShipped, EstimatedDeliveryAt: &eta, CustomerID: customer.ID}
+	otherOrder := models.Order{Item: "phone", Amount: models.Shillings(500), Time: time.Now(), CustomerID: other.ID}
+	number := "ORD-2025-000003"
+	numbered := models.Order{Number: &number, Item: "charger", Amount: models.Shillings(200), Time: time.Now(), Status: models.OrderStatusPending, CustomerID: customer.ID}
+	db.Create(&order)
+	db.Create(&otherOrder)
+	db.Create(&numbered)
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{
+			name:     "status of own order",
+			text:     "status 1",
+			expected: "order 1 (laptop) is shipped. estimated delivery: 2025-09-25",
+		},
+		{
+			name:     "status of another customer's order",
+			text:     "STATUS 2",
+			expected: "order 2 not found",
+		},
+		{
+			name:     "status by order number",
+			text:     "status ord-2025-000003",
+			expected: "order ORD-2025-000003 (charger) is pending",
+		},
+		{
+			name:     "unknown order number",
+			text:     "STATUS #ORD-2025-000002",
+			expected: "order ORD-2025-000002 not found",
+		},
+		{
+			name:     "status of something that is not an order",
+			text:     "STATUS please",
+			expected: smsHelpMessage,
+		},
+		{
+			name:     "status without order number",
+			text:     "STATUS",
+			expected: smsHelpMessage,
+		},
+		{
+			name:     "unknown command",
+			text:     "hello there",
+			expected: smsHelpMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, handler.commandReply(db, customer, tt.text))
+		})
+	}
+}
+
+func TestSMSDryRun(t *testing.T) {
+	db := testutil.DB(t)
+	dryRun := services.NewDryRunSMSService(db)
+	handler := NewSMSCallbackHandler(db, dryRun)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	handler.sendReply(context.Background(), customer, customer.Phone, "order 1 (laptop) is shipped")
+
+	var messages []models.SMSMessage
+	db.Find(&messages)
+	if assert.Len(t, messages, 1, "a dry run reply is stored once") {
+		assert.True(t, messages[0].DryRun)
+		assert.Equal(t, models.SMSDirectionOutbound, messages[0].Direction)
+		assert.Equal(t, "order 1 (laptop) is shipped", messages[0].Body)
+		if assert.NotNil(t, messages[0].CustomerID) {
+			assert.Equal(t, customer.ID, *messages[0].CustomerID)
+		}
+	}
+
+	result, err := dryRun.SendBulkSMS(context.Background(), []string{"+254711000001", "+254711000002", "+254711000001"}, "flash sale")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.SentCount())
+
+	var stored int64
+	db.Model(&models.SMSMessage{}).Where("body = ? AND dry_run = ?", "flash sale", true).Count(&stored)
+	assert.Equal(t, int64(2), stored)
+}
+
+func TestSMSDeliveryReport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	sms := services.NewMockSMSService()
+	handler := NewSMSCallbackHandler(db, sms).WithCampaigns(services.NewCampaignService(db, sms, services.CampaignPolicy{}))
+	verifier := middleware.NewCallbackVerifier("sms", middleware.CallbackConfig{Token: "callback-secret"})
+	r := gin.New()
+	r.POST("/callbacks/sms/delivery", verifier.Middleware(), handler.DeliveryReport)
+	api := httptest.NewServer(r)
+	defer api.Close()
+
+	at := fakeat.NewServer("testuser", "testapikey")
+	defer at.Close()
+
+	customer := testutil.NewCustomer(t).Create(db)
+	campaign := models.Campaign{Name: "March offer", Message: "10% off", Tags: []string{"vip"}, SendAt: time.Now(), Status: models.CampaignSending}
+	if err := db.Create(&campaign).Error; err != nil {
+		t.Fatalf("failed to create campaign: %v", err)
+	}
+	messageID := "ATXid_campaign"
+	sentAt := time.Now()
+	recipient := models.CampaignRecipient{CampaignID: campaign.ID, CustomerID: customer.ID, Status: models.CampaignRecipientSent, ProviderMessageID: &messageID, SentAt: &sentAt}
+	if err := db.Create(&recipient).Error; err != nil {
+		t.Fatalf("failed to create recipient: %v", err)
+	}
+
+	callback := api.URL + "/callbacks/sms/delivery?token=callback-secret"
+	status, err := at.Deliver(context.Background(), api.URL+"/callbacks/sms/delivery", fakeat.DeliveryReport{ID: messageID, Status: "Success"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	status, err = at.Deliver(context.Background(), callback, fakeat.DeliveryReport{ID: "ATXid_order_update", Status: "Success", PhoneNumber: customer.Phone})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, "reports of other messages are acknowledged")
+
+	status, err = at.Deliver(context.Background(), callback, fakeat.DeliveryReport{ID: messageID, Status: "Success", PhoneNumber: customer.Phone, NetworkCode: "63902"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status)
+
+	var stored models.CampaignRecipient
+	db.First(&stored, recipient.ID)
+	assert.Equal(t, models.CampaignRecipientDelivered, stored.Status)
+	assert.NotNil(t, stored.DeliveredAt)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SMSFailureHandler reports why text messages failed
+type SMSFailureHandler struct {
+	tracker *services.SMSFailureTracker
+}
+
+// NewSMSFailureHandler reports on tracker. A nil tracker, for SMS services
+// that do not count failures, always reports none.
+func NewSMSFailureHandler(tracker *services.SMSFailureTracker) *SMSFailureHandler {
+	if tracker == nil {
+		tracker = services.NewSMSFailureTracker()
+	}
+	return &SMSFailureHandler{tracker: tracker}
+}
+
+// GetFailures breaks down the messages that failed over ?window= (default
+// and at most 24h) by reason
+func (h *SMSFailureHandler) GetFailures(c *gin.Context) {
+	window := services.MaxSMSFailureWindow
+	if value := c.Query("window"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Minute || d > services.MaxSMSFailureWindow {
+			respond.Error(c, http.StatusBadRequest, "invalid_window", "window must be a duration between 1m and 24h")
+			return
+		}
+		window = d
+	}
+
+	respond.OK(c, http.StatusOK, h.tracker.Report(window))
+}
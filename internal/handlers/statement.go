@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// StatementHandler serves customer account statements, to staff and through
+// signed links texted to customers
+type StatementHandler struct {
+	db         *gorm.DB
+	reports    *services.ReportService
+	links      *services.StatementLinks
+	smsService services.SMSServiceInterface
+}
+
+func NewStatementHandler(db *gorm.DB, reports *services.ReportService, links *services.StatementLinks, smsService services.SMSServiceInterface) *StatementHandler {
+	return &StatementHandler{
+		db:         db,
+		reports:    reports,
+		links:      links,
+		smsService: smsService,
+	}
+}
+
+// GetStatement returns the customer's statement for ?from= to ?to= as
+// ?format=json (the default), csv or pdf
+func (h *StatementHandler) GetStatement(c *gin.Context) {
+	customer, ok := h.findCustomer(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	from, to, ok := h.parsePeriod(c, c.Query("from"), c.Query("to"))
+	if !ok {
+		return
+	}
+	format, ok := parseStatementFormat(c, c.Query("format"))
+	if !ok {
+		return
+	}
+
+	h.render(c, customer, from, to, format)
+}
+
+// SendStatement texts the customer a link to their statement. The link is
+// also returned, e.g. to be emailed. With no links configured it is 503.
+func (h *StatementHandler) SendStatement(c *gin.Context) {
+	if h.links == nil {
+		respond.Error(c, http.StatusServiceUnavailable, "statement_links_not_configured", "statement links are not configured")
+		return
+	}
+	customer, ok := h.findCustomer(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var req models.SendStatementRequest
+	if c.Request.ContentLength != 0 {
+		if err := respond.BindJSON(c, &req); err != nil {
+			respond.BindError(c, err)
+			return
+		}
+	}
+	from, to, ok := h.parsePeriod(c, req.From, req.To)
+	if !ok {
+		return
+	}
+	format, ok := parseStatementFormat(c, req.Format)
+	if !ok {
+		return
+	}
+
+	url, expiresAt := h.links.URL(services.StatementRef{CustomerID: customer.ID, From: from, To: to, Format: format})
+	message := fmt.Sprintf("hello %s, your statement for %s to %s is ready: %s",
+		customer.Name, from.Format(services.DayLayout), to.Format(services.DayLayout), url)
+	if err := h.smsService.SendSMS(c.Request.Context(), customer.Phone, message); err != nil {
+		log.Printf("failed to text statement link to customer %d: %v", customer.ID, err)
+		respond.Error(c, http.StatusBadGateway, "sms_failed", "failed to send statement link")
+		return
+	}
+
+	respond.OK(c, http.StatusOK, gin.H{"url": url, "expires_at": expiresAt})
+}
+
+// GetSharedStatement serves the statement a signed link was issued for. It
+// is public, so the link's signature is the only check.
+func (h *StatementHandler) GetSharedStatement(c *gin.Context) {
+	if h.links == nil {
+		respond.Error(c, http.StatusNotFound, "statement_link_not_found", "invalid statement link")
+		return
+	}
+	ref, err := h.links.Verify(c.Param("token"), h.reports.Location())
+	if err != nil {
+		if errors.Is(err, services.ErrStatementLinkExpired) {
+			respond.Error(c, http.StatusGone, "statement_link_expired", "this statement link has expired")
+			return
+		}
+		respond.Error(c, http.StatusNotFound, "statement_link_not_found", "invalid statement link")
+		return
+	}
+
+	customer, ok := h.findCustomer(c, strconv.FormatUint(uint64(ref.CustomerID), 10))
+	if !ok {
+		return
+	}
+	h.render(c, customer, ref.From, ref.To, ref.Format)
+}
+
+func (h *StatementHandler) render(c *gin.Context, customer models.Customer, from, to time.Time, format string) {
+	statement, err := h.reports.CustomerStatement(c.Request.Context(), customer, from, to)
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to build statement")
+		return
+	}
+
+	var body bytes.Buffer
+	var contentType string
+	switch format {
+	case services.StatementCSV:
+		contentType = "text/csv; charset=utf-8"
+		err = services.WriteStatementCSV(&body, statement)
+	case services.StatementPDF:
+		contentType = "application/pdf"
+		err = services.WriteStatementPDF(&body, statement)
+	default:
+		respond.OK(c, http.StatusOK, statement)
+		return
+	}
+	if err != nil {
+		respond.ServerError(c, err, "internal_error", "failed to render statement")
+		return
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.%s", customer.Code, statement.From, statement.To, format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, contentType, body.Bytes())
+}
+
+func (h *StatementHandler) findCustomer(c *gin.Context, rawID string) (models.Customer, bool) {
+	db := h.db.WithContext(c.Request.Context())
+
+	var customer models.Customer
+	id, err := strconv.ParseUint(rawID, 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid customer id")
+		return customer, false
+	}
+
+	if err := db.First(&customer, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "customer_not_found", "customer not found")
+			return customer, false
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve customer")
+		return customer, false
+	}
+	return customer, true
+}
+
+// parsePeriod reads the statement's first and last days as YYYY-MM-DD in
+// the report timezone. They default to the current month up to today.
+func (h *StatementHandler) parsePeriod(c *gin.Context, rawFrom, rawTo string) (time.Time, time.Time, bool) {
+	location := h.reports.Location()
+	now := time.Now().In(location)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, location)
+
+	for _, day := range []struct {
+		name  string
+		raw   string
+		value *time.Time
+	}{
+		{"from", rawFrom, &from},
+		{"to", rawTo, &to},
+	} {
+		if day.raw == "" {
+			continue
+		}
+		parsed, err := time.ParseInLocation(services.DayLayout, day.raw, location)
+		if err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_range", day.name+" must be a date in YYYY-MM-DD format")
+			return from, to, false
+		}
+		*day.value = parsed
+	}
+
+	if from.After(to) {
+		respond.Error(c, http.StatusBadRequest, "invalid_range", "from must not be after to")
+		return from, to, false
+	}
+	if to.Sub(from) >= services.MaxStatementDays*24*time.Hour {
+		respond.Error(c, http.StatusBadRequest, "invalid_range", fmt.Sprintf("a statement covers at most %d days", services.MaxStatementDays))
+		return from, to, false
+	}
+	return from, to, true
+}
+
+func parseStatementFormat(c *gin.Context, format string) (string, bool) {
+	switch format {
+	case "":
+		return services.StatementJSON, true
+	case services.StatementJSON, services.StatementCSV, services.StatementPDF:
+		return format, true
+	default:
+		respond.Error(c, http.StatusBadRequest, "invalid_format", "format must be json, csv or pdf")
+		return "", false
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStatement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	links, err := services.NewStatementLinks("test-secret", "https://api.example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create statement links: %v", err)
+	}
+	handler := NewStatementHandler(db, services.NewReportService(db, nairobi), links, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	other := models.Customer{Name: "Amina Hassan", Code: "CUST002", Phone: "+254711222333", Email: "amina@example.com"}
+	for _, c := range []*models.Customer{&customer, &other} {
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("failed to create customer: %v", err)
+		}
+	}
+
+	order := func(item string, shillings float64, placed time.Time, status string, customerID uint) models.Order {
+		gross := models.Shillings(shillings)
+		return models.Order{Item: item, Amount: gross, NetAmount: gross, GrossAmount: gross, Time: placed, Status: status, CustomerID: customerID}
+	}
+	for _, o := range []models.Order{
+		order("laptop", 1000, time.Date(2025, 8, 20, 9, 0, 0, 0, time.UTC), models.OrderStatusDelivered, customer.ID),
+		order("cancelled before", 400, time.Date(2025, 8, 25, 9, 0, 0, 0, time.UTC), models.OrderStatusCancelled, customer.ID),
+		// 1 September 00:30 in Nairobi
+		order("phone", 500, time.Date(2025, 8, 31, 21, 30, 0, 0, time.UTC), models.OrderStatusPending, customer.ID),
+		order("tablet", 250.5, time.Date(2025, 9, 10, 9, 0, 0, 0, time.UTC), models.OrderStatusCancelled, customer.ID),
+		order("mouse", 99.5, time.Date(2025, 9, 30, 20, 0, 0, 0, time.UTC), models.OrderStatusShipped, customer.ID),
+		order("after", 10, time.Date(2025, 9, 30, 21, 0, 0, 0, time.UTC), models.OrderStatusPending, customer.ID),
+		order("someone else's", 700, time.Date(2025, 9, 5, 9, 0, 0, 0, time.UTC), models.OrderStatusPending, other.ID),
+	} {
+		if err := db.Create(&o).Error; err != nil {
+			t.Fatalf("failed to create order: %v", err)
+		}
+	}
+	db.Create(&models.ArchivedOrder{ID: 100, Item: "desk", Amount: models.Shillings(300), NetAmount: models.Shillings(300), GrossAmount: models.Shillings(300),
+		Time: time.Date(2025, 9, 2, 9, 0, 0, 0, time.UTC), Status: models.OrderStatusDelivered, CustomerID: customer.ID, ArchivedAt: time.Now()})
+
+	tests := []struct {
+		name                string
+		customerID          string
+		query               string
+		expectedStatus      int
+		expectedError       string
+		expectedContentType string
+	}{
+		{name: "json", customerID: "1", query: "from=2025-09-01&to=2025-09-30", expectedStatus: http.StatusOK, expectedContentType: "application/json; charset=utf-8"},
+		{name: "csv", customerID: "1", query: "from=2025-09-01&to=2025-09-30&format=csv", expectedStatus: http.StatusOK, expectedContentType: "text/csv; charset=utf-8"},
+		{name: "pdf", customerID: "1", query: "from=2025-09-01&to=2025-09-30&format=pdf", expectedStatus: http.StatusOK, expectedContentType: "application/pdf"},
+		{name: "unknown format", customerID: "1", query: "format=xlsx", expectedStatus: http.StatusBadRequest, expectedError: "invalid_format"},
+		{name: "reversed period", customerID: "1", query: "from=2025-09-30&to=2025-09-01", expectedStatus: http.StatusBadRequest, expectedError: "invalid_range"},
+		{name: "period too long", customerID: "1", query: "from=2024-01-01&to=2025-09-01", expectedStatus: http.StatusBadRequest, expectedError: "invalid_range"},
+		{name: "invalid date", customerID: "1", query: "from=september", expectedStatus: http.StatusBadRequest, expectedError: "invalid_range"},
+		{name: "non-existent customer", customerID: "999", expectedStatus: http.StatusNotFound, expectedError: "customer_not_found"},
+		{name: "invalid customer id", customerID: "abc", expectedStatus: http.StatusBadRequest, expectedError: "invalid_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/customers/"+tt.customerID+"/statement?"+tt.query, nil)
+			c.Params = []gin.Param{{Key: "id", Value: tt.customerID}}
+
+			handler.GetStatement(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+			assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+
+			switch tt.name {
+			case "json":
+				var statement models.Statement
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &statement})
+				assert.Equal(t, "2025-09-01", statement.From)
+				assert.Equal(t, "2025-09-30", statement.To)
+				assert.Equal(t, models.Shillings(1000), statement.OpeningBalance)
+				assert.Equal(t, models.Shillings(899.5), statement.Charges)
+				assert.Equal(t, models.Shillings(250.5), statement.Cancelled)
+				assert.Equal(t, models.Shillings(1899.5), statement.ClosingBalance)
+				assert.Equal(t, int64(3), statement.OrdersCount)
+
+				items := make([]string, 0, len(statement.Lines))
+				for _, line := range statement.Lines {
+					items = append(items, line.Item+" "+line.Kind)
+				}
+				assert.Equal(t, []string{"phone charge", "desk charge", "tablet cancelled", "mouse charge"}, items)
+				assert.Equal(t, []models.Money{150000, 180000, 180000, 189950}, []models.Money{
+					statement.Lines[0].Balance, statement.Lines[1].Balance, statement.Lines[2].Balance, statement.Lines[3].Balance,
+				})
+			case "csv":
+				assert.Equal(t, `attachment; filename="statement-CUST001-2025-09-01-2025-09-30.csv"`, w.Header().Get("Content-Disposition"))
+				lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+				assert.Equal(t, "2025-09-01,,opening balance,,,,,,1000.00", lines[1])
+				assert.Equal(t, "2025-09-01 00:30,3,phone,pending,charge,500.00,0.00,500.00,1500.00", lines[2])
+				assert.Equal(t, "2025-09-30,,closing balance,,,,,,1899.50", lines[len(lines)-1])
+			case "pdf":
+				assert.True(t, bytes.HasPrefix(w.Body.Bytes(), []byte("%PDF-1.4")))
+				assert.Contains(t, w.Body.String(), "(Customer: Sebbie Chanzu \\(CUST001\\)) Tj")
+			}
+		})
+	}
+}
+
+func TestSendStatement(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	reports := services.NewReportService(db, time.UTC)
+	mockSMSService := services.NewMockSMSService()
+	links, err := services.NewStatementLinks("test-secret", "https://api.example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create statement links: %v", err)
+	}
+	tracking, err := services.NewTrackingService("test-secret", "", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create tracking service: %v", err)
+	}
+	handler := NewStatementHandler(db, reports, links, mockSMSService)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/customers/1/statement/send", strings.NewReader(`{"from": "2025-09-01", "to": "2025-09-30", "format": "pdf"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+	handler.SendStatement(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+	assert.True(t, strings.HasPrefix(response.URL, "https://api.example.com/statements/"))
+	if assert.Len(t, mockSMSService.SentMessages, 1) {
+		assert.Equal(t, customer.Phone, mockSMSService.SentMessages[0].To)
+		assert.Equal(t, "hello Sebbie Chanzu, your statement for 2025-09-01 to 2025-09-30 is ready: "+response.URL, mockSMSService.SentMessages[0].Message)
+	}
+
+	// the link opens the statement without authentication
+	token := strings.TrimPrefix(response.URL, "https://api.example.com/statements/")
+	tests := []struct {
+		name                string
+		token               string
+		expectedStatus      int
+		expectedError       string
+		expectedContentType string
+	}{
+		{name: "valid link", token: token, expectedStatus: http.StatusOK, expectedContentType: "application/pdf"},
+		{name: "tampered link", token: strings.Replace(token, "20250901", "20250101", 1), expectedStatus: http.StatusNotFound, expectedError: "statement_link_not_found"},
+		{name: "tracking token", token: tracking.GenerateToken(1), expectedStatus: http.StatusNotFound, expectedError: "statement_link_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("GET", "/statements/"+tt.token, nil)
+			c.Params = []gin.Param{{Key: "token", Value: tt.token}}
+
+			handler.GetSharedStatement(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+			assert.Equal(t, tt.expectedContentType, w.Header().Get("Content-Type"))
+		})
+	}
+}
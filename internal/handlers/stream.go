@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NDJSONContentType is the type of streamed lists, one JSON object a line
+const NDJSONContentType = "application/x-ndjson"
+
+// streamFlushEvery is how many rows are written between flushes, so a
+// compressed stream still reaches the client as it is read
+const streamFlushEvery = 100
+
+// StreamOrders writes every order matching the list filters as NDJSON, in
+// id order. Rows are read through a database cursor, so an export of any
+// size needs neither pages nor the whole result in memory.
+func (h *OrderHandler) StreamOrders(c *gin.Context) {
+	customerID, ok := parseCustomerFilter(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filters, ok := parseOrderFilters(c, orderFilterFields)
+	if !ok {
+		return
+	}
+	breached, ok := parseSLAFilter(c)
+	if !ok {
+		return
+	}
+	fields, ok := parseStreamFields(c, orderFields)
+	if !ok {
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.Order{}).
+		Scopes(scopes.ByCustomer(customerID), scopes.CreatedBetween(from, to), filters.scope)
+	if breached {
+		query = query.Scopes(slaBreached)
+	}
+	if fields != nil {
+		query = query.Select(orderFields.selectColumns(fields))
+	}
+	// as a summary, so the unloaded customer is left out
+	streamNDJSON(c, query, fields, "orders", func(order models.Order) interface{} {
+		return models.OrderSummary{Order: order}
+	})
+}
+
+// StreamCustomers writes every customer matching the list filters as
+// NDJSON, in id order, like StreamOrders
+func (h *CustomerHandler) StreamCustomers(c *gin.Context) {
+	from, to, ok := parseCreatedRange(c)
+	if !ok {
+		return
+	}
+	filter, ok := parseFilter(c, customerFilterFields)
+	if !ok {
+		return
+	}
+	fields, ok := parseStreamFields(c, customerFields)
+	if !ok {
+		return
+	}
+
+	query := h.db.WithContext(c.Request.Context()).Model(&models.Customer{}).
+		Scopes(scopes.CreatedBetween(from, to), filter.Scope)
+	if fields != nil {
+		query = query.Select(customerFields.selectColumns(fields))
+	} else {
+		query = query.Select("customers.*", ordersCountColumn+" AS orders_count")
+	}
+	streamNDJSON(c, query, fields, "customers", func(customer models.Customer) interface{} {
+		return customer
+	})
+}
+
+// parseStreamFields reads ?fields= like a list does, except that related
+// records are never embedded in a stream
+func parseStreamFields(c *gin.Context, spec fieldSpec) ([]string, bool) {
+	fields, err := spec.parse(c)
+	if err == nil {
+		for _, field := range fields {
+			if _, ok := spec.relations[field]; ok {
+				err = fmt.Errorf("%s can't be streamed", field)
+				break
+			}
+		}
+	}
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_fields", err.Error())
+		return nil, false
+	}
+	return fields, true
+}
+
+// streamNDJSON writes the rows of query, scanned as T and encoded as view
+// returns them, one JSON object a line. A failure before the first row is
+// a 500 as usual; after it, the status is already sent, so the stream ends
+// with an error line instead.
+func streamNDJSON[T any](c *gin.Context, query *gorm.DB, fields []string, resource string, view func(T) interface{}) {
+	rows, err := query.Order("id").Rows()
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve "+resource)
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", NDJSONContentType)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	written := 0
+	for rows.Next() {
+		var row T
+		if err = query.ScanRows(rows, &row); err != nil {
+			break
+		}
+		if err = encoder.Encode(projectFields(view(row), fields)); err != nil {
+			// the client went away
+			return
+		}
+		written++
+		if written%streamFlushEvery == 0 {
+			c.Writer.Flush()
+		}
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil && c.Request.Context().Err() == nil {
+		respond.StreamError(c, fmt.Errorf("after %d rows: %w", written, err), "database_error", "failed to retrieve "+resource)
+	}
+	c.Writer.Flush()
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamNDJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+
+	// enough rows to span several flushes
+	for i := 1; i <= 250; i++ {
+		customer := models.Customer{Name: fmt.Sprintf("Customer %d", i), Code: fmt.Sprintf("CUST%03d", i), Phone: "+254740827150", Email: fmt.Sprintf("customer%d@example.com", i)}
+		require.NoError(t, db.Create(&customer).Error)
+		item := "laptop"
+		if i%2 == 0 {
+			item = "phone"
+		}
+		require.NoError(t, db.Create(&models.Order{Item: item, Amount: models.Shillings(float64(i)), Time: time.Now(), CustomerID: customer.ID}).Error)
+	}
+
+	r := gin.New()
+	r.Use(middleware.Compress(middleware.DefaultCompressionConfig()))
+	customerHandler := NewCustomerHandler(db)
+	orderHandler := NewOrderHandler(db, services.NewMockSMSService())
+	r.GET("/customers/stream.ndjson", customerHandler.StreamCustomers)
+	r.GET("/orders/stream.ndjson", orderHandler.StreamOrders)
+
+	stream := func(t *testing.T, path string, gzipped bool) []map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if gzipped {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		r.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, NDJSONContentType, w.Header().Get("Content-Type"))
+
+		scanner := bufio.NewScanner(w.Body)
+		if gzipped {
+			require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			gz, err := gzip.NewReader(w.Body)
+			require.NoError(t, err)
+			scanner = bufio.NewScanner(gz)
+		}
+		var lines []map[string]interface{}
+		for scanner.Scan() {
+			var line map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			lines = append(lines, line)
+		}
+		return lines
+	}
+
+	t.Run("streams every customer in id order", func(t *testing.T) {
+		lines := stream(t, "/customers/stream.ndjson", true)
+		require.Len(t, lines, 250)
+		assert.Equal(t, float64(1), lines[0]["id"])
+		assert.Equal(t, float64(250), lines[249]["id"])
+		assert.Equal(t, "customer250@example.com", lines[249]["email"])
+		assert.Equal(t, float64(1), lines[249]["orders_count"])
+	})
+
+	t.Run("orders take the list filters", func(t *testing.T) {
+		lines := stream(t, "/orders/stream.ndjson?item=phone&min_amount=100", false)
+		require.Len(t, lines, 76)
+		assert.Equal(t, "phone", lines[0]["item"])
+		assert.Equal(t, float64(100), lines[0]["amount"])
+		assert.NotContains(t, lines[0], "customer")
+	})
+
+	t.Run("projects fields", func(t *testing.T) {
+		lines := stream(t, "/orders/stream.ndjson?customer_id=3&fields=item,amount", false)
+		require.Len(t, lines, 1)
+		assert.Equal(t, map[string]interface{}{"item": "laptop", "amount": float64(3)}, lines[0])
+	})
+
+	t.Run("rejects related fields and bad filters", func(t *testing.T) {
+		for path, code := range map[string]string{
+			"/orders/stream.ndjson?fields=item,customer": "invalid_fields",
+			"/customers/stream.ndjson?fields=orders":     "invalid_fields",
+			"/orders/stream.ndjson?sla=met":              "invalid_sla_filter",
+			"/orders/stream.ndjson?customer_id=abc":      "invalid_id",
+		} {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			r.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code, path)
+			var body models.ErrorEnvelope
+			json.Unmarshal(w.Body.Bytes(), &body)
+			assert.Equal(t, code, body.Error.Code, path)
+		}
+	})
+}
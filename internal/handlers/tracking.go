@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type TrackingHandler struct {
+	db       *gorm.DB
+	tracking *services.TrackingService
+	cache    services.CachePolicy
+}
+
+func NewTrackingHandler(db *gorm.DB, tracking *services.TrackingService) *TrackingHandler {
+	return &TrackingHandler{
+		db:       db,
+		tracking: tracking,
+		cache:    services.DefaultCachePolicy(),
+	}
+}
+
+// WithCachePolicy sets how long the CDN may keep tracking pages
+func (h *TrackingHandler) WithCachePolicy(policy services.CachePolicy) *TrackingHandler {
+	h.cache = policy.WithDefaults()
+	return h
+}
+
+// Track shows the status of the order referenced by a signed tracking token.
+// It is public, so only non-identifying order fields are returned, and the
+// CDN may cache it under the order's key until the order changes. With no
+// tracking service no link was issued, so none is valid.
+func (h *TrackingHandler) Track(c *gin.Context) {
+	db := h.db.WithContext(c.Request.Context())
+	if h.tracking == nil {
+		respond.Error(c, http.StatusNotFound, "tracking_link_not_found", "invalid tracking link")
+		return
+	}
+
+	orderID, err := h.tracking.VerifyToken(c.Param("token"))
+	if err != nil {
+		if errors.Is(err, services.ErrTrackingTokenExpired) {
+			respond.Error(c, http.StatusGone, "tracking_link_expired", "this tracking link has expired")
+			return
+		}
+		respond.Error(c, http.StatusNotFound, "tracking_link_not_found", "invalid tracking link")
+		return
+	}
+
+	var order models.Order
+	if err := db.First(&order, orderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+			return
+		}
+		respond.ServerError(c, err, "database_error", "failed to retrieve order")
+		return
+	}
+
+	middleware.CachePublicly(c, h.cache.TrackingTTL, services.OrderCacheKey(order.ID))
+	respond.OK(c, http.StatusOK, models.TrackingResponse{
+		OrderID:             order.ID,
+		Item:                order.Item,
+		Status:              order.Status,
+		PlacedAt:            order.Time,
+		EstimatedDeliveryAt: order.EstimatedDeliveryAt,
+	})
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	trackingService, err := services.NewTrackingService("test-secret", "https://api.example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create tracking service: %v", err)
+	}
+	handler := NewTrackingHandler(db, trackingService)
+
+	customer := models.Customer{
+		Name:  "Sebbie Chanzu",
+		Code:  "CUST001",
+		Phone: "+254740827150",
+		Email: "sebbievilar2@gmail.com",
+	}
+	if err := db.Create(&customer).Error; err != nil {
+		t.Fatalf("failed to create customer: %v", err)
+	}
+
+	eta := time.Now().Add(48 * time.Hour)
+	order := models.Order{
+		Item:                "laptop",
+		Amount:              models.Shillings(1500.00),
+		Time:                time.Now(),
+		Status:              models.OrderStatusShipped,
+		EstimatedDeliveryAt: &eta,
+		CustomerID:          customer.ID,
+	}
+	if err := db.Create(&order).Error; err != nil {
+		t.Fatalf("failed to create order: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "valid tracking token",
+			token:          trackingService.GenerateToken(order.ID),
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "tampered tracking token",
+			token:          trackingService.GenerateToken(order.ID) + "x",
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "tracking_link_not_found",
+		},
+		{
+			name:           "token for missing order",
+			token:          trackingService.GenerateToken(999),
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "order_not_found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			req, _ := http.NewRequest("GET", "/track/"+tt.token, nil)
+			c.Request = req
+			c.Params = []gin.Param{{Key: "token", Value: tt.token}}
+
+			handler.Track(c)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+
+			if tt.expectedError != "" {
+				var errorResponse models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &errorResponse)
+				assert.Equal(t, tt.expectedError, errorResponse.Error.Code)
+				assert.Empty(t, w.Header().Get("Surrogate-Key"))
+			} else {
+				var response models.TrackingResponse
+				json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &response})
+				assert.Equal(t, order.ID, response.OrderID)
+				assert.Equal(t, models.OrderStatusShipped, response.Status)
+				assert.NotNil(t, response.EstimatedDeliveryAt)
+				assert.Equal(t, "public, max-age=0, s-maxage=60", w.Header().Get("Cache-Control"))
+				assert.Equal(t, services.OrderCacheKey(order.ID), w.Header().Get("Surrogate-Key"))
+			}
+		})
+	}
+}
+
+func TestOrderNotificationIncludesTrackingLink(t *testing.T) {
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	trackingService, err := services.NewTrackingService("test-secret", "https://api.example.com", time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create tracking service: %v", err)
+	}
+	handler := NewOrderHandler(db, mockSMSService).WithTracking(trackingService)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Phone: "+254740827150"}
+	order := models.Order{ID: 7, Item: "laptop", Amount: models.Shillings(1500.00), Time: time.Now()}
+
+	handler.sendOrderNotification(context.Background(), customer, order)
+
+	assert.Len(t, mockSMSService.SentMessages, 1)
+	assert.Contains(t, mockSMSService.SentMessages[0].Message, "https://api.example.com/track/7.")
+}
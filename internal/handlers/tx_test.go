@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+func TestWithTx(t *testing.T) {
+	errFailed := errors.New("failed")
+
+	tests := []struct {
+		name          string
+		fn            func(tx *gorm.DB) error
+		expectedErr   error
+		expectedPanic bool
+		expectedKept  bool
+	}{
+		{
+			name: "commits when fn succeeds",
+			fn: func(tx *gorm.DB) error {
+				return tx.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}).Error
+			},
+			expectedKept: true,
+		},
+		{
+			name: "rolls back and returns fn's error",
+			fn: func(tx *gorm.DB) error {
+				if err := tx.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}).Error; err != nil {
+					return err
+				}
+				return errFailed
+			},
+			expectedErr: errFailed,
+		},
+		{
+			name: "rolls back on panic",
+			fn: func(tx *gorm.DB) error {
+				tx.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+				panic("boom")
+			},
+			expectedPanic: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := testutil.DB(t)
+
+			var err error
+			run := func() { err = services.WithTx(context.Background(), db, tt.fn) }
+			if tt.expectedPanic {
+				assert.Panics(t, run)
+			} else {
+				run()
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+
+			var count int64
+			db.Model(&models.Customer{}).Count(&count)
+			if tt.expectedKept {
+				assert.Equal(t, int64(1), count)
+			} else {
+				assert.Zero(t, count)
+			}
+		})
+	}
+}
+
+func TestWithTxCancelledContext(t *testing.T) {
+	db := testutil.DB(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := services.WithTx(ctx, db, func(tx *gorm.DB) error {
+		return tx.Create(&models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}).Error
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// WebhookHandler lets admins subscribe consumers to order events and
+// rotate the secrets deliveries are signed with
+type WebhookHandler struct {
+	webhooks *services.WebhookService
+	audit    services.AuditRecorder
+}
+
+func NewWebhookHandler(webhooks *services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhooks: webhooks}
+}
+
+// WithAudit records subscriptions created, changed and deleted, and
+// secrets rotated
+func (h *WebhookHandler) WithAudit(audit services.AuditRecorder) *WebhookHandler {
+	h.audit = audit
+	return h
+}
+
+// CreateWebhook subscribes a URL. Its signing secret is only ever shown in
+// this response.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req models.CreateWebhookSubscriptionRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	sub := models.WebhookSubscription{
+		URL:         req.URL,
+		Description: req.Description,
+		Events:      req.Events,
+		CreatedBy:   middleware.CurrentUserEmail(c),
+	}
+	if err := h.webhooks.Create(c.Request.Context(), &sub); err != nil {
+		respond.ServerError(c, err, "database_error", "failed to create webhook")
+		return
+	}
+	h.record(c, models.AuditWebhookCreated, sub)
+
+	// not respond.Created: a minimal body would lose the secret
+	respond.OK(c, http.StatusCreated, sub)
+}
+
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	subs, err := h.webhooks.List(c.Request.Context())
+	if err != nil {
+		respond.ServerError(c, err, "database_error", "failed to retrieve webhooks")
+		return
+	}
+	respond.OK(c, http.StatusOK, subs)
+}
+
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	sub, err := h.webhooks.Get(c.Request.Context(), id)
+	if err != nil {
+		webhookError(c, err, "failed to retrieve webhook")
+		return
+	}
+	respond.OK(c, http.StatusOK, sub)
+}
+
+// UpdateWebhook changes a subscription's URL, description or events, or
+// pauses and resumes its deliveries
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateWebhookSubscriptionRequest
+	if err := respond.BindJSON(c, &req); err != nil {
+		respond.BindError(c, err)
+		return
+	}
+
+	sub, err := h.webhooks.Update(c.Request.Context(), id, req)
+	if err != nil {
+		webhookError(c, err, "failed to update webhook")
+		return
+	}
+	h.record(c, models.AuditWebhookUpdated, sub)
+
+	respond.OK(c, http.StatusOK, sub)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	sub, err := h.webhooks.Delete(c.Request.Context(), id)
+	if err != nil {
+		webhookError(c, err, "failed to delete webhook")
+		return
+	}
+	h.record(c, models.AuditWebhookDeleted, sub)
+
+	respond.OK(c, http.StatusOK, gin.H{"message": "webhook deleted successfully"})
+}
+
+// RotateWebhookSecret replaces a subscription's signing secret, returning
+// the new one. The old one keeps signing deliveries for the grace period.
+func (h *WebhookHandler) RotateWebhookSecret(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+	var req models.RotateWebhookSecretRequest
+	if c.Request.ContentLength != 0 {
+		if err := respond.BindJSON(c, &req); err != nil {
+			respond.BindError(c, err)
+			return
+		}
+	}
+	grace := services.DefaultWebhookGracePeriod
+	if req.GracePeriodMinutes != nil {
+		grace = time.Duration(*req.GracePeriodMinutes) * time.Minute
+	}
+
+	sub, err := h.webhooks.RotateSecret(c.Request.Context(), id, grace)
+	if err != nil {
+		webhookError(c, err, "failed to rotate webhook secret")
+		return
+	}
+	h.record(c, models.AuditWebhookSecretRotated, sub)
+
+	respond.OK(c, http.StatusOK, sub)
+}
+
+func webhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		respond.Error(c, http.StatusBadRequest, "invalid_id", "invalid webhook id")
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func webhookError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrWebhookNotFound) {
+		respond.Error(c, http.StatusNotFound, "webhook_not_found", "webhook not found")
+		return
+	}
+	respond.ServerError(c, err, "database_error", message)
+}
+
+func (h *WebhookHandler) record(c *gin.Context, eventType string, sub models.WebhookSubscription) {
+	if h.audit == nil {
+		return
+	}
+	details := fmt.Sprintf("webhook=%d url=%s active=%t", sub.ID, sub.URL, sub.Active)
+	if len(sub.Events) > 0 {
+		details += " events=" + strings.Join(sub.Events, ",")
+	}
+	if sub.PreviousSecretExpiresAt != nil && eventType == models.AuditWebhookSecretRotated {
+		details += " previous_secret_expires_at=" + sub.PreviousSecretExpiresAt.UTC().Format(time.RFC3339)
+	}
+	h.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     middleware.CurrentUserEmail(c),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
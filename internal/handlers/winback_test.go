@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLastOrderAt(t *testing.T) {
+	db := testutil.DB(t)
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	placed := time.Date(2025, 9, 1, 9, 0, 0, 0, time.UTC)
+	db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: placed, CustomerID: customer.ID, CreatedAt: placed})
+	db.Create(&models.Order{Item: "phone", Amount: models.Shillings(800), Time: placed, CustomerID: customer.ID, CreatedAt: placed.AddDate(0, 0, -7)})
+
+	db.First(&customer, customer.ID)
+	if assert.NotNil(t, customer.LastOrderAt) {
+		assert.True(t, placed.Equal(*customer.LastOrderAt), "an older order does not move last_order_at back")
+	}
+}
+
+func TestWinBackCampaign(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+	mockSMSService := services.NewMockSMSService()
+	winBack := services.NewWinBackService(db, mockSMSService, services.WinBackPolicy{Message: "hi {name}, we miss you. 10% off your next order"})
+	handler := NewReportHandler(services.NewReportService(db, time.UTC)).WithWinBack(winBack)
+
+	lapsed := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	recent := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"}
+	optedOut := models.Customer{Name: "Amina Hassan", Code: "CUST003", Phone: "+254711000003", Email: "amina@example.com"}
+	never := models.Customer{Name: "Otieno Odhiambo", Code: "CUST004", Phone: "+254711000004", Email: "otieno@example.com"}
+	for _, customer := range []*models.Customer{&lapsed, &recent, &optedOut, &never} {
+		db.Create(customer)
+	}
+
+	longAgo := time.Now().AddDate(0, 0, -120)
+	db.Create(&models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: longAgo, CustomerID: lapsed.ID, CreatedAt: longAgo})
+	db.Create(&models.Order{Item: "phone", Amount: models.Shillings(800), Time: time.Now(), CustomerID: recent.ID})
+	db.Create(&models.Order{Item: "tablet", Amount: models.Shillings(600), Time: longAgo, CustomerID: optedOut.ID, CreatedAt: longAgo})
+	db.Model(&models.Customer{}).Where("id = ?", optedOut.ID).UpdateColumn("marketing_opt_out_at", time.Now())
+
+	sent, err := winBack.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	if assert.Len(t, mockSMSService.SentMessages, 1) {
+		assert.Equal(t, "+254740827150", mockSMSService.SentMessages[0].To)
+		assert.Equal(t, "hi Sebbie Chanzu, we miss you. 10% off your next order. reply STOP to opt out", mockSMSService.SentMessages[0].Message)
+	}
+
+	// each lapse is texted once
+	sent, err = winBack.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Zero(t, sent)
+
+	comeback := models.Order{Item: "charger", Amount: models.Shillings(200), Time: time.Now(), CustomerID: lapsed.ID}
+	db.Create(&comeback)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/reports/win-back", nil)
+	handler.GetWinBackReport(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var report models.WinBackReport
+	json.Unmarshal(w.Body.Bytes(), &models.Envelope{Data: &report})
+	assert.Equal(t, int64(1), report.MessagesSent)
+	assert.Equal(t, int64(0), report.MessagesFailed)
+	assert.Equal(t, int64(1), report.Reactivated)
+	assert.Equal(t, 1.0, report.ReactivationRate)
+	if assert.Len(t, report.Customers, 1) {
+		assert.Equal(t, lapsed.ID, report.Customers[0].CustomerID)
+		assert.Equal(t, "CUST001", report.Customers[0].Code)
+		assert.Equal(t, comeback.ID, report.Customers[0].OrderID)
+		assert.Equal(t, models.Shillings(200), report.Customers[0].Amount)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("GET", "/reports/win-back?from=2025-10-01&to=2025-09-01", nil)
+	handler.GetWinBackReport(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSMSMarketingOptOut(t *testing.T) {
+	db := testutil.DB(t)
+	handler := NewSMSCallbackHandler(db, services.NewMockSMSService())
+
+	customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+	db.Create(&customer)
+
+	assert.Equal(t, "you will no longer receive offers from us. reply START to opt back in", handler.commandReply(db, customer, "stop"))
+	var optedOut models.Customer
+	db.First(&optedOut, customer.ID)
+	assert.NotNil(t, optedOut.MarketingOptOutAt)
+
+	assert.Equal(t, "you will receive our offers again. reply STOP to opt out", handler.commandReply(db, customer, "START"))
+	var optedIn models.Customer
+	db.First(&optedIn, customer.ID)
+	assert.Nil(t, optedIn.MarketingOptOutAt)
+}
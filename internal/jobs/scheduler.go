@@ -0,0 +1,258 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
+)
+
+// What started a run
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobRunning  = errors.New("job is already running")
+)
+
+// Job is a unit of background work run on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// History keeps a record of job runs that outlives the process
+type History interface {
+	// Started records a run that has just begun and returns its id
+	Started(ctx context.Context, job, trigger string, at time.Time) (uint, error)
+	// Finished records how the run ended; err is nil when it succeeded
+	Finished(ctx context.Context, id uint, duration time.Duration, err error) error
+}
+
+// Status is what the scheduler knows about a job on this instance
+type Status struct {
+	Name     string
+	Interval time.Duration
+	// Running is set while a run is in progress on this instance
+	Running bool
+	// NextRunAt is zero when the job is not scheduled here, as on
+	// serverless instances, where jobs only run when triggered
+	NextRunAt time.Time
+}
+
+// Scheduler runs registered jobs in their own goroutines until stopped.
+// A job never runs twice at once on the same scheduler: a scheduled run
+// that comes up while the job is still running is skipped.
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    []Job
+	state   map[string]*jobState
+	history History
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type jobState struct {
+	running   bool
+	nextRunAt time.Time
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{state: map[string]*jobState{}}
+}
+
+// WithHistory records every run in history
+func (s *Scheduler) WithHistory(history History) *Scheduler {
+	s.history = history
+	return s
+}
+
+// Register adds a job. Jobs registered after Start are not run.
+func (s *Scheduler) Register(job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs = append(s.jobs, job)
+	s.state[job.Name] = &jobState{}
+}
+
+// Start runs every job once immediately and then on its interval
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(s.ctx, job)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// Jobs reports on every registered job, in the order they were registered
+func (s *Scheduler) Jobs() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		state := s.state[job.Name]
+		statuses = append(statuses, Status{
+			Name:      job.Name,
+			Interval:  job.Interval,
+			Running:   state.running,
+			NextRunAt: state.nextRunAt,
+		})
+	}
+	return statuses
+}
+
+// RunNow starts a run of the named job in the background, whether or not
+// the scheduler was started. It returns ErrJobRunning when the job is
+// already running here.
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	job, ok := s.find(name)
+	if !ok {
+		s.mu.Unlock()
+		return ErrJobNotFound
+	}
+	state := s.state[name]
+	if state.running {
+		s.mu.Unlock()
+		return ErrJobRunning
+	}
+	state.running = true
+	ctx := s.ctx
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	go func() {
+		defer s.wg.Done()
+		defer s.release(name)
+		s.runOnce(ctx, job, TriggerManual)
+	}()
+	return nil
+}
+
+func (s *Scheduler) find(name string) (Job, bool) {
+	for _, job := range s.jobs {
+		if job.Name == name {
+			return job, true
+		}
+	}
+	return Job{}, false
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	defer s.wg.Done()
+	defer s.setNextRun(job.Name, time.Time{})
+
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.setNextRun(job.Name, time.Now().Add(job.Interval))
+		if s.claim(job.Name) {
+			s.runOnce(ctx, job, TriggerSchedule)
+			s.release(job.Name)
+		} else {
+			log.Printf("job %s is still running, skipping this run", job.Name)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) setNextRun(name string, at time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[name].nextRunAt = at
+}
+
+// claim marks the job as running, unless it already is
+func (s *Scheduler) claim(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.state[name]
+	if state.running {
+		return false
+	}
+	state.running = true
+	return true
+}
+
+func (s *Scheduler) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state[name].running = false
+}
+
+func (s *Scheduler) runOnce(ctx context.Context, job Job, trigger string) {
+	start := time.Now()
+
+	var id uint
+	recorded := false
+	if s.history != nil {
+		var err error
+		if id, err = s.history.Started(ctx, job.Name, trigger, start); err != nil {
+			log.Printf("failed to record start of job %s: %v", job.Name, err)
+		} else {
+			recorded = true
+		}
+	}
+
+	err := s.run(ctx, job)
+	duration := time.Since(start)
+	if err != nil {
+		log.Printf("job %s failed after %s: %v", job.Name, duration, err)
+	} else {
+		log.Printf("job %s completed in %s", job.Name, duration)
+	}
+
+	if recorded {
+		// a run cut short by Stop is still recorded
+		if err := s.history.Finished(context.WithoutCancel(ctx), id, duration, err); err != nil {
+			log.Printf("failed to record end of job %s: %v", job.Name, err)
+		}
+	}
+}
+
+// run calls the job, turning a panic into an error
+func (s *Scheduler) run(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("job %s panicked (%s): %v", job.Name, buildinfo.Get(), r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
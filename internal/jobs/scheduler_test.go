@@ -0,0 +1,151 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerRunsJobsUntilStopped(t *testing.T) {
+	var runs, failures int32
+
+	scheduler := NewScheduler()
+	scheduler.Register(Job{
+		Name:     "counter",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+	})
+	scheduler.Register(Job{
+		Name:     "failing",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&failures, 1)
+			return errors.New("boom")
+		},
+	})
+
+	scheduler.Start(context.Background())
+	time.Sleep(30 * time.Millisecond)
+	scheduler.Stop()
+
+	stoppedAt := atomic.LoadInt32(&runs)
+	assert.GreaterOrEqual(t, stoppedAt, int32(2))
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&failures), int32(2))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, stoppedAt, atomic.LoadInt32(&runs))
+}
+
+type recordedRun struct {
+	job, trigger string
+	err          error
+	finished     bool
+}
+
+type memoryHistory struct {
+	mu   sync.Mutex
+	runs []*recordedRun
+}
+
+func (h *memoryHistory) Started(ctx context.Context, job, trigger string, at time.Time) (uint, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs = append(h.runs, &recordedRun{job: job, trigger: trigger})
+	return uint(len(h.runs)), nil
+}
+
+func (h *memoryHistory) Finished(ctx context.Context, id uint, duration time.Duration, err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.runs[id-1].err = err
+	h.runs[id-1].finished = true
+	return nil
+}
+
+func TestSchedulerRunNow(t *testing.T) {
+	history := &memoryHistory{}
+	release := make(chan struct{})
+
+	scheduler := NewScheduler().WithHistory(history)
+	scheduler.Register(Job{
+		Name:     "slow",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			<-release
+			return nil
+		},
+	})
+	scheduler.Register(Job{
+		Name:     "panicking",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			panic("boom")
+		},
+	})
+
+	statuses := scheduler.Jobs()
+	if assert.Len(t, statuses, 2) {
+		assert.Equal(t, "slow", statuses[0].Name)
+		assert.True(t, statuses[0].NextRunAt.IsZero(), "jobs are not scheduled before Start")
+	}
+
+	assert.ErrorIs(t, scheduler.RunNow("missing"), ErrJobNotFound)
+	assert.NoError(t, scheduler.RunNow("slow"))
+	assert.ErrorIs(t, scheduler.RunNow("slow"), ErrJobRunning)
+	assert.True(t, scheduler.Jobs()[0].Running)
+
+	assert.NoError(t, scheduler.RunNow("panicking"))
+	close(release)
+	scheduler.Stop()
+
+	assert.False(t, scheduler.Jobs()[0].Running)
+	history.mu.Lock()
+	defer history.mu.Unlock()
+	if assert.Len(t, history.runs, 2) {
+		for _, run := range history.runs {
+			assert.Equal(t, TriggerManual, run.trigger)
+			assert.True(t, run.finished)
+			if run.job == "panicking" {
+				assert.ErrorContains(t, run.err, "panic: boom")
+			} else {
+				assert.NoError(t, run.err)
+			}
+		}
+	}
+}
+
+func TestSchedulerSkipsOverlappingRuns(t *testing.T) {
+	var runs int32
+	release := make(chan struct{})
+
+	scheduler := NewScheduler()
+	scheduler.Register(Job{
+		Name:     "slow",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			atomic.AddInt32(&runs, 1)
+			<-release
+			return nil
+		},
+	})
+	assert.NoError(t, scheduler.RunNow("slow"))
+
+	scheduler.Start(context.Background())
+	assert.Eventually(t, func() bool {
+		return !scheduler.Jobs()[0].NextRunAt.IsZero()
+	}, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	scheduler.Stop()
+
+	// the scheduled run came up while the manual one was running
+	assert.Equal(t, int32(1), atomic.LoadInt32(&runs))
+}
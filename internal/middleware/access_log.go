@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// AccessLog logs one line per request, like gin's logger but with the
+// request id, so a line can be matched to the response a client reports
+func AccessLog() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		requestID, _ := p.Keys[respond.RequestIDKey].(string)
+		line := fmt.Sprintf("[GIN] %s | %3d | %13v | %15s | %-7s %#v | %s\n",
+			p.TimeStamp.Format(time.RFC3339), p.StatusCode, p.Latency, p.ClientIP, p.Method, p.Path, requestID)
+		if p.ErrorMessage != "" {
+			line += p.ErrorMessage
+		}
+		return line
+	})
+}
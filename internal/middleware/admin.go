@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin lets through only authenticated users whose email is in
+// adminEmails. It must run after AuthMiddleware.
+// With no admin emails configured every request is refused.
+func RequireAdmin(adminEmails []string) gin.HandlerFunc {
+	admins := make(map[string]bool, len(adminEmails))
+	for _, email := range adminEmails {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			admins[email] = true
+		}
+	}
+
+	return func(c *gin.Context) {
+		if !admins[strings.ToLower(CurrentUserEmail(c))] {
+			respond.AbortError(c, http.StatusForbidden, "forbidden", "admin access required")
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		adminEmails    []string
+		userEmail      string
+		expectedStatus int
+	}{
+		{
+			name:           "admin email",
+			adminEmails:    []string{"admin@example.com"},
+			userEmail:      "admin@example.com",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "admin email in different case",
+			adminEmails:    []string{" Admin@Example.com"},
+			userEmail:      "admin@example.COM",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "non admin email",
+			adminEmails:    []string{"admin@example.com"},
+			userEmail:      "user@example.com",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "no admins configured",
+			adminEmails:    nil,
+			userEmail:      "",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/admin", func(c *gin.Context) {
+				SetCurrentUser(c, &models.Claims{Email: tt.userEmail})
+				c.Next()
+			}, RequireAdmin(tt.adminEmails), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/admin", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries a partner's API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuth signs in requests that carry an API key, counts them against
+// the key's monthly quota and rejects them once it is used up. Requests
+// without a key are left to AuthMiddleware, which must run after it.
+func APIKeyAuth(keys *services.APIKeyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		secret := c.GetHeader(APIKeyHeader)
+		if secret == "" {
+			c.Next()
+			return
+		}
+
+		key, err := keys.Authenticate(c.Request.Context(), secret)
+		if err != nil {
+			if errors.Is(err, services.ErrAPIKeyNotFound) {
+				respond.AbortError(c, http.StatusUnauthorized, "invalid_api_key", "invalid or revoked api key")
+				return
+			}
+			respond.AbortError(c, http.StatusInternalServerError, "database_error", "failed to check api key")
+			return
+		}
+
+		used, err := keys.Use(c.Request.Context(), key)
+		if key.MonthlyQuota > 0 {
+			c.Header("X-Quota-Limit", strconv.FormatInt(key.MonthlyQuota, 10))
+			c.Header("X-Quota-Remaining", strconv.FormatInt(max(key.MonthlyQuota-used, 0), 10))
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrQuotaExceeded) {
+				c.Header("Retry-After", strconv.Itoa(int(time.Until(services.NextMonth(time.Now())).Seconds())+1))
+				respond.AbortError(c, http.StatusTooManyRequests, "quota_exceeded", fmt.Sprintf("monthly quota of %d requests used up", key.MonthlyQuota))
+				return
+			}
+			respond.AbortError(c, http.StatusInternalServerError, "database_error", "failed to record api usage")
+			return
+		}
+
+		// API keys are partners, not users, so they have no email and are
+		// never admins
+		SetCurrentUser(c, &models.Claims{Sub: fmt.Sprintf("api_key:%d", key.ID), Name: key.Name, Scope: strings.Join(key.Scopes, " ")})
+		c.Next()
+	}
+}
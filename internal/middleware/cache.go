@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SurrogateKeyHeader tags a cached response with keys the CDN can purge it by
+const SurrogateKeyHeader = "Surrogate-Key"
+
+// NoStore keeps responses out of shared caches unless a handler opts in with
+// CachePublicly, so nothing personal is cached by a CDN by accident
+func NoStore() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		c.Next()
+	}
+}
+
+// CachePublicly lets the CDN keep the response for ttl, tagged with keys.
+// Browsers revalidate every time, so a purge reaches them too. Call it only
+// for successful responses to requests that are the same for everyone.
+func CachePublicly(c *gin.Context, ttl time.Duration, keys ...string) {
+	if ttl <= 0 {
+		return
+	}
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=0, s-maxage=%d", int(ttl.Seconds())))
+	if len(keys) > 0 {
+		c.Header(SurrogateKeyHeader, strings.Join(keys, " "))
+	}
+}
@@ -0,0 +1,231 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	CallbackTokenHeader     = "X-Callback-Token"
+	CallbackTimestampHeader = "X-Callback-Timestamp"
+	CallbackSignatureHeader = "X-Callback-Signature"
+
+	// maxCallbackBody caps the body read to check a signature
+	maxCallbackBody = 1 << 20
+)
+
+// CallbackConfig sets how callbacks from one provider are authenticated.
+// At least one of Token and SigningSecret must be set; callbacks from a
+// provider with neither are refused.
+type CallbackConfig struct {
+	// Token, when set, must be passed as ?token= or in X-Callback-Token
+	Token string
+	// SigningSecret, when set, requires X-Callback-Timestamp (unix seconds)
+	// and X-Callback-Signature, the hex HMAC-SHA256 of "<timestamp>.<body>"
+	SigningSecret string
+	// AllowedIPs, when set, limits callers to these addresses and ranges
+	AllowedIPs []netip.Prefix
+	// MaxAge is how far a signed callback's timestamp may be from now.
+	// A signature is only accepted once within it.
+	MaxAge time.Duration
+}
+
+func DefaultCallbackConfig() CallbackConfig {
+	return CallbackConfig{MaxAge: 5 * time.Minute}
+}
+
+// CallbackConfigFromEnv reads <prefix>_CALLBACK_TOKEN,
+// <prefix>_CALLBACK_SECRET, <prefix>_CALLBACK_ALLOWED_IPS (comma separated
+// addresses or CIDR ranges) and <prefix>_CALLBACK_MAX_AGE over the defaults
+func CallbackConfigFromEnv(prefix string) CallbackConfig {
+	cfg := DefaultCallbackConfig()
+	cfg.Token = os.Getenv(prefix + "_CALLBACK_TOKEN")
+	cfg.SigningSecret = os.Getenv(prefix + "_CALLBACK_SECRET")
+
+	if ips := os.Getenv(prefix + "_CALLBACK_ALLOWED_IPS"); ips != "" {
+		for _, entry := range strings.Split(ips, ",") {
+			allowed, err := parseIPPrefix(strings.TrimSpace(entry))
+			if err != nil {
+				log.Printf("ignoring invalid callback allowed ip %q: %v", entry, err)
+				continue
+			}
+			cfg.AllowedIPs = append(cfg.AllowedIPs, allowed)
+		}
+	}
+	if d, err := time.ParseDuration(os.Getenv(prefix + "_CALLBACK_MAX_AGE")); err == nil && d > 0 {
+		cfg.MaxAge = d
+	}
+	return cfg
+}
+
+// parseIPPrefix accepts a CIDR range or a single address
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// CallbackVerifier authenticates the callbacks of one provider before they
+// reach handlers that change state
+type CallbackVerifier struct {
+	provider string
+	cfg      CallbackConfig
+	proxies  *Proxies
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+func NewCallbackVerifier(provider string, cfg CallbackConfig) *CallbackVerifier {
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultCallbackConfig().MaxAge
+	}
+	if cfg.Token == "" && cfg.SigningSecret == "" {
+		log.Printf("no callback token or secret set for %s, its callbacks will be refused", provider)
+	}
+	return &CallbackVerifier{
+		provider: provider,
+		cfg:      cfg,
+		seen:     make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// WithProxies reads callers' addresses from the X-Forwarded-For of these
+// proxies. Without them the peer's own address is checked.
+func (v *CallbackVerifier) WithProxies(proxies *Proxies) *CallbackVerifier {
+	v.proxies = proxies
+	return v
+}
+
+func (v *CallbackVerifier) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if v.cfg.Token == "" && v.cfg.SigningSecret == "" {
+			respond.AbortError(c, http.StatusServiceUnavailable, "callback_not_configured", "callbacks are not accepted until they can be verified")
+			return
+		}
+
+		if len(v.cfg.AllowedIPs) > 0 && !v.allowed(v.proxies.ClientIP(c)) {
+			v.reject(c, http.StatusForbidden, "forbidden", "callback source not allowed")
+			return
+		}
+
+		if v.cfg.Token != "" {
+			token := c.Query("token")
+			if token == "" {
+				token = c.GetHeader(CallbackTokenHeader)
+			}
+			if subtle.ConstantTimeCompare([]byte(token), []byte(v.cfg.Token)) != 1 {
+				v.reject(c, http.StatusUnauthorized, "unauthorized", "invalid callback token")
+				return
+			}
+		}
+
+		if v.cfg.SigningSecret != "" {
+			status, code, message := v.verifySignature(c)
+			if status != 0 {
+				v.reject(c, status, code, message)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+func (v *CallbackVerifier) allowed(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range v.cfg.AllowedIPs {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySignature checks the signature over the timestamp and body, and
+// that neither is stale or replayed. It returns a zero status when the
+// callback is genuine.
+func (v *CallbackVerifier) verifySignature(c *gin.Context) (int, string, string) {
+	timestamp := c.GetHeader(CallbackTimestampHeader)
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return http.StatusUnauthorized, "invalid_signature", "missing or invalid callback timestamp"
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxCallbackBody+1))
+	if err != nil {
+		return http.StatusBadRequest, "invalid_request", "failed to read callback body"
+	}
+	if len(body) > maxCallbackBody {
+		return http.StatusRequestEntityTooLarge, "payload_too_large", "callback body is too large"
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, []byte(v.cfg.SigningSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	signature, err := hex.DecodeString(strings.TrimPrefix(c.GetHeader(CallbackSignatureHeader), "sha256="))
+	if err != nil || !hmac.Equal(signature, mac.Sum(nil)) {
+		return http.StatusUnauthorized, "invalid_signature", "invalid callback signature"
+	}
+
+	now := v.now()
+	sentAt := time.Unix(unix, 0)
+	if sentAt.Before(now.Add(-v.cfg.MaxAge)) || sentAt.After(now.Add(v.cfg.MaxAge)) {
+		return http.StatusUnauthorized, "stale_callback", "callback timestamp is too far from now"
+	}
+
+	if !v.firstSeen(hex.EncodeToString(signature), now) {
+		return http.StatusConflict, "callback_replayed", "callback was already received"
+	}
+	return 0, "", ""
+}
+
+// firstSeen remembers signatures until their timestamp is stale anyway,
+// and reports whether this one is new
+func (v *CallbackVerifier) firstSeen(signature string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for seen, at := range v.seen {
+		if now.Sub(at) > 2*v.cfg.MaxAge {
+			delete(v.seen, seen)
+		}
+	}
+	if _, ok := v.seen[signature]; ok {
+		return false
+	}
+	v.seen[signature] = now
+	return true
+}
+
+func (v *CallbackVerifier) reject(c *gin.Context, status int, code, message string) {
+	log.Printf("rejected %s callback %s %s from %s: %s", v.provider, c.Request.Method, c.Request.URL.Path, v.proxies.ClientIP(c), code)
+	respond.AbortError(c, status, code, message)
+}
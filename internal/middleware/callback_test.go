@@ -0,0 +1,236 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(secret string, timestamp int64, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCallbackVerifier(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC)
+	body := "from=%2B254740827150&text=STATUS+1"
+
+	tests := []struct {
+		name           string
+		cfg            CallbackConfig
+		path           string
+		proxies        []string
+		remoteAddr     string
+		headers        map[string]string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "nothing configured",
+			cfg:            CallbackConfig{},
+			path:           "/callback",
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedError:  "callback_not_configured",
+		},
+		{
+			name:           "token in query",
+			cfg:            CallbackConfig{Token: "callback-secret"},
+			path:           "/callback?token=callback-secret",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "token in header",
+			cfg:            CallbackConfig{Token: "callback-secret"},
+			path:           "/callback",
+			headers:        map[string]string{CallbackTokenHeader: "callback-secret"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "wrong token",
+			cfg:            CallbackConfig{Token: "callback-secret"},
+			path:           "/callback?token=guess",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+		{
+			name:           "allowed ip",
+			cfg:            CallbackConfig{Token: "callback-secret", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+			path:           "/callback?token=callback-secret",
+			remoteAddr:     "192.0.2.10:40000",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "ip not allowed",
+			cfg:            CallbackConfig{Token: "callback-secret", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+			path:           "/callback?token=callback-secret",
+			remoteAddr:     "198.51.100.7:40000",
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "forbidden",
+		},
+		{
+			name:           "allowed ip forwarded by a trusted proxy",
+			cfg:            CallbackConfig{Token: "callback-secret", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+			path:           "/callback?token=callback-secret",
+			proxies:        []string{"10.0.0.1"},
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.10"},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "allowed ip spoofed with no proxies configured",
+			cfg:            CallbackConfig{Token: "callback-secret", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")}},
+			path:           "/callback?token=callback-secret",
+			remoteAddr:     "198.51.100.7:40000",
+			headers:        map[string]string{"X-Forwarded-For": "192.0.2.10"},
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "forbidden",
+		},
+		{
+			name: "valid signature",
+			cfg:  CallbackConfig{SigningSecret: "signing-secret"},
+			path: "/callback",
+			headers: map[string]string{
+				CallbackTimestampHeader: strconv.FormatInt(now.Unix(), 10),
+				CallbackSignatureHeader: "sha256=" + sign("signing-secret", now.Unix(), body),
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "signature with another secret",
+			cfg:  CallbackConfig{SigningSecret: "signing-secret"},
+			path: "/callback",
+			headers: map[string]string{
+				CallbackTimestampHeader: strconv.FormatInt(now.Unix(), 10),
+				CallbackSignatureHeader: sign("guess", now.Unix(), body),
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_signature",
+		},
+		{
+			name:           "missing timestamp",
+			cfg:            CallbackConfig{SigningSecret: "signing-secret"},
+			path:           "/callback",
+			headers:        map[string]string{CallbackSignatureHeader: sign("signing-secret", now.Unix(), body)},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_signature",
+		},
+		{
+			name: "stale timestamp",
+			cfg:  CallbackConfig{SigningSecret: "signing-secret", MaxAge: 5 * time.Minute},
+			path: "/callback",
+			headers: map[string]string{
+				CallbackTimestampHeader: strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10),
+				CallbackSignatureHeader: sign("signing-secret", now.Add(-10*time.Minute).Unix(), body),
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "stale_callback",
+		},
+		{
+			name: "token and signature both required",
+			cfg:  CallbackConfig{Token: "callback-secret", SigningSecret: "signing-secret"},
+			path: "/callback",
+			headers: map[string]string{
+				CallbackTimestampHeader: strconv.FormatInt(now.Unix(), 10),
+				CallbackSignatureHeader: sign("signing-secret", now.Unix(), body),
+			},
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxies, _ := NewProxies(tt.proxies)
+			verifier := NewCallbackVerifier("test", tt.cfg).WithProxies(proxies)
+			verifier.now = func() time.Time { return now }
+
+			var received string
+			r := gin.New()
+			r.POST("/callback", verifier.Middleware(), func(c *gin.Context) {
+				b, _ := io.ReadAll(c.Request.Body)
+				received = string(b)
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(body))
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for key, value := range tt.headers {
+				req.Header.Set(key, value)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+				return
+			}
+			assert.Equal(t, body, received, "the handler still reads the whole body")
+		})
+	}
+}
+
+func TestCallbackVerifierReplay(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	now := time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC)
+
+	verifier := NewCallbackVerifier("test", CallbackConfig{SigningSecret: "signing-secret", MaxAge: 5 * time.Minute})
+	verifier.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.POST("/callback", verifier.Middleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	send := func(timestamp int64, body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/callback", strings.NewReader(body))
+		req.Header.Set(CallbackTimestampHeader, strconv.FormatInt(timestamp, 10))
+		req.Header.Set(CallbackSignatureHeader, sign("signing-secret", timestamp, body))
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send(now.Unix(), "status=Success&id=1"))
+	assert.Equal(t, http.StatusConflict, send(now.Unix(), "status=Success&id=1"), "the same signed callback is a replay")
+	assert.Equal(t, http.StatusOK, send(now.Unix(), "status=Success&id=2"))
+	assert.Equal(t, http.StatusOK, send(now.Unix()+1, "status=Success&id=1"), "a resend is signed afresh")
+
+	// later on the same callback is refused as stale
+	now = now.Add(time.Hour)
+	assert.Equal(t, http.StatusUnauthorized, send(now.Add(-time.Hour).Unix(), "status=Success&id=1"))
+}
+
+func TestCallbackConfigFromEnv(t *testing.T) {
+	t.Setenv("SMS_CALLBACK_TOKEN", "callback-secret")
+	t.Setenv("SMS_CALLBACK_SECRET", "signing-secret")
+	t.Setenv("SMS_CALLBACK_ALLOWED_IPS", "192.0.2.0/24, 198.51.100.7,not-an-ip")
+	t.Setenv("SMS_CALLBACK_MAX_AGE", "1m")
+
+	cfg := CallbackConfigFromEnv("SMS")
+	assert.Equal(t, "callback-secret", cfg.Token)
+	assert.Equal(t, "signing-secret", cfg.SigningSecret)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24"), netip.MustParsePrefix("198.51.100.7/32")}, cfg.AllowedIPs)
+	assert.Equal(t, time.Minute, cfg.MaxAge)
+
+	assert.Equal(t, DefaultCallbackConfig(), CallbackConfigFromEnv("PAYMENTS"))
+}
@@ -0,0 +1,204 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+type CompressionConfig struct {
+	// MinSize is the smallest body, in bytes, worth compressing
+	MinSize  int
+	Disabled bool
+}
+
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{MinSize: 1024}
+}
+
+// CompressionConfigFromEnv reads COMPRESSION_MIN_SIZE and
+// COMPRESSION_DISABLED over the defaults
+func CompressionConfigFromEnv() CompressionConfig {
+	cfg := DefaultCompressionConfig()
+
+	if n, err := strconv.Atoi(os.Getenv("COMPRESSION_MIN_SIZE")); err == nil && n > 0 {
+		cfg.MinSize = n
+	}
+	cfg.Disabled, _ = strconv.ParseBool(os.Getenv("COMPRESSION_DISABLED"))
+	return cfg
+}
+
+// Compress brotli or gzip encodes JSON, NDJSON and text responses of at least
+// MinSize bytes, whichever the client prefers in Accept-Encoding (brotli
+// on a tie). Smaller bodies are sent as is, since compressing them costs
+// more than it saves.
+func Compress(cfg CompressionConfig) gin.HandlerFunc {
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = DefaultCompressionConfig().MinSize
+	}
+
+	return func(c *gin.Context) {
+		if cfg.Disabled || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		c.Header("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: c.Writer, encoding: encoding, minSize: cfg.MinSize}
+		c.Writer = cw
+		defer func() {
+			cw.finish()
+			c.Writer = cw.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks br or gzip from an Accept-Encoding header,
+// honouring q-values, or returns "" when the client accepts neither
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "br" && name != "gzip" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		if q > bestQ || (q == bestQ && q > 0 && name == "br") {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter holds back the start of the body until it knows whether
+// the response is big enough, and of a type, to be worth compressing
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+
+	buf     []byte
+	decided bool
+	encoder io.WriteCloser
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		return w.write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends what has been written so far, compressed if the response is
+// eligible, so streamed responses are not held back by the buffer
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(); err != nil {
+			return
+		}
+	}
+	if flusher, ok := w.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.encoder != nil {
+		return w.encoder.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// decide starts compressing if the response is eligible and writes out the
+// buffered body either way
+func (w *compressWriter) decide() error {
+	w.decided = true
+
+	if w.compressible() {
+		header := w.Header()
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+
+		if w.encoding == "br" {
+			w.encoder = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+		} else {
+			w.encoder = gzip.NewWriter(w.ResponseWriter)
+		}
+	}
+
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.write(buf)
+	return err
+}
+
+func (w *compressWriter) compressible() bool {
+	header := w.Header()
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+
+	status := w.Status()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+
+	contentType := header.Get("Content-Type")
+	return strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "application/x-ndjson") ||
+		strings.HasPrefix(contentType, "text/")
+}
+
+// finish writes a body that stayed under MinSize uncompressed, or closes
+// the encoder
+func (w *compressWriter) finish() {
+	if !w.decided {
+		w.decided = true
+		if len(w.buf) > 0 {
+			w.ResponseWriter.Write(w.buf)
+			w.buf = nil
+		}
+		return
+	}
+	if w.encoder != nil {
+		w.encoder.Close()
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	large := strings.Repeat("customer ", 200)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		body             string
+		contentType      string
+		expectedEncoding string
+	}{
+		{name: "gzip", acceptEncoding: "gzip, deflate", body: large, expectedEncoding: "gzip"},
+		{name: "brotli preferred on a tie", acceptEncoding: "gzip, br", body: large, expectedEncoding: "br"},
+		{name: "q-values", acceptEncoding: "br;q=0.5, gzip;q=0.8", body: large, expectedEncoding: "gzip"},
+		{name: "refused encoding", acceptEncoding: "br;q=0, gzip", body: large, expectedEncoding: "gzip"},
+		{name: "no accepted encoding", acceptEncoding: "deflate", body: large},
+		{name: "no accept encoding header", body: large},
+		{name: "under threshold", acceptEncoding: "gzip", body: "small"},
+		{name: "ndjson", acceptEncoding: "gzip", body: large, contentType: "application/x-ndjson", expectedEncoding: "gzip"},
+		{name: "not json or text", acceptEncoding: "gzip", body: large, contentType: "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(Compress(CompressionConfig{MinSize: 1024}))
+			r.GET("/orders", func(c *gin.Context) {
+				contentType := tt.contentType
+				if contentType == "" {
+					contentType = "application/json; charset=utf-8"
+				}
+				c.Data(http.StatusOK, contentType, []byte(tt.body))
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/orders", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expectedEncoding, w.Header().Get("Content-Encoding"))
+			assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+
+			var reader io.Reader = w.Body
+			switch tt.expectedEncoding {
+			case "gzip":
+				gz, err := gzip.NewReader(w.Body)
+				if !assert.NoError(t, err) {
+					return
+				}
+				reader = gz
+			case "br":
+				reader = brotli.NewReader(w.Body)
+			}
+			if tt.expectedEncoding != "" {
+				assert.Less(t, w.Body.Len(), len(tt.body))
+			}
+
+			body, err := io.ReadAll(reader)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestCompressDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(Compress(CompressionConfig{Disabled: true}))
+	r.GET("/orders", func(c *gin.Context) {
+		c.String(http.StatusOK, strings.Repeat("order ", 500))
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/orders", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	r.ServeHTTP(w, req)
+
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Equal(t, strings.Repeat("order ", 500), w.Body.String())
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Keys of the request state the middleware leaves in the gin context. Read
+// them through the helpers below rather than with c.Get.
+const (
+	claimsKey    = "claims"
+	sessionIDKey = "session_id"
+
+	// LoginMethodKey is the gin context key the login method is stored
+	// under, so failed attempts can be audited with it
+	LoginMethodKey = "login_method"
+)
+
+// SetCurrentUser stores the claims of the authenticated user on the request
+func SetCurrentUser(c *gin.Context, claims *models.Claims) {
+	c.Set(claimsKey, claims)
+}
+
+// CurrentUser returns the claims AuthMiddleware accepted for the request,
+// or false when the request is not authenticated
+func CurrentUser(c *gin.Context) (*models.Claims, bool) {
+	value, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*models.Claims)
+	return claims, ok && claims != nil
+}
+
+// CurrentUserEmail returns the authenticated user's email, or "" when there
+// is none
+func CurrentUserEmail(c *gin.Context) string {
+	if claims, ok := CurrentUser(c); ok {
+		return claims.Email
+	}
+	return ""
+}
+
+// CurrentSubject returns the authenticated user's subject, or "" when there
+// is none
+func CurrentSubject(c *gin.Context) string {
+	if claims, ok := CurrentUser(c); ok {
+		return claims.Sub
+	}
+	return ""
+}
+
+// CurrentSessionID returns the id of the session ActiveSession checked, or
+// "" for tokens issued without one
+func CurrentSessionID(c *gin.Context) string {
+	return c.GetString(sessionIDKey)
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCurrentUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, ok := CurrentUser(c)
+	assert.False(t, ok, "unauthenticated request")
+	assert.Empty(t, CurrentUserEmail(c))
+	assert.Empty(t, CurrentSubject(c))
+
+	c.Set(claimsKey, map[string]string{"email": "seb@example.com"})
+	_, ok = CurrentUser(c)
+	assert.False(t, ok, "claims of another type are not trusted")
+
+	SetCurrentUser(c, &models.Claims{Email: "seb@example.com", Sub: "seb-sub"})
+	claims, ok := CurrentUser(c)
+	assert.True(t, ok)
+	assert.Equal(t, "seb@example.com", claims.Email)
+	assert.Equal(t, "seb@example.com", CurrentUserEmail(c))
+	assert.Equal(t, "seb-sub", CurrentSubject(c))
+}
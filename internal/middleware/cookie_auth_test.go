@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetSessionCookies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+
+	expires := time.Now().Add(time.Hour)
+	csrfToken, err := SetSessionCookies(c, CookieConfig{Enabled: true, Domain: "example.com", SameSite: http.SameSiteStrictMode}, "token-1", expires)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, csrfToken)
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	if assert.Contains(t, cookies, SessionCookie) {
+		session := cookies[SessionCookie]
+		assert.Equal(t, "token-1", session.Value)
+		assert.True(t, session.HttpOnly)
+		assert.True(t, session.Secure)
+		assert.Equal(t, http.SameSiteStrictMode, session.SameSite)
+		assert.Equal(t, "example.com", session.Domain)
+	}
+	if assert.Contains(t, cookies, CSRFCookie) {
+		assert.Equal(t, csrfToken, cookies[CSRFCookie].Value)
+		assert.False(t, cookies[CSRFCookie].HttpOnly, "the dashboard reads it to echo it")
+	}
+}
+
+func TestAuthMiddlewareCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	token := testutil.Token(t, "test@example.com")
+
+	tests := []struct {
+		name           string
+		method         string
+		csrfCookie     string
+		csrfHeader     string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "safe request needs no csrf token",
+			method:         "GET",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsafe request with matching csrf token",
+			method:         "POST",
+			csrfCookie:     "csrf-1",
+			csrfHeader:     "csrf-1",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "unsafe request without csrf header",
+			method:         "POST",
+			csrfCookie:     "csrf-1",
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "csrf_token_invalid",
+		},
+		{
+			name:           "unsafe request with another csrf token",
+			method:         "DELETE",
+			csrfCookie:     "csrf-1",
+			csrfHeader:     "csrf-2",
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "csrf_token_invalid",
+		},
+		{
+			name:           "unsafe request without csrf cookie",
+			method:         "PUT",
+			csrfHeader:     "csrf-1",
+			expectedStatus: http.StatusForbidden,
+			expectedError:  "csrf_token_invalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(AuthMiddleware(TokenConfig{}))
+			router.Handle(tt.method, "/test", func(c *gin.Context) {
+				assert.Equal(t, "test@example.com", CurrentUserEmail(c))
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/test", nil)
+			req.AddCookie(&http.Cookie{Name: SessionCookie, Value: token})
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.csrfCookie})
+			}
+			if tt.csrfHeader != "" {
+				req.Header.Set(CSRFHeader, tt.csrfHeader)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedError != "" {
+				var response models.ErrorEnvelope
+				json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Equal(t, tt.expectedError, response.Error.Code)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareBearerNeedsNoCSRF(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+	token := testutil.Token(t, "test@example.com")
+
+	router := gin.New()
+	router.Use(AuthMiddleware(TokenConfig{}))
+	router.POST("/test", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	// a header is never sent by a browser on its own, so a stale cookie
+	// alongside it does not matter
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/test", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.AddCookie(&http.Cookie{Name: SessionCookie, Value: "stale"})
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
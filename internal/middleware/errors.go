@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// Errors is the one place server errors are logged. A panicking handler is
+// answered with a 500, and a handler that records an error with c.Error
+// without responding gets one too. Every 500 envelope carries an error id,
+// and each is logged under it with the request id, the build and the
+// stack, so a customer's report can be matched to the log line and the
+// code that produced it. The client never sees the underlying error.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			failure := &respond.Failure{
+				ID:     respond.NewErrorID(),
+				Status: http.StatusInternalServerError,
+				Code:   "internal_error",
+				Err:    fmt.Errorf("panic: %v", recovered),
+				Stack:  debug.Stack(),
+			}
+			logFailure(c, failure)
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			respond.AbortFailure(c, failure, "internal server error")
+		}()
+
+		c.Next()
+
+		for _, ginErr := range c.Errors {
+			var failure *respond.Failure
+			if errors.As(ginErr.Err, &failure) {
+				logFailure(c, failure)
+				continue
+			}
+			failure = &respond.Failure{
+				ID:     respond.NewErrorID(),
+				Status: http.StatusInternalServerError,
+				Code:   "internal_error",
+				Err:    ginErr.Err,
+			}
+			logFailure(c, failure)
+			if !c.Writer.Written() {
+				respond.AbortFailure(c, failure, "internal server error")
+			}
+		}
+	}
+}
+
+// logFailure logs the failure with its stack, when there is one; an error
+// recorded with c.Error has none, as the handler has returned
+func logFailure(c *gin.Context, failure *respond.Failure) {
+	log.Printf("error %s serving %s %s (request %s, %s): %v\n%s",
+		failure.ID, c.Request.Method, c.Request.URL.Path, c.GetString(respond.RequestIDKey), buildinfo.Get(), failure, failure.Stack)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	r := gin.New()
+	r.Use(RequestID(), Errors())
+	r.GET("/boom", func(c *gin.Context) {
+		panic("boom")
+	})
+	r.GET("/database", func(c *gin.Context) {
+		respond.ServerError(c, errors.New("dial tcp 10.0.0.5:5432: connection refused"), "database_error", "failed to retrieve orders")
+	})
+	r.GET("/unanswered", func(c *gin.Context) {
+		c.Error(errors.New("template is missing"))
+	})
+	r.GET("/not-found", func(c *gin.Context) {
+		respond.Error(c, http.StatusNotFound, "order_not_found", "order not found")
+	})
+
+	tests := []struct {
+		name            string
+		path            string
+		expectedStatus  int
+		expectedCode    string
+		expectedMessage string
+		expectedLog     string
+	}{
+		{name: "panic", path: "/boom", expectedStatus: http.StatusInternalServerError, expectedCode: "internal_error", expectedMessage: "internal server error", expectedLog: "panic: boom"},
+		{name: "reported error", path: "/database", expectedStatus: http.StatusInternalServerError, expectedCode: "database_error", expectedMessage: "failed to retrieve orders", expectedLog: "database_error: dial tcp 10.0.0.5:5432: connection refused"},
+		{name: "recorded error", path: "/unanswered", expectedStatus: http.StatusInternalServerError, expectedCode: "internal_error", expectedMessage: "internal server error", expectedLog: "template is missing"},
+		{name: "client error", path: "/not-found", expectedStatus: http.StatusNotFound, expectedCode: "order_not_found", expectedMessage: "order not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			req.Header.Set("X-Request-ID", "abc-123")
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			var response models.ErrorEnvelope
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, tt.expectedCode, response.Error.Code)
+			assert.Equal(t, tt.expectedMessage, response.Error.Message)
+			assert.Equal(t, "abc-123", response.RequestID)
+
+			if tt.expectedLog == "" {
+				assert.Empty(t, response.Error.ErrorID)
+				assert.Empty(t, logs.String())
+				return
+			}
+			if assert.NotEmpty(t, response.Error.ErrorID) {
+				assert.Contains(t, logs.String(), "error "+response.Error.ErrorID+" serving GET "+tt.path+" (request abc-123")
+			}
+			assert.Contains(t, logs.String(), tt.expectedLog)
+			assert.NotContains(t, w.Body.String(), tt.expectedLog, "internals are not sent to the client")
+			if tt.path != "/unanswered" {
+				assert.Contains(t, logs.String(), "goroutine", "the stack is logged")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// lowPriorityKey marks a request ShedLoad let through, so TrackLoad leaves
+// it out of the latency the monitor sheds on
+const lowPriorityKey = "low_priority"
+
+// TrackLoad counts every request in flight with the monitor, and gives it
+// the latency of those that are not low priority. Scrapes of /metrics are
+// left out like they are from the SLOs.
+func TrackLoad(monitor *services.LoadMonitor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() == "/metrics" {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		monitor.Start()
+		defer func() {
+			monitor.Done(time.Since(start), !c.GetBool(lowPriorityKey))
+		}()
+		c.Next()
+	}
+}
+
+// ShedLoad marks the routes it guards as low priority, and answers them
+// 503 with a Retry-After while the monitor reports the server overloaded,
+// so order taking and lookups keep the capacity that is left
+func ShedLoad(monitor *services.LoadMonitor) gin.HandlerFunc {
+	retryAfter := strconv.Itoa(int(monitor.RetryAfter().Seconds()))
+
+	return func(c *gin.Context) {
+		c.Set(lowPriorityKey, true)
+		if reason := monitor.Overloaded(); reason != "" {
+			monitor.Shed(reason)
+			c.Header("Retry-After", retryAfter)
+			respond.AbortError(c, http.StatusServiceUnavailable, "overloaded", "the server is busy, retry later")
+			return
+		}
+		c.Next()
+	}
+}
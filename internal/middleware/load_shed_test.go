@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShedLoad(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	monitor := services.NewLoadMonitor(services.LoadShedConfig{MaxInFlight: 1, RetryAfter: 10 * time.Second})
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	router := gin.New()
+	router.Use(TrackLoad(monitor))
+	router.POST("/orders", func(c *gin.Context) {
+		close(started)
+		<-release
+		c.Status(http.StatusCreated)
+	})
+	router.GET("/orders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/reports/daily", ShedLoad(monitor), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/reports/daily").Code, "served while idle")
+
+	done := make(chan struct{})
+	go func() {
+		serve("POST", "/orders")
+		close(done)
+	}()
+	<-started
+
+	w := serve("GET", "/reports/daily")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "10", w.Header().Get("Retry-After"))
+	var body models.ErrorEnvelope
+	json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, "overloaded", body.Error.Code)
+
+	assert.Equal(t, http.StatusOK, serve("GET", "/orders/1").Code, "other routes are never shed")
+
+	close(release)
+	<-done
+	assert.Equal(t, http.StatusOK, serve("GET", "/reports/daily").Code, "served again once the load drops")
+}
@@ -0,0 +1,292 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// maxLoginBody caps the body read for its email. Larger bodies are still
+// throttled by IP.
+const maxLoginBody = 64 << 10
+
+type LoginThrottleConfig struct {
+	// MaxAttemptsPerWindow caps login attempts from one IP per Window
+	MaxAttemptsPerWindow int
+	Window               time.Duration
+	// FreeFailures is how many failures are allowed before delays start
+	FreeFailures int
+	BaseDelay    time.Duration
+	// MaxFailures triggers a lockout of LockoutDuration
+	MaxFailures     int
+	LockoutDuration time.Duration
+}
+
+func DefaultLoginThrottleConfig() LoginThrottleConfig {
+	return LoginThrottleConfig{
+		MaxAttemptsPerWindow: 10,
+		Window:               time.Minute,
+		FreeFailures:         3,
+		BaseDelay:            2 * time.Second,
+		MaxFailures:          5,
+		LockoutDuration:      15 * time.Minute,
+	}
+}
+
+// LoginThrottleConfigFromEnv reads LOGIN_MAX_ATTEMPTS_PER_MINUTE,
+// LOGIN_MAX_FAILURES and LOGIN_LOCKOUT_DURATION over the defaults
+func LoginThrottleConfigFromEnv() LoginThrottleConfig {
+	cfg := DefaultLoginThrottleConfig()
+
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_ATTEMPTS_PER_MINUTE")); err == nil && n > 0 {
+		cfg.MaxAttemptsPerWindow = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LOGIN_MAX_FAILURES")); err == nil && n > 0 {
+		cfg.MaxFailures = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOGIN_LOCKOUT_DURATION")); err == nil && d > 0 {
+		cfg.LockoutDuration = d
+	}
+	return cfg
+}
+
+type loginAttempts struct {
+	windowStart time.Time
+	attempts    int
+	failures    int
+	nextAllowed time.Time
+	lockedUntil time.Time
+	lastSeen    time.Time
+}
+
+// LoginThrottle limits credential endpoints per client IP and per email,
+// adding exponential delays after repeated failures and locking out keys
+// that keep failing.
+type LoginThrottle struct {
+	mu      sync.Mutex
+	cfg     LoginThrottleConfig
+	entries map[string]*loginAttempts
+	audit   services.AuditRecorder
+	proxies *Proxies
+	now     func() time.Time
+}
+
+func NewLoginThrottle(cfg LoginThrottleConfig, audit services.AuditRecorder) *LoginThrottle {
+	defaults := DefaultLoginThrottleConfig()
+	if cfg.MaxAttemptsPerWindow <= 0 {
+		cfg.MaxAttemptsPerWindow = defaults.MaxAttemptsPerWindow
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaults.Window
+	}
+	if cfg.FreeFailures < 0 {
+		cfg.FreeFailures = 0
+	}
+	if cfg.BaseDelay <= 0 {
+		cfg.BaseDelay = defaults.BaseDelay
+	}
+	if cfg.MaxFailures <= 0 {
+		cfg.MaxFailures = defaults.MaxFailures
+	}
+	if cfg.LockoutDuration <= 0 {
+		cfg.LockoutDuration = defaults.LockoutDuration
+	}
+
+	return &LoginThrottle{
+		cfg:     cfg,
+		entries: make(map[string]*loginAttempts),
+		audit:   audit,
+		now:     time.Now,
+	}
+}
+
+// WithProxies reads clients' addresses from the X-Forwarded-For of these
+// proxies. Without them attempts are counted per peer address.
+func (t *LoginThrottle) WithProxies(proxies *Proxies) *LoginThrottle {
+	t.proxies = proxies
+	return t
+}
+
+func (t *LoginThrottle) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := t.proxies.ClientIP(c)
+		email := peekLoginEmail(c)
+
+		keys := []string{"ip:" + ip}
+		if email != "" {
+			keys = append(keys, "email:"+email)
+		}
+
+		if reason, retryAfter := t.check(keys); reason != "" {
+			eventType := models.AuditLoginThrottled
+			if reason == "account_locked" {
+				eventType = models.AuditLoginLockedOut
+			}
+			t.record(c, eventType, email, ip, reason)
+
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			respond.AbortError(c, http.StatusTooManyRequests, reason, fmt.Sprintf("too many login attempts, retry in %s", retryAfter.Round(time.Second)))
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+			if locked := t.fail(keys); locked {
+				t.record(c, models.AuditLoginLockedOut, email, ip, "lockout started")
+			}
+			details := fmt.Sprintf("status=%d", status)
+			if method := c.GetString(LoginMethodKey); method != "" {
+				details = fmt.Sprintf("method=%s %s", method, details)
+			}
+			t.record(c, models.AuditLoginFailed, email, ip, details)
+		} else if status < http.StatusBadRequest {
+			t.succeed(keys)
+		}
+	}
+}
+
+// check counts the attempt and returns a non-empty reason if it must be rejected
+func (t *LoginThrottle) check(keys []string) (string, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.prune(now)
+
+	for _, key := range keys {
+		entry := t.entry(key, now)
+
+		if now.Before(entry.lockedUntil) {
+			return "account_locked", entry.lockedUntil.Sub(now)
+		}
+		if now.Before(entry.nextAllowed) {
+			return "login_throttled", entry.nextAllowed.Sub(now)
+		}
+	}
+
+	ipEntry := t.entry(keys[0], now)
+	if now.Sub(ipEntry.windowStart) >= t.cfg.Window {
+		ipEntry.windowStart = now
+		ipEntry.attempts = 0
+	}
+	ipEntry.attempts++
+	if ipEntry.attempts > t.cfg.MaxAttemptsPerWindow {
+		return "rate_limited", ipEntry.windowStart.Add(t.cfg.Window).Sub(now)
+	}
+
+	return "", 0
+}
+
+// fail records a failed attempt and reports whether it triggered a lockout
+func (t *LoginThrottle) fail(keys []string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	locked := false
+
+	for _, key := range keys {
+		entry := t.entry(key, now)
+		entry.failures++
+
+		if entry.failures >= t.cfg.MaxFailures {
+			entry.lockedUntil = now.Add(t.cfg.LockoutDuration)
+			entry.failures = 0
+			locked = true
+			continue
+		}
+
+		if extra := entry.failures - t.cfg.FreeFailures; extra > 0 {
+			entry.nextAllowed = now.Add(t.cfg.BaseDelay * time.Duration(1<<uint(extra-1)))
+		}
+	}
+	return locked
+}
+
+func (t *LoginThrottle) succeed(keys []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, key := range keys {
+		if entry, ok := t.entries[key]; ok {
+			entry.failures = 0
+			entry.nextAllowed = time.Time{}
+		}
+	}
+}
+
+func (t *LoginThrottle) entry(key string, now time.Time) *loginAttempts {
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &loginAttempts{windowStart: now}
+		t.entries[key] = entry
+	}
+	entry.lastSeen = now
+	return entry
+}
+
+// prune drops idle entries so the map cannot grow without bound
+func (t *LoginThrottle) prune(now time.Time) {
+	if len(t.entries) < 10000 {
+		return
+	}
+	idle := t.cfg.Window + t.cfg.LockoutDuration
+	for key, entry := range t.entries {
+		if now.Sub(entry.lastSeen) > idle && now.After(entry.lockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+func (t *LoginThrottle) record(c *gin.Context, eventType, email, ip, details string) {
+	if t.audit == nil {
+		return
+	}
+	t.audit.Record(models.AuditEvent{
+		Type:      eventType,
+		Actor:     email,
+		IP:        ip,
+		UserAgent: c.Request.UserAgent(),
+		Details:   details,
+	})
+}
+
+// peekLoginEmail reads the email from a JSON login body without consuming it
+func peekLoginEmail(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxLoginBody+1))
+	if err != nil {
+		return ""
+	}
+	// the handler reads what was peeked at, then the rest
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if len(body) > maxLoginBody {
+		return ""
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(req.Email))
+}
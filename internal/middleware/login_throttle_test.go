@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingAudit struct {
+	mu     sync.Mutex
+	events []models.AuditEvent
+}
+
+func (r *recordingAudit) Record(event models.AuditEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordingAudit) count(eventType string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for _, event := range r.events {
+		if event.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+func setupThrottledRouter(cfg LoginThrottleConfig, audit *recordingAudit) (*gin.Engine, *LoginThrottle) {
+	gin.SetMode(gin.TestMode)
+	throttle := NewLoginThrottle(cfg, audit)
+
+	router := gin.New()
+	router.POST("/login", throttle.Middleware(), func(c *gin.Context) {
+		if c.Query("ok") == "1" {
+			c.JSON(http.StatusOK, gin.H{"access_token": "token"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	})
+	return router, throttle
+}
+
+func attemptLogin(router *gin.Engine, email, ip string, ok bool) *httptest.ResponseRecorder {
+	path := "/login"
+	if ok {
+		path += "?ok=1"
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(`{"email":"`+email+`","password":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginThrottleLockout(t *testing.T) {
+	audit := &recordingAudit{}
+	router, _ := setupThrottledRouter(LoginThrottleConfig{
+		MaxAttemptsPerWindow: 100,
+		FreeFailures:         10,
+		MaxFailures:          3,
+		LockoutDuration:      time.Minute,
+	}, audit)
+
+	for i := 0; i < 3; i++ {
+		w := attemptLogin(router, "victim@example.com", "10.0.0.1", false)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// same email from a different IP is still locked out
+	w := attemptLogin(router, "Victim@Example.com", "10.0.0.2", true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "account_locked")
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// other accounts from a fresh IP are unaffected
+	w = attemptLogin(router, "other@example.com", "10.0.0.3", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	assert.Equal(t, 3, audit.count(models.AuditLoginFailed))
+	assert.Equal(t, 2, audit.count(models.AuditLoginLockedOut))
+}
+
+func TestLoginThrottleProgressiveDelay(t *testing.T) {
+	audit := &recordingAudit{}
+	router, throttle := setupThrottledRouter(LoginThrottleConfig{
+		MaxAttemptsPerWindow: 100,
+		FreeFailures:         1,
+		BaseDelay:            time.Second,
+		MaxFailures:          10,
+	}, audit)
+
+	now := time.Now()
+	throttle.now = func() time.Time { return now }
+
+	attemptLogin(router, "user@example.com", "10.0.0.1", false)
+	attemptLogin(router, "user@example.com", "10.0.0.1", false)
+
+	w := attemptLogin(router, "user@example.com", "10.0.0.1", true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "login_throttled")
+	assert.Equal(t, 1, audit.count(models.AuditLoginThrottled))
+
+	now = now.Add(2 * time.Second)
+	w = attemptLogin(router, "user@example.com", "10.0.0.1", true)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginThrottleIPRateLimit(t *testing.T) {
+	router, _ := setupThrottledRouter(LoginThrottleConfig{MaxAttemptsPerWindow: 2}, &recordingAudit{})
+
+	assert.Equal(t, http.StatusOK, attemptLogin(router, "a@example.com", "10.0.0.1", true).Code)
+	assert.Equal(t, http.StatusOK, attemptLogin(router, "b@example.com", "10.0.0.1", true).Code)
+
+	w := attemptLogin(router, "c@example.com", "10.0.0.1", true)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "rate_limited")
+}
+
+func TestLoginThrottleForwardedFor(t *testing.T) {
+	router, throttle := setupThrottledRouter(LoginThrottleConfig{MaxAttemptsPerWindow: 2}, &recordingAudit{})
+
+	attempt := func(forwardedFor string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/login?ok=1", bytes.NewBufferString(`{"email":"a@example.com","password":"x"}`))
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// with no proxies configured a made-up address each time doesn't help
+	assert.Equal(t, http.StatusOK, attempt("203.0.113.1"))
+	assert.Equal(t, http.StatusOK, attempt("203.0.113.2"))
+	assert.Equal(t, http.StatusTooManyRequests, attempt("203.0.113.3"))
+
+	proxies, _ := NewProxies([]string{"10.0.0.1"})
+	throttle.WithProxies(proxies)
+	assert.Equal(t, http.StatusOK, attempt("203.0.113.4"), "behind a trusted proxy each client is counted")
+}
+
+func TestLoginThrottleLargeBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	throttle := NewLoginThrottle(LoginThrottleConfig{MaxAttemptsPerWindow: 100, FreeFailures: 10, MaxFailures: 1}, &recordingAudit{})
+	var received int
+	router := gin.New()
+	router.POST("/login", throttle.Middleware(), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		received = len(body)
+		c.Status(http.StatusUnauthorized)
+	})
+
+	body := `{"email":"victim@example.com","password":"` + strings.Repeat("x", maxLoginBody) + `"}`
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/login", strings.NewReader(body))
+	req.RemoteAddr = "10.0.0.1:1234"
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, len(body), received, "the handler still reads the whole body")
+	assert.Equal(t, http.StatusUnauthorized, attemptLogin(router, "victim@example.com", "10.0.0.2", false).Code, "past the cap the email isn't read, so isn't locked out")
+}
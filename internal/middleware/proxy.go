@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Proxies are the load balancers in front of the API, whose
+// X-Forwarded-Proto is believed. A nil *Proxies trusts no peer.
+type Proxies struct {
+	prefixes []netip.Prefix
+}
+
+// NewProxies trusts the given addresses and CIDR ranges, the same list gin
+// is given for X-Forwarded-For. An empty list trusts no peer.
+func NewProxies(trusted []string) (*Proxies, error) {
+	p := &Proxies{}
+	for _, entry := range trusted {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			p.prefixes = append(p.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		p.prefixes = append(p.prefixes, prefix.Masked())
+	}
+	return p, nil
+}
+
+// Trusts reports whether the peer at remoteAddr, an address with or
+// without a port, is one of the proxies
+func (p *Proxies) Trusts(remoteAddr string) bool {
+	if p == nil {
+		return false
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+	addr, err := netip.ParseAddr(remoteAddr)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the client's address as gin reads it from the headers of
+// trusted proxies, or the peer's own address when no proxy is trusted, so
+// that a forwarded header counts for nothing unless proxies are configured
+func (p *Proxies) ClientIP(c *gin.Context) string {
+	if p == nil || len(p.prefixes) == 0 {
+		return c.RemoteIP()
+	}
+	return c.ClientIP()
+}
+
+// Scheme is "https" when r came over TLS, to the server itself or to a
+// trusted proxy that says so in X-Forwarded-Proto, and "http" otherwise
+func (p *Proxies) Scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	if p.Trusts(r.RemoteAddr) {
+		// a proxy behind another lists each hop's scheme, the client's first
+		proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+		if strings.EqualFold(strings.TrimSpace(proto), "https") {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// forwardedPlainHTTP reports whether a trusted proxy says r reached it over
+// plain HTTP. Requests without X-Forwarded-Proto, such as a load
+// balancer's health checks, are not.
+func (p *Proxies) forwardedPlainHTTP(r *http.Request) bool {
+	if r.TLS != nil || !p.Trusts(r.RemoteAddr) {
+		return false
+	}
+	proto, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "http")
+}
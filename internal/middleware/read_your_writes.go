@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/gin-gonic/gin"
+)
+
+// ReadPrimaryHeader carries the time, in unix milliseconds, until which a
+// client's reads go to the primary database. Writes return it; clients that
+// send it back see their own writes whichever instance serves them.
+const ReadPrimaryHeader = "X-Read-Primary-Until"
+
+// DefaultReadYourWritesWindow covers the usual replica lag
+const DefaultReadYourWritesWindow = 5 * time.Second
+
+// RecentWriters sends the reads of clients that wrote within the window to
+// the primary, so an order read back right after it was placed is found
+// even before the replicas have it. Without replicas it changes nothing.
+type RecentWriters struct {
+	mu     sync.Mutex
+	window time.Duration
+	until  map[string]time.Time
+	now    func() time.Time
+}
+
+func NewRecentWriters(window time.Duration) *RecentWriters {
+	if window <= 0 {
+		window = DefaultReadYourWritesWindow
+	}
+	return &RecentWriters{window: window, until: map[string]time.Time{}, now: time.Now}
+}
+
+// Middleware must run after authentication, since clients are told apart
+// by their subject, or by IP when not signed in
+func (w *RecentWriters) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		now := w.now()
+		client := CurrentSubject(c)
+		if client == "" {
+			client = "ip:" + c.ClientIP()
+		}
+
+		if isWrite(c.Request.Method) {
+			until := w.wrote(client, now)
+			c.Header(ReadPrimaryHeader, strconv.FormatInt(until.UnixMilli(), 10))
+			c.Request = c.Request.WithContext(db.WithPrimary(c.Request.Context()))
+		} else if w.pinned(client, now) || w.pinnedByHeader(c.GetHeader(ReadPrimaryHeader), now) {
+			c.Request = c.Request.WithContext(db.WithPrimary(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+func (w *RecentWriters) wrote(client string, now time.Time) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// forget clients whose window has passed once there are many of them
+	if len(w.until) > 10000 {
+		for key, until := range w.until {
+			if !now.Before(until) {
+				delete(w.until, key)
+			}
+		}
+	}
+	until := now.Add(w.window)
+	w.until[client] = until
+	return until
+}
+
+func (w *RecentWriters) pinned(client string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return now.Before(w.until[client])
+}
+
+// pinnedByHeader honours a time sent back by the client, as long as it is
+// no further ahead than a write made now would pin
+func (w *RecentWriters) pinnedByHeader(value string, now time.Time) bool {
+	if value == "" {
+		return false
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	until := time.UnixMilli(ms)
+	return now.Before(until) && !until.After(now.Add(w.window))
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentWriters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	writers := NewRecentWriters(5 * time.Second)
+	writers.now = func() time.Time { return now }
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-Test-User"); user != "" {
+			SetCurrentUser(c, &models.Claims{Sub: user})
+		}
+	}, writers.Middleware())
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, strconv.FormatBool(db.UsesPrimary(c.Request.Context())))
+	}
+	r.GET("/orders", handler)
+	r.POST("/orders", handler)
+
+	request := func(method, user, header string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/orders", nil)
+		req.Header.Set("X-Test-User", user)
+		if header != "" {
+			req.Header.Set(ReadPrimaryHeader, header)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, "false", request("GET", "alice", "").Body.String())
+
+	w := request("POST", "alice", "")
+	assert.Equal(t, "true", w.Body.String())
+	until := w.Header().Get(ReadPrimaryHeader)
+	assert.Equal(t, strconv.FormatInt(now.Add(5*time.Second).UnixMilli(), 10), until)
+
+	assert.Equal(t, "true", request("GET", "alice", "").Body.String(), "the writer reads the primary")
+	assert.Equal(t, "false", request("GET", "bob", "").Body.String(), "other clients read replicas")
+	assert.Equal(t, "true", request("GET", "bob", until).Body.String(), "the header pins on any instance")
+
+	far := strconv.FormatInt(now.Add(time.Hour).UnixMilli(), 10)
+	assert.Equal(t, "false", request("GET", "bob", far).Body.String(), "pins beyond the window are ignored")
+
+	now = now.Add(6 * time.Second)
+	assert.Equal(t, "false", request("GET", "alice", "").Body.String(), "the pin expires")
+	assert.Equal(t, "false", request("GET", "bob", until).Body.String())
+}
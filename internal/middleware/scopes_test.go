@@ -0,0 +1,52 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		scope          string
+		method         string
+		expectedStatus int
+	}{
+		{name: "unscoped token reads", scope: "", method: "GET", expectedStatus: http.StatusOK},
+		{name: "unscoped token writes", scope: "", method: "POST", expectedStatus: http.StatusOK},
+		{name: "read scope reads", scope: "orders:read reports:read", method: "GET", expectedStatus: http.StatusOK},
+		{name: "read scope covers head", scope: "orders:read", method: "HEAD", expectedStatus: http.StatusOK},
+		{name: "read scope cannot write", scope: "orders:read", method: "PUT", expectedStatus: http.StatusForbidden},
+		{name: "write scope writes", scope: "orders:write", method: "DELETE", expectedStatus: http.StatusOK},
+		{name: "write scope does not read", scope: "orders:write", method: "GET", expectedStatus: http.StatusForbidden},
+		{name: "other group's scope", scope: "customers:read", method: "GET", expectedStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(func(c *gin.Context) {
+				SetCurrentUser(c, &models.Claims{Sub: "bi", Scope: tt.scope})
+			})
+			r.Handle(tt.method, "/orders", RequireScope("orders"), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(tt.method, "/orders", nil)
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="insufficient_scope"`)
+			}
+		})
+	}
+}
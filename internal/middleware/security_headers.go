@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// HSTSConfig shapes the Strict-Transport-Security header sent over HTTPS
+type HSTSConfig struct {
+	// Disabled leaves the header out, e.g. while a domain still serves
+	// something over plain HTTP
+	Disabled          bool
+	MaxAge            time.Duration
+	IncludeSubdomains bool
+	// Preload asks to be listed in browsers' preload lists, which requires
+	// a MaxAge of a year and IncludeSubdomains
+	Preload bool
+	// Enforce redirects requests a trusted proxy received over plain HTTP
+	// to HTTPS
+	Enforce bool
+}
+
+func DefaultHSTSConfig() HSTSConfig {
+	return HSTSConfig{MaxAge: 365 * 24 * time.Hour, IncludeSubdomains: true}
+}
+
+// HSTSConfigFromEnv reads HSTS_DISABLED, HSTS_MAX_AGE,
+// HSTS_INCLUDE_SUBDOMAINS, HSTS_PRELOAD and HSTS_ENFORCE over the defaults
+func HSTSConfigFromEnv() HSTSConfig {
+	cfg := DefaultHSTSConfig()
+
+	cfg.Disabled, _ = strconv.ParseBool(os.Getenv("HSTS_DISABLED"))
+	if d, err := time.ParseDuration(os.Getenv("HSTS_MAX_AGE")); err == nil && d > 0 {
+		cfg.MaxAge = d
+	}
+	if include, err := strconv.ParseBool(os.Getenv("HSTS_INCLUDE_SUBDOMAINS")); err == nil {
+		cfg.IncludeSubdomains = include
+	}
+	cfg.Preload, _ = strconv.ParseBool(os.Getenv("HSTS_PRELOAD"))
+	cfg.Enforce, _ = strconv.ParseBool(os.Getenv("HSTS_ENFORCE"))
+	return cfg
+}
+
+// Header is the Strict-Transport-Security value
+func (c HSTSConfig) Header() string {
+	maxAge := c.MaxAge
+	if maxAge <= 0 {
+		maxAge = DefaultHSTSConfig().MaxAge
+	}
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if c.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if c.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// SecurityHeaders sets the headers browsers need to treat responses as
+// plain data: not sniffed as another type, not framed, and not leaking the
+// URL as a referrer. HSTS is only sent over HTTPS, directly or through one
+// of the proxies that says so.
+func SecurityHeaders(hsts HSTSConfig, proxies *Proxies) gin.HandlerFunc {
+	header := hsts.Header()
+	return func(c *gin.Context) {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("X-Frame-Options", "DENY")
+		c.Header("Referrer-Policy", "no-referrer")
+		c.Header("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		if !hsts.Disabled && proxies.Scheme(c.Request) == "https" {
+			c.Header("Strict-Transport-Security", header)
+		}
+		c.Next()
+	}
+}
+
+// HTTPSRedirect sends requests one of the proxies received over plain HTTP
+// to the same URL over HTTPS, with a 308 so the method and body are kept.
+// Requests straight to the server are let through, so a load balancer's
+// health checks still reach it.
+func HTTPSRedirect(proxies *Proxies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !proxies.forwardedPlainHTTP(c.Request) {
+			c.Next()
+			return
+		}
+		if c.Request.Host == "" {
+			respond.AbortError(c, http.StatusBadRequest, "https_required", "requests must be made over HTTPS")
+			return
+		}
+		c.Redirect(http.StatusPermanentRedirect, "https://"+c.Request.Host+c.Request.URL.RequestURI())
+		c.Abort()
+	}
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	loadBalancer, _ := NewProxies([]string{"10.0.0.1"})
+
+	tests := []struct {
+		name         string
+		hsts         HSTSConfig
+		proxies      *Proxies
+		remoteAddr   string
+		proto        string
+		tls          bool
+		expectedHSTS string
+	}{
+		{name: "plain http", hsts: DefaultHSTSConfig(), proxies: loadBalancer, expectedHSTS: ""},
+		{name: "https behind a proxy", hsts: DefaultHSTSConfig(), proxies: loadBalancer, proto: "https", expectedHSTS: "max-age=31536000; includeSubDomains"},
+		{name: "https served directly", hsts: DefaultHSTSConfig(), proxies: nil, tls: true, expectedHSTS: "max-age=31536000; includeSubDomains"},
+		{name: "https from a trusted proxy", hsts: DefaultHSTSConfig(), proxies: loadBalancer, remoteAddr: "10.0.0.1:5000", proto: "https", expectedHSTS: "max-age=31536000; includeSubDomains"},
+		{name: "https claimed by an untrusted peer", hsts: DefaultHSTSConfig(), proxies: loadBalancer, remoteAddr: "10.0.0.2:5000", proto: "https", expectedHSTS: ""},
+		{name: "first hop of a proxy chain", hsts: DefaultHSTSConfig(), proxies: loadBalancer, proto: "https, http", expectedHSTS: "max-age=31536000; includeSubDomains"},
+		{
+			name:         "preload",
+			hsts:         HSTSConfig{MaxAge: 2 * 365 * 24 * time.Hour, IncludeSubdomains: true, Preload: true},
+			proxies:      loadBalancer,
+			proto:        "https",
+			expectedHSTS: "max-age=63072000; includeSubDomains; preload",
+		},
+		{name: "shorter max age", hsts: HSTSConfig{MaxAge: time.Hour}, proxies: loadBalancer, proto: "https", expectedHSTS: "max-age=3600"},
+		{name: "hsts disabled", hsts: HSTSConfig{Disabled: true}, proxies: loadBalancer, proto: "https", expectedHSTS: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.Use(SecurityHeaders(tt.hsts, tt.proxies))
+			r.GET("/", func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:5000"
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+			assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+			assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+			assert.Equal(t, tt.expectedHSTS, w.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	proxies, err := NewProxies([]string{"10.0.0.0/8", "fd00::/8"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r := gin.New()
+	r.Use(HTTPSRedirect(proxies))
+	r.POST("/orders", func(c *gin.Context) {
+		c.Status(http.StatusCreated)
+	})
+
+	tests := []struct {
+		name             string
+		remoteAddr       string
+		proto            string
+		expectedStatus   int
+		expectedLocation string
+	}{
+		{name: "plain http through the proxy", remoteAddr: "10.2.0.1:5000", proto: "http", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "https://api.example.com/orders?dry_run=true"},
+		{name: "ipv6 proxy", remoteAddr: "[fd00::1]:5000", proto: "http", expectedStatus: http.StatusPermanentRedirect, expectedLocation: "https://api.example.com/orders?dry_run=true"},
+		{name: "https through the proxy", remoteAddr: "10.2.0.1:5000", proto: "https", expectedStatus: http.StatusCreated},
+		{name: "health check straight from the load balancer", remoteAddr: "10.2.0.1:5000", expectedStatus: http.StatusCreated},
+		{name: "untrusted peer", remoteAddr: "192.0.2.1:5000", proto: "http", expectedStatus: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "http://api.example.com/orders?dry_run=true", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.proto != "" {
+				req.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedLocation, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestNewProxies(t *testing.T) {
+	_, err := NewProxies([]string{"10.0.0.1", "not-an-ip"})
+	assert.Error(t, err)
+
+	proxies, err := NewProxies([]string{" 10.0.0.0/8", "2001:db8::1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, proxies.Trusts("10.9.8.7:443"))
+	assert.True(t, proxies.Trusts("::ffff:10.0.0.5"))
+	assert.True(t, proxies.Trusts("[2001:db8::1]:80"))
+	assert.False(t, proxies.Trusts("11.0.0.1:443"))
+	assert.False(t, proxies.Trusts("garbage"))
+
+	empty, err := NewProxies(nil)
+	if assert.NoError(t, err) {
+		assert.False(t, empty.Trusts("10.0.0.1"), "an empty list trusts no peer")
+	}
+
+	var none *Proxies
+	assert.False(t, none.Trusts("10.0.0.1"))
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ActiveSession rejects tokens whose session was revoked. It must run after
+// AuthMiddleware. Tokens issued without a session id are let through until
+// they expire.
+func ActiveSession(sessions *services.SessionStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := CurrentUser(c)
+		if !ok {
+			respond.AbortError(c, http.StatusUnauthorized, "unauthorized", "no user info available")
+			return
+		}
+
+		id := claims.ID
+		if id == "" {
+			c.Next()
+			return
+		}
+
+		if err := sessions.Validate(c.Request.Context(), id); err != nil {
+			switch {
+			case errors.Is(err, services.ErrSessionRevoked):
+				respond.AbortError(c, http.StatusUnauthorized, "session_revoked", "session has been revoked")
+			case errors.Is(err, services.ErrSessionNotFound):
+				respond.AbortError(c, http.StatusUnauthorized, "invalid_token", "unknown session")
+			default:
+				respond.AbortError(c, http.StatusInternalServerError, "database_error", "failed to check session")
+			}
+			return
+		}
+
+		c.Set(sessionIDKey, id)
+		c.Next()
+	}
+}
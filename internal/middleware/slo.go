@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// SLO records every request's status and latency with the tracker, under
+// its route group. Scrapes of /metrics are left out so they do not pad the
+// SLIs with easy requests.
+func SLO(tracker *services.SLOTracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.FullPath()
+		if path == "/metrics" {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		tracker.Record(routeGroup(path), c.Writer.Status(), time.Since(start))
+	}
+}
+
+// routeGroup names the group a route belongs to after its first segment
+// below /api/v1, so "/api/v1/orders/:id" is "orders" and "/auth/login" is
+// "auth". Requests that matched no route are "unmatched".
+func routeGroup(path string) string {
+	if path == "" {
+		return "unmatched"
+	}
+
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "/api/v1"), "/")
+	group, _, _ := strings.Cut(path, "/")
+	if group == "" {
+		return "root"
+	}
+	return group
+}
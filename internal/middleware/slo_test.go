@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLO(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tracker := services.NewSLOTracker(services.DefaultSLOConfig())
+
+	router := gin.New()
+	router.Use(SLO(tracker))
+	router.GET("/api/v1/orders/:id", func(c *gin.Context) {
+		if c.Param("id") == "fail" {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+	router.GET("/auth/login", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/metrics", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/api/v1/orders/1", "/api/v1/orders/fail", "/auth/login", "/metrics", "/nope"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		router.ServeHTTP(w, req)
+	}
+
+	requests := map[string]int64{}
+	errors := map[string]int64{}
+	for _, group := range tracker.Report().Groups {
+		requests[group.Group] = group.Requests
+		errors[group.Group] = group.Availability.BadRequests
+	}
+	assert.Equal(t, map[string]int64{"orders": 2, "auth": 1, "unmatched": 1}, requests, "metrics scrapes are not counted")
+	assert.Equal(t, int64(1), errors["orders"])
+}
+
+func TestRouteGroup(t *testing.T) {
+	tests := map[string]string{
+		"/api/v1/customers/:id/notes": "customers",
+		"/api/v1/admin/slo":           "admin",
+		"/auth/callback":              "auth",
+		"/health/ready":               "health",
+		"/":                           "root",
+		"":                            "unmatched",
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, routeGroup(path), path)
+	}
+}
@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// StrictJSON makes handlers reject request bodies with fields their request
+// type does not have, answering 400 unknown_fields with every offending key
+func StrictJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(respond.StrictJSONKey, true)
+		c.Next()
+	}
+}
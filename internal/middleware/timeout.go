@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+)
+
+// Timeout gives the request's context a deadline d from now, which the
+// database queries and provider calls made with c.Request.Context() give
+// up at, so a slow request stops holding a connection nobody is waiting
+// on. The rest of the chain runs on the request's own goroutine: nothing
+// else writes the response, nothing is left running once it is answered,
+// and a panic still reaches Errors. A handler that fails at the deadline
+// with respond.ServerError is answered 503 request_timeout, as is one that
+// returns after it without answering; one that answered in time keeps its
+// response.
+//
+// Routes in untimed, by their full path, get no deadline, e.g. streams
+// that run for as long as the client reads. Adding Timeout to a group or
+// route again can shorten the deadline there, never lengthen it. A d of 0
+// sets no deadline.
+func Timeout(d time.Duration, untimed ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(untimed))
+	for _, path := range untimed {
+		skip[path] = true
+	}
+
+	return func(c *gin.Context) {
+		if d <= 0 || skip[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		req := c.Request
+		ctx, cancel := context.WithTimeout(req.Context(), d)
+		defer cancel()
+		c.Request = req.WithContext(ctx)
+
+		c.Next()
+
+		c.Request = req
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			respond.AbortError(c, http.StatusServiceUnavailable, respond.TimeoutCode, respond.TimeoutMessage)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.DB(t)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	deadline := func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		respond.OK(c, http.StatusOK, gin.H{"deadline": ok})
+	}
+
+	r := gin.New()
+	r.Use(RequestID(), Errors(), Timeout(20*time.Millisecond, "/stream"))
+	r.GET("/fast", deadline)
+	r.GET("/stream", deadline)
+	r.GET("/short", Timeout(time.Millisecond), func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		respond.ServerError(c, c.Request.Context().Err(), "internal_error", "gave up")
+	})
+	r.GET("/query", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		var orders []models.Order
+		if err := db.WithContext(c.Request.Context()).Find(&orders).Error; err != nil {
+			respond.ServerError(c, err, "database_error", "failed to retrieve orders")
+			return
+		}
+		respond.OK(c, http.StatusOK, orders)
+	})
+	r.GET("/ignores", func(c *gin.Context) {
+		time.Sleep(40 * time.Millisecond)
+	})
+	r.GET("/late", func(c *gin.Context) {
+		time.Sleep(40 * time.Millisecond)
+		respond.OK(c, http.StatusOK, gin.H{"late": true})
+	})
+	r.GET("/panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	hasDeadline := func(expected bool) func(t *testing.T, w *testutil.Response) {
+		return func(t *testing.T, w *testutil.Response) {
+			var body map[string]bool
+			w.Data(&body)
+			assert.Equal(t, expected, body["deadline"])
+		}
+	}
+
+	testutil.Run(t, r, []testutil.Case{
+		{Name: "in time", Request: testutil.NewRequest("GET", "/fast"), Status: http.StatusOK, Check: hasDeadline(true)},
+		{Name: "untimed route", Request: testutil.NewRequest("GET", "/stream"), Status: http.StatusOK, Check: hasDeadline(false)},
+		{Name: "shorter on a route", Request: testutil.NewRequest("GET", "/short"), Status: http.StatusServiceUnavailable, Code: respond.TimeoutCode},
+		{
+			Name:    "queries give up at the deadline",
+			Request: testutil.NewRequest("GET", "/query"),
+			Status:  http.StatusServiceUnavailable,
+			Code:    respond.TimeoutCode,
+			Check: func(t *testing.T, w *testutil.Response) {
+				assert.NotEmpty(t, w.Error().ErrorID)
+				assert.Contains(t, logs.String(), "context deadline exceeded")
+			},
+		},
+		{Name: "returns without answering", Request: testutil.NewRequest("GET", "/ignores"), Status: http.StatusServiceUnavailable, Code: respond.TimeoutCode},
+		{Name: "answered late", Request: testutil.NewRequest("GET", "/late"), Status: http.StatusOK},
+		{Name: "panics are still recovered", Request: testutil.NewRequest("GET", "/panic"), Status: http.StatusInternalServerError, Code: "internal_error"},
+	})
+}
+
+func TestTimeoutDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/", Timeout(0), func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		respond.OK(c, http.StatusOK, gin.H{"deadline": ok})
+	})
+
+	w := testutil.NewRequest("GET", "/").Serve(t, r)
+	var body map[string]bool
+	w.Data(&body)
+	assert.False(t, body["deadline"])
+}
@@ -0,0 +1,162 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const defaultTokenIssuer = "customer-order-api"
+
+var (
+	ErrTokenExpired       = errors.New("expired token")
+	ErrTokenNotYetValid   = errors.New("token is not valid yet")
+	ErrTokenIssuer        = errors.New("token was issued by someone else")
+	ErrTokenAudience      = errors.New("token is meant for another audience")
+	ErrTokenClaimsMissing = errors.New("token is missing required claims")
+)
+
+// TokenConfig sets how long the access tokens the API issues last, and
+// what a token must say to be accepted
+type TokenConfig struct {
+	// TTL is how long an access token is valid for
+	TTL time.Duration
+	// Issuer and Audience are stamped on every token issued and must match
+	// on every token accepted
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew between the instance that issued a token
+	// and the one checking it
+	Leeway time.Duration
+}
+
+func DefaultTokenConfig() TokenConfig {
+	return TokenConfig{
+		TTL:      24 * time.Hour,
+		Issuer:   defaultTokenIssuer,
+		Audience: defaultTokenIssuer,
+		Leeway:   30 * time.Second,
+	}
+}
+
+// TokenConfigFromEnv reads JWT_TTL, JWT_ISSUER, JWT_AUDIENCE and
+// JWT_LEEWAY over the defaults
+func TokenConfigFromEnv() TokenConfig {
+	cfg := DefaultTokenConfig()
+	if ttl, err := time.ParseDuration(os.Getenv("JWT_TTL")); err == nil && ttl > 0 {
+		cfg.TTL = ttl
+	}
+	if issuer := strings.TrimSpace(os.Getenv("JWT_ISSUER")); issuer != "" {
+		cfg.Issuer = issuer
+	}
+	if audience := strings.TrimSpace(os.Getenv("JWT_AUDIENCE")); audience != "" {
+		cfg.Audience = audience
+	}
+	if leeway, err := time.ParseDuration(os.Getenv("JWT_LEEWAY")); err == nil && leeway >= 0 {
+		cfg.Leeway = leeway
+	}
+	return cfg
+}
+
+// WithDefaults fills unset fields from DefaultTokenConfig. A zero Leeway
+// is kept, as it means no tolerance.
+func (cfg TokenConfig) WithDefaults() TokenConfig {
+	defaults := DefaultTokenConfig()
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaults.TTL
+	}
+	if cfg.Issuer == "" {
+		cfg.Issuer = defaults.Issuer
+	}
+	if cfg.Audience == "" {
+		cfg.Audience = defaults.Audience
+	}
+	return cfg
+}
+
+// NewClaims returns the claims of an access token for a user, issued at
+// now and expiring TTL later
+func (cfg TokenConfig) NewClaims(email, subject, name string, now time.Time) *models.Claims {
+	cfg = cfg.WithDefaults()
+	return &models.Claims{
+		Email: email,
+		Sub:   subject,
+		Name:  name,
+		Iss:   cfg.Issuer,
+		Aud:   cfg.Audience,
+		Iat:   now.Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(cfg.TTL)),
+			Issuer:    cfg.Issuer,
+			Subject:   subject,
+		},
+	}
+}
+
+// ParseToken verifies the token's HMAC signature with secret and checks
+// its claims: exp, iat, iss, aud and sub must all be set, the token must
+// be within its lifetime give or take Leeway, and iss and aud must match.
+func ParseToken(tokenString string, secret []byte, cfg TokenConfig) (*models.Claims, error) {
+	cfg = cfg.WithDefaults()
+
+	claims := &models.Claims{}
+	// the claims are checked below, with leeway
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}), jwt.WithoutClaimsValidation())
+	token, err := parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if err := checkClaims(claims, cfg, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func checkClaims(claims *models.Claims, cfg TokenConfig, now time.Time) error {
+	var missing []string
+	if claims.ExpiresAt == nil {
+		missing = append(missing, "exp")
+	}
+	if claims.Iat == 0 {
+		missing = append(missing, "iat")
+	}
+	if claims.Iss == "" {
+		missing = append(missing, "iss")
+	}
+	if claims.Aud == "" {
+		missing = append(missing, "aud")
+	}
+	if claims.Sub == "" {
+		missing = append(missing, "sub")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrTokenClaimsMissing, strings.Join(missing, ", "))
+	}
+
+	if now.After(claims.ExpiresAt.Time.Add(cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	if time.Unix(claims.Iat, 0).After(now.Add(cfg.Leeway)) {
+		return ErrTokenNotYetValid
+	}
+	if claims.NotBefore != nil && claims.NotBefore.Time.After(now.Add(cfg.Leeway)) {
+		return ErrTokenNotYetValid
+	}
+	if claims.Iss != cfg.Issuer {
+		return ErrTokenIssuer
+	}
+	if claims.Aud != cfg.Audience {
+		return ErrTokenAudience
+	}
+	return nil
+}
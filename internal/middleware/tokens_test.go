@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseToken(t *testing.T) {
+	secret := []byte("test-secret")
+	cfg := TokenConfig{TTL: time.Hour, Issuer: "savannah", Audience: "savannah-api", Leeway: time.Minute}
+	now := time.Now()
+
+	sign := func(claims *models.Claims) string {
+		token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		return token
+	}
+	issued := func(modify func(*models.Claims)) string {
+		claims := cfg.NewClaims("seb@example.com", "seb", "Seb", now)
+		modify(claims)
+		return sign(claims)
+	}
+
+	tests := []struct {
+		name          string
+		token         string
+		expectedError error
+	}{
+		{name: "valid", token: issued(func(*models.Claims) {})},
+		{name: "expired within the leeway", token: issued(func(c *models.Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-30 * time.Second)) })},
+		{name: "expired", token: issued(func(c *models.Claims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-2 * time.Minute)) }), expectedError: ErrTokenExpired},
+		{name: "issued by a clock slightly ahead", token: issued(func(c *models.Claims) { c.Iat = now.Add(30 * time.Second).Unix() })},
+		{name: "issued in the future", token: issued(func(c *models.Claims) { c.Iat = now.Add(time.Hour).Unix() }), expectedError: ErrTokenNotYetValid},
+		{name: "not valid yet", token: issued(func(c *models.Claims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour)) }), expectedError: ErrTokenNotYetValid},
+		{name: "other issuer", token: issued(func(c *models.Claims) { c.Iss = "someone-else" }), expectedError: ErrTokenIssuer},
+		{name: "other audience", token: issued(func(c *models.Claims) { c.Aud = "customer-order-api" }), expectedError: ErrTokenAudience},
+		{name: "no expiry", token: issued(func(c *models.Claims) { c.ExpiresAt = nil }), expectedError: ErrTokenClaimsMissing},
+		{name: "no subject or audience", token: sign(&models.Claims{Email: "seb@example.com", Iss: "savannah", Iat: now.Unix(), RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}}), expectedError: ErrTokenClaimsMissing},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token, secret, cfg)
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, "seb", claims.Sub)
+			}
+		})
+	}
+
+	_, err := ParseToken(issued(func(*models.Claims) {}), []byte("other-secret"), cfg)
+	assert.Error(t, err)
+
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, cfg.NewClaims("seb@example.com", "seb", "Seb", now)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	_, err = ParseToken(none, secret, cfg)
+	assert.Error(t, err, "unsigned tokens are rejected")
+}
+
+func TestTokenConfigFromEnv(t *testing.T) {
+	os.Unsetenv("JWT_TTL")
+	assert.Equal(t, DefaultTokenConfig(), TokenConfigFromEnv())
+
+	t.Setenv("JWT_TTL", "15m")
+	t.Setenv("JWT_ISSUER", "https://api.savannah.example")
+	t.Setenv("JWT_AUDIENCE", "dashboard")
+	t.Setenv("JWT_LEEWAY", "0s")
+
+	cfg := TokenConfigFromEnv()
+	assert.Equal(t, 15*time.Minute, cfg.TTL)
+	assert.Equal(t, "https://api.savannah.example", cfg.Issuer)
+	assert.Equal(t, "dashboard", cfg.Audience)
+	assert.Zero(t, cfg.Leeway)
+}
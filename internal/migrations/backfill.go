@@ -0,0 +1,198 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultBatchSize is how many rows a backfill updates per transaction
+// unless it sets its own
+const DefaultBatchSize = 1000
+
+// Backfill updates every row of Table, in id order, a batch at a time
+type Backfill struct {
+	Name      string
+	Table     string
+	BatchSize int
+	// Batch updates the rows with ids after < id <= upTo. It runs in the
+	// transaction that records the progress, and may run again for the
+	// same rows if the process stops before that commits.
+	Batch func(tx *gorm.DB, after, upTo uint) error
+}
+
+// Runner runs backfills to completion, recording their progress in
+// backfill_runs so a restart resumes each where it stopped. Several
+// instances may run the same backfill; each batch is claimed by moving
+// the recorded progress past it.
+type Runner struct {
+	db        *gorm.DB
+	backfills []Backfill
+	pause     time.Duration
+}
+
+func NewRunner(db *gorm.DB, backfills ...Backfill) *Runner {
+	return &Runner{db: db, backfills: backfills}
+}
+
+// WithPause waits between batches to leave the database room for live
+// traffic
+func (r *Runner) WithPause(pause time.Duration) *Runner {
+	r.pause = pause
+	return r
+}
+
+// errBatchTaken means another instance recorded the batch first
+var errBatchTaken = errors.New("batch was backfilled by another instance")
+
+// Run runs the backfills that have not finished until they do or ctx is
+// done, and returns how many rows it updated
+func (r *Runner) Run(ctx context.Context) (int64, error) {
+	var updated int64
+	for _, backfill := range r.backfills {
+		n, err := r.run(ctx, backfill)
+		updated += n
+		if err != nil {
+			return updated, fmt.Errorf("backfill %s: %w", backfill.Name, err)
+		}
+	}
+	return updated, nil
+}
+
+func (r *Runner) run(ctx context.Context, backfill Backfill) (int64, error) {
+	db := r.db.WithContext(ctx)
+	batchSize := backfill.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	run, err := r.start(db, backfill)
+	if err != nil || run.FinishedAt != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return updated, err
+		}
+
+		var ids []uint
+		err := db.Table(backfill.Table).Where("id > ? AND id <= ?", run.LastID, run.EndID).
+			Order("id ASC").Limit(batchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return updated, err
+		}
+		if len(ids) == 0 {
+			now := time.Now()
+			err := db.Model(&models.BackfillRun{}).Where("id = ?", run.ID).
+				Updates(map[string]interface{}{"finished_at": now, "last_error": ""}).Error
+			if err == nil {
+				log.Printf("backfill %s finished, %d rows", backfill.Name, run.RowsDone)
+			}
+			return updated, err
+		}
+
+		upTo := ids[len(ids)-1]
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := backfill.Batch(tx, run.LastID, upTo); err != nil {
+				return err
+			}
+			res := tx.Model(&models.BackfillRun{}).Where("id = ? AND last_id = ?", run.ID, run.LastID).
+				Updates(map[string]interface{}{
+					"last_id":    upTo,
+					"rows_done":  gorm.Expr("rows_done + ?", len(ids)),
+					"last_error": "",
+				})
+			if res.Error != nil {
+				return res.Error
+			}
+			if res.RowsAffected == 0 {
+				return errBatchTaken
+			}
+			return nil
+		})
+		switch {
+		case errors.Is(err, errBatchTaken):
+			if err := db.First(&run, run.ID).Error; err != nil {
+				return updated, err
+			}
+			continue
+		case err != nil:
+			db.Model(&models.BackfillRun{}).Where("id = ?", run.ID).Update("last_error", err.Error())
+			return updated, err
+		}
+
+		run.LastID = upTo
+		run.RowsDone += int64(len(ids))
+		updated += int64(len(ids))
+
+		if r.pause > 0 {
+			select {
+			case <-ctx.Done():
+				return updated, ctx.Err()
+			case <-time.After(r.pause):
+			}
+		}
+	}
+}
+
+// start loads the backfill's progress, recording where it ends the first
+// time it runs
+func (r *Runner) start(db *gorm.DB, backfill Backfill) (models.BackfillRun, error) {
+	var run models.BackfillRun
+	err := db.Where("name = ?", backfill.Name).First(&run).Error
+	if err == nil || !errors.Is(err, gorm.ErrRecordNotFound) {
+		return run, err
+	}
+
+	var end struct{ ID uint }
+	if err := db.Table(backfill.Table).Select("COALESCE(MAX(id), 0) AS id").Scan(&end).Error; err != nil {
+		return run, err
+	}
+	now := time.Now()
+	run = models.BackfillRun{Name: backfill.Name, Table: backfill.Table, EndID: end.ID, StartedAt: &now}
+	if err := db.Table(backfill.Table).Where("id <= ?", end.ID).Count(&run.RowsTotal).Error; err != nil {
+		return run, err
+	}
+	if err := db.Create(&run).Error; err != nil {
+		// another instance started it at the same time
+		if err := db.Where("name = ?", backfill.Name).First(&run).Error; err != nil {
+			return run, err
+		}
+	}
+	return run, nil
+}
+
+// Progress reports every backfill, including those that have not started
+func (r *Runner) Progress(ctx context.Context) ([]models.BackfillRun, error) {
+	var runs []models.BackfillRun
+	if err := r.db.WithContext(ctx).Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.BackfillRun, len(runs))
+	for _, run := range runs {
+		byName[run.Name] = run
+	}
+
+	progress := make([]models.BackfillRun, 0, len(r.backfills))
+	for _, backfill := range r.backfills {
+		run, ok := byName[backfill.Name]
+		if !ok {
+			run = models.BackfillRun{Name: backfill.Name, Table: backfill.Table}
+		}
+		switch {
+		case run.FinishedAt != nil:
+			run.Percent = 100
+		case run.RowsTotal > 0:
+			run.Percent = min(99.9, float64(run.RowsDone*1000/run.RowsTotal)/10)
+		}
+		progress = append(progress, run)
+	}
+	return progress, nil
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestRunnerBackfillsRename(t *testing.T) {
+	db := setupTestDB(t)
+	placed := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	// written before the rename was registered, so placed_at is empty
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Create(&models.Order{Item: "Laptop", Amount: models.Shillings(100), CustomerID: 1, Time: placed}).Error)
+	}
+
+	backfill := Renames[0].Backfill()
+	backfill.BatchSize = 2
+	runner := NewRunner(db, backfill)
+
+	progress, err := runner.Progress(context.Background())
+	require.NoError(t, err)
+	require.Len(t, progress, 1)
+	assert.Nil(t, progress[0].StartedAt)
+	assert.Zero(t, progress[0].Percent)
+
+	updated, err := runner.Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), updated)
+
+	var missing int64
+	require.NoError(t, db.Model(&models.Order{}).Where("placed_at IS NULL").Count(&missing).Error)
+	assert.Zero(t, missing)
+
+	progress, err = runner.Progress(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), progress[0].RowsDone)
+	assert.Equal(t, int64(5), progress[0].RowsTotal)
+	assert.Equal(t, float64(100), progress[0].Percent)
+	assert.NotNil(t, progress[0].FinishedAt)
+
+	// a finished backfill does not run again
+	updated, err = runner.Run(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, updated)
+}
+
+func TestRunnerResumes(t *testing.T) {
+	db := setupTestDB(t)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, db.Create(&models.Order{Item: "Laptop", Amount: models.Shillings(100), CustomerID: 1, Time: time.Now()}).Error)
+	}
+
+	backfill := Renames[0].Backfill()
+	backfill.BatchSize = 1
+	failing := backfill
+	failing.Batch = func(tx *gorm.DB, after, upTo uint) error {
+		if after == 2 {
+			return errors.New("lock wait timeout")
+		}
+		return backfill.Batch(tx, after, upTo)
+	}
+
+	updated, err := NewRunner(db, failing).Run(context.Background())
+	assert.ErrorContains(t, err, "lock wait timeout")
+	assert.Equal(t, int64(2), updated)
+
+	progress, err := NewRunner(db, backfill).Progress(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), progress[0].LastID)
+	assert.Equal(t, float64(50), progress[0].Percent)
+	assert.Equal(t, "lock wait timeout", progress[0].LastError)
+	assert.Nil(t, progress[0].FinishedAt)
+
+	updated, err = NewRunner(db, backfill).Run(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), updated)
+
+	progress, err = NewRunner(db, backfill).Progress(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, progress[0].LastError)
+	assert.NotNil(t, progress[0].FinishedAt)
+}
@@ -0,0 +1,197 @@
+// Package migrations supports changing the schema without downtime, in
+// expand and contract steps. To rename a column:
+//
+//  1. expand: add the new column next to the old one and register a Rename,
+//     so every write fills both. Deploy, and let the backfill copy the old
+//     column into the new one for existing rows.
+//  2. once the backfill has finished, move reads over to the new column.
+//  3. contract: once no running instance reads the old column, stop
+//     writing it and drop it.
+//
+// Writes made with raw SQL skip the dual-write and must fill both columns
+// themselves.
+package migrations
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Rename is a column being renamed in Table from From to To, with both in
+// place while running instances still use the old one
+type Rename struct {
+	Table string
+	From  string
+	To    string
+	// Transform converts a value of the old column for the new one. Nil
+	// copies values as they are.
+	Transform func(value interface{}) (interface{}, error)
+}
+
+// Renames lists the renames in progress; each is dual-written and
+// backfilled
+var Renames = []Rename{
+	// orders.time becomes placed_at
+	{Table: "orders", From: "time", To: "placed_at"},
+}
+
+// Name identifies the rename, as <table>.<new column>
+func (r Rename) Name() string {
+	return r.Table + "." + r.To
+}
+
+// RegisterRenames has every create and update made through db that sets a
+// renamed column set the new column too
+func RegisterRenames(db *gorm.DB, renames ...Rename) error {
+	for _, rename := range renames {
+		name := "migrations:dual_write:" + rename.Name()
+		rename := rename
+		if err := db.Callback().Create().Before("gorm:create").Register(name, rename.dualWrite); err != nil {
+			return err
+		}
+		if err := db.Callback().Update().Before("gorm:update").Register(name, rename.dualWrite); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r Rename) dualWrite(db *gorm.DB) {
+	stmt := db.Statement
+	if stmt.Schema == nil || stmt.Schema.Table != r.Table || db.Error != nil {
+		return
+	}
+	from, to := stmt.Schema.LookUpField(r.From), stmt.Schema.LookUpField(r.To)
+	if from == nil || to == nil {
+		db.AddError(fmt.Errorf("dual-write %s: %s has no %s or %s field", r.Name(), r.Table, r.From, r.To))
+		return
+	}
+
+	// Update("time", ...), Updates(map) and UpdateColumn
+	if values, ok := stmt.Dest.(map[string]interface{}); ok {
+		value, ok := values[from.DBName]
+		if !ok {
+			value, ok = values[from.Name]
+		}
+		if !ok {
+			return
+		}
+		if _, isExpr := value.(clause.Expr); isExpr && r.Transform != nil {
+			db.AddError(fmt.Errorf("dual-write %s: cannot transform an SQL expression", r.Name()))
+			return
+		}
+		converted, err := r.convert(value)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		values[to.DBName] = converted
+		r.selectColumn(stmt, to)
+		return
+	}
+
+	switch stmt.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		// batch creates
+		for i := 0; i < stmt.ReflectValue.Len(); i++ {
+			if err := r.copyField(stmt, from, to, reflect.Indirect(stmt.ReflectValue.Index(i))); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		source := stmt.ReflectValue
+		// Updates(Order{...}) carries the values in Dest, not the model
+		if dest := reflect.Indirect(reflect.ValueOf(stmt.Dest)); dest.Kind() == reflect.Struct && dest.Type() == source.Type() {
+			source = dest
+		}
+		value, zero := from.ValueOf(stmt.Context, source)
+		if zero {
+			return
+		}
+		converted, err := r.convert(value)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		stmt.SetColumn(to.DBName, converted)
+		r.selectColumn(stmt, to)
+	}
+}
+
+func (r Rename) copyField(stmt *gorm.Statement, from, to *schema.Field, row reflect.Value) error {
+	value, zero := from.ValueOf(stmt.Context, row)
+	if zero {
+		return nil
+	}
+	converted, err := r.convert(value)
+	if err != nil {
+		return err
+	}
+	return to.Set(stmt.Context, row, converted)
+}
+
+// selectColumn keeps the new column in updates limited with Select
+func (r Rename) selectColumn(stmt *gorm.Statement, to *schema.Field) {
+	if len(stmt.Selects) > 0 {
+		stmt.Selects = append(stmt.Selects, to.DBName)
+	}
+}
+
+func (r Rename) convert(value interface{}) (interface{}, error) {
+	if r.Transform == nil {
+		return value, nil
+	}
+	converted, err := r.Transform(value)
+	if err != nil {
+		return nil, fmt.Errorf("dual-write %s: %w", r.Name(), err)
+	}
+	return converted, nil
+}
+
+// Backfill copies the old column into the new one for existing rows, a
+// batch of ids at a time
+func (r Rename) Backfill() Backfill {
+	return Backfill{
+		Name:  r.Name(),
+		Table: r.Table,
+		Batch: func(tx *gorm.DB, after, upTo uint) error {
+			rows := tx.Table(r.Table).Where("id > ? AND id <= ?", after, upTo)
+			if r.Transform == nil {
+				return rows.Update(r.To, gorm.Expr("?", clause.Column{Name: r.From})).Error
+			}
+
+			var values []map[string]interface{}
+			if err := rows.Select("id", r.From).Find(&values).Error; err != nil {
+				return err
+			}
+			for _, row := range values {
+				if row[r.From] == nil {
+					continue
+				}
+				converted, err := r.Transform(row[r.From])
+				if err != nil {
+					return fmt.Errorf("row %v: %w", row["id"], err)
+				}
+				if err := tx.Table(r.Table).Where("id = ?", row["id"]).Update(r.To, converted).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// Backfills returns the backfills of the renames in progress and of
+// columns derived from other tables
+func Backfills() []Backfill {
+	backfills := make([]Backfill, 0, len(Renames)+1)
+	for _, rename := range Renames {
+		backfills = append(backfills, rename.Backfill())
+	}
+	return append(backfills, LastOrderAt)
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func placedAt(t *testing.T, db *gorm.DB, id uint) *time.Time {
+	var order models.Order
+	require.NoError(t, db.First(&order, id).Error)
+	return order.PlacedAt
+}
+
+func TestDualWrite(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, RegisterRenames(db, Renames...))
+	placed := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+
+	order := models.Order{Item: "Laptop", Amount: models.Shillings(100), CustomerID: 1, Time: placed}
+	require.NoError(t, db.Create(&order).Error)
+	if assert.NotNil(t, placedAt(t, db, order.ID)) {
+		assert.True(t, placed.Equal(*placedAt(t, db, order.ID)))
+	}
+
+	batch := []models.Order{
+		{Item: "Phone", Amount: models.Shillings(50), CustomerID: 1, Time: placed},
+		{Item: "Tablet", Amount: models.Shillings(70), CustomerID: 1, Time: placed},
+	}
+	require.NoError(t, db.Create(&batch).Error)
+	for _, o := range batch {
+		assert.NotNil(t, placedAt(t, db, o.ID))
+	}
+
+	moved := placed.Add(time.Hour)
+	require.NoError(t, db.Model(&order).Update("time", moved).Error)
+	assert.True(t, moved.Equal(*placedAt(t, db, order.ID)))
+
+	moved = moved.Add(time.Hour)
+	require.NoError(t, db.Model(&order).Updates(map[string]interface{}{"time": moved}).Error)
+	assert.True(t, moved.Equal(*placedAt(t, db, order.ID)))
+
+	moved = moved.Add(time.Hour)
+	require.NoError(t, db.Model(&order).Select("time").Updates(models.Order{Time: moved}).Error)
+	assert.True(t, moved.Equal(*placedAt(t, db, order.ID)))
+
+	// updates that leave the old column alone leave the new one alone too
+	require.NoError(t, db.Model(&order).Update("status", models.OrderStatusConfirmed).Error)
+	assert.True(t, moved.Equal(*placedAt(t, db, order.ID)))
+}
+
+func TestDualWriteTransform(t *testing.T) {
+	db := setupTestDB(t)
+	rename := Rename{Table: "orders", From: "time", To: "placed_at", Transform: func(value interface{}) (interface{}, error) {
+		return value.(time.Time).Truncate(24 * time.Hour), nil
+	}}
+	require.NoError(t, RegisterRenames(db, rename))
+	placed := time.Date(2025, 9, 1, 10, 30, 0, 0, time.UTC)
+
+	order := models.Order{Item: "Laptop", Amount: models.Shillings(100), CustomerID: 1, Time: placed}
+	require.NoError(t, db.Create(&order).Error)
+	assert.True(t, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC).Equal(*placedAt(t, db, order.ID)))
+}
@@ -0,0 +1,16 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// LastOrderAt fills customers.last_order_at for customers who ordered
+// before it was kept, from their latest live or archived order
+var LastOrderAt = Backfill{
+	Name:  "customers.last_order_at",
+	Table: "customers",
+	Batch: func(tx *gorm.DB, after, upTo uint) error {
+		return tx.Exec(`UPDATE customers SET last_order_at = COALESCE(
+			(SELECT MAX(created_at) FROM orders WHERE orders.customer_id = customers.id),
+			(SELECT MAX(created_at) FROM archived_orders WHERE archived_orders.customer_id = customers.id))
+			WHERE id > ? AND id <= ? AND last_order_at IS NULL`, after, upTo).Error
+	},
+}
@@ -1,7 +1,15 @@
 package models
 
-import "github.com/golang-jwt/jwt/v4"
+import (
+	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Claims are the contents of the tokens the API issues. They are read back
+// by AuthMiddleware and reach handlers through middleware.CurrentUser.
 type Claims struct {
 	Email string `json:"email"`
 	Sub   string `json:"sub"`
@@ -9,5 +17,65 @@ type Claims struct {
 	Iss   string `json:"iss"`
 	Aud   string `json:"aud"`
 	Iat   int64  `json:"iat"`
+	// Scope limits the token to the space separated scopes, as in OAuth.
+	// Tokens without one are not limited by scope.
+	Scope string `json:"scope,omitempty"`
 	jwt.RegisteredClaims
 }
+
+// Scopes a token or API key can be limited to, one read and one write
+// scope per group of routes. Read covers GET and HEAD, write every other
+// method.
+const (
+	ScopeCustomersRead  = "customers:read"
+	ScopeCustomersWrite = "customers:write"
+	ScopeOrdersRead     = "orders:read"
+	ScopeOrdersWrite    = "orders:write"
+	ScopeProductsRead   = "products:read"
+	ScopeProductsWrite  = "products:write"
+	ScopeRidersRead     = "riders:read"
+	ScopeRidersWrite    = "riders:write"
+	ScopeReportsRead    = "reports:read"
+	ScopeReportsWrite   = "reports:write"
+	ScopeAdminRead      = "admin:read"
+	ScopeAdminWrite     = "admin:write"
+)
+
+// Scopes is every scope there is
+var Scopes = []string{
+	ScopeCustomersRead, ScopeCustomersWrite,
+	ScopeOrdersRead, ScopeOrdersWrite,
+	ScopeProductsRead, ScopeProductsWrite,
+	ScopeRidersRead, ScopeRidersWrite,
+	ScopeReportsRead, ScopeReportsWrite,
+	ScopeAdminRead, ScopeAdminWrite,
+}
+
+// ParseScope splits a space separated scope, rejecting unknown scopes and
+// dropping repeated ones
+func ParseScope(scope string) ([]string, error) {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !slices.Contains(Scopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes, nil
+}
+
+// Scoped reports whether the token is limited by scope
+func (c *Claims) Scoped() bool {
+	return strings.TrimSpace(c.Scope) != ""
+}
+
+// HasScope reports whether the token may use scope. Unscoped tokens may use
+// any.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.Scoped() {
+		return true
+	}
+	return slices.Contains(strings.Fields(c.Scope), scope)
+}
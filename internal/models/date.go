@@ -0,0 +1,56 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is how a Date is written, in requests, responses and columns
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day with no time or zone, such as a birthday. It is
+// stored as YYYY-MM-DD text, so its month and day can be matched with
+// SUBSTR on every database.
+type Date string
+
+// ParseDate reads a YYYY-MM-DD date
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q, want YYYY-MM-DD", s)
+	}
+	return DateOf(t), nil
+}
+
+// DateOf is the day t falls on in its own location
+func DateOf(t time.Time) Date {
+	return Date(t.Format(DateLayout))
+}
+
+// Time is the start of the day in UTC
+func (d Date) Time() time.Time {
+	t, _ := time.Parse(DateLayout, string(d))
+	return t
+}
+
+// MonthDay is the MM-DD the date recurs on every year
+func (d Date) MonthDay() string {
+	if len(d) != len(DateLayout) {
+		return ""
+	}
+	return string(d[5:])
+}
+
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("a date must be a YYYY-MM-DD string")
+	}
+	date, err := ParseDate(s)
+	if err != nil {
+		return err
+	}
+	*d = date
+	return nil
+}
@@ -0,0 +1,234 @@
+package models
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// All returns every model in the system. New models must be added here so
+// all entrypoints and tests migrate them and startup checks look for them.
+func All() []interface{} {
+	return []interface{}{&Customer{}, &Order{}, &Product{}, &AuditEvent{}, &DailyOrderStat{}, &ArchivedOrder{}, &SMSMessage{}, &FeatureFlag{}, &NotificationAttempt{}, &CustomerNote{}, &Rider{}, &DeliveryAssignment{}, &Session{}, &UserIdentity{}, &Saga{}, &SagaStep{}, &CustomerCodeChange{}, &OrderAnomaly{}, &DeviceToken{}, &PushNotification{}, &OrderRevision{}, &ShipmentEvent{}, &BackfillRun{}, &Quote{}, &APIKey{}, &APIUsage{}, &Policy{}, &UserRole{}, &WinBackMessage{}, &JobRun{}, &OrderEvent{}, &OrderDigest{}, &WebhookSubscription{}, &CustomerTag{}, &SegmentSync{}, &SegmentSyncMember{}, &GreetingMessage{}, &OrderNumberCounter{}, &Campaign{}, &CampaignRecipient{}, &PromoCode{}, &PromoRedemption{}}
+}
+
+// Migrate creates or updates the tables for every model in All
+func Migrate(db *gorm.DB) error {
+	if db.Dialector.Name() == "mysql" {
+		// InnoDB for foreign keys and transactions, utf8mb4 so names and SMS
+		// texts can hold any character
+		db = db.Set("gorm:table_options", "ENGINE=InnoDB DEFAULT CHARSET=utf8mb4")
+	}
+
+	// emails are encrypted now, so uniqueness moved to email_hash. The old
+	// index goes first since MySQL cannot index the email column once it
+	// is text.
+	if db.Migrator().HasIndex(&Customer{}, "idx_customers_email") {
+		if err := db.Migrator().DropIndex(&Customer{}, "idx_customers_email"); err != nil {
+			return err
+		}
+	}
+
+	if err := amountsToCents(db); err != nil {
+		return err
+	}
+
+	amountsUnchecked := !db.Migrator().HasColumn(&Order{}, "amount_checked_at")
+
+	err := db.AutoMigrate(All()...)
+	if err != nil {
+		return err
+	}
+
+	if amountsUnchecked {
+		// orders placed before amounts were checked are left alone, so
+		// turning the check on does not raise alerts about old orders
+		err := db.Unscoped().Model(&Order{}).Where("amount_checked_at IS NULL").
+			UpdateColumn("amount_checked_at", gorm.Expr("created_at")).Error
+		if err != nil {
+			return err
+		}
+	}
+	if err := itemSearchIndex(db); err != nil {
+		return err
+	}
+	if err := customerNameIndex(db); err != nil {
+		return err
+	}
+	return uniqueCodesIgnoringCase(db)
+}
+
+// amountsToCents converts money columns created when amounts were float
+// shillings to whole cents. Each column is copied, scaled, into a BIGINT
+// <column>_cents which then replaces it. MySQL commits every ALTER on its
+// own, so each step can be run again: the copy always reads the untouched
+// shillings, and a swap that stopped once they were dropped is finished by
+// the rename alone.
+func amountsToCents(db *gorm.DB) error {
+	moneyType := reflect.TypeOf(Money(0))
+	for _, model := range []interface{}{&Order{}, &ArchivedOrder{}, &Product{}, &Quote{}, &DailyOrderStat{}, &OrderAnomaly{}} {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		columnTypes, err := db.Migrator().ColumnTypes(model)
+		if err != nil {
+			return err
+		}
+		columns := map[string]string{}
+		for _, columnType := range columnTypes {
+			columns[columnType.Name()] = columnType.DatabaseTypeName()
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IndirectFieldType != moneyType {
+				continue
+			}
+			shillings, ok := columns[field.DBName]
+			floating := ok && isFloatColumn(shillings)
+			_, copied := columns[field.DBName+"_cents"]
+			// a swap that stopped once the shillings were dropped only
+			// needs the rename
+			if !floating && (ok || !copied) {
+				continue
+			}
+
+			log.Printf("converting %s.%s to cents", stmt.Schema.Table, field.DBName)
+			err := db.Transaction(func(tx *gorm.DB) error {
+				return swapInCents(tx, model, stmt.Schema.Table, field, floating, copied)
+			})
+			if err != nil {
+				return fmt.Errorf("failed to convert %s.%s to cents: %w", stmt.Schema.Table, field.DBName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// swapInCents copies field's shillings, while they are still there, into
+// its _cents column and renames that over them
+func swapInCents(tx *gorm.DB, model interface{}, table string, field *schema.Field, shillings, copied bool) error {
+	cents := field.DBName + "_cents"
+	if shillings {
+		if !copied {
+			err := tx.Exec("ALTER TABLE ? ADD ? BIGINT", clause.Table{Name: table}, clause.Column{Name: cents}).Error
+			if err != nil {
+				return err
+			}
+		}
+		err := tx.Exec("UPDATE ? SET ? = ROUND(? * 100)", clause.Table{Name: table},
+			clause.Column{Name: cents}, clause.Column{Name: field.DBName}).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn(model, field.DBName); err != nil {
+			return err
+		}
+	}
+	if err := tx.Migrator().RenameColumn(model, cents, field.DBName); err != nil {
+		return err
+	}
+	return tx.Migrator().AlterColumn(model, field.Name)
+}
+
+func isFloatColumn(databaseType string) bool {
+	switch strings.ToLower(databaseType) {
+	case "real", "float", "float4", "float8", "double", "double precision", "numeric", "decimal":
+		return true
+	}
+	return false
+}
+
+// itemSearchIndex lets Postgres serve the order list's item substring
+// search from a trigram index. pg_trgm may not be available to the
+// database user, in which case the search scans instead. Other databases
+// cannot index a LIKE '%...%' search.
+func itemSearchIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" || db.Migrator().HasIndex(&Order{}, "idx_orders_item_trgm") {
+		return nil
+	}
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("pg_trgm is not available, order item search will not be indexed: %v", err)
+		return nil
+	}
+	return db.Exec("CREATE INDEX idx_orders_item_trgm ON orders USING gin (LOWER(item) gin_trgm_ops)").Error
+}
+
+// customerNameIndex lets Postgres find customers with similar names, for
+// the duplicates report, from a trigram index. As with itemSearchIndex the
+// report falls back to comparing names itself without pg_trgm.
+func customerNameIndex(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" || db.Migrator().HasIndex(&Customer{}, "idx_customers_name_trgm") {
+		return nil
+	}
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS pg_trgm").Error; err != nil {
+		log.Printf("pg_trgm is not available, customer names will not be indexed: %v", err)
+		return nil
+	}
+	return db.Exec("CREATE INDEX idx_customers_name_trgm ON customers USING gin (LOWER(name) gin_trgm_ops)").Error
+}
+
+// uniqueCodesIgnoringCase adds an index on LOWER(code) so "CUST001" and
+// "cust001" cannot both be taken. Existing codes are trimmed first, and
+// where two customers' codes then match, the newer customer's code gets its
+// id appended so the index can be built. Renames are audited.
+func uniqueCodesIgnoringCase(db *gorm.DB) error {
+	if db.Migrator().HasIndex(&Customer{}, "idx_customers_code_ci") {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var customers []Customer
+		if err := tx.Unscoped().Select("id", "code").Order("id ASC").Find(&customers).Error; err != nil {
+			return err
+		}
+
+		owners := map[string]uint{}
+		var renames, trims []Customer
+		for _, customer := range customers {
+			code := NormalizeCode(customer.Code)
+			if owner, ok := owners[strings.ToLower(code)]; ok {
+				renamed := fmt.Sprintf("%s-%d", code, customer.ID)
+				log.Printf("customer %d code %q clashes with customer %d, renaming it to %q", customer.ID, customer.Code, owner, renamed)
+				renames = append(renames, Customer{ID: customer.ID, Code: renamed})
+				continue
+			}
+			owners[strings.ToLower(code)] = customer.ID
+			if code != customer.Code {
+				trims = append(trims, Customer{ID: customer.ID, Code: code})
+			}
+		}
+
+		// renames go first so a trimmed code never meets its untrimmed twin
+		for _, customer := range append(renames, trims...) {
+			err := tx.Unscoped().Model(&Customer{}).Where("id = ?", customer.ID).UpdateColumn("code", customer.Code).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, customer := range renames {
+			event := AuditEvent{
+				Type:    AuditCustomerCodeChanged,
+				Actor:   "migration",
+				Details: fmt.Sprintf("customer %d code renamed to %s, it clashed with another customer's code", customer.ID, customer.Code),
+			}
+			if err := tx.Create(&event).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return db.Exec("CREATE UNIQUE INDEX idx_customers_code_ci ON customers ((LOWER(code)))").Error
+}
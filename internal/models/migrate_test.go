@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMigrateAmountsToCents(t *testing.T) {
+	tests := []struct {
+		name    string
+		columns string
+		values  string
+	}{
+		{name: "float shillings", columns: "`price` real NOT NULL", values: "1499.9"},
+		{name: "stopped after the copy", columns: "`price` real NOT NULL,`price_cents` bigint", values: "1499.9, 149990"},
+		{name: "stopped after the shillings were dropped", columns: "`price_cents` bigint", values: "149990"},
+		{name: "already cents", columns: "`price` bigint NOT NULL", values: "149990"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+			if err != nil {
+				t.Fatalf("failed to connect to test database: %v", err)
+			}
+			// as GORM created it when prices were float shillings
+			db.Exec("CREATE TABLE `products` (`id` integer PRIMARY KEY,`name` text NOT NULL,`sku` text NOT NULL," + tt.columns + ")")
+			db.Exec("INSERT INTO products VALUES (1, 'Laptop', 'LAP-001', " + tt.values + ")")
+
+			// a second run must leave the amounts as the first one did
+			for run := 1; run <= 2; run++ {
+				if !assert.NoError(t, Migrate(db), "run %d", run) {
+					return
+				}
+				var product Product
+				assert.NoError(t, db.First(&product, 1).Error)
+				assert.Equal(t, Money(149990), product.Price, "run %d", run)
+				assert.False(t, db.Migrator().HasColumn(&Product{}, "price_cents"), "run %d", run)
+			}
+		})
+	}
+}
@@ -1,65 +1,513 @@
 package models
 
 import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
 	"gorm.io/gorm"
 )
 
-// Customer - customer in the system
+// Customer - customer in the system. Phone and email are encrypted at rest;
+// PhoneHash and EmailHash are their blind indexes, for lookups and email
+// uniqueness.
 type Customer struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Name      string         `json:"name" gorm:"not null" binding:"required"`
-	Code      string         `json:"code" gorm:"uniqueIndex;not null" binding:"required"`
-	Phone     string         `json:"phone" gorm:"not null" binding:"required"`
-	Email     string         `json:"email" gorm:"uniqueIndex"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
-	Orders    []Order        `json:"orders,omitempty" gorm:"foreignKey:CustomerID"`
+	ID           uint           `json:"id" gorm:"primaryKey"`
+	Name         string         `json:"name" gorm:"not null" binding:"required"`
+	Code         string         `json:"code" gorm:"uniqueIndex;not null" binding:"required"`
+	Phone        string         `json:"phone" gorm:"type:text;not null;serializer:pii" binding:"required"`
+	PhoneHash    string         `json:"-" gorm:"type:varchar(64);index"`
+	Email        string         `json:"email" gorm:"type:text;serializer:pii"`
+	EmailHash    *string        `json:"-" gorm:"type:varchar(64);uniqueIndex"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	AnonymizedAt *time.Time     `json:"anonymized_at,omitempty"`
+	// LastOrderAt is when the customer last placed an order, kept by
+	// Order.AfterCreate
+	LastOrderAt *time.Time `json:"last_order_at,omitempty" gorm:"index"`
+	// MarketingOptOutAt is set when the customer replied STOP, and keeps
+	// them out of win-back, greeting and SMS campaigns
+	MarketingOptOutAt *time.Time `json:"marketing_opt_out_at,omitempty"`
+	// Birthday and OnboardedOn, when known, are greeted by the greeting
+	// campaigns every year
+	Birthday    *Date `json:"birthday,omitempty" gorm:"type:varchar(10)"`
+	OnboardedOn *Date `json:"onboarded_on,omitempty" gorm:"type:varchar(10)"`
+	// DeliveryInstructions are copied onto new orders that come without
+	// their own
+	DeliveryInstructions string         `json:"delivery_instructions,omitempty" gorm:"type:varchar(500)"`
+	Orders               []Order        `json:"orders,omitempty" gorm:"foreignKey:CustomerID"`
+	Notes                []CustomerNote `json:"notes,omitempty" gorm:"foreignKey:CustomerID"`
+	OrdersCount          *int64         `json:"orders_count,omitempty" gorm:"->;-:migration"`
+}
+
+// BeforeSave normalizes the code and email and keeps the blind indexes in
+// step with phone and email
+func (c *Customer) BeforeSave(tx *gorm.DB) error {
+	c.Code = NormalizeCode(c.Code)
+	c.Email = NormalizeEmail(c.Email)
+	c.PhoneHash, c.EmailHash = CustomerHashes(c.Phone, c.Email)
+	return nil
 }
 
+// NormalizeEmail trims and lowercases an email, so addresses that differ
+// only in case or surrounding spaces belong to one customer
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeCode trims a customer code. Codes keep the case they were given
+// in but are unique regardless of it.
+func NormalizeCode(code string) string {
+	return strings.TrimSpace(code)
+}
+
+// CustomerHashes returns the blind indexes of a customer's phone and email.
+// An empty email has none, so any number of customers can leave it out.
+func CustomerHashes(phone, email string) (string, *string) {
+	var emailHash *string
+	if email != "" {
+		h := pii.BlindIndex(email)
+		emailHash = &h
+	}
+	return pii.BlindIndex(phone), emailHash
+}
+
+// Order statuses, in the order an order normally moves through them
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusConfirmed = "confirmed"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+const (
+	OrderPriorityNormal  = "normal"
+	OrderPriorityExpress = "express"
+)
+
 type Order struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	Item       string         `json:"item" gorm:"not null" binding:"required"`
-	Amount     float64        `json:"amount" gorm:"not null" binding:"required,min=0"`
-	Time       time.Time      `json:"time" gorm:"not null"`
-	CustomerID uint           `json:"customer_id" gorm:"not null" binding:"required"`
-	Customer   Customer       `json:"customer,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                  uint       `json:"id" gorm:"primaryKey"`
+	Number              *string    `json:"number,omitempty" gorm:"type:varchar(40);uniqueIndex"` // e.g. ORD-2025-000123, see services.OrderNumberPolicy
+	Item                string     `json:"item" gorm:"not null" binding:"required"`
+	Amount              Money      `json:"amount" gorm:"not null;index" binding:"required,min=0"`
+	TaxRate             float64    `json:"tax_rate" gorm:"not null;default:0"`
+	TaxInclusive        bool       `json:"tax_inclusive" gorm:"not null;default:false"`
+	NetAmount           Money      `json:"net_amount" gorm:"not null;default:0"`
+	TaxAmount           Money      `json:"tax_amount" gorm:"not null;default:0"`
+	GrossAmount         Money      `json:"gross_amount" gorm:"not null;default:0"`
+	PromoCode           *string    `json:"promo_code,omitempty" gorm:"type:varchar(32);index"`
+	DiscountAmount      Money      `json:"discount_amount,omitempty" gorm:"not null;default:0"` // taken off by PromoCode, so Amount is after it
+	Time                time.Time  `json:"time" gorm:"not null;index"`
+	PlacedAt            *time.Time `json:"-"` // replacing Time, see migrations.Renames
+	Status              string     `json:"status" gorm:"not null;default:pending;index"`
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at,omitempty"`
+	ProductID           *uint      `json:"product_id,omitempty" gorm:"index"`
+	Quantity            int        `json:"quantity" gorm:"not null;default:1"`
+	Priority            string     `json:"priority" gorm:"type:varchar(10);not null;default:normal"`
+	SLADeadline         *time.Time `json:"sla_deadline,omitempty" gorm:"index"`
+	SLABreachedAt       *time.Time `json:"sla_breached_at,omitempty" gorm:"index"`
+	SLAEscalatedAt      *time.Time `json:"-"`
+	// DeliveryInstructions are for the rider, such as "call on arrival,
+	// gate 3", and default to the customer's
+	DeliveryInstructions string     `json:"delivery_instructions,omitempty" gorm:"type:varchar(500)"`
+	AmountCheckedAt      *time.Time `json:"-" gorm:"index"`
+	CustomerID           uint       `json:"customer_id" gorm:"not null" binding:"required"`
+	Customer             Customer   `json:"customer,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	// EventSequence is the sequence of the last order event reflected in
+	// this row, see OrderEvent
+	EventSequence int            `json:"-" gorm:"not null;default:0"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AfterCreate moves the customer's last_order_at forward, whichever way
+// the order was placed
+func (o *Order) AfterCreate(tx *gorm.DB) error {
+	placed := o.CreatedAt
+	if placed.IsZero() {
+		placed = time.Now()
+	}
+	return tx.Model(&Customer{}).
+		Where("id = ? AND (last_order_at IS NULL OR last_order_at < ?)", o.CustomerID, placed).
+		UpdateColumn("last_order_at", placed).Error
+}
+
+// Reference names the order to people, in texts and replies: its number,
+// or its id for orders placed before orders were numbered
+func (o Order) Reference() string {
+	if o.Number != nil {
+		return *o.Number
+	}
+	return strconv.FormatUint(uint64(o.ID), 10)
+}
+
+// OrderNumberCounter - the last number given out in a gapless sequence of
+// order numbers, one per prefix and year
+type OrderNumberCounter struct {
+	Scope     string    `json:"scope" gorm:"primaryKey;type:varchar(40)"`
+	Value     int64     `json:"value" gorm:"not null;default:0"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CustomerSummary - the customer of an order in order lists, without the
+// rest of the customer record
+type CustomerSummary struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Code  string `json:"code"`
+	Phone string `json:"phone" gorm:"serializer:pii"`
+}
+
+// OrderSummary - an order as listed, with a summary of its customer in
+// place of the full record
+type OrderSummary struct {
+	Order
+	Customer *CustomerSummary `json:"customer,omitempty"`
+}
+
+// Product - stocked item that orders can draw down
+type Product struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	Name              string         `json:"name" gorm:"not null"`
+	SKU               string         `json:"sku" gorm:"uniqueIndex;not null"`
+	Price             Money          `json:"price" gorm:"not null"`
+	StockQuantity     int            `json:"stock_quantity" gorm:"not null;default:0"`
+	LowStockThreshold int            `json:"low_stock_threshold" gorm:"not null;default:0"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// IsLowStock reports whether the product is at or below its alert threshold
+func (p Product) IsLowStock() bool {
+	return p.StockQuantity <= p.LowStockThreshold
 }
 
 type CreateCustomerRequest struct {
-	Name  string `json:"name" binding:"required"`
-	Code  string `json:"code" binding:"required"`
-	Phone string `json:"phone" binding:"required"`
-	Email string `json:"email" binding:"email"`
+	Name                 string `json:"name" binding:"required"`
+	Code                 string `json:"code" binding:"required,customer_code"`
+	Phone                string `json:"phone" binding:"required,kenyan_phone"`
+	Email                string `json:"email" binding:"email"`
+	DeliveryInstructions string `json:"delivery_instructions" binding:"max=500"`
+	Birthday             *Date  `json:"birthday"`
+	OnboardedOn          *Date  `json:"onboarded_on"`
+}
+
+// UnmarshalJSON normalizes the code and email before they are validated
+func (r *CreateCustomerRequest) UnmarshalJSON(data []byte) error {
+	type plain CreateCustomerRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Code = NormalizeCode(r.Code)
+	r.Email = NormalizeEmail(r.Email)
+	return nil
 }
 
 type UpdateCustomerRequest struct {
 	Name  string `json:"name"`
-	Phone string `json:"phone"`
+	Phone string `json:"phone" binding:"omitempty,kenyan_phone"`
 	Email string `json:"email" binding:"omitempty,email"`
+	// DeliveryInstructions set to "" clears them
+	DeliveryInstructions *string `json:"delivery_instructions" binding:"omitempty,max=500"`
+	// Birthday and OnboardedOn set to null clear them
+	Birthday    Optional[Date] `json:"birthday,omitzero"`
+	OnboardedOn Optional[Date] `json:"onboarded_on,omitzero"`
+}
+
+// UnmarshalJSON normalizes the email before it is validated
+func (r *UpdateCustomerRequest) UnmarshalJSON(data []byte) error {
+	type plain UpdateCustomerRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Email = NormalizeEmail(r.Email)
+	return nil
+}
+
+type ChangeCustomerCodeRequest struct {
+	Code string `json:"code" binding:"required,max=50,customer_code"`
+}
+
+// UnmarshalJSON normalizes the code before it is validated
+func (r *ChangeCustomerCodeRequest) UnmarshalJSON(data []byte) error {
+	type plain ChangeCustomerCodeRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Code = NormalizeCode(r.Code)
+	return nil
+}
+
+// CustomerCodeChange records a code a customer used to have, so references
+// to the old code still resolve. An old code belongs to one customer only.
+type CustomerCodeChange struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CustomerID uint      `json:"customer_id" gorm:"not null;index"`
+	OldCode    string    `json:"old_code" gorm:"type:varchar(50);not null;uniqueIndex"`
+	NewCode    string    `json:"new_code" gorm:"type:varchar(50);not null"`
+	ChangedBy  string    `json:"changed_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (CustomerCodeChange) TableName() string {
+	return "code_history"
+}
+
+// BulkCustomerRequest selects customers to delete or restore in one go,
+// either by id or by filter. With DryRun nothing is changed.
+type BulkCustomerRequest struct {
+	IDs    []uint              `json:"ids" binding:"omitempty,max=1000,dive,min=1"`
+	Filter *BulkCustomerFilter `json:"filter"`
+	DryRun bool                `json:"dry_run"`
+}
+
+// BulkCustomerFilter matches customers on every criterion given
+type BulkCustomerFilter struct {
+	CodePrefix   string     `json:"code_prefix" binding:"omitempty,max=50"`
+	NameContains string     `json:"name_contains" binding:"omitempty,max=255"`
+	CreatedFrom  *time.Time `json:"created_from"`
+	CreatedTo    *time.Time `json:"created_to"`
+}
+
+// BulkCustomerResult reports the customers a bulk operation changed, or
+// would change on a dry run. NotFound lists requested ids there was nothing
+// to do for.
+type BulkCustomerResult struct {
+	DryRun   bool   `json:"dry_run"`
+	Affected int    `json:"affected"`
+	IDs      []uint `json:"ids"`
+	NotFound []uint `json:"not_found,omitempty"`
+}
+
+// Reasons two customers look like the same person
+const (
+	DuplicateByPhone = "phone"
+	DuplicateByEmail = "email"
+	DuplicateByName  = "name"
+)
+
+// DuplicateCluster - customers that look like one person. KeepID is the
+// customer a merge should keep: the one with the most orders, then the
+// oldest. Confidence is that of the weakest match holding the cluster
+// together.
+type DuplicateCluster struct {
+	CustomerIDs []uint           `json:"customer_ids"`
+	KeepID      uint             `json:"keep_id"`
+	Confidence  float64          `json:"confidence"`
+	Customers   []Customer       `json:"customers"`
+	Matches     []DuplicateMatch `json:"matches"`
+}
+
+// DuplicateMatch - why two customers look like the same person
+type DuplicateMatch struct {
+	CustomerIDs    [2]uint  `json:"customer_ids"`
+	Reasons        []string `json:"reasons"`
+	NameSimilarity float64  `json:"name_similarity"`
+	Confidence     float64  `json:"confidence"`
 }
 
 type CreateOrderRequest struct {
 	Item       string    `json:"item" binding:"required"`
-	Amount     float64   `json:"amount" binding:"required,min=0"`
-	Time       time.Time `json:"time" binding:"required"`
+	Amount     Money     `json:"amount" binding:"required,min=0,order_amount"`
+	Time       time.Time `json:"time" binding:"required,order_time"`
 	CustomerID uint      `json:"customer_id" binding:"required"`
+	ProductID  *uint     `json:"product_id"`
+	Quantity   int       `json:"quantity" binding:"omitempty,min=1"`
+	Priority   string    `json:"priority" binding:"omitempty,oneof=normal express"`
+	// DeliveryInstructions default to the customer's when left out
+	DeliveryInstructions string `json:"delivery_instructions" binding:"max=500"`
+	// PromoCode takes its discount off Amount, which is the full price
+	PromoCode string `json:"promo_code" binding:"omitempty,promo_code"`
+}
+
+// CreateCustomerOrderRequest places an order for the customer in the path,
+// so unlike CreateOrderRequest it has no customer_id
+type CreateCustomerOrderRequest struct {
+	Item      string    `json:"item" binding:"required"`
+	Amount    Money     `json:"amount" binding:"required,min=0,order_amount"`
+	Time      time.Time `json:"time" binding:"required,order_time"`
+	ProductID *uint     `json:"product_id"`
+	Quantity  int       `json:"quantity" binding:"omitempty,min=1"`
+	Priority  string    `json:"priority" binding:"omitempty,oneof=normal express"`
+	// DeliveryInstructions default to the customer's when left out
+	DeliveryInstructions string `json:"delivery_instructions" binding:"max=500"`
+	// PromoCode takes its discount off Amount, which is the full price
+	PromoCode string `json:"promo_code" binding:"omitempty,promo_code"`
+}
+
+// DuplicateOrderRequest overrides fields of the order being copied
+type DuplicateOrderRequest struct {
+	Item   string `json:"item"`
+	Amount *Money `json:"amount" binding:"omitempty,gt=0,order_amount"`
+	// Quantity without Amount scales the amount at the original unit price
+	Quantity int        `json:"quantity" binding:"omitempty,min=1"`
+	Priority string     `json:"priority" binding:"omitempty,oneof=normal express"`
+	Time     *time.Time `json:"time" binding:"omitempty,order_time"`
 }
 
+// UpdateOrderRequest changes the fields it sets and leaves the rest, so an
+// amount of 0 is an amount like any other. Sending the same update twice
+// changes the order once.
 type UpdateOrderRequest struct {
-	Item   string    `json:"item"`
-	Amount float64   `json:"amount" binding:"omitempty,min=0"`
-	Time   time.Time `json:"time" binding:"omitempty"`
+	Item   *string    `json:"item,omitempty" binding:"omitempty,min=1"`
+	Amount *Money     `json:"amount,omitempty" binding:"omitempty,min=0,order_amount"`
+	Time   *time.Time `json:"time,omitempty"`
+	Status *string    `json:"status,omitempty" binding:"omitempty,oneof=pending confirmed shipped delivered cancelled"`
+	// EstimatedDeliveryAt set to null clears it
+	EstimatedDeliveryAt Optional[time.Time] `json:"estimated_delivery_at,omitzero"`
+	// DeliveryInstructions set to "" clears them
+	DeliveryInstructions *string `json:"delivery_instructions,omitempty" binding:"omitempty,max=500"`
+}
+
+// ShipmentEvent is a status update a courier sent for an order. Couriers
+// retry their webhooks, so each event is stored once per provider.
+type ShipmentEvent struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrderID        uint      `json:"order_id" gorm:"not null;index"`
+	Provider       string    `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_shipment_events_event"`
+	EventID        string    `json:"event_id" gorm:"type:varchar(191);not null;uniqueIndex:idx_shipment_events_event"`
+	Event          string    `json:"event" gorm:"type:varchar(50);not null"`
+	Status         string    `json:"status,omitempty" gorm:"type:varchar(20)"`
+	TrackingNumber string    `json:"tracking_number,omitempty"`
+	OccurredAt     time.Time `json:"occurred_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// OrderRevision records one field an order update changed, with who
+// changed it. Values are kept as text, times in RFC 3339, and a cleared
+// value is empty.
+type OrderRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	OrderID   uint      `json:"order_id" gorm:"not null;index"`
+	Field     string    `json:"field" gorm:"type:varchar(50);not null"`
+	OldValue  string    `json:"old_value" gorm:"type:text"`
+	NewValue  string    `json:"new_value" gorm:"type:text"`
+	Actor     string    `json:"actor"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// Order event types
+const (
+	OrderEventCreated             = "order.created"
+	OrderEventItemChanged         = "order.item_changed"
+	OrderEventAmountChanged       = "order.amount_changed"
+	OrderEventTimeChanged         = "order.time_changed"
+	OrderEventStatusChanged       = "order.status_changed"
+	OrderEventDeliveryEstimated   = "order.delivery_estimated"
+	OrderEventInstructionsChanged = "order.delivery_instructions_changed"
+	OrderEventCancelled           = "order.cancelled"
+	OrderEventDeleted             = "order.deleted"
+)
+
+// ErrOrderEventImmutable is returned on any attempt to change or delete an
+// order event
+var ErrOrderEventImmutable = errors.New("order events cannot be changed or deleted")
+
+// OrderEvent is one command applied to an order, numbered from 1 per
+// order. Events are only ever appended, so replaying an order's events in
+// sequence rebuilds it as it stood after the last one. The exception is
+// anonymizing a customer, which blanks the delivery instructions in their
+// orders' events, see services.EraseDeliveryInstructions.
+type OrderEvent struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	OrderID   uint           `json:"order_id" gorm:"not null;uniqueIndex:idx_order_events_sequence"`
+	Sequence  int            `json:"sequence" gorm:"not null;uniqueIndex:idx_order_events_sequence"`
+	Type      string         `json:"type" gorm:"type:varchar(40);not null"`
+	Data      OrderEventData `json:"data" gorm:"type:text;serializer:json"`
+	Actor     string         `json:"actor"`
+	CreatedAt time.Time      `json:"created_at" gorm:"index"`
+}
+
+// BeforeUpdate keeps the event log append-only
+func (e *OrderEvent) BeforeUpdate(tx *gorm.DB) error {
+	return ErrOrderEventImmutable
+}
+
+// BeforeDelete keeps the event log append-only
+func (e *OrderEvent) BeforeDelete(tx *gorm.DB) error {
+	return ErrOrderEventImmutable
+}
+
+// OrderEventData holds the order fields an event sets. A created event sets
+// them all; the others only the fields they change.
+type OrderEventData struct {
+	Item                 *string    `json:"item,omitempty"`
+	Amount               *Money     `json:"amount,omitempty"`
+	TaxRate              *float64   `json:"tax_rate,omitempty"`
+	TaxInclusive         *bool      `json:"tax_inclusive,omitempty"`
+	NetAmount            *Money     `json:"net_amount,omitempty"`
+	TaxAmount            *Money     `json:"tax_amount,omitempty"`
+	GrossAmount          *Money     `json:"gross_amount,omitempty"`
+	Time                 *time.Time `json:"time,omitempty"`
+	Status               *string    `json:"status,omitempty"`
+	EstimatedDeliveryAt  *time.Time `json:"estimated_delivery_at,omitempty"`
+	CustomerID           *uint      `json:"customer_id,omitempty"`
+	ProductID            *uint      `json:"product_id,omitempty"`
+	Quantity             *int       `json:"quantity,omitempty"`
+	Priority             *string    `json:"priority,omitempty"`
+	SLADeadline          *time.Time `json:"sla_deadline,omitempty"`
+	DeliveryInstructions *string    `json:"delivery_instructions,omitempty"`
+	PromoCode            *string    `json:"promo_code,omitempty"`
+	DiscountAmount       *Money     `json:"discount_amount,omitempty"`
+}
+
+type CreateProductRequest struct {
+	Name              string `json:"name" binding:"required"`
+	SKU               string `json:"sku" binding:"required"`
+	Price             Money  `json:"price" binding:"min=0"`
+	StockQuantity     int    `json:"stock_quantity" binding:"min=0"`
+	LowStockThreshold int    `json:"low_stock_threshold" binding:"min=0"`
+}
+
+type UpdateProductRequest struct {
+	Name              string `json:"name"`
+	Price             *Money `json:"price" binding:"omitempty,min=0"`
+	StockQuantity     *int   `json:"stock_quantity" binding:"omitempty,min=0"`
+	LowStockThreshold *int   `json:"low_stock_threshold" binding:"omitempty,min=0"`
+}
+
+// TrackingResponse - public view of an order returned by the tracking link
+type TrackingResponse struct {
+	OrderID             uint       `json:"order_id"`
+	Item                string     `json:"item"`
+	Status              string     `json:"status"`
+	PlacedAt            time.Time  `json:"placed_at"`
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at,omitempty"`
+}
+
+// CatalogProduct - public view of a product in the catalog, without stock
+// levels or thresholds
+type CatalogProduct struct {
+	ID      uint   `json:"id"`
+	Name    string `json:"name"`
+	SKU     string `json:"sku"`
+	Price   Money  `json:"price"`
+	InStock bool   `json:"in_stock"`
+}
+
+// ToCatalogProduct returns the public view of the product
+func (p Product) ToCatalogProduct() CatalogProduct {
+	return CatalogProduct{
+		ID:      p.ID,
+		Name:    p.Name,
+		SKU:     p.SKU,
+		Price:   p.Price,
+		InStock: p.StockQuantity > 0,
+	}
 }
 
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// Scope asks for a token limited to these space separated scopes
+	Scope string `json:"scope" binding:"max=500"`
 }
 
 type AuthResponse struct {
@@ -67,10 +515,1251 @@ type AuthResponse struct {
 	RefreshToken string `json:"refresh_token"`
 	ExpiresIn    int64  `json:"expires_in"`
 	TokenType    string `json:"token_type"`
+	// Scope is what the token is limited to, when it is
+	Scope string `json:"scope,omitempty"`
+	// CSRFToken must be sent in the X-CSRF-Token header of unsafe requests
+	// authenticated by the session cookie
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+// Envelope wraps every successful response
+type Envelope struct {
+	Data      interface{} `json:"data"`
+	Meta      interface{} `json:"meta,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// ErrorEnvelope wraps every error response
+type ErrorEnvelope struct {
+	Error     ErrorBody `json:"error"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// ErrorBody describes what went wrong. Code is a stable snake_case
+// identifier clients can branch on; Message is for humans.
+type ErrorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+	// ErrorID identifies a server error in the logs; quote it to support
+	ErrorID string `json:"error_id,omitempty"`
+}
+
+// FieldError is one failed validation rule, returned in ErrorBody.Details
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	// Message explains the business rules of the validation package
+	Message string `json:"message,omitempty"`
+}
+
+// PageMeta describes the page returned by a list endpoint
+type PageMeta struct {
+	Total      int64 `json:"total"`
+	Page       int   `json:"page"`
+	Limit      int   `json:"limit"`
+	TotalPages int   `json:"total_pages"`
+	HasNext    bool  `json:"has_next"`
+	// TotalAccuracy is "exact", "estimated" or "none" when the client
+	// asked how to count. Without a total, total and total_pages are left
+	// out.
+	TotalAccuracy string `json:"total_accuracy,omitempty"`
+}
+
+func (m PageMeta) MarshalJSON() ([]byte, error) {
+	type meta PageMeta
+	if m.TotalAccuracy != "none" {
+		return json.Marshal(meta(m))
+	}
+	return json.Marshal(struct {
+		Page          int    `json:"page"`
+		Limit         int    `json:"limit"`
+		HasNext       bool   `json:"has_next"`
+		TotalAccuracy string `json:"total_accuracy"`
+	}{m.Page, m.Limit, m.HasNext, m.TotalAccuracy})
+}
+
+// Audit event types
+const (
+	AuditLoginSucceeded = "login_succeeded"
+	AuditLoginFailed    = "login_failed"
+	AuditLoginThrottled = "login_throttled"
+	AuditLoginLockedOut = "login_locked_out"
+
+	AuditCustomerAnonymized  = "customer_anonymized"
+	AuditCustomerExported    = "customer_exported"
+	AuditCustomerCodeChanged = "customer_code_changed"
+	AuditCustomersDeleted    = "customers_bulk_deleted"
+	AuditCustomersRestored   = "customers_bulk_restored"
+
+	AuditSessionRevoked = "session_revoked"
+	AuditJWTKeyRotated  = "jwt_key_rotated"
+
+	AuditSagaCompensated = "saga_compensated"
+
+	AuditAPIKeyCreated = "api_key_created"
+	AuditAPIKeyRevoked = "api_key_revoked"
+
+	AuditPolicyCreated = "policy_created"
+	AuditPolicyDeleted = "policy_deleted"
+	AuditRoleAssigned  = "role_assigned"
+	AuditRoleRemoved   = "role_removed"
+
+	AuditIdentityLinked   = "identity_linked"
+	AuditIdentityRelinked = "identity_relinked"
+
+	AuditJobTriggered = "job_triggered"
+
+	AuditDigestSent = "digest_sent"
+
+	AuditWebhookCreated       = "webhook_created"
+	AuditWebhookUpdated       = "webhook_updated"
+	AuditWebhookDeleted       = "webhook_deleted"
+	AuditWebhookSecretRotated = "webhook_secret_rotated"
+
+	AuditSegmentSyncCreated   = "segment_sync_created"
+	AuditSegmentSyncUpdated   = "segment_sync_updated"
+	AuditSegmentSyncDeleted   = "segment_sync_deleted"
+	AuditSegmentSyncTriggered = "segment_sync_triggered"
+
+	AuditCampaignCreated   = "campaign_created"
+	AuditCampaignCancelled = "campaign_cancelled"
+
+	AuditPromoCodeCreated = "promo_code_created"
+	AuditPromoCodeUpdated = "promo_code_updated"
+	AuditPromoCodeDeleted = "promo_code_deleted"
+)
+
+// AuditEvent - security relevant event kept for later review
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Type      string    `json:"type" gorm:"not null;index"`
+	Actor     string    `json:"actor" gorm:"index"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent" gorm:"type:text"`
+	Details   string    `json:"details" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// ArchivedOrder is an order moved out of the orders table by the archival
+// job. It keeps the original id and timestamps so old references resolve.
+type ArchivedOrder struct {
+	ID                  uint       `json:"id" gorm:"primaryKey;autoIncrement:false"`
+	Number              *string    `json:"number,omitempty" gorm:"type:varchar(40);index"`
+	Item                string     `json:"item" gorm:"not null"`
+	Amount              Money      `json:"amount" gorm:"not null;index"`
+	TaxRate             float64    `json:"tax_rate" gorm:"not null;default:0"`
+	TaxInclusive        bool       `json:"tax_inclusive" gorm:"not null;default:false"`
+	NetAmount           Money      `json:"net_amount" gorm:"not null;default:0"`
+	TaxAmount           Money      `json:"tax_amount" gorm:"not null;default:0"`
+	GrossAmount         Money      `json:"gross_amount" gorm:"not null;default:0"`
+	Time                time.Time  `json:"time" gorm:"not null;index"`
+	Status              string     `json:"status" gorm:"not null"`
+	EstimatedDeliveryAt *time.Time `json:"estimated_delivery_at,omitempty"`
+	ProductID           *uint      `json:"product_id,omitempty"`
+	Quantity            int        `json:"quantity" gorm:"not null;default:1"`
+	CustomerID          uint       `json:"customer_id" gorm:"not null;index"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	ArchivedAt          time.Time  `json:"archived_at" gorm:"not null"`
+}
+
+// DailyOrderStat - pre-aggregated order figures for one calendar day
+type DailyOrderStat struct {
+	ID           uint      `json:"-" gorm:"primaryKey"`
+	Day          string    `json:"day" gorm:"type:varchar(10);uniqueIndex;not null"`
+	OrdersCount  int64     `json:"orders_count" gorm:"not null;default:0"`
+	Revenue      Money     `json:"revenue" gorm:"not null;default:0"`
+	NewCustomers int64     `json:"new_customers" gorm:"not null;default:0"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ReportPoint - one entry of a daily, weekly or monthly report series
+type ReportPoint struct {
+	PeriodStart  string `json:"period_start"`
+	OrdersCount  int64  `json:"orders_count"`
+	Revenue      Money  `json:"revenue"`
+	NewCustomers int64  `json:"new_customers"`
+}
+
+// VATReportPoint - VAT collected on the orders of one month
+type VATReportPoint struct {
+	Month       string `json:"month"`
+	OrdersCount int64  `json:"orders_count"`
+	NetAmount   Money  `json:"net_amount"`
+	TaxAmount   Money  `json:"tax_amount"`
+	GrossAmount Money  `json:"gross_amount"`
+}
+
+// Statement line kinds
+const (
+	StatementLineCharge    = "charge"
+	StatementLineCancelled = "cancelled"
+)
+
+// Statement summarizes a customer's orders over a period. No payments are
+// recorded, so the balance is the value of the orders placed to date;
+// cancelled orders are listed but not charged.
+type Statement struct {
+	CustomerID     uint            `json:"customer_id"`
+	CustomerName   string          `json:"customer_name"`
+	CustomerCode   string          `json:"customer_code"`
+	From           string          `json:"from"`
+	To             string          `json:"to"`
+	Timezone       string          `json:"timezone"`
+	OpeningBalance Money           `json:"opening_balance"`
+	Charges        Money           `json:"charges"`
+	Cancelled      Money           `json:"cancelled"`
+	ClosingBalance Money           `json:"closing_balance"`
+	OrdersCount    int64           `json:"orders_count"`
+	Lines          []StatementLine `json:"lines"`
+	GeneratedAt    time.Time       `json:"generated_at"`
+}
+
+// StatementLine - one order on a statement, with the balance after it
+type StatementLine struct {
+	Time        time.Time `json:"time"`
+	OrderID     uint      `json:"order_id"`
+	Item        string    `json:"item"`
+	Status      string    `json:"status"`
+	Kind        string    `json:"kind"`
+	NetAmount   Money     `json:"net_amount"`
+	TaxAmount   Money     `json:"tax_amount"`
+	GrossAmount Money     `json:"gross_amount"`
+	Balance     Money     `json:"balance"`
+}
+
+// SendStatementRequest - the period and format of a statement link texted
+// to the customer. The period defaults like the statement's.
+type SendStatementRequest struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Format string `json:"format" binding:"omitempty,oneof=json pdf csv"`
+}
+
+// HeatmapCell - how many orders were placed in one hour of one weekday
+type HeatmapCell struct {
+	Weekday     string `json:"weekday"`
+	Hour        int    `json:"hour"`
+	OrdersCount int64  `json:"orders_count"`
+}
+
+// CreatedResource - what a create returns with ?return=minimal
+type CreatedResource struct {
+	ID      uint   `json:"id"`
+	Version string `json:"version"`
+}
+
+// OrderTotal - how many orders one customer, item or day has and what
+// they add up to. Group is the customer id, the item or the YYYY-MM-DD day.
+type OrderTotal struct {
+	Group       string `json:"group" gorm:"column:group_key"`
+	OrdersCount int64  `json:"orders_count"`
+	TotalAmount Money  `json:"total_amount"`
+}
+
+// SMSFailureReport - how many text messages failed over a recent window,
+// and why
+type SMSFailureReport struct {
+	Window string    `json:"window"`
+	Since  time.Time `json:"since"`
+	// Messages counts recipients sent to or failed, a bulk send counting
+	// once per number
+	Messages    int64              `json:"messages"`
+	Sent        int64              `json:"sent"`
+	Failed      int64              `json:"failed"`
+	FailureRate float64            `json:"failure_rate"`
+	Reasons     []SMSFailureReason `json:"reasons"`
+}
+
+// SMSFailureReason - failures for one reason, most frequent first
+type SMSFailureReason struct {
+	Reason string `json:"reason"`
+	Count  int64  `json:"count"`
+	// Share is the reason's share of the failures
+	Share float64 `json:"share"`
+}
+
+// SLOReport - the current month's error budgets, per route group and for
+// the API as a whole
+type SLOReport struct {
+	MonthStart time.Time `json:"month_start"`
+	// Since is when counting began: the month start, or when this instance
+	// started if that was later
+	Since              time.Time        `json:"since"`
+	AvailabilityTarget float64          `json:"availability_target"`
+	LatencyTarget      float64          `json:"latency_target"`
+	LatencyThresholdMs int64            `json:"latency_threshold_ms"`
+	Overall            SLOGroupReport   `json:"overall"`
+	Groups             []SLOGroupReport `json:"groups"`
+}
+
+// SLOGroupReport - the SLIs of one route group, e.g. "orders"
+type SLOGroupReport struct {
+	Group        string    `json:"group"`
+	Requests     int64     `json:"requests"`
+	Availability SLIReport `json:"availability"`
+	Latency      SLIReport `json:"latency"`
+}
+
+// SLIReport - how one SLI stands against its target this month
+type SLIReport struct {
+	BadRequests int64 `json:"bad_requests"`
+	// Ratio is the share of good requests, 1 with no traffic
+	Ratio float64 `json:"ratio"`
+	// BudgetRemaining is the share of the month's error budget left; it
+	// goes negative once the budget is spent
+	BudgetRemaining float64 `json:"budget_remaining"`
+	// BurnRates is how fast the budget is being spent over recent windows
+	// ("5m", "1h", "6h"), where 1 spends exactly the budget in a month
+	BurnRates map[string]float64 `json:"burn_rates"`
+}
+
+const (
+	SMSDirectionInbound  = "inbound"
+	SMSDirectionOutbound = "outbound"
+)
+
+// SMSMessage is one message of a two-way SMS conversation. CustomerID is
+// empty for senders that do not match a customer. DryRun marks outbound
+// messages that were stored instead of sent, see SMS_DRY_RUN. Outbound
+// messages carry their encoding, segment count and estimated cost.
+type SMSMessage struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	CustomerID        *uint     `json:"customer_id,omitempty" gorm:"index"`
+	Direction         string    `json:"direction" gorm:"type:varchar(10);not null"`
+	Phone             string    `json:"phone" gorm:"not null;index"`
+	Body              string    `json:"body" gorm:"type:text"`
+	ProviderMessageID *string   `json:"provider_message_id,omitempty" gorm:"uniqueIndex"`
+	DryRun            bool      `json:"dry_run,omitempty" gorm:"not null;default:false"`
+	Encoding          string    `json:"encoding,omitempty" gorm:"type:varchar(10)"`
+	Segments          int       `json:"segments,omitempty"`
+	EstimatedCost     Money     `json:"estimated_cost,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// InboundSMSRequest is the form Africa's Talking posts for incoming messages
+type InboundSMSRequest struct {
+	From   string `form:"from" binding:"required"`
+	To     string `form:"to"`
+	Text   string `form:"text"`
+	ID     string `form:"id"`
+	LinkID string `form:"linkId"`
+	Date   string `form:"date"`
+}
+
+// FeatureFlag gates new behaviour without a redeploy. An enabled flag is on
+// for every subject in Subjects and for RolloutPercent of everyone else.
+type FeatureFlag struct {
+	ID             uint      `json:"-" gorm:"primaryKey"`
+	Key            string    `json:"key" gorm:"type:varchar(100);uniqueIndex;not null"`
+	Description    string    `json:"description" gorm:"type:text"`
+	Enabled        bool      `json:"enabled" gorm:"not null;default:false"`
+	RolloutPercent int       `json:"rollout_percent" gorm:"not null;default:0"`
+	Subjects       []string  `json:"subjects" gorm:"type:text;serializer:json"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+type UpdateFeatureFlagRequest struct {
+	Description    *string  `json:"description"`
+	Enabled        *bool    `json:"enabled"`
+	RolloutPercent *int     `json:"rollout_percent" binding:"omitempty,min=0,max=100"`
+	Subjects       []string `json:"subjects"`
+}
+
+const (
+	NotificationStatusSent   = "sent"
+	NotificationStatusFailed = "failed"
+)
+
+// NotificationRequestedBySystem marks attempts recorded by the service
+// itself rather than requested by a user
+const NotificationRequestedBySystem = "system"
+
+// NotificationAttempt records a manual resend of an order notification, or
+// an order confirmation that could not be sent
+type NotificationAttempt struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	OrderID     uint      `json:"order_id" gorm:"not null;index"`
+	Recipient   string    `json:"recipient" gorm:"not null"`
+	Status      string    `json:"status" gorm:"type:varchar(10);not null"`
+	Error       string    `json:"error,omitempty" gorm:"type:text"`
+	RequestedBy string    `json:"requested_by"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+type ResendNotificationRequest struct {
+	// Phone overrides the customer's number for this resend only
+	Phone string `json:"phone" binding:"omitempty,min=9,max=20,kenyan_phone"`
+}
+
+// Device platforms push notifications can be sent to
+const (
+	DevicePlatformAndroid = "android"
+	DevicePlatformIOS     = "ios"
+	DevicePlatformWeb     = "web"
+)
+
+// DeviceToken - an install of the mobile app that pushes to a customer are
+// sent to. A token belongs to the customer who registered it last.
+type DeviceToken struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CustomerID uint      `json:"customer_id" gorm:"not null;index"`
+	Token      string    `json:"token" gorm:"size:255;uniqueIndex;not null"`
+	Platform   string    `json:"platform" gorm:"type:varchar(10);not null"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type RegisterDeviceRequest struct {
+	Token    string `json:"token" binding:"required,max=255"`
+	Platform string `json:"platform" binding:"required,oneof=android ios web"`
+}
+
+const (
+	PushStatusPending   = "pending"
+	PushStatusDelivered = "delivered"
+	PushStatusFellBack  = "fell_back"
+	PushStatusFailed    = "failed"
+)
+
+// PushNotification - a notification pushed to a customer's devices. The
+// app acknowledges it when shown; one still pending after the fallback
+// delay is texted to the customer instead.
+type PushNotification struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	CustomerID  uint       `json:"customer_id" gorm:"not null;index"`
+	OrderID     *uint      `json:"order_id,omitempty" gorm:"index"`
+	Title       string     `json:"title" gorm:"not null"`
+	Body        string     `json:"body" gorm:"type:text;not null"`
+	Status      string     `json:"status" gorm:"type:varchar(10);not null;index"`
+	Error       string     `json:"error,omitempty" gorm:"type:text"`
+	SentAt      time.Time  `json:"sent_at" gorm:"index"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	FellBackAt  *time.Time `json:"fell_back_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CustomerExport is everything held about one customer, returned for data
+// access requests
+type CustomerExport struct {
+	Customer             Customer              `json:"customer"`
+	Orders               []Order               `json:"orders"`
+	ArchivedOrders       []ArchivedOrder       `json:"archived_orders"`
+	SMSMessages          []SMSMessage          `json:"sms_messages"`
+	NotificationAttempts []NotificationAttempt `json:"notification_attempts"`
+	Devices              []DeviceToken         `json:"devices"`
+	PushNotifications    []PushNotification    `json:"push_notifications"`
+	Notes                []CustomerNote        `json:"notes"`
+	CodeHistory          []CustomerCodeChange  `json:"code_history"`
+	ExportedAt           time.Time             `json:"exported_at"`
+}
+
+// CustomerNote records an interaction with a customer, such as the outcome
+// of a call. Pinned notes are listed first.
+type CustomerNote struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	CustomerID uint      `json:"customer_id" gorm:"not null;index"`
+	Author     string    `json:"author" gorm:"not null;index"`
+	Text       string    `json:"text" gorm:"type:text;not null"`
+	Pinned     bool      `json:"pinned" gorm:"not null;default:false"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type CreateCustomerNoteRequest struct {
+	Text   string `json:"text" binding:"required,max=5000"`
+	Pinned bool   `json:"pinned"`
+}
+
+type UpdateCustomerNoteRequest struct {
+	Text   *string `json:"text" binding:"omitempty,min=1,max=5000"`
+	Pinned *bool   `json:"pinned"`
+}
+
+// Rider - delivery rider that orders are assigned to
+type Rider struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name" gorm:"not null"`
+	Phone     string         `json:"phone" gorm:"uniqueIndex;not null"`
+	Active    bool           `json:"active" gorm:"not null;default:true"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Delivery assignment statuses. Assigned and picked up assignments are open
+// and make up the rider's manifest.
+const (
+	AssignmentStatusAssigned  = "assigned"
+	AssignmentStatusPickedUp  = "picked_up"
+	AssignmentStatusDelivered = "delivered"
+	AssignmentStatusFailed    = "failed"
+	AssignmentStatusCancelled = "cancelled"
+)
+
+// AssignmentOpenStatuses are the statuses of assignments still in progress
+var AssignmentOpenStatuses = []string{AssignmentStatusAssigned, AssignmentStatusPickedUp}
+
+// DeliveryAssignment records an order handed to a rider. An order has at
+// most one open assignment; reassigning cancels the previous one.
+type DeliveryAssignment struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	OrderID     uint       `json:"order_id" gorm:"not null;index"`
+	Order       *Order     `json:"order,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	RiderID     uint       `json:"rider_id" gorm:"not null;index"`
+	Rider       *Rider     `json:"rider,omitempty" gorm:"constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Status      string     `json:"status" gorm:"type:varchar(20);not null;default:assigned;index"`
+	AssignedBy  string     `json:"assigned_by"`
+	NotifiedAt  *time.Time `json:"notified_at,omitempty"`
+	PickedUpAt  *time.Time `json:"picked_up_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type CreateRiderRequest struct {
+	Name  string `json:"name" binding:"required"`
+	Phone string `json:"phone" binding:"required,min=9,max=20,kenyan_phone"`
+}
+
+type UpdateRiderRequest struct {
+	Name   string `json:"name"`
+	Phone  string `json:"phone" binding:"omitempty,min=9,max=20,kenyan_phone"`
+	Active *bool  `json:"active"`
+}
+
+type AssignOrderRequest struct {
+	RiderID uint `json:"rider_id" binding:"required"`
+}
+
+type UpdateAssignmentRequest struct {
+	Status string `json:"status" binding:"required,oneof=picked_up delivered failed cancelled"`
+}
+
+// Login methods
+const (
+	LoginMethodPassword = "password"
+	LoginMethodOIDC     = "oidc"
+)
+
+// UserIdentity links an account at an identity provider to the local user,
+// known by email, that signing in with it logs in as. The link is made on
+// the first login and kept when the provider's email changes, so admins
+// can point it at another user.
+type UserIdentity struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Provider string `json:"provider" gorm:"type:varchar(50);not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Subject  string `json:"subject" gorm:"type:varchar(255);not null;uniqueIndex:idx_user_identities_provider_subject"`
+	Email    string `json:"email" gorm:"not null;index"`
+	// ProviderEmail is what the provider last said the email was
+	ProviderEmail string    `json:"provider_email"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastLoginAt   time.Time `json:"last_login_at"`
+}
+
+// UpdateUserIdentityRequest points an identity at another local user
+type UpdateUserIdentityRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// Session is one issued access token. Its id is the token's jti claim, so
+// revoking the session rejects the token before it expires.
+type Session struct {
+	ID        string `json:"id" gorm:"primaryKey;type:varchar(32)"`
+	UserEmail string `json:"user_email" gorm:"not null;index"`
+	Subject   string `json:"subject"`
+	Method    string `json:"method" gorm:"type:varchar(10);not null"`
+	// Provider is the identity provider an OIDC login went through
+	Provider   string     `json:"provider,omitempty" gorm:"type:varchar(50)"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null;index"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// Current marks the session of the token making the request
+	Current bool `json:"current" gorm:"-"`
+}
+
+// Saga kinds
+const (
+	SagaKindOrderCreation = "order_creation"
+)
+
+// Saga statuses
+const (
+	SagaStatusRunning = "running"
+	// SagaStatusCompleted means every step succeeded
+	SagaStatusCompleted = "completed"
+	// SagaStatusPartiallyFailed means a non-critical step failed and was
+	// compensated on its own; the operation itself stands
+	SagaStatusPartiallyFailed = "partially_failed"
+	// SagaStatusCompensated means the operation was undone
+	SagaStatusCompensated = "compensated"
+	// SagaStatusFailed means a compensation failed and needs attention
+	SagaStatusFailed = "failed"
+)
+
+// Saga step statuses
+const (
+	SagaStepPending            = "pending"
+	SagaStepDone               = "done"
+	SagaStepFailed             = "failed"
+	SagaStepCompensated        = "compensated"
+	SagaStepCompensationFailed = "compensation_failed"
+)
+
+// OrderAnomaly flags an order whose amount is far above what its customer
+// usually spends. TypicalAmount is the median of the customer's earlier
+// orders and Ratio how many times it the order came to.
+type OrderAnomaly struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	OrderID       uint       `json:"order_id" gorm:"not null;uniqueIndex"`
+	CustomerID    uint       `json:"customer_id" gorm:"not null;index"`
+	Amount        Money      `json:"amount" gorm:"not null"`
+	TypicalAmount Money      `json:"typical_amount" gorm:"not null"`
+	Ratio         float64    `json:"ratio" gorm:"not null"`
+	AlertedAt     *time.Time `json:"alerted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"index"`
+}
+
+// Saga tracks the steps of an operation that spans more than one database
+// transaction or external call, such as creating an order and sending its
+// confirmation, so failures after the commit are compensated and visible
+type Saga struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Kind      string     `json:"kind" gorm:"type:varchar(30);not null;index"`
+	OrderID   uint       `json:"order_id" gorm:"not null;index"`
+	Status    string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	Steps     []SagaStep `json:"steps,omitempty"`
+	CreatedAt time.Time  `json:"created_at" gorm:"index"`
+	UpdatedAt time.Time  `json:"updated_at" gorm:"index"`
+}
+
+// SagaStep is one step of a saga, in the order the steps run
+type SagaStep struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	SagaID   uint   `json:"saga_id" gorm:"not null;index"`
+	Position int    `json:"position" gorm:"not null"`
+	Name     string `json:"name" gorm:"type:varchar(30);not null"`
+	// Critical steps must succeed for the operation to stand
+	Critical  bool      `json:"critical" gorm:"not null;default:false"`
+	Status    string    `json:"status" gorm:"type:varchar(20);not null"`
+	Error     string    `json:"error,omitempty" gorm:"type:text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BackfillRun tracks a batched backfill, so it resumes where it stopped
+// and its progress can be followed. Rows up to EndID, the last id when it
+// started, are backfilled; later rows are written in full already.
+type BackfillRun struct {
+	ID         uint       `json:"-" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"type:varchar(100);not null;uniqueIndex"`
+	Table      string     `json:"table" gorm:"column:table_name;type:varchar(64);not null"`
+	LastID     uint       `json:"last_id" gorm:"not null;default:0"`
+	EndID      uint       `json:"end_id" gorm:"not null;default:0"`
+	RowsDone   int64      `json:"rows_done" gorm:"not null;default:0"`
+	RowsTotal  int64      `json:"rows_total" gorm:"not null;default:0"`
+	Percent    float64    `json:"percent" gorm:"-"`
+	LastError  string     `json:"last_error,omitempty" gorm:"type:text"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Job run statuses
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// JobRun records one run of a background job. Trigger is "schedule" or
+// "manual", for runs started by an admin.
+type JobRun struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Job        string     `json:"job" gorm:"type:varchar(50);not null;index:idx_job_runs_job_started,priority:1"`
+	Trigger    string     `json:"trigger" gorm:"type:varchar(20);not null"`
+	Status     string     `json:"status" gorm:"type:varchar(20);not null;index"`
+	Error      string     `json:"error,omitempty" gorm:"type:text"`
+	StartedAt  time.Time  `json:"started_at" gorm:"not null;index:idx_job_runs_job_started,priority:2"`
+	FinishedAt *time.Time `json:"finished_at"`
+	DurationMs int64      `json:"duration_ms" gorm:"not null;default:0"`
+}
+
+// JobStatus describes a registered background job. NextRunAt is nil where
+// the job is not scheduled, and LastRun nil when it has never run.
+type JobStatus struct {
+	Name            string     `json:"name"`
+	IntervalSeconds int64      `json:"interval_seconds"`
+	Scheduled       bool       `json:"scheduled"`
+	Running         bool       `json:"running"`
+	NextRunAt       *time.Time `json:"next_run_at"`
+	LastRun         *JobRun    `json:"last_run"`
+}
+
+// Quote statuses. A held quote keeps its stock and price until it expires.
+const (
+	QuoteStatusHeld      = "held"
+	QuoteStatusConfirmed = "confirmed"
+	QuoteStatusCancelled = "cancelled"
+	QuoteStatusExpired   = "expired"
+)
+
+// Quote holds an item's stock and price for a customer for a while, so the
+// order it is confirmed into is billed exactly as quoted
+type Quote struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	CustomerID   uint       `json:"customer_id" gorm:"not null;index"`
+	ProductID    *uint      `json:"product_id,omitempty" gorm:"index"`
+	Item         string     `json:"item" gorm:"not null"`
+	Quantity     int        `json:"quantity" gorm:"not null;default:1"`
+	UnitPrice    Money      `json:"unit_price" gorm:"not null"`
+	Amount       Money      `json:"amount" gorm:"not null"`
+	TaxRate      float64    `json:"tax_rate" gorm:"not null;default:0"`
+	TaxInclusive bool       `json:"tax_inclusive" gorm:"not null;default:false"`
+	NetAmount    Money      `json:"net_amount" gorm:"not null;default:0"`
+	TaxAmount    Money      `json:"tax_amount" gorm:"not null;default:0"`
+	GrossAmount  Money      `json:"gross_amount" gorm:"not null;default:0"`
+	Priority     string     `json:"priority" gorm:"type:varchar(10);not null;default:normal"`
+	Status       string     `json:"status" gorm:"type:varchar(20);not null;default:held;index:idx_quotes_status_expiry"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null;index:idx_quotes_status_expiry"`
+	OrderID      *uint      `json:"order_id,omitempty" gorm:"index"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// CreateQuoteRequest prices a product from the catalog, or an item at the
+// given amount when there is no product
+type CreateQuoteRequest struct {
+	CustomerID uint   `json:"customer_id" binding:"required"`
+	ProductID  *uint  `json:"product_id"`
+	Item       string `json:"item"`
+	Amount     Money  `json:"amount" binding:"omitempty,gt=0,order_amount"`
+	Quantity   int    `json:"quantity" binding:"omitempty,min=1"`
+	Priority   string `json:"priority" binding:"omitempty,oneof=normal express"`
+	// HoldMinutes overrides how long the quote is held
+	HoldMinutes int `json:"hold_minutes" binding:"omitempty,min=1,max=1440"`
+}
+
+// APIKey lets a partner call the API without signing in. Only a hash of
+// the key is stored; Prefix identifies it in lists. A zero MonthlyQuota is
+// unlimited, as is a key without Scopes.
+type APIKey struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Name         string     `json:"name" gorm:"not null"`
+	Prefix       string     `json:"prefix" gorm:"type:varchar(16);not null"`
+	KeyHash      string     `json:"-" gorm:"type:varchar(64);not null;uniqueIndex"`
+	MonthlyQuota int64      `json:"monthly_quota" gorm:"not null;default:0"`
+	Scopes       []string   `json:"scopes,omitempty" gorm:"type:text;serializer:json"`
+	CreatedBy    string     `json:"created_by"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	// Key is only set in the response that creates it
+	Key string `json:"key,omitempty" gorm:"-"`
+}
+
+// CreateAPIKeyRequest issues a key for a partner
+type CreateAPIKeyRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	MonthlyQuota int64  `json:"monthly_quota" binding:"min=0"`
+	// Scopes limits the key, e.g. to orders:read for a reporting tool
+	Scopes []string `json:"scopes" binding:"omitempty,max=12,dive,oneof=customers:read customers:write orders:read orders:write products:read products:write riders:read riders:write reports:read reports:write admin:read admin:write"`
+}
+
+// APIUsage counts the requests made with an API key on one UTC day
+type APIUsage struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	APIKeyID  uint      `json:"api_key_id" gorm:"not null;uniqueIndex:idx_api_usages_key_day"`
+	Day       string    `json:"day" gorm:"type:varchar(10);not null;uniqueIndex:idx_api_usages_key_day"`
+	Requests  int64     `json:"requests" gorm:"not null;default:0"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// APIUsageReport - one API key's requests in a month, for billing
+type APIUsageReport struct {
+	APIKeyID     uint          `json:"api_key_id"`
+	Name         string        `json:"name"`
+	Prefix       string        `json:"prefix"`
+	Month        string        `json:"month"`
+	Requests     int64         `json:"requests"`
+	MonthlyQuota int64         `json:"monthly_quota"`
+	Days         []APIUsageDay `json:"days"`
+}
+
+type APIUsageDay struct {
+	Day      string `json:"day"`
+	Requests int64  `json:"requests"`
+}
+
+const (
+	PolicyAllow = "allow"
+	PolicyDeny  = "deny"
+
+	// PolicySourceConfig marks policies read from AUTHZ_POLICIES, which
+	// cannot be deleted through the API
+	PolicySourceConfig   = "config"
+	PolicySourceDatabase = "database"
+)
+
+// Policy allows or denies a role a route. Path is the route as registered,
+// e.g. /api/v1/customers/:id, or a prefix ending in *; Method and Role may
+// be * to match any.
+type Policy struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Role        string    `json:"role" gorm:"type:varchar(50);not null"`
+	Method      string    `json:"method" gorm:"type:varchar(10);not null"`
+	Path        string    `json:"path" gorm:"not null"`
+	Effect      string    `json:"effect" gorm:"type:varchar(10);not null"`
+	Description string    `json:"description" gorm:"type:text"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	Source      string    `json:"source" gorm:"-"`
+}
+
+type CreatePolicyRequest struct {
+	Role        string `json:"role" binding:"required,max=50"`
+	Method      string `json:"method" binding:"required,oneof=GET POST PUT PATCH DELETE *"`
+	Path        string `json:"path" binding:"required,startswith=/,max=191"`
+	Effect      string `json:"effect" binding:"required,oneof=allow deny"`
+	Description string `json:"description"`
+}
+
+// UserRole gives a user a role for policies. Users without one have the
+// user role.
+type UserRole struct {
+	ID        uint      `json:"-" gorm:"primaryKey"`
+	Email     string    `json:"email" gorm:"type:varchar(191);uniqueIndex;not null"`
+	Role      string    `json:"role" gorm:"type:varchar(50);not null"`
+	CreatedBy string    `json:"created_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required,max=50"`
+}
+
+// WinBackMessage is one attempt to text a customer who stopped ordering.
+// The first order the customer places within the reactivation window
+// after a sent message is recorded against it.
+type WinBackMessage struct {
+	ID         uint `json:"id" gorm:"primaryKey"`
+	CustomerID uint `json:"customer_id" gorm:"not null;index"`
+	// LastOrderAt is the customer's last order when the message was sent
+	LastOrderAt         time.Time  `json:"last_order_at"`
+	Sent                bool       `json:"sent" gorm:"not null;default:false"`
+	Error               string     `json:"error,omitempty" gorm:"type:text"`
+	SentAt              time.Time  `json:"sent_at" gorm:"not null;index"`
+	ReactivatedAt       *time.Time `json:"reactivated_at,omitempty"`
+	ReactivationOrderID *uint      `json:"reactivation_order_id,omitempty"`
+}
+
+// WinBackReport sums up the win-back messages sent in a period and lists
+// the customers who ordered again
+type WinBackReport struct {
+	MessagesSent     int64                 `json:"messages_sent"`
+	MessagesFailed   int64                 `json:"messages_failed"`
+	Reactivated      int64                 `json:"reactivated"`
+	ReactivationRate float64               `json:"reactivation_rate"`
+	Customers        []WinBackReactivation `json:"customers"`
+}
+
+type WinBackReactivation struct {
+	CustomerID    uint      `json:"customer_id"`
+	Name          string    `json:"name"`
+	Code          string    `json:"code"`
+	LastOrderAt   time.Time `json:"last_order_at"`
+	SentAt        time.Time `json:"sent_at"`
+	ReactivatedAt time.Time `json:"reactivated_at"`
+	OrderID       uint      `json:"order_id"`
+	Amount        Money     `json:"amount"`
+}
+
+// Greeting campaigns, each texting customers on a yearly date
+const (
+	GreetingBirthday    = "birthday"
+	GreetingAnniversary = "anniversary"
+)
+
+// GreetingMessage records one attempt to text a customer a greeting. A
+// customer is greeted once per campaign on each Day, and a failed message
+// is tried again by later runs that day.
+type GreetingMessage struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	CustomerID uint   `json:"customer_id" gorm:"not null;index:idx_greeting_messages_day"`
+	Campaign   string `json:"campaign" gorm:"type:varchar(20);not null;index:idx_greeting_messages_day"`
+	// Day is the date greeted, in the campaign's time zone
+	Day    Date      `json:"day" gorm:"type:varchar(10);not null;index:idx_greeting_messages_day"`
+	Sent   bool      `json:"sent" gorm:"not null;default:false"`
+	Error  string    `json:"error,omitempty" gorm:"type:text"`
+	SentAt time.Time `json:"sent_at" gorm:"not null"`
+}
+
+// Order digest statuses. A digest is sending while its email is out; one
+// that failed is tried again by the next scheduled run.
+const (
+	DigestSending = "sending"
+	DigestSent    = "sent"
+	DigestFailed  = "failed"
+)
+
+// OrderDigest is the summary of a day's orders and text messages emailed
+// to admins, kept so past digests can be looked at again. ScheduleKey is
+// the day for digests sent by the daily job, so each day is only sent once
+// however many instances run it, and nil for those sent on demand.
+type OrderDigest struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	Day         string  `json:"day" gorm:"type:varchar(10);not null;index"`
+	ScheduleKey *string `json:"-" gorm:"type:varchar(10);uniqueIndex"`
+	Trigger     string  `json:"trigger" gorm:"type:varchar(20);not null"`
+	Status      string  `json:"status" gorm:"type:varchar(20);not null"`
+	Error       string  `json:"error,omitempty" gorm:"type:text"`
+	// Recipients are the addresses the digest was emailed to
+	Recipients []string `json:"recipients" gorm:"serializer:json"`
+	CreatedBy  string   `json:"created_by,omitempty"`
+
+	OrdersCount    int64 `json:"orders_count"`
+	CancelledCount int64 `json:"cancelled_count"`
+	// Revenue leaves out cancelled orders
+	Revenue     Money `json:"revenue"`
+	SMSSent     int64 `json:"sms_sent"`
+	SMSReceived int64 `json:"sms_received"`
+	SMSSegments int64 `json:"sms_segments"`
+	SMSCost     Money `json:"sms_cost"`
+	// Orders are the day's orders as they were when the digest was made.
+	// They are left out of lists.
+	Orders []DigestOrder `json:"orders,omitempty" gorm:"serializer:json"`
+
+	CreatedAt time.Time  `json:"created_at"`
+	SentAt    *time.Time `json:"sent_at,omitempty"`
+}
+
+// DigestOrder is one order in a digest
+type DigestOrder struct {
+	ID         uint      `json:"id"`
+	Time       time.Time `json:"time"`
+	CustomerID uint      `json:"customer_id"`
+	Item       string    `json:"item"`
+	Quantity   int       `json:"quantity"`
+	Amount     Money     `json:"amount"`
+	Status     string    `json:"status"`
+}
+
+// SendDigestRequest sends the digest of Day, yesterday by default, to
+// Recipients, by default those configured
+type SendDigestRequest struct {
+	Day        string   `json:"day" binding:"omitempty,datetime=2006-01-02"`
+	Recipients []string `json:"recipients" binding:"omitempty,max=20,dive,email"`
+}
+
+// WebhookSubscription sends order events to a consumer's URL, in the order
+// they happened, starting from those recorded after it was created.
+// Deliveries are signed with Secret; after a rotation PreviousSecret signs
+// them as well until PreviousSecretExpiresAt, so the consumer can switch
+// over without turning any away. Secrets are encrypted like personal data.
+type WebhookSubscription struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	URL         string `json:"url" gorm:"type:text;not null"`
+	Description string `json:"description,omitempty"`
+	// Events are the order event types sent, all of them when empty
+	Events []string `json:"events,omitempty" gorm:"type:text;serializer:json"`
+	Active bool     `json:"active" gorm:"not null;default:true"`
+
+	Secret                  string     `json:"-" gorm:"type:text;not null;serializer:pii"`
+	PreviousSecret          string     `json:"-" gorm:"type:text;serializer:pii"`
+	PreviousSecretExpiresAt *time.Time `json:"previous_secret_expires_at,omitempty"`
+	SecretRotatedAt         *time.Time `json:"secret_rotated_at,omitempty"`
+
+	// LastEventID is the last order event delivered, or passed over for
+	// not being in Events
+	LastEventID     uint       `json:"last_event_id" gorm:"not null;default:0"`
+	LastDeliveredAt *time.Time `json:"last_delivered_at,omitempty"`
+	// Failures counts the failed attempts since the last delivery; the
+	// next is not made before NextAttemptAt
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// SigningSecret is only set in the responses that create or rotate it
+	SigningSecret string `json:"signing_secret,omitempty" gorm:"-"`
+}
+
+// CreateWebhookSubscriptionRequest subscribes a URL to order events
+type CreateWebhookSubscriptionRequest struct {
+	URL         string   `json:"url" binding:"required,url,startswith=https://,max=2000"`
+	Description string   `json:"description" binding:"max=200"`
+	Events      []string `json:"events" binding:"omitempty,max=20,dive,oneof=order.created order.item_changed order.amount_changed order.time_changed order.status_changed order.delivery_estimated order.delivery_instructions_changed order.cancelled order.deleted"`
+}
+
+// UpdateWebhookSubscriptionRequest changes the fields it sets. Events set
+// to [] sends every event type.
+type UpdateWebhookSubscriptionRequest struct {
+	URL         *string   `json:"url,omitempty" binding:"omitempty,url,startswith=https://,max=2000"`
+	Description *string   `json:"description,omitempty" binding:"omitempty,max=200"`
+	Events      *[]string `json:"events,omitempty" binding:"omitempty,max=20,dive,oneof=order.created order.item_changed order.amount_changed order.time_changed order.status_changed order.delivery_estimated order.delivery_instructions_changed order.cancelled order.deleted"`
+	// Active set to true again retries a failing subscription right away
+	Active *bool `json:"active,omitempty"`
+}
+
+// RotateWebhookSecretRequest replaces a subscription's signing secret. The
+// old one keeps signing deliveries for GracePeriodMinutes, 24 hours when
+// left out; 0 stops it at once, e.g. after it leaked.
+type RotateWebhookSecretRequest struct {
+	GracePeriodMinutes *int `json:"grace_period_minutes" binding:"omitempty,min=0,max=10080"`
+}
+
+// CustomerTag puts a customer in a segment, such as vip, that can be synced
+// to a marketing platform
+type CustomerTag struct {
+	CustomerID uint      `json:"customer_id" gorm:"primaryKey;autoIncrement:false"`
+	Tag        string    `json:"tag" gorm:"primaryKey;type:varchar(50);index"`
+	CreatedBy  string    `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// TagCustomerRequest adds tags to a customer; tags it already has are kept
+type TagCustomerRequest struct {
+	Tags []string `json:"tags" binding:"required,min=1,max=20,dive,segment_tag"`
+}
+
+// The marketing platforms segments can be synced to
+const (
+	MarketingPlatformMailchimp  = "mailchimp"
+	MarketingPlatformCustomerIO = "customerio"
+)
+
+// The outcome of a segment sync's last run
+const (
+	SegmentSyncSucceeded = "succeeded"
+	SegmentSyncFailed    = "failed"
+)
+
+// SegmentSync keeps the customers tagged Tag in a segment on a marketing
+// platform: added when tagged, updated when they change and removed when
+// untagged, deleted or anonymized. On Mailchimp the segment is the tag
+// Segment in the audience Audience; on Customer.io it is the customer
+// attribute Segment, set to true, which a data-driven segment can filter
+// on. Fields maps the platform's field names to customer fields.
+type SegmentSync struct {
+	ID       uint              `json:"id" gorm:"primaryKey"`
+	Tag      string            `json:"tag" gorm:"type:varchar(50);not null;index"`
+	Platform string            `json:"platform" gorm:"type:varchar(20);not null"`
+	Audience string            `json:"audience,omitempty"`
+	Segment  string            `json:"segment" gorm:"not null"`
+	Fields   map[string]string `json:"fields,omitempty" gorm:"type:text;serializer:json"`
+	Active   bool              `json:"active" gorm:"not null;default:true"`
+
+	// Members is how many customers are in the segment on the platform
+	Members       int        `json:"members" gorm:"not null;default:0"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastStatus    string     `json:"last_status,omitempty" gorm:"type:varchar(20)"`
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	// LastAdded, LastUpdated and LastRemoved count the customers the last
+	// run changed on the platform, and LastSkipped those it could not
+	// send, such as customers without an email on Mailchimp
+	LastAdded   int `json:"last_added"`
+	LastUpdated int `json:"last_updated"`
+	LastRemoved int `json:"last_removed"`
+	LastSkipped int `json:"last_skipped"`
+
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SegmentSyncMember is a customer a segment sync put on the platform, as
+// they were sent, so changes are sent again and removals reach the
+// contact the platform knows
+type SegmentSyncMember struct {
+	SyncID     uint `gorm:"primaryKey;autoIncrement:false"`
+	CustomerID uint `gorm:"primaryKey;autoIncrement:false"`
+	// Email is the address the customer was sent with
+	Email             string `gorm:"type:text;serializer:pii"`
+	OptedOut          bool   `gorm:"not null;default:false"`
+	CustomerUpdatedAt time.Time
+	SyncedAt          time.Time
+}
+
+// CreateSegmentSyncRequest syncs the customers tagged Tag to a platform.
+// Segment defaults to the tag; Fields to the platform's usual names for a
+// customer's name and phone.
+type CreateSegmentSyncRequest struct {
+	Tag      string            `json:"tag" binding:"required,segment_tag"`
+	Platform string            `json:"platform" binding:"required,oneof=mailchimp customerio"`
+	Audience string            `json:"audience" binding:"required_if=Platform mailchimp,max=100"`
+	Segment  string            `json:"segment" binding:"max=100"`
+	Fields   map[string]string `json:"fields" binding:"max=20,dive,keys,min=1,max=100,endkeys,oneof=name first_name last_name code phone email created_at last_order_at"`
+}
+
+// UpdateSegmentSyncRequest changes the fields it sets. Changing Fields
+// sends every member again. Where a sync puts its customers can't change;
+// create another sync instead.
+type UpdateSegmentSyncRequest struct {
+	Fields *map[string]string `json:"fields,omitempty" binding:"omitempty,max=20,dive,keys,min=1,max=100,endkeys,oneof=name first_name last_name code phone email created_at last_order_at"`
+	Active *bool              `json:"active,omitempty"`
+}
+
+// Campaign statuses. A scheduled campaign has its recipients listed when
+// SendAt comes, and is sending until every one of them is done.
+const (
+	CampaignScheduled = "scheduled"
+	CampaignSending   = "sending"
+	CampaignCompleted = "completed"
+	CampaignCancelled = "cancelled"
+)
+
+// Campaign texts Message to the customers with any of Tags, from SendAt.
+// The message may use {name}, {first_name} and {code}.
+type Campaign struct {
+	ID      uint      `json:"id" gorm:"primaryKey"`
+	Name    string    `json:"name" gorm:"not null"`
+	Message string    `json:"message" gorm:"type:text;not null"`
+	Tags    []string  `json:"tags" gorm:"type:text;serializer:json"`
+	SendAt  time.Time `json:"send_at" gorm:"not null;index"`
+	Status  string    `json:"status" gorm:"type:varchar(20);not null;index"`
+	// Recipients is how many customers the campaign was sent to, once
+	// they are listed
+	Recipients  int        `json:"recipients" gorm:"not null;default:0"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	CreatedBy   string     `json:"created_by"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Stats *CampaignStats `json:"stats,omitempty" gorm:"-"`
+}
+
+// Campaign recipient statuses. A sent message is delivered or failed once
+// the provider's delivery report comes in; skipped recipients opted out or
+// were gone by the time their turn came.
+const (
+	CampaignRecipientPending   = "pending"
+	CampaignRecipientSent      = "sent"
+	CampaignRecipientDelivered = "delivered"
+	CampaignRecipientFailed    = "failed"
+	CampaignRecipientSkipped   = "skipped"
+)
+
+// CampaignRecipient is a customer a campaign texts, and how that went
+type CampaignRecipient struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	CampaignID uint   `json:"campaign_id" gorm:"not null;uniqueIndex:idx_campaign_recipients_customer;index:idx_campaign_recipients_status"`
+	CustomerID uint   `json:"customer_id" gorm:"not null;uniqueIndex:idx_campaign_recipients_customer"`
+	Status     string `json:"status" gorm:"type:varchar(20);not null;index:idx_campaign_recipients_status"`
+	// ProviderMessageID matches delivery reports to the message
+	ProviderMessageID *string    `json:"provider_message_id,omitempty" gorm:"uniqueIndex"`
+	Error             string     `json:"error,omitempty" gorm:"type:text"`
+	SentAt            *time.Time `json:"sent_at,omitempty" gorm:"index"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// CampaignStats counts a campaign's recipients by status
+type CampaignStats struct {
+	Pending   int64 `json:"pending"`
+	Sent      int64 `json:"sent"`
+	Delivered int64 `json:"delivered"`
+	Failed    int64 `json:"failed"`
+	Skipped   int64 `json:"skipped"`
+}
+
+// CreateCampaignRequest schedules a campaign to the customers with any of
+// Tags. Without SendAt it goes out on the next run.
+type CreateCampaignRequest struct {
+	Name    string     `json:"name" binding:"required,max=100"`
+	Message string     `json:"message" binding:"required,max=1000"`
+	Tags    []string   `json:"tags" binding:"required,min=1,max=20,dive,segment_tag"`
+	SendAt  *time.Time `json:"send_at,omitempty"`
+}
+
+// SMSDeliveryReportRequest is the form Africa's Talking posts when a sent
+// message is delivered or fails
+type SMSDeliveryReportRequest struct {
+	ID            string `form:"id" binding:"required"`
+	Status        string `form:"status" binding:"required"`
+	PhoneNumber   string `form:"phoneNumber"`
+	NetworkCode   string `form:"networkCode"`
+	FailureReason string `form:"failureReason"`
+	RetryCount    int    `form:"retryCount"`
+}
+
+// Promo code discount types
+const (
+	PromoCodePercentage = "percentage"
+	PromoCodeFixed      = "fixed"
+)
+
+// PromoCode takes PercentOff percent, or AmountOff, off the amount of
+// orders placed with it between StartsAt and EndsAt. MaxRedemptions and
+// MaxPerCustomer limit how many orders may use it in all and per customer,
+// with 0 for no limit. Codes are kept in upper case; a deleted code keeps
+// its name, so orders placed with it never refer to another code.
+type PromoCode struct {
+	ID          uint    `json:"id" gorm:"primaryKey"`
+	Code        string  `json:"code" gorm:"type:varchar(32);not null;uniqueIndex"`
+	Description string  `json:"description,omitempty"`
+	Type        string  `json:"type" gorm:"type:varchar(20);not null"`
+	PercentOff  float64 `json:"percent_off,omitempty" gorm:"not null;default:0"`
+	AmountOff   Money   `json:"amount_off,omitempty" gorm:"not null;default:0"`
+	// MinAmount is the smallest order amount the code applies to
+	MinAmount      Money      `json:"min_amount,omitempty" gorm:"not null;default:0"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxRedemptions int        `json:"max_redemptions,omitempty" gorm:"not null;default:0"`
+	MaxPerCustomer int        `json:"max_per_customer,omitempty" gorm:"not null;default:0"`
+	// Redemptions is how many orders have used the code
+	Redemptions int            `json:"redemptions" gorm:"not null;default:0"`
+	Active      bool           `json:"active" gorm:"not null;default:true"`
+	CreatedBy   string         `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// PromoRedemption records an order placed with a promo code and what the
+// code took off it
+type PromoRedemption struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	PromoCodeID uint      `json:"promo_code_id" gorm:"not null;index:idx_promo_redemptions_customer"`
+	CustomerID  uint      `json:"customer_id" gorm:"not null;index:idx_promo_redemptions_customer"`
+	OrderID     uint      `json:"order_id" gorm:"not null;uniqueIndex"`
+	Discount    Money     `json:"discount" gorm:"not null"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// CreatePromoCodeRequest adds a promo code. PercentOff is required for
+// percentage codes and AmountOff for fixed ones.
+type CreatePromoCodeRequest struct {
+	Code           string     `json:"code" binding:"required,promo_code"`
+	Description    string     `json:"description" binding:"max=200"`
+	Type           string     `json:"type" binding:"required,oneof=percentage fixed"`
+	PercentOff     float64    `json:"percent_off" binding:"required_if=Type percentage,min=0,max=100"`
+	AmountOff      Money      `json:"amount_off" binding:"required_if=Type fixed,min=0,order_amount"`
+	MinAmount      Money      `json:"min_amount" binding:"min=0,order_amount"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxRedemptions int        `json:"max_redemptions" binding:"min=0"`
+	MaxPerCustomer int        `json:"max_per_customer" binding:"min=0"`
 }
 
-type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+// UpdatePromoCodeRequest changes the fields it sets. What a code takes off
+// can't change once customers may have used it; create another code
+// instead.
+type UpdatePromoCodeRequest struct {
+	Description    *string    `json:"description,omitempty" binding:"omitempty,max=200"`
+	MinAmount      *Money     `json:"min_amount,omitempty" binding:"omitempty,min=0,order_amount"`
+	StartsAt       *time.Time `json:"starts_at,omitempty"`
+	EndsAt         *time.Time `json:"ends_at,omitempty"`
+	MaxRedemptions *int       `json:"max_redemptions,omitempty" binding:"omitempty,min=0"`
+	MaxPerCustomer *int       `json:"max_per_customer,omitempty" binding:"omitempty,min=0"`
+	Active         *bool      `json:"active,omitempty"`
 }
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in cents, so sums, splits and tax come out exact where
+// float64 shillings drifted to values like 1499.9999999. In JSON it is a
+// number of shillings with at most two decimals, as amounts always were;
+// in the database it is a BIGINT of cents.
+type Money int64
+
+// Shillings converts an amount in shillings, rounding to the nearest cent
+func Shillings(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// Float returns the amount in shillings, for ratios and display only
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// Times multiplies the amount by a whole quantity
+func (m Money) Times(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Scale multiplies the amount by factor, rounding to the nearest cent
+func (m Money) Scale(factor float64) Money {
+	return Money(math.Round(float64(m) * factor))
+}
+
+// String writes the amount in shillings with two decimals, e.g. 1499.90
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// MarshalJSON writes the shortest exact number of shillings, so 1500 stays
+// 1500 and 1499.90 is 1499.9
+func (m Money) MarshalJSON() ([]byte, error) {
+	s := m.String()
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	return []byte(s), nil
+}
+
+var errMoneyPrecision = errors.New("amounts may have at most two decimal places")
+
+// moneyPattern is a plain decimal number, with an optional leading minus
+// and never an exponent or a ratio such as 3/2
+var moneyPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// UnmarshalJSON reads a number of shillings, or a string holding one, and
+// refuses fractions of a cent rather than rounding them away
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	s = strings.TrimSpace(s)
+	if !moneyPattern.MatchString(s) {
+		return fmt.Errorf("invalid amount %s", data)
+	}
+	digits, negative := strings.CutPrefix(s, "-")
+	whole, fraction, _ := strings.Cut(digits, ".")
+	if len(fraction) > 2 {
+		return errMoneyPrecision
+	}
+	cents, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", 2-len(fraction)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("amount %s is too large", data)
+	}
+	if negative {
+		cents = -cents
+	}
+	*m = Money(cents)
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
+
+// Scan reads cents. Aggregates such as SUM and AVG may come back as
+// decimals or floats, which are rounded to the nearest cent.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case int64:
+		*m = Money(v)
+	case float64:
+		*m = Money(math.Round(v))
+	case []byte:
+		return m.scanText(string(v))
+	case string:
+		return m.scanText(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanText(s string) error {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*m = Money(n)
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("cannot scan %q into Money: %w", s, err)
+	}
+	*m = Money(math.Round(f))
+	return nil
+}
+
+// GormDataType stores amounts as whole cents
+func (Money) GormDataType() string {
+	return "bigint"
+}
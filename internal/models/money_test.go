@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      Money
+		output        string
+		expectedError string
+	}{
+		{name: "whole shillings", input: "1500", expected: 150000, output: "1500"},
+		{name: "cents", input: "1499.90", expected: 149990, output: "1499.9"},
+		{name: "string", input: `"99.99"`, expected: 9999, output: "99.99"},
+		{name: "negative", input: "-0.5", expected: -50, output: "-0.5"},
+		{name: "exponent", input: "1.5e3", expectedError: "invalid amount"},
+		{name: "fraction of a cent", input: "0.001", expectedError: "at most two decimal places"},
+		{name: "trailing zero past the cents", input: "1.230", expectedError: "at most two decimal places"},
+		{name: "ratio", input: `"3/2"`, expectedError: "invalid amount"},
+		{name: "plus sign", input: `"+5"`, expectedError: "invalid amount"},
+		{name: "too large", input: "99999999999999999999", expectedError: "too large"},
+		{name: "not a number", input: `"lots"`, expectedError: "invalid amount"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var amount Money
+			err := json.Unmarshal([]byte(tt.input), &amount)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, amount)
+
+			data, err := json.Marshal(amount)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.output, string(data))
+		})
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	// 0.1 + 0.2 shillings is 0.30000000000000004 as float64
+	assert.Equal(t, "0.30", (Shillings(0.1) + Shillings(0.2)).String())
+	assert.Equal(t, Money(449997), Shillings(1499.99).Times(3))
+	assert.Equal(t, Money(33333), Shillings(1000).Scale(1.0/3))
+	assert.Equal(t, "-12.05", Money(-1205).String())
+	assert.Equal(t, 1499.9, Money(149990).Float())
+}
+
+func TestMoneyScan(t *testing.T) {
+	var amount Money
+	for _, src := range []interface{}{int64(149990), float64(149990.4), []byte("149990"), "149989.6"} {
+		assert.NoError(t, amount.Scan(src))
+		assert.Equal(t, Money(149990), amount, "%T", src)
+	}
+	assert.NoError(t, amount.Scan(nil))
+	assert.Equal(t, Money(0), amount)
+	assert.Error(t, amount.Scan(true))
+}
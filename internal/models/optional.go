@@ -0,0 +1,52 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Optional is a request field that can be left out, set, or cleared with
+// null, where a pointer alone can't tell leaving it out from clearing it.
+// Tag it omitzero so a request that leaves it out is sent without it.
+type Optional[T any] struct {
+	// Set is whether the field was in the request at all
+	Set bool
+	// Value is nil when the field was null
+	Value *T
+}
+
+// Some sets an Optional to value
+func Some[T any](value T) Optional[T] {
+	return Optional[T]{Set: true, Value: &value}
+}
+
+// Null clears the field an Optional is sent for
+func Null[T any]() Optional[T] {
+	return Optional[T]{Set: true}
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Value = nil
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+func (o Optional[T]) MarshalJSON() ([]byte, error) {
+	if o.Value == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(*o.Value)
+}
+
+// IsZero reports a field left out, for omitzero
+func (o Optional[T]) IsZero() bool {
+	return !o.Set
+}
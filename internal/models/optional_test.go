@@ -0,0 +1,41 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOptional(t *testing.T) {
+	type request struct {
+		Note Optional[string] `json:"note,omitzero"`
+	}
+
+	tests := []struct {
+		name     string
+		body     string
+		expected Optional[string]
+	}{
+		{name: "left out", body: `{}`, expected: Optional[string]{}},
+		{name: "null", body: `{"note": null}`, expected: Null[string]()},
+		{name: "set", body: `{"note": "hi"}`, expected: Some("hi")},
+		{name: "set to empty", body: `{"note": ""}`, expected: Some("")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req request
+			assert.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			assert.Equal(t, tt.expected, req.Note)
+
+			// sent again as it was received
+			body, err := json.Marshal(req)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.body, string(body))
+		})
+	}
+
+	var req request
+	assert.Error(t, json.Unmarshal([]byte(`{"note": 5}`), &req))
+}
@@ -0,0 +1,254 @@
+// Package pii encrypts personal data, such as customer phone numbers and
+// emails, before it is written to the database, so backups never hold it in
+// plain text.
+//
+// Values are sealed with AES-256-GCM under the primary key of a Keyring and
+// stored as "enc:v1:<key id>:<base64 nonce+ciphertext>". Older keys stay in
+// the keyring to open values written before a rotation. Since ciphertexts
+// differ every time, lookups and unique constraints use BlindIndex instead.
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+
+	"gorm.io/gorm/schema"
+)
+
+const prefix = "enc:v1:"
+
+var (
+	ErrUnknownKey = errors.New("pii: value was encrypted with an unknown key")
+	ErrNoKeyring  = errors.New("pii: value is encrypted but no keys are configured")
+	ErrMalformed  = errors.New("pii: malformed encrypted value")
+)
+
+// Keyring holds the keys values are encrypted with. New values use the
+// primary key; the others only decrypt.
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+	hashKey []byte
+}
+
+// NewKeyring builds a keyring from 32 byte AES keys by id. hashKey keys
+// BlindIndex and is not rotated with the encryption keys.
+func NewKeyring(primary string, keys map[string][]byte, hashKey []byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("pii: primary key %q is not in the keyring", primary)
+	}
+	if len(hashKey) < 32 {
+		return nil, errors.New("pii: hash key must be at least 32 bytes")
+	}
+
+	k := &Keyring{primary: primary, aeads: map[string]cipher.AEAD{}, hashKey: hashKey}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("pii: invalid key id %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("pii: key %q must be 32 bytes, got %d", id, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// KeyringFromEnv reads PII_ENCRYPTION_KEYS, a comma separated list of
+// id:base64-key pairs with the primary key first, and PII_HASH_KEY. It
+// returns nil when no keys are set.
+func KeyringFromEnv() (*Keyring, error) {
+	list := strings.TrimSpace(os.Getenv("PII_ENCRYPTION_KEYS"))
+	if list == "" {
+		return nil, nil
+	}
+
+	var primary string
+	keys := map[string][]byte{}
+	for _, entry := range strings.Split(list, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(entry), ":")
+		if !ok {
+			return nil, fmt.Errorf("pii: PII_ENCRYPTION_KEYS entry %q is not id:key", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("pii: key %q is not valid base64: %w", id, err)
+		}
+		if primary == "" {
+			primary = id
+		}
+		keys[id] = key
+	}
+
+	hashKey, err := base64.StdEncoding.DecodeString(os.Getenv("PII_HASH_KEY"))
+	if err != nil {
+		return nil, fmt.Errorf("pii: PII_HASH_KEY is not valid base64: %w", err)
+	}
+	return NewKeyring(primary, keys, hashKey)
+}
+
+// Primary is the id of the key new values are encrypted with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// Encrypt seals plaintext under the primary key. Empty values stay empty.
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("pii: failed to generate nonce: %w", err)
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.primary))
+	return prefix + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value written by Encrypt with whichever key sealed it.
+// Values that are not encrypted, such as rows from before encryption was
+// enabled, are returned as they are.
+func (k *Keyring) Decrypt(value string) (string, error) {
+	id, sealed, ok := parse(value)
+	if !ok {
+		return value, nil
+	}
+	if k == nil {
+		return "", ErrNoKeyring
+	}
+
+	aead, ok := k.aeads[id]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(raw) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, raw[:aead.NonceSize()], raw[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("pii: failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Prefix is how every value sealed under the primary key starts
+func (k *Keyring) Prefix() string {
+	return prefix + k.primary + ":"
+}
+
+// NeedsRotation reports whether a stored value is plain text or sealed with
+// a key other than the primary one
+func (k *Keyring) NeedsRotation(value string) bool {
+	if value == "" {
+		return false
+	}
+	return !strings.HasPrefix(value, k.Prefix())
+}
+
+// IsEncrypted reports whether a stored value was written by Encrypt
+func IsEncrypted(value string) bool {
+	_, _, ok := parse(value)
+	return ok
+}
+
+func parse(value string) (id, sealed string, ok bool) {
+	rest, ok := strings.CutPrefix(value, prefix)
+	if !ok {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
+
+var current atomic.Pointer[Keyring]
+
+// SetKeyring sets the keys the "pii" serializer uses. With none, values are
+// written in plain text.
+func SetKeyring(k *Keyring) {
+	current.Store(k)
+}
+
+// Current returns the keyring set with SetKeyring, or nil
+func Current() *Keyring {
+	return current.Load()
+}
+
+// BlindIndex is a keyed hash of value for equality lookups and unique
+// indexes on encrypted columns. Without a keyring it falls back to an
+// unkeyed SHA-256 so lookups keep working in development.
+func BlindIndex(value string) string {
+	var sum []byte
+	if k := Current(); k != nil {
+		mac := hmac.New(sha256.New, k.hashKey)
+		mac.Write([]byte(value))
+		sum = mac.Sum(nil)
+	} else {
+		s := sha256.Sum256([]byte(value))
+		sum = s[:]
+	}
+	return hex.EncodeToString(sum)
+}
+
+func init() {
+	schema.RegisterSerializer("pii", Serializer{})
+}
+
+// Serializer encrypts string fields tagged `gorm:"serializer:pii"` on write
+// and decrypts them on read
+type Serializer struct{}
+
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	var stored string
+	switch v := dbValue.(type) {
+	case nil:
+	case string:
+		stored = v
+	case []byte:
+		stored = string(v)
+	default:
+		return fmt.Errorf("pii: unsupported value %T for %s", dbValue, field.Name)
+	}
+
+	plaintext, err := Current().Decrypt(stored)
+	if err != nil {
+		return err
+	}
+	return field.Set(ctx, dst, plaintext)
+}
+
+func (Serializer) Value(_ context.Context, field *schema.Field, _ reflect.Value, fieldValue interface{}) (interface{}, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("pii: field %s must be a string", field.Name)
+	}
+
+	k := Current()
+	if k == nil {
+		return plaintext, nil
+	}
+	return k.Encrypt(plaintext)
+}
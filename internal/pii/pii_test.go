@@ -0,0 +1,125 @@
+package pii
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestKeyringEncryptDecrypt(t *testing.T) {
+	keyring, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, testKey(9))
+	assert.NoError(t, err)
+
+	sealed, err := keyring.Encrypt("+254740827150")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "enc:v1:k1:"))
+	assert.NotContains(t, sealed, "740827150")
+
+	again, _ := keyring.Encrypt("+254740827150")
+	assert.NotEqual(t, sealed, again, "each value gets its own nonce")
+
+	plaintext, err := keyring.Decrypt(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "+254740827150", plaintext)
+
+	empty, err := keyring.Encrypt("")
+	assert.NoError(t, err)
+	assert.Empty(t, empty)
+
+	plaintext, err = keyring.Decrypt("legacy@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "legacy@example.com", plaintext, "plain text rows read as they are")
+
+	tampered := sealed[:len(sealed)-4] + "AAAA"
+	_, err = keyring.Decrypt(tampered)
+	assert.Error(t, err)
+
+	_, err = keyring.Decrypt("enc:v1:k9:" + strings.TrimPrefix(sealed, "enc:v1:k1:"))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	var none *Keyring
+	_, err = none.Decrypt(sealed)
+	assert.ErrorIs(t, err, ErrNoKeyring)
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, testKey(9))
+	assert.NoError(t, err)
+	sealed, _ := old.Encrypt("sebbievilar2@gmail.com")
+
+	rotated, err := NewKeyring("k2", map[string][]byte{"k1": testKey(1), "k2": testKey(2)}, testKey(9))
+	assert.NoError(t, err)
+
+	plaintext, err := rotated.Decrypt(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "sebbievilar2@gmail.com", plaintext)
+
+	assert.True(t, rotated.NeedsRotation(sealed))
+	assert.True(t, rotated.NeedsRotation("plain"))
+	assert.False(t, rotated.NeedsRotation(""))
+
+	resealed, _ := rotated.Encrypt(plaintext)
+	assert.False(t, rotated.NeedsRotation(resealed))
+	assert.True(t, IsEncrypted(resealed))
+}
+
+func TestNewKeyringValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		keys    map[string][]byte
+		hashKey []byte
+	}{
+		{name: "missing primary", primary: "k2", keys: map[string][]byte{"k1": testKey(1)}, hashKey: testKey(9)},
+		{name: "short key", primary: "k1", keys: map[string][]byte{"k1": testKey(1)[:16]}, hashKey: testKey(9)},
+		{name: "short hash key", primary: "k1", keys: map[string][]byte{"k1": testKey(1)}, hashKey: testKey(9)[:8]},
+		{name: "colon in id", primary: "k:1", keys: map[string][]byte{"k:1": testKey(1)}, hashKey: testKey(9)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKeyring(tt.primary, tt.keys, tt.hashKey)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestKeyringFromEnv(t *testing.T) {
+	t.Setenv("PII_ENCRYPTION_KEYS", "")
+	keyring, err := KeyringFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, keyring)
+
+	encode := base64.StdEncoding.EncodeToString
+	t.Setenv("PII_ENCRYPTION_KEYS", "2025b:"+encode(testKey(2))+", 2025a:"+encode(testKey(1)))
+	t.Setenv("PII_HASH_KEY", encode(testKey(9)))
+	keyring, err = KeyringFromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, "2025b", keyring.Primary())
+
+	t.Setenv("PII_HASH_KEY", "")
+	_, err = KeyringFromEnv()
+	assert.Error(t, err, "a hash key is required with encryption keys")
+}
+
+func TestBlindIndex(t *testing.T) {
+	t.Cleanup(func() { SetKeyring(nil) })
+
+	unkeyed := BlindIndex("+254740827150")
+	assert.Len(t, unkeyed, 64)
+	assert.Equal(t, unkeyed, BlindIndex("+254740827150"))
+
+	keyring, _ := NewKeyring("k1", map[string][]byte{"k1": testKey(1)}, testKey(9))
+	SetKeyring(keyring)
+	keyed := BlindIndex("+254740827150")
+	assert.Equal(t, keyed, BlindIndex("+254740827150"))
+	assert.NotEqual(t, unkeyed, keyed)
+	assert.NotEqual(t, keyed, BlindIndex("+254740827151"))
+}
@@ -0,0 +1,142 @@
+package respond
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StrictJSONKey is the gin context key that, when true, makes BindJSON
+// reject request bodies with fields the request type does not have
+const StrictJSONKey = "strict_json"
+
+// UnknownFieldsError lists the body fields a strict request did not expect,
+// with the path to nested ones such as items[0].qty
+type UnknownFieldsError struct {
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return "unknown fields: " + strings.Join(e.Fields, ", ")
+}
+
+// BindJSON binds and validates the JSON body like c.ShouldBindJSON. On
+// strict requests a body with unknown fields fails with an
+// UnknownFieldsError listing all of them, so a typo such as "amonut" is
+// reported instead of silently ignored.
+func BindJSON(c *gin.Context, obj interface{}) error {
+	if !c.GetBool(StrictJSONKey) || c.Request == nil || c.Request.Body == nil {
+		return c.ShouldBindJSON(obj)
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	if unknown := unknownFields(body, reflect.TypeOf(obj), ""); len(unknown) > 0 {
+		return &UnknownFieldsError{Fields: unknown}
+	}
+	return c.ShouldBindJSON(obj)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unknownFields walks data alongside t and returns the keys t has no field
+// for. Keys are matched case insensitively, as encoding/json does. Data
+// that does not fit t is left for the decoder to report.
+func unknownFields(data []byte, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return nil
+		}
+
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var unknown []string
+		for _, key := range keys {
+			field, ok := fields[strings.ToLower(key)]
+			if !ok {
+				unknown = append(unknown, path+key)
+				continue
+			}
+			unknown = append(unknown, unknownFields(object[key], field, path+key+".")...)
+		}
+		return unknown
+
+	case reflect.Slice, reflect.Array:
+		var items []json.RawMessage
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil
+		}
+
+		var unknown []string
+		prefix := strings.TrimSuffix(path, ".")
+		for i, item := range items {
+			unknown = append(unknown, unknownFields(item, t.Elem(), fmt.Sprintf("%s[%d].", prefix, i))...)
+		}
+		return unknown
+	}
+	return nil
+}
+
+// jsonFields maps the lower cased JSON names of t's fields, including
+// those of embedded structs, to their types
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for key, value := range jsonFields(embedded) {
+					if _, ok := fields[key]; !ok {
+						fields[key] = value
+					}
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[strings.ToLower(name)] = field.Type
+	}
+	return fields
+}
@@ -0,0 +1,59 @@
+package respond
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ReturnMinimal        = "minimal"
+	ReturnRepresentation = "representation"
+)
+
+// Created writes a 201 for a resource created at location, which is also
+// sent as the Location header. The full resource is returned unless the
+// client asks for ?return=minimal or sends Prefer: return=minimal, in which
+// case only its id and version are, so it can be shown optimistically and
+// fetched later. Unknown values are ignored, as preferences are.
+func Created(c *gin.Context, location string, id uint, updatedAt time.Time, resource interface{}) {
+	c.Header("Location", location)
+
+	switch returnPreference(c) {
+	case ReturnMinimal:
+		c.Header("Preference-Applied", "return="+ReturnMinimal)
+		OK(c, http.StatusCreated, models.CreatedResource{ID: id, Version: Version(updatedAt)})
+	case ReturnRepresentation:
+		c.Header("Preference-Applied", "return="+ReturnRepresentation)
+		OK(c, http.StatusCreated, resource)
+	default:
+		OK(c, http.StatusCreated, resource)
+	}
+}
+
+// Version is the opaque version of a resource last updated at updatedAt.
+// It changes whenever the resource does.
+func Version(updatedAt time.Time) string {
+	return strconv.FormatInt(updatedAt.UnixNano(), 36)
+}
+
+// returnPreference reads ?return=, falling back to the return preference
+// of the Prefer header
+func returnPreference(c *gin.Context) string {
+	if value := c.Query("return"); value != "" {
+		return value
+	}
+	for _, header := range c.Request.Header.Values("Prefer") {
+		for _, preference := range strings.Split(header, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(preference), "=")
+			if strings.EqualFold(name, "return") {
+				return strings.Trim(value, `"`)
+			}
+		}
+	}
+	return ""
+}
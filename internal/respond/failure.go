@@ -0,0 +1,105 @@
+package respond
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Failure is a server error answered with a sanitized envelope. It is
+// recorded on the gin context, with the stack it was reported from, for
+// middleware.Errors to log under ID, the error id the client was given.
+type Failure struct {
+	ID     string
+	Status int
+	Code   string
+	// Err is the underlying cause. It may hold internals and is never sent
+	// to the client.
+	Err   error
+	Stack []byte
+}
+
+func (f *Failure) Error() string {
+	if f.Err == nil {
+		return f.Code
+	}
+	return f.Code + ": " + f.Err.Error()
+}
+
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// TimeoutCode and TimeoutMessage answer a request that ran past the
+// deadline middleware.Timeout gave it
+const (
+	TimeoutCode    = "request_timeout"
+	TimeoutMessage = "the request took too long, retry later"
+)
+
+// ServerError answers with a 500 carrying code, message and a new error
+// id, and records err for the error middleware to log under that id. Use
+// it instead of Error whenever a handler has the error that caused a 500.
+// A failure because the request's deadline passed is answered 503
+// request_timeout instead, so clients know to retry.
+func ServerError(c *gin.Context, err error, code, message string) {
+	serverError(c, http.StatusInternalServerError, err, code, message, nil)
+}
+
+// serverError writes every 500 envelope, so each one has an error id
+func serverError(c *gin.Context, status int, err error, code, message string, details interface{}) {
+	if timedOut(c, err) {
+		status, code, message, details = http.StatusServiceUnavailable, TimeoutCode, TimeoutMessage, nil
+	}
+	failure := &Failure{ID: NewErrorID(), Status: status, Code: code, Err: err, Stack: debug.Stack()}
+	if err == nil {
+		failure.Err = errors.New(message)
+	}
+	c.Error(failure)
+	writeError(c, status, code, message, failure.ID, details)
+}
+
+// timedOut reports whether err, or the request it was serving, ran out of
+// time
+func timedOut(c *gin.Context, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	return c.Request != nil && errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
+
+// AbortFailure answers with the failure's status, code and error id, and
+// stops the handler chain
+func AbortFailure(c *gin.Context, failure *Failure, message string) {
+	writeError(c, failure.Status, failure.Code, message, failure.ID, nil)
+	c.Abort()
+}
+
+// NewErrorID returns a random id for a server error, short enough for a
+// customer to read out to support
+func NewErrorID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// StreamError ends a streamed response that failed after its status was
+// sent with a last line holding the error envelope, and records err like
+// ServerError. Clients take that line to mean the stream is incomplete.
+func StreamError(c *gin.Context, err error, code, message string) {
+	failure := &Failure{ID: NewErrorID(), Status: http.StatusInternalServerError, Code: code, Err: err, Stack: debug.Stack()}
+	c.Error(failure)
+	json.NewEncoder(c.Writer).Encode(models.ErrorEnvelope{
+		Error:     models.ErrorBody{Code: code, Message: message, ErrorID: failure.ID},
+		RequestID: c.GetString(RequestIDKey),
+	})
+}
@@ -0,0 +1,141 @@
+// Package respond writes every API response in one of two envelopes:
+//
+//	{"data": ..., "meta": ..., "request_id": "..."}
+//	{"error": {"code": "...", "message": "...", "details": ...}, "request_id": "..."}
+//
+// Streamed NDJSON lists are the exception: a line per record, and an error
+// envelope as the last line if the stream fails part way (see StreamError).
+//
+// Handlers and middleware must use these helpers rather than c.JSON so that
+// every endpoint has the same shape.
+package respond
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/validation"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// RequestIDKey is the gin context key the request id is stored under
+const RequestIDKey = "request_id"
+
+func init() {
+	// report validation failures by their JSON (or form) names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(fieldName)
+		if err := validation.Register(v); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// OK writes data in a success envelope
+func OK(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, models.Envelope{
+		Data:      data,
+		RequestID: c.GetString(RequestIDKey),
+	})
+}
+
+// OKWithMeta writes data in a success envelope along with meta, such as
+// pagination for list endpoints
+func OKWithMeta(c *gin.Context, status int, data, meta interface{}) {
+	c.JSON(status, models.Envelope{
+		Data:      data,
+		Meta:      meta,
+		RequestID: c.GetString(RequestIDKey),
+	})
+}
+
+// Error writes an error envelope
+func Error(c *gin.Context, status int, code, message string) {
+	ErrorWithDetails(c, status, code, message, nil)
+}
+
+// ErrorWithDetails writes an error envelope carrying extra context for the
+// client, such as failed fields or health checks. A 500 is given an error
+// id and recorded like ServerError.
+func ErrorWithDetails(c *gin.Context, status int, code, message string, details interface{}) {
+	if status == http.StatusInternalServerError {
+		serverError(c, status, nil, code, message, details)
+		return
+	}
+	writeError(c, status, code, message, "", details)
+}
+
+func writeError(c *gin.Context, status int, code, message, errorID string, details interface{}) {
+	c.JSON(status, models.ErrorEnvelope{
+		Error: models.ErrorBody{
+			Code:    code,
+			Message: message,
+			Details: details,
+			ErrorID: errorID,
+		},
+		RequestID: c.GetString(RequestIDKey),
+	})
+}
+
+// AbortError writes an error envelope and stops the handler chain
+func AbortError(c *gin.Context, status int, code, message string) {
+	Error(c, status, code, message)
+	c.Abort()
+}
+
+// BindError reports a request that failed to bind, listing each failed
+// validation rule, or each unknown field of a strict request, in details.
+// When every failure is of one business rule, such as kenyan_phone, that
+// rule's code is used instead of invalid_request.
+func BindError(c *gin.Context, err error) {
+	var unknownFields *UnknownFieldsError
+	if errors.As(err, &unknownFields) {
+		details := make([]models.FieldError, 0, len(unknownFields.Fields))
+		for _, field := range unknownFields.Fields {
+			details = append(details, models.FieldError{Field: field, Rule: "unknown"})
+		}
+		ErrorWithDetails(c, 400, "unknown_fields", err.Error(), details)
+		return
+	}
+
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		Error(c, 400, "invalid_request", err.Error())
+		return
+	}
+
+	code := ""
+	details := make([]models.FieldError, 0, len(validationErrors))
+	for i, fe := range validationErrors {
+		detail := models.FieldError{Field: fe.Field(), Rule: fe.Tag()}
+		ruleCode, message, ok := validation.Describe(fe.Tag())
+		if ok {
+			detail.Message = message
+		}
+		if i == 0 || ruleCode == code {
+			code = ruleCode
+		} else {
+			code = ""
+		}
+		details = append(details, detail)
+	}
+	if code == "" {
+		code = "invalid_request"
+	}
+	ErrorWithDetails(c, 400, code, err.Error(), details)
+}
+
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
@@ -0,0 +1,286 @@
+package respond
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOK(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(RequestIDKey, "req-1")
+
+	OKWithMeta(c, http.StatusOK, []string{"a", "b"}, models.PageMeta{Total: 2, Page: 1, Limit: 10, TotalPages: 1})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":["a","b"],"meta":{"total":2,"page":1,"limit":10,"total_pages":1,"has_next":false},"request_id":"req-1"}`, w.Body.String())
+}
+
+func TestStreamError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Set(RequestIDKey, "req-1")
+	c.Status(http.StatusOK)
+	c.Writer.WriteString("{\"id\":1}\n")
+
+	StreamError(c, errors.New("connection reset"), "database_error", "failed to retrieve orders")
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		var body models.ErrorEnvelope
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &body))
+		assert.Equal(t, "database_error", body.Error.Code)
+		assert.Equal(t, "req-1", body.RequestID)
+		assert.NotEmpty(t, body.Error.ErrorID)
+	}
+	assert.Equal(t, http.StatusOK, w.Code)
+	if assert.Len(t, c.Errors, 1) {
+		assert.ErrorContains(t, c.Errors[0].Err, "connection reset")
+	}
+}
+
+func TestCreated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	updatedAt := time.Date(2025, 9, 19, 10, 0, 0, 0, time.UTC)
+	resource := gin.H{"id": 7, "name": "Sebbie Chanzu"}
+
+	tests := []struct {
+		name            string
+		query           string
+		prefer          string
+		expectedBody    string
+		expectedApplied string
+	}{
+		{
+			name:         "full resource by default",
+			expectedBody: `{"data":{"id":7,"name":"Sebbie Chanzu"},"request_id":"req-1"}`,
+		},
+		{
+			name:            "minimal by query",
+			query:           "?return=minimal",
+			expectedBody:    `{"data":{"id":7,"version":"` + Version(updatedAt) + `"},"request_id":"req-1"}`,
+			expectedApplied: "return=minimal",
+		},
+		{
+			name:            "minimal by prefer header",
+			prefer:          "respond-async, return=minimal",
+			expectedBody:    `{"data":{"id":7,"version":"` + Version(updatedAt) + `"},"request_id":"req-1"}`,
+			expectedApplied: "return=minimal",
+		},
+		{
+			name:            "query wins over the header",
+			query:           "?return=representation",
+			prefer:          "return=minimal",
+			expectedBody:    `{"data":{"id":7,"name":"Sebbie Chanzu"},"request_id":"req-1"}`,
+			expectedApplied: "return=representation",
+		},
+		{
+			name:         "unknown preference ignored",
+			query:        "?return=tiny",
+			expectedBody: `{"data":{"id":7,"name":"Sebbie Chanzu"},"request_id":"req-1"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Set(RequestIDKey, "req-1")
+			c.Request, _ = http.NewRequest("POST", "/customers"+tt.query, nil)
+			if tt.prefer != "" {
+				c.Request.Header.Set("Prefer", tt.prefer)
+			}
+
+			Created(c, "/api/v1/customers/7", 7, updatedAt, resource)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+			assert.Equal(t, "/api/v1/customers/7", w.Header().Get("Location"))
+			assert.Equal(t, tt.expectedApplied, w.Header().Get("Preference-Applied"))
+			assert.JSONEq(t, tt.expectedBody, w.Body.String())
+		})
+	}
+}
+
+func TestBindError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name            string
+		body            string
+		expectedCode    string
+		expectedDetails []models.FieldError
+	}{
+		{
+			name:         "validation errors listed by json name",
+			body:         `{"email": "not-an-email"}`,
+			expectedCode: "invalid_request",
+			expectedDetails: []models.FieldError{
+				{Field: "name", Rule: "required"},
+				{Field: "email", Rule: "email"},
+			},
+		},
+		{
+			name:         "business rule has its own code",
+			body:         `{"name": "Sebbie", "email": "sebbie@example.com", "phone": "0812345678"}`,
+			expectedCode: "invalid_phone",
+			expectedDetails: []models.FieldError{
+				{Field: "phone", Rule: "kenyan_phone", Message: "must be a Kenyan mobile number such as +254712345678"},
+			},
+		},
+		{
+			name:         "business rule among other failures",
+			body:         `{"email": "sebbie@example.com", "phone": "0812345678"}`,
+			expectedCode: "invalid_request",
+			expectedDetails: []models.FieldError{
+				{Field: "name", Rule: "required"},
+				{Field: "phone", Rule: "kenyan_phone", Message: "must be a Kenyan mobile number such as +254712345678"},
+			},
+		},
+		{
+			name:         "malformed json has no details",
+			body:         `{"name":`,
+			expectedCode: "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+
+			var req struct {
+				Name  string `json:"name" binding:"required"`
+				Email string `json:"email" binding:"required,email"`
+				Phone string `json:"phone" binding:"omitempty,kenyan_phone"`
+			}
+			BindError(c, c.ShouldBindJSON(&req))
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response struct {
+				Error struct {
+					Code    string              `json:"code"`
+					Details []models.FieldError `json:"details"`
+				} `json:"error"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, tt.expectedCode, response.Error.Code)
+			assert.Equal(t, tt.expectedDetails, response.Error.Details)
+		})
+	}
+}
+
+func TestBindJSONStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	type item struct {
+		ProductID uint `json:"product_id"`
+		Quantity  int  `json:"quantity"`
+	}
+	type base struct {
+		Note string `json:"note"`
+	}
+	type request struct {
+		base
+		Amount float64   `json:"amount" binding:"required"`
+		Time   time.Time `json:"time"`
+		Items  []item    `json:"items"`
+		Extra  *item     `json:"extra"`
+		Hidden string    `json:"-"`
+		Tags   []string  `json:"tags"`
+		Meta   gin.H     `json:"meta"`
+		Raw    json.RawMessage
+	}
+
+	tests := []struct {
+		name            string
+		strict          bool
+		body            string
+		expectedCode    string
+		expectedDetails []models.FieldError
+	}{
+		{
+			name: "unknown fields are ignored by default",
+			body: `{"amount": 10, "amonut": 12}`,
+		},
+		{
+			name:   "known fields bind",
+			strict: true,
+			body:   `{"AMOUNT": 10, "note": "gift", "time": "2025-09-20T12:00:00Z", "items": [{"product_id": 1}], "tags": ["a"], "meta": {"any": 1}, "raw": {"x": 1}}`,
+		},
+		{
+			name:         "unknown fields are listed",
+			strict:       true,
+			body:         `{"amount": 10, "amonut": 12, "items": [{"product_id": 1, "qty": 2}], "extra": {"colour": "red"}, "Hidden": "x"}`,
+			expectedCode: "unknown_fields",
+			expectedDetails: []models.FieldError{
+				{Field: "Hidden", Rule: "unknown"},
+				{Field: "amonut", Rule: "unknown"},
+				{Field: "extra.colour", Rule: "unknown"},
+				{Field: "items[0].qty", Rule: "unknown"},
+			},
+		},
+		{
+			name:         "validation still runs",
+			strict:       true,
+			body:         `{"note": "gift"}`,
+			expectedCode: "invalid_request",
+			expectedDetails: []models.FieldError{
+				{Field: "amount", Rule: "required"},
+			},
+		},
+		{
+			name:         "malformed json is left to the decoder",
+			strict:       true,
+			body:         `{"amount":`,
+			expectedCode: "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request, _ = http.NewRequest("POST", "/", strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			if tt.strict {
+				c.Set(StrictJSONKey, true)
+			}
+
+			var req request
+			err := BindJSON(c, &req)
+			if tt.expectedCode == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, 10.0, req.Amount)
+				return
+			}
+			BindError(c, err)
+
+			var response models.ErrorEnvelope
+			json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tt.expectedCode, response.Error.Code)
+			if tt.expectedDetails != nil {
+				details, _ := json.Marshal(response.Error.Details)
+				var fieldErrors []models.FieldError
+				json.Unmarshal(details, &fieldErrors)
+				assert.Equal(t, tt.expectedDetails, fieldErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	gcpBaseURL     = "https://secretmanager.googleapis.com"
+	gcpScope       = "https://www.googleapis.com/auth/cloud-platform"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// GCPProvider reads secrets from Google Cloud Secret Manager
+type GCPProvider struct {
+	projectID string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewGCPProvider reads secrets of projectID. client must add the OAuth2
+// token of a service account allowed to access them.
+func NewGCPProvider(projectID string, client *http.Client) *GCPProvider {
+	return &GCPProvider{
+		projectID: projectID,
+		baseURL:   gcpBaseURL,
+		client:    client,
+	}
+}
+
+// NewGCPProviderFromEnv reads GCP_PROJECT_ID and the service account key,
+// either from the file GCP_CREDENTIALS_FILE names or inline in
+// GCP_CREDENTIALS_JSON
+func NewGCPProviderFromEnv() (*GCPProvider, error) {
+	projectID := os.Getenv("GCP_PROJECT_ID")
+	if projectID == "" {
+		return nil, fmt.Errorf("gcp secrets need GCP_PROJECT_ID")
+	}
+
+	key := []byte(os.Getenv("GCP_CREDENTIALS_JSON"))
+	if path := os.Getenv("GCP_CREDENTIALS_FILE"); path != "" {
+		var err error
+		if key, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read gcp credentials: %w", err)
+		}
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("gcp secrets need GCP_CREDENTIALS_FILE or GCP_CREDENTIALS_JSON")
+	}
+
+	var account struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(key, &account); err != nil {
+		return nil, fmt.Errorf("invalid gcp credentials: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURL
+	}
+
+	cfg := &jwt.Config{
+		Email:        account.ClientEmail,
+		PrivateKey:   []byte(account.PrivateKey),
+		PrivateKeyID: account.PrivateKeyID,
+		Scopes:       []string{gcpScope},
+		TokenURL:     account.TokenURI,
+	}
+	return NewGCPProvider(projectID, cfg.Client(context.Background())), nil
+}
+
+// WithBaseURL sends requests to another Secret Manager endpoint, such as a
+// fake in tests
+func (p *GCPProvider) WithBaseURL(baseURL string) *GCPProvider {
+	p.baseURL = strings.TrimSuffix(baseURL, "/")
+	return p
+}
+
+// Fetch returns a version of a secret. id is a secret name, read at its
+// latest version, or a full projects/.../secrets/.../versions/... path.
+func (p *GCPProvider) Fetch(ctx context.Context, id string) (string, error) {
+	name := id
+	if !strings.HasPrefix(name, "projects/") {
+		name = fmt.Sprintf("projects/%s/secrets/%s", p.projectID, id)
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("secret manager request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Status  string `json:"status"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.Unmarshal(data, &failure)
+		return "", fmt.Errorf("secret manager returned %d: %s %s", resp.StatusCode, failure.Error.Status, failure.Error.Message)
+	}
+
+	var version struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &version); err != nil {
+		return "", fmt.Errorf("invalid secret manager response: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret payload: %w", err)
+	}
+	return string(value), nil
+}
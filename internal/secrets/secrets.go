@@ -0,0 +1,254 @@
+// Package secrets loads secrets such as JWT_SECRET, DATABASE_URL and
+// AFRICASTALKING_API_KEY from a cloud secret manager into the environment
+// at startup, so they need not be kept as plain environment variables on
+// the hosting platform. Everything that reads the environment afterwards
+// sees them as if they had been set there.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider fetches the current value of a secret from a secret manager
+type Provider interface {
+	Fetch(ctx context.Context, id string) (string, error)
+}
+
+// DefaultRefreshInterval is how often secrets are fetched again to pick up
+// rotations
+const DefaultRefreshInterval = time.Hour
+
+// Manager keeps environment variables in step with the secrets they are
+// mapped to. Each secret is fetched once per load or refresh however many
+// variables read it.
+type Manager struct {
+	provider Provider
+	// refs maps an environment variable to a secret id, optionally with
+	// #field to read one field of a JSON secret
+	refs     map[string]string
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	values    map[string]string
+	fetchedAt time.Time
+	hooks     []func(name string)
+}
+
+// NewManager maps environment variables to secret references. A reference
+// is a secret id, or id#field to read one field of a secret holding a JSON
+// object, e.g. DB_PASSWORD=prod/db#password.
+func NewManager(provider Provider, refs map[string]string) *Manager {
+	return &Manager{
+		provider: provider,
+		refs:     refs,
+		interval: DefaultRefreshInterval,
+		now:      time.Now,
+		values:   map[string]string{},
+	}
+}
+
+// WithRefreshInterval sets how long fetched secrets are used before
+// RefreshIfStale fetches them again
+func (m *Manager) WithRefreshInterval(interval time.Duration) *Manager {
+	if interval > 0 {
+		m.interval = interval
+	}
+	return m
+}
+
+// WithClock replaces time.Now, for tests
+func (m *Manager) WithClock(now func() time.Time) *Manager {
+	m.now = now
+	return m
+}
+
+// RefreshInterval is how often secrets are fetched again
+func (m *Manager) RefreshInterval() time.Duration {
+	return m.interval
+}
+
+// OnRotate calls hook with the name of each environment variable whose
+// secret changed on a refresh
+func (m *Manager) OnRotate(hook func(name string)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// Load fetches every secret and sets the environment variables mapped to
+// them. It fails if any secret cannot be read, leaving the environment
+// untouched.
+func (m *Manager) Load(ctx context.Context) error {
+	_, err := m.refresh(ctx)
+	return err
+}
+
+// Refresh fetches every secret again and updates the variables whose
+// secret changed, calling the rotation hooks for them. It returns the
+// names of those variables.
+func (m *Manager) Refresh(ctx context.Context) ([]string, error) {
+	return m.refresh(ctx)
+}
+
+// RefreshIfStale refreshes once the secrets are older than the refresh
+// interval, for serverless instances that run no background jobs. It is
+// cheap otherwise. Only one caller refreshes; if that fails the old values
+// are kept until the next interval.
+func (m *Manager) RefreshIfStale(ctx context.Context) error {
+	m.mu.Lock()
+	now := m.now()
+	stale := now.Sub(m.fetchedAt) >= m.interval
+	if stale {
+		m.fetchedAt = now
+	}
+	m.mu.Unlock()
+	if !stale {
+		return nil
+	}
+	_, err := m.refresh(ctx)
+	return err
+}
+
+func (m *Manager) refresh(ctx context.Context) ([]string, error) {
+	fetched := map[string]string{}
+	values := make(map[string]string, len(m.refs))
+	for name, ref := range m.refs {
+		id, field, _ := strings.Cut(ref, "#")
+		raw, ok := fetched[id]
+		if !ok {
+			var err error
+			if raw, err = m.provider.Fetch(ctx, id); err != nil {
+				return nil, fmt.Errorf("failed to fetch secret %s for %s: %w", id, name, err)
+			}
+			fetched[id] = raw
+		}
+
+		value, err := secretField(raw, field)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s for %s: %w", id, name, err)
+		}
+		values[name] = value
+	}
+
+	m.mu.Lock()
+	var changed []string
+	for name, value := range values {
+		if old, ok := m.values[name]; ok && old == value {
+			continue
+		}
+		if _, loaded := m.values[name]; loaded {
+			changed = append(changed, name)
+		}
+		os.Setenv(name, value)
+	}
+	m.values = values
+	m.fetchedAt = m.now()
+	hooks := append([]func(string){}, m.hooks...)
+	m.mu.Unlock()
+
+	sort.Strings(changed)
+	for _, name := range changed {
+		for _, hook := range hooks {
+			hook(name)
+		}
+	}
+	return changed, nil
+}
+
+// secretField returns the whole secret, or one field of a JSON object
+func secretField(raw, field string) (string, error) {
+	if field == "" {
+		return raw, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &object); err != nil {
+		return "", fmt.Errorf("is not a JSON object, cannot read field %s", field)
+	}
+	value, ok := object[field]
+	if !ok {
+		return "", fmt.Errorf("has no field %s", field)
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		return s, nil
+	}
+	// numbers such as a port are used as written
+	return string(value), nil
+}
+
+// ParseRefs reads a comma separated list of NAME=reference pairs
+func ParseRefs(list string) (map[string]string, error) {
+	refs := map[string]string{}
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, ref, ok := strings.Cut(pair, "=")
+		name, ref = strings.TrimSpace(name), strings.TrimSpace(ref)
+		if !ok || name == "" || ref == "" {
+			return nil, fmt.Errorf("invalid secret mapping %q, expected NAME=secret-id", pair)
+		}
+		refs[name] = ref
+	}
+	return refs, nil
+}
+
+// FromEnv builds the manager SECRETS_PROVIDER (aws or gcp) and SECRETS,
+// the NAME=reference list, describe. It returns nil when SECRETS_PROVIDER
+// is not set. The provider's own credentials are read from the environment
+// too; see NewAWSProviderFromEnv and NewGCPProviderFromEnv.
+func FromEnv() (*Manager, error) {
+	kind := strings.ToLower(os.Getenv("SECRETS_PROVIDER"))
+	if kind == "" {
+		return nil, nil
+	}
+
+	refs, err := ParseRefs(os.Getenv("SECRETS"))
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("SECRETS_PROVIDER is %s but SECRETS maps no variables", kind)
+	}
+
+	var provider Provider
+	switch kind {
+	case "aws":
+		provider, err = NewAWSProviderFromEnv()
+	case "gcp":
+		provider, err = NewGCPProviderFromEnv()
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q, expected aws or gcp", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	interval, _ := time.ParseDuration(os.Getenv("SECRETS_REFRESH_INTERVAL"))
+	return NewManager(provider, refs).WithRefreshInterval(interval), nil
+}
+
+// LoadFromEnv loads the secrets FromEnv describes into the environment. It
+// returns nil, with nothing loaded, when no provider is configured.
+func LoadFromEnv(ctx context.Context) (*Manager, error) {
+	manager, err := FromEnv()
+	if err != nil || manager == nil {
+		return nil, err
+	}
+	if err := manager.Load(ctx); err != nil {
+		return nil, err
+	}
+	log.Printf("loaded %d secrets from %s", len(manager.refs), os.Getenv("SECRETS_PROVIDER"))
+	return manager, nil
+}
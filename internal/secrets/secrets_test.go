@@ -0,0 +1,231 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProvider struct {
+	secrets map[string]string
+	fetches int
+	err     error
+}
+
+func (p *fakeProvider) Fetch(ctx context.Context, id string) (string, error) {
+	p.fetches++
+	if p.err != nil {
+		return "", p.err
+	}
+	value, ok := p.secrets[id]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return value, nil
+}
+
+func TestManagerLoad(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "")
+	t.Setenv("TEST_DB_PASSWORD", "")
+	t.Setenv("TEST_DB_PORT", "")
+	provider := &fakeProvider{secrets: map[string]string{
+		"jwt":     "s3cret",
+		"prod/db": `{"password":"hunter2","port":5432}`,
+	}}
+
+	manager := NewManager(provider, map[string]string{
+		"TEST_JWT_SECRET":  "jwt",
+		"TEST_DB_PASSWORD": "prod/db#password",
+		"TEST_DB_PORT":     "prod/db#port",
+	})
+	assert.NoError(t, manager.Load(context.Background()))
+
+	assert.Equal(t, "s3cret", os.Getenv("TEST_JWT_SECRET"))
+	assert.Equal(t, "hunter2", os.Getenv("TEST_DB_PASSWORD"))
+	assert.Equal(t, "5432", os.Getenv("TEST_DB_PORT"))
+	// prod/db is fetched once for both fields
+	assert.Equal(t, 2, provider.fetches)
+}
+
+func TestManagerLoadFails(t *testing.T) {
+	t.Setenv("TEST_DB_PASSWORD", "unchanged")
+
+	missing := NewManager(&fakeProvider{secrets: map[string]string{}}, map[string]string{"TEST_DB_PASSWORD": "prod/db"})
+	assert.Error(t, missing.Load(context.Background()))
+
+	noField := NewManager(&fakeProvider{secrets: map[string]string{"prod/db": `{"user":"app"}`}}, map[string]string{"TEST_DB_PASSWORD": "prod/db#password"})
+	assert.ErrorContains(t, noField.Load(context.Background()), "has no field password")
+
+	notJSON := NewManager(&fakeProvider{secrets: map[string]string{"prod/db": "plain"}}, map[string]string{"TEST_DB_PASSWORD": "prod/db#password"})
+	assert.Error(t, notJSON.Load(context.Background()))
+
+	assert.Equal(t, "unchanged", os.Getenv("TEST_DB_PASSWORD"))
+}
+
+func TestManagerRefreshCallsRotationHooks(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "")
+	t.Setenv("TEST_API_KEY", "")
+	provider := &fakeProvider{secrets: map[string]string{"jwt": "one", "at": "key"}}
+	manager := NewManager(provider, map[string]string{"TEST_JWT_SECRET": "jwt", "TEST_API_KEY": "at"})
+
+	var rotated []string
+	manager.OnRotate(func(name string) { rotated = append(rotated, name) })
+
+	assert.NoError(t, manager.Load(context.Background()))
+	assert.Empty(t, rotated, "the first load is not a rotation")
+
+	provider.secrets["jwt"] = "two"
+	changed, err := manager.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"TEST_JWT_SECRET"}, changed)
+	assert.Equal(t, []string{"TEST_JWT_SECRET"}, rotated)
+	assert.Equal(t, "two", os.Getenv("TEST_JWT_SECRET"))
+
+	changed, err = manager.Refresh(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, changed)
+}
+
+func TestManagerRefreshIfStale(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	provider := &fakeProvider{secrets: map[string]string{"jwt": "one"}}
+	manager := NewManager(provider, map[string]string{"TEST_JWT_SECRET": "jwt"}).
+		WithRefreshInterval(10 * time.Minute).
+		WithClock(func() time.Time { return now })
+	assert.NoError(t, manager.Load(context.Background()))
+
+	now = now.Add(5 * time.Minute)
+	assert.NoError(t, manager.RefreshIfStale(context.Background()))
+	assert.Equal(t, 1, provider.fetches)
+
+	now = now.Add(5 * time.Minute)
+	provider.secrets["jwt"] = "two"
+	assert.NoError(t, manager.RefreshIfStale(context.Background()))
+	assert.Equal(t, 2, provider.fetches)
+	assert.Equal(t, "two", os.Getenv("TEST_JWT_SECRET"))
+
+	// a failed refresh keeps the old value and waits for the next interval
+	now = now.Add(10 * time.Minute)
+	provider.err = errors.New("unavailable")
+	assert.Error(t, manager.RefreshIfStale(context.Background()))
+	assert.NoError(t, manager.RefreshIfStale(context.Background()))
+	assert.Equal(t, 3, provider.fetches)
+	assert.Equal(t, "two", os.Getenv("TEST_JWT_SECRET"))
+}
+
+func TestParseRefs(t *testing.T) {
+	refs, err := ParseRefs(" JWT_SECRET=prod/jwt , DATABASE_URL=prod/db#url,")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"JWT_SECRET": "prod/jwt", "DATABASE_URL": "prod/db#url"}, refs)
+
+	_, err = ParseRefs("JWT_SECRET")
+	assert.Error(t, err)
+	_, err = ParseRefs("=prod/jwt")
+	assert.Error(t, err)
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("SECRETS_PROVIDER", "")
+	manager, err := FromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, manager)
+
+	t.Setenv("SECRETS_PROVIDER", "vault")
+	t.Setenv("SECRETS", "JWT_SECRET=jwt")
+	_, err = FromEnv()
+	assert.ErrorContains(t, err, "unknown SECRETS_PROVIDER")
+
+	t.Setenv("SECRETS_PROVIDER", "aws")
+	t.Setenv("SECRETS", "")
+	_, err = FromEnv()
+	assert.ErrorContains(t, err, "maps no variables")
+
+	t.Setenv("SECRETS", "JWT_SECRET=jwt")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("SECRETS_REFRESH_INTERVAL", "15m")
+	manager, err = FromEnv()
+	assert.NoError(t, err)
+	assert.Equal(t, 15*time.Minute, manager.RefreshInterval())
+}
+
+func TestSignAWSRequest(t *testing.T) {
+	// the get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	credentials := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, credentials, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestAWSProviderFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "token", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+
+		var body struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&body)
+		switch body.SecretId {
+		case "prod/jwt":
+			json.NewEncoder(w).Encode(map[string]string{"Name": "prod/jwt", "SecretString": "s3cret"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "ResourceNotFoundException", "message": "Secrets Manager can't find the specified secret."})
+		}
+	}))
+	defer server.Close()
+
+	provider := NewAWSProvider("eu-west-1", AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"}).
+		WithEndpoint(server.URL)
+
+	value, err := provider.Fetch(context.Background(), "prod/jwt")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	_, err = provider.Fetch(context.Background(), "prod/missing")
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
+
+func TestGCPProviderFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/projects/shop/secrets/jwt/versions/latest:access", "/v1/projects/shop/secrets/jwt/versions/3:access":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name":    "projects/shop/secrets/jwt/versions/3",
+				"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("s3cret"))},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"error": map[string]interface{}{"status": "NOT_FOUND", "message": "Secret not found"}})
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGCPProvider("shop", server.Client()).WithBaseURL(server.URL)
+
+	value, err := provider.Fetch(context.Background(), "jwt")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	value, err = provider.Fetch(context.Background(), "projects/shop/secrets/jwt/versions/3")
+	assert.NoError(t, err)
+	assert.Equal(t, "s3cret", value)
+
+	_, err = provider.Fetch(context.Background(), "missing")
+	assert.ErrorContains(t, err, "NOT_FOUND")
+}
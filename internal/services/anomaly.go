@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// anomalyBatchSize is how many new orders are checked per query
+const anomalyBatchSize = 200
+
+// AnomalyPolicy sets when an order's amount is unusual for its customer
+type AnomalyPolicy struct {
+	// Ratio is how many times the customer's typical amount an order must
+	// come to before it is flagged
+	Ratio float64
+	// History is how many of the customer's latest earlier orders their
+	// typical amount is learnt from
+	History int
+	// MinHistory is how many earlier orders a customer needs before their
+	// orders are checked at all
+	MinHistory int
+	// MinAmount keeps small orders from being flagged however unusual they
+	// are for the customer
+	MinAmount models.Money
+}
+
+func DefaultAnomalyPolicy() AnomalyPolicy {
+	return AnomalyPolicy{
+		Ratio:      10,
+		History:    50,
+		MinHistory: 5,
+	}
+}
+
+// AnomalyPolicyFromEnv reads ANOMALY_RATIO, ANOMALY_HISTORY,
+// ANOMALY_MIN_HISTORY and ANOMALY_MIN_AMOUNT over the defaults
+func AnomalyPolicyFromEnv() AnomalyPolicy {
+	policy := DefaultAnomalyPolicy()
+
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_RATIO"), 64); err == nil && f > 1 {
+		policy.Ratio = f
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_HISTORY")); err == nil && n > 0 {
+		policy.History = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("ANOMALY_MIN_HISTORY")); err == nil && n > 0 {
+		policy.MinHistory = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("ANOMALY_MIN_AMOUNT"), 64); err == nil && f > 0 {
+		policy.MinAmount = models.Shillings(f)
+	}
+	return policy
+}
+
+// WithDefaults fills unset fields from DefaultAnomalyPolicy
+func (p AnomalyPolicy) WithDefaults() AnomalyPolicy {
+	defaults := DefaultAnomalyPolicy()
+	if p.Ratio <= 1 {
+		p.Ratio = defaults.Ratio
+	}
+	if p.History <= 0 {
+		p.History = defaults.History
+	}
+	if p.MinHistory <= 0 {
+		p.MinHistory = defaults.MinHistory
+	}
+	p.MinHistory = min(p.MinHistory, p.History)
+	return p
+}
+
+// AnomalyService compares the amount of every new order with what its
+// customer usually spends, records the outliers in order_anomalies and
+// alerts admins about them by SMS
+type AnomalyService struct {
+	db          *gorm.DB
+	sms         SMSServiceInterface
+	alertPhones []string
+	policy      AnomalyPolicy
+	now         func() time.Time
+}
+
+// NewAnomalyService builds the analyzer. With no alertPhones anomalies are
+// only recorded.
+func NewAnomalyService(db *gorm.DB, sms SMSServiceInterface, alertPhones []string, policy AnomalyPolicy) *AnomalyService {
+	return &AnomalyService{
+		db:          db,
+		sms:         sms,
+		alertPhones: alertPhones,
+		policy:      policy.WithDefaults(),
+		now:         time.Now,
+	}
+}
+
+// Check looks at the orders placed since the last check, flags those far
+// above their customer's typical amount, and sends the alerts that are
+// still due, including ones that failed to send before
+func (s *AnomalyService) Check(ctx context.Context) (flagged int, err error) {
+	db := s.db.WithContext(ctx)
+
+	for {
+		var orders []models.Order
+		err := db.Where("amount_checked_at IS NULL").Order("id ASC").Limit(anomalyBatchSize).Find(&orders).Error
+		if err != nil {
+			return flagged, fmt.Errorf("failed to find unchecked orders: %w", err)
+		}
+
+		for _, order := range orders {
+			anomaly, err := s.check(ctx, order)
+			if err != nil {
+				return flagged, err
+			}
+			if anomaly {
+				flagged++
+			}
+		}
+
+		if len(orders) < anomalyBatchSize {
+			break
+		}
+	}
+
+	return flagged, s.alert(ctx, db)
+}
+
+// check compares one order with the median of its customer's earlier
+// orders and marks it checked
+func (s *AnomalyService) check(ctx context.Context, order models.Order) (bool, error) {
+	var amounts []models.Money
+	err := s.db.WithContext(ctx).Model(&models.Order{}).
+		Where("customer_id = ? AND id < ?", order.CustomerID, order.ID).
+		Order("id DESC").Limit(s.policy.History).
+		Pluck("amount", &amounts).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to learn typical amount for order %d: %w", order.ID, err)
+	}
+
+	var anomaly *models.OrderAnomaly
+	if len(amounts) >= s.policy.MinHistory && order.Amount >= s.policy.MinAmount {
+		if typical := median(amounts); typical > 0 && float64(order.Amount) >= float64(typical)*s.policy.Ratio {
+			anomaly = &models.OrderAnomaly{
+				OrderID:       order.ID,
+				CustomerID:    order.CustomerID,
+				Amount:        order.Amount,
+				TypicalAmount: typical,
+				Ratio:         float64(order.Amount) / float64(typical),
+			}
+		}
+	}
+
+	err = WithTx(ctx, s.db, func(tx *gorm.DB) error {
+		if anomaly != nil {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(anomaly).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&order).UpdateColumn("amount_checked_at", s.now()).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to record amount check for order %d: %w", order.ID, err)
+	}
+
+	if anomaly != nil {
+		log.Printf("order %d amount %s is %.1f times customer %d's typical %s", order.ID, order.Amount, anomaly.Ratio, order.CustomerID, anomaly.TypicalAmount)
+	}
+	return anomaly != nil, nil
+}
+
+// alert texts the admins about every anomaly not alerted yet. Anomalies
+// whose alert could not be sent are tried again on the next check.
+func (s *AnomalyService) alert(ctx context.Context, db *gorm.DB) error {
+	if len(s.alertPhones) == 0 {
+		return nil
+	}
+
+	var anomalies []models.OrderAnomaly
+	if err := db.Where("alerted_at IS NULL").Order("id ASC").Find(&anomalies).Error; err != nil {
+		return fmt.Errorf("failed to find anomalies to alert: %w", err)
+	}
+
+	for _, anomaly := range anomalies {
+		message := fmt.Sprintf("order alert: order %d for %s is %.0fx customer %d's usual %s",
+			anomaly.OrderID, anomaly.Amount, anomaly.Ratio, anomaly.CustomerID, anomaly.TypicalAmount)
+		result, err := s.sms.SendBulkSMS(ctx, s.alertPhones, message)
+		if err != nil {
+			log.Printf("failed to send anomaly alert for order %d: %v", anomaly.OrderID, err)
+			continue
+		}
+		for _, failed := range result.Failed() {
+			log.Printf("anomaly alert for order %d not sent to %s: %s", anomaly.OrderID, failed.Phone, failed.Error)
+		}
+
+		if err := db.Model(&anomaly).Update("alerted_at", s.now()).Error; err != nil {
+			return fmt.Errorf("failed to mark anomaly for order %d alerted: %w", anomaly.OrderID, err)
+		}
+	}
+	return nil
+}
+
+func median(values []models.Money) models.Money {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]).Scale(0.5)
+	}
+	return sorted[mid]
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrQuotaExceeded  = errors.New("monthly quota exceeded")
+)
+
+// MonthLayout is how months are written in usage reports
+const MonthLayout = "2006-01"
+
+// apiKeyPrefix starts every key, so leaked keys are easy to recognise
+const apiKeyPrefix = "sav_"
+
+// APIKeyStore issues API keys to partners and counts their requests per
+// day, in UTC, so they can be billed and held to a monthly quota
+type APIKeyStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db, now: time.Now}
+}
+
+// WithClock replaces time.Now, for tests
+func (s *APIKeyStore) WithClock(now func() time.Time) *APIKeyStore {
+	s.now = now
+	return s
+}
+
+// Create issues a key. The key itself is only returned here, in key.Key.
+func (s *APIKeyStore) Create(ctx context.Context, key *models.APIKey) error {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	secret := apiKeyPrefix + hex.EncodeToString(b)
+
+	key.KeyHash = hashAPIKey(secret)
+	key.Prefix = secret[:len(apiKeyPrefix)+8]
+	if err := s.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	key.Key = secret
+	return nil
+}
+
+// List returns every key, newest first
+func (s *APIKeyStore) List(ctx context.Context) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	err := s.db.WithContext(ctx).Order("id DESC").Find(&keys).Error
+	return keys, err
+}
+
+// Revoke stops a key from being accepted. Its usage is kept for billing.
+func (s *APIKeyStore) Revoke(ctx context.Context, id uint) (models.APIKey, error) {
+	var key models.APIKey
+	db := s.db.WithContext(ctx)
+	if err := db.First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return key, ErrAPIKeyNotFound
+		}
+		return key, err
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+
+	now := s.now()
+	key.RevokedAt = &now
+	return key, db.Model(&key).UpdateColumn("revoked_at", now).Error
+}
+
+// Authenticate returns the unrevoked key with the given secret, or
+// ErrAPIKeyNotFound
+func (s *APIKeyStore) Authenticate(ctx context.Context, secret string) (models.APIKey, error) {
+	var key models.APIKey
+	err := s.db.WithContext(ctx).Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(secret)).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return key, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+// Use counts one request made with the key and returns the requests made
+// this month, including it. Once the quota is used up the request is not
+// counted and ErrQuotaExceeded is returned. Requests racing for the last
+// of the quota may all be let through.
+func (s *APIKeyStore) Use(ctx context.Context, key models.APIKey) (int64, error) {
+	db := s.db.WithContext(ctx)
+	now := s.now().UTC()
+
+	used, err := s.monthRequests(db, key.ID, now)
+	if err != nil {
+		return 0, err
+	}
+	if key.MonthlyQuota > 0 && used >= key.MonthlyQuota {
+		return used, ErrQuotaExceeded
+	}
+
+	err = db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "api_key_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"requests": gorm.Expr("api_usages.requests + 1"), "updated_at": now}),
+	}).Create(&models.APIUsage{APIKeyID: key.ID, Day: now.Format(DayLayout), Requests: 1}).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to record api usage: %w", err)
+	}
+	return used + 1, nil
+}
+
+func (s *APIKeyStore) monthRequests(db *gorm.DB, keyID uint, now time.Time) (int64, error) {
+	from, to := monthDays(now)
+	var used int64
+	err := db.Model(&models.APIUsage{}).Where("api_key_id = ? AND day >= ? AND day < ?", keyID, from, to).
+		Select("COALESCE(SUM(requests), 0)").Scan(&used).Error
+	return used, err
+}
+
+// Usage reports each key's requests per day in the month starting at
+// month, for the key given or for every key with a zero keyID. Keys without
+// requests that month are left out.
+func (s *APIKeyStore) Usage(ctx context.Context, month time.Time, keyID uint) ([]models.APIUsageReport, error) {
+	db := s.db.WithContext(ctx)
+	from, to := monthDays(month)
+
+	query := db.Where("day >= ? AND day < ?", from, to)
+	if keyID != 0 {
+		query = query.Where("api_key_id = ?", keyID)
+	}
+	var usage []models.APIUsage
+	if err := query.Order("api_key_id ASC, day ASC").Find(&usage).Error; err != nil {
+		return nil, err
+	}
+
+	reports := []models.APIUsageReport{}
+	byKey := map[uint]int{}
+	var ids []uint
+	for _, u := range usage {
+		i, ok := byKey[u.APIKeyID]
+		if !ok {
+			i = len(reports)
+			byKey[u.APIKeyID] = i
+			ids = append(ids, u.APIKeyID)
+			reports = append(reports, models.APIUsageReport{APIKeyID: u.APIKeyID, Month: month.Format(MonthLayout), Days: []models.APIUsageDay{}})
+		}
+		reports[i].Requests += u.Requests
+		reports[i].Days = append(reports[i].Days, models.APIUsageDay{Day: u.Day, Requests: u.Requests})
+	}
+	if len(reports) == 0 {
+		return reports, nil
+	}
+
+	var keys []models.APIKey
+	if err := db.Where("id IN ?", ids).Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		r := &reports[byKey[key.ID]]
+		r.Name, r.Prefix, r.MonthlyQuota = key.Name, key.Prefix, key.MonthlyQuota
+	}
+	return reports, nil
+}
+
+// NextMonth is when the month of t ends, in UTC, and with it its quota
+func NextMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// monthDays returns the first day of t's month and of the next, in UTC
+func monthDays(t time.Time) (string, string) {
+	t = t.UTC()
+	start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return start.Format(DayLayout), NextMonth(t).Format(DayLayout)
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultArchiveAfter     = 365 * 24 * time.Hour
+	defaultArchiveBatchSize = 500
+)
+
+// ArchiveService moves finished orders past a configured age from the orders
+// table into archived_orders, keeping the hot table small.
+type ArchiveService struct {
+	db        *gorm.DB
+	after     time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+func NewArchiveService(db *gorm.DB, after time.Duration) *ArchiveService {
+	if after <= 0 {
+		after = defaultArchiveAfter
+	}
+	return &ArchiveService{
+		db:        db,
+		after:     after,
+		batchSize: defaultArchiveBatchSize,
+		now:       time.Now,
+	}
+}
+
+// ArchiveOrders moves delivered and cancelled orders created before the
+// cutoff, one batch per transaction, and returns how many were moved.
+// Open orders are never archived however old they are.
+func (s *ArchiveService) ArchiveOrders(ctx context.Context) (int, error) {
+	cutoff := s.now().Add(-s.after)
+	total := 0
+
+	for {
+		moved, err := s.archiveBatch(ctx, cutoff)
+		total += moved
+		if err != nil {
+			return total, fmt.Errorf("failed to archive orders: %w", err)
+		}
+		if moved < s.batchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *ArchiveService) archiveBatch(ctx context.Context, cutoff time.Time) (int, error) {
+	moved := 0
+
+	err := WithTx(ctx, s.db, func(tx *gorm.DB) error {
+		var orders []models.Order
+		err := tx.Where("created_at < ? AND status IN ?", cutoff,
+			[]string{models.OrderStatusDelivered, models.OrderStatusCancelled}).
+			Order("id ASC").
+			Limit(s.batchSize).
+			Find(&orders).Error
+		if err != nil || len(orders) == 0 {
+			return err
+		}
+
+		archivedAt := s.now()
+		archived := make([]models.ArchivedOrder, 0, len(orders))
+		ids := make([]uint, 0, len(orders))
+		for _, order := range orders {
+			archived = append(archived, models.ArchivedOrder{
+				ID:                  order.ID,
+				Number:              order.Number,
+				Item:                order.Item,
+				Amount:              order.Amount,
+				TaxRate:             order.TaxRate,
+				TaxInclusive:        order.TaxInclusive,
+				NetAmount:           order.NetAmount,
+				TaxAmount:           order.TaxAmount,
+				GrossAmount:         order.GrossAmount,
+				Time:                order.Time,
+				Status:              order.Status,
+				EstimatedDeliveryAt: order.EstimatedDeliveryAt,
+				ProductID:           order.ProductID,
+				Quantity:            order.Quantity,
+				CustomerID:          order.CustomerID,
+				CreatedAt:           order.CreatedAt,
+				UpdatedAt:           order.UpdatedAt,
+				ArchivedAt:          archivedAt,
+			})
+			ids = append(ids, order.ID)
+		}
+
+		if err := tx.Create(&archived).Error; err != nil {
+			return err
+		}
+		// delivery assignments reference the order, so they go with it
+		if err := tx.Where("order_id IN ?", ids).Delete(&models.DeliveryAssignment{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&models.Order{}, ids).Error; err != nil {
+			return err
+		}
+
+		moved = len(orders)
+		return nil
+	})
+
+	return moved, err
+}
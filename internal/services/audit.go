@@ -0,0 +1,26 @@
+package services
+
+import (
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type AuditLogger struct {
+	db *gorm.DB
+}
+
+func NewAuditLogger(db *gorm.DB) *AuditLogger {
+	return &AuditLogger{db: db}
+}
+
+// Record persists an audit event. Failures are logged rather than returned
+// so auditing never breaks the request being audited.
+func (a *AuditLogger) Record(event models.AuditEvent) {
+	log.Printf("audit: %s actor=%s ip=%s %s", event.Type, event.Actor, event.IP, event.Details)
+
+	if err := a.db.Create(&event).Error; err != nil {
+		log.Printf("failed to record audit event %s: %v", event.Type, err)
+	}
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCampaignNotFound = errors.New("campaign not found")
+	// ErrCampaignFinished is returned when cancelling a campaign that has
+	// completed or was cancelled already
+	ErrCampaignFinished = errors.New("campaign has finished")
+)
+
+// CampaignPolicy sets how fast campaigns are sent and when they may not be
+type CampaignPolicy struct {
+	// DailyQuota caps the campaign messages sent per day, across all
+	// campaigns; 0 for no limit. Messages over it wait for the next day.
+	DailyQuota int
+	// BatchSize caps the messages sent per run, which with the run's
+	// interval sets how fast a campaign goes out
+	BatchSize int
+	// Nothing is sent from QuietStart to QuietEnd, hours of the day in
+	// Location, e.g. 21 to 8. Equal hours mean no quiet hours.
+	QuietStart int
+	QuietEnd   int
+	// Location is the time zone of the quiet hours and the daily quota
+	Location *time.Location
+}
+
+func DefaultCampaignPolicy() CampaignPolicy {
+	return CampaignPolicy{
+		BatchSize:  200,
+		QuietStart: 21,
+		QuietEnd:   8,
+	}
+}
+
+// CampaignPolicyFromEnv reads CAMPAIGN_DAILY_QUOTA, CAMPAIGN_BATCH_SIZE and
+// CAMPAIGN_QUIET_HOURS (e.g. 21-8, or off) over the defaults
+func CampaignPolicyFromEnv() CampaignPolicy {
+	policy := DefaultCampaignPolicy()
+
+	if n, err := strconv.Atoi(os.Getenv("CAMPAIGN_DAILY_QUOTA")); err == nil && n >= 0 {
+		policy.DailyQuota = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("CAMPAIGN_BATCH_SIZE")); err == nil && n > 0 {
+		policy.BatchSize = n
+	}
+	quiet := strings.TrimSpace(os.Getenv("CAMPAIGN_QUIET_HOURS"))
+	if strings.EqualFold(quiet, "off") {
+		policy.QuietStart, policy.QuietEnd = 0, 0
+	} else if start, end, ok := strings.Cut(quiet, "-"); ok {
+		from, err1 := strconv.Atoi(strings.TrimSpace(start))
+		to, err2 := strconv.Atoi(strings.TrimSpace(end))
+		if err1 == nil && err2 == nil && validHour(from) && validHour(to) {
+			policy.QuietStart, policy.QuietEnd = from, to
+		}
+	}
+	return policy
+}
+
+// WithDefaults fills unset or invalid fields from DefaultCampaignPolicy
+func (p CampaignPolicy) WithDefaults() CampaignPolicy {
+	defaults := DefaultCampaignPolicy()
+	if p.DailyQuota < 0 {
+		p.DailyQuota = 0
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = defaults.BatchSize
+	}
+	if !validHour(p.QuietStart) || !validHour(p.QuietEnd) {
+		p.QuietStart, p.QuietEnd = defaults.QuietStart, defaults.QuietEnd
+	}
+	if p.Location == nil {
+		p.Location = time.UTC
+	}
+	return p
+}
+
+// Quiet reports whether t falls in the quiet hours
+func (p CampaignPolicy) Quiet(t time.Time) bool {
+	hour := t.In(p.Location).Hour()
+	if p.QuietStart < p.QuietEnd {
+		return hour >= p.QuietStart && hour < p.QuietEnd
+	}
+	if p.QuietStart > p.QuietEnd {
+		// across midnight
+		return hour >= p.QuietStart || hour < p.QuietEnd
+	}
+	return false
+}
+
+func validHour(hour int) bool {
+	return hour >= 0 && hour < 24
+}
+
+// CampaignService sends the SMS campaigns admins schedule to tagged
+// customers, and tracks each message until it is delivered
+type CampaignService struct {
+	db     *gorm.DB
+	sms    SMSServiceInterface
+	policy CampaignPolicy
+	now    func() time.Time
+}
+
+func NewCampaignService(db *gorm.DB, sms SMSServiceInterface, policy CampaignPolicy) *CampaignService {
+	return &CampaignService{
+		db:     db,
+		sms:    sms,
+		policy: policy.WithDefaults(),
+		now:    time.Now,
+	}
+}
+
+// WithClock replaces time.Now, for tests
+func (s *CampaignService) WithClock(now func() time.Time) *CampaignService {
+	s.now = now
+	return s
+}
+
+// Create schedules campaign, to go out on the next run when it has no
+// SendAt
+func (s *CampaignService) Create(ctx context.Context, campaign *models.Campaign) error {
+	if campaign.SendAt.IsZero() {
+		campaign.SendAt = s.now()
+	}
+	campaign.Status = models.CampaignScheduled
+	if err := s.db.WithContext(ctx).Create(campaign).Error; err != nil {
+		return fmt.Errorf("failed to create campaign: %w", err)
+	}
+	campaign.Stats = &models.CampaignStats{}
+	return nil
+}
+
+// Campaigns returns every campaign with its stats, newest first
+func (s *CampaignService) Campaigns(ctx context.Context) ([]models.Campaign, error) {
+	campaigns := []models.Campaign{}
+	if err := s.db.WithContext(ctx).Order("id DESC").Find(&campaigns).Error; err != nil {
+		return campaigns, err
+	}
+	return campaigns, s.withStats(ctx, campaigns)
+}
+
+// Campaign returns a campaign with its stats
+func (s *CampaignService) Campaign(ctx context.Context, id uint) (models.Campaign, error) {
+	var campaign models.Campaign
+	if err := s.db.WithContext(ctx).First(&campaign, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return campaign, ErrCampaignNotFound
+		}
+		return campaign, err
+	}
+	campaigns := []models.Campaign{campaign}
+	err := s.withStats(ctx, campaigns)
+	return campaigns[0], err
+}
+
+// withStats counts the recipients of campaigns by status
+func (s *CampaignService) withStats(ctx context.Context, campaigns []models.Campaign) error {
+	if len(campaigns) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(campaigns))
+	byID := make(map[uint]*models.CampaignStats, len(campaigns))
+	for i := range campaigns {
+		ids[i] = campaigns[i].ID
+		campaigns[i].Stats = &models.CampaignStats{}
+		byID[campaigns[i].ID] = campaigns[i].Stats
+	}
+
+	var counts []struct {
+		CampaignID uint
+		Status     string
+		Count      int64
+	}
+	err := s.db.WithContext(ctx).Model(&models.CampaignRecipient{}).
+		Select("campaign_id, status, COUNT(*) AS count").
+		Where("campaign_id IN ?", ids).
+		Group("campaign_id, status").
+		Scan(&counts).Error
+	if err != nil {
+		return fmt.Errorf("failed to count campaign recipients: %w", err)
+	}
+
+	for _, count := range counts {
+		stats := byID[count.CampaignID]
+		switch count.Status {
+		case models.CampaignRecipientPending:
+			stats.Pending = count.Count
+		case models.CampaignRecipientSent:
+			stats.Sent = count.Count
+		case models.CampaignRecipientDelivered:
+			stats.Delivered = count.Count
+		case models.CampaignRecipientFailed:
+			stats.Failed = count.Count
+		case models.CampaignRecipientSkipped:
+			stats.Skipped = count.Count
+		}
+	}
+	return nil
+}
+
+// Cancel stops a campaign that is scheduled or sending. Recipients not
+// texted yet are skipped; messages already sent are still tracked.
+func (s *CampaignService) Cancel(ctx context.Context, id uint) (models.Campaign, error) {
+	campaign, err := s.Campaign(ctx, id)
+	if err != nil {
+		return campaign, err
+	}
+
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Campaign{}).
+			Where("id = ? AND status IN ?", id, []string{models.CampaignScheduled, models.CampaignSending}).
+			Updates(map[string]interface{}{"status": models.CampaignCancelled, "completed_at": s.now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrCampaignFinished
+		}
+		return tx.Model(&models.CampaignRecipient{}).
+			Where("campaign_id = ? AND status = ?", id, models.CampaignRecipientPending).
+			Updates(map[string]interface{}{"status": models.CampaignRecipientSkipped, "error": "campaign cancelled"}).Error
+	})
+	if err != nil {
+		return campaign, err
+	}
+	return s.Campaign(ctx, id)
+}
+
+// Run lists the recipients of campaigns that are due, then texts up to
+// BatchSize pending recipients within what is left of the daily quota.
+// Nothing is sent in the quiet hours. It returns how many messages were
+// sent.
+func (s *CampaignService) Run(ctx context.Context) (int, error) {
+	now := s.now()
+	if s.policy.Quiet(now) {
+		return 0, nil
+	}
+	if err := s.start(ctx, now); err != nil {
+		return 0, err
+	}
+
+	limit := s.policy.BatchSize
+	if s.policy.DailyQuota > 0 {
+		local := now.In(s.policy.Location)
+		midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, s.policy.Location)
+
+		var today int64
+		if err := s.db.WithContext(ctx).Model(&models.CampaignRecipient{}).Where("sent_at >= ?", midnight).Count(&today).Error; err != nil {
+			return 0, fmt.Errorf("failed to count today's campaign messages: %w", err)
+		}
+		limit = min(limit, s.policy.DailyQuota-int(today))
+	}
+
+	sent := 0
+	if limit > 0 {
+		var recipients []models.CampaignRecipient
+		err := s.db.WithContext(ctx).
+			Where("status = ? AND campaign_id IN (SELECT id FROM campaigns WHERE status = ?)", models.CampaignRecipientPending, models.CampaignSending).
+			Order("id ASC").Limit(limit).
+			Find(&recipients).Error
+		if err != nil {
+			return 0, fmt.Errorf("failed to find campaign recipients: %w", err)
+		}
+		if sent, err = s.send(ctx, recipients); err != nil {
+			return sent, err
+		}
+	}
+
+	err := s.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("status = ?", models.CampaignSending).
+		Where("NOT EXISTS (SELECT 1 FROM campaign_recipients r WHERE r.campaign_id = campaigns.id AND r.status = ?)", models.CampaignRecipientPending).
+		Updates(map[string]interface{}{"status": models.CampaignCompleted, "completed_at": s.now()}).Error
+	if err != nil {
+		return sent, fmt.Errorf("failed to complete campaigns: %w", err)
+	}
+	return sent, nil
+}
+
+// start lists the recipients of the scheduled campaigns whose SendAt has
+// come: the customers with any of the campaign's tags who have not opted
+// out, been anonymized or deleted
+func (s *CampaignService) start(ctx context.Context, now time.Time) error {
+	var campaigns []models.Campaign
+	err := s.db.WithContext(ctx).Where("status = ? AND send_at <= ?", models.CampaignScheduled, now).Order("id ASC").Find(&campaigns).Error
+	if err != nil {
+		return fmt.Errorf("failed to find due campaigns: %w", err)
+	}
+
+	for _, campaign := range campaigns {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			started := tx.Model(&models.Campaign{}).Where("id = ? AND status = ?", campaign.ID, models.CampaignScheduled).
+				Updates(map[string]interface{}{"status": models.CampaignSending, "started_at": now})
+			if started.Error != nil || started.RowsAffected == 0 {
+				// cancelled meanwhile
+				return started.Error
+			}
+
+			listed := tx.Exec("INSERT INTO campaign_recipients (campaign_id, customer_id, status, created_at, updated_at) "+
+				"SELECT ?, customers.id, ?, ?, ? FROM customers "+
+				"WHERE customers.deleted_at IS NULL AND customers.marketing_opt_out_at IS NULL AND customers.anonymized_at IS NULL "+
+				"AND EXISTS (SELECT 1 FROM customer_tags t WHERE t.customer_id = customers.id AND t.tag IN ?)",
+				campaign.ID, models.CampaignRecipientPending, now, now, campaign.Tags)
+			if listed.Error != nil {
+				return listed.Error
+			}
+			return tx.Model(&models.Campaign{}).Where("id = ?", campaign.ID).UpdateColumn("recipients", listed.RowsAffected).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start campaign %d: %w", campaign.ID, err)
+		}
+	}
+	return nil
+}
+
+// campaignText is the rendered message of a campaign, sent in one bulk
+// request to every recipient it reads the same for
+type campaignText struct {
+	campaignID uint
+	text       string
+}
+
+// send texts recipients, checking again that each may still be texted, and
+// records how each message went
+func (s *CampaignService) send(ctx context.Context, recipients []models.CampaignRecipient) (int, error) {
+	if len(recipients) == 0 {
+		return 0, nil
+	}
+	db := s.db.WithContext(ctx)
+
+	campaignIDs := []uint{}
+	customerIDs := make([]uint, len(recipients))
+	for i, recipient := range recipients {
+		customerIDs[i] = recipient.CustomerID
+		if i == 0 || recipient.CampaignID != recipients[i-1].CampaignID {
+			campaignIDs = append(campaignIDs, recipient.CampaignID)
+		}
+	}
+	var campaignList []models.Campaign
+	if err := db.Where("id IN ?", campaignIDs).Find(&campaignList).Error; err != nil {
+		return 0, fmt.Errorf("failed to load campaigns: %w", err)
+	}
+	campaigns := make(map[uint]models.Campaign, len(campaignList))
+	for _, campaign := range campaignList {
+		campaigns[campaign.ID] = campaign
+	}
+	var customerList []models.Customer
+	if err := db.Where("id IN ?", customerIDs).Find(&customerList).Error; err != nil {
+		return 0, fmt.Errorf("failed to load campaign recipients: %w", err)
+	}
+	customers := make(map[uint]models.Customer, len(customerList))
+	for _, customer := range customerList {
+		customers[customer.ID] = customer
+	}
+
+	var texts []campaignText
+	phones := map[campaignText][]string{}
+	byPhone := map[campaignText]map[string]models.CampaignRecipient{}
+	for _, recipient := range recipients {
+		customer, ok := customers[recipient.CustomerID]
+		reason := ""
+		switch {
+		case !ok:
+			reason = "customer deleted"
+		case customer.MarketingOptOutAt != nil:
+			reason = "customer opted out"
+		case customer.AnonymizedAt != nil:
+			reason = "customer anonymized"
+		}
+		if reason != "" {
+			if err := s.skip(db, recipient, reason); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		key := campaignText{recipient.CampaignID, campaignMessage(campaigns[recipient.CampaignID].Message, customer)}
+		if byPhone[key] == nil {
+			texts = append(texts, key)
+			byPhone[key] = map[string]models.CampaignRecipient{}
+		}
+		phone := formatPhoneNumber(customer.Phone)
+		if _, ok := byPhone[key][phone]; ok {
+			// customers sharing a phone get the message once
+			if err := s.skip(db, recipient, "phone already texted"); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		byPhone[key][phone] = recipient
+		phones[key] = append(phones[key], phone)
+	}
+
+	sent := 0
+	for _, key := range texts {
+		result, sendErr := s.sms.SendBulkSMS(ctx, phones[key], key.text)
+		if sendErr != nil && ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+		results := make(map[string]RecipientResult, len(result.Recipients))
+		for _, r := range result.Recipients {
+			results[r.Phone] = r
+		}
+
+		now := s.now()
+		for _, phone := range phones[key] {
+			recipient := byPhone[key][phone]
+			updates := map[string]interface{}{"status": models.CampaignRecipientFailed, "sent_at": now}
+			r, ok := results[phone]
+			switch {
+			case ok && r.Sent:
+				updates["status"] = models.CampaignRecipientSent
+				if r.MessageID != "" {
+					updates["provider_message_id"] = r.MessageID
+				}
+				sent++
+			case ok && r.Error != "":
+				updates["error"] = r.Error
+			case sendErr != nil:
+				updates["error"] = sendErr.Error()
+			default:
+				updates["error"] = "missing from provider response"
+			}
+			if updates["status"] == models.CampaignRecipientFailed {
+				log.Printf("failed to send campaign %d to customer %d: %v", recipient.CampaignID, recipient.CustomerID, updates["error"])
+			}
+			if err := db.Model(&models.CampaignRecipient{}).Where("id = ?", recipient.ID).Updates(updates).Error; err != nil {
+				return sent, fmt.Errorf("failed to record campaign %d message to customer %d: %w", recipient.CampaignID, recipient.CustomerID, err)
+			}
+		}
+	}
+	return sent, nil
+}
+
+func (s *CampaignService) skip(db *gorm.DB, recipient models.CampaignRecipient, reason string) error {
+	err := db.Model(&models.CampaignRecipient{}).Where("id = ?", recipient.ID).
+		Updates(map[string]interface{}{"status": models.CampaignRecipientSkipped, "error": reason}).Error
+	if err != nil {
+		return fmt.Errorf("failed to skip customer %d of campaign %d: %w", recipient.CustomerID, recipient.CampaignID, err)
+	}
+	return nil
+}
+
+// campaignMessage fills in the placeholders of message for customer and
+// makes sure the text says how to opt out
+func campaignMessage(message string, customer models.Customer) string {
+	firstName, _, _ := strings.Cut(strings.TrimSpace(customer.Name), " ")
+	return withOptOut(strings.NewReplacer(
+		"{name}", customer.Name,
+		"{first_name}", firstName,
+		"{code}", customer.Code,
+	).Replace(message))
+}
+
+// RecordDelivery applies a provider delivery report to the campaign
+// message it is about. Reports of messages still on their way are ignored.
+// It reports whether the message was a campaign's.
+func (s *CampaignService) RecordDelivery(ctx context.Context, report models.SMSDeliveryReportRequest) (bool, error) {
+	updates := map[string]interface{}{}
+	switch report.Status {
+	case "Success":
+		updates["status"] = models.CampaignRecipientDelivered
+		updates["delivered_at"] = s.now()
+	case "Failed", "Rejected", "AbsentSubscriber", "Expired":
+		updates["status"] = models.CampaignRecipientFailed
+		updates["error"] = report.Status
+		if report.FailureReason != "" {
+			updates["error"] = report.Status + ": " + report.FailureReason
+		}
+	}
+
+	db := s.db.WithContext(ctx)
+	if len(updates) == 0 {
+		var count int64
+		err := db.Model(&models.CampaignRecipient{}).Where("provider_message_id = ?", report.ID).Count(&count).Error
+		return count > 0, err
+	}
+	result := db.Model(&models.CampaignRecipient{}).
+		Where("provider_message_id = ? AND status = ?", report.ID, models.CampaignRecipientSent).
+		Updates(updates)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record delivery of message %s: %w", report.ID, result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
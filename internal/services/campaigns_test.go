@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// campaignSMS answers bulk sends with a message id per recipient, failing
+// the numbers in failing
+type campaignSMS struct {
+	*MockSMSService
+	failing map[string]bool
+	sent    int
+}
+
+func (s *campaignSMS) SendBulkSMS(ctx context.Context, recipients []string, message string) (BulkSMSResult, error) {
+	result := BulkSMSResult{}
+	for _, phone := range recipients {
+		if s.failing[phone] {
+			result.Recipients = append(result.Recipients, RecipientResult{Phone: phone, Status: "InvalidPhoneNumber", Error: "InvalidPhoneNumber (code: 403)"})
+			continue
+		}
+		s.sent++
+		s.MockSMSService.SendSMS(ctx, phone, message)
+		result.Recipients = append(result.Recipients, RecipientResult{Phone: phone, Sent: true, Status: "Success", MessageID: fmt.Sprintf("ATXid_%d", s.sent)})
+	}
+	return result, nil
+}
+
+func TestCampaignPolicyFromEnv(t *testing.T) {
+	t.Setenv("CAMPAIGN_DAILY_QUOTA", "5000")
+	t.Setenv("CAMPAIGN_BATCH_SIZE", "50")
+	t.Setenv("CAMPAIGN_QUIET_HOURS", "22-7")
+	assert.Equal(t, CampaignPolicy{DailyQuota: 5000, BatchSize: 50, QuietStart: 22, QuietEnd: 7}, CampaignPolicyFromEnv())
+
+	t.Setenv("CAMPAIGN_QUIET_HOURS", "off")
+	assert.Equal(t, CampaignPolicy{DailyQuota: 5000, BatchSize: 50}, CampaignPolicyFromEnv())
+
+	t.Setenv("CAMPAIGN_DAILY_QUOTA", "-1")
+	t.Setenv("CAMPAIGN_BATCH_SIZE", "0")
+	t.Setenv("CAMPAIGN_QUIET_HOURS", "21-25")
+	assert.Equal(t, DefaultCampaignPolicy(), CampaignPolicyFromEnv(), "invalid values keep the defaults")
+}
+
+func TestCampaignPolicyQuiet(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2026, 3, 10, hour, 30, 0, 0, time.UTC) }
+
+	overnight := CampaignPolicy{QuietStart: 21, QuietEnd: 8}.WithDefaults()
+	assert.True(t, overnight.Quiet(at(22)))
+	assert.True(t, overnight.Quiet(at(7)))
+	assert.False(t, overnight.Quiet(at(8)))
+	assert.False(t, overnight.Quiet(at(20)))
+	// 05:30 UTC is 08:30 in Nairobi
+	assert.False(t, CampaignPolicy{QuietStart: 21, QuietEnd: 8, Location: time.FixedZone("EAT", 3*60*60)}.Quiet(at(5)))
+
+	afternoon := CampaignPolicy{QuietStart: 13, QuietEnd: 14}.WithDefaults()
+	assert.True(t, afternoon.Quiet(at(13)))
+	assert.False(t, afternoon.Quiet(at(14)))
+
+	assert.False(t, CampaignPolicy{}.WithDefaults().Quiet(at(3)), "equal hours are no quiet hours")
+}
+
+func TestCampaignService(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+
+	tag := func(customer models.Customer, tags ...string) models.Customer {
+		for _, tag := range tags {
+			require.NoError(t, db.Create(&models.CustomerTag{CustomerID: customer.ID, Tag: tag}).Error)
+		}
+		return customer
+	}
+	optedOut := time.Now()
+	sebbie := tag(testutil.NewCustomer(t).WithName("Sebbie Chanzu").WithCode("CUST001").WithPhone("0740827150").Create(db), "vip", "nairobi")
+	amina := tag(testutil.NewCustomer(t).WithName("Amina Hassan").WithPhone("+254711222333").Create(db), "nairobi")
+	tag(testutil.NewCustomer(t).WithPhone("+254711000003").OptedOut(optedOut).Create(db), "vip")
+	brian := tag(testutil.NewCustomer(t).WithName("Brian Kip").WithPhone("+254711000004").Create(db), "vip")
+	wanjiru := tag(testutil.NewCustomer(t).WithName("Wanjiru Mwangi").WithPhone("+254711000005").Create(db), "vip")
+	tag(testutil.NewCustomer(t).WithPhone("+254711000006").Create(db), "mombasa")
+
+	// 10:00 in Nairobi
+	now := time.Date(2026, 3, 10, 7, 0, 0, 0, time.UTC)
+	sms := &campaignSMS{MockSMSService: NewMockSMSService(), failing: map[string]bool{"+254711000004": true}}
+	policy := CampaignPolicy{DailyQuota: 3, BatchSize: 2, QuietStart: 21, QuietEnd: 8, Location: time.FixedZone("EAT", 3*60*60)}
+	service := NewCampaignService(db, sms, policy).WithClock(func() time.Time { return now })
+
+	campaign := models.Campaign{Name: "March offer", Message: "Hi {first_name} ({code}), 10% off this week", Tags: []string{"vip", "nairobi"}, SendAt: now.Add(time.Hour)}
+	require.NoError(t, service.Create(ctx, &campaign))
+	assert.Equal(t, models.CampaignScheduled, campaign.Status)
+
+	sent, err := service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "not due yet")
+
+	// 22:00 in Nairobi
+	now = now.Add(12 * time.Hour)
+	sent, err = service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "quiet hours")
+
+	// 09:00 the next day
+	now = now.Add(11 * time.Hour)
+	sent, err = service.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	require.Len(t, sms.SentMessages, 2)
+	assert.Equal(t, MockSMSMessage{To: "+254740827150", Message: "Hi Sebbie (CUST001), 10% off this week. " + marketingOptOut}, sms.SentMessages[0])
+	assert.Equal(t, "+254711222333", sms.SentMessages[1].To)
+
+	campaign, err = service.Campaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CampaignSending, campaign.Status)
+	assert.Equal(t, 4, campaign.Recipients, "opted out and untagged customers are left out")
+	assert.Equal(t, models.CampaignStats{Pending: 2, Sent: 2}, *campaign.Stats)
+
+	// Wanjiru opts out after being listed
+	require.NoError(t, db.Model(&wanjiru).UpdateColumn("marketing_opt_out_at", now).Error)
+
+	now = now.Add(time.Minute)
+	sent, err = service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "the daily quota of 3 leaves one message, to Brian, which fails")
+
+	campaign, err = service.Campaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CampaignStats{Pending: 1, Sent: 2, Failed: 1}, *campaign.Stats)
+
+	sent, err = service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "over the quota")
+
+	// the next morning
+	now = now.Add(24 * time.Hour)
+	sent, err = service.Run(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+
+	campaign, err = service.Campaign(ctx, campaign.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.CampaignCompleted, campaign.Status)
+	assert.NotNil(t, campaign.CompletedAt)
+	assert.Equal(t, models.CampaignStats{Sent: 2, Failed: 1, Skipped: 1}, *campaign.Stats)
+
+	var recipients []models.CampaignRecipient
+	require.NoError(t, db.Where("campaign_id = ?", campaign.ID).Order("customer_id").Find(&recipients).Error)
+	require.Len(t, recipients, 4)
+	assert.Equal(t, sebbie.ID, recipients[0].CustomerID)
+	assert.Equal(t, "ATXid_1", *recipients[0].ProviderMessageID)
+	assert.Equal(t, amina.ID, recipients[1].CustomerID)
+	assert.Equal(t, brian.ID, recipients[2].CustomerID)
+	assert.Equal(t, "InvalidPhoneNumber (code: 403)", recipients[2].Error)
+	assert.Equal(t, "customer opted out", recipients[3].Error)
+
+	t.Run("delivery reports", func(t *testing.T) {
+		matched, err := service.RecordDelivery(ctx, models.SMSDeliveryReportRequest{ID: "ATXid_1", Status: "Buffered"})
+		require.NoError(t, err)
+		assert.True(t, matched)
+
+		matched, err = service.RecordDelivery(ctx, models.SMSDeliveryReportRequest{ID: "ATXid_1", Status: "Success"})
+		require.NoError(t, err)
+		assert.True(t, matched)
+		matched, err = service.RecordDelivery(ctx, models.SMSDeliveryReportRequest{ID: "ATXid_2", Status: "Failed", FailureReason: "AbsentSubscriber"})
+		require.NoError(t, err)
+		assert.True(t, matched)
+
+		matched, err = service.RecordDelivery(ctx, models.SMSDeliveryReportRequest{ID: "ATXid_1", Status: "Failed"})
+		require.NoError(t, err)
+		assert.False(t, matched, "a delivered message stays delivered")
+		matched, err = service.RecordDelivery(ctx, models.SMSDeliveryReportRequest{ID: "ATXid_other", Status: "Success"})
+		require.NoError(t, err)
+		assert.False(t, matched)
+
+		campaign, err := service.Campaign(ctx, campaign.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.CampaignStats{Delivered: 1, Failed: 2, Skipped: 1}, *campaign.Stats)
+
+		var failed models.CampaignRecipient
+		require.NoError(t, db.Where("provider_message_id = ?", "ATXid_2").First(&failed).Error)
+		assert.Equal(t, "Failed: AbsentSubscriber", failed.Error)
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		_, err := service.Cancel(ctx, campaign.ID)
+		assert.ErrorIs(t, err, ErrCampaignFinished)
+		_, err = service.Cancel(ctx, 999)
+		assert.ErrorIs(t, err, ErrCampaignNotFound)
+
+		later := models.Campaign{Name: "Later", Message: "Hi {name}, reply STOP to opt out", Tags: []string{"mombasa"}}
+		require.NoError(t, service.Create(ctx, &later))
+		cancelled, err := service.Cancel(ctx, later.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.CampaignCancelled, cancelled.Status)
+
+		sent, err := service.Run(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, sent)
+		var count int64
+		require.NoError(t, db.Model(&models.CampaignRecipient{}).Where("campaign_id = ?", later.ID).Count(&count).Error)
+		assert.Zero(t, count, "a cancelled campaign is never listed")
+	})
+
+	campaigns, err := service.Campaigns(ctx)
+	require.NoError(t, err)
+	require.Len(t, campaigns, 2)
+	assert.Equal(t, "Later", campaigns[0].Name)
+	assert.NotNil(t, campaigns[1].Stats)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const fastlyBaseURL = "https://api.fastly.com"
+
+// CatalogCacheKey tags every cached catalog response, so a product change
+// purges the lists it may appear in
+const CatalogCacheKey = "products"
+
+// OrderCacheKey tags cached responses showing the order
+func OrderCacheKey(id uint) string {
+	return fmt.Sprintf("order-%d", id)
+}
+
+// ProductCacheKey tags cached responses showing the product
+func ProductCacheKey(id uint) string {
+	return fmt.Sprintf("product-%d", id)
+}
+
+// CachePolicy sets how long the CDN may keep the public responses. Purges
+// evict them sooner when what they show changes.
+type CachePolicy struct {
+	TrackingTTL time.Duration
+	CatalogTTL  time.Duration
+}
+
+func DefaultCachePolicy() CachePolicy {
+	return CachePolicy{
+		TrackingTTL: time.Minute,
+		CatalogTTL:  5 * time.Minute,
+	}
+}
+
+// WithDefaults fills unset TTLs from DefaultCachePolicy
+func (p CachePolicy) WithDefaults() CachePolicy {
+	defaults := DefaultCachePolicy()
+	if p.TrackingTTL <= 0 {
+		p.TrackingTTL = defaults.TrackingTTL
+	}
+	if p.CatalogTTL <= 0 {
+		p.CatalogTTL = defaults.CatalogTTL
+	}
+	return p
+}
+
+// CachePolicyFromEnv reads CACHE_TRACKING_TTL and CACHE_CATALOG_TTL over
+// the defaults
+func CachePolicyFromEnv() CachePolicy {
+	policy := DefaultCachePolicy()
+	if d, err := time.ParseDuration(os.Getenv("CACHE_TRACKING_TTL")); err == nil && d > 0 {
+		policy.TrackingTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("CACHE_CATALOG_TTL")); err == nil && d > 0 {
+		policy.CatalogTTL = d
+	}
+	return policy
+}
+
+// FastlyPurger purges by surrogate key through the Fastly API
+type FastlyPurger struct {
+	serviceID string
+	token     string
+	baseURL   string
+	client    *ResilientClient
+}
+
+func NewFastlyPurger(serviceID, token string) *FastlyPurger {
+	return &FastlyPurger{
+		serviceID: serviceID,
+		token:     token,
+		baseURL:   fastlyBaseURL,
+		client:    NewResilientClient(DefaultHTTPClientConfig()),
+	}
+}
+
+// FastlyPurgerFromEnv reads FASTLY_SERVICE_ID and FASTLY_API_TOKEN, and the
+// CDN_ client settings. It returns nil when no CDN is configured.
+func FastlyPurgerFromEnv() *FastlyPurger {
+	serviceID := os.Getenv("FASTLY_SERVICE_ID")
+	token := os.Getenv("FASTLY_API_TOKEN")
+	if serviceID == "" || token == "" {
+		return nil
+	}
+	return NewFastlyPurger(serviceID, token).WithHTTPClient(NewResilientClient(HTTPClientConfigFromEnv("CDN")))
+}
+
+// WithHTTPClient replaces the default API client, e.g. to tune timeouts
+func (p *FastlyPurger) WithHTTPClient(client *ResilientClient) *FastlyPurger {
+	p.client = client
+	return p
+}
+
+// Purge marks everything tagged with any of keys as stale, so the next
+// request is fetched from the API while stale copies can still be served
+// if it is down
+func (p *FastlyPurger) Purge(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	url := fmt.Sprintf("%s/service/%s/purge", p.baseURL, p.serviceID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Fastly-Key", p.token)
+	req.Header.Set("Fastly-Soft-Purge", "1")
+	req.Header.Set("Surrogate-Key", strings.Join(keys, " "))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to purge: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("purge failed with status %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// MockCachePurger records purged keys instead of purging them
+type MockCachePurger struct {
+	mu     sync.Mutex
+	purged []string
+}
+
+func NewMockCachePurger() *MockCachePurger {
+	return &MockCachePurger{}
+}
+
+func (m *MockCachePurger) Purge(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.purged = append(m.purged, keys...)
+	return nil
+}
+
+// Purged returns every key purged so far
+func (m *MockCachePurger) Purged() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.purged...)
+}
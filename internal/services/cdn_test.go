@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFastlyPurgerPurge(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	const endpoint = "https://api.fastly.com/service/svc-1/purge"
+
+	tests := []struct {
+		name          string
+		status        int
+		expectedError string
+	}{
+		{name: "purged", status: http.StatusOK},
+		{name: "rejected", status: http.StatusUnauthorized, expectedError: "purge failed with status 401: {\"msg\":\"Provided credentials are missing or invalid\"}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Reset()
+
+			var header http.Header
+			httpmock.RegisterResponder("POST", endpoint, func(req *http.Request) (*http.Response, error) {
+				header = req.Header
+				if tt.status != http.StatusOK {
+					return httpmock.NewStringResponse(tt.status, `{"msg":"Provided credentials are missing or invalid"}`), nil
+				}
+				return httpmock.NewStringResponse(tt.status, `{"status":"ok"}`), nil
+			})
+
+			purger := NewFastlyPurger("svc-1", "token-1").WithHTTPClient(newTestResilientClient())
+			err := purger.Purge(context.Background(), OrderCacheKey(7), CatalogCacheKey)
+
+			assert.Equal(t, 1, httpmock.GetTotalCallCount())
+			assert.Equal(t, "order-7 products", header.Get("Surrogate-Key"))
+			assert.Equal(t, "token-1", header.Get("Fastly-Key"))
+			assert.Equal(t, "1", header.Get("Fastly-Soft-Purge"))
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFastlyPurgerFromEnvUnset(t *testing.T) {
+	t.Setenv("FASTLY_SERVICE_ID", "svc-1")
+	t.Setenv("FASTLY_API_TOKEN", "")
+
+	assert.Nil(t, FastlyPurgerFromEnv())
+}
+
+func TestCachePolicyFromEnv(t *testing.T) {
+	t.Setenv("CACHE_TRACKING_TTL", "30s")
+	t.Setenv("CACHE_CATALOG_TTL", "nope")
+
+	policy := CachePolicyFromEnv()
+	assert.Equal(t, 30*time.Second, policy.TrackingTTL)
+	assert.Equal(t, 5*time.Minute, policy.CatalogTTL)
+}
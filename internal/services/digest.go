@@ -0,0 +1,310 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoDigestRecipients is returned when a digest has nobody to go to
+var ErrNoDigestRecipients = errors.New("no digest recipients")
+
+// digestClaimTimeout is how long a scheduled digest may stay sending
+// before another run takes it over, as the instance sending it went away
+const digestClaimTimeout = time.Hour
+
+// DigestService emails admins a summary of each day's orders and text
+// messages, with the orders attached as CSV and PDF
+type DigestService struct {
+	db         *gorm.DB
+	email      EmailSender
+	location   *time.Location
+	recipients []string
+	now        func() time.Time
+}
+
+func NewDigestService(db *gorm.DB, email EmailSender, location *time.Location, recipients []string) *DigestService {
+	if location == nil {
+		location = time.UTC
+	}
+	return &DigestService{db: db, email: email, location: location, recipients: recipients, now: time.Now}
+}
+
+// Configured reports whether digests can be emailed
+func (s *DigestService) Configured() bool {
+	return s.email != nil
+}
+
+// Location is the timezone days are computed in
+func (s *DigestService) Location() *time.Location {
+	return s.location
+}
+
+// Yesterday is the day the daily digest covers
+func (s *DigestService) Yesterday() time.Time {
+	now := s.now().In(s.location)
+	return time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, s.location)
+}
+
+// Compile summarizes the orders placed and the text messages sent and
+// received on day, over live and archived orders
+func (s *DigestService) Compile(ctx context.Context, day time.Time) (models.OrderDigest, error) {
+	db := s.db.WithContext(ctx)
+	day = day.In(s.location)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, s.location)
+	next := start.AddDate(0, 0, 1)
+	digest := models.OrderDigest{Day: start.Format(DayLayout), Orders: []models.DigestOrder{}}
+
+	for _, model := range []interface{}{&models.Order{}, &models.ArchivedOrder{}} {
+		var orders []models.DigestOrder
+		err := db.Model(model).
+			Select("id, time, customer_id, item, quantity, amount, status").
+			Where("time >= ? AND time < ?", start, next).
+			Scan(&orders).Error
+		if err != nil {
+			return digest, fmt.Errorf("failed to load orders for %s: %w", digest.Day, err)
+		}
+		digest.Orders = append(digest.Orders, orders...)
+	}
+	sort.Slice(digest.Orders, func(i, j int) bool {
+		if !digest.Orders[i].Time.Equal(digest.Orders[j].Time) {
+			return digest.Orders[i].Time.Before(digest.Orders[j].Time)
+		}
+		return digest.Orders[i].ID < digest.Orders[j].ID
+	})
+	for _, order := range digest.Orders {
+		if order.Status == models.OrderStatusCancelled {
+			digest.CancelledCount++
+			continue
+		}
+		digest.OrdersCount++
+		digest.Revenue += order.Amount
+	}
+
+	var messages []struct {
+		Direction string
+		Count     int64
+		Segments  int64
+		Cost      models.Money
+	}
+	err := db.Model(&models.SMSMessage{}).
+		Select("direction, COUNT(*) AS count, COALESCE(SUM(segments), 0) AS segments, COALESCE(SUM(estimated_cost), 0) AS cost").
+		Where("created_at >= ? AND created_at < ? AND dry_run = ?", start, next, false).
+		Group("direction").
+		Scan(&messages).Error
+	if err != nil {
+		return digest, fmt.Errorf("failed to count text messages for %s: %w", digest.Day, err)
+	}
+	for _, m := range messages {
+		switch m.Direction {
+		case models.SMSDirectionOutbound:
+			digest.SMSSent = m.Count
+			digest.SMSSegments = m.Segments
+			digest.SMSCost = m.Cost
+		case models.SMSDirectionInbound:
+			digest.SMSReceived = m.Count
+		}
+	}
+	return digest, nil
+}
+
+// SendScheduled sends yesterday's digest to the configured recipients,
+// unless it was sent already. Instances running the job at once send it
+// only once, and one that failed is sent again. sent is false when there
+// was nothing to do.
+func (s *DigestService) SendScheduled(ctx context.Context) (sent bool, err error) {
+	if len(s.recipients) == 0 {
+		return false, ErrNoDigestRecipients
+	}
+	digest, err := s.Compile(ctx, s.Yesterday())
+	if err != nil {
+		return false, err
+	}
+	key := digest.Day
+	digest.ScheduleKey = &key
+	digest.Trigger = "schedule"
+	digest.Status = models.DigestSending
+	digest.Recipients = s.recipients
+	digest.CreatedAt = s.now()
+
+	db := s.db.WithContext(ctx)
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&digest)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to record digest: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		// take over a digest that failed, or whose sender went away
+		claimed := db.Model(&models.OrderDigest{}).
+			Where("schedule_key = ? AND (status = ? OR (status = ? AND created_at < ?))",
+				key, models.DigestFailed, models.DigestSending, digest.CreatedAt.Add(-digestClaimTimeout)).
+			Updates(map[string]interface{}{"status": models.DigestSending, "created_at": digest.CreatedAt})
+		if claimed.Error != nil {
+			return false, fmt.Errorf("failed to claim digest: %w", claimed.Error)
+		}
+		if claimed.RowsAffected == 0 {
+			return false, nil
+		}
+		var existing models.OrderDigest
+		if err := db.Select("id").Where("schedule_key = ?", key).First(&existing).Error; err != nil {
+			return false, fmt.Errorf("failed to claim digest: %w", err)
+		}
+		digest.ID = existing.ID
+		if err := db.Save(&digest).Error; err != nil {
+			return false, fmt.Errorf("failed to record digest: %w", err)
+		}
+	}
+
+	return true, s.deliver(ctx, &digest)
+}
+
+// Send emails the digest of day to recipients now, or to the configured
+// recipients when none are given, whether or not it was sent before
+func (s *DigestService) Send(ctx context.Context, day time.Time, recipients []string, actor string) (models.OrderDigest, error) {
+	if len(recipients) == 0 {
+		recipients = s.recipients
+	}
+	if len(recipients) == 0 {
+		return models.OrderDigest{}, ErrNoDigestRecipients
+	}
+	digest, err := s.Compile(ctx, day)
+	if err != nil {
+		return digest, err
+	}
+	digest.Trigger = "manual"
+	digest.Status = models.DigestSending
+	digest.Recipients = recipients
+	digest.CreatedBy = actor
+	digest.CreatedAt = s.now()
+	if err := s.db.WithContext(ctx).Create(&digest).Error; err != nil {
+		return digest, fmt.Errorf("failed to record digest: %w", err)
+	}
+	return digest, s.deliver(ctx, &digest)
+}
+
+// deliver emails the digest and records how it went
+func (s *DigestService) deliver(ctx context.Context, digest *models.OrderDigest) error {
+	email, err := DigestEmail(*digest, s.location)
+	if err == nil {
+		err = s.email.SendEmail(ctx, email)
+	}
+
+	updates := map[string]interface{}{"status": models.DigestSent, "error": ""}
+	if err != nil {
+		digest.Status = models.DigestFailed
+		digest.Error = err.Error()
+		updates["status"], updates["error"] = digest.Status, digest.Error
+	} else {
+		sentAt := s.now()
+		digest.Status = models.DigestSent
+		digest.SentAt = &sentAt
+		updates["sent_at"] = sentAt
+	}
+	if updateErr := s.db.WithContext(ctx).Model(&models.OrderDigest{}).Where("id = ?", digest.ID).Updates(updates).Error; updateErr != nil && err == nil {
+		err = fmt.Errorf("failed to record digest: %w", updateErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send digest for %s: %w", digest.Day, err)
+	}
+	return nil
+}
+
+// DigestEmail renders the digest as an email to its recipients, with its
+// orders attached as CSV and PDF
+func DigestEmail(digest models.OrderDigest, location *time.Location) (Email, error) {
+	var csvData, pdfData bytes.Buffer
+	if err := WriteDigestCSV(&csvData, digest, location); err != nil {
+		return Email{}, err
+	}
+	if err := WriteDigestPDF(&pdfData, digest, location); err != nil {
+		return Email{}, err
+	}
+	return Email{
+		To:      digest.Recipients,
+		Subject: "Orders digest for " + digest.Day,
+		Body:    strings.Join(digestSummary(digest), "\n") + "\n\nThe day's orders are attached.\n",
+		Attachments: []EmailAttachment{
+			{Filename: "digest-" + digest.Day + ".csv", ContentType: "text/csv; charset=utf-8", Data: csvData.Bytes()},
+			{Filename: "digest-" + digest.Day + ".pdf", ContentType: "application/pdf", Data: pdfData.Bytes()},
+		},
+	}, nil
+}
+
+func digestSummary(digest models.OrderDigest) []string {
+	return []string{
+		fmt.Sprintf("Orders: %d, totalling %s", digest.OrdersCount, digest.Revenue),
+		fmt.Sprintf("Cancelled orders: %d", digest.CancelledCount),
+		fmt.Sprintf("Text messages sent: %d (%d segments, estimated cost %s)", digest.SMSSent, digest.SMSSegments, digest.SMSCost),
+		fmt.Sprintf("Text messages received: %d", digest.SMSReceived),
+	}
+}
+
+// WriteDigestCSV writes the digest's totals as metric,value rows, then,
+// after a blank line, its orders
+func WriteDigestCSV(w io.Writer, digest models.OrderDigest, location *time.Location) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"metric", "value"})
+	for _, row := range [][]string{
+		{"day", digest.Day},
+		{"orders", strconv.FormatInt(digest.OrdersCount, 10)},
+		{"revenue", digest.Revenue.String()},
+		{"cancelled_orders", strconv.FormatInt(digest.CancelledCount, 10)},
+		{"sms_sent", strconv.FormatInt(digest.SMSSent, 10)},
+		{"sms_segments", strconv.FormatInt(digest.SMSSegments, 10)},
+		{"sms_cost", digest.SMSCost.String()},
+		{"sms_received", strconv.FormatInt(digest.SMSReceived, 10)},
+	} {
+		out.Write(row)
+	}
+	out.Write(nil)
+
+	out.Write([]string{"order_id", "time", "customer_id", "item", "quantity", "amount", "status"})
+	for _, order := range digest.Orders {
+		out.Write([]string{
+			strconv.FormatUint(uint64(order.ID), 10),
+			order.Time.In(location).Format("2006-01-02 15:04"),
+			strconv.FormatUint(uint64(order.CustomerID), 10),
+			csvSafe(order.Item),
+			strconv.Itoa(order.Quantity),
+			order.Amount.String(),
+			order.Status,
+		})
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// WriteDigestPDF writes the digest as a plain text PDF, like statements
+func WriteDigestPDF(w io.Writer, digest models.OrderDigest, location *time.Location) error {
+	text := append([]string{"Orders digest for " + digest.Day, ""}, digestSummary(digest)...)
+	text = append(text, "",
+		fmt.Sprintf("%-8s %-6s %-9s %-30s %4s %12s %-10s", "Order", "Time", "Customer", "Item", "Qty", "Amount", "Status"))
+	for _, order := range digest.Orders {
+		item := order.Item
+		if runes := []rune(item); len(runes) > 30 {
+			item = string(runes[:29]) + "~"
+		}
+		text = append(text, fmt.Sprintf("%-8d %-6s %-9d %-30s %4d %12s %-10s",
+			order.ID, order.Time.In(location).Format("15:04"), order.CustomerID, item, order.Quantity, order.Amount, order.Status))
+	}
+
+	var pages [][]string
+	for len(text) > statementPageLines {
+		pages = append(pages, text[:statementPageLines])
+		text = text[statementPageLines:]
+	}
+	pages = append(pages, text)
+
+	return writePDF(w, pages)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type failingEmailSender struct {
+	err error
+}
+
+func (f *failingEmailSender) SendEmail(ctx context.Context, email Email) error {
+	return f.err
+}
+
+func TestDigestService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "digest.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+
+	nairobi, err := time.LoadLocation("Africa/Nairobi")
+	require.NoError(t, err)
+	now := time.Date(2026, 3, 11, 7, 0, 0, 0, nairobi)
+	yesterday := time.Date(2026, 3, 10, 9, 30, 0, 0, nairobi)
+
+	require.NoError(t, db.Create(&models.Customer{ID: 1, Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150"}).Error)
+	for _, order := range []models.Order{
+		{ID: 1, Item: "laptop", Amount: models.Shillings(1500), Time: yesterday, Status: models.OrderStatusPending, CustomerID: 1, Quantity: 1},
+		{ID: 2, Item: "=charger", Amount: models.Shillings(200), Time: yesterday.Add(time.Hour), Status: models.OrderStatusCancelled, CustomerID: 1, Quantity: 2},
+		{ID: 3, Item: "mouse", Amount: models.Shillings(50), Time: now, Status: models.OrderStatusPending, CustomerID: 1, Quantity: 1},
+	} {
+		require.NoError(t, db.Create(&order).Error)
+	}
+	require.NoError(t, db.Create(&models.ArchivedOrder{ID: 4, Item: "bag", Amount: models.Shillings(300), Time: yesterday.Add(-time.Hour), Status: models.OrderStatusDelivered, CustomerID: 1, Quantity: 1, ArchivedAt: now}).Error)
+	for _, message := range []models.SMSMessage{
+		{Direction: models.SMSDirectionOutbound, Phone: "+254740827150", Segments: 2, EstimatedCost: models.Shillings(1.6), CreatedAt: yesterday},
+		{Direction: models.SMSDirectionOutbound, Phone: "+254740827150", Segments: 1, EstimatedCost: models.Shillings(0.8), CreatedAt: yesterday, DryRun: true},
+		{Direction: models.SMSDirectionInbound, Phone: "+254740827150", CreatedAt: yesterday},
+	} {
+		require.NoError(t, db.Create(&message).Error)
+	}
+
+	email := NewMockEmailService()
+	digests := NewDigestService(db, email, nairobi, []string{"ops@example.com"})
+	digests.now = func() time.Time { return now }
+
+	digest, err := digests.Compile(context.Background(), digests.Yesterday())
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-10", digest.Day)
+	assert.Equal(t, int64(2), digest.OrdersCount, "live and archived orders, cancelled left out")
+	assert.Equal(t, int64(1), digest.CancelledCount)
+	assert.Equal(t, models.Shillings(1800), digest.Revenue)
+	assert.Equal(t, []uint{4, 1, 2}, []uint{digest.Orders[0].ID, digest.Orders[1].ID, digest.Orders[2].ID})
+	assert.Equal(t, int64(1), digest.SMSSent, "dry runs were not sent")
+	assert.Equal(t, int64(2), digest.SMSSegments)
+	assert.Equal(t, models.Shillings(1.6), digest.SMSCost)
+	assert.Equal(t, int64(1), digest.SMSReceived)
+
+	sent, err := digests.SendScheduled(context.Background())
+	require.NoError(t, err)
+	assert.True(t, sent)
+	sent, err = digests.SendScheduled(context.Background())
+	require.NoError(t, err)
+	assert.False(t, sent, "each day is sent once")
+
+	emails := email.Sent()
+	require.Len(t, emails, 1)
+	assert.Equal(t, []string{"ops@example.com"}, emails[0].To)
+	assert.Equal(t, "Orders digest for 2026-03-10", emails[0].Subject)
+	assert.Contains(t, emails[0].Body, "Orders: 2, totalling 1800.00")
+	require.Len(t, emails[0].Attachments, 2)
+	assert.Equal(t, "digest-2026-03-10.csv", emails[0].Attachments[0].Filename)
+	assert.Contains(t, string(emails[0].Attachments[0].Data), "2,2026-03-10 10:30,1,'=charger,2,200.00,cancelled")
+	assert.True(t, strings.HasPrefix(string(emails[0].Attachments[1].Data), "%PDF-1.4"))
+
+	var stored models.OrderDigest
+	require.NoError(t, db.First(&stored).Error)
+	assert.Equal(t, models.DigestSent, stored.Status)
+	assert.NotNil(t, stored.SentAt)
+	assert.Len(t, stored.Orders, 3)
+
+	t.Run("failed digests are sent again", func(t *testing.T) {
+		digests.now = func() time.Time { return now.AddDate(0, 0, 1) }
+		digests.email = &failingEmailSender{err: errors.New("relay refused")}
+		_, err := digests.SendScheduled(context.Background())
+		assert.ErrorContains(t, err, "relay refused")
+
+		var failed models.OrderDigest
+		require.NoError(t, db.Where("day = ?", "2026-03-11").First(&failed).Error)
+		assert.Equal(t, models.DigestFailed, failed.Status)
+		assert.Equal(t, "relay refused", failed.Error)
+
+		digests.email = email
+		sent, err := digests.SendScheduled(context.Background())
+		require.NoError(t, err)
+		assert.True(t, sent)
+		require.NoError(t, db.First(&failed, failed.ID).Error)
+		assert.Equal(t, models.DigestSent, failed.Status)
+		assert.Empty(t, failed.Error)
+		assert.Len(t, email.Sent(), 2)
+	})
+
+	t.Run("on demand", func(t *testing.T) {
+		digest, err := digests.Send(context.Background(), yesterday, []string{"cfo@example.com"}, "admin@example.com")
+		require.NoError(t, err)
+		assert.Equal(t, "manual", digest.Trigger)
+		assert.Equal(t, "2026-03-10", digest.Day)
+		assert.Equal(t, []string{"cfo@example.com"}, email.Sent()[2].To)
+	})
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// How much each kind of match says two customers are one person. A name on
+// its own is weak evidence, since many customers share common names.
+const (
+	phoneMatchConfidence = 0.9
+	emailMatchConfidence = 0.85
+	nameMatchWeight      = 0.5
+)
+
+// NameSimilarity is the trigram similarity, as pg_trgm computes it, from
+// which two names count as a match. It must stay above pg_trgm's default
+// similarity_threshold of 0.3 for the index to find every pair.
+const NameSimilarity = 0.6
+
+// DefaultDuplicateConfidence is the least confidence a match is reported at
+// unless asked otherwise. An identical name alone scores 0.5.
+const DefaultDuplicateConfidence = 0.5
+
+// DuplicateFinder looks for customers that are likely the same person: by
+// phone number and email once normalized, and by similar names
+type DuplicateFinder struct {
+	db *gorm.DB
+}
+
+func NewDuplicateFinder(db *gorm.DB) *DuplicateFinder {
+	return &DuplicateFinder{db: db}
+}
+
+// Find returns clusters of customers joined by matches of at least
+// minConfidence, most confident first. Deleted and anonymized customers are
+// left out. Phones and emails are encrypted, so every customer is loaded to
+// compare them.
+func (f *DuplicateFinder) Find(ctx context.Context, minConfidence float64) ([]models.DuplicateCluster, error) {
+	db := f.db.WithContext(ctx)
+
+	var customers []models.Customer
+	err := db.Select("id", "name", "code", "phone", "email", "created_at", "updated_at").
+		Where("anonymized_at IS NULL").Order("id ASC").Find(&customers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	matches := map[[2]uint]*models.DuplicateMatch{}
+	match := func(a, b uint) *models.DuplicateMatch {
+		pair := [2]uint{min(a, b), max(a, b)}
+		if matches[pair] == nil {
+			matches[pair] = &models.DuplicateMatch{CustomerIDs: pair, Reasons: []string{}}
+		}
+		return matches[pair]
+	}
+
+	phones := map[string][]uint{}
+	emails := map[string][]uint{}
+	for _, customer := range customers {
+		if phone := canonicalPhone(customer.Phone); phone != "" {
+			phones[phone] = append(phones[phone], customer.ID)
+		}
+		if email := canonicalEmail(customer.Email); email != "" {
+			emails[email] = append(emails[email], customer.ID)
+		}
+	}
+	for reason, groups := range map[string]map[string][]uint{models.DuplicateByPhone: phones, models.DuplicateByEmail: emails} {
+		for _, ids := range groups {
+			for i := range ids {
+				for _, other := range ids[i+1:] {
+					m := match(ids[i], other)
+					m.Reasons = append(m.Reasons, reason)
+				}
+			}
+		}
+	}
+
+	names, err := f.namePairs(db, customers)
+	if err != nil {
+		return nil, err
+	}
+	for pair, similarity := range names {
+		m := match(pair[0], pair[1])
+		m.Reasons = append(m.Reasons, models.DuplicateByName)
+		m.NameSimilarity = similarity
+	}
+
+	kept := make([]models.DuplicateMatch, 0, len(matches))
+	for _, m := range matches {
+		sort.Slice(m.Reasons, func(i, j int) bool { return reasonRank(m.Reasons[i]) < reasonRank(m.Reasons[j]) })
+		m.Confidence = matchConfidence(*m)
+		if m.Confidence >= minConfidence {
+			kept = append(kept, *m)
+		}
+	}
+	return f.cluster(db, customers, kept)
+}
+
+// namePairs finds pairs of customers with similar names, with Postgres'
+// trigram index when pg_trgm is there and by comparing trigrams here
+// otherwise
+func (f *DuplicateFinder) namePairs(db *gorm.DB, customers []models.Customer) (map[[2]uint]float64, error) {
+	if db.Dialector.Name() == "postgres" {
+		pairs, err := trigramNamePairs(db)
+		if err == nil {
+			return pairs, nil
+		}
+		log.Printf("pg_trgm is not available, comparing customer names in the application: %v", err)
+	}
+	return similarNames(customers), nil
+}
+
+func trigramNamePairs(db *gorm.DB) (map[[2]uint]float64, error) {
+	var rows []struct {
+		A          uint
+		B          uint
+		Similarity float64
+	}
+	err := db.Raw(`SELECT a.id AS a, b.id AS b, similarity(LOWER(a.name), LOWER(b.name)) AS similarity
+		FROM customers a JOIN customers b ON a.id < b.id AND LOWER(a.name) % LOWER(b.name)
+		WHERE a.deleted_at IS NULL AND b.deleted_at IS NULL AND a.anonymized_at IS NULL AND b.anonymized_at IS NULL
+		AND similarity(LOWER(a.name), LOWER(b.name)) >= ?`, NameSimilarity).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pairs := make(map[[2]uint]float64, len(rows))
+	for _, row := range rows {
+		pairs[[2]uint{row.A, row.B}] = round3(row.Similarity)
+	}
+	return pairs, nil
+}
+
+// similarNames compares the trigrams of every pair of names sharing at
+// least one, the way pg_trgm's similarity() does
+func similarNames(customers []models.Customer) map[[2]uint]float64 {
+	grams := make([]map[string]bool, len(customers))
+	index := map[string][]int{}
+	for i, customer := range customers {
+		grams[i] = trigrams(customer.Name)
+		for gram := range grams[i] {
+			index[gram] = append(index[gram], i)
+		}
+	}
+
+	shared := map[[2]int]int{}
+	for _, holders := range index {
+		for i := range holders {
+			for _, other := range holders[i+1:] {
+				shared[[2]int{holders[i], other}]++
+			}
+		}
+	}
+
+	pairs := map[[2]uint]float64{}
+	for pair, n := range shared {
+		similarity := float64(n) / float64(len(grams[pair[0]])+len(grams[pair[1]])-n)
+		if similarity >= NameSimilarity {
+			a, b := customers[pair[0]].ID, customers[pair[1]].ID
+			pairs[[2]uint{min(a, b), max(a, b)}] = round3(similarity)
+		}
+	}
+	return pairs
+}
+
+// trigrams splits a name into the trigrams pg_trgm would: lowercased words
+// of letters and digits, each padded with two spaces before and one after
+func trigrams(name string) map[string]bool {
+	set := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// cluster joins matching customers into clusters, strongest matches first,
+// so each cluster's confidence is its weakest necessary match
+func (f *DuplicateFinder) cluster(db *gorm.DB, customers []models.Customer, matches []models.DuplicateMatch) ([]models.DuplicateCluster, error) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Confidence != matches[j].Confidence {
+			return matches[i].Confidence > matches[j].Confidence
+		}
+		if matches[i].CustomerIDs[0] != matches[j].CustomerIDs[0] {
+			return matches[i].CustomerIDs[0] < matches[j].CustomerIDs[0]
+		}
+		return matches[i].CustomerIDs[1] < matches[j].CustomerIDs[1]
+	})
+
+	parent := map[uint]uint{}
+	confidence := map[uint]float64{}
+	var root func(id uint) uint
+	root = func(id uint) uint {
+		p, ok := parent[id]
+		if !ok {
+			parent[id], confidence[id] = id, 1
+			return id
+		}
+		if p != id {
+			parent[id] = root(p)
+		}
+		return parent[id]
+	}
+	for _, m := range matches {
+		a, b := root(m.CustomerIDs[0]), root(m.CustomerIDs[1])
+		if a != b {
+			parent[b] = a
+			confidence[a] = min(confidence[a], confidence[b], m.Confidence)
+		}
+	}
+
+	byID := make(map[uint]models.Customer, len(customers))
+	for _, customer := range customers {
+		byID[customer.ID] = customer
+	}
+
+	clusters := map[uint]*models.DuplicateCluster{}
+	var ids []uint
+	for _, m := range matches {
+		r := root(m.CustomerIDs[0])
+		if clusters[r] == nil {
+			clusters[r] = &models.DuplicateCluster{Confidence: confidence[r]}
+		}
+		clusters[r].Matches = append(clusters[r].Matches, m)
+	}
+	for _, customer := range customers {
+		if _, ok := parent[customer.ID]; !ok {
+			continue
+		}
+		c := clusters[root(customer.ID)]
+		c.CustomerIDs = append(c.CustomerIDs, customer.ID)
+		c.Customers = append(c.Customers, customer)
+		ids = append(ids, customer.ID)
+	}
+
+	orders := map[uint]int64{}
+	if len(ids) > 0 {
+		var counts []struct {
+			CustomerID uint
+			Count      int64
+		}
+		err := db.Model(&models.Order{}).Select("customer_id, COUNT(*) AS count").
+			Where("customer_id IN ?", ids).Group("customer_id").Scan(&counts).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			orders[count.CustomerID] = count.Count
+		}
+	}
+
+	result := make([]models.DuplicateCluster, 0, len(clusters))
+	for _, c := range clusters {
+		for i := range c.Customers {
+			count := orders[c.Customers[i].ID]
+			c.Customers[i].OrdersCount = &count
+		}
+		// customers are in id order, so the first with the most orders is
+		// the oldest of them
+		keep := c.Customers[0]
+		for _, customer := range c.Customers[1:] {
+			if *customer.OrdersCount > *keep.OrdersCount {
+				keep = customer
+			}
+		}
+		c.KeepID = keep.ID
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Confidence != result[j].Confidence {
+			return result[i].Confidence > result[j].Confidence
+		}
+		return result[i].CustomerIDs[0] < result[j].CustomerIDs[0]
+	})
+	return result, nil
+}
+
+// matchConfidence combines the evidence of each reason as independent
+// chances that the customers are one person
+func matchConfidence(m models.DuplicateMatch) float64 {
+	doubt := 1.0
+	for _, reason := range m.Reasons {
+		switch reason {
+		case models.DuplicateByPhone:
+			doubt *= 1 - phoneMatchConfidence
+		case models.DuplicateByEmail:
+			doubt *= 1 - emailMatchConfidence
+		case models.DuplicateByName:
+			doubt *= 1 - nameMatchWeight*m.NameSimilarity
+		}
+	}
+	return round3(1 - doubt)
+}
+
+func reasonRank(reason string) int {
+	switch reason {
+	case models.DuplicateByPhone:
+		return 0
+	case models.DuplicateByEmail:
+		return 1
+	}
+	return 2
+}
+
+// canonicalPhone writes a Kenyan number entered as 07..., 254... or
+// +254 7... in one form. Other numbers keep their digits.
+func canonicalPhone(phone string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+
+	switch {
+	case digits == "":
+		return ""
+	case len(digits) == 12 && strings.HasPrefix(digits, "254"):
+		return "+" + digits
+	case len(digits) == 10 && strings.HasPrefix(digits, "0"):
+		return "+254" + digits[1:]
+	case len(digits) == 9:
+		return "+254" + digits
+	}
+	return "+" + digits
+}
+
+// canonicalEmail drops what mail providers ignore: a +tag, and for Gmail
+// dots in the local part and the googlemail.com domain
+func canonicalEmail(email string) string {
+	email = models.NormalizeEmail(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return ""
+	}
+
+	local, domain := email[:at], email[at+1:]
+	local, _, _ = strings.Cut(local, "+")
+	if domain == "googlemail.com" {
+		domain = "gmail.com"
+	}
+	if domain == "gmail.com" {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if local == "" {
+		return ""
+	}
+	return local + "@" + domain
+}
+
+func round3(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
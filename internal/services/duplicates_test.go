@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalPhone(t *testing.T) {
+	for _, phone := range []string{"+254740827150", "254740827150", "0740827150", "0740 827 150", "(0740) 827-150", "740827150"} {
+		assert.Equal(t, "+254740827150", canonicalPhone(phone), phone)
+	}
+	assert.Equal(t, "+447700900123", canonicalPhone("+44 7700 900123"))
+	assert.Empty(t, canonicalPhone(""))
+}
+
+func TestCanonicalEmail(t *testing.T) {
+	tests := map[string]string{
+		"Sebbie.Chanzu@gmail.com":          "sebbiechanzu@gmail.com",
+		"sebbiechanzu+shop@googlemail.com": "sebbiechanzu@gmail.com",
+		"amina.hassan+news@example.com":    "amina.hassan@example.com",
+		"+tag@example.com":                 "",
+		"not-an-email":                     "",
+	}
+	for email, expected := range tests {
+		assert.Equal(t, expected, canonicalEmail(email), email)
+	}
+}
+
+func TestSimilarNames(t *testing.T) {
+	pairs := similarNames([]models.Customer{
+		{ID: 1, Name: "Sebbie Chanzu"},
+		{ID: 2, Name: "Amina Hassan"},
+		{ID: 3, Name: "sebie chanzu"},
+		{ID: 4, Name: "A. Hassan"},
+	})
+	// the same value pg_trgm's similarity() gives
+	assert.Equal(t, map[[2]uint]float64{{1, 3}: 0.8}, pairs)
+}
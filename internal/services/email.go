@@ -0,0 +1,208 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Email is a plain text message with optional attachments
+type Email struct {
+	To          []string
+	Subject     string
+	Body        string
+	Attachments []EmailAttachment
+}
+
+type EmailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// smtpTimeout bounds a whole delivery, from dialing to QUIT
+const smtpTimeout = 30 * time.Second
+
+// SMTPEmailService sends email through an SMTP relay, upgrading to TLS
+// with STARTTLS when the relay offers it, or from the start on port 465
+type SMTPEmailService struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPEmailService(host, port, username, password, from string) *SMTPEmailService {
+	if port == "" {
+		port = "587"
+	}
+	return &SMTPEmailService{host: host, port: port, username: username, password: password, from: from}
+}
+
+// SMTPEmailServiceFromEnv reads SMTP_HOST, SMTP_PORT (default 587),
+// SMTP_USERNAME, SMTP_PASSWORD and EMAIL_FROM. It returns nil when
+// SMTP_HOST or EMAIL_FROM is not set.
+func SMTPEmailServiceFromEnv() *SMTPEmailService {
+	host := os.Getenv("SMTP_HOST")
+	from := os.Getenv("EMAIL_FROM")
+	if host == "" || from == "" {
+		return nil
+	}
+	return NewSMTPEmailService(host, os.Getenv("SMTP_PORT"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+}
+
+func (s *SMTPEmailService) SendEmail(ctx context.Context, email Email) error {
+	message, err := buildEmailMessage(s.from, email, time.Now())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+	addr := net.JoinHostPort(s.host, s.port)
+	var conn net.Conn
+	if s.port == "465" {
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: s.host}}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to greet %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	if s.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.username, s.password, s.host)); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err := client.Mail(s.from); err != nil {
+		return fmt.Errorf("sender refused: %w", err)
+	}
+	for _, to := range email.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s refused: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message refused: %w", err)
+	}
+	return client.Quit()
+}
+
+// buildEmailMessage renders email as a MIME message: the body as quoted
+// printable text, followed by the attachments in base64
+func buildEmailMessage(from string, email Email, now time.Time) ([]byte, error) {
+	if len(email.To) == 0 {
+		return nil, fmt.Errorf("email has no recipients")
+	}
+	for _, address := range append([]string{from}, email.To...) {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid email address %q: %w", address, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", parts.Boundary())
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	body := quotedprintable.NewWriter(text)
+	body.Write([]byte(email.Body))
+	if err := body.Close(); err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range email.Attachments {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MockEmailService records emails instead of sending them
+type MockEmailService struct {
+	mu   sync.Mutex
+	sent []Email
+}
+
+func NewMockEmailService() *MockEmailService {
+	return &MockEmailService{}
+}
+
+func (m *MockEmailService) SendEmail(ctx context.Context, email Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, email)
+	return nil
+}
+
+// Sent returns the emails sent so far
+func (m *MockEmailService) Sent() []Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Email(nil), m.sent...)
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildEmailMessage(t *testing.T) {
+	raw, err := buildEmailMessage("reports@example.com", Email{
+		To:      []string{"ops@example.com", "cfo@example.com"},
+		Subject: "Orders digest for 2026-03-10 – Nairobi",
+		Body:    "Orders: 2, totalling 1800.00\n",
+		Attachments: []EmailAttachment{
+			{Filename: "digest-2026-03-10.csv", ContentType: "text/csv; charset=utf-8", Data: []byte(strings.Repeat("order_id,item\n", 20))},
+		},
+	}, time.Date(2026, 3, 11, 7, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+
+	message, err := mail.ReadMessage(strings.NewReader(string(raw)))
+	require.NoError(t, err)
+	assert.Equal(t, "ops@example.com, cfo@example.com", message.Header.Get("To"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Orders digest for 2026-03-10 – Nairobi", subject)
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	parts := multipart.NewReader(message.Body, params["boundary"])
+	text, err := parts.NextPart()
+	require.NoError(t, err)
+	body, _ := io.ReadAll(text)
+	assert.Equal(t, "Orders: 2, totalling 1800.00\r\n", string(body), "lines end in CRLF, as email expects")
+
+	attachment, err := parts.NextPart()
+	require.NoError(t, err)
+	assert.Equal(t, "digest-2026-03-10.csv", attachment.FileName())
+	data, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, attachment))
+	assert.Equal(t, strings.Repeat("order_id,item\n", 20), string(data), "the base64 attachment decodes back")
+
+	_, err = buildEmailMessage("reports@example.com", Email{To: []string{"ops@example.com\r\nBcc: x@example.com"}}, time.Now())
+	assert.Error(t, err, "addresses cannot add headers")
+}
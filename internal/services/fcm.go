@@ -0,0 +1,173 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	fcmBaseURL     = "https://fcm.googleapis.com"
+	fcmScope       = "https://www.googleapis.com/auth/firebase.messaging"
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+)
+
+// ErrPushTokenInvalid means the device token is no longer registered with
+// the push provider and should be forgotten
+var ErrPushTokenInvalid = errors.New("push token is no longer valid")
+
+// PushMessage is what a device shows, along with data the app reads
+type PushMessage struct {
+	Title string
+	Body  string
+	Data  map[string]string
+}
+
+// FCMService pushes messages through the Firebase Cloud Messaging HTTP v1 API
+type FCMService struct {
+	projectID string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewFCMService pushes for projectID. client must add the OAuth2 token of
+// a service account allowed to send messages.
+func NewFCMService(projectID string, client *http.Client) *FCMService {
+	return &FCMService{
+		projectID: projectID,
+		baseURL:   fcmBaseURL,
+		client:    client,
+	}
+}
+
+// FCMServiceFromEnv reads FCM_PROJECT_ID and FCM_CREDENTIALS_FILE, the
+// path of a service account key. It returns nil when push is not
+// configured.
+func FCMServiceFromEnv() (*FCMService, error) {
+	projectID := os.Getenv("FCM_PROJECT_ID")
+	path := os.Getenv("FCM_CREDENTIALS_FILE")
+	if projectID == "" || path == "" {
+		return nil, nil
+	}
+
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fcm credentials: %w", err)
+	}
+	var account struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(key, &account); err != nil {
+		return nil, fmt.Errorf("invalid fcm credentials: %w", err)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = googleTokenURL
+	}
+
+	cfg := &jwt.Config{
+		Email:        account.ClientEmail,
+		PrivateKey:   []byte(account.PrivateKey),
+		PrivateKeyID: account.PrivateKeyID,
+		Scopes:       []string{fcmScope},
+		TokenURL:     account.TokenURI,
+	}
+	return NewFCMService(projectID, cfg.Client(context.Background())), nil
+}
+
+func (s *FCMService) Send(ctx context.Context, token string, message PushMessage) error {
+	payload := map[string]interface{}{
+		"message": map[string]interface{}{
+			"token": token,
+			"notification": map[string]string{
+				"title": message.Title,
+				"body":  message.Body,
+			},
+			"data": message.Data,
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode push: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/v1/projects/%s/messages:send", s.baseURL, s.projectID)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send push: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	respBody, _ := io.ReadAll(resp.Body)
+	var fcmErr struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+			Details []struct {
+				ErrorCode string `json:"errorCode"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	json.Unmarshal(respBody, &fcmErr)
+
+	for _, detail := range fcmErr.Error.Details {
+		if detail.ErrorCode == "UNREGISTERED" {
+			return ErrPushTokenInvalid
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrPushTokenInvalid
+	}
+	return fmt.Errorf("push failed with status %d: %s %s", resp.StatusCode, fcmErr.Error.Status, fcmErr.Error.Message)
+}
+
+// MockPushService records pushes instead of sending them. Pushes to tokens
+// in Invalid fail with ErrPushTokenInvalid and to tokens in Failing with
+// another error.
+type MockPushService struct {
+	Sent    []MockPush
+	Invalid map[string]bool
+	Failing map[string]bool
+}
+
+type MockPush struct {
+	Token   string
+	Message PushMessage
+}
+
+func NewMockPushService() *MockPushService {
+	return &MockPushService{
+		Invalid: map[string]bool{},
+		Failing: map[string]bool{},
+	}
+}
+
+func (m *MockPushService) Send(ctx context.Context, token string, message PushMessage) error {
+	if m.Invalid[token] {
+		return ErrPushTokenInvalid
+	}
+	if m.Failing[token] {
+		return errors.New("push provider unavailable")
+	}
+	m.Sent = append(m.Sent, MockPush{Token: token, Message: message})
+	return nil
+}
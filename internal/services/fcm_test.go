@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFCMServiceSend(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	const endpoint = "https://fcm.googleapis.com/v1/projects/savannah/messages:send"
+
+	tests := []struct {
+		name          string
+		status        int
+		body          string
+		expectedError string
+		tokenInvalid  bool
+	}{
+		{
+			name:   "sent",
+			status: http.StatusOK,
+			body:   `{"name":"projects/savannah/messages/1"}`,
+		},
+		{
+			name:         "unregistered token",
+			status:       http.StatusBadRequest,
+			body:         `{"error":{"status":"INVALID_ARGUMENT","details":[{"errorCode":"UNREGISTERED"}]}}`,
+			tokenInvalid: true,
+		},
+		{
+			name:         "unknown token",
+			status:       http.StatusNotFound,
+			body:         `{"error":{"status":"NOT_FOUND","message":"Requested entity was not found."}}`,
+			tokenInvalid: true,
+		},
+		{
+			name:          "provider error",
+			status:        http.StatusServiceUnavailable,
+			body:          `{"error":{"status":"UNAVAILABLE","message":"try again later"}}`,
+			expectedError: "push failed with status 503: UNAVAILABLE try again later",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Reset()
+
+			var payload struct {
+				Message struct {
+					Token        string            `json:"token"`
+					Notification map[string]string `json:"notification"`
+					Data         map[string]string `json:"data"`
+				} `json:"message"`
+			}
+			httpmock.RegisterResponder("POST", endpoint, func(req *http.Request) (*http.Response, error) {
+				json.NewDecoder(req.Body).Decode(&payload)
+				return httpmock.NewStringResponse(tt.status, tt.body), nil
+			})
+
+			fcm := NewFCMService("savannah", http.DefaultClient)
+			err := fcm.Send(context.Background(), "device-token", PushMessage{
+				Title: "Order received",
+				Body:  "hello sebbie",
+				Data:  map[string]string{"notification_id": "7"},
+			})
+
+			assert.Equal(t, 1, httpmock.GetTotalCallCount())
+			assert.Equal(t, "device-token", payload.Message.Token)
+			assert.Equal(t, "Order received", payload.Message.Notification["title"])
+			assert.Equal(t, "7", payload.Message.Data["notification_id"])
+
+			switch {
+			case tt.tokenInvalid:
+				assert.ErrorIs(t, err, ErrPushTokenInvalid)
+			case tt.expectedError != "":
+				assert.EqualError(t, err, tt.expectedError)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFCMServiceFromEnvUnset(t *testing.T) {
+	t.Setenv("FCM_PROJECT_ID", "")
+	t.Setenv("FCM_CREDENTIALS_FILE", "")
+
+	fcm, err := FCMServiceFromEnv()
+	assert.NoError(t, err)
+	assert.Nil(t, fcm)
+}
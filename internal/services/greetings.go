@@ -0,0 +1,233 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Feature flags that switch each greeting campaign on, for everyone or for
+// the customer codes and rollout share the flag names
+const (
+	FlagBirthdayGreetings    = "birthday_greetings"
+	FlagAnniversaryGreetings = "anniversary_greetings"
+)
+
+// GreetingPolicy sets what the greeting campaigns say and when. Messages
+// may use {name}, {first_name} and {years}, the customer's age or how long
+// they have been a customer. A campaign without a message is off.
+type GreetingPolicy struct {
+	BirthdayMessage    string
+	AnniversaryMessage string
+	// SendHour is the hour of the day, in the campaign's time zone, from
+	// which greetings go out, so nobody is texted at midnight
+	SendHour int
+	// BatchSize caps the customers looked at per query
+	BatchSize int
+	// MaxAttempts is how many times a failed greeting is tried on the day
+	MaxAttempts int
+}
+
+func DefaultGreetingPolicy() GreetingPolicy {
+	return GreetingPolicy{
+		SendHour:    9,
+		BatchSize:   500,
+		MaxAttempts: 3,
+	}
+}
+
+// GreetingPolicyFromEnv reads BIRTHDAY_MESSAGE, ANNIVERSARY_MESSAGE and
+// GREETING_SEND_HOUR over the defaults
+func GreetingPolicyFromEnv() GreetingPolicy {
+	policy := DefaultGreetingPolicy()
+	policy.BirthdayMessage = strings.TrimSpace(os.Getenv("BIRTHDAY_MESSAGE"))
+	policy.AnniversaryMessage = strings.TrimSpace(os.Getenv("ANNIVERSARY_MESSAGE"))
+
+	if n, err := strconv.Atoi(os.Getenv("GREETING_SEND_HOUR")); err == nil && n >= 0 && n < 24 {
+		policy.SendHour = n
+	}
+	return policy
+}
+
+// WithDefaults fills unset fields from DefaultGreetingPolicy
+func (p GreetingPolicy) WithDefaults() GreetingPolicy {
+	defaults := DefaultGreetingPolicy()
+	if p.SendHour < 0 || p.SendHour >= 24 {
+		p.SendHour = defaults.SendHour
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = defaults.BatchSize
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	return p
+}
+
+// Enabled reports whether either campaign has a message to send
+func (p GreetingPolicy) Enabled() bool {
+	return p.BirthdayMessage != "" || p.AnniversaryMessage != ""
+}
+
+// greetingCampaign is a campaign's message and the customer column holding
+// the date it greets
+type greetingCampaign struct {
+	name    string
+	column  string
+	flag    string
+	message string
+}
+
+// GreetingService texts customers on their birthday and on the anniversary
+// of becoming a customer
+type GreetingService struct {
+	db       *gorm.DB
+	sms      SMSServiceInterface
+	flags    FlagChecker
+	policy   GreetingPolicy
+	location *time.Location
+	now      func() time.Time
+}
+
+// NewGreetingService greets customers by their dates in location
+func NewGreetingService(db *gorm.DB, sms SMSServiceInterface, policy GreetingPolicy, location *time.Location) *GreetingService {
+	if location == nil {
+		location = time.UTC
+	}
+	return &GreetingService{
+		db:       db,
+		sms:      sms,
+		policy:   policy.WithDefaults(),
+		location: location,
+		now:      time.Now,
+	}
+}
+
+// WithFlags only greets the customers a campaign's flag is on for, by
+// their code. Without flags every campaign with a message runs.
+func (s *GreetingService) WithFlags(flags FlagChecker) *GreetingService {
+	s.flags = flags
+	return s
+}
+
+// WithClock replaces time.Now, for tests
+func (s *GreetingService) WithClock(now func() time.Time) *GreetingService {
+	s.now = now
+	return s
+}
+
+func (s *GreetingService) campaigns() []greetingCampaign {
+	var campaigns []greetingCampaign
+	if s.policy.BirthdayMessage != "" {
+		campaigns = append(campaigns, greetingCampaign{models.GreetingBirthday, "birthday", FlagBirthdayGreetings, s.policy.BirthdayMessage})
+	}
+	if s.policy.AnniversaryMessage != "" {
+		campaigns = append(campaigns, greetingCampaign{models.GreetingAnniversary, "onboarded_on", FlagAnniversaryGreetings, s.policy.AnniversaryMessage})
+	}
+	return campaigns
+}
+
+// Run texts today's greetings that have not been sent yet, once SendHour
+// has passed. It returns how many messages were sent.
+func (s *GreetingService) Run(ctx context.Context) (int, error) {
+	now := s.now().In(s.location)
+	if now.Hour() < s.policy.SendHour {
+		return 0, nil
+	}
+	today := models.DateOf(now)
+
+	sent := 0
+	for _, campaign := range s.campaigns() {
+		n, err := s.greet(ctx, campaign, today)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// greet texts the customers whose date recurs today, who have not opted
+// out and have not had the greeting yet
+func (s *GreetingService) greet(ctx context.Context, campaign greetingCampaign, today models.Date) (int, error) {
+	db := s.db.WithContext(ctx)
+	monthDays := []string{today.MonthDay()}
+	if year := today.Time().Year(); monthDays[0] == "02-28" && !isLeapYear(year) {
+		// 29 February is greeted on the 28th in other years
+		monthDays = append(monthDays, "02-29")
+	}
+
+	sent := 0
+	var lastID uint
+	for {
+		var customers []models.Customer
+		// the date must be in an earlier year, so nobody is greeted on the
+		// day itself
+		err := db.Where("SUBSTR("+campaign.column+", 6, 5) IN ? AND "+campaign.column+" < ?", monthDays, today).
+			Where("marketing_opt_out_at IS NULL AND anonymized_at IS NULL AND id > ?", lastID).
+			Where("NOT EXISTS (SELECT 1 FROM greeting_messages g WHERE g.customer_id = customers.id AND g.campaign = ? AND g.day = ? AND g.sent = ?)", campaign.name, today, true).
+			Where("(SELECT COUNT(*) FROM greeting_messages g WHERE g.customer_id = customers.id AND g.campaign = ? AND g.day = ?) < ?", campaign.name, today, s.policy.MaxAttempts).
+			Order("id ASC").Limit(s.policy.BatchSize).
+			Find(&customers).Error
+		if err != nil {
+			return sent, fmt.Errorf("failed to find %s greetings: %w", campaign.name, err)
+		}
+
+		for _, customer := range customers {
+			lastID = customer.ID
+			if err := ctx.Err(); err != nil {
+				return sent, err
+			}
+			if s.flags != nil && !s.flags.Enabled(ctx, campaign.flag, customer.Code) {
+				continue
+			}
+
+			message := models.GreetingMessage{CustomerID: customer.ID, Campaign: campaign.name, Day: today, SentAt: s.now()}
+			if err := s.sms.SendSMS(ctx, customer.Phone, s.message(campaign, customer, today)); err != nil {
+				log.Printf("failed to send %s greeting to customer %d: %v", campaign.name, customer.ID, err)
+				message.Error = err.Error()
+			} else {
+				message.Sent = true
+				sent++
+			}
+			if err := db.Create(&message).Error; err != nil {
+				return sent, fmt.Errorf("failed to record %s greeting to customer %d: %w", campaign.name, customer.ID, err)
+			}
+		}
+		if len(customers) < s.policy.BatchSize {
+			return sent, nil
+		}
+	}
+}
+
+// message fills in the campaign's placeholders for customer and makes sure
+// the text says how to opt out
+func (s *GreetingService) message(campaign greetingCampaign, customer models.Customer, today models.Date) string {
+	date := customer.Birthday
+	if campaign.name == models.GreetingAnniversary {
+		date = customer.OnboardedOn
+	}
+	years := 0
+	if date != nil {
+		years = today.Time().Year() - date.Time().Year()
+	}
+	firstName, _, _ := strings.Cut(strings.TrimSpace(customer.Name), " ")
+
+	message := strings.NewReplacer(
+		"{name}", customer.Name,
+		"{first_name}", firstName,
+		"{years}", strconv.Itoa(years),
+	).Replace(campaign.message)
+	return withOptOut(message)
+}
+
+func isLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
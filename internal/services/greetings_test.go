@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type greetingFlags map[string][]string
+
+func (f greetingFlags) Enabled(ctx context.Context, key, subject string) bool {
+	for _, allowed := range f[key] {
+		if allowed == subject {
+			return true
+		}
+	}
+	return false
+}
+
+type failingSMS struct {
+	*MockSMSService
+	failing bool
+}
+
+func (s *failingSMS) SendSMS(ctx context.Context, to, message string) error {
+	if s.failing {
+		return errors.New("gateway timeout")
+	}
+	return s.MockSMSService.SendSMS(ctx, to, message)
+}
+
+func TestGreetingService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "greetings.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+	ctx := context.Background()
+
+	date := func(s string) *models.Date {
+		d, err := models.ParseDate(s)
+		require.NoError(t, err)
+		return &d
+	}
+	optedOut := time.Now()
+	for _, customer := range []models.Customer{
+		{ID: 1, Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Birthday: date("1990-03-10"), OnboardedOn: date("2023-03-10")},
+		{ID: 2, Name: "Amina Otieno", Code: "CUST002", Phone: "+254711000002", Birthday: date("1985-03-10"), MarketingOptOutAt: &optedOut},
+		{ID: 3, Name: "Brian Kip", Code: "CUST003", Phone: "+254711000003", Birthday: date("1992-03-11"), OnboardedOn: date("2026-03-10")},
+		{ID: 4, Name: "Wanjiru Mwangi", Code: "CUST004", Phone: "+254711000004", Birthday: date("2000-02-29")},
+		{ID: 5, Name: "Otieno Odhiambo", Code: "CUST005", Phone: "+254711000005", Birthday: date("1999-03-10")},
+	} {
+		require.NoError(t, db.Create(&customer).Error)
+	}
+
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	now := time.Date(2026, 3, 10, 8, 30, 0, 0, nairobi)
+	sms := &failingSMS{MockSMSService: NewMockSMSService()}
+	policy := GreetingPolicy{
+		BirthdayMessage:    "Happy birthday {first_name}! Enjoy 20% off with code BDAY20",
+		AnniversaryMessage: "{name}, thank you for {years} years with us",
+		SendHour:           9,
+		BatchSize:          1,
+	}
+	flags := greetingFlags{
+		FlagBirthdayGreetings:    {"CUST001", "CUST002", "CUST003", "CUST004"},
+		FlagAnniversaryGreetings: {"CUST001", "CUST003"},
+	}
+	greetings := NewGreetingService(db, sms, policy, nairobi).WithFlags(flags).WithClock(func() time.Time { return now })
+
+	t.Run("waits for the send hour", func(t *testing.T) {
+		sent, err := greetings.Run(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, sent)
+	})
+
+	t.Run("failed greetings are tried again", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		sms.failing = true
+		sent, err := greetings.Run(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, sent)
+
+		var failed models.GreetingMessage
+		require.NoError(t, db.Where("customer_id = ? AND campaign = ?", 1, models.GreetingBirthday).First(&failed).Error)
+		assert.False(t, failed.Sent)
+		assert.Equal(t, "gateway timeout", failed.Error)
+		assert.Equal(t, models.Date("2026-03-10"), failed.Day)
+		sms.failing = false
+	})
+
+	t.Run("greets the enabled customers whose day it is", func(t *testing.T) {
+		sent, err := greetings.Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, sent)
+		assert.Equal(t, []MockSMSMessage{
+			{To: "+254740827150", Message: "Happy birthday Sebbie! Enjoy 20% off with code BDAY20. reply STOP to opt out"},
+			{To: "+254740827150", Message: "Sebbie Chanzu, thank you for 3 years with us. reply STOP to opt out"},
+		}, sms.SentMessages, "opted out, not enabled, other days and this year's customers are left out")
+	})
+
+	t.Run("once a day", func(t *testing.T) {
+		now = now.Add(5 * time.Hour)
+		sent, err := greetings.Run(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, sent)
+	})
+
+	t.Run("29 February is greeted on the 28th", func(t *testing.T) {
+		now = time.Date(2027, 2, 28, 10, 0, 0, 0, nairobi)
+		sent, err := greetings.Run(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, sent)
+		assert.Equal(t, "Happy birthday Wanjiru! Enjoy 20% off with code BDAY20. reply STOP to opt out", sms.SentMessages[2].Message)
+	})
+}
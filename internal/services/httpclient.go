@@ -0,0 +1,349 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+type HTTPClientConfig struct {
+	// Name labels the client's metrics, e.g. "sms"
+	Name             string
+	Timeout          time.Duration
+	MaxRetries       int
+	BaseBackoff      time.Duration
+	MaxBackoff       time.Duration
+	FailureThreshold int
+	OpenDuration     time.Duration
+	// MaxIdleConns is how many kept alive connections to the provider are
+	// held open for reuse, and IdleConnTimeout how long each is kept
+	MaxIdleConns    int
+	IdleConnTimeout time.Duration
+	// ProxyURL sends requests through a proxy. Without it HTTPS_PROXY and
+	// NO_PROXY are followed.
+	ProxyURL string
+}
+
+// DefaultHTTPClientConfig returns the settings used when none are configured
+func DefaultHTTPClientConfig() HTTPClientConfig {
+	return HTTPClientConfig{
+		Name:             "default",
+		Timeout:          10 * time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      200 * time.Millisecond,
+		MaxBackoff:       2 * time.Second,
+		FailureThreshold: 5,
+		OpenDuration:     30 * time.Second,
+		MaxIdleConns:     16,
+		IdleConnTimeout:  90 * time.Second,
+	}
+}
+
+// HTTPClientConfigFromEnv reads <prefix>_HTTP_TIMEOUT, <prefix>_MAX_RETRIES,
+// <prefix>_CIRCUIT_FAILURE_THRESHOLD, <prefix>_CIRCUIT_OPEN_DURATION,
+// <prefix>_HTTP_MAX_IDLE_CONNS, <prefix>_HTTP_IDLE_TIMEOUT and
+// <prefix>_HTTP_PROXY, falling back to the defaults for anything unset or
+// invalid. The client's metrics are labelled with the prefix.
+func HTTPClientConfigFromEnv(prefix string) HTTPClientConfig {
+	cfg := DefaultHTTPClientConfig()
+	cfg.Name = strings.ToLower(prefix)
+
+	if d, err := time.ParseDuration(os.Getenv(prefix + "_HTTP_TIMEOUT")); err == nil {
+		cfg.Timeout = d
+	}
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_MAX_RETRIES")); err == nil {
+		cfg.MaxRetries = n
+	}
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_CIRCUIT_FAILURE_THRESHOLD")); err == nil {
+		cfg.FailureThreshold = n
+	}
+	if d, err := time.ParseDuration(os.Getenv(prefix + "_CIRCUIT_OPEN_DURATION")); err == nil {
+		cfg.OpenDuration = d
+	}
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_HTTP_MAX_IDLE_CONNS")); err == nil {
+		cfg.MaxIdleConns = n
+	}
+	if d, err := time.ParseDuration(os.Getenv(prefix + "_HTTP_IDLE_TIMEOUT")); err == nil {
+		cfg.IdleConnTimeout = d
+	}
+	if proxy := strings.TrimSpace(os.Getenv(prefix + "_HTTP_PROXY")); proxy != "" {
+		if _, err := url.Parse(proxy); err != nil {
+			log.Printf("invalid %s_HTTP_PROXY, following HTTPS_PROXY instead: %v", prefix, err)
+		} else {
+			cfg.ProxyURL = proxy
+		}
+	}
+	return cfg
+}
+
+// ProviderHealth is a snapshot of an upstream provider's circuit breaker
+type ProviderHealth struct {
+	Healthy             bool       `json:"healthy"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+}
+
+// ResilientClient wraps http.Client with retries on 5xx/network errors using
+// jittered exponential backoff, and a circuit breaker shared by all callers.
+// It is safe for concurrent use and meant to be built once per provider, so
+// its connections are kept alive and reused. Every attempt is counted in
+// DefaultOutboundMetrics.
+type ResilientClient struct {
+	client      *http.Client
+	transport   *instrumentedTransport
+	maxRetries  int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	breaker     *circuitBreaker
+}
+
+func NewResilientClient(cfg HTTPClientConfig) *ResilientClient {
+	defaults := DefaultHTTPClientConfig()
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaults.Timeout
+	}
+	if cfg.MaxRetries < 0 {
+		cfg.MaxRetries = 0
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = defaults.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = defaults.MaxBackoff
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaults.FailureThreshold
+	}
+	if cfg.OpenDuration <= 0 {
+		cfg.OpenDuration = defaults.OpenDuration
+	}
+	if cfg.Name == "" {
+		cfg.Name = defaults.Name
+	}
+
+	transport := &instrumentedTransport{
+		name:    cfg.Name,
+		base:    newHTTPTransport(cfg),
+		metrics: DefaultOutboundMetrics(),
+	}
+	return &ResilientClient{
+		client:      &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		transport:   transport,
+		maxRetries:  cfg.MaxRetries,
+		baseBackoff: cfg.BaseBackoff,
+		maxBackoff:  cfg.MaxBackoff,
+		breaker: &circuitBreaker{
+			threshold:    cfg.FailureThreshold,
+			openDuration: cfg.OpenDuration,
+		},
+	}
+}
+
+// newHTTPTransport tunes a copy of the default transport to keep
+// connections to one provider alive
+func newHTTPTransport(cfg HTTPClientConfig) http.RoundTripper {
+	base, ok := http.DefaultTransport.(*http.Transport)
+	if !ok {
+		return http.DefaultTransport
+	}
+	transport := base.Clone()
+	if cfg.MaxIdleConns > 0 {
+		transport.MaxIdleConns = cfg.MaxIdleConns
+		transport.MaxIdleConnsPerHost = cfg.MaxIdleConns
+	}
+	if cfg.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.ProxyURL != "" {
+		if proxy, err := url.Parse(cfg.ProxyURL); err == nil {
+			transport.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	return transport
+}
+
+// WithTransport sends requests through transport instead, still counted in
+// the metrics, e.g. to answer them in tests. Set it before the client is
+// used.
+func (rc *ResilientClient) WithTransport(transport http.RoundTripper) *ResilientClient {
+	rc.transport.base = transport
+	return rc
+}
+
+// Do sends req, retrying transient failures. Requests must have a
+// replayable body (http.NewRequest sets GetBody for in-memory readers).
+func (rc *ResilientClient) Do(req *http.Request) (*http.Response, error) {
+	allowed, probe := rc.breaker.allow()
+	if !allowed {
+		return nil, ErrCircuitOpen
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= rc.maxRetries; attempt++ {
+		// a caller giving up says nothing about the provider, so nothing is
+		// counted, but a probe it was sending is given back
+		if err := req.Context().Err(); err != nil {
+			rc.breaker.release(probe)
+			return nil, err
+		}
+		if attempt > 0 {
+			if err := rc.wait(req, attempt); err != nil {
+				rc.breaker.release(probe)
+				return nil, err
+			}
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					lastErr = err
+					break
+				}
+				req.Body = body
+			}
+		}
+
+		resp, err := rc.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode >= http.StatusInternalServerError {
+			resp.Body.Close()
+			lastErr = fmt.Errorf("provider returned status %d", resp.StatusCode)
+			continue
+		}
+
+		rc.breaker.recordSuccess()
+		return resp, nil
+	}
+
+	rc.breaker.recordFailure()
+	return nil, lastErr
+}
+
+// Health reports the state of the client's circuit breaker
+func (rc *ResilientClient) Health() ProviderHealth {
+	return rc.breaker.health()
+}
+
+func (rc *ResilientClient) wait(req *http.Request, attempt int) error {
+	backoff := rc.baseBackoff << (attempt - 1)
+	if backoff > rc.maxBackoff || backoff <= 0 {
+		backoff = rc.maxBackoff
+	}
+	delay := time.Duration(rand.Int63n(int64(backoff)) + 1)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-req.Context().Done():
+		return req.Context().Err()
+	}
+}
+
+type circuitBreaker struct {
+	mu           sync.Mutex
+	threshold    int
+	openDuration time.Duration
+	failures     int
+	openedAt     time.Time
+	lastFailure  time.Time
+	halfOpen     bool
+}
+
+// allow reports whether a request may be sent, and whether it is the
+// single probe let through once the circuit has been open long enough
+func (b *circuitBreaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, false
+	}
+
+	// after the cool-down let a single probe request through
+	if !b.halfOpen && time.Since(b.openedAt) >= b.openDuration {
+		b.halfOpen = true
+		return true, true
+	}
+	return false, false
+}
+
+// release gives back a probe that ended without an answer from the
+// provider, counting nothing, so the next request probes instead
+func (b *circuitBreaker) release(probe bool) {
+	if !probe {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.halfOpen = false
+}
+
+func (b *circuitBreaker) recordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.halfOpen = false
+}
+
+func (b *circuitBreaker) recordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastFailure = time.Now()
+	if b.failures >= b.threshold {
+		b.openedAt = b.lastFailure
+		b.halfOpen = false
+	}
+}
+
+func (b *circuitBreaker) state() string {
+	if b.failures < b.threshold {
+		return CircuitClosed
+	}
+	if b.halfOpen || time.Since(b.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return CircuitOpen
+}
+
+func (b *circuitBreaker) health() ProviderHealth {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.state()
+	health := ProviderHealth{
+		Healthy:             state == CircuitClosed,
+		State:               state,
+		ConsecutiveFailures: b.failures,
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		health.LastFailureAt = &lastFailure
+	}
+	return health
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader carries the id of the API request an outbound call was
+// made for, so the provider's logs can be matched with ours
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the id of the API request being
+// served, which outbound calls made under it pass on
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFromContext returns the id WithRequestID stored, or ""
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// outboundLatencyBuckets are the upper bounds, in seconds, of the provider
+// call duration histogram. Providers are slower than our own requests.
+var outboundLatencyBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type outboundClient struct {
+	// requests counts attempts by status class: 2xx, 4xx, 5xx or error
+	requests    map[string]int64
+	durations   []int64
+	durationSum float64
+	total       int64
+}
+
+// OutboundMetrics counts the calls made to providers, per client, for the
+// /metrics endpoint. Each retry is counted as a call of its own.
+type OutboundMetrics struct {
+	mu      sync.Mutex
+	clients map[string]*outboundClient
+}
+
+func NewOutboundMetrics() *OutboundMetrics {
+	return &OutboundMetrics{clients: make(map[string]*outboundClient)}
+}
+
+var defaultOutboundMetrics = NewOutboundMetrics()
+
+// DefaultOutboundMetrics is where every ResilientClient counts its calls
+func DefaultOutboundMetrics() *OutboundMetrics {
+	return defaultOutboundMetrics
+}
+
+// Record counts one call by client that got status, or failed with err
+// before a response
+func (m *OutboundMetrics) Record(client string, status int, err error, duration time.Duration) {
+	class := "error"
+	if err == nil {
+		class = fmt.Sprintf("%dxx", status/100)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.clients[client]
+	if !ok {
+		c = &outboundClient{requests: make(map[string]int64), durations: make([]int64, len(outboundLatencyBuckets)+1)}
+		m.clients[client] = c
+	}
+	c.requests[class]++
+	c.total++
+	c.durationSum += duration.Seconds()
+	bucket := sort.SearchFloat64s(outboundLatencyBuckets, duration.Seconds())
+	c.durations[bucket]++
+}
+
+// WriteMetrics writes the call counts in the Prometheus text exposition
+// format. Nothing is written before the first call.
+func (m *OutboundMetrics) WriteMetrics(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.clients) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(m.clients))
+	for name := range m.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	metric := func(name, kind, help string) {
+		lines = append(lines, fmt.Sprintf("# HELP %s %s", name, help), fmt.Sprintf("# TYPE %s %s", name, kind))
+	}
+	sample := func(name, labels string, value interface{}) {
+		lines = append(lines, fmt.Sprintf("%s{%s} %v", name, labels, value))
+	}
+
+	metric("outbound_http_requests_total", "counter", "Calls made to providers, by status class.")
+	for _, name := range names {
+		c := m.clients[name]
+		classes := make([]string, 0, len(c.requests))
+		for class := range c.requests {
+			classes = append(classes, class)
+		}
+		sort.Strings(classes)
+		for _, class := range classes {
+			sample("outbound_http_requests_total", fmt.Sprintf("client=%q,code=%q", name, class), c.requests[class])
+		}
+	}
+
+	metric("outbound_http_request_duration_seconds", "histogram", "Provider call latency.")
+	for _, name := range names {
+		c := m.clients[name]
+		var cumulative int64
+		for i, bound := range outboundLatencyBuckets {
+			cumulative += c.durations[i]
+			sample("outbound_http_request_duration_seconds_bucket", fmt.Sprintf("client=%q,le=\"%v\"", name, bound), cumulative)
+		}
+		sample("outbound_http_request_duration_seconds_bucket", fmt.Sprintf("client=%q,le=\"+Inf\"", name), c.total)
+		sample("outbound_http_request_duration_seconds_sum", fmt.Sprintf("client=%q", name), c.durationSum)
+		sample("outbound_http_request_duration_seconds_count", fmt.Sprintf("client=%q", name), c.total)
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// instrumentedTransport times every call, passes on the request id and
+// logs calls that fail
+type instrumentedTransport struct {
+	name    string
+	base    http.RoundTripper
+	metrics *OutboundMetrics
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	requestID := RequestIDFromContext(req.Context())
+	if requestID != "" && req.Header.Get(RequestIDHeader) == "" {
+		// a RoundTripper must not change the request it is given
+		req = req.Clone(req.Context())
+		req.Header.Set(RequestIDHeader, requestID)
+	}
+
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	duration := time.Since(start)
+
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	t.metrics.Record(t.name, status, err, duration)
+	if err != nil || status >= http.StatusInternalServerError {
+		log.Printf("outbound %s %s %s%s failed: status=%d error=%v duration=%s request_id=%s",
+			t.name, req.Method, req.URL.Host, req.URL.Path, status, err, duration.Round(time.Millisecond), requestID)
+	}
+	return resp, err
+}
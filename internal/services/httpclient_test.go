@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResilientClient() *ResilientClient {
+	return NewResilientClient(HTTPClientConfig{
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       2 * time.Millisecond,
+		FailureThreshold: 2,
+		OpenDuration:     time.Hour,
+	}).WithTransport(httpmock.DefaultTransport)
+}
+
+func TestResilientClientRetries(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	const endpoint = "https://provider.example.com/send"
+
+	tests := []struct {
+		name          string
+		responder     httpmock.Responder
+		expectedCalls int
+		expectedError string
+	}{
+		{
+			name: "recovers after transient 5xx",
+			responder: httpmock.ResponderFromMultipleResponses([]*http.Response{
+				httpmock.NewStringResponse(http.StatusBadGateway, ""),
+				httpmock.NewStringResponse(http.StatusOK, "ok"),
+			}),
+			expectedCalls: 2,
+		},
+		{
+			name:          "does not retry 4xx",
+			responder:     httpmock.NewStringResponder(http.StatusUnauthorized, "denied"),
+			expectedCalls: 1,
+		},
+		{
+			name:          "gives up after max retries",
+			responder:     httpmock.NewErrorResponder(fmt.Errorf("network error")),
+			expectedCalls: 3,
+			expectedError: "network error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpmock.Reset()
+			httpmock.RegisterResponder("POST", endpoint, tt.responder)
+
+			client := newTestResilientClient()
+			req, _ := http.NewRequest("POST", endpoint, strings.NewReader("to=%2B254740827150"))
+
+			resp, err := client.Do(req)
+			if tt.expectedError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				resp.Body.Close()
+			}
+
+			assert.Equal(t, tt.expectedCalls, httpmock.GetCallCountInfo()["POST "+endpoint])
+		})
+	}
+}
+
+func TestResilientClientCircuitBreaker(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	const endpoint = "https://provider.example.com/send"
+	httpmock.RegisterResponder("POST", endpoint, httpmock.NewStringResponder(http.StatusServiceUnavailable, ""))
+
+	client := newTestResilientClient()
+	assert.True(t, client.Health().Healthy)
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", endpoint, strings.NewReader("message=hi"))
+		_, err := client.Do(req)
+		assert.Error(t, err)
+	}
+
+	health := client.Health()
+	assert.False(t, health.Healthy)
+	assert.Equal(t, CircuitOpen, health.State)
+	assert.Equal(t, 2, health.ConsecutiveFailures)
+
+	callsBefore := httpmock.GetTotalCallCount()
+	req, _ := http.NewRequest("POST", endpoint, strings.NewReader("message=hi"))
+	_, err := client.Do(req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, callsBefore, httpmock.GetTotalCallCount())
+}
+
+func TestResilientClientCancelledProbe(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	client := NewResilientClient(HTTPClientConfig{
+		MaxRetries:       DefaultHTTPClientConfig().MaxRetries,
+		BaseBackoff:      time.Millisecond,
+		MaxBackoff:       2 * time.Millisecond,
+		FailureThreshold: 1,
+		OpenDuration:     10 * time.Millisecond,
+	}).WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+	}))
+	send := func(ctx context.Context) error {
+		req, _ := http.NewRequestWithContext(ctx, "POST", "https://provider.example.com/send", strings.NewReader("message=hi"))
+		_, err := client.Do(req)
+		return err
+	}
+
+	assert.Error(t, send(context.Background()))
+	assert.Equal(t, CircuitOpen, client.Health().State)
+	time.Sleep(20 * time.Millisecond)
+
+	// the caller gives up on the probe, which says nothing about the provider
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, send(cancelled), context.Canceled)
+	assert.Equal(t, 1, client.Health().ConsecutiveFailures)
+
+	status = http.StatusOK
+	assert.NoError(t, send(context.Background()), "the next request probes instead")
+	assert.Equal(t, CircuitClosed, client.Health().State)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestResilientClientInstrumentation(t *testing.T) {
+	const endpoint = "https://provider.example.com/send"
+
+	var requestIDs []string
+	responses := []int{http.StatusBadGateway, http.StatusOK}
+	client := NewResilientClient(HTTPClientConfig{
+		Name:        "instrumented",
+		Timeout:     time.Second,
+		MaxRetries:  2,
+		BaseBackoff: time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}).WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requestIDs = append(requestIDs, req.Header.Get(RequestIDHeader))
+		status := responses[0]
+		responses = responses[1:]
+		return httpmock.NewStringResponse(status, ""), nil
+	}))
+
+	req, _ := http.NewRequestWithContext(WithRequestID(context.Background(), "req-123"), "POST", endpoint, strings.NewReader("message=hi"))
+	resp, err := client.Do(req)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"req-123", "req-123"}, requestIDs, "every attempt carries the request id")
+	assert.Empty(t, req.Header.Get(RequestIDHeader), "the caller's request is left as it was")
+
+	var metrics strings.Builder
+	assert.NoError(t, DefaultOutboundMetrics().WriteMetrics(&metrics))
+	assert.Contains(t, metrics.String(), `outbound_http_requests_total{client="instrumented",code="2xx"} 1`)
+	assert.Contains(t, metrics.String(), `outbound_http_requests_total{client="instrumented",code="5xx"} 1`)
+	assert.Contains(t, metrics.String(), `outbound_http_request_duration_seconds_count{client="instrumented"} 2`)
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// IdentityStore maps the accounts staff sign in with at each identity
+// provider to local users, so one person on Google Workspace and Azure AD
+// is the same user with the same roles and sessions
+type IdentityStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewIdentityStore(db *gorm.DB) *IdentityStore {
+	return &IdentityStore{db: db, now: time.Now}
+}
+
+// Resolve returns the identity of subject at provider, linking it to the
+// user with the provider's email on its first login. created reports
+// whether it was linked just now.
+func (s *IdentityStore) Resolve(ctx context.Context, provider, subject, email, name string) (identity models.UserIdentity, created bool, err error) {
+	db := s.db.WithContext(ctx)
+	now := s.now()
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	err = db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err == nil {
+		identity.ProviderEmail = email
+		identity.Name = name
+		identity.LastLoginAt = now
+		err = db.Model(&identity).Updates(map[string]interface{}{"provider_email": email, "name": name, "last_login_at": now}).Error
+		return identity, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return identity, false, err
+	}
+
+	identity = models.UserIdentity{
+		Provider:      provider,
+		Subject:       subject,
+		Email:         email,
+		ProviderEmail: email,
+		Name:          name,
+		CreatedAt:     now,
+		LastLoginAt:   now,
+	}
+	// two first logins racing: the loser reads the winner's link
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&identity)
+	if result.Error != nil {
+		return identity, false, fmt.Errorf("failed to link identity: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		err = db.Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+		return identity, false, err
+	}
+	return identity, true, nil
+}
+
+// List returns the identities linked to email, or every identity when email
+// is empty, most recently used first
+func (s *IdentityStore) List(ctx context.Context, email string) ([]models.UserIdentity, error) {
+	query := s.db.WithContext(ctx).Order("last_login_at DESC, id DESC")
+	if email != "" {
+		query = query.Where("email = ?", strings.ToLower(strings.TrimSpace(email)))
+	}
+	var identities []models.UserIdentity
+	err := query.Find(&identities).Error
+	return identities, err
+}
+
+// Relink points an identity at another user. Sessions already started with
+// it keep the old user until they end.
+func (s *IdentityStore) Relink(ctx context.Context, id uint, email string) (models.UserIdentity, error) {
+	var identity models.UserIdentity
+	db := s.db.WithContext(ctx)
+	if err := db.First(&identity, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return identity, ErrIdentityNotFound
+		}
+		return identity, err
+	}
+	identity.Email = strings.ToLower(strings.TrimSpace(email))
+	return identity, db.Model(&identity).UpdateColumn("email", identity.Email).Error
+}
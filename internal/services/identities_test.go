@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestIdentityStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "identities.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+
+	ctx := context.Background()
+	store := NewIdentityStore(db)
+
+	google, created, err := store.Resolve(ctx, "google", "g-1", "Wanjiru@Example.com", "Wanjiru")
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "wanjiru@example.com", google.Email)
+
+	microsoft, created, err := store.Resolve(ctx, "microsoft", "m-1", "wanjiru@example.com", "Wanjiru")
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.NotEqual(t, google.ID, microsoft.ID, "each provider account is an identity of its own")
+
+	identities, err := store.List(ctx, "wanjiru@example.com")
+	require.NoError(t, err)
+	assert.Len(t, identities, 2, "both sign in as the same user")
+
+	// the provider renames the account; it stays linked to the same user
+	again, created, err := store.Resolve(ctx, "google", "g-1", "w.kamau@example.com", "Wanjiru Kamau")
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, google.ID, again.ID)
+	assert.Equal(t, "wanjiru@example.com", again.Email)
+	assert.Equal(t, "w.kamau@example.com", again.ProviderEmail)
+
+	relinked, err := store.Relink(ctx, microsoft.ID, "ops@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "ops@example.com", relinked.Email)
+	again, _, err = store.Resolve(ctx, "microsoft", "m-1", "wanjiru@example.com", "Wanjiru")
+	require.NoError(t, err)
+	assert.Equal(t, "ops@example.com", again.Email, "a relinked identity keeps its new user")
+
+	_, err = store.Relink(ctx, 999, "ops@example.com")
+	assert.ErrorIs(t, err, ErrIdentityNotFound)
+}
@@ -1,6 +1,76 @@
 package services
 
+import (
+	"context"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// SMSServiceInterface sends text messages. Cancelling ctx aborts the
+// provider call, including any pending retries. SendBulkSMS reports the
+// outcome per recipient and only errors when no recipient was sent to.
 type SMSServiceInterface interface {
-	SendSMS(to, message string) error
-	SendBulkSMS(recipients []string, message string) error
-}
\ No newline at end of file
+	SendSMS(ctx context.Context, to, message string) error
+	SendBulkSMS(ctx context.Context, recipients []string, message string) (BulkSMSResult, error)
+}
+
+// NotificationService delivers a notification to a customer over whichever
+// channel it implements. It errors when the customer could not be reached.
+type NotificationService interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// EmailSender delivers an email to every one of its recipients, or errors
+type EmailSender interface {
+	SendEmail(ctx context.Context, email Email) error
+}
+
+// PushSender pushes a message to one device. It returns ErrPushTokenInvalid
+// when the device no longer accepts pushes.
+type PushSender interface {
+	Send(ctx context.Context, token string, message PushMessage) error
+}
+
+// CachePurger evicts cached responses tagged with any of the surrogate keys
+// from the CDN in front of the API
+type CachePurger interface {
+	Purge(ctx context.Context, keys ...string) error
+}
+
+// MarketingPlatform keeps segments of customers in a marketing tool
+type MarketingPlatform interface {
+	// Upsert creates or updates contact with their fields and puts them in
+	// segment. It returns ErrContactRejected for a contact the platform
+	// cannot hold, which is skipped rather than failing the sync.
+	Upsert(ctx context.Context, segment MarketingSegment, contact MarketingContact) error
+	// Remove takes contact out of segment; a contact not in it is fine
+	Remove(ctx context.Context, segment MarketingSegment, contact MarketingContact) error
+}
+
+// ProviderHealthChecker is implemented by services backed by an external
+// provider that can report its availability
+type ProviderHealthChecker interface {
+	Health() ProviderHealth
+}
+
+// SMSFailureReporter is implemented by SMS services that count why
+// messages failed
+type SMSFailureReporter interface {
+	Failures() *SMSFailureTracker
+}
+
+// SMSMessageLogger is implemented by SMS services that can store the
+// messages they send themselves
+type SMSMessageLogger interface {
+	LogsMessages() bool
+}
+
+type AuditRecorder interface {
+	Record(event models.AuditEvent)
+}
+
+// FlagChecker reports whether a feature flag is on for subject; the
+// features.Store is one
+type FlagChecker interface {
+	Enabled(ctx context.Context, key, subject string) bool
+}
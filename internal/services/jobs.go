@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// JobHistory keeps background job runs in the job_runs table. It is the
+// scheduler's jobs.History.
+type JobHistory struct {
+	db *gorm.DB
+}
+
+func NewJobHistory(db *gorm.DB) *JobHistory {
+	return &JobHistory{db: db}
+}
+
+// Started records a run as running and returns its id
+func (h *JobHistory) Started(ctx context.Context, job, trigger string, at time.Time) (uint, error) {
+	run := models.JobRun{Job: job, Trigger: trigger, Status: models.JobRunRunning, StartedAt: at}
+	if err := h.db.WithContext(ctx).Create(&run).Error; err != nil {
+		return 0, fmt.Errorf("failed to record job run: %w", err)
+	}
+	return run.ID, nil
+}
+
+// Finished records the outcome of a run; runErr is nil when it succeeded
+func (h *JobHistory) Finished(ctx context.Context, id uint, duration time.Duration, runErr error) error {
+	updates := map[string]interface{}{
+		"status":      models.JobRunSucceeded,
+		"finished_at": time.Now(),
+		"duration_ms": duration.Milliseconds(),
+	}
+	if runErr != nil {
+		updates["status"] = models.JobRunFailed
+		updates["error"] = runErr.Error()
+	}
+	return h.db.WithContext(ctx).Model(&models.JobRun{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// Last returns the latest run of each job that has run, by job name
+func (h *JobHistory) Last(ctx context.Context) (map[string]models.JobRun, error) {
+	var runs []models.JobRun
+	err := h.db.WithContext(ctx).
+		Where("id IN (?)", h.db.Model(&models.JobRun{}).Select("MAX(id)").Group("job")).
+		Find(&runs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load last job runs: %w", err)
+	}
+
+	last := make(map[string]models.JobRun, len(runs))
+	for _, run := range runs {
+		last[run.Job] = run
+	}
+	return last, nil
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LoadShedConfig sets when low priority requests, such as reports and
+// exports, are turned away so the rest stay responsive
+type LoadShedConfig struct {
+	Disabled bool
+	// MaxInFlight is how many requests may be served at once before low
+	// priority ones are shed
+	MaxInFlight int
+	// MaxLatency is the average latency of the other requests above which
+	// low priority ones are shed
+	MaxLatency time.Duration
+	// RetryAfter is how long shed requests are told to wait
+	RetryAfter time.Duration
+}
+
+func DefaultLoadShedConfig() LoadShedConfig {
+	return LoadShedConfig{
+		MaxInFlight: 200,
+		MaxLatency:  500 * time.Millisecond,
+		RetryAfter:  30 * time.Second,
+	}
+}
+
+// LoadShedConfigFromEnv reads LOAD_SHED_DISABLED, LOAD_SHED_MAX_IN_FLIGHT,
+// LOAD_SHED_MAX_LATENCY and LOAD_SHED_RETRY_AFTER. MaxLatency is left zero
+// when unset, for the caller to default to the latency SLO.
+func LoadShedConfigFromEnv() LoadShedConfig {
+	cfg := DefaultLoadShedConfig()
+	cfg.MaxLatency = 0
+
+	cfg.Disabled, _ = strconv.ParseBool(os.Getenv("LOAD_SHED_DISABLED"))
+	if n, err := strconv.Atoi(os.Getenv("LOAD_SHED_MAX_IN_FLIGHT")); err == nil && n > 0 {
+		cfg.MaxInFlight = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOAD_SHED_MAX_LATENCY")); err == nil && d > 0 {
+		cfg.MaxLatency = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOAD_SHED_RETRY_AFTER")); err == nil && d >= time.Second {
+		cfg.RetryAfter = d
+	}
+	return cfg
+}
+
+// Reasons a LoadMonitor reports overload for
+const (
+	LoadShedInFlight = "in_flight"
+	LoadShedLatency  = "latency"
+)
+
+// loadLatencyWeight is how much each request moves the average latency
+const loadLatencyWeight = 0.2
+
+// loadLatencyStale is how long the average latency counts without new
+// requests. Past it the latency is unknown rather than stuck at its last
+// value while only shed requests come in.
+const loadLatencyStale = 10 * time.Second
+
+// LoadMonitor watches how many requests are in flight and how long the
+// ones that matter take, and reports when the server is overloaded. Like
+// the SLOTracker it only sees the instance it runs in.
+type LoadMonitor struct {
+	cfg      LoadShedConfig
+	inFlight atomic.Int64
+
+	mu        sync.Mutex
+	latency   time.Duration
+	sampledAt time.Time
+	shed      map[string]int64
+	now       func() time.Time
+}
+
+func NewLoadMonitor(cfg LoadShedConfig) *LoadMonitor {
+	defaults := DefaultLoadShedConfig()
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = defaults.MaxInFlight
+	}
+	if cfg.MaxLatency <= 0 {
+		cfg.MaxLatency = defaults.MaxLatency
+	}
+	if cfg.RetryAfter < time.Second {
+		cfg.RetryAfter = defaults.RetryAfter
+	}
+
+	return &LoadMonitor{
+		cfg:  cfg,
+		shed: make(map[string]int64),
+		now:  time.Now,
+	}
+}
+
+// WithClock replaces time.Now, for tests
+func (m *LoadMonitor) WithClock(now func() time.Time) *LoadMonitor {
+	m.now = now
+	return m
+}
+
+// RetryAfter is how long shed requests are told to wait
+func (m *LoadMonitor) RetryAfter() time.Duration {
+	return m.cfg.RetryAfter
+}
+
+// Start counts a request in flight until its Done
+func (m *LoadMonitor) Start() {
+	m.inFlight.Add(1)
+}
+
+// Done ends a request counted by Start. Its duration only moves the
+// average latency when sampled, so slow exports and reports don't shed
+// themselves.
+func (m *LoadMonitor) Done(duration time.Duration, sampled bool) {
+	m.inFlight.Add(-1)
+	if !sampled {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if m.sampledAt.IsZero() || now.Sub(m.sampledAt) > loadLatencyStale {
+		m.latency = duration
+	} else {
+		m.latency += time.Duration(loadLatencyWeight * float64(duration-m.latency))
+	}
+	m.sampledAt = now
+}
+
+// Overloaded returns why low priority requests should be shed now, or ""
+// when they can be served
+func (m *LoadMonitor) Overloaded() string {
+	if m.cfg.Disabled {
+		return ""
+	}
+	if m.inFlight.Load() > int64(m.cfg.MaxInFlight) {
+		return LoadShedInFlight
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.sampledAt.IsZero() && m.now().Sub(m.sampledAt) <= loadLatencyStale && m.latency > m.cfg.MaxLatency {
+		return LoadShedLatency
+	}
+	return ""
+}
+
+// Shed counts a request turned away for reason
+func (m *LoadMonitor) Shed(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.shed[reason]++
+}
+
+// WriteMetrics writes the load and shed counts in the Prometheus text
+// exposition format
+func (m *LoadMonitor) WriteMetrics(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var lines []string
+	metric := func(name, kind, help string) {
+		lines = append(lines, fmt.Sprintf("# HELP %s %s", name, help), fmt.Sprintf("# TYPE %s %s", name, kind))
+	}
+
+	metric("http_requests_in_flight", "gauge", "Requests being served.")
+	lines = append(lines, fmt.Sprintf("http_requests_in_flight %d", m.inFlight.Load()))
+
+	metric("load_shed_requests_total", "counter", "Low priority requests turned away, by reason.")
+	reasons := make([]string, 0, len(m.shed))
+	for reason := range m.shed {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		lines = append(lines, fmt.Sprintf("load_shed_requests_total{reason=%q} %d", reason, m.shed[reason]))
+	}
+
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMonitor(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	monitor := NewLoadMonitor(LoadShedConfig{MaxInFlight: 2, MaxLatency: 100 * time.Millisecond}).WithClock(func() time.Time { return now })
+
+	assert.Equal(t, 30*time.Second, monitor.RetryAfter(), "defaults fill the rest")
+	assert.Empty(t, monitor.Overloaded())
+
+	t.Run("too many requests in flight", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			monitor.Start()
+		}
+		assert.Equal(t, LoadShedInFlight, monitor.Overloaded())
+		monitor.Done(10*time.Millisecond, true)
+		assert.Empty(t, monitor.Overloaded())
+		monitor.Done(10*time.Millisecond, true)
+		monitor.Done(10*time.Millisecond, true)
+	})
+
+	t.Run("slow requests", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			monitor.Start()
+			monitor.Done(time.Second, false)
+		}
+		assert.Empty(t, monitor.Overloaded(), "unsampled requests don't count")
+
+		for i := 0; i < 10; i++ {
+			monitor.Start()
+			monitor.Done(time.Second, true)
+		}
+		assert.Equal(t, LoadShedLatency, monitor.Overloaded())
+
+		now = now.Add(time.Minute)
+		assert.Empty(t, monitor.Overloaded(), "an old average is not trusted")
+		monitor.Start()
+		monitor.Done(20*time.Millisecond, true)
+		assert.Empty(t, monitor.Overloaded())
+	})
+
+	t.Run("metrics", func(t *testing.T) {
+		monitor.Shed(LoadShedLatency)
+		monitor.Shed(LoadShedLatency)
+		monitor.Shed(LoadShedInFlight)
+
+		var out strings.Builder
+		assert.NoError(t, monitor.WriteMetrics(&out))
+		assert.Contains(t, out.String(), "http_requests_in_flight 0\n")
+		assert.Contains(t, out.String(), `load_shed_requests_total{reason="in_flight"} 1`)
+		assert.Contains(t, out.String(), `load_shed_requests_total{reason="latency"} 2`)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		disabled := NewLoadMonitor(LoadShedConfig{Disabled: true, MaxInFlight: 1})
+		disabled.Start()
+		disabled.Start()
+		assert.Empty(t, disabled.Overloaded())
+	})
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+var ErrInvalidShipmentUpdate = errors.New("invalid shipment update")
+
+// ShipmentUpdate is a courier's status update for one of our orders,
+// normalized by the adapter for the courier's payload
+type ShipmentUpdate struct {
+	OrderID uint
+	// EventID identifies the update at the courier, so a retried webhook is
+	// only applied once
+	EventID string
+	// Event is the courier's own name for the update
+	Event string
+	// Status is the order status the update moves the order to, or "" for
+	// updates that do not move it, such as a failed delivery attempt
+	Status         string
+	TrackingNumber string
+	OccurredAt     time.Time
+}
+
+// LogisticsAdapter maps one courier payload to shipment updates
+type LogisticsAdapter interface {
+	Parse(body []byte) ([]ShipmentUpdate, error)
+}
+
+// LogisticsAdapters returns the adapters for the courier payloads we take,
+// by the name couriers pass as ?format=
+func LogisticsAdapters() map[string]LogisticsAdapter {
+	return map[string]LogisticsAdapter{
+		"status": StatusPayloadAdapter{},
+		"events": EventsPayloadAdapter{},
+	}
+}
+
+// AdvancesOrder reports whether a courier may move an order from status to
+// next. Couriers only ship and deliver, and their webhooks can arrive out
+// of order, so an order never moves back, nor out of cancelled.
+func AdvancesOrder(status, next string) bool {
+	rank := map[string]int{
+		models.OrderStatusPending:   1,
+		models.OrderStatusConfirmed: 2,
+		models.OrderStatusShipped:   3,
+		models.OrderStatusDelivered: 4,
+	}
+	return rank[status] > 0 && rank[next] > rank[status]
+}
+
+// courierOrderStatus maps the shipment events couriers send to the order
+// status they mean
+func courierOrderStatus(event string) string {
+	switch strings.ToLower(event) {
+	case "picked_up", "in_transit", "out_for_delivery":
+		return models.OrderStatusShipped
+	case "delivered":
+		return models.OrderStatusDelivered
+	default:
+		return ""
+	}
+}
+
+func parseOrderReference(reference string) (uint, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(reference), "#"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("%w: unknown order reference %q", ErrInvalidShipmentUpdate, reference)
+	}
+	return uint(id), nil
+}
+
+// StatusPayloadAdapter takes one update per webhook with the shipment's
+// current status:
+//
+//	{"event_id": "evt_1", "reference": "42", "tracking_number": "TRK1",
+//	 "status": "IN_TRANSIT", "timestamp": "2025-09-19T10:00:00Z"}
+type StatusPayloadAdapter struct{}
+
+func (StatusPayloadAdapter) Parse(body []byte) ([]ShipmentUpdate, error) {
+	var payload struct {
+		EventID        string    `json:"event_id"`
+		Reference      string    `json:"reference"`
+		TrackingNumber string    `json:"tracking_number"`
+		Status         string    `json:"status"`
+		Timestamp      time.Time `json:"timestamp"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShipmentUpdate, err)
+	}
+	if payload.EventID == "" || payload.Status == "" {
+		return nil, fmt.Errorf("%w: event_id and status are required", ErrInvalidShipmentUpdate)
+	}
+	orderID, err := parseOrderReference(payload.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	return []ShipmentUpdate{{
+		OrderID:        orderID,
+		EventID:        payload.EventID,
+		Event:          strings.ToLower(payload.Status),
+		Status:         courierOrderStatus(payload.Status),
+		TrackingNumber: payload.TrackingNumber,
+		OccurredAt:     payload.Timestamp,
+	}}, nil
+}
+
+// EventsPayloadAdapter takes a shipment with the events since the last
+// webhook:
+//
+//	{"shipment": {"id": "SHP1", "merchant_reference": "42"},
+//	 "events": [{"id": "e1", "type": "picked_up", "occurred_at": "2025-09-19T10:00:00Z"}]}
+type EventsPayloadAdapter struct{}
+
+func (EventsPayloadAdapter) Parse(body []byte) ([]ShipmentUpdate, error) {
+	var payload struct {
+		Shipment struct {
+			ID                string `json:"id"`
+			MerchantReference string `json:"merchant_reference"`
+		} `json:"shipment"`
+		Events []struct {
+			ID         string    `json:"id"`
+			Type       string    `json:"type"`
+			OccurredAt time.Time `json:"occurred_at"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidShipmentUpdate, err)
+	}
+	if len(payload.Events) == 0 {
+		return nil, fmt.Errorf("%w: no events", ErrInvalidShipmentUpdate)
+	}
+	orderID, err := parseOrderReference(payload.Shipment.MerchantReference)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make([]ShipmentUpdate, 0, len(payload.Events))
+	for _, event := range payload.Events {
+		if event.ID == "" || event.Type == "" {
+			return nil, fmt.Errorf("%w: every event needs an id and a type", ErrInvalidShipmentUpdate)
+		}
+		updates = append(updates, ShipmentUpdate{
+			OrderID:        orderID,
+			EventID:        event.ID,
+			Event:          strings.ToLower(event.Type),
+			Status:         courierOrderStatus(event.Type),
+			TrackingNumber: payload.Shipment.ID,
+			OccurredAt:     event.OccurredAt,
+		})
+	}
+	return updates, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogisticsAdapters(t *testing.T) {
+	at := time.Date(2025, 9, 19, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		format   string
+		body     string
+		expected []ShipmentUpdate
+		invalid  bool
+	}{
+		{
+			name:   "status payload",
+			format: "status",
+			body:   `{"event_id": "evt_1", "reference": "#42", "tracking_number": "TRK1", "status": "OUT_FOR_DELIVERY", "timestamp": "2025-09-19T10:00:00Z"}`,
+			expected: []ShipmentUpdate{
+				{OrderID: 42, EventID: "evt_1", Event: "out_for_delivery", Status: models.OrderStatusShipped, TrackingNumber: "TRK1", OccurredAt: at},
+			},
+		},
+		{
+			name:   "status payload that does not move the order",
+			format: "status",
+			body:   `{"event_id": "evt_2", "reference": "42", "status": "DELIVERY_FAILED"}`,
+			expected: []ShipmentUpdate{
+				{OrderID: 42, EventID: "evt_2", Event: "delivery_failed"},
+			},
+		},
+		{
+			name:    "status payload without an order",
+			format:  "status",
+			body:    `{"event_id": "evt_3", "reference": "ORD-42", "status": "DELIVERED"}`,
+			invalid: true,
+		},
+		{
+			name:   "events payload",
+			format: "events",
+			body:   `{"shipment": {"id": "SHP1", "merchant_reference": "42"}, "events": [{"id": "e1", "type": "picked_up", "occurred_at": "2025-09-19T10:00:00Z"}, {"id": "e2", "type": "Delivered"}]}`,
+			expected: []ShipmentUpdate{
+				{OrderID: 42, EventID: "e1", Event: "picked_up", Status: models.OrderStatusShipped, TrackingNumber: "SHP1", OccurredAt: at},
+				{OrderID: 42, EventID: "e2", Event: "delivered", Status: models.OrderStatusDelivered, TrackingNumber: "SHP1"},
+			},
+		},
+		{
+			name:    "events payload without events",
+			format:  "events",
+			body:    `{"shipment": {"id": "SHP1", "merchant_reference": "42"}, "events": []}`,
+			invalid: true,
+		},
+		{
+			name:    "malformed json",
+			format:  "events",
+			body:    `{"shipment":`,
+			invalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updates, err := LogisticsAdapters()[tt.format].Parse([]byte(tt.body))
+			if tt.invalid {
+				assert.True(t, errors.Is(err, ErrInvalidShipmentUpdate), "error: %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, updates)
+		})
+	}
+}
+
+func TestAdvancesOrder(t *testing.T) {
+	assert.True(t, AdvancesOrder(models.OrderStatusPending, models.OrderStatusShipped))
+	assert.True(t, AdvancesOrder(models.OrderStatusShipped, models.OrderStatusDelivered))
+	assert.False(t, AdvancesOrder(models.OrderStatusDelivered, models.OrderStatusShipped))
+	assert.False(t, AdvancesOrder(models.OrderStatusShipped, models.OrderStatusShipped))
+	assert.False(t, AdvancesOrder(models.OrderStatusCancelled, models.OrderStatusDelivered))
+	assert.False(t, AdvancesOrder(models.OrderStatusConfirmed, ""))
+}
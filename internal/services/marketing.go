@@ -0,0 +1,305 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// ErrContactRejected is returned for a contact a marketing platform cannot
+// hold, such as one without an email on Mailchimp or one it refuses
+var ErrContactRejected = errors.New("marketing platform rejected the contact")
+
+// MarketingSegment is where a segment sync puts its customers: the tag Name
+// in the Mailchimp audience Audience, or the Customer.io attribute Name
+type MarketingSegment struct {
+	Audience string
+	Name     string
+}
+
+// MarketingContact is a customer as sent to a marketing platform. Fields
+// are already named as the platform expects.
+type MarketingContact struct {
+	CustomerID uint
+	Email      string
+	// OptedOut customers are kept on the platform but marked unsubscribed
+	OptedOut bool
+	Fields   map[string]string
+}
+
+// DefaultMarketingFields are the fields a segment sync sends when none are
+// configured, by platform
+func DefaultMarketingFields(platform string) map[string]string {
+	switch platform {
+	case models.MarketingPlatformMailchimp:
+		return map[string]string{"FNAME": "first_name", "LNAME": "last_name", "PHONE": "phone"}
+	default:
+		return map[string]string{"first_name": "first_name", "last_name": "last_name", "phone": "phone"}
+	}
+}
+
+// MarketingPlatformsFromEnv returns the platforms with credentials set, by
+// name: Mailchimp with MAILCHIMP_API_KEY, and Customer.io with
+// CUSTOMERIO_SITE_ID and CUSTOMERIO_API_KEY (CUSTOMERIO_REGION=eu for its EU
+// data center). Both use the MARKETING_ client settings.
+func MarketingPlatformsFromEnv() map[string]MarketingPlatform {
+	platforms := map[string]MarketingPlatform{}
+	var client *ResilientClient
+	httpClient := func() *ResilientClient {
+		if client == nil {
+			client = NewResilientClient(HTTPClientConfigFromEnv("MARKETING"))
+		}
+		return client
+	}
+	if key := os.Getenv("MAILCHIMP_API_KEY"); key != "" {
+		platforms[models.MarketingPlatformMailchimp] = NewMailchimpClient(key).WithHTTPClient(httpClient())
+	}
+	siteID, key := os.Getenv("CUSTOMERIO_SITE_ID"), os.Getenv("CUSTOMERIO_API_KEY")
+	if siteID != "" && key != "" {
+		platforms[models.MarketingPlatformCustomerIO] = NewCustomerIOClient(siteID, key, os.Getenv("CUSTOMERIO_REGION")).WithHTTPClient(httpClient())
+	}
+	return platforms
+}
+
+// MailchimpClient keeps contacts in Mailchimp audiences through the
+// Marketing API, tagging them with the segment
+type MailchimpClient struct {
+	apiKey  string
+	baseURL string
+	client  *ResilientClient
+}
+
+// NewMailchimpClient calls the data center named at the end of apiKey,
+// such as us21 in "0123abcd-us21"
+func NewMailchimpClient(apiKey string) *MailchimpClient {
+	dc := "us1"
+	if i := strings.LastIndex(apiKey, "-"); i >= 0 && i < len(apiKey)-1 {
+		dc = apiKey[i+1:]
+	}
+	return &MailchimpClient{
+		apiKey:  apiKey,
+		baseURL: "https://" + dc + ".api.mailchimp.com/3.0",
+		client:  NewResilientClient(DefaultHTTPClientConfig()),
+	}
+}
+
+// WithHTTPClient replaces the default API client, e.g. to tune timeouts
+func (m *MailchimpClient) WithHTTPClient(client *ResilientClient) *MailchimpClient {
+	m.client = client
+	return m
+}
+
+// Upsert adds or updates the member with contact's email, then tags them.
+// An opted out contact is unsubscribed, so no campaign reaches them.
+func (m *MailchimpClient) Upsert(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	if contact.Email == "" {
+		return fmt.Errorf("%w: no email", ErrContactRejected)
+	}
+	status := "subscribed"
+	if contact.OptedOut {
+		status = "unsubscribed"
+	}
+	member := map[string]interface{}{
+		"email_address": contact.Email,
+		"status_if_new": status,
+	}
+	if contact.OptedOut {
+		member["status"] = status
+	}
+	if len(contact.Fields) > 0 {
+		member["merge_fields"] = contact.Fields
+	}
+	if err := m.call(ctx, http.MethodPut, m.memberPath(segment, contact.Email), member); err != nil {
+		return err
+	}
+	return m.tag(ctx, segment, contact.Email, "active")
+}
+
+// Remove takes the tag off the member; members who are gone are fine
+func (m *MailchimpClient) Remove(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	if contact.Email == "" {
+		return nil
+	}
+	err := m.tag(ctx, segment, contact.Email, "inactive")
+	if errors.Is(err, errMarketingNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (m *MailchimpClient) tag(ctx context.Context, segment MarketingSegment, email, status string) error {
+	body := map[string]interface{}{
+		"tags": []map[string]string{{"name": segment.Name, "status": status}},
+	}
+	return m.call(ctx, http.MethodPost, m.memberPath(segment, email)+"/tags", body)
+}
+
+// memberPath addresses a member by the MD5 of their lowercased email, as
+// Mailchimp does
+func (m *MailchimpClient) memberPath(segment MarketingSegment, email string) string {
+	hash := md5.Sum([]byte(strings.ToLower(email)))
+	return "/lists/" + url.PathEscape(segment.Audience) + "/members/" + hex.EncodeToString(hash[:])
+}
+
+func (m *MailchimpClient) call(ctx context.Context, method, path string, body interface{}) error {
+	return marketingCall(ctx, m.client, method, m.baseURL+path, body, func(req *http.Request) {
+		req.SetBasicAuth("savannah", m.apiKey)
+	})
+}
+
+// CustomerIOClient keeps customers in Customer.io through the Track API,
+// identified by their id. Their segment attribute is true while they are
+// in it and false once removed.
+type CustomerIOClient struct {
+	siteID  string
+	apiKey  string
+	baseURL string
+	client  *ResilientClient
+}
+
+// NewCustomerIOClient calls the EU data center when region is "eu", and
+// the US one otherwise
+func NewCustomerIOClient(siteID, apiKey, region string) *CustomerIOClient {
+	baseURL := "https://track.customer.io/api/v1"
+	if strings.EqualFold(region, "eu") {
+		baseURL = "https://track-eu.customer.io/api/v1"
+	}
+	return &CustomerIOClient{
+		siteID:  siteID,
+		apiKey:  apiKey,
+		baseURL: baseURL,
+		client:  NewResilientClient(DefaultHTTPClientConfig()),
+	}
+}
+
+// WithHTTPClient replaces the default API client, e.g. to tune timeouts
+func (c *CustomerIOClient) WithHTTPClient(client *ResilientClient) *CustomerIOClient {
+	c.client = client
+	return c
+}
+
+// Upsert creates or updates the customer with contact's fields and sets
+// their segment attribute. An opted out contact is marked unsubscribed.
+func (c *CustomerIOClient) Upsert(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	attributes := map[string]interface{}{
+		segment.Name:   true,
+		"unsubscribed": contact.OptedOut,
+	}
+	if contact.Email != "" {
+		attributes["email"] = contact.Email
+	}
+	for name, value := range contact.Fields {
+		attributes[name] = value
+	}
+	return c.identify(ctx, contact, attributes)
+}
+
+// Remove clears the customer's segment attribute
+func (c *CustomerIOClient) Remove(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	return c.identify(ctx, contact, map[string]interface{}{segment.Name: false})
+}
+
+func (c *CustomerIOClient) identify(ctx context.Context, contact MarketingContact, attributes map[string]interface{}) error {
+	endpoint := c.baseURL + "/customers/" + strconv.FormatUint(uint64(contact.CustomerID), 10)
+	return marketingCall(ctx, c.client, http.MethodPut, endpoint, attributes, func(req *http.Request) {
+		req.SetBasicAuth(c.siteID, c.apiKey)
+	})
+}
+
+var errMarketingNotFound = errors.New("marketing platform returned status 404")
+
+// marketingCall sends body as JSON. A 400 is the platform refusing the
+// contact, which is wrapped in ErrContactRejected; any other failure is
+// the platform's or the sync's.
+func marketingCall(ctx context.Context, client *ResilientClient, method, endpoint string, body interface{}, authorize func(*http.Request)) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	authorize(req)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call marketing platform: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil
+	}
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", errMarketingNotFound, bytes.TrimSpace(excerpt))
+	case http.StatusBadRequest:
+		return fmt.Errorf("%w: %s", ErrContactRejected, bytes.TrimSpace(excerpt))
+	}
+	return fmt.Errorf("marketing platform returned status %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+}
+
+// MockMarketingPlatform records the contacts in each segment instead of
+// sending them anywhere
+type MockMarketingPlatform struct {
+	mu       sync.Mutex
+	segments map[string]map[uint]MarketingContact
+	// Err, when set, is returned by every call
+	Err error
+}
+
+func NewMockMarketingPlatform() *MockMarketingPlatform {
+	return &MockMarketingPlatform{segments: map[string]map[uint]MarketingContact{}}
+}
+
+func (m *MockMarketingPlatform) Upsert(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	if m.segments[segment.Name] == nil {
+		m.segments[segment.Name] = map[uint]MarketingContact{}
+	}
+	m.segments[segment.Name][contact.CustomerID] = contact
+	return nil
+}
+
+func (m *MockMarketingPlatform) Remove(ctx context.Context, segment MarketingSegment, contact MarketingContact) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.Err != nil {
+		return m.Err
+	}
+	delete(m.segments[segment.Name], contact.CustomerID)
+	return nil
+}
+
+// Segment returns the contacts in segment, by customer id
+func (m *MockMarketingPlatform) Segment(name string) map[uint]MarketingContact {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	contacts := make(map[uint]MarketingContact, len(m.segments[name]))
+	for id, contact := range m.segments[name] {
+		contacts[id] = contact
+	}
+	return contacts
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMailchimpClient(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// md5 of "sebbie@example.com"
+	const member = "https://us21.api.mailchimp.com/3.0/lists/a1b2c3d4/members/e9f0a47f4f28fc54a6f343cd31429e20"
+	bodies := map[string]map[string]interface{}{}
+	record := func(status int) httpmock.Responder {
+		return func(req *http.Request) (*http.Response, error) {
+			user, key, _ := req.BasicAuth()
+			assert.Equal(t, "savannah", user)
+			assert.Equal(t, "0123abcd-us21", key)
+			var body map[string]interface{}
+			raw, _ := io.ReadAll(req.Body)
+			require.NoError(t, json.Unmarshal(raw, &body))
+			bodies[req.Method+" "+req.URL.Path] = body
+			return httpmock.NewStringResponse(status, `{}`), nil
+		}
+	}
+
+	client := NewMailchimpClient("0123abcd-us21").WithHTTPClient(newTestResilientClient())
+	segment := MarketingSegment{Audience: "a1b2c3d4", Name: "vip"}
+	ctx := context.Background()
+
+	t.Run("upserts the member and tags them", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder("PUT", member, record(http.StatusOK))
+		httpmock.RegisterResponder("POST", member+"/tags", record(http.StatusNoContent))
+
+		err := client.Upsert(ctx, segment, MarketingContact{CustomerID: 1, Email: "Sebbie@example.com", OptedOut: true, Fields: map[string]string{"FNAME": "Sebbie"}})
+		require.NoError(t, err)
+
+		put := bodies["PUT /3.0/lists/a1b2c3d4/members/e9f0a47f4f28fc54a6f343cd31429e20"]
+		assert.Equal(t, "unsubscribed", put["status"])
+		assert.Equal(t, map[string]interface{}{"FNAME": "Sebbie"}, put["merge_fields"])
+		tags := bodies["POST /3.0/lists/a1b2c3d4/members/e9f0a47f4f28fc54a6f343cd31429e20/tags"]
+		assert.Equal(t, []interface{}{map[string]interface{}{"name": "vip", "status": "active"}}, tags["tags"])
+	})
+
+	t.Run("rejects contacts without an email or refused", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder("PUT", member, httpmock.NewStringResponder(http.StatusBadRequest, `{"title":"Invalid Resource"}`))
+
+		assert.ErrorIs(t, client.Upsert(ctx, segment, MarketingContact{CustomerID: 1}), ErrContactRejected)
+		assert.ErrorIs(t, client.Upsert(ctx, segment, MarketingContact{CustomerID: 1, Email: "sebbie@example.com"}), ErrContactRejected)
+	})
+
+	t.Run("removing a member who is gone is fine", func(t *testing.T) {
+		httpmock.Reset()
+		httpmock.RegisterResponder("POST", member+"/tags", httpmock.NewStringResponder(http.StatusNotFound, `{"title":"Resource Not Found"}`))
+		assert.NoError(t, client.Remove(ctx, segment, MarketingContact{CustomerID: 1, Email: "sebbie@example.com"}))
+
+		httpmock.RegisterResponder("POST", member+"/tags", httpmock.NewStringResponder(http.StatusUnauthorized, `{"title":"API Key Invalid"}`))
+		err := client.Remove(ctx, segment, MarketingContact{CustomerID: 1, Email: "sebbie@example.com"})
+		assert.EqualError(t, err, `marketing platform returned status 401: {"title":"API Key Invalid"}`)
+	})
+}
+
+func TestCustomerIOClient(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var bodies []map[string]interface{}
+	httpmock.RegisterResponder("PUT", "https://track-eu.customer.io/api/v1/customers/7", func(req *http.Request) (*http.Response, error) {
+		user, key, _ := req.BasicAuth()
+		assert.Equal(t, "site-1", user)
+		assert.Equal(t, "key-1", key)
+		var body map[string]interface{}
+		raw, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(raw, &body))
+		bodies = append(bodies, body)
+		return httpmock.NewStringResponse(http.StatusOK, `{}`), nil
+	})
+
+	client := NewCustomerIOClient("site-1", "key-1", "eu").WithHTTPClient(newTestResilientClient())
+	segment := MarketingSegment{Name: "vip"}
+	ctx := context.Background()
+
+	require.NoError(t, client.Upsert(ctx, segment, MarketingContact{CustomerID: 7, Email: "amina@example.com", Fields: map[string]string{"first_name": "Amina"}}))
+	require.NoError(t, client.Remove(ctx, segment, MarketingContact{CustomerID: 7}))
+
+	require.Len(t, bodies, 2)
+	assert.Equal(t, map[string]interface{}{"vip": true, "unsubscribed": false, "email": "amina@example.com", "first_name": "Amina"}, bodies[0])
+	assert.Equal(t, map[string]interface{}{"vip": false}, bodies[1])
+}
+
+func TestMarketingPlatformsFromEnv(t *testing.T) {
+	t.Setenv("MAILCHIMP_API_KEY", "0123abcd-us21")
+	t.Setenv("CUSTOMERIO_SITE_ID", "site-1")
+	t.Setenv("CUSTOMERIO_API_KEY", "")
+
+	platforms := MarketingPlatformsFromEnv()
+	assert.Len(t, platforms, 1)
+	assert.IsType(t, &MailchimpClient{}, platforms["mailchimp"])
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// Notification is a message for one customer
+type Notification struct {
+	CustomerID uint
+	OrderID    *uint
+	// Phone is where the message is texted, directly or as a fallback
+	Phone   string
+	Title   string
+	Message string
+}
+
+// SMSNotifier sends notifications as text messages
+type SMSNotifier struct {
+	sms SMSServiceInterface
+}
+
+func NewSMSNotifier(sms SMSServiceInterface) *SMSNotifier {
+	return &SMSNotifier{sms: sms}
+}
+
+func (n *SMSNotifier) Notify(ctx context.Context, notification Notification) error {
+	return n.sms.SendSMS(ctx, notification.Phone, notification.Message)
+}
+
+// MockNotifier records notifications instead of sending them
+type MockNotifier struct {
+	mu   sync.Mutex
+	sent []Notification
+}
+
+func NewMockNotifier() *MockNotifier {
+	return &MockNotifier{}
+}
+
+func (m *MockNotifier) Notify(ctx context.Context, notification Notification) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, notification)
+	return nil
+}
+
+// Sent returns every notification sent so far
+func (m *MockNotifier) Sent() []Notification {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Notification(nil), m.sent...)
+}
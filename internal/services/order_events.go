@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultProjectionBatchSize = 500
+
+// ErrNoOrderEvents is returned when rebuilding an order that has no history
+var ErrNoOrderEvents = errors.New("order has no events")
+
+// AppendOrderEvents adds events to the end of the history of order, as it
+// stood before them, and marks its row as up to date with them. Call it in
+// the transaction that changes the row, after the change, so the two never
+// disagree. An order placed before the event log first gets a created
+// event holding its state before these events.
+func AppendOrderEvents(tx *gorm.DB, order models.Order, events ...models.OrderEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	orderID := order.ID
+
+	var last int
+	err := tx.Model(&models.OrderEvent{}).Where("order_id = ?", orderID).
+		Select("COALESCE(MAX(sequence), 0)").Scan(&last).Error
+	if err != nil {
+		return err
+	}
+	if last == 0 && events[0].Type != models.OrderEventCreated {
+		events = append([]models.OrderEvent{OrderCreatedEvent(order, "backfill")}, events...)
+	}
+	for i := range events {
+		last++
+		events[i].OrderID = orderID
+		events[i].Sequence = last
+	}
+	// the unique (order_id, sequence) index stops two writers interleaving
+	if err := tx.Create(&events).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Model(&models.Order{}).Where("id = ?", orderID).
+		UpdateColumn("event_sequence", last).Error
+}
+
+// OrderCreatedEvent records a new order in full
+func OrderCreatedEvent(order models.Order, actor string) models.OrderEvent {
+	event := models.OrderEvent{
+		Type:  models.OrderEventCreated,
+		Actor: actor,
+		Data: models.OrderEventData{
+			Item:                &order.Item,
+			Amount:              &order.Amount,
+			TaxRate:             &order.TaxRate,
+			TaxInclusive:        &order.TaxInclusive,
+			NetAmount:           &order.NetAmount,
+			TaxAmount:           &order.TaxAmount,
+			GrossAmount:         &order.GrossAmount,
+			Time:                &order.Time,
+			Status:              &order.Status,
+			EstimatedDeliveryAt: order.EstimatedDeliveryAt,
+			CustomerID:          &order.CustomerID,
+			ProductID:           order.ProductID,
+			Quantity:            &order.Quantity,
+			Priority:            &order.Priority,
+			SLADeadline:         order.SLADeadline,
+		},
+	}
+	if order.DeliveryInstructions != "" {
+		event.Data.DeliveryInstructions = &order.DeliveryInstructions
+	}
+	if order.PromoCode != nil {
+		event.Data.PromoCode = order.PromoCode
+		event.Data.DiscountAmount = &order.DiscountAmount
+	}
+	return event
+}
+
+// OrderStatusEvent records the order moving to status. Cancelling gets its
+// own event type, as it is the one auditors look for.
+func OrderStatusEvent(status, actor string) models.OrderEvent {
+	eventType := models.OrderEventStatusChanged
+	if status == models.OrderStatusCancelled {
+		eventType = models.OrderEventCancelled
+	}
+	return models.OrderEvent{Type: eventType, Actor: actor, Data: models.OrderEventData{Status: &status}}
+}
+
+// OrderDeletedEvent records the order being deleted
+func OrderDeletedEvent(actor string) models.OrderEvent {
+	return models.OrderEvent{Type: models.OrderEventDeleted, Actor: actor}
+}
+
+// OrderChangeEvents returns an event for each change between before and
+// after, in the order UpdateOrder applies them
+func OrderChangeEvents(before, after models.Order, actor string) []models.OrderEvent {
+	var events []models.OrderEvent
+	add := func(eventType string, data models.OrderEventData) {
+		events = append(events, models.OrderEvent{Type: eventType, Actor: actor, Data: data})
+	}
+
+	if after.Item != before.Item {
+		add(models.OrderEventItemChanged, models.OrderEventData{Item: &after.Item})
+	}
+	if after.Amount != before.Amount || after.GrossAmount != before.GrossAmount {
+		add(models.OrderEventAmountChanged, models.OrderEventData{
+			Amount:      &after.Amount,
+			NetAmount:   &after.NetAmount,
+			TaxAmount:   &after.TaxAmount,
+			GrossAmount: &after.GrossAmount,
+		})
+	}
+	if !after.Time.Equal(before.Time) {
+		add(models.OrderEventTimeChanged, models.OrderEventData{Time: &after.Time})
+	}
+	if after.Status != before.Status {
+		events = append(events, OrderStatusEvent(after.Status, actor))
+	}
+	if after.EstimatedDeliveryAt != nil && (before.EstimatedDeliveryAt == nil || !after.EstimatedDeliveryAt.Equal(*before.EstimatedDeliveryAt)) {
+		add(models.OrderEventDeliveryEstimated, models.OrderEventData{EstimatedDeliveryAt: after.EstimatedDeliveryAt})
+	}
+	if after.DeliveryInstructions != before.DeliveryInstructions {
+		add(models.OrderEventInstructionsChanged, models.OrderEventData{DeliveryInstructions: &after.DeliveryInstructions})
+	}
+	return events
+}
+
+// EraseDeliveryInstructions blanks the delivery instructions of a
+// customer's orders, archived ones included, wherever they were kept: on
+// the orders, in the revisions recorded by updates and in the order
+// events. It is the one change ever made to events, which are written
+// directly since they refuse updates; replaying them still gives the
+// orders as they are. Call it in the transaction that anonymizes the
+// customer.
+func EraseDeliveryInstructions(tx *gorm.DB, customerID uint) error {
+	err := tx.Unscoped().Model(&models.Order{}).Where("customer_id = ?", customerID).
+		UpdateColumn("delivery_instructions", "").Error
+	if err != nil {
+		return err
+	}
+
+	orders := tx.Unscoped().Model(&models.Order{}).Select("id").Where("customer_id = ?", customerID)
+	archived := tx.Model(&models.ArchivedOrder{}).Select("id").Where("customer_id = ?", customerID)
+	err = tx.Model(&models.OrderRevision{}).
+		Where("field = ? AND (order_id IN (?) OR order_id IN (?))", "delivery_instructions", orders, archived).
+		Updates(map[string]interface{}{"old_value": "", "new_value": ""}).Error
+	if err != nil {
+		return err
+	}
+
+	var events []models.OrderEvent
+	err = tx.Where("type IN ? AND (order_id IN (?) OR order_id IN (?))", []string{models.OrderEventCreated, models.OrderEventInstructionsChanged}, orders, archived).
+		Find(&events).Error
+	if err != nil {
+		return err
+	}
+	blank := ""
+	for _, event := range events {
+		if event.Data.DeliveryInstructions == nil || *event.Data.DeliveryInstructions == "" {
+			continue
+		}
+		event.Data.DeliveryInstructions = &blank
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&models.OrderEvent{}).Where("id = ?", event.ID).UpdateColumn("data", string(data)).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayOrder rebuilds an order from its events, which must be in sequence
+// and start with it being created
+func ReplayOrder(events []models.OrderEvent) (models.Order, error) {
+	var order models.Order
+	if len(events) == 0 {
+		return order, ErrNoOrderEvents
+	}
+	if events[0].Type != models.OrderEventCreated {
+		return order, fmt.Errorf("history of order %d starts with %s", events[0].OrderID, events[0].Type)
+	}
+
+	order.ID = events[0].OrderID
+	order.CreatedAt = events[0].CreatedAt
+	for i, event := range events {
+		if event.Sequence != i+1 {
+			return order, fmt.Errorf("history of order %d is missing event %d", order.ID, i+1)
+		}
+		applyOrderEvent(&order, event)
+		order.UpdatedAt = event.CreatedAt
+		order.EventSequence = event.Sequence
+	}
+	return order, nil
+}
+
+func applyOrderEvent(order *models.Order, event models.OrderEvent) {
+	if event.Type == models.OrderEventDeleted {
+		order.DeletedAt = gorm.DeletedAt{Time: event.CreatedAt, Valid: true}
+		return
+	}
+
+	data := event.Data
+	if data.Item != nil {
+		order.Item = *data.Item
+	}
+	if data.Amount != nil {
+		order.Amount = *data.Amount
+	}
+	if data.TaxRate != nil {
+		order.TaxRate = *data.TaxRate
+	}
+	if data.TaxInclusive != nil {
+		order.TaxInclusive = *data.TaxInclusive
+	}
+	if data.NetAmount != nil {
+		order.NetAmount = *data.NetAmount
+	}
+	if data.TaxAmount != nil {
+		order.TaxAmount = *data.TaxAmount
+	}
+	if data.GrossAmount != nil {
+		order.GrossAmount = *data.GrossAmount
+	}
+	if data.Time != nil {
+		order.Time = *data.Time
+	}
+	if data.Status != nil {
+		order.Status = *data.Status
+	}
+	if data.EstimatedDeliveryAt != nil {
+		order.EstimatedDeliveryAt = data.EstimatedDeliveryAt
+	}
+	if data.CustomerID != nil {
+		order.CustomerID = *data.CustomerID
+	}
+	if data.ProductID != nil {
+		order.ProductID = data.ProductID
+	}
+	if data.Quantity != nil {
+		order.Quantity = *data.Quantity
+	}
+	if data.Priority != nil {
+		order.Priority = *data.Priority
+	}
+	if data.SLADeadline != nil {
+		order.SLADeadline = data.SLADeadline
+	}
+	if data.DeliveryInstructions != nil {
+		order.DeliveryInstructions = *data.DeliveryInstructions
+	}
+	if data.PromoCode != nil {
+		order.PromoCode = data.PromoCode
+	}
+	if data.DiscountAmount != nil {
+		order.DiscountAmount = *data.DiscountAmount
+	}
+}
+
+// OrderProjection keeps the orders table in step with the order event log
+type OrderProjection struct {
+	db        *gorm.DB
+	batchSize int
+}
+
+func NewOrderProjection(db *gorm.DB) *OrderProjection {
+	return &OrderProjection{db: db, batchSize: defaultProjectionBatchSize}
+}
+
+// Rebuild replays the events of an order
+func (p *OrderProjection) Rebuild(ctx context.Context, orderID uint) (models.Order, error) {
+	var events []models.OrderEvent
+	err := p.db.WithContext(ctx).Where("order_id = ?", orderID).Order("sequence ASC").Find(&events).Error
+	if err != nil {
+		return models.Order{}, err
+	}
+	return ReplayOrder(events)
+}
+
+// Run starts the history of orders placed before the event log with a
+// created event holding their current state, then rewrites the rows of
+// orders that are behind their events from a replay. It returns how many
+// orders it did either for.
+func (p *OrderProjection) Run(ctx context.Context) (int, error) {
+	started, err := p.startHistories(ctx)
+	if err != nil {
+		return started, fmt.Errorf("failed to start order histories: %w", err)
+	}
+	projected, err := p.project(ctx)
+	if err != nil {
+		return started + projected, fmt.Errorf("failed to project order events: %w", err)
+	}
+	return started + projected, nil
+}
+
+func (p *OrderProjection) startHistories(ctx context.Context) (int, error) {
+	var ids []uint
+	err := p.db.WithContext(ctx).Unscoped().Model(&models.Order{}).
+		Where("NOT EXISTS (SELECT 1 FROM order_events e WHERE e.order_id = orders.id)").
+		Order("id ASC").Limit(p.batchSize).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	started := 0
+	for _, id := range ids {
+		err := WithTx(ctx, p.db, func(tx *gorm.DB) error {
+			// locked, and checked again, so an order being updated right now
+			// is not given two histories
+			var order models.Order
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, id).Error; err != nil {
+				return err
+			}
+			var count int64
+			if err := tx.Model(&models.OrderEvent{}).Where("order_id = ?", id).Count(&count).Error; err != nil || count > 0 {
+				return err
+			}
+
+			events := []models.OrderEvent{OrderCreatedEvent(order, "backfill")}
+			if order.DeletedAt.Valid {
+				events = append(events, OrderDeletedEvent("backfill"))
+			}
+			return AppendOrderEvents(tx, order, events...)
+		})
+		if err != nil {
+			return started, fmt.Errorf("order %d: %w", id, err)
+		}
+		started++
+	}
+	return started, nil
+}
+
+func (p *OrderProjection) project(ctx context.Context) (int, error) {
+	var ids []uint
+	err := p.db.WithContext(ctx).Unscoped().Model(&models.Order{}).
+		Where("event_sequence < (SELECT MAX(e.sequence) FROM order_events e WHERE e.order_id = orders.id)").
+		Order("id ASC").Limit(p.batchSize).Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	projected := 0
+	for _, id := range ids {
+		err := WithTx(ctx, p.db, func(tx *gorm.DB) error {
+			// locked so a write to the order waits for its projection
+			if err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Order{}, id).Error; err != nil {
+				return err
+			}
+			order, err := NewOrderProjection(tx).Rebuild(ctx, id)
+			if err != nil {
+				return err
+			}
+			return tx.Unscoped().Model(&models.Order{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+				"item":                  order.Item,
+				"amount":                order.Amount,
+				"tax_rate":              order.TaxRate,
+				"tax_inclusive":         order.TaxInclusive,
+				"net_amount":            order.NetAmount,
+				"tax_amount":            order.TaxAmount,
+				"gross_amount":          order.GrossAmount,
+				"time":                  order.Time,
+				"status":                order.Status,
+				"estimated_delivery_at": order.EstimatedDeliveryAt,
+				"customer_id":           order.CustomerID,
+				"product_id":            order.ProductID,
+				"quantity":              order.Quantity,
+				"priority":              order.Priority,
+				"sla_deadline":          order.SLADeadline,
+				"delivery_instructions": order.DeliveryInstructions,
+				"promo_code":            order.PromoCode,
+				"discount_amount":       order.DiscountAmount,
+				"event_sequence":        order.EventSequence,
+				"updated_at":            order.UpdatedAt,
+				"deleted_at":            order.DeletedAt,
+			}).Error
+		})
+		if err != nil {
+			return projected, fmt.Errorf("order %d: %w", id, err)
+		}
+		projected++
+	}
+	return projected, nil
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Order numbering schemes
+const (
+	// OrderNumberSequence numbers orders by their id, which costs nothing
+	// but skips the numbers of inserts that were rolled back
+	OrderNumberSequence = "sequence"
+	// OrderNumberGapless counts orders per prefix and year in a counter
+	// taken in the order's transaction, so no number is ever skipped, at the
+	// cost of placing orders one at a time
+	OrderNumberGapless = "gapless"
+)
+
+// orderNumberPrefix is what a prefix may be made of, so numbers are easy
+// to read out and type back in a text
+var orderNumberPrefix = regexp.MustCompile(`^[A-Z0-9]{1,10}$`)
+
+// OrderNumberPolicy sets how orders are numbered: the prefix, the year the
+// order was placed in and a zero padded count, e.g. ORD-2025-000123
+type OrderNumberPolicy struct {
+	Prefix string
+	Scheme string
+	// Digits is the count's width; larger counts are not cut
+	Digits int
+	// Location is the time zone whose year goes in the number
+	Location *time.Location
+}
+
+func DefaultOrderNumberPolicy() OrderNumberPolicy {
+	return OrderNumberPolicy{
+		Prefix: "ORD",
+		Scheme: OrderNumberSequence,
+		Digits: 6,
+	}
+}
+
+// OrderNumberPolicyFromEnv reads ORDER_NUMBER_PREFIX, ORDER_NUMBER_SCHEME
+// (sequence or gapless) and ORDER_NUMBER_DIGITS over the defaults
+func OrderNumberPolicyFromEnv() OrderNumberPolicy {
+	policy := DefaultOrderNumberPolicy()
+
+	if prefix := strings.ToUpper(strings.TrimSpace(os.Getenv("ORDER_NUMBER_PREFIX"))); orderNumberPrefix.MatchString(prefix) {
+		policy.Prefix = prefix
+	}
+	if scheme := strings.ToLower(strings.TrimSpace(os.Getenv("ORDER_NUMBER_SCHEME"))); scheme == OrderNumberSequence || scheme == OrderNumberGapless {
+		policy.Scheme = scheme
+	}
+	if n, err := strconv.Atoi(os.Getenv("ORDER_NUMBER_DIGITS")); err == nil && n > 0 && n <= 12 {
+		policy.Digits = n
+	}
+	return policy
+}
+
+// WithDefaults fills unset or invalid fields from DefaultOrderNumberPolicy
+func (p OrderNumberPolicy) WithDefaults() OrderNumberPolicy {
+	defaults := DefaultOrderNumberPolicy()
+	p.Prefix = strings.ToUpper(p.Prefix)
+	if !orderNumberPrefix.MatchString(p.Prefix) {
+		p.Prefix = defaults.Prefix
+	}
+	if p.Scheme != OrderNumberGapless {
+		p.Scheme = defaults.Scheme
+	}
+	if p.Digits <= 0 {
+		p.Digits = defaults.Digits
+	}
+	if p.Location == nil {
+		p.Location = time.UTC
+	}
+	return p
+}
+
+// Format returns the number of the nth order of year
+func (p OrderNumberPolicy) Format(year int, n int64) string {
+	return fmt.Sprintf("%s-%d-%0*d", p.Prefix, year, p.Digits, n)
+}
+
+// NormalizeOrderNumber reads a number as typed back by a person, in any
+// case and with spaces around it
+func NormalizeOrderNumber(number string) string {
+	return strings.ToUpper(strings.TrimSpace(number))
+}
+
+// CreateOrder inserts order with the next number, placed at now. Call it
+// in the transaction that places the order, so a gapless number is only
+// taken if the order is.
+func (p OrderNumberPolicy) CreateOrder(tx *gorm.DB, order *models.Order, now time.Time) error {
+	p = p.WithDefaults()
+	year := now.In(p.Location).Year()
+
+	if p.Scheme == OrderNumberSequence {
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+		number := p.Format(year, int64(order.ID))
+		if err := tx.Model(&models.Order{}).Where("id = ?", order.ID).UpdateColumn("number", number).Error; err != nil {
+			return fmt.Errorf("failed to number order %d: %w", order.ID, err)
+		}
+		order.Number = &number
+		return nil
+	}
+
+	n, err := nextOrderNumber(tx, fmt.Sprintf("%s-%d", p.Prefix, year))
+	if err != nil {
+		return fmt.Errorf("failed to take an order number: %w", err)
+	}
+	number := p.Format(year, n)
+	order.Number = &number
+	return tx.Create(order).Error
+}
+
+// nextOrderNumber moves the counter of scope on by one and returns it. The
+// update locks the counter's row until the transaction ends, which is what
+// keeps the numbers gapless.
+func nextOrderNumber(tx *gorm.DB, scope string) (int64, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.OrderNumberCounter{Scope: scope}).Error; err != nil {
+		return 0, err
+	}
+	err := tx.Model(&models.OrderNumberCounter{}).Where("scope = ?", scope).
+		Updates(map[string]interface{}{"value": gorm.Expr("value + 1"), "updated_at": time.Now()}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var counter models.OrderNumberCounter
+	if err := tx.Where("scope = ?", scope).First(&counter).Error; err != nil {
+		return 0, err
+	}
+	return counter.Value, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestOrderNumberPolicyFromEnv(t *testing.T) {
+	t.Setenv("ORDER_NUMBER_PREFIX", " sav ")
+	t.Setenv("ORDER_NUMBER_SCHEME", "Gapless")
+	t.Setenv("ORDER_NUMBER_DIGITS", "8")
+	assert.Equal(t, OrderNumberPolicy{Prefix: "SAV", Scheme: OrderNumberGapless, Digits: 8}, OrderNumberPolicyFromEnv())
+
+	t.Setenv("ORDER_NUMBER_PREFIX", "ORD 2025")
+	t.Setenv("ORDER_NUMBER_SCHEME", "random")
+	t.Setenv("ORDER_NUMBER_DIGITS", "0")
+	assert.Equal(t, DefaultOrderNumberPolicy(), OrderNumberPolicyFromEnv(), "invalid values keep the defaults")
+}
+
+func TestOrderNumberPolicyCreateOrder(t *testing.T) {
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	// 22:00 UTC on new year's eve is already 2026 in Nairobi
+	now := time.Date(2025, 12, 31, 22, 0, 0, 0, time.UTC)
+
+	create := func(t *testing.T, db *gorm.DB, policy OrderNumberPolicy, at time.Time) models.Order {
+		order := testutil.NewOrder(t).For(testutil.NewCustomer(t).Create(db)).Build()
+		require.NoError(t, db.Transaction(func(tx *gorm.DB) error {
+			return policy.CreateOrder(tx, &order, at)
+		}))
+		require.NotNil(t, order.Number)
+
+		var stored models.Order
+		require.NoError(t, db.First(&stored, order.ID).Error)
+		require.NotNil(t, stored.Number)
+		assert.Equal(t, *order.Number, *stored.Number)
+		return order
+	}
+
+	t.Run("sequence numbers by id", func(t *testing.T) {
+		db := testutil.DB(t)
+		policy := OrderNumberPolicy{Prefix: "ord", Location: nairobi}
+
+		first := create(t, db, policy, now)
+		assert.Equal(t, "ORD-2026-000001", *first.Number)
+		assert.Equal(t, "ORD-2026-000001", first.Reference())
+
+		second := create(t, db, policy, now.Add(-24*time.Hour))
+		assert.Equal(t, fmt.Sprintf("ORD-2025-%06d", second.ID), *second.Number)
+	})
+
+	t.Run("gapless counts per prefix and year", func(t *testing.T) {
+		db := testutil.DB(t)
+		policy := OrderNumberPolicy{Prefix: "SAV", Scheme: OrderNumberGapless, Digits: 4, Location: nairobi}
+
+		assert.Equal(t, "SAV-2026-0001", *create(t, db, policy, now).Number)
+
+		rolledBack := errors.New("rolled back")
+		order := testutil.NewOrder(t).For(testutil.NewCustomer(t).Create(db)).Build()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := policy.CreateOrder(tx, &order, now); err != nil {
+				return err
+			}
+			assert.Equal(t, "SAV-2026-0002", *order.Number)
+			return rolledBack
+		})
+		require.ErrorIs(t, err, rolledBack)
+
+		assert.Equal(t, "SAV-2026-0002", *create(t, db, policy, now).Number, "the rolled back number is given again")
+		assert.Equal(t, "SAV-2025-0001", *create(t, db, policy, now.Add(-24*time.Hour)).Number)
+
+		policy.Prefix = "WEB"
+		assert.Equal(t, "WEB-2026-0001", *create(t, db, policy, now).Number)
+	})
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"log"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"gorm.io/gorm"
+)
+
+// customerPIIRow is a customer's encrypted columns as stored, read without
+// the pii serializer
+type customerPIIRow struct {
+	ID        uint
+	Phone     string
+	PhoneHash string
+	Email     string
+	EmailHash *string
+}
+
+// BackfillCustomerPII rewrites customers whose phone or email is in plain
+// text or sealed with a retired key, whose plain text email is not
+// normalized, or whose blind indexes are missing, and returns how many were
+// updated. With all set every customer is rewritten, which is needed after
+// PII_HASH_KEY changes and to normalize emails encrypted before they were.
+func BackfillCustomerPII(ctx context.Context, db *gorm.DB, all bool) (int64, error) {
+	keyring := pii.Current()
+	db = db.WithContext(ctx)
+	query := db.Table("customers")
+
+	if !all {
+		needsWork := db.Where("phone_hash = '' OR phone_hash IS NULL OR (email <> '' AND email_hash IS NULL)").
+			Or("email NOT LIKE 'enc:v1:%' AND email <> LOWER(TRIM(email))")
+		if keyring != nil {
+			n := len(keyring.Prefix())
+			needsWork = needsWork.
+				Or("phone <> '' AND SUBSTR(phone, 1, ?) <> ?", n, keyring.Prefix()).
+				Or("email <> '' AND SUBSTR(email, 1, ?) <> ?", n, keyring.Prefix())
+		}
+		query = query.Where(needsWork)
+	}
+
+	var updated int64
+	var rows []customerPIIRow
+	err := query.FindInBatches(&rows, 500, func(_ *gorm.DB, batch int) error {
+		for _, row := range rows {
+			columns, err := rewriteCustomerPII(db, keyring, row)
+			if err != nil {
+				return err
+			}
+			if err := db.Table("customers").Where("id = ?", row.ID).UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+			updated++
+		}
+		return nil
+	}).Error
+
+	return updated, err
+}
+
+// rewriteCustomerPII decrypts a row with whichever key sealed it and returns
+// its columns sealed under the primary key, with the email normalized and
+// fresh blind indexes. An email that would clash with another customer's
+// once normalized is left as it is for someone to sort out.
+func rewriteCustomerPII(db *gorm.DB, keyring *pii.Keyring, row customerPIIRow) (map[string]interface{}, error) {
+	phone, err := keyring.Decrypt(row.Phone)
+	if err != nil {
+		return nil, err
+	}
+	email, err := keyring.Decrypt(row.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	if normalized := models.NormalizeEmail(email); normalized != email {
+		var clashes int64
+		if normalized != "" {
+			err := db.Table("customers").Where("email_hash = ? AND id <> ?", pii.BlindIndex(normalized), row.ID).Count(&clashes).Error
+			if err != nil {
+				return nil, err
+			}
+		}
+		if clashes > 0 {
+			log.Printf("customer %d email matches another customer's once normalized, leaving it as it is", row.ID)
+		} else {
+			email = normalized
+		}
+	}
+
+	phoneHash, emailHash := models.CustomerHashes(phone, email)
+	columns := map[string]interface{}{
+		"phone":      phone,
+		"phone_hash": phoneHash,
+		"email":      email,
+		"email_hash": emailHash,
+	}
+
+	if keyring != nil {
+		if columns["phone"], err = keyring.Encrypt(phone); err != nil {
+			return nil, err
+		}
+		if columns["email"], err = keyring.Encrypt(email); err != nil {
+			return nil, err
+		}
+	}
+	return columns, nil
+}
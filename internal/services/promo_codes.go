@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrPromoCodeNotFound = errors.New("promo code not found")
+	// ErrPromoCodeNotActive is returned for a code that is switched off, or
+	// used outside its validity window
+	ErrPromoCodeNotActive = errors.New("promo code is not active")
+	// ErrPromoCodeUsedUp is returned once a code has been used
+	// MaxRedemptions times
+	ErrPromoCodeUsedUp = errors.New("promo code has been used up")
+	// ErrPromoCodeAlreadyUsed is returned once a customer has used a code
+	// MaxPerCustomer times
+	ErrPromoCodeAlreadyUsed = errors.New("customer has already used this promo code")
+	ErrPromoCodeMinAmount   = errors.New("order amount is below the promo code's minimum")
+	// ErrInvalidPromoWindow is returned for a code that would end before it
+	// starts
+	ErrInvalidPromoWindow = errors.New("promo code ends before it starts")
+)
+
+// NormalizePromoCode returns code as it is stored, so customers can type it
+// in any case
+func NormalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// PromoDiscount returns what promo takes off amount, which is never more
+// than the amount itself
+func PromoDiscount(promo models.PromoCode, amount models.Money) models.Money {
+	discount := promo.AmountOff
+	if promo.Type == models.PromoCodePercentage {
+		discount = amount.Scale(promo.PercentOff / 100)
+	}
+	return min(discount, amount)
+}
+
+// PromoCodeService keeps the promo codes admins hand out, and applies them
+// to orders
+type PromoCodeService struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewPromoCodeService(db *gorm.DB) *PromoCodeService {
+	return &PromoCodeService{db: db, now: time.Now}
+}
+
+// WithClock replaces time.Now, for tests
+func (s *PromoCodeService) WithClock(now func() time.Time) *PromoCodeService {
+	s.now = now
+	return s
+}
+
+// Create adds an active promo code. A code that is taken, even by a deleted
+// code, is a unique violation.
+func (s *PromoCodeService) Create(ctx context.Context, promo *models.PromoCode) error {
+	promo.Code = NormalizePromoCode(promo.Code)
+	if !validPromoWindow(*promo) {
+		return ErrInvalidPromoWindow
+	}
+	promo.Active = true
+	if err := s.db.WithContext(ctx).Create(promo).Error; err != nil {
+		return fmt.Errorf("failed to create promo code: %w", err)
+	}
+	return nil
+}
+
+// PromoCodes returns every promo code, newest first
+func (s *PromoCodeService) PromoCodes(ctx context.Context) ([]models.PromoCode, error) {
+	var promos []models.PromoCode
+	err := s.db.WithContext(ctx).Order("id DESC").Find(&promos).Error
+	return promos, err
+}
+
+func (s *PromoCodeService) PromoCode(ctx context.Context, id uint) (models.PromoCode, error) {
+	var promo models.PromoCode
+	if err := s.db.WithContext(ctx).First(&promo, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return promo, ErrPromoCodeNotFound
+		}
+		return promo, err
+	}
+	return promo, nil
+}
+
+// Update changes the fields req sets. Lowering a limit below the uses a
+// code already has stops it being used again, without undoing those uses.
+func (s *PromoCodeService) Update(ctx context.Context, id uint, req models.UpdatePromoCodeRequest) (models.PromoCode, error) {
+	promo, err := s.PromoCode(ctx, id)
+	if err != nil {
+		return promo, err
+	}
+
+	columns := []string{}
+	if req.Description != nil {
+		promo.Description = strings.TrimSpace(*req.Description)
+		columns = append(columns, "description")
+	}
+	if req.MinAmount != nil {
+		promo.MinAmount = *req.MinAmount
+		columns = append(columns, "min_amount")
+	}
+	if req.StartsAt != nil {
+		promo.StartsAt = req.StartsAt
+		columns = append(columns, "starts_at")
+	}
+	if req.EndsAt != nil {
+		promo.EndsAt = req.EndsAt
+		columns = append(columns, "ends_at")
+	}
+	if req.MaxRedemptions != nil {
+		promo.MaxRedemptions = *req.MaxRedemptions
+		columns = append(columns, "max_redemptions")
+	}
+	if req.MaxPerCustomer != nil {
+		promo.MaxPerCustomer = *req.MaxPerCustomer
+		columns = append(columns, "max_per_customer")
+	}
+	if req.Active != nil {
+		promo.Active = *req.Active
+		columns = append(columns, "active")
+	}
+	if len(columns) == 0 {
+		return promo, nil
+	}
+	if !validPromoWindow(promo) {
+		return promo, ErrInvalidPromoWindow
+	}
+	err = s.db.WithContext(ctx).Model(&promo).Select(columns).Updates(&promo).Error
+	return promo, err
+}
+
+// Delete stops a code being used. Orders placed with it keep their
+// discount.
+func (s *PromoCodeService) Delete(ctx context.Context, id uint) (models.PromoCode, error) {
+	promo, err := s.PromoCode(ctx, id)
+	if err != nil {
+		return promo, err
+	}
+	return promo, s.db.WithContext(ctx).Delete(&promo).Error
+}
+
+// Apply takes code's discount off the order's amount in tx, which must go
+// on to create the order, and claims one of the code's uses. The returned
+// redemption is saved once the order has an id. Tax is left to the caller,
+// to be worked out on the discounted amount.
+func (s *PromoCodeService) Apply(tx *gorm.DB, code string, order *models.Order) (models.PromoRedemption, error) {
+	var promo models.PromoCode
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("code = ?", NormalizePromoCode(code)).First(&promo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.PromoRedemption{}, ErrPromoCodeNotFound
+	}
+	if err != nil {
+		return models.PromoRedemption{}, err
+	}
+
+	now := s.now()
+	if !promo.Active || (promo.StartsAt != nil && now.Before(*promo.StartsAt)) || (promo.EndsAt != nil && !now.Before(*promo.EndsAt)) {
+		return models.PromoRedemption{}, ErrPromoCodeNotActive
+	}
+	if order.Amount < promo.MinAmount {
+		return models.PromoRedemption{}, fmt.Errorf("%w of %s", ErrPromoCodeMinAmount, promo.MinAmount)
+	}
+	if promo.MaxPerCustomer > 0 {
+		var used int64
+		err := tx.Model(&models.PromoRedemption{}).
+			Where("promo_code_id = ? AND customer_id = ?", promo.ID, order.CustomerID).
+			Count(&used).Error
+		if err != nil {
+			return models.PromoRedemption{}, err
+		}
+		if used >= int64(promo.MaxPerCustomer) {
+			return models.PromoRedemption{}, ErrPromoCodeAlreadyUsed
+		}
+	}
+
+	// claimed with a guarded increment, so two orders can't both take the
+	// last use
+	claimed := tx.Model(&models.PromoCode{}).
+		Where("id = ? AND (max_redemptions = 0 OR redemptions < max_redemptions)", promo.ID).
+		UpdateColumn("redemptions", gorm.Expr("redemptions + 1"))
+	if claimed.Error != nil {
+		return models.PromoRedemption{}, claimed.Error
+	}
+	if claimed.RowsAffected == 0 {
+		return models.PromoRedemption{}, ErrPromoCodeUsedUp
+	}
+
+	discount := PromoDiscount(promo, order.Amount)
+	order.Amount -= discount
+	order.DiscountAmount = discount
+	order.PromoCode = &promo.Code
+	return models.PromoRedemption{PromoCodeID: promo.ID, CustomerID: order.CustomerID, Discount: discount}, nil
+}
+
+func validPromoWindow(promo models.PromoCode) bool {
+	return promo.StartsAt == nil || promo.EndsAt == nil || promo.EndsAt.After(*promo.StartsAt)
+}
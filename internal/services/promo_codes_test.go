@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestPromoDiscount(t *testing.T) {
+	percent := models.PromoCode{Type: models.PromoCodePercentage, PercentOff: 12.5}
+	assert.Equal(t, models.Shillings(125), PromoDiscount(percent, models.Shillings(1000)))
+	assert.Equal(t, models.Shillings(0.13), PromoDiscount(percent, models.Shillings(1)), "rounded to the cent")
+
+	fixed := models.PromoCode{Type: models.PromoCodeFixed, AmountOff: models.Shillings(500)}
+	assert.Equal(t, models.Shillings(500), PromoDiscount(fixed, models.Shillings(1200)))
+	assert.Equal(t, models.Shillings(300), PromoDiscount(fixed, models.Shillings(300)), "never more than the amount")
+}
+
+func TestPromoCodeService(t *testing.T) {
+	db := testutil.DB(t)
+	ctx := context.Background()
+
+	now := time.Date(2026, 12, 1, 9, 0, 0, 0, time.UTC)
+	service := NewPromoCodeService(db).WithClock(func() time.Time { return now })
+	sebbie := testutil.NewCustomer(t).Create(db)
+	amina := testutil.NewCustomer(t).Create(db)
+
+	starts, ends := now.Add(24*time.Hour), now.Add(31*24*time.Hour)
+	december := models.PromoCode{Code: " dec-2026 ", Type: models.PromoCodePercentage, PercentOff: 10, MinAmount: models.Shillings(1000), StartsAt: &starts, EndsAt: &ends, MaxRedemptions: 2, MaxPerCustomer: 1}
+	require.NoError(t, service.Create(ctx, &december))
+	assert.Equal(t, "DEC-2026", december.Code)
+	assert.True(t, december.Active)
+
+	inverted := models.PromoCode{Code: "BACKWARDS", Type: models.PromoCodeFixed, AmountOff: 100, StartsAt: &ends, EndsAt: &starts}
+	assert.ErrorIs(t, service.Create(ctx, &inverted), ErrInvalidPromoWindow)
+
+	// place applies the code and saves the order, as placing an order does
+	place := func(customer models.Customer, code string, amount models.Money) (models.Order, error) {
+		order := testutil.NewOrder(t).For(customer).WithAmount(amount).Build()
+		err := db.Transaction(func(tx *gorm.DB) error {
+			redemption, err := service.Apply(tx, code, &order)
+			if err != nil {
+				return err
+			}
+			if err := tx.Create(&order).Error; err != nil {
+				return err
+			}
+			redemption.OrderID = order.ID
+			return tx.Create(&redemption).Error
+		})
+		return order, err
+	}
+
+	_, err := place(sebbie, "NOPE", models.Shillings(2000))
+	assert.ErrorIs(t, err, ErrPromoCodeNotFound)
+	_, err = place(sebbie, "dec-2026", models.Shillings(2000))
+	assert.ErrorIs(t, err, ErrPromoCodeNotActive, "before it starts")
+
+	now = starts
+	_, err = place(sebbie, "dec-2026", models.Shillings(999))
+	assert.ErrorIs(t, err, ErrPromoCodeMinAmount)
+	assert.EqualError(t, err, "order amount is below the promo code's minimum of 1000.00")
+
+	order, err := place(sebbie, "dec-2026", models.Shillings(2000))
+	require.NoError(t, err)
+	assert.Equal(t, models.Shillings(1800), order.Amount)
+	assert.Equal(t, models.Shillings(200), order.DiscountAmount)
+	assert.Equal(t, "DEC-2026", *order.PromoCode)
+
+	_, err = place(sebbie, "DEC-2026", models.Shillings(2000))
+	assert.ErrorIs(t, err, ErrPromoCodeAlreadyUsed)
+
+	_, err = place(amina, "DEC-2026", models.Shillings(1000))
+	require.NoError(t, err)
+	_, err = place(testutil.NewCustomer(t).Create(db), "DEC-2026", models.Shillings(1000))
+	assert.ErrorIs(t, err, ErrPromoCodeUsedUp)
+
+	december, err = service.PromoCode(ctx, december.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, december.Redemptions, "failed orders don't use the code")
+	var redemptions []models.PromoRedemption
+	require.NoError(t, db.Order("id").Find(&redemptions).Error)
+	require.Len(t, redemptions, 2)
+	assert.Equal(t, models.PromoRedemption{ID: redemptions[0].ID, PromoCodeID: december.ID, CustomerID: sebbie.ID, OrderID: order.ID, Discount: models.Shillings(200), CreatedAt: redemptions[0].CreatedAt}, redemptions[0])
+
+	t.Run("update", func(t *testing.T) {
+		more, off := 0, false
+		updated, err := service.Update(ctx, december.ID, models.UpdatePromoCodeRequest{MaxRedemptions: &more})
+		require.NoError(t, err)
+		assert.Zero(t, updated.MaxRedemptions)
+		_, err = place(testutil.NewCustomer(t).Create(db), "DEC-2026", models.Shillings(1000))
+		require.NoError(t, err, "no limit")
+
+		updated, err = service.Update(ctx, december.ID, models.UpdatePromoCodeRequest{Active: &off})
+		require.NoError(t, err)
+		assert.False(t, updated.Active)
+		_, err = place(testutil.NewCustomer(t).Create(db), "DEC-2026", models.Shillings(1000))
+		assert.ErrorIs(t, err, ErrPromoCodeNotActive)
+
+		early := starts.Add(-time.Hour)
+		_, err = service.Update(ctx, december.ID, models.UpdatePromoCodeRequest{EndsAt: &early})
+		assert.ErrorIs(t, err, ErrInvalidPromoWindow)
+		_, err = service.Update(ctx, 999, models.UpdatePromoCodeRequest{Active: &off})
+		assert.ErrorIs(t, err, ErrPromoCodeNotFound)
+	})
+
+	t.Run("ended", func(t *testing.T) {
+		flash := models.PromoCode{Code: "FLASH", Type: models.PromoCodeFixed, AmountOff: models.Shillings(50), EndsAt: &ends}
+		require.NoError(t, service.Create(ctx, &flash))
+		now = ends
+		_, err := place(sebbie, "FLASH", models.Shillings(100))
+		assert.ErrorIs(t, err, ErrPromoCodeNotActive)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		deleted, err := service.Delete(ctx, december.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "DEC-2026", deleted.Code)
+		_, err = service.PromoCode(ctx, december.ID)
+		assert.ErrorIs(t, err, ErrPromoCodeNotFound)
+		_, err = place(sebbie, "DEC-2026", models.Shillings(1000))
+		assert.ErrorIs(t, err, ErrPromoCodeNotFound)
+
+		again := models.PromoCode{Code: "dec-2026", Type: models.PromoCodeFixed, AmountOff: 100}
+		assert.Error(t, service.Create(ctx, &again), "a deleted code's name stays taken")
+	})
+
+	promos, err := service.PromoCodes(ctx)
+	require.NoError(t, err)
+	require.Len(t, promos, 1)
+	assert.Equal(t, "FLASH", promos[0].Code)
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// PushPolicy sets when a push is given up on in favour of SMS
+type PushPolicy struct {
+	// FallbackAfter is how long a push may go unacknowledged before it is
+	// texted to the customer instead
+	FallbackAfter time.Duration
+}
+
+func DefaultPushPolicy() PushPolicy {
+	return PushPolicy{FallbackAfter: 10 * time.Minute}
+}
+
+// PushPolicyFromEnv reads PUSH_FALLBACK_AFTER over the defaults
+func PushPolicyFromEnv() PushPolicy {
+	policy := DefaultPushPolicy()
+	if d, err := time.ParseDuration(os.Getenv("PUSH_FALLBACK_AFTER")); err == nil && d > 0 {
+		policy.FallbackAfter = d
+	}
+	return policy
+}
+
+// WithDefaults fills unset fields from DefaultPushPolicy
+func (p PushPolicy) WithDefaults() PushPolicy {
+	if p.FallbackAfter <= 0 {
+		p.FallbackAfter = DefaultPushPolicy().FallbackAfter
+	}
+	return p
+}
+
+// PushNotifier pushes notifications to the customer's devices first, since
+// pushes cost nothing, and texts them when the customer has no device, no
+// push could be sent, or no device acknowledged it within FallbackAfter
+type PushNotifier struct {
+	db     *gorm.DB
+	push   PushSender
+	sms    SMSServiceInterface
+	policy PushPolicy
+	now    func() time.Time
+}
+
+func NewPushNotifier(db *gorm.DB, push PushSender, sms SMSServiceInterface, policy PushPolicy) *PushNotifier {
+	return &PushNotifier{
+		db:     db,
+		push:   push,
+		sms:    sms,
+		policy: policy.WithDefaults(),
+		now:    time.Now,
+	}
+}
+
+func (n *PushNotifier) Notify(ctx context.Context, notification Notification) error {
+	db := n.db.WithContext(ctx)
+
+	var devices []models.DeviceToken
+	if err := db.Where("customer_id = ?", notification.CustomerID).Find(&devices).Error; err != nil {
+		return fmt.Errorf("failed to find devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return n.sms.SendSMS(ctx, notification.Phone, notification.Message)
+	}
+
+	push := models.PushNotification{
+		CustomerID: notification.CustomerID,
+		OrderID:    notification.OrderID,
+		Title:      notification.Title,
+		Body:       notification.Message,
+		Status:     models.PushStatusPending,
+		SentAt:     n.now(),
+	}
+	if err := db.Create(&push).Error; err != nil {
+		return fmt.Errorf("failed to record push: %w", err)
+	}
+
+	message := PushMessage{
+		Title: notification.Title,
+		Body:  notification.Message,
+		Data:  map[string]string{"notification_id": strconv.FormatUint(uint64(push.ID), 10)},
+	}
+	var lastErr error
+	sent := 0
+	for _, device := range devices {
+		err := n.push.Send(ctx, device.Token, message)
+		switch {
+		case errors.Is(err, ErrPushTokenInvalid):
+			log.Printf("forgetting device %d of customer %d: %v", device.ID, device.CustomerID, err)
+			if err := db.Delete(&device).Error; err != nil {
+				log.Printf("failed to forget device %d: %v", device.ID, err)
+			}
+			lastErr = err
+		case err != nil:
+			log.Printf("failed to push notification %d to device %d: %v", push.ID, device.ID, err)
+			lastErr = err
+		default:
+			sent++
+		}
+	}
+	if sent > 0 {
+		return nil
+	}
+
+	// nothing was pushed, so there is no point waiting for an acknowledgement
+	return n.fallBack(ctx, push, notification.Phone, lastErr)
+}
+
+// FallBack texts the customers of pushes no device acknowledged within
+// FallbackAfter, and reports how many were texted
+func (n *PushNotifier) FallBack(ctx context.Context) (int, error) {
+	db := n.db.WithContext(ctx)
+
+	var pending []models.PushNotification
+	err := db.Where("status = ? AND sent_at <= ?", models.PushStatusPending, n.now().Add(-n.policy.FallbackAfter)).
+		Order("id ASC").Find(&pending).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find unacknowledged pushes: %w", err)
+	}
+
+	texted := 0
+	for _, push := range pending {
+		var customer models.Customer
+		if err := db.First(&customer, push.CustomerID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				n.finish(ctx, push, models.PushStatusFailed, "customer not found")
+				continue
+			}
+			return texted, fmt.Errorf("failed to find customer of push %d: %w", push.ID, err)
+		}
+
+		if err := n.fallBack(ctx, push, customer.Phone, errors.New("not acknowledged in time")); err != nil {
+			log.Printf("failed to text push %d to customer %d: %v", push.ID, push.CustomerID, err)
+			continue
+		}
+		texted++
+	}
+	return texted, nil
+}
+
+// fallBack texts the push to phone. A push acknowledged meanwhile is left
+// alone.
+func (n *PushNotifier) fallBack(ctx context.Context, push models.PushNotification, phone string, reason error) error {
+	claimed, err := n.claim(ctx, push)
+	if err != nil || !claimed {
+		return err
+	}
+
+	if err := n.sms.SendSMS(ctx, phone, push.Body); err != nil {
+		n.finish(ctx, push, models.PushStatusFailed, err.Error())
+		return err
+	}
+
+	message := ""
+	if reason != nil {
+		message = reason.Error()
+	}
+	n.finish(ctx, push, models.PushStatusFellBack, message)
+	return nil
+}
+
+// claim moves a pending push to fell_back before it is texted, so a late
+// acknowledgement or another worker cannot act on it too
+func (n *PushNotifier) claim(ctx context.Context, push models.PushNotification) (bool, error) {
+	result := n.db.WithContext(ctx).Model(&models.PushNotification{}).
+		Where("id = ? AND status = ?", push.ID, models.PushStatusPending).
+		Updates(map[string]interface{}{"status": models.PushStatusFellBack, "fell_back_at": n.now()})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim push %d: %w", push.ID, result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (n *PushNotifier) finish(ctx context.Context, push models.PushNotification, status, message string) {
+	err := n.db.WithContext(ctx).Model(&models.PushNotification{}).Where("id = ?", push.ID).
+		Updates(map[string]interface{}{"status": status, "error": message}).Error
+	if err != nil {
+		log.Printf("failed to update push %d: %v", push.ID, err)
+	}
+}
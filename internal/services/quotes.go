@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// DefaultQuoteHold is how long a quote holds its stock and price unless
+// configured otherwise
+const DefaultQuoteHold = 15 * time.Minute
+
+// ReleaseQuote ends a held quote with status, cancelled or expired, and
+// puts its stock back. It reports false, changing nothing, when the quote
+// is no longer held.
+func ReleaseQuote(tx *gorm.DB, quote models.Quote, status string) (bool, error) {
+	res := tx.Model(&models.Quote{}).
+		Where("id = ? AND status = ?", quote.ID, models.QuoteStatusHeld).
+		Update("status", status)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+
+	if quote.ProductID != nil {
+		err := tx.Model(&models.Product{}).Where("id = ?", *quote.ProductID).
+			Update("stock_quantity", gorm.Expr("stock_quantity + ?", quote.Quantity)).Error
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ExpireQuotes releases the held quotes that have expired, returning their
+// stock, and returns how many it expired
+func ExpireQuotes(ctx context.Context, db *gorm.DB) (int, error) {
+	var quotes []models.Quote
+	err := db.WithContext(ctx).
+		Where("status = ? AND expires_at <= ?", models.QuoteStatusHeld, time.Now()).
+		Find(&quotes).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find expired quotes: %w", err)
+	}
+
+	expired := 0
+	for _, quote := range quotes {
+		err := WithTx(ctx, db, func(tx *gorm.DB) error {
+			released, err := ReleaseQuote(tx, quote, models.QuoteStatusExpired)
+			if released {
+				expired++
+			}
+			return err
+		})
+		if err != nil {
+			return expired, fmt.Errorf("failed to expire quote %d: %w", quote.ID, err)
+		}
+	}
+	return expired, nil
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DayLayout = "2006-01-02"
+
+const (
+	ReportDaily   = "daily"
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
+
+// What OrderTotals can group orders by
+const (
+	TotalsByCustomer = "customer"
+	TotalsByDay      = "day"
+	TotalsByItem     = "item"
+)
+
+// ErrInvalidGrouping is returned for a group_by OrderTotals does not know
+var ErrInvalidGrouping = errors.New("group_by must be customer, day or item")
+
+// ReportService maintains the daily_order_stats table and builds report
+// series from it, so reports never scan the raw orders table.
+type ReportService struct {
+	db       *gorm.DB
+	location *time.Location
+}
+
+func NewReportService(db *gorm.DB, location *time.Location) *ReportService {
+	if location == nil {
+		location = time.UTC
+	}
+	return &ReportService{
+		db:       db,
+		location: location,
+	}
+}
+
+// Location is the timezone day boundaries are computed in
+func (s *ReportService) Location() *time.Location {
+	return s.location
+}
+
+// RefreshDailyStats recomputes the aggregates for every day from..to inclusive
+func (s *ReportService) RefreshDailyStats(ctx context.Context, from, to time.Time) error {
+	db := s.db.WithContext(ctx)
+
+	for day := s.startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		stat := models.DailyOrderStat{Day: day.Format(DayLayout)}
+
+		var orders struct {
+			Count   int64
+			Revenue models.Money
+		}
+		err := db.Model(&models.Order{}).
+			Select("COUNT(*) AS count, COALESCE(SUM(amount), 0) AS revenue").
+			Where("time >= ? AND time < ? AND status <> ?", day, next, models.OrderStatusCancelled).
+			Scan(&orders).Error
+		if err != nil {
+			return fmt.Errorf("failed to aggregate orders for %s: %w", stat.Day, err)
+		}
+		stat.OrdersCount = orders.Count
+		stat.Revenue = orders.Revenue
+
+		err = db.Model(&models.Customer{}).
+			Where("created_at >= ? AND created_at < ?", day, next).
+			Count(&stat.NewCustomers).Error
+		if err != nil {
+			return fmt.Errorf("failed to count new customers for %s: %w", stat.Day, err)
+		}
+
+		err = db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "day"}},
+			DoUpdates: clause.AssignmentColumns([]string{"orders_count", "revenue", "new_customers", "updated_at"}),
+		}).Create(&stat).Error
+		if err != nil {
+			return fmt.Errorf("failed to store stats for %s: %w", stat.Day, err)
+		}
+	}
+
+	return nil
+}
+
+// Series returns report points for from..to inclusive, rolled up by period
+func (s *ReportService) Series(ctx context.Context, period string, from, to time.Time) ([]models.ReportPoint, error) {
+	var stats []models.DailyOrderStat
+	err := s.db.WithContext(ctx).
+		Where("day >= ? AND day <= ?", from.Format(DayLayout), to.Format(DayLayout)).
+		Order("day ASC").
+		Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]models.ReportPoint, 0, len(stats))
+	index := make(map[string]int)
+
+	for _, stat := range stats {
+		day, err := time.ParseInLocation(DayLayout, stat.Day, s.location)
+		if err != nil {
+			return nil, err
+		}
+
+		key := periodStart(period, day).Format(DayLayout)
+		i, ok := index[key]
+		if !ok {
+			i = len(points)
+			index[key] = i
+			points = append(points, models.ReportPoint{PeriodStart: key})
+		}
+
+		points[i].OrdersCount += stat.OrdersCount
+		points[i].Revenue += stat.Revenue
+		points[i].NewCustomers += stat.NewCustomers
+	}
+
+	return points, nil
+}
+
+// VATSummary totals net, VAT and gross amounts per month for the months
+// from..to fall in, over live and archived orders. Cancelled orders are
+// left out. Months are computed in the report timezone.
+func (s *ReportService) VATSummary(ctx context.Context, from, to time.Time) ([]models.VATReportPoint, error) {
+	db := s.db.WithContext(ctx)
+
+	first := periodStart(ReportMonthly, s.startOfDay(from))
+	last := periodStart(ReportMonthly, s.startOfDay(to))
+
+	var points []models.VATReportPoint
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		point := models.VATReportPoint{Month: month.Format("2006-01")}
+		next := month.AddDate(0, 1, 0)
+
+		for _, model := range []interface{}{&models.Order{}, &models.ArchivedOrder{}} {
+			var totals struct {
+				Count int64
+				Net   models.Money
+				Tax   models.Money
+				Gross models.Money
+			}
+			err := db.Model(model).
+				Select("COUNT(*) AS count, COALESCE(SUM(net_amount), 0) AS net, COALESCE(SUM(tax_amount), 0) AS tax, COALESCE(SUM(gross_amount), 0) AS gross").
+				Where("time >= ? AND time < ? AND status <> ?", month, next, models.OrderStatusCancelled).
+				Scan(&totals).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to total vat for %s: %w", point.Month, err)
+			}
+
+			point.OrdersCount += totals.Count
+			point.NetAmount += totals.Net
+			point.TaxAmount += totals.Tax
+			point.GrossAmount += totals.Gross
+		}
+
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// OrderHeatmap counts the orders placed on the days from..to inclusive by
+// weekday and hour in the report timezone, over live and archived orders
+// and leaving out cancelled ones. It returns all 168 cells, Monday 00:00
+// first.
+func (s *ReportService) OrderHeatmap(ctx context.Context, from, to time.Time) ([]models.HeatmapCell, error) {
+	db := s.db.WithContext(ctx)
+	start := s.startOfDay(from)
+	end := s.startOfDay(to).AddDate(0, 0, 1)
+	weekday, hour := s.localParts(db, "time", start)
+
+	var counts [7][24]int64
+	for _, model := range []interface{}{&models.Order{}, &models.ArchivedOrder{}} {
+		var buckets []struct {
+			Weekday int
+			Hour    int
+			Count   int64
+		}
+		err := db.Model(model).
+			Select(fmt.Sprintf("%s AS weekday, %s AS hour, COUNT(*) AS count", weekday, hour)).
+			Where("time >= ? AND time < ? AND status <> ?", start, end, models.OrderStatusCancelled).
+			Group("weekday, hour").
+			Scan(&buckets).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to bucket orders: %w", err)
+		}
+
+		for _, bucket := range buckets {
+			if bucket.Weekday >= 0 && bucket.Weekday < 7 && bucket.Hour >= 0 && bucket.Hour < 24 {
+				counts[bucket.Weekday][bucket.Hour] += bucket.Count
+			}
+		}
+	}
+
+	cells := make([]models.HeatmapCell, 0, 7*24)
+	for i := range 7 {
+		day := (i + 1) % 7 // Monday first
+		for hour := range 24 {
+			cells = append(cells, models.HeatmapCell{
+				Weekday:     strings.ToLower(time.Weekday(day).String()),
+				Hour:        hour,
+				OrdersCount: counts[day][hour],
+			})
+		}
+	}
+	return cells, nil
+}
+
+// OrderTotals counts and sums the live orders matched by filters per
+// customer, item or day (in the report timezone), and returns one page of
+// groups along with how many there are in all. Days come in order; customers
+// and items largest total first.
+func (s *ReportService) OrderTotals(ctx context.Context, groupBy string, page scopes.Page, filters ...func(*gorm.DB) *gorm.DB) ([]models.OrderTotal, int64, error) {
+	db := s.db.WithContext(ctx)
+
+	var column, order string
+	switch groupBy {
+	case TotalsByCustomer:
+		column, order = "customer_id", "total_amount DESC, group_key ASC"
+	case TotalsByItem:
+		column, order = "item", "total_amount DESC, group_key ASC"
+	case TotalsByDay:
+		column, order = s.localDay(db, "time", time.Now()), "group_key ASC"
+	default:
+		return nil, 0, ErrInvalidGrouping
+	}
+
+	groups := db.Model(&models.Order{}).Scopes(filters...).
+		Select(column + " AS group_key").
+		Group("group_key")
+
+	var total int64
+	if err := db.Table("(?) AS order_groups", groups).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count groups: %w", err)
+	}
+
+	totals := []models.OrderTotal{}
+	err := db.Model(&models.Order{}).Scopes(filters...).
+		Select(column + " AS group_key, COUNT(*) AS orders_count, COALESCE(SUM(amount), 0) AS total_amount").
+		Group("group_key").
+		Order(order).
+		Scopes(scopes.Paginate(page)).
+		Scan(&totals).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to total orders: %w", err)
+	}
+	return totals, total, nil
+}
+
+// localDay returns SQL for the YYYY-MM-DD day of column in the report
+// timezone, converting like localParts
+func (s *ReportService) localDay(db *gorm.DB, column string, at time.Time) string {
+	_, offset := at.In(s.location).Zone()
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("TO_CHAR(%s AT TIME ZONE '%s', 'YYYY-MM-DD')", column, strings.ReplaceAll(s.location.String(), "'", "''"))
+	case "mysql":
+		return fmt.Sprintf("DATE_FORMAT(DATE_ADD(%s, INTERVAL %d SECOND), '%%Y-%%m-%%d')", column, offset)
+	default:
+		return fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, '%+d seconds')", column, offset)
+	}
+}
+
+// localParts returns SQL for the weekday (0 is Sunday) and hour of column
+// in the report timezone. Postgres converts with the zone itself; SQLite
+// and MySQL cannot without timezone tables, so they shift by the zone's
+// offset at the start of the range, which is exact for zones without
+// daylight saving such as Africa/Nairobi.
+func (s *ReportService) localParts(db *gorm.DB, column string, at time.Time) (string, string) {
+	_, offset := at.Zone()
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		local := fmt.Sprintf("(%s AT TIME ZONE '%s')", column, strings.ReplaceAll(s.location.String(), "'", "''"))
+		return fmt.Sprintf("CAST(EXTRACT(DOW FROM %s) AS INTEGER)", local), fmt.Sprintf("CAST(EXTRACT(HOUR FROM %s) AS INTEGER)", local)
+	case "mysql":
+		local := fmt.Sprintf("DATE_ADD(%s, INTERVAL %d SECOND)", column, offset)
+		return fmt.Sprintf("(DAYOFWEEK(%s) - 1)", local), fmt.Sprintf("HOUR(%s)", local)
+	default:
+		shift := fmt.Sprintf("'%+d seconds'", offset)
+		return fmt.Sprintf("CAST(strftime('%%w', %s, %s) AS INTEGER)", column, shift), fmt.Sprintf("CAST(strftime('%%H', %s, %s) AS INTEGER)", column, shift)
+	}
+}
+
+func (s *ReportService) startOfDay(t time.Time) time.Time {
+	t = t.In(s.location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location)
+}
+
+// periodStart truncates a day to the start of its week (Monday) or month
+func periodStart(period string, day time.Time) time.Time {
+	switch period {
+	case ReportWeekly:
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case ReportMonthly:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+	default:
+		return day
+	}
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Order creation saga steps
+const (
+	SagaStepCreateOrder    = "create_order"
+	SagaStepNotifyCustomer = "notify_customer"
+	SagaStepLowStockAlert  = "low_stock_alert"
+)
+
+var (
+	ErrSagaNotFound = errors.New("saga not found")
+	// ErrSagaNotCompensable is returned for sagas that are still running or
+	// have already been undone
+	ErrSagaNotCompensable = errors.New("saga cannot be compensated")
+)
+
+// errStepInterrupted is recorded on steps left pending by a process that
+// stopped mid-saga
+var errStepInterrupted = errors.New("interrupted before completion")
+
+// SagaAction is a step run by the coordinator
+type SagaAction struct {
+	Name string
+	// Critical steps must succeed: when one fails every completed step is
+	// compensated. Any other failure only compensates the failed step.
+	Critical bool
+	// Run is nil for a step that completed before the saga started, such as
+	// the order insert, which is recorded so it can be compensated
+	Run func(ctx context.Context) error
+}
+
+// Compensation undoes a completed step, or records the failure of a step
+// that cannot simply be retried. Compensations only touch the database so
+// they can run after a restart, from the recovery job or an admin request.
+type Compensation func(db *gorm.DB, saga models.Saga, step models.SagaStep) error
+
+// SagaCoordinator runs sagas, persisting every step so that failures after
+// the database commit are compensated and can be inspected
+type SagaCoordinator struct {
+	db *gorm.DB
+	// undo compensates completed steps when the saga is rolled back
+	undo map[string]Compensation
+	// onFailure compensates a failed non-critical step
+	onFailure map[string]Compensation
+	now       func() time.Time
+}
+
+func NewSagaCoordinator(db *gorm.DB) *SagaCoordinator {
+	return &SagaCoordinator{
+		db: db,
+		undo: map[string]Compensation{
+			SagaStepCreateOrder: cancelCreatedOrder,
+		},
+		onFailure: map[string]Compensation{
+			SagaStepNotifyCustomer: recordFailedConfirmation,
+		},
+		now: time.Now,
+	}
+}
+
+// Run records a saga for the order and runs its actions in order, returning
+// the saga and the error of the first failed step
+func (s *SagaCoordinator) Run(ctx context.Context, kind string, orderID uint, actions []SagaAction) (models.Saga, error) {
+	db := s.db.WithContext(ctx)
+
+	saga := models.Saga{Kind: kind, OrderID: orderID, Status: models.SagaStatusRunning}
+	for i, action := range actions {
+		status := models.SagaStepPending
+		if action.Run == nil {
+			status = models.SagaStepDone
+		}
+		saga.Steps = append(saga.Steps, models.SagaStep{
+			Position: i,
+			Name:     action.Name,
+			Critical: action.Critical,
+			Status:   status,
+		})
+	}
+	if err := db.Create(&saga).Error; err != nil {
+		return saga, fmt.Errorf("failed to record saga: %w", err)
+	}
+
+	var firstErr error
+	for i, action := range actions {
+		if action.Run == nil {
+			continue
+		}
+
+		if err := action.Run(ctx); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			if action.Critical {
+				s.setStep(db, &saga, i, models.SagaStepFailed, err.Error())
+				s.compensateAll(db, &saga)
+				break
+			}
+			s.failStep(db, &saga, i, err)
+			continue
+		}
+		s.setStep(db, &saga, i, models.SagaStepDone, "")
+	}
+
+	s.finish(db, &saga)
+	return saga, firstErr
+}
+
+// Get returns a saga with its steps
+func (s *SagaCoordinator) Get(ctx context.Context, id uint) (models.Saga, error) {
+	var saga models.Saga
+	err := s.db.WithContext(ctx).Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).First(&saga, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return saga, ErrSagaNotFound
+	}
+	return saga, err
+}
+
+// Compensate undoes a finished saga by compensating its completed steps in
+// reverse. For order creation this cancels the order and restocks it.
+// Compensations that failed before are retried.
+func (s *SagaCoordinator) Compensate(ctx context.Context, id uint) (models.Saga, error) {
+	db := s.db.WithContext(ctx)
+
+	saga, err := s.Get(ctx, id)
+	if err != nil {
+		return saga, err
+	}
+	if saga.Status == models.SagaStatusRunning || saga.Status == models.SagaStatusCompensated {
+		return saga, ErrSagaNotCompensable
+	}
+
+	s.compensateAll(db, &saga)
+	s.finish(db, &saga)
+	return saga, nil
+}
+
+// Recover finishes sagas that have been running for longer than staleAfter,
+// left behind by a process that stopped mid-saga. Their pending steps are
+// treated as failed and compensated. It returns how many were recovered.
+func (s *SagaCoordinator) Recover(ctx context.Context, staleAfter time.Duration) (int, error) {
+	db := s.db.WithContext(ctx)
+
+	var ids []uint
+	err := db.Model(&models.Saga{}).
+		Where("status = ? AND updated_at < ?", models.SagaStatusRunning, s.now().Add(-staleAfter)).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		saga, err := s.Get(ctx, id)
+		if err != nil {
+			return 0, err
+		}
+
+		for i, step := range saga.Steps {
+			if step.Status != models.SagaStepPending {
+				continue
+			}
+			if step.Critical {
+				s.setStep(db, &saga, i, models.SagaStepFailed, errStepInterrupted.Error())
+				s.compensateAll(db, &saga)
+				break
+			}
+			s.failStep(db, &saga, i, errStepInterrupted)
+		}
+		s.finish(db, &saga)
+	}
+	return len(ids), nil
+}
+
+// failStep records a non-critical failure and compensates that step alone
+func (s *SagaCoordinator) failStep(db *gorm.DB, saga *models.Saga, i int, stepErr error) {
+	s.setStep(db, saga, i, models.SagaStepFailed, stepErr.Error())
+
+	compensate, ok := s.onFailure[saga.Steps[i].Name]
+	if !ok {
+		return
+	}
+	if err := compensate(db, *saga, saga.Steps[i]); err != nil {
+		s.setStep(db, saga, i, models.SagaStepCompensationFailed, fmt.Sprintf("%s; compensation: %v", stepErr, err))
+		return
+	}
+	s.setStep(db, saga, i, models.SagaStepCompensated, stepErr.Error())
+}
+
+// compensateAll compensates completed steps, latest first. Steps with no
+// compensation, such as a sent SMS, are left as they are.
+func (s *SagaCoordinator) compensateAll(db *gorm.DB, saga *models.Saga) {
+	for i := len(saga.Steps) - 1; i >= 0; i-- {
+		step := saga.Steps[i]
+		if step.Status != models.SagaStepDone && step.Status != models.SagaStepCompensationFailed {
+			continue
+		}
+		compensate, ok := s.undo[step.Name]
+		if !ok {
+			continue
+		}
+
+		if err := compensate(db, *saga, step); err != nil {
+			s.setStep(db, saga, i, models.SagaStepCompensationFailed, err.Error())
+			continue
+		}
+		s.setStep(db, saga, i, models.SagaStepCompensated, "")
+	}
+}
+
+// finish sets the saga's final status from its steps: compensated once a
+// critical step failed or was undone, partially failed when only other
+// steps did, and failed when any compensation did
+func (s *SagaCoordinator) finish(db *gorm.DB, saga *models.Saga) {
+	var undone, partial, stuck bool
+	for _, step := range saga.Steps {
+		switch step.Status {
+		case models.SagaStepCompensationFailed:
+			stuck = true
+		case models.SagaStepFailed, models.SagaStepCompensated:
+			if step.Critical {
+				undone = true
+			} else {
+				partial = true
+			}
+		}
+	}
+
+	status := models.SagaStatusCompleted
+	switch {
+	case stuck:
+		status = models.SagaStatusFailed
+	case undone:
+		status = models.SagaStatusCompensated
+	case partial:
+		status = models.SagaStatusPartiallyFailed
+	}
+
+	saga.Status = status
+	saga.UpdatedAt = s.now()
+	db.Model(&models.Saga{}).Where("id = ?", saga.ID).
+		UpdateColumns(map[string]interface{}{"status": status, "updated_at": saga.UpdatedAt})
+}
+
+// setStep persists a step's status and marks the saga as making progress,
+// so the recovery job leaves it alone
+func (s *SagaCoordinator) setStep(db *gorm.DB, saga *models.Saga, i int, status, message string) {
+	now := s.now()
+	step := &saga.Steps[i]
+	step.Status = status
+	step.Error = message
+	step.UpdatedAt = now
+	saga.UpdatedAt = now
+
+	db.Model(&models.SagaStep{}).Where("id = ?", step.ID).
+		UpdateColumns(map[string]interface{}{"status": status, "error": message, "updated_at": now})
+	db.Model(&models.Saga{}).Where("id = ?", saga.ID).UpdateColumn("updated_at", now)
+}
+
+// cancelCreatedOrder undoes order creation by cancelling the order and
+// putting its stock back. Orders that already left the warehouse are not
+// touched, and ones cancelled since were restocked at the time.
+func cancelCreatedOrder(db *gorm.DB, saga models.Saga, _ models.SagaStep) error {
+	return WithTx(db.Statement.Context, db, func(tx *gorm.DB) error {
+		var order models.Order
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, saga.OrderID).Error; err != nil {
+			return err
+		}
+
+		switch order.Status {
+		case models.OrderStatusCancelled:
+			return nil
+		case models.OrderStatusShipped, models.OrderStatusDelivered:
+			return fmt.Errorf("order is already %s", order.Status)
+		}
+
+		before := order
+		if err := tx.Model(&order).Update("status", models.OrderStatusCancelled).Error; err != nil {
+			return err
+		}
+		if err := AppendOrderEvents(tx, before, OrderStatusEvent(models.OrderStatusCancelled, "saga")); err != nil {
+			return err
+		}
+		if order.ProductID == nil {
+			return nil
+		}
+		return tx.Model(&models.Product{}).
+			Where("id = ?", *order.ProductID).
+			Update("stock_quantity", gorm.Expr("stock_quantity + ?", order.Quantity)).Error
+	})
+}
+
+// recordFailedConfirmation records an order confirmation that could not be
+// sent as a failed notification attempt, so it can be resent
+func recordFailedConfirmation(db *gorm.DB, saga models.Saga, step models.SagaStep) error {
+	var order models.Order
+	if err := db.Preload("Customer").First(&order, saga.OrderID).Error; err != nil {
+		return err
+	}
+
+	return db.Create(&models.NotificationAttempt{
+		OrderID:     order.ID,
+		Recipient:   order.Customer.Phone,
+		Status:      models.NotificationStatusFailed,
+		Error:       step.Error,
+		RequestedBy: models.NotificationRequestedBySystem,
+	}).Error
+}
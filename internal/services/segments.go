@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSegmentSyncNotFound = errors.New("segment sync not found")
+	// ErrPlatformNotConfigured is returned for a sync to a platform without
+	// credentials
+	ErrPlatformNotConfigured = errors.New("marketing platform is not configured")
+)
+
+// segmentPage is how many tagged customers are read at a time
+const segmentPage = 500
+
+// SegmentService keeps customer tags and syncs the tagged customers to
+// marketing platforms. A run only sends the customers added, changed or
+// removed since the last one, so it can be repeated freely; several
+// instances running it at once send some contacts twice, which the
+// platforms treat as updates.
+type SegmentService struct {
+	db        *gorm.DB
+	platforms map[string]MarketingPlatform
+	now       func() time.Time
+}
+
+func NewSegmentService(db *gorm.DB, platforms map[string]MarketingPlatform) *SegmentService {
+	return &SegmentService{db: db, platforms: platforms, now: time.Now}
+}
+
+// WithClock replaces time.Now, for tests
+func (s *SegmentService) WithClock(now func() time.Time) *SegmentService {
+	s.now = now
+	return s
+}
+
+// Tags returns a customer's tags, alphabetically
+func (s *SegmentService) Tags(ctx context.Context, customerID uint) ([]models.CustomerTag, error) {
+	var tags []models.CustomerTag
+	err := s.db.WithContext(ctx).Where("customer_id = ?", customerID).Order("tag").Find(&tags).Error
+	return tags, err
+}
+
+// Tag adds tags to a customer, keeping those they already have
+func (s *SegmentService) Tag(ctx context.Context, customerID uint, tags []string, actor string) ([]models.CustomerTag, error) {
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, tag := range tags {
+			err := tx.Where(models.CustomerTag{CustomerID: customerID, Tag: tag}).
+				Attrs(models.CustomerTag{CreatedBy: actor}).
+				FirstOrCreate(&models.CustomerTag{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Tags(ctx, customerID)
+}
+
+// Untag takes tag off a customer, reporting whether they had it
+func (s *SegmentService) Untag(ctx context.Context, customerID uint, tag string) (bool, error) {
+	result := s.db.WithContext(ctx).Where("customer_id = ? AND tag = ?", customerID, tag).Delete(&models.CustomerTag{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// Configured reports whether platform has credentials
+func (s *SegmentService) Configured(platform string) bool {
+	_, ok := s.platforms[platform]
+	return ok
+}
+
+// CreateSync starts syncing the customers tagged sync.Tag; the first run
+// sends all of them
+func (s *SegmentService) CreateSync(ctx context.Context, sync *models.SegmentSync) error {
+	if !s.Configured(sync.Platform) {
+		return ErrPlatformNotConfigured
+	}
+	if sync.Segment == "" {
+		sync.Segment = sync.Tag
+	}
+	if len(sync.Fields) == 0 {
+		sync.Fields = DefaultMarketingFields(sync.Platform)
+	}
+	sync.Active = true
+	if err := s.db.WithContext(ctx).Create(sync).Error; err != nil {
+		return fmt.Errorf("failed to create segment sync: %w", err)
+	}
+	return nil
+}
+
+// Syncs returns every segment sync, newest first
+func (s *SegmentService) Syncs(ctx context.Context) ([]models.SegmentSync, error) {
+	var syncs []models.SegmentSync
+	err := s.db.WithContext(ctx).Order("id DESC").Find(&syncs).Error
+	return syncs, err
+}
+
+func (s *SegmentService) Sync(ctx context.Context, id uint) (models.SegmentSync, error) {
+	var sync models.SegmentSync
+	if err := s.db.WithContext(ctx).First(&sync, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return sync, ErrSegmentSyncNotFound
+		}
+		return sync, err
+	}
+	return sync, nil
+}
+
+// UpdateSync changes the fields req sets. Changing the fields sends every
+// member again on the next run.
+func (s *SegmentService) UpdateSync(ctx context.Context, id uint, req models.UpdateSegmentSyncRequest) (models.SegmentSync, error) {
+	sync, err := s.Sync(ctx, id)
+	if err != nil {
+		return sync, err
+	}
+
+	db := s.db.WithContext(ctx)
+	columns := []string{}
+	if req.Fields != nil {
+		sync.Fields = *req.Fields
+		if len(sync.Fields) == 0 {
+			sync.Fields = DefaultMarketingFields(sync.Platform)
+		}
+		columns = append(columns, "fields")
+	}
+	if req.Active != nil {
+		sync.Active = *req.Active
+		columns = append(columns, "active")
+	}
+	if len(columns) == 0 {
+		return sync, nil
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&sync).Select(columns).Updates(&sync).Error; err != nil {
+			return err
+		}
+		if req.Fields == nil {
+			return nil
+		}
+		// members synced before now are sent again with the new fields
+		return tx.Model(&models.SegmentSyncMember{}).Where("sync_id = ?", sync.ID).
+			Update("customer_updated_at", time.Time{}).Error
+	})
+	return sync, err
+}
+
+// DeleteSync stops syncing. The customers already on the platform stay in
+// the segment there.
+func (s *SegmentService) DeleteSync(ctx context.Context, id uint) (models.SegmentSync, error) {
+	sync, err := s.Sync(ctx, id)
+	if err != nil {
+		return sync, err
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("sync_id = ?", sync.ID).Delete(&models.SegmentSyncMember{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&sync).Error
+	})
+	return sync, err
+}
+
+// RunAll runs every active sync, returning how many customers were added,
+// updated or removed. A sync failing is recorded on it and the others
+// still run; the error is the first failure.
+func (s *SegmentService) RunAll(ctx context.Context) (int, error) {
+	var syncs []models.SegmentSync
+	if err := s.db.WithContext(ctx).Where("active = ?", true).Order("id").Find(&syncs).Error; err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var first error
+	for _, sync := range syncs {
+		ran, err := s.Run(ctx, sync.ID)
+		changed += ran.LastAdded + ran.LastUpdated + ran.LastRemoved
+		if err != nil && first == nil {
+			first = fmt.Errorf("segment sync %d: %w", sync.ID, err)
+		}
+	}
+	return changed, first
+}
+
+// Run sends the sync's changes to its platform and records the outcome on
+// it, returning the sync as it was left
+func (s *SegmentService) Run(ctx context.Context, id uint) (models.SegmentSync, error) {
+	sync, err := s.Sync(ctx, id)
+	if err != nil {
+		return sync, err
+	}
+	platform, ok := s.platforms[sync.Platform]
+	if !ok {
+		err = ErrPlatformNotConfigured
+	}
+
+	var counts segmentCounts
+	if err == nil {
+		counts, err = s.run(ctx, sync, platform)
+	}
+
+	now := s.now()
+	sync.LastRunAt = &now
+	sync.LastAdded, sync.LastUpdated, sync.LastRemoved, sync.LastSkipped = counts.added, counts.updated, counts.removed, counts.skipped
+	sync.LastStatus, sync.LastError = models.SegmentSyncSucceeded, ""
+	if err != nil {
+		sync.LastStatus, sync.LastError = models.SegmentSyncFailed, err.Error()
+		log.Printf("segment sync %d to %s failed: %v", sync.ID, sync.Platform, err)
+	} else {
+		sync.LastSuccessAt = &now
+	}
+
+	// a background context, so the outcome is saved even when ctx was cancelled
+	db := s.db.WithContext(context.WithoutCancel(ctx))
+	var members int64
+	if countErr := db.Model(&models.SegmentSyncMember{}).Where("sync_id = ?", sync.ID).Count(&members).Error; countErr != nil {
+		return sync, countErr
+	}
+	sync.Members = int(members)
+	saveErr := db.Model(&sync).
+		Select("members", "last_run_at", "last_success_at", "last_status", "last_error", "last_added", "last_updated", "last_removed", "last_skipped").
+		Updates(&sync).Error
+	if err != nil {
+		return sync, err
+	}
+	return sync, saveErr
+}
+
+type segmentCounts struct {
+	added, updated, removed, skipped int
+}
+
+func (s *SegmentService) run(ctx context.Context, sync models.SegmentSync, platform MarketingPlatform) (segmentCounts, error) {
+	var counts segmentCounts
+	db := s.db.WithContext(ctx)
+	segment := MarketingSegment{Audience: sync.Audience, Name: sync.Segment}
+
+	var existing []models.SegmentSyncMember
+	if err := db.Where("sync_id = ?", sync.ID).Find(&existing).Error; err != nil {
+		return counts, err
+	}
+	members := make(map[uint]models.SegmentSyncMember, len(existing))
+	for _, member := range existing {
+		members[member.CustomerID] = member
+	}
+
+	var afterID uint
+	for {
+		var customers []models.Customer
+		err := db.Select("customers.*").
+			Joins("JOIN customer_tags ON customer_tags.customer_id = customers.id AND customer_tags.tag = ?", sync.Tag).
+			Where("customers.id > ? AND customers.anonymized_at IS NULL", afterID).
+			Order("customers.id").Limit(segmentPage).Find(&customers).Error
+		if err != nil {
+			return counts, err
+		}
+
+		for _, customer := range customers {
+			member, synced := members[customer.ID]
+			delete(members, customer.ID)
+			optedOut := customer.MarketingOptOutAt != nil
+			if synced && !customer.UpdatedAt.After(member.CustomerUpdatedAt) && member.OptedOut == optedOut {
+				continue
+			}
+
+			// a changed email is a different Mailchimp member, so the old
+			// one leaves the segment first
+			if synced && member.Email != customer.Email {
+				if err := platform.Remove(ctx, segment, MarketingContact{CustomerID: customer.ID, Email: member.Email}); err != nil {
+					return counts, err
+				}
+			}
+			contact := MarketingContact{
+				CustomerID: customer.ID,
+				Email:      customer.Email,
+				OptedOut:   optedOut,
+				Fields:     MarketingFields(customer, sync.Fields),
+			}
+			if err := platform.Upsert(ctx, segment, contact); err != nil {
+				if !errors.Is(err, ErrContactRejected) {
+					return counts, err
+				}
+				log.Printf("segment sync %d skipped customer %d: %v", sync.ID, customer.ID, err)
+				counts.skipped++
+				if synced {
+					if err := db.Delete(&member).Error; err != nil {
+						return counts, err
+					}
+				}
+				continue
+			}
+
+			member = models.SegmentSyncMember{
+				SyncID:            sync.ID,
+				CustomerID:        customer.ID,
+				Email:             customer.Email,
+				OptedOut:          optedOut,
+				CustomerUpdatedAt: customer.UpdatedAt,
+				SyncedAt:          s.now(),
+			}
+			if err := db.Save(&member).Error; err != nil {
+				return counts, err
+			}
+			if synced {
+				counts.updated++
+			} else {
+				counts.added++
+			}
+		}
+
+		if len(customers) < segmentPage {
+			break
+		}
+		afterID = customers[len(customers)-1].ID
+	}
+
+	// whoever is left was untagged, deleted or anonymized
+	for _, member := range members {
+		contact := MarketingContact{CustomerID: member.CustomerID, Email: member.Email}
+		if err := platform.Remove(ctx, segment, contact); err != nil {
+			return counts, err
+		}
+		if err := db.Delete(&member).Error; err != nil {
+			return counts, err
+		}
+		counts.removed++
+	}
+	return counts, nil
+}
+
+// MarketingFields maps a customer's fields to the names in fields, which
+// maps platform names to customer fields. Dates are sent as 2006-01-02.
+func MarketingFields(customer models.Customer, fields map[string]string) map[string]string {
+	first, last, _ := strings.Cut(strings.TrimSpace(customer.Name), " ")
+	values := map[string]string{
+		"name":       customer.Name,
+		"first_name": first,
+		"last_name":  strings.TrimSpace(last),
+		"code":       customer.Code,
+		"phone":      customer.Phone,
+		"email":      customer.Email,
+		"created_at": customer.CreatedAt.Format(time.DateOnly),
+	}
+	if customer.LastOrderAt != nil {
+		values["last_order_at"] = customer.LastOrderAt.Format(time.DateOnly)
+	}
+
+	mapped := make(map[string]string, len(fields))
+	for name, field := range fields {
+		if value, ok := values[field]; ok && value != "" {
+			mapped[name] = value
+		}
+	}
+	return mapped
+}
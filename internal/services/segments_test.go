@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSegmentService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "segments.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+	ctx := context.Background()
+
+	platform := NewMockMarketingPlatform()
+	segments := NewSegmentService(db, map[string]MarketingPlatform{models.MarketingPlatformMailchimp: platform})
+
+	for _, customer := range []models.Customer{
+		{ID: 1, Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbie@example.com"},
+		{ID: 2, Name: "Amina Otieno", Code: "CUST002", Phone: "+254711000002", Email: "amina@example.com"},
+		{ID: 3, Name: "Brian Kip", Code: "CUST003", Phone: "+254711000003", Email: "brian@example.com"},
+	} {
+		require.NoError(t, db.Create(&customer).Error)
+	}
+	_, err = segments.Tag(ctx, 1, []string{"vip", "nairobi"}, "admin@example.com")
+	require.NoError(t, err)
+	_, err = segments.Tag(ctx, 2, []string{"vip"}, "admin@example.com")
+	require.NoError(t, err)
+	tags, err := segments.Tag(ctx, 1, []string{"vip"}, "admin@example.com")
+	require.NoError(t, err)
+	require.Len(t, tags, 2)
+	assert.Equal(t, "nairobi", tags[0].Tag)
+
+	sync := models.SegmentSync{Tag: "vip", Platform: models.MarketingPlatformMailchimp, Audience: "a1b2c3d4"}
+	require.NoError(t, segments.CreateSync(ctx, &sync))
+	assert.Equal(t, "vip", sync.Segment)
+	assert.Equal(t, DefaultMarketingFields(models.MarketingPlatformMailchimp), sync.Fields)
+
+	t.Run("first run sends every tagged customer", func(t *testing.T) {
+		ran, err := segments.Run(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.SegmentSyncSucceeded, ran.LastStatus)
+		assert.Equal(t, 2, ran.LastAdded)
+		assert.Equal(t, 2, ran.Members)
+
+		members := platform.Segment("vip")
+		require.Len(t, members, 2)
+		assert.Equal(t, "sebbie@example.com", members[1].Email)
+		assert.Equal(t, map[string]string{"FNAME": "Sebbie", "LNAME": "Chanzu", "PHONE": "+254740827150"}, members[1].Fields)
+	})
+
+	t.Run("later runs only send changes", func(t *testing.T) {
+		ran, err := segments.Run(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Zero(t, ran.LastAdded+ran.LastUpdated+ran.LastRemoved)
+
+		require.NoError(t, db.Model(&models.Customer{ID: 2}).Updates(models.Customer{Name: "Amina Wanjiru", UpdatedAt: time.Now().Add(time.Second)}).Error)
+		require.NoError(t, db.Model(&models.Customer{}).Where("id = ?", 1).UpdateColumn("marketing_opt_out_at", time.Now()).Error)
+		_, err = segments.Untag(ctx, 1, "vip")
+		require.NoError(t, err)
+		_, err = segments.Tag(ctx, 3, []string{"vip"}, "admin@example.com")
+		require.NoError(t, err)
+
+		ran, err = segments.Run(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ran.LastAdded)
+		assert.Equal(t, 1, ran.LastUpdated)
+		assert.Equal(t, 1, ran.LastRemoved)
+		assert.Equal(t, 2, ran.Members)
+
+		members := platform.Segment("vip")
+		require.Len(t, members, 2)
+		assert.Equal(t, "Wanjiru", members[2].Fields["LNAME"])
+		assert.Contains(t, members, uint(3))
+	})
+
+	t.Run("opted out customers are sent as unsubscribed", func(t *testing.T) {
+		require.NoError(t, db.Model(&models.Customer{}).Where("id = ?", 3).UpdateColumn("marketing_opt_out_at", time.Now()).Error)
+		ran, err := segments.Run(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, ran.LastUpdated)
+		assert.True(t, platform.Segment("vip")[3].OptedOut)
+	})
+
+	t.Run("changing the fields sends everyone again", func(t *testing.T) {
+		fields := map[string]string{"CODE": "code"}
+		_, err := segments.UpdateSync(ctx, sync.ID, models.UpdateSegmentSyncRequest{Fields: &fields})
+		require.NoError(t, err)
+
+		ran, err := segments.Run(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, ran.LastUpdated)
+		assert.Equal(t, map[string]string{"CODE": "CUST002"}, platform.Segment("vip")[2].Fields)
+	})
+
+	t.Run("deleted customers are removed and failures recorded", func(t *testing.T) {
+		require.NoError(t, db.Delete(&models.Customer{}, 2).Error)
+		platform.Err = errors.New("mailchimp is down")
+		ran, err := segments.Run(ctx, sync.ID)
+		assert.Error(t, err)
+		assert.Equal(t, models.SegmentSyncFailed, ran.LastStatus)
+		assert.Equal(t, "mailchimp is down", ran.LastError)
+		assert.Equal(t, 2, ran.Members)
+
+		platform.Err = nil
+		changed, err := segments.RunAll(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, changed)
+		stored, err := segments.Sync(ctx, sync.ID)
+		require.NoError(t, err)
+		assert.Equal(t, models.SegmentSyncSucceeded, stored.LastStatus)
+		assert.Empty(t, stored.LastError)
+		assert.Equal(t, 1, stored.Members)
+		assert.NotContains(t, platform.Segment("vip"), uint(2))
+	})
+
+	t.Run("unconfigured platforms are refused", func(t *testing.T) {
+		err := segments.CreateSync(ctx, &models.SegmentSync{Tag: "vip", Platform: models.MarketingPlatformCustomerIO})
+		assert.ErrorIs(t, err, ErrPlatformNotConfigured)
+	})
+}
+
+func TestMarketingFields(t *testing.T) {
+	lastOrder := time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC)
+	customer := models.Customer{Name: "Mary Wambui Njeri", Code: "CUST009", Phone: "+254711000009", CreatedAt: time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), LastOrderAt: &lastOrder}
+
+	fields := MarketingFields(customer, map[string]string{"FNAME": "first_name", "LNAME": "last_name", "EMAIL2": "email", "SINCE": "created_at", "LAST": "last_order_at"})
+	assert.Equal(t, map[string]string{"FNAME": "Mary", "LNAME": "Wambui Njeri", "SINCE": "2025-01-02", "LAST": "2026-03-10"}, fields)
+}
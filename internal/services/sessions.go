@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+)
+
+// sessionTouchInterval limits last_seen_at writes to one per session per
+// interval, rather than one per request
+const sessionTouchInterval = time.Minute
+
+// SessionStore keeps track of issued access tokens so users can see where
+// they are signed in and revoke tokens before they expire
+type SessionStore struct {
+	db  *gorm.DB
+	now func() time.Time
+}
+
+func NewSessionStore(db *gorm.DB) *SessionStore {
+	return &SessionStore{db: db, now: time.Now}
+}
+
+// Create records a new session, filling in its id
+func (s *SessionStore) Create(ctx context.Context, session *models.Session) error {
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+
+	now := s.now()
+	session.ID = id
+	session.CreatedAt = now
+	session.LastSeenAt = now
+
+	if err := s.db.WithContext(ctx).Create(session).Error; err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+// Validate returns ErrSessionRevoked for a revoked session and
+// ErrSessionNotFound for an unknown one, and otherwise notes the session was
+// just used
+func (s *SessionStore) Validate(ctx context.Context, id string) error {
+	db := s.db.WithContext(ctx)
+
+	var session models.Session
+	if err := db.First(&session, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return err
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+
+	now := s.now()
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		return db.Model(&session).UpdateColumn("last_seen_at", now).Error
+	}
+	return nil
+}
+
+// Active lists the user's sessions that are neither revoked nor expired,
+// most recently used first
+func (s *SessionStore) Active(ctx context.Context, email string) ([]models.Session, error) {
+	var sessions []models.Session
+	err := s.db.WithContext(ctx).
+		Where("user_email = ? AND revoked_at IS NULL AND expires_at > ?", email, s.now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke ends one of the user's sessions. Other users' sessions are
+// reported as not found.
+func (s *SessionStore) Revoke(ctx context.Context, email, id string) error {
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("id = ? AND user_email = ? AND revoked_at IS NULL", id, email).
+		Update("revoked_at", s.now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session still open, e.g. after the signing key
+// leaked, and returns how many it ended
+func (s *SessionStore) RevokeAll(ctx context.Context) (int64, error) {
+	result := s.db.WithContext(ctx).Model(&models.Session{}).
+		Where("revoked_at IS NULL AND expires_at > ?", s.now()).
+		Update("revoked_at", s.now())
+	return result.RowsAffected, result.Error
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// SLAOpenStatuses are the statuses in which an order can still miss its
+// shipping deadline
+var SLAOpenStatuses = []string{models.OrderStatusPending, models.OrderStatusConfirmed}
+
+// SLAPolicy sets how long an order may take to ship, by priority
+type SLAPolicy struct {
+	Normal  time.Duration
+	Express time.Duration
+	// EscalateBefore is how close to its deadline an unshipped express order
+	// may get before ops are alerted
+	EscalateBefore time.Duration
+}
+
+func DefaultSLAPolicy() SLAPolicy {
+	return SLAPolicy{
+		Normal:         72 * time.Hour,
+		Express:        24 * time.Hour,
+		EscalateBefore: 4 * time.Hour,
+	}
+}
+
+// SLAPolicyFromEnv reads SLA_NORMAL_SHIP_WITHIN, SLA_EXPRESS_SHIP_WITHIN and
+// SLA_ESCALATE_BEFORE over the defaults
+func SLAPolicyFromEnv() SLAPolicy {
+	policy := DefaultSLAPolicy()
+
+	if d, err := time.ParseDuration(os.Getenv("SLA_NORMAL_SHIP_WITHIN")); err == nil && d > 0 {
+		policy.Normal = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SLA_EXPRESS_SHIP_WITHIN")); err == nil && d > 0 {
+		policy.Express = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("SLA_ESCALATE_BEFORE")); err == nil && d > 0 {
+		policy.EscalateBefore = d
+	}
+	return policy
+}
+
+// WithDefaults fills unset durations from DefaultSLAPolicy
+func (p SLAPolicy) WithDefaults() SLAPolicy {
+	defaults := DefaultSLAPolicy()
+	if p.Normal <= 0 {
+		p.Normal = defaults.Normal
+	}
+	if p.Express <= 0 {
+		p.Express = defaults.Express
+	}
+	if p.EscalateBefore <= 0 {
+		p.EscalateBefore = defaults.EscalateBefore
+	}
+	return p
+}
+
+// Deadline is when an order of the given priority placed at from must ship
+func (p SLAPolicy) Deadline(priority string, from time.Time) time.Time {
+	if priority == models.OrderPriorityExpress {
+		return from.Add(p.Express)
+	}
+	return from.Add(p.Normal)
+}
+
+// SLAService flags orders that missed their shipping deadline and alerts ops
+// about express orders about to miss theirs
+type SLAService struct {
+	db        *gorm.DB
+	sms       SMSServiceInterface
+	opsPhones []string
+	policy    SLAPolicy
+	now       func() time.Time
+}
+
+func NewSLAService(db *gorm.DB, sms SMSServiceInterface, opsPhones []string, policy SLAPolicy) *SLAService {
+	return &SLAService{
+		db:        db,
+		sms:       sms,
+		opsPhones: opsPhones,
+		policy:    policy.WithDefaults(),
+		now:       time.Now,
+	}
+}
+
+// Check marks newly breached orders and escalates express orders due within
+// EscalateBefore. Each order is escalated at most once.
+func (s *SLAService) Check(ctx context.Context) (breached int64, escalated int, err error) {
+	db := s.db.WithContext(ctx)
+	now := s.now()
+
+	result := db.Model(&models.Order{}).
+		Where("sla_deadline < ? AND sla_breached_at IS NULL AND status IN ?", now, SLAOpenStatuses).
+		Update("sla_breached_at", now)
+	if result.Error != nil {
+		return 0, 0, fmt.Errorf("failed to flag breached orders: %w", result.Error)
+	}
+	breached = result.RowsAffected
+
+	if len(s.opsPhones) == 0 {
+		return breached, 0, nil
+	}
+
+	var atRisk []models.Order
+	err = db.Where("priority = ? AND sla_deadline <= ? AND sla_escalated_at IS NULL AND status IN ?",
+		models.OrderPriorityExpress, now.Add(s.policy.EscalateBefore), SLAOpenStatuses).
+		Order("sla_deadline ASC").
+		Find(&atRisk).Error
+	if err != nil {
+		return breached, 0, fmt.Errorf("failed to find at risk orders: %w", err)
+	}
+
+	for _, order := range atRisk {
+		message := fmt.Sprintf("sla alert: express order %d (%s) is not shipped and is due %s",
+			order.ID, order.Item, order.SLADeadline.Format("2006-01-02 15:04"))
+		result, err := s.sms.SendBulkSMS(ctx, s.opsPhones, message)
+		if err != nil {
+			// leave it unmarked so the next check tries again
+			log.Printf("failed to send sla escalation for order %d: %v", order.ID, err)
+			continue
+		}
+		for _, failed := range result.Failed() {
+			log.Printf("sla escalation for order %d not sent to %s: %s", order.ID, failed.Phone, failed.Error)
+		}
+
+		if err := db.Model(&order).Update("sla_escalated_at", now).Error; err != nil {
+			return breached, escalated, fmt.Errorf("failed to mark order %d escalated: %w", order.ID, err)
+		}
+		escalated++
+	}
+
+	return breached, escalated, nil
+}
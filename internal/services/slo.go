@@ -0,0 +1,356 @@
+package services
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// SLOConfig sets the service level objectives requests are measured against
+type SLOConfig struct {
+	// AvailabilityTarget is the share of requests that must not fail with a
+	// 5xx, e.g. 0.999
+	AvailabilityTarget float64
+	// LatencyTarget is the share of requests that must complete within
+	// LatencyThreshold
+	LatencyTarget    float64
+	LatencyThreshold time.Duration
+}
+
+func DefaultSLOConfig() SLOConfig {
+	return SLOConfig{
+		AvailabilityTarget: 0.999,
+		LatencyTarget:      0.99,
+		LatencyThreshold:   500 * time.Millisecond,
+	}
+}
+
+// SLOConfigFromEnv reads SLO_AVAILABILITY_TARGET, SLO_LATENCY_TARGET and
+// SLO_LATENCY_THRESHOLD over the defaults
+func SLOConfigFromEnv() SLOConfig {
+	cfg := DefaultSLOConfig()
+
+	if f, err := strconv.ParseFloat(os.Getenv("SLO_AVAILABILITY_TARGET"), 64); err == nil && f > 0 && f < 1 {
+		cfg.AvailabilityTarget = f
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("SLO_LATENCY_TARGET"), 64); err == nil && f > 0 && f < 1 {
+		cfg.LatencyTarget = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("SLO_LATENCY_THRESHOLD")); err == nil && d > 0 {
+		cfg.LatencyThreshold = d
+	}
+	return cfg
+}
+
+// SLOBurnWindows are the windows burn rates are reported over, short ones
+// for fast burn alerts and long ones for slow burns
+var SLOBurnWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// sloSlots is how many one minute slots are kept for the burn windows
+const sloSlots = 6 * 60
+
+// sloLatencyBuckets are the upper bounds, in seconds, of the request
+// duration histogram
+var sloLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type sloCounts struct {
+	total  int64
+	errors int64
+	slow   int64
+}
+
+func (c *sloCounts) add(o sloCounts) {
+	c.total += o.total
+	c.errors += o.errors
+	c.slow += o.slow
+}
+
+type sloGroup struct {
+	// lifetime only ever grows, as Prometheus counters must
+	lifetime sloCounts
+	month    sloCounts
+	// slots hold the counts of the minute in slotMinute, as a ring
+	slots      [sloSlots]sloCounts
+	slotMinute [sloSlots]int64
+	// durations counts requests per latency bucket, the last being +Inf
+	durations   []int64
+	durationSum float64
+}
+
+// SLOTracker counts requests per route group against the availability and
+// latency SLOs. Counts are kept in memory, so each instance reports on the
+// traffic it served; Prometheus aggregates across instances.
+type SLOTracker struct {
+	mu         sync.Mutex
+	cfg        SLOConfig
+	started    time.Time
+	monthStart time.Time
+	groups     map[string]*sloGroup
+	now        func() time.Time
+}
+
+func NewSLOTracker(cfg SLOConfig) *SLOTracker {
+	defaults := DefaultSLOConfig()
+	if cfg.AvailabilityTarget <= 0 || cfg.AvailabilityTarget >= 1 {
+		cfg.AvailabilityTarget = defaults.AvailabilityTarget
+	}
+	if cfg.LatencyTarget <= 0 || cfg.LatencyTarget >= 1 {
+		cfg.LatencyTarget = defaults.LatencyTarget
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = defaults.LatencyThreshold
+	}
+
+	return &SLOTracker{
+		cfg:    cfg,
+		groups: make(map[string]*sloGroup),
+		now:    time.Now,
+	}
+}
+
+// WithClock replaces time.Now, for tests
+func (t *SLOTracker) WithClock(now func() time.Time) *SLOTracker {
+	t.now = now
+	return t
+}
+
+// Record counts one request. A 5xx counts against availability and taking
+// longer than the latency threshold counts against latency.
+func (t *SLOTracker) Record(group string, status int, duration time.Duration) {
+	counts := sloCounts{total: 1}
+	if status >= http.StatusInternalServerError {
+		counts.errors = 1
+	}
+	if duration > t.cfg.LatencyThreshold {
+		counts.slow = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rollMonth(now)
+
+	g, ok := t.groups[group]
+	if !ok {
+		g = &sloGroup{durations: make([]int64, len(sloLatencyBuckets)+1)}
+		t.groups[group] = g
+	}
+	g.lifetime.add(counts)
+	g.month.add(counts)
+
+	minute := now.Unix() / 60
+	slot := minute % sloSlots
+	if g.slotMinute[slot] != minute {
+		g.slots[slot] = sloCounts{}
+		g.slotMinute[slot] = minute
+	}
+	g.slots[slot].add(counts)
+
+	seconds := duration.Seconds()
+	bucket := sort.SearchFloat64s(sloLatencyBuckets, seconds)
+	g.durations[bucket]++
+	g.durationSum += seconds
+}
+
+// rollMonth starts the month's counts over once a new month begins
+func (t *SLOTracker) rollMonth(now time.Time) {
+	if t.started.IsZero() {
+		t.started = now
+	}
+
+	now = now.UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if start.Equal(t.monthStart) {
+		return
+	}
+	t.monthStart = start
+	for _, g := range t.groups {
+		g.month = sloCounts{}
+	}
+}
+
+// window sums a group's counts over the last d
+func (t *SLOTracker) window(g *sloGroup, now time.Time, d time.Duration) sloCounts {
+	var sum sloCounts
+	minute := now.Unix() / 60
+	for m := minute - int64(d/time.Minute) + 1; m <= minute; m++ {
+		if slot := m % sloSlots; g.slotMinute[slot] == m {
+			sum.add(g.slots[slot])
+		}
+	}
+	return sum
+}
+
+// Report summarizes the current month's error budgets
+func (t *SLOTracker) Report() models.SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rollMonth(now)
+
+	report := models.SLOReport{
+		MonthStart:         t.monthStart,
+		Since:              t.monthStart,
+		AvailabilityTarget: t.cfg.AvailabilityTarget,
+		LatencyTarget:      t.cfg.LatencyTarget,
+		LatencyThresholdMs: t.cfg.LatencyThreshold.Milliseconds(),
+		Groups:             []models.SLOGroupReport{},
+	}
+	if t.started.After(t.monthStart) {
+		report.Since = t.started
+	}
+
+	overall := &sloGroup{}
+	for _, name := range t.groupNames() {
+		g := t.groups[name]
+		report.Groups = append(report.Groups, t.groupReport(name, g, now))
+
+		overall.month.add(g.month)
+		for i := range g.slots {
+			if g.slotMinute[i] == overall.slotMinute[i] {
+				overall.slots[i].add(g.slots[i])
+			} else if g.slotMinute[i] > overall.slotMinute[i] {
+				overall.slots[i] = g.slots[i]
+				overall.slotMinute[i] = g.slotMinute[i]
+			}
+		}
+	}
+	report.Overall = t.groupReport("all", overall, now)
+
+	return report
+}
+
+func (t *SLOTracker) groupReport(name string, g *sloGroup, now time.Time) models.SLOGroupReport {
+	report := models.SLOGroupReport{
+		Group:        name,
+		Requests:     g.month.total,
+		Availability: sliReport(t.cfg.AvailabilityTarget, g.month.total, g.month.errors),
+		Latency:      sliReport(t.cfg.LatencyTarget, g.month.total, g.month.slow),
+	}
+	for _, w := range SLOBurnWindows {
+		counts := t.window(g, now, w.Duration)
+		report.Availability.BurnRates[w.Name] = burnRate(t.cfg.AvailabilityTarget, counts.total, counts.errors)
+		report.Latency.BurnRates[w.Name] = burnRate(t.cfg.LatencyTarget, counts.total, counts.slow)
+	}
+	return report
+}
+
+func sliReport(target float64, total, bad int64) models.SLIReport {
+	report := models.SLIReport{
+		BadRequests:     bad,
+		Ratio:           1,
+		BudgetRemaining: 1,
+		BurnRates:       map[string]float64{},
+	}
+	if total > 0 {
+		report.Ratio = float64(total-bad) / float64(total)
+		report.BudgetRemaining = 1 - float64(bad)/(float64(total)*(1-target))
+	}
+	return report
+}
+
+// burnRate is the error rate relative to the rate the target allows
+func burnRate(target float64, total, bad int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total) / (1 - target)
+}
+
+func (t *SLOTracker) groupNames() []string {
+	names := make([]string, 0, len(t.groups))
+	for name := range t.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WriteMetrics writes the SLO metrics in the Prometheus text exposition
+// format
+func (t *SLOTracker) WriteMetrics(w io.Writer) error {
+	report := t.Report()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var lines []string
+	metric := func(name, kind, help string) {
+		lines = append(lines, fmt.Sprintf("# HELP %s %s", name, help), fmt.Sprintf("# TYPE %s %s", name, kind))
+	}
+	sample := func(name, labels string, value interface{}) {
+		lines = append(lines, fmt.Sprintf("%s{%s} %v", name, labels, value))
+	}
+	names := t.groupNames()
+
+	metric("slo_objective_ratio", "gauge", "Target share of good requests per SLI.")
+	sample("slo_objective_ratio", `sli="availability"`, t.cfg.AvailabilityTarget)
+	sample("slo_objective_ratio", `sli="latency"`, t.cfg.LatencyTarget)
+
+	metric("slo_latency_threshold_seconds", "gauge", "Requests slower than this count against the latency SLO.")
+	lines = append(lines, fmt.Sprintf("slo_latency_threshold_seconds %v", t.cfg.LatencyThreshold.Seconds()))
+
+	metric("slo_requests_total", "counter", "Requests counted towards the SLOs.")
+	for _, name := range names {
+		sample("slo_requests_total", fmt.Sprintf("group=%q", name), t.groups[name].lifetime.total)
+	}
+
+	metric("slo_bad_requests_total", "counter", "Requests that failed an SLI.")
+	for _, name := range names {
+		g := t.groups[name]
+		sample("slo_bad_requests_total", fmt.Sprintf("group=%q,sli=\"availability\"", name), g.lifetime.errors)
+		sample("slo_bad_requests_total", fmt.Sprintf("group=%q,sli=\"latency\"", name), g.lifetime.slow)
+	}
+
+	metric("http_request_duration_seconds", "histogram", "Request latency.")
+	for _, name := range names {
+		g := t.groups[name]
+		var cumulative int64
+		for i, bound := range sloLatencyBuckets {
+			cumulative += g.durations[i]
+			sample("http_request_duration_seconds_bucket", fmt.Sprintf("group=%q,le=\"%v\"", name, bound), cumulative)
+		}
+		sample("http_request_duration_seconds_bucket", fmt.Sprintf("group=%q,le=\"+Inf\"", name), g.lifetime.total)
+		sample("http_request_duration_seconds_sum", fmt.Sprintf("group=%q", name), g.durationSum)
+		sample("http_request_duration_seconds_count", fmt.Sprintf("group=%q", name), g.lifetime.total)
+	}
+
+	groups := append([]models.SLOGroupReport{report.Overall}, report.Groups...)
+
+	metric("slo_burn_rate", "gauge", "Error budget burn rate over a recent window; 1 spends the budget in exactly a month.")
+	for _, g := range groups {
+		for _, w := range SLOBurnWindows {
+			sample("slo_burn_rate", fmt.Sprintf("group=%q,sli=\"availability\",window=%q", g.Group, w.Name), g.Availability.BurnRates[w.Name])
+			sample("slo_burn_rate", fmt.Sprintf("group=%q,sli=\"latency\",window=%q", g.Group, w.Name), g.Latency.BurnRates[w.Name])
+		}
+	}
+
+	metric("slo_error_budget_remaining_ratio", "gauge", "Share of this month's error budget left.")
+	for _, g := range groups {
+		sample("slo_error_budget_remaining_ratio", fmt.Sprintf("group=%q,sli=\"availability\"", g.Group), g.Availability.BudgetRemaining)
+		sample("slo_error_budget_remaining_ratio", fmt.Sprintf("group=%q,sli=\"latency\"", g.Group), g.Latency.BudgetRemaining)
+	}
+
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
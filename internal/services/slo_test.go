@@ -0,0 +1,90 @@
+package services
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSLOTrackerReport(t *testing.T) {
+	now := time.Date(2025, 9, 19, 10, 0, 0, 0, time.UTC)
+	tracker := NewSLOTracker(SLOConfig{AvailabilityTarget: 0.99, LatencyTarget: 0.9, LatencyThreshold: 100 * time.Millisecond}).
+		WithClock(func() time.Time { return now })
+
+	// 200 orders requests two hours ago: 1 failure, 10 slow
+	now = now.Add(-2 * time.Hour)
+	for i := 0; i < 200; i++ {
+		status, duration := http.StatusOK, 10*time.Millisecond
+		if i == 0 {
+			status = http.StatusServiceUnavailable
+		}
+		if i < 10 {
+			duration = time.Second
+		}
+		tracker.Record("orders", status, duration)
+	}
+
+	// 100 recent ones, 4 of them failing
+	now = now.Add(2 * time.Hour)
+	for i := 0; i < 100; i++ {
+		status := http.StatusOK
+		if i < 4 {
+			status = http.StatusInternalServerError
+		}
+		tracker.Record("orders", status, 10*time.Millisecond)
+	}
+	tracker.Record("customers", http.StatusNotFound, 10*time.Millisecond)
+
+	report := tracker.Report()
+	assert.Equal(t, time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), report.MonthStart)
+	assert.Equal(t, now.Add(-2*time.Hour), report.Since, "counting began when the instance started")
+	assert.Equal(t, int64(100), report.LatencyThresholdMs)
+
+	if assert.Len(t, report.Groups, 2) {
+		assert.Equal(t, "customers", report.Groups[0].Group)
+		assert.Equal(t, int64(0), report.Groups[0].Availability.BadRequests, "4xx are not failures")
+
+		orders := report.Groups[1]
+		assert.Equal(t, int64(300), orders.Requests)
+		assert.Equal(t, int64(5), orders.Availability.BadRequests)
+		// 5 failures against a budget of 3
+		assert.InDelta(t, -2.0/3, orders.Availability.BudgetRemaining, 1e-9)
+		// 10 slow against a budget of 30
+		assert.InDelta(t, 2.0/3, orders.Latency.BudgetRemaining, 1e-9)
+		assert.InDelta(t, 4.0, orders.Availability.BurnRates["1h"], 1e-9)
+		assert.InDelta(t, 5.0/300/0.01, orders.Availability.BurnRates["6h"], 1e-9)
+		assert.Zero(t, orders.Latency.BurnRates["1h"])
+	}
+	assert.Equal(t, int64(301), report.Overall.Requests)
+	assert.InDelta(t, 4.0/101/0.01, report.Overall.Availability.BurnRates["5m"], 1e-9)
+
+	// a new month starts with a full budget
+	now = time.Date(2025, 10, 1, 0, 30, 0, 0, time.UTC)
+	report = tracker.Report()
+	assert.Equal(t, time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), report.Since)
+	assert.Zero(t, report.Overall.Requests)
+	assert.Equal(t, 1.0, report.Overall.Availability.BudgetRemaining)
+}
+
+func TestSLOTrackerWriteMetrics(t *testing.T) {
+	tracker := NewSLOTracker(DefaultSLOConfig())
+	tracker.Record("orders", http.StatusOK, 80*time.Millisecond)
+	tracker.Record("orders", http.StatusBadGateway, 2*time.Second)
+
+	var buf bytes.Buffer
+	assert.NoError(t, tracker.WriteMetrics(&buf))
+	metrics := buf.String()
+
+	assert.Contains(t, metrics, "# TYPE slo_requests_total counter")
+	assert.Contains(t, metrics, `slo_requests_total{group="orders"} 2`)
+	assert.Contains(t, metrics, `slo_bad_requests_total{group="orders",sli="availability"} 1`)
+	assert.Contains(t, metrics, `slo_bad_requests_total{group="orders",sli="latency"} 1`)
+	assert.Contains(t, metrics, `http_request_duration_seconds_bucket{group="orders",le="0.1"} 1`)
+	assert.Contains(t, metrics, `http_request_duration_seconds_bucket{group="orders",le="+Inf"} 2`)
+	assert.Contains(t, metrics, `slo_burn_rate{group="all",sli="availability",window="5m"} `)
+	assert.Contains(t, metrics, `slo_error_budget_remaining_ratio{group="orders",sli="latency"} `)
+	assert.Contains(t, metrics, `slo_objective_ratio{sli="availability"} 0.999`)
+}
@@ -1,91 +1,214 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+
+	"gorm.io/gorm"
 )
 
+// ErrSMSThrottled means Africa's Talking refused a request for exceeding
+// the account's rate limit; nothing was sent
+var ErrSMSThrottled = errors.New("sms provider throttled the request")
+
 type SMSService struct {
 	username string
 	apiKey   string
 	senderId string
 	baseUrl  string
+	client   *ResilientClient
+	bulk     BulkSMSConfig
+	limiter  *rateLimiter
+	failures *SMSFailureTracker
+	length   SMSLengthPolicy
+	messages *gorm.DB
 }
 
 type SMSResponse struct {
 	SMSMessageData struct {
-		Message    string `json:"Message"`
-		Recipients []struct {
-			StatusCode int    `json:"statusCode"`
-			Number     string `json:"number"`
-			Status     string `json:"status"`
-			Cost       string `json:"cost"`
-			MessageId  string `json:"messageId"`
-		} `json:"Recipients"`
+		Message    string         `json:"Message"`
+		Recipients []SMSRecipient `json:"Recipients"`
 	} `json:"SMSMessageData"`
 }
 
+type SMSRecipient struct {
+	StatusCode int    `json:"statusCode"`
+	Number     string `json:"number"`
+	Status     string `json:"status"`
+	Cost       string `json:"cost"`
+	MessageId  string `json:"messageId"`
+}
+
+// Sent reports whether the provider accepted the message (101 processed,
+// 102 sent)
+func (r SMSRecipient) Sent() bool {
+	return r.StatusCode == 101 || r.StatusCode == 102
+}
+
+// Africa's Talking environments, chosen with SMS_ENVIRONMENT
+const (
+	SMSEnvironmentSandbox = "sandbox"
+	SMSEnvironmentLive    = "live"
+)
+
+var smsEndpoints = map[string]string{
+	SMSEnvironmentSandbox: "https://api.sandbox.africastalking.com/version1/messaging",
+	SMSEnvironmentLive:    "https://api.africastalking.com/version1/messaging",
+}
+
 func NewSMSService(username, apiKey, senderID string) *SMSService {
 	return &SMSService{
 		username: username,
 		apiKey:   apiKey,
 		senderId: senderID,
-		baseUrl:  "https://api.sandbox.africastalking.com/version1/messaging",
+		baseUrl:  smsEndpoints[SMSEnvironmentSandbox],
+		client:   NewResilientClient(DefaultHTTPClientConfig()),
+		bulk:     DefaultBulkSMSConfig(),
+		limiter:  newRateLimiter(DefaultBulkSMSConfig().RequestsPerSecond),
+		failures: NewSMSFailureTracker(),
+		length:   DefaultSMSLengthPolicy(),
 	}
 }
 
-func (s *SMSService) SendSMS(to, message string) error {
-	data := url.Values{}
-	data.Set("username", s.username)
-	data.Set("to", s.formatPhoneNumber(to))
-	data.Set("message", message)
-	if s.senderId != "" {
-		data.Set("from", s.senderId)
+// WithHTTPClient replaces the default provider client, e.g. to tune timeouts
+func (s *SMSService) WithHTTPClient(client *ResilientClient) *SMSService {
+	s.client = client
+	return s
+}
+
+// WithTransport sends provider requests through transport, e.g. to answer
+// them in tests
+func (s *SMSService) WithTransport(transport http.RoundTripper) *SMSService {
+	s.client.WithTransport(transport)
+	return s
+}
+
+// WithLengthPolicy limits how many segments a message may take and sets
+// the cost estimated for each
+func (s *SMSService) WithLengthPolicy(policy SMSLengthPolicy) *SMSService {
+	s.length = policy
+	return s
+}
+
+// WithMessageLog stores every message the provider accepts as an outbound
+// SMSMessage, with its encoding, segments and estimated cost
+func (s *SMSService) WithMessageLog(db *gorm.DB) *SMSService {
+	s.messages = db
+	return s
+}
+
+// LogsMessages reports whether sent messages are stored, see WithMessageLog
+func (s *SMSService) LogsMessages() bool {
+	return s.messages != nil
+}
+
+// SMSEnvironmentFromEnv reads SMS_ENVIRONMENT, defaulting to the sandbox so
+// a missing or mistyped value never sends real messages
+func SMSEnvironmentFromEnv() string {
+	environment := strings.ToLower(strings.TrimSpace(os.Getenv("SMS_ENVIRONMENT")))
+	if environment == "" {
+		return SMSEnvironmentSandbox
+	}
+	if _, ok := smsEndpoints[environment]; !ok {
+		log.Printf("unknown SMS_ENVIRONMENT %q, using sandbox", environment)
+		return SMSEnvironmentSandbox
 	}
+	return environment
+}
 
-	req, err := http.NewRequest("POST", s.baseUrl, strings.NewReader(data.Encode()))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+// WithEnvironment sends through the sandbox or live endpoint. Unknown
+// environments leave the endpoint as it is.
+func (s *SMSService) WithEnvironment(environment string) *SMSService {
+	if endpoint, ok := smsEndpoints[environment]; ok {
+		s.baseUrl = endpoint
 	}
+	return s
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("apikey", s.apiKey) // ✅ lowercase per AT docs
+// WithEndpoint sends to a messaging endpoint other than Africa's Talking's
+// own, e.g. a fakeat server in tests
+func (s *SMSService) WithEndpoint(endpoint string) *SMSService {
+	s.baseUrl = endpoint
+	return s
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+// Failures counts the messages sent and why others failed
+func (s *SMSService) Failures() *SMSFailureTracker {
+	return s.failures
+}
 
-	bodyBytes, _ := io.ReadAll(resp.Body)
-	log.Printf("SMS API response: %s", string(bodyBytes))
+// Health reports whether Africa's Talking is currently reachable
+func (s *SMSService) Health() ProviderHealth {
+	return s.client.Health()
+}
 
-	var smsResponse SMSResponse
-	if err := json.Unmarshal(bodyBytes, &smsResponse); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+func (s *SMSService) SendSMS(ctx context.Context, to, message string) error {
+	message, size := s.length.Apply(message)
+	smsResponse, err := s.send(ctx, s.formatPhoneNumber(to), message)
+	if err != nil {
+		s.recordError(ctx, err, 1)
+		return err
 	}
 
 	if len(smsResponse.SMSMessageData.Recipients) == 0 {
+		s.failures.RecordFailure(SMSFailureOther, 1)
 		return fmt.Errorf("no recipients in response")
 	}
 
 	recipient := smsResponse.SMSMessageData.Recipients[0]
-	if recipient.StatusCode != 101 && recipient.StatusCode != 102 {
+	s.record(recipient)
+	if !recipient.Sent() {
 		return fmt.Errorf("SMS failed to send: %s (code: %d)", recipient.Status, recipient.StatusCode)
 	}
 
+	s.logSent(ctx, []SMSRecipient{recipient}, message, size)
 	return nil
 }
 
-func (s *SMSService) SendBulkSMS(recipients []string, message string) error {
-	to := strings.Join(s.formatPhoneNumbers(recipients), ",")
+// logSent stores the messages the provider accepted. They have been sent
+// by now, so failing to store them is only logged.
+func (s *SMSService) logSent(ctx context.Context, recipients []SMSRecipient, message string, size SMSSize) {
+	if s.messages == nil || len(recipients) == 0 {
+		return
+	}
+	// stored even if the caller has gone, as the messages were sent
+	db := s.messages.WithContext(context.WithoutCancel(ctx))
+
+	phones := make([]string, len(recipients))
+	for i, recipient := range recipients {
+		phones[i] = recipient.Number
+	}
+	messages, err := outboundSMSMessages(db, phones, message, size, s.length.Cost(size))
+	if err == nil {
+		for i, recipient := range recipients {
+			if recipient.MessageId != "" {
+				id := recipient.MessageId
+				messages[i].ProviderMessageID = &id
+			}
+		}
+		err = db.Create(&messages).Error
+	}
+	if err != nil {
+		log.Printf("failed to store %d sent text messages: %v", len(recipients), err)
+	}
+}
+
+// send makes one provider request to a comma separated list of formatted
+// numbers, waiting for the rate limiter first
+func (s *SMSService) send(ctx context.Context, to, message string) (SMSResponse, error) {
+	var smsResponse SMSResponse
+
+	if err := s.limiter.Wait(ctx); err != nil {
+		return smsResponse, err
+	}
 
 	data := url.Values{}
 	data.Set("username", s.username)
@@ -95,44 +218,59 @@ func (s *SMSService) SendBulkSMS(recipients []string, message string) error {
 		data.Set("from", s.senderId)
 	}
 
-	req, err := http.NewRequest("POST", s.baseUrl, strings.NewReader(data.Encode()))
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseUrl, strings.NewReader(data.Encode()))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return smsResponse, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
-	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("apikey", s.apiKey) // ✅ lowercase per AT docs
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return smsResponse, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return smsResponse, ErrSMSThrottled
+	}
+
 	bodyBytes, _ := io.ReadAll(resp.Body)
-	log.Printf("Bulk SMS API response: %s", string(bodyBytes))
+	log.Printf("SMS API response: %s", string(bodyBytes))
 
-	var smsResponse SMSResponse
 	if err := json.Unmarshal(bodyBytes, &smsResponse); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+		return smsResponse, fmt.Errorf("failed to decode response: %w", err)
 	}
+	return smsResponse, nil
+}
 
-	successCount := 0
-	for _, recipient := range smsResponse.SMSMessageData.Recipients {
-		if recipient.StatusCode == 101 || recipient.StatusCode == 102 {
-			successCount++
-		}
+// record counts a recipient's outcome
+func (s *SMSService) record(recipient SMSRecipient) {
+	if recipient.Sent() {
+		s.failures.RecordSent(1)
+		return
 	}
+	s.failures.RecordFailure(SMSFailureReason(recipient.StatusCode), 1)
+}
 
-	if successCount == 0 {
-		return fmt.Errorf("failed to send sms to any recipient")
+// recordError counts n messages of a request that failed as a whole. A
+// caller giving up says nothing about the provider, so it is not counted.
+func (s *SMSService) recordError(ctx context.Context, err error, n int) {
+	if ctx.Err() != nil {
+		return
 	}
-	return nil
+	s.failures.RecordFailure(smsFailureErrorReason(err), n)
 }
 
 func (s *SMSService) formatPhoneNumber(phone string) string {
+	return formatPhoneNumber(phone)
+}
+
+// formatPhoneNumber puts a Kenyan number the way the provider takes it,
+// e.g. 0740 827150 as +254740827150
+func formatPhoneNumber(phone string) string {
 	phone = strings.ReplaceAll(phone, " ", "")
 	phone = strings.ReplaceAll(phone, "-", "")
 	phone = strings.ReplaceAll(phone, "(", "")
@@ -170,14 +308,16 @@ func NewMockSMSService() *MockSMSService {
 	}
 }
 
-func (m *MockSMSService) SendSMS(to, message string) error {
+func (m *MockSMSService) SendSMS(ctx context.Context, to, message string) error {
 	m.SentMessages = append(m.SentMessages, MockSMSMessage{To: to, Message: message})
 	return nil
 }
 
-func (m *MockSMSService) SendBulkSMS(recipients []string, message string) error {
+func (m *MockSMSService) SendBulkSMS(ctx context.Context, recipients []string, message string) (BulkSMSResult, error) {
+	result := BulkSMSResult{Recipients: make([]RecipientResult, 0, len(recipients))}
 	for _, recipient := range recipients {
 		m.SentMessages = append(m.SentMessages, MockSMSMessage{To: recipient, Message: message})
+		result.Recipients = append(result.Recipients, RecipientResult{Phone: recipient, Sent: true, Status: "Success"})
 	}
-	return nil
+	return result, nil
 }
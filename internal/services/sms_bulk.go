@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BulkSMSConfig controls how SendBulkSMS splits and paces provider requests
+type BulkSMSConfig struct {
+	// BatchSize caps the recipients of one provider request
+	BatchSize int
+	// Workers is how many batches are in flight at once
+	Workers int
+	// RequestsPerSecond caps provider requests made by the service, single
+	// and bulk sends alike
+	RequestsPerSecond float64
+}
+
+func DefaultBulkSMSConfig() BulkSMSConfig {
+	return BulkSMSConfig{
+		BatchSize:         100,
+		Workers:           4,
+		RequestsPerSecond: 10,
+	}
+}
+
+// BulkSMSConfigFromEnv reads SMS_BULK_BATCH_SIZE, SMS_BULK_WORKERS and
+// SMS_RATE_LIMIT (requests per second) over the defaults
+func BulkSMSConfigFromEnv() BulkSMSConfig {
+	cfg := DefaultBulkSMSConfig()
+
+	if n, err := strconv.Atoi(os.Getenv("SMS_BULK_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SMS_BULK_WORKERS")); err == nil && n > 0 {
+		cfg.Workers = n
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("SMS_RATE_LIMIT"), 64); err == nil && f > 0 {
+		cfg.RequestsPerSecond = f
+	}
+	return cfg
+}
+
+// WithBulkConfig replaces the default batching and rate limit
+func (s *SMSService) WithBulkConfig(cfg BulkSMSConfig) *SMSService {
+	defaults := DefaultBulkSMSConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaults.BatchSize
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaults.Workers
+	}
+	if cfg.RequestsPerSecond <= 0 {
+		cfg.RequestsPerSecond = defaults.RequestsPerSecond
+	}
+
+	s.bulk = cfg
+	s.limiter = newRateLimiter(cfg.RequestsPerSecond)
+	return s
+}
+
+// RecipientResult is the outcome of a bulk send for one recipient
+type RecipientResult struct {
+	Phone      string `json:"phone"`
+	Sent       bool   `json:"sent"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code,omitempty"`
+	MessageID  string `json:"message_id,omitempty"`
+	Cost       string `json:"cost,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BulkSMSResult lists one result per distinct recipient, in the order given
+type BulkSMSResult struct {
+	Recipients []RecipientResult `json:"recipients"`
+}
+
+func (r BulkSMSResult) SentCount() int {
+	sent := 0
+	for _, recipient := range r.Recipients {
+		if recipient.Sent {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Failed returns the recipients that were not sent to
+func (r BulkSMSResult) Failed() []RecipientResult {
+	var failed []RecipientResult
+	for _, recipient := range r.Recipients {
+		if !recipient.Sent {
+			failed = append(failed, recipient)
+		}
+	}
+	return failed
+}
+
+// SendBulkSMS sends message to every recipient, BatchSize numbers per
+// provider request with up to Workers requests in flight. A failed batch
+// does not stop the others; it is reported per recipient in the result.
+func (s *SMSService) SendBulkSMS(ctx context.Context, recipients []string, message string) (BulkSMSResult, error) {
+	phones := uniquePhones(s.formatPhoneNumbers(recipients))
+	result := BulkSMSResult{Recipients: make([]RecipientResult, len(phones))}
+	if len(phones) == 0 {
+		return result, fmt.Errorf("no recipients")
+	}
+	message, size := s.length.Apply(message)
+
+	batchSize := s.bulk.BatchSize
+	batches := make(chan int)
+	workers := min(s.bulk.Workers, (len(phones)+batchSize-1)/batchSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				end := min(start+batchSize, len(phones))
+				// each batch fills its own part of the results
+				s.sendBatch(ctx, phones[start:end], message, size, result.Recipients[start:end])
+			}
+		}()
+	}
+
+	for start := 0; start < len(phones); start += batchSize {
+		batches <- start
+	}
+	close(batches)
+	wg.Wait()
+
+	if result.SentCount() == 0 {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		return result, fmt.Errorf("failed to send sms to any recipient")
+	}
+	return result, nil
+}
+
+func (s *SMSService) sendBatch(ctx context.Context, phones []string, message string, size SMSSize, results []RecipientResult) {
+	for i, phone := range phones {
+		results[i] = RecipientResult{Phone: phone, Status: "Failed"}
+	}
+
+	smsResponse, err := s.send(ctx, strings.Join(phones, ","), message)
+	if err != nil {
+		s.recordError(ctx, err, len(phones))
+		for i := range results {
+			results[i].Error = err.Error()
+		}
+		return
+	}
+
+	byNumber := make(map[string]SMSRecipient, len(smsResponse.SMSMessageData.Recipients))
+	for _, recipient := range smsResponse.SMSMessageData.Recipients {
+		byNumber[recipient.Number] = recipient
+	}
+
+	var sent []SMSRecipient
+	for i := range results {
+		recipient, ok := byNumber[results[i].Phone]
+		if !ok {
+			s.failures.RecordFailure(SMSFailureOther, 1)
+			results[i].Error = "missing from provider response"
+			continue
+		}
+		s.record(recipient)
+
+		results[i].Sent = recipient.Sent()
+		results[i].Status = recipient.Status
+		results[i].StatusCode = recipient.StatusCode
+		results[i].MessageID = recipient.MessageId
+		results[i].Cost = recipient.Cost
+		if !results[i].Sent {
+			results[i].Error = fmt.Sprintf("%s (code: %d)", recipient.Status, recipient.StatusCode)
+			continue
+		}
+		sent = append(sent, recipient)
+	}
+	s.logSent(ctx, sent, message, size)
+}
+
+func uniquePhones(phones []string) []string {
+	seen := make(map[string]bool, len(phones))
+	unique := make([]string, 0, len(phones))
+	for _, phone := range phones {
+		if !seen[phone] {
+			seen[phone] = true
+			unique = append(unique, phone)
+		}
+	}
+	return unique
+}
+
+// rateLimiter spaces calls at least interval apart, across goroutines
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func newRateLimiter(perSecond float64) *rateLimiter {
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Wait blocks until the caller's turn, or until ctx is done
+func (l *rateLimiter) Wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := at.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkResponder answers like Africa's Talking, rejecting the numbers in
+// invalid and failing whole requests that include a number in down
+func bulkResponder(calls *int32, invalid, down map[string]bool) httpmock.Responder {
+	return func(req *http.Request) (*http.Response, error) {
+		atomic.AddInt32(calls, 1)
+		req.ParseForm()
+
+		var recipients []string
+		for _, number := range strings.Split(req.PostForm.Get("to"), ",") {
+			if down[number] {
+				return httpmock.NewStringResponse(http.StatusBadRequest, `{"SMSMessageData":{"Message":"bad request","Recipients":[]}}`), nil
+			}
+			status, code := "Success", 101
+			if invalid[number] {
+				status, code = "InvalidPhoneNumber", 403
+			}
+			recipients = append(recipients, fmt.Sprintf(`{"statusCode":%d,"number":"%s","status":"%s","cost":"KES 0.80","messageId":"ATXid_%s"}`,
+				code, number, status, number))
+		}
+		return httpmock.NewStringResponse(http.StatusCreated,
+			`{"SMSMessageData":{"Message":"Sent","Recipients":[`+strings.Join(recipients, ",")+`]}}`), nil
+	}
+}
+
+func TestSendBulkSMS(t *testing.T) {
+	recipients := []string{"0700000001", "0700000002", "0700000003", "0700000004", "0700000005", "0700000001"}
+
+	tests := []struct {
+		name          string
+		invalid       map[string]bool
+		down          map[string]bool
+		expectedCalls int32
+		expectedSent  int
+		expectedError string
+	}{
+		{
+			name:          "all sent in batches",
+			expectedCalls: 3,
+			expectedSent:  5,
+		},
+		{
+			name:          "invalid number reported per recipient",
+			invalid:       map[string]bool{"+254700000004": true},
+			expectedCalls: 3,
+			expectedSent:  4,
+		},
+		{
+			name:          "failed batch does not stop the others",
+			down:          map[string]bool{"+254700000001": true},
+			expectedCalls: 3,
+			expectedSent:  3,
+		},
+		{
+			name:          "nothing sent",
+			invalid:       map[string]bool{"+254700000001": true, "+254700000002": true, "+254700000003": true, "+254700000004": true, "+254700000005": true},
+			expectedCalls: 3,
+			expectedError: "failed to send sms to any recipient",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smsService := NewSMSService("testuser", "testapikey", "testsender").
+				WithBulkConfig(BulkSMSConfig{BatchSize: 2, Workers: 2, RequestsPerSecond: 1000}).
+				WithTransport(httpmock.DefaultTransport)
+			httpmock.Activate()
+			defer httpmock.DeactivateAndReset()
+
+			var calls int32
+			httpmock.RegisterResponder("POST", smsService.baseUrl, bulkResponder(&calls, tt.invalid, tt.down))
+
+			result, err := smsService.SendBulkSMS(context.Background(), recipients, "Test message")
+
+			assert.Equal(t, tt.expectedCalls, atomic.LoadInt32(&calls))
+			assert.Equal(t, tt.expectedSent, result.SentCount())
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			// one result per distinct recipient, in the order given
+			assert.Len(t, result.Recipients, 5)
+			for i, recipient := range result.Recipients {
+				assert.Equal(t, fmt.Sprintf("+25470000000%d", i+1), recipient.Phone)
+				switch {
+				case tt.invalid[recipient.Phone]:
+					assert.False(t, recipient.Sent)
+					assert.Equal(t, 403, recipient.StatusCode)
+				case tt.down[recipient.Phone]:
+					assert.False(t, recipient.Sent)
+					assert.NotEmpty(t, recipient.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(20)
+
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, limiter.Wait(context.Background()))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, limiter.Wait(ctx), context.Canceled)
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// DryRunSMSService stands in for the provider on staging: every message is
+// logged and stored as an outbound SMSMessage marked dry_run, and reported
+// as sent, but nothing leaves the server.
+type DryRunSMSService struct {
+	db     *gorm.DB
+	length SMSLengthPolicy
+}
+
+func NewDryRunSMSService(db *gorm.DB) *DryRunSMSService {
+	return &DryRunSMSService{db: db, length: DefaultSMSLengthPolicy()}
+}
+
+// WithLengthPolicy limits and prices messages as the live service would
+func (s *DryRunSMSService) WithLengthPolicy(policy SMSLengthPolicy) *DryRunSMSService {
+	s.length = policy
+	return s
+}
+
+// LogsMessages is always true, as storing them is all the service does
+func (s *DryRunSMSService) LogsMessages() bool {
+	return true
+}
+
+func (s *DryRunSMSService) SendSMS(ctx context.Context, to, message string) error {
+	return s.record(ctx, to, message)
+}
+
+func (s *DryRunSMSService) SendBulkSMS(ctx context.Context, recipients []string, message string) (BulkSMSResult, error) {
+	phones := uniquePhones(recipients)
+	result := BulkSMSResult{Recipients: make([]RecipientResult, 0, len(phones))}
+	if len(phones) == 0 {
+		return result, fmt.Errorf("no recipients")
+	}
+
+	for _, phone := range phones {
+		recipient := RecipientResult{Phone: phone, Sent: true, Status: "DryRun"}
+		if err := s.record(ctx, phone, message); err != nil {
+			recipient = RecipientResult{Phone: phone, Status: "Failed", Error: err.Error()}
+		}
+		result.Recipients = append(result.Recipients, recipient)
+	}
+
+	if result.SentCount() == 0 {
+		return result, fmt.Errorf("failed to record any message")
+	}
+	return result, nil
+}
+
+func (s *DryRunSMSService) record(ctx context.Context, to, text string) error {
+	text, size := s.length.Apply(text)
+	log.Printf("SMS dry run, not sending to %s (%d %s segments): %s", to, size.Segments, size.Encoding, text)
+
+	messages, err := outboundSMSMessages(s.db.WithContext(ctx), []string{to}, text, size, s.length.Cost(size))
+	if err != nil {
+		return fmt.Errorf("failed to record dry run message: %w", err)
+	}
+	messages[0].DryRun = true
+
+	if err := s.db.WithContext(ctx).Create(&messages).Error; err != nil {
+		return fmt.Errorf("failed to record dry run message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// SMS failure reasons. Most come from the recipient status codes Africa's
+// Talking returns; the last three cover requests that got no per-recipient
+// answer.
+const (
+	SMSFailureRiskHold            = "risk_hold"
+	SMSFailureInvalidSenderID     = "invalid_sender_id"
+	SMSFailureInvalidNumber       = "invalid_number"
+	SMSFailureUnsupportedNumber   = "unsupported_number"
+	SMSFailureInsufficientBalance = "insufficient_balance"
+	SMSFailureBlacklisted         = "blacklisted"
+	SMSFailureCouldNotRoute       = "could_not_route"
+	SMSFailureDoNotDisturb        = "do_not_disturb"
+	SMSFailureProviderError       = "provider_error"
+	SMSFailureGatewayError        = "gateway_error"
+	SMSFailureRejectedByGateway   = "rejected_by_gateway"
+	SMSFailureThrottled           = "throttled"
+	SMSFailureRequestFailed       = "request_failed"
+	SMSFailureOther               = "other"
+)
+
+var smsFailureReasons = map[int]string{
+	401: SMSFailureRiskHold,
+	402: SMSFailureInvalidSenderID,
+	403: SMSFailureInvalidNumber,
+	404: SMSFailureUnsupportedNumber,
+	405: SMSFailureInsufficientBalance,
+	406: SMSFailureBlacklisted,
+	407: SMSFailureCouldNotRoute,
+	409: SMSFailureDoNotDisturb,
+	500: SMSFailureProviderError,
+	501: SMSFailureGatewayError,
+	502: SMSFailureRejectedByGateway,
+}
+
+// SMSFailureReason names the failure behind a recipient status code
+func SMSFailureReason(statusCode int) string {
+	if reason, ok := smsFailureReasons[statusCode]; ok {
+		return reason
+	}
+	return SMSFailureOther
+}
+
+// smsFailureErrorReason names the failure of a request that failed as a
+// whole
+func smsFailureErrorReason(err error) string {
+	if errors.Is(err, ErrSMSThrottled) {
+		return SMSFailureThrottled
+	}
+	return SMSFailureRequestFailed
+}
+
+// MaxSMSFailureWindow is the longest window failures are reported over
+const MaxSMSFailureWindow = 24 * time.Hour
+
+const smsFailureSlots = int(MaxSMSFailureWindow / time.Minute)
+
+type smsFailureSlot struct {
+	sent     int64
+	failures map[string]int64
+}
+
+// SMSFailureTracker counts text messages sent and failed, by failure
+// reason, per minute over the last day. Counts are kept in memory, so each
+// instance reports on the messages it sent.
+type SMSFailureTracker struct {
+	mu         sync.Mutex
+	slots      [smsFailureSlots]smsFailureSlot
+	slotMinute [smsFailureSlots]int64
+	now        func() time.Time
+}
+
+func NewSMSFailureTracker() *SMSFailureTracker {
+	return &SMSFailureTracker{now: time.Now}
+}
+
+// WithClock replaces time.Now, for tests
+func (t *SMSFailureTracker) WithClock(now func() time.Time) *SMSFailureTracker {
+	t.now = now
+	return t
+}
+
+// RecordSent counts n messages the provider accepted
+func (t *SMSFailureTracker) RecordSent(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.slot().sent += int64(n)
+}
+
+// RecordFailure counts n messages that failed for reason
+func (t *SMSFailureTracker) RecordFailure(reason string, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slot := t.slot()
+	if slot.failures == nil {
+		slot.failures = make(map[string]int64)
+	}
+	slot.failures[reason] += int64(n)
+}
+
+// slot returns the current minute's slot, clearing it first when it last
+// held an older minute
+func (t *SMSFailureTracker) slot() *smsFailureSlot {
+	minute := t.now().Unix() / 60
+	i := minute % int64(smsFailureSlots)
+	if t.slotMinute[i] != minute {
+		t.slots[i] = smsFailureSlot{}
+		t.slotMinute[i] = minute
+	}
+	return &t.slots[i]
+}
+
+// Report sums the last window, capped at MaxSMSFailureWindow
+func (t *SMSFailureTracker) Report(window time.Duration) models.SMSFailureReport {
+	if window <= 0 || window > MaxSMSFailureWindow {
+		window = MaxSMSFailureWindow
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	report := models.SMSFailureReport{Window: formatWindow(window), Since: now.Add(-window), Reasons: []models.SMSFailureReason{}}
+	failures := map[string]int64{}
+	minute := now.Unix() / 60
+	for m := minute - int64(window/time.Minute) + 1; m <= minute; m++ {
+		i := m % int64(smsFailureSlots)
+		if t.slotMinute[i] != m {
+			continue
+		}
+		report.Sent += t.slots[i].sent
+		for reason, count := range t.slots[i].failures {
+			failures[reason] += count
+			report.Failed += count
+		}
+	}
+
+	report.Messages = report.Sent + report.Failed
+	if report.Messages > 0 {
+		report.FailureRate = float64(report.Failed) / float64(report.Messages)
+	}
+	for reason, count := range failures {
+		report.Reasons = append(report.Reasons, models.SMSFailureReason{
+			Reason: reason,
+			Count:  count,
+			Share:  float64(count) / float64(report.Failed),
+		})
+	}
+	sort.Slice(report.Reasons, func(i, j int) bool {
+		if report.Reasons[i].Count != report.Reasons[j].Count {
+			return report.Reasons[i].Count > report.Reasons[j].Count
+		}
+		return report.Reasons[i].Reason < report.Reasons[j].Reason
+	})
+	return report
+}
+
+// SMSFailureAlertPolicy sets when a high SMS failure rate is alerted
+type SMSFailureAlertPolicy struct {
+	// Rate is the share of failed messages over Window that raises an alert
+	Rate   float64
+	Window time.Duration
+	// MinMessages keeps a handful of failures on a quiet day from alerting
+	MinMessages int64
+}
+
+func DefaultSMSFailureAlertPolicy() SMSFailureAlertPolicy {
+	return SMSFailureAlertPolicy{
+		Rate:        0.2,
+		Window:      15 * time.Minute,
+		MinMessages: 20,
+	}
+}
+
+// SMSFailureAlertPolicyFromEnv reads SMS_FAILURE_ALERT_RATE,
+// SMS_FAILURE_ALERT_WINDOW and SMS_FAILURE_ALERT_MIN_MESSAGES over the
+// defaults
+func SMSFailureAlertPolicyFromEnv() SMSFailureAlertPolicy {
+	policy := DefaultSMSFailureAlertPolicy()
+
+	if f, err := strconv.ParseFloat(os.Getenv("SMS_FAILURE_ALERT_RATE"), 64); err == nil && f > 0 && f <= 1 {
+		policy.Rate = f
+	}
+	if d, err := time.ParseDuration(os.Getenv("SMS_FAILURE_ALERT_WINDOW")); err == nil && d >= time.Minute && d <= MaxSMSFailureWindow {
+		policy.Window = d
+	}
+	if n, err := strconv.ParseInt(os.Getenv("SMS_FAILURE_ALERT_MIN_MESSAGES"), 10, 64); err == nil && n > 0 {
+		policy.MinMessages = n
+	}
+	return policy
+}
+
+// SMSFailureAlerter alerts admins when too many text messages fail, with
+// the reasons why. An alert is raised at most once per window.
+type SMSFailureAlerter struct {
+	tracker     *SMSFailureTracker
+	sms         SMSServiceInterface
+	alertPhones []string
+	policy      SMSFailureAlertPolicy
+	lastAlert   time.Time
+}
+
+// NewSMSFailureAlerter builds the alerter. With no alertPhones alerts are
+// only logged.
+func NewSMSFailureAlerter(tracker *SMSFailureTracker, sms SMSServiceInterface, alertPhones []string, policy SMSFailureAlertPolicy) *SMSFailureAlerter {
+	defaults := DefaultSMSFailureAlertPolicy()
+	if policy.Rate <= 0 {
+		policy.Rate = defaults.Rate
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaults.Window
+	}
+	if policy.MinMessages <= 0 {
+		policy.MinMessages = defaults.MinMessages
+	}
+	return &SMSFailureAlerter{tracker: tracker, sms: sms, alertPhones: alertPhones, policy: policy}
+}
+
+// Check alerts when the failure rate over the window is at or above the
+// policy's, and reports whether it did
+func (a *SMSFailureAlerter) Check(ctx context.Context) (bool, error) {
+	report := a.tracker.Report(a.policy.Window)
+	if report.Messages < a.policy.MinMessages || report.FailureRate < a.policy.Rate {
+		return false, nil
+	}
+	now := a.tracker.now()
+	if !a.lastAlert.IsZero() && now.Sub(a.lastAlert) < a.policy.Window {
+		return false, nil
+	}
+	a.lastAlert = now
+
+	message := SMSFailureAlertMessage(report)
+	log.Print(message)
+	if len(a.alertPhones) == 0 {
+		return true, nil
+	}
+	// when the balance has run out this cannot be delivered either; the log
+	// line above still records it
+	if _, err := a.sms.SendBulkSMS(ctx, a.alertPhones, message); err != nil {
+		return true, fmt.Errorf("failed to send sms failure alert: %w", err)
+	}
+	return true, nil
+}
+
+// SMSFailureAlertMessage describes a report's failure rate and its top
+// reasons
+func SMSFailureAlertMessage(report models.SMSFailureReport) string {
+	reasons := make([]string, 0, 3)
+	for i, reason := range report.Reasons {
+		if i == 3 {
+			break
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %d", reason.Reason, reason.Count))
+	}
+	return fmt.Sprintf("sms alert: %d of %d messages (%.0f%%) failed in the last %s: %s",
+		report.Failed, report.Messages, report.FailureRate*100, report.Window, strings.Join(reasons, ", "))
+}
+
+// formatWindow writes a duration without trailing zero units, e.g. 15m
+func formatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/fakeat"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSMSFailureTrackerReport(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewSMSFailureTracker().WithClock(func() time.Time { return now })
+
+	tracker.RecordSent(6)
+	tracker.RecordFailure(SMSFailureInvalidNumber, 1)
+	now = now.Add(-2 * time.Hour)
+	tracker.RecordFailure(SMSFailureInsufficientBalance, 5)
+	now = now.Add(2*time.Hour + 30*time.Second)
+	tracker.RecordFailure(SMSFailureInsufficientBalance, 2)
+
+	report := tracker.Report(time.Hour)
+	assert.Equal(t, "1h", report.Window)
+	assert.Equal(t, int64(9), report.Messages)
+	assert.Equal(t, int64(6), report.Sent)
+	assert.Equal(t, int64(3), report.Failed)
+	assert.InDelta(t, 1.0/3, report.FailureRate, 0.0001)
+	assert.Equal(t, []models.SMSFailureReason{
+		{Reason: SMSFailureInsufficientBalance, Count: 2, Share: 2.0 / 3},
+		{Reason: SMSFailureInvalidNumber, Count: 1, Share: 1.0 / 3},
+	}, report.Reasons)
+
+	report = tracker.Report(0)
+	assert.Equal(t, "24h", report.Window)
+	assert.Equal(t, int64(8), report.Failed)
+
+	// counts older than a day are dropped
+	now = now.Add(25 * time.Hour)
+	assert.Zero(t, tracker.Report(0).Messages)
+}
+
+func TestSMSServiceRecordsFailures(t *testing.T) {
+	sms, at := newFakeATService(t)
+	at.RejectNumber("+254740000002", fakeat.StatusInsufficientBalance)
+	at.RejectNumber("+254740000003", fakeat.StatusUserInBlacklist)
+
+	_, err := sms.SendBulkSMS(context.Background(), []string{"0740000001", "0740000002", "0740000003", "0740000004"}, "Flash sale today")
+	require.NoError(t, err)
+	at.FailRequests(1, http.StatusTooManyRequests)
+	assert.ErrorIs(t, sms.SendSMS(context.Background(), "0740000001", "Your order has been confirmed"), ErrSMSThrottled)
+	assert.Error(t, sms.SendSMS(context.Background(), "0740000003", "Your order has been confirmed"))
+
+	report := sms.Failures().Report(time.Hour)
+	assert.Equal(t, int64(6), report.Messages)
+	assert.Equal(t, int64(2), report.Sent)
+	reasons := map[string]int64{}
+	for _, reason := range report.Reasons {
+		reasons[reason.Reason] = reason.Count
+	}
+	assert.Equal(t, map[string]int64{
+		SMSFailureBlacklisted:         2,
+		SMSFailureInsufficientBalance: 1,
+		SMSFailureThrottled:           1,
+	}, reasons)
+}
+
+func TestSMSFailureAlerter(t *testing.T) {
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewSMSFailureTracker().WithClock(func() time.Time { return now })
+	sms := NewMockSMSService()
+	alerter := NewSMSFailureAlerter(tracker, sms, []string{"+254700000001"}, SMSFailureAlertPolicy{Rate: 0.25, Window: 15 * time.Minute, MinMessages: 10})
+
+	// too few messages to judge
+	tracker.RecordFailure(SMSFailureInsufficientBalance, 5)
+	alerted, err := alerter.Check(context.Background())
+	require.NoError(t, err)
+	assert.False(t, alerted)
+
+	tracker.RecordSent(10)
+	tracker.RecordFailure(SMSFailureInvalidNumber, 1)
+	alerted, err = alerter.Check(context.Background())
+	require.NoError(t, err)
+	assert.True(t, alerted)
+	if assert.Len(t, sms.SentMessages, 1) {
+		assert.Equal(t, "sms alert: 6 of 16 messages (38%) failed in the last 15m: insufficient_balance 5, invalid_number 1", sms.SentMessages[0].Message)
+	}
+
+	// one alert per window
+	now = now.Add(5 * time.Minute)
+	alerted, _ = alerter.Check(context.Background())
+	assert.False(t, alerted)
+
+	// the failures have aged out of the window
+	now = now.Add(15 * time.Minute)
+	alerted, _ = alerter.Check(context.Background())
+	assert.False(t, alerted)
+	assert.Len(t, sms.SentMessages, 1)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/fakeat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeATService sends to a fake Africa's Talking server, retrying
+// quickly so outage tests stay fast
+func newFakeATService(t *testing.T) (*SMSService, *fakeat.Server) {
+	at := fakeat.NewServer("testuser", "testapikey")
+	t.Cleanup(at.Close)
+
+	client := NewResilientClient(HTTPClientConfig{Timeout: time.Second, MaxRetries: 2, BaseBackoff: time.Millisecond, MaxBackoff: time.Millisecond})
+	sms := NewSMSService("testuser", "testapikey", "SAVANNAH").
+		WithEndpoint(at.URL()).
+		WithHTTPClient(client).
+		WithBulkConfig(BulkSMSConfig{BatchSize: 2, Workers: 1, RequestsPerSecond: 1000})
+	return sms, at
+}
+
+func TestSendSMSFakeAT(t *testing.T) {
+	tests := []struct {
+		name             string
+		setup            func(at *fakeat.Server)
+		apiKey           string
+		expectedError    string
+		expectedErrorIs  error
+		expectedRequests int
+		expectedSent     int
+	}{
+		{
+			name:             "sent",
+			expectedRequests: 1,
+			expectedSent:     1,
+		},
+		{
+			name:             "rejected number",
+			setup:            func(at *fakeat.Server) { at.RejectNumber("+254740827150", fakeat.StatusUserInBlacklist) },
+			expectedError:    "SMS failed to send: UserInBlacklist (code: 406)",
+			expectedRequests: 1,
+		},
+		{
+			name:             "throttled",
+			setup:            func(at *fakeat.Server) { at.FailRequests(1, http.StatusTooManyRequests) },
+			expectedErrorIs:  ErrSMSThrottled,
+			expectedRequests: 1,
+		},
+		{
+			name:             "outage recovered by retry",
+			setup:            func(at *fakeat.Server) { at.FailRequests(2, http.StatusServiceUnavailable) },
+			expectedRequests: 3,
+			expectedSent:     1,
+		},
+		{
+			name:             "outage outlasting retries",
+			setup:            func(at *fakeat.Server) { at.FailRequests(3, http.StatusServiceUnavailable) },
+			expectedError:    "provider returned status 503",
+			expectedRequests: 3,
+		},
+		{
+			name:             "wrong api key",
+			apiKey:           "wrong",
+			expectedError:    "failed to decode response",
+			expectedRequests: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sms, at := newFakeATService(t)
+			if tt.setup != nil {
+				tt.setup(at)
+			}
+			if tt.apiKey != "" {
+				sms.apiKey = tt.apiKey
+			}
+
+			err := sms.SendSMS(context.Background(), "0740827150", "Your order has been confirmed")
+			switch {
+			case tt.expectedErrorIs != nil:
+				assert.ErrorIs(t, err, tt.expectedErrorIs)
+			case tt.expectedError != "":
+				assert.ErrorContains(t, err, tt.expectedError)
+			default:
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expectedRequests, at.Requests())
+			sent := 0
+			for _, message := range at.Messages() {
+				assert.Equal(t, "+254740827150", message.To)
+				assert.Equal(t, "SAVANNAH", message.From)
+				assert.Equal(t, "Your order has been confirmed", message.Text)
+				if message.StatusCode == fakeat.StatusSent {
+					sent++
+				}
+			}
+			assert.Equal(t, tt.expectedSent, sent)
+		})
+	}
+}
+
+func TestSendBulkSMSFakeAT(t *testing.T) {
+	sms, at := newFakeATService(t)
+	at.RejectNumber("+254740000004", fakeat.StatusInvalidPhoneNumber)
+	// the first batch is throttled, the others go through
+	at.FailRequests(1, http.StatusTooManyRequests)
+
+	recipients := []string{"0740000001", "0740000002", "0740000003", "0740000004", "0740000005", "0740000001"}
+	result, err := sms.SendBulkSMS(context.Background(), recipients, "Flash sale today")
+	require.NoError(t, err)
+
+	// five distinct numbers in batches of two
+	assert.Equal(t, 3, at.Requests())
+	require.Len(t, result.Recipients, 5)
+
+	throttled, rejected := 0, 0
+	for _, recipient := range result.Recipients {
+		switch {
+		case recipient.Error == ErrSMSThrottled.Error():
+			throttled++
+		case recipient.StatusCode == fakeat.StatusInvalidPhoneNumber:
+			rejected++
+			assert.False(t, recipient.Sent)
+		default:
+			assert.True(t, recipient.Sent, recipient.Phone)
+			assert.NotEmpty(t, recipient.MessageID)
+			assert.Equal(t, "KES 0.8000", recipient.Cost)
+		}
+	}
+	assert.Equal(t, 2, throttled)
+	assert.Equal(t, 1, rejected)
+	assert.Equal(t, 2, result.SentCount())
+	assert.Len(t, result.Failed(), 3)
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/pii"
+	"gorm.io/gorm"
+)
+
+// Encodings a text message can be sent in. GSM-7 fits 160 characters in a
+// single message; one character outside it switches the whole message to
+// UCS-2, which fits 70.
+const (
+	SMSEncodingGSM7 = "GSM-7"
+	SMSEncodingUCS2 = "UCS-2"
+)
+
+// characters per segment. A message longer than one segment is sent as
+// several concatenated ones, each giving up room for the header that joins
+// them, and each charged for.
+const (
+	gsm7SingleLimit = 160
+	gsm7MultiLimit  = 153
+	ucs2SingleLimit = 70
+	ucs2MultiLimit  = 67
+)
+
+const smsTruncationMark = "..."
+
+const gsm7Basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// characters sent as an escape and another character, taking two places
+const gsm7Extension = "\f^{}\\[~]|€"
+
+// SMSSize is how a message will be sent: its encoding, how many places it
+// takes in that encoding and how many segments it is charged as
+type SMSSize struct {
+	Encoding string `json:"encoding"`
+	Units    int    `json:"units"`
+	Segments int    `json:"segments"`
+}
+
+// MeasureSMS works out the encoding and segments of a message the way the
+// network will. A character is never split across two segments.
+func MeasureSMS(text string) SMSSize {
+	width := gsm7Width
+	single, multi := gsm7SingleLimit, gsm7MultiLimit
+	encoding := SMSEncodingGSM7
+	for _, r := range text {
+		if gsm7Width(r) == 0 {
+			width = ucs2Width
+			single, multi = ucs2SingleLimit, ucs2MultiLimit
+			encoding = SMSEncodingUCS2
+			break
+		}
+	}
+
+	size := SMSSize{Encoding: encoding}
+	if text == "" {
+		return size
+	}
+
+	used := 0
+	size.Segments = 1
+	for _, r := range text {
+		w := width(r)
+		size.Units += w
+		if used+w > multi {
+			size.Segments++
+			used = 0
+		}
+		used += w
+	}
+	if size.Units <= single {
+		size.Segments = 1
+	}
+	return size
+}
+
+// gsm7Width is the number of septets r takes, or 0 when GSM-7 cannot hold it
+func gsm7Width(r rune) int {
+	switch {
+	case strings.ContainsRune(gsm7Basic, r):
+		return 1
+	case strings.ContainsRune(gsm7Extension, r):
+		return 2
+	default:
+		return 0
+	}
+}
+
+// ucs2Width is the number of UTF-16 code units r takes
+func ucs2Width(r rune) int {
+	if n := utf16.RuneLen(r); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// TruncateSMS shortens text to fit in maxSegments, marking the cut with
+// "...". Text that already fits is returned as it is.
+func TruncateSMS(text string, maxSegments int) string {
+	if maxSegments <= 0 || MeasureSMS(text).Segments <= maxSegments {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimRightFunc(string(runes), unicode.IsSpace) + smsTruncationMark
+		if MeasureSMS(candidate).Segments <= maxSegments {
+			return candidate
+		}
+	}
+	return smsTruncationMark
+}
+
+// SMSLengthPolicy limits how long text messages get and prices them
+type SMSLengthPolicy struct {
+	// MaxSegments is the most segments a message should take; 0 for no limit
+	MaxSegments int
+	// Truncate cuts messages over MaxSegments down to it. Otherwise they
+	// are sent whole and logged.
+	Truncate bool
+	// CostPerSegment is what the provider charges for one segment
+	CostPerSegment models.Money
+}
+
+func DefaultSMSLengthPolicy() SMSLengthPolicy {
+	return SMSLengthPolicy{CostPerSegment: models.Shillings(0.80)}
+}
+
+// SMSLengthPolicyFromEnv reads SMS_MAX_SEGMENTS, SMS_TRUNCATE and
+// SMS_SEGMENT_COST (shillings) over the defaults
+func SMSLengthPolicyFromEnv() SMSLengthPolicy {
+	policy := DefaultSMSLengthPolicy()
+
+	if n, err := strconv.Atoi(os.Getenv("SMS_MAX_SEGMENTS")); err == nil && n >= 0 {
+		policy.MaxSegments = n
+	}
+	if b, err := strconv.ParseBool(os.Getenv("SMS_TRUNCATE")); err == nil {
+		policy.Truncate = b
+	}
+	if f, err := strconv.ParseFloat(os.Getenv("SMS_SEGMENT_COST"), 64); err == nil && f >= 0 {
+		policy.CostPerSegment = models.Shillings(f)
+	}
+	return policy
+}
+
+// Fits reports whether text is within MaxSegments
+func (p SMSLengthPolicy) Fits(text string) bool {
+	return p.MaxSegments <= 0 || MeasureSMS(text).Segments <= p.MaxSegments
+}
+
+// Choose returns the first of the templates, longest first, that fits, or
+// the last when none does
+func (p SMSLengthPolicy) Choose(templates ...string) string {
+	for _, text := range templates {
+		if p.Fits(text) {
+			return text
+		}
+	}
+	if len(templates) == 0 {
+		return ""
+	}
+	return templates[len(templates)-1]
+}
+
+// Apply returns text as it should be sent, truncated when the policy says
+// so, and its size
+func (p SMSLengthPolicy) Apply(text string) (string, SMSSize) {
+	size := MeasureSMS(text)
+	if p.MaxSegments > 0 && size.Segments > p.MaxSegments {
+		if !p.Truncate {
+			log.Printf("SMS is %d %s segments, over the limit of %d", size.Segments, size.Encoding, p.MaxSegments)
+			return text, size
+		}
+		text = TruncateSMS(text, p.MaxSegments)
+		size = MeasureSMS(text)
+	}
+	return text, size
+}
+
+// Cost estimates what sending a message of size to one recipient costs
+func (p SMSLengthPolicy) Cost(size SMSSize) models.Money {
+	return p.CostPerSegment.Times(size.Segments)
+}
+
+// outboundSMSMessages builds the stored copies of a message sent to phones,
+// linked to the customers they belong to so anonymizing a customer also
+// clears theirs
+func outboundSMSMessages(db *gorm.DB, phones []string, text string, size SMSSize, cost models.Money) ([]models.SMSMessage, error) {
+	messages := make([]models.SMSMessage, len(phones))
+	hashes := make([]string, len(phones))
+	for i, phone := range phones {
+		hashes[i] = pii.BlindIndex(phone)
+		messages[i] = models.SMSMessage{
+			Direction:     models.SMSDirectionOutbound,
+			Phone:         phone,
+			Body:          text,
+			Encoding:      size.Encoding,
+			Segments:      size.Segments,
+			EstimatedCost: cost,
+		}
+	}
+
+	var customers []models.Customer
+	if err := db.Select("id", "phone_hash").Where("phone_hash IN ?", hashes).Find(&customers).Error; err != nil {
+		return nil, err
+	}
+	byHash := make(map[string]uint, len(customers))
+	for _, customer := range customers {
+		byHash[customer.PhoneHash] = customer.ID
+	}
+	for i := range messages {
+		if id, ok := byHash[hashes[i]]; ok {
+			messages[i].CustomerID = &id
+		}
+	}
+	return messages, nil
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMeasureSMS(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected SMSSize
+	}{
+		{name: "empty", text: "", expected: SMSSize{Encoding: SMSEncodingGSM7}},
+		{name: "one gsm segment", text: strings.Repeat("a", 160), expected: SMSSize{Encoding: SMSEncodingGSM7, Units: 160, Segments: 1}},
+		{name: "two gsm segments", text: strings.Repeat("a", 161), expected: SMSSize{Encoding: SMSEncodingGSM7, Units: 161, Segments: 2}},
+		{name: "three gsm segments", text: strings.Repeat("a", 307), expected: SMSSize{Encoding: SMSEncodingGSM7, Units: 307, Segments: 3}},
+		{name: "extension characters take two", text: strings.Repeat("€", 80), expected: SMSSize{Encoding: SMSEncodingGSM7, Units: 160, Segments: 1}},
+		// 152 septets then a two septet character, which moves to the next segment
+		{name: "extension character not split", text: strings.Repeat("a", 152) + "{" + strings.Repeat("a", 10), expected: SMSSize{Encoding: SMSEncodingGSM7, Units: 164, Segments: 2}},
+		{name: "one ucs-2 segment", text: "ok " + strings.Repeat("ü", 60) + "✓", expected: SMSSize{Encoding: SMSEncodingUCS2, Units: 64, Segments: 1}},
+		{name: "non gsm character switches encoding", text: strings.Repeat("a", 70) + "✓", expected: SMSSize{Encoding: SMSEncodingUCS2, Units: 71, Segments: 2}},
+		{name: "emoji takes two code units", text: strings.Repeat("a", 68) + "😀", expected: SMSSize{Encoding: SMSEncodingUCS2, Units: 70, Segments: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, MeasureSMS(tt.text))
+		})
+	}
+}
+
+func TestSMSLengthPolicy(t *testing.T) {
+	long := "hello Sebbie, your order for " + strings.Repeat("extra long gaming laptop ", 10) + "has been received"
+	short := "order 1 received"
+	require.Equal(t, 2, MeasureSMS(long).Segments)
+
+	t.Run("choose the first template that fits", func(t *testing.T) {
+		assert.Equal(t, short, SMSLengthPolicy{MaxSegments: 1}.Choose(long, short))
+		assert.Equal(t, long, SMSLengthPolicy{MaxSegments: 2}.Choose(long, short))
+		assert.Equal(t, long, SMSLengthPolicy{}.Choose(long, short), "no limit")
+	})
+
+	t.Run("truncate over the limit", func(t *testing.T) {
+		text, size := SMSLengthPolicy{MaxSegments: 1, Truncate: true}.Apply(long)
+		assert.Equal(t, 1, size.Segments)
+		assert.LessOrEqual(t, size.Units, 160)
+		assert.True(t, strings.HasSuffix(text, "..."))
+		assert.True(t, strings.HasPrefix(long, strings.TrimSuffix(text, "...")))
+	})
+
+	t.Run("send whole without truncating", func(t *testing.T) {
+		text, size := SMSLengthPolicy{MaxSegments: 1}.Apply(long)
+		assert.Equal(t, long, text)
+		assert.Equal(t, 2, size.Segments)
+	})
+
+	t.Run("cost per segment", func(t *testing.T) {
+		policy := SMSLengthPolicy{CostPerSegment: models.Shillings(0.8)}
+		assert.Equal(t, models.Shillings(1.6), policy.Cost(MeasureSMS(long)))
+	})
+}
+
+func TestSMSServiceMessageLog(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "sms.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+
+	sms, at := newFakeATService(t)
+	sms.WithMessageLog(db).WithLengthPolicy(SMSLengthPolicy{MaxSegments: 1, Truncate: true, CostPerSegment: models.Shillings(0.8)})
+
+	err = sms.SendSMS(context.Background(), "0740827150", "your order for "+strings.Repeat("a very long item name ", 10)+"is confirmed")
+	require.NoError(t, err)
+	_, err = sms.SendBulkSMS(context.Background(), []string{"0711000001", "0711000002", "0711000003"}, "sale today")
+	require.NoError(t, err)
+
+	if assert.Len(t, at.Messages(), 4) {
+		assert.LessOrEqual(t, len(at.Messages()[0].Text), 160, "the long message was truncated before sending")
+	}
+
+	var messages []models.SMSMessage
+	db.Order("id ASC").Find(&messages)
+	if assert.Len(t, messages, 4) {
+		for _, message := range messages {
+			assert.Equal(t, models.SMSDirectionOutbound, message.Direction)
+			assert.Equal(t, SMSEncodingGSM7, message.Encoding)
+			assert.Equal(t, 1, message.Segments)
+			assert.Equal(t, models.Shillings(0.8), message.EstimatedCost)
+			assert.NotNil(t, message.ProviderMessageID)
+		}
+		assert.Equal(t, "+254740827150", messages[0].Phone)
+		assert.True(t, strings.HasSuffix(messages[0].Body, "..."))
+	}
+	assert.True(t, sms.LogsMessages())
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"testing"
@@ -88,7 +89,7 @@ func TestMockSMSService(t *testing.T) {
 		to := "+254740827150"
 		message := "test message"
 
-		err := mockService.SendSMS(to, message)
+		err := mockService.SendSMS(context.Background(), to, message)
 		assert.NoError(t, err)
 
 		assert.Len(t, mockService.SentMessages, 1)
@@ -101,8 +102,9 @@ func TestMockSMSService(t *testing.T) {
 		recipients := []string{"+254740827150", "+254111768132", "+254770110234"}
 		message := "bulk test message"
 
-		err := mockService.SendBulkSMS(recipients, message)
+		result, err := mockService.SendBulkSMS(context.Background(), recipients, message)
 		assert.NoError(t, err)
+		assert.Equal(t, 3, result.SentCount())
 
 		assert.Len(t, mockService.SentMessages, 3)
 
@@ -118,7 +120,7 @@ func TestMockSMSService(t *testing.T) {
 		to := "+254740827150"
 		message := "new test message"
 
-		err := mockService.SendSMS(to, message)
+		err := mockService.SendSMS(context.Background(), to, message)
 		assert.NoError(t, err)
 
 		assert.Len(t, mockService.SentMessages, 1)
@@ -140,6 +142,26 @@ func TestSMSServiceCreation(t *testing.T) {
 	assert.Equal(t, "https://api.sandbox.africastalking.com/version1/messaging", smsService.baseUrl)
 }
 
+func TestSMSServiceEnvironment(t *testing.T) {
+	smsService := NewSMSService("testuser", "testapikey", "testsender").WithEnvironment(SMSEnvironmentLive)
+	assert.Equal(t, "https://api.africastalking.com/version1/messaging", smsService.baseUrl)
+
+	smsService.WithEnvironment("production")
+	assert.Equal(t, "https://api.africastalking.com/version1/messaging", smsService.baseUrl, "unknown environments are ignored")
+
+	tests := map[string]string{
+		"":        SMSEnvironmentSandbox,
+		"live":    SMSEnvironmentLive,
+		" LIVE ":  SMSEnvironmentLive,
+		"sandbox": SMSEnvironmentSandbox,
+		"prod":    SMSEnvironmentSandbox,
+	}
+	for value, expected := range tests {
+		t.Setenv("SMS_ENVIRONMENT", value)
+		assert.Equal(t, expected, SMSEnvironmentFromEnv(), value)
+	}
+}
+
 func TestSMSServiceWithEmptySenderID(t *testing.T) {
 	username := "testuser"
 	apiKey := "testapikey"
@@ -153,7 +175,7 @@ func TestSMSServiceWithEmptySenderID(t *testing.T) {
 }
 
 func TestSendSMS(t *testing.T) {
-	smsService := NewSMSService("testuser", "testapikey", "testsender")
+	smsService := NewSMSService("testuser", "testapikey", "testsender").WithTransport(httpmock.DefaultTransport)
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
 
@@ -241,7 +263,7 @@ func TestSendSMS(t *testing.T) {
 					httpmock.NewErrorResponder(fmt.Errorf("network error")))
 			}
 
-			err := smsService.SendSMS(tt.to, tt.message)
+			err := smsService.SendSMS(context.Background(), tt.to, tt.message)
 
 			if tt.expectedError != "" {
 				assert.Error(t, err)
@@ -257,3 +279,21 @@ func TestSendSMS(t *testing.T) {
 		})
 	}
 }
+
+func TestSendSMSCancelledContext(t *testing.T) {
+	smsService := NewSMSService("testuser", "testapikey", "testsender").WithTransport(httpmock.DefaultTransport)
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("POST", smsService.baseUrl,
+		httpmock.NewStringResponder(201, `{"SMSMessageData":{"Message":"Sent","Recipients":[]}}`))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := smsService.SendSMS(ctx, "+254740827150", "Test message")
+
+	assert.Error(t, err)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, httpmock.GetTotalCallCount())
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// MaxStatementDays caps the period one statement covers
+const MaxStatementDays = 366
+
+// Statement formats
+const (
+	StatementJSON = "json"
+	StatementCSV  = "csv"
+	StatementPDF  = "pdf"
+)
+
+var (
+	ErrInvalidStatementLink = errors.New("invalid statement link")
+	ErrStatementLinkExpired = errors.New("statement link expired")
+)
+
+// CustomerStatement lists the customer's live and archived orders placed on
+// the days from..to inclusive, in the report timezone, with the balance
+// carried from the orders placed before. Cancelled orders are listed but
+// leave the balance as it is.
+func (s *ReportService) CustomerStatement(ctx context.Context, customer models.Customer, from, to time.Time) (models.Statement, error) {
+	db := s.db.WithContext(ctx)
+	start := s.startOfDay(from)
+	end := s.startOfDay(to).AddDate(0, 0, 1)
+
+	statement := models.Statement{
+		CustomerID:   customer.ID,
+		CustomerName: customer.Name,
+		CustomerCode: customer.Code,
+		From:         start.Format(DayLayout),
+		To:           s.startOfDay(to).Format(DayLayout),
+		Timezone:     s.location.String(),
+		Lines:        []models.StatementLine{},
+		GeneratedAt:  time.Now(),
+	}
+
+	for _, model := range []interface{}{&models.Order{}, &models.ArchivedOrder{}} {
+		// bounds go in as UTC, as sqlite compares the stored times as text
+		var opening models.Money
+		err := db.Model(model).
+			Select("COALESCE(SUM(gross_amount), 0)").
+			Where("customer_id = ? AND time < ? AND status <> ?", customer.ID, start.UTC(), models.OrderStatusCancelled).
+			Scan(&opening).Error
+		if err != nil {
+			return statement, fmt.Errorf("failed to total orders before the statement: %w", err)
+		}
+		statement.OpeningBalance += opening
+
+		var lines []models.StatementLine
+		err = db.Model(model).
+			Select("time, id AS order_id, item, status, net_amount, tax_amount, gross_amount").
+			Where("customer_id = ? AND time >= ? AND time < ?", customer.ID, start.UTC(), end.UTC()).
+			Scan(&lines).Error
+		if err != nil {
+			return statement, fmt.Errorf("failed to list statement orders: %w", err)
+		}
+		statement.Lines = append(statement.Lines, lines...)
+	}
+
+	sort.SliceStable(statement.Lines, func(i, j int) bool {
+		if statement.Lines[i].Time.Equal(statement.Lines[j].Time) {
+			return statement.Lines[i].OrderID < statement.Lines[j].OrderID
+		}
+		return statement.Lines[i].Time.Before(statement.Lines[j].Time)
+	})
+
+	balance := statement.OpeningBalance
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		line.Time = line.Time.In(s.location)
+		if line.Status == models.OrderStatusCancelled {
+			line.Kind = models.StatementLineCancelled
+			statement.Cancelled += line.GrossAmount
+		} else {
+			line.Kind = models.StatementLineCharge
+			statement.Charges += line.GrossAmount
+			statement.OrdersCount++
+			balance += line.GrossAmount
+		}
+		line.Balance = balance
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// StatementRef identifies the statement a link opens
+type StatementRef struct {
+	CustomerID uint
+	From, To   time.Time
+	Format     string
+}
+
+// StatementLinks issues and verifies signed, expiring links customers can
+// open their statement with, like TrackingService does for orders
+type StatementLinks struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewStatementLinks refuses an empty secret with ErrNoSigningSecret
+func NewStatementLinks(secret, baseURL string, ttl time.Duration) (*StatementLinks, error) {
+	if secret == "" {
+		return nil, ErrNoSigningSecret
+	}
+	if ttl <= 0 {
+		ttl = 7 * 24 * time.Hour
+	}
+	return &StatementLinks{
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+	}, nil
+}
+
+// URL returns the public link to the statement and when it expires. The
+// token has the form <customer id>.<from>.<to>.<format>.<expiry unix>.<signature>
+// with the days as YYYYMMDD.
+func (l *StatementLinks) URL(ref StatementRef) (string, time.Time) {
+	expiresAt := time.Now().Add(l.ttl)
+	payload := fmt.Sprintf("%d.%s.%s.%s.%d", ref.CustomerID, ref.From.Format("20060102"), ref.To.Format("20060102"), ref.Format, expiresAt.Unix())
+	return l.baseURL + "/statements/" + payload + "." + l.sign(payload), expiresAt
+}
+
+// Verify checks the token's signature and expiry and returns the statement
+// it opens, with the days in location
+func (l *StatementLinks) Verify(token string, location *time.Location) (StatementRef, error) {
+	var ref StatementRef
+	parts := strings.Split(token, ".")
+	if len(parts) != 6 {
+		return ref, ErrInvalidStatementLink
+	}
+
+	payload := strings.Join(parts[:5], ".")
+	if !hmac.Equal([]byte(l.sign(payload)), []byte(parts[5])) {
+		return ref, ErrInvalidStatementLink
+	}
+
+	customerID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return ref, ErrInvalidStatementLink
+	}
+	from, err := time.ParseInLocation("20060102", parts[1], location)
+	if err != nil {
+		return ref, ErrInvalidStatementLink
+	}
+	to, err := time.ParseInLocation("20060102", parts[2], location)
+	if err != nil {
+		return ref, ErrInvalidStatementLink
+	}
+	expiresAt, err := strconv.ParseInt(parts[4], 10, 64)
+	if err != nil {
+		return ref, ErrInvalidStatementLink
+	}
+	if time.Now().Unix() > expiresAt {
+		return ref, ErrStatementLinkExpired
+	}
+
+	return StatementRef{CustomerID: uint(customerID), From: from, To: to, Format: parts[3]}, nil
+}
+
+func (l *StatementLinks) sign(payload string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte("statement." + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// WriteStatementCSV writes the statement's lines as CSV, with the opening
+// and closing balances as the first and last rows
+func WriteStatementCSV(w io.Writer, statement models.Statement) error {
+	out := csv.NewWriter(w)
+	money := func(amount models.Money) string {
+		return amount.String()
+	}
+
+	out.Write([]string{"date", "order_id", "item", "status", "kind", "net_amount", "tax_amount", "gross_amount", "balance"})
+	out.Write([]string{statement.From, "", "opening balance", "", "", "", "", "", money(statement.OpeningBalance)})
+	for _, line := range statement.Lines {
+		out.Write([]string{
+			line.Time.Format("2006-01-02 15:04"),
+			strconv.FormatUint(uint64(line.OrderID), 10),
+			csvSafe(line.Item),
+			line.Status,
+			line.Kind,
+			money(line.NetAmount),
+			money(line.TaxAmount),
+			money(line.GrossAmount),
+			money(line.Balance),
+		})
+	}
+	out.Write([]string{statement.To, "", "closing balance", "", "", "", "", "", money(statement.ClosingBalance)})
+
+	out.Flush()
+	return out.Error()
+}
+
+// csvSafe keeps spreadsheets from running values as formulas
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// statementPageLines is how many lines of text fit on one A4 page
+const statementPageLines = 50
+
+// WriteStatementPDF writes the statement as a plain text PDF. It only uses
+// the standard Courier font, so no font files are embedded; characters
+// outside Latin-1 are replaced with ?.
+func WriteStatementPDF(w io.Writer, statement models.Statement) error {
+	text := []string{
+		"Statement of account",
+		"",
+		fmt.Sprintf("Customer: %s (%s)", statement.CustomerName, statement.CustomerCode),
+		fmt.Sprintf("Period: %s to %s (%s)", statement.From, statement.To, statement.Timezone),
+		"",
+		fmt.Sprintf("%-16s %-8s %-28s %-10s %12s %12s", "Date", "Order", "Item", "Status", "Amount", "Balance"),
+		fmt.Sprintf("%-16s %-8s %-28s %-10s %12s %12s", statement.From, "", "Opening balance", "", "", statement.OpeningBalance),
+	}
+	for _, line := range statement.Lines {
+		item := line.Item
+		if runes := []rune(item); len(runes) > 28 {
+			item = string(runes[:27]) + "~"
+		}
+		text = append(text, fmt.Sprintf("%-16s %-8d %-28s %-10s %12s %12s",
+			line.Time.Format("2006-01-02 15:04"), line.OrderID, item, line.Status, line.GrossAmount, line.Balance))
+	}
+	text = append(text,
+		fmt.Sprintf("%-16s %-8s %-28s %-10s %12s %12s", statement.To, "", "Closing balance", "", "", statement.ClosingBalance),
+		"",
+		fmt.Sprintf("Orders charged: %d, totalling %s. Cancelled orders: %s, not charged.", statement.OrdersCount, statement.Charges, statement.Cancelled),
+		"Generated "+statement.GeneratedAt.Format("2006-01-02 15:04 MST"),
+	)
+
+	var pages [][]string
+	for len(text) > statementPageLines {
+		pages = append(pages, text[:statementPageLines])
+		text = text[statementPageLines:]
+	}
+	pages = append(pages, text)
+
+	return writePDF(w, pages)
+}
+
+// writePDF writes pages of monospaced text lines as a minimal PDF document
+func writePDF(w io.Writer, pages [][]string) error {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// objects 1 and 2 are the catalog and the page tree, 3 the font, and
+	// each page is followed by its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, lines := range pages {
+		var content strings.Builder
+		content.WriteString("BT /F1 9 Tf 11 TL 40 800 Td\n")
+		for _, line := range lines {
+			content.WriteString("(" + pdfString(line) + ") Tj T*\n")
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// pdfString escapes text for a PDF string literal in WinAnsi encoding
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 32 && r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatementLinkRoundTrip(t *testing.T) {
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	links, err := NewStatementLinks("test-secret", "https://api.example.com/", time.Hour)
+	require.NoError(t, err)
+	ref := StatementRef{
+		CustomerID: 7,
+		From:       time.Date(2025, 9, 1, 0, 0, 0, 0, nairobi),
+		To:         time.Date(2025, 9, 30, 0, 0, 0, 0, nairobi),
+		Format:     StatementPDF,
+	}
+
+	url, expiresAt := links.URL(ref)
+	assert.True(t, strings.HasPrefix(url, "https://api.example.com/statements/7.20250901.20250930.pdf."))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	verified, err := links.Verify(strings.TrimPrefix(url, "https://api.example.com/statements/"), nairobi)
+	assert.NoError(t, err)
+	assert.Equal(t, ref.CustomerID, verified.CustomerID)
+	assert.True(t, ref.From.Equal(verified.From))
+	assert.True(t, ref.To.Equal(verified.To))
+	assert.Equal(t, ref.Format, verified.Format)
+}
+
+func TestStatementLinkRejected(t *testing.T) {
+	links, err := NewStatementLinks("test-secret", "https://api.example.com", time.Hour)
+	require.NoError(t, err)
+	other, err := NewStatementLinks("other-secret", "https://api.example.com", time.Hour)
+	require.NoError(t, err)
+	tracking, err := NewTrackingService("test-secret", "", time.Hour)
+	require.NoError(t, err)
+	url, _ := links.URL(StatementRef{CustomerID: 7, From: time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 9, 30, 0, 0, 0, 0, time.UTC), Format: StatementCSV})
+	token := strings.TrimPrefix(url, "https://api.example.com/statements/")
+
+	tests := []struct {
+		name          string
+		token         string
+		links         *StatementLinks
+		expectedError error
+	}{
+		{
+			name:          "malformed token",
+			token:         "not-a-token",
+			links:         links,
+			expectedError: ErrInvalidStatementLink,
+		},
+		{
+			name:          "tampered customer id",
+			token:         "8" + token[1:],
+			links:         links,
+			expectedError: ErrInvalidStatementLink,
+		},
+		{
+			name:          "tampered format",
+			token:         strings.Replace(token, ".csv.", ".pdf.", 1),
+			links:         links,
+			expectedError: ErrInvalidStatementLink,
+		},
+		{
+			name:          "different secret",
+			token:         token,
+			links:         other,
+			expectedError: ErrInvalidStatementLink,
+		},
+		{
+			name:          "tracking token signed with the same secret",
+			token:         "7.1." + tracking.sign("7.1"),
+			links:         links,
+			expectedError: ErrInvalidStatementLink,
+		},
+		{
+			name:          "expired link",
+			token:         "7.20250901.20250930.csv.1." + links.sign("7.20250901.20250930.csv.1"),
+			links:         links,
+			expectedError: ErrStatementLinkExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.links.Verify(tt.token, time.UTC)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestStatementLinksNeedSecret(t *testing.T) {
+	_, err := NewStatementLinks("", "https://api.example.com", time.Hour)
+	assert.ErrorIs(t, err, ErrNoSigningSecret)
+}
+
+func TestWriteStatement(t *testing.T) {
+	statement := models.Statement{
+		CustomerName:   "Sebbie (Nairobi)",
+		CustomerCode:   "CUST001",
+		From:           "2025-09-01",
+		To:             "2025-09-30",
+		Timezone:       "Africa/Nairobi",
+		OpeningBalance: models.Shillings(100),
+		ClosingBalance: models.Shillings(150),
+		Lines: []models.StatementLine{
+			{Time: time.Date(2025, 9, 2, 10, 0, 0, 0, time.UTC), OrderID: 1, Item: "=SUM(A1:A9)", Status: models.OrderStatusPending, Kind: models.StatementLineCharge, NetAmount: models.Shillings(50), GrossAmount: models.Shillings(50), Balance: models.Shillings(150)},
+		},
+		GeneratedAt: time.Date(2025, 10, 1, 8, 0, 0, 0, time.UTC),
+	}
+
+	var csvOut bytes.Buffer
+	assert.NoError(t, WriteStatementCSV(&csvOut, statement))
+	assert.Equal(t, strings.Join([]string{
+		"date,order_id,item,status,kind,net_amount,tax_amount,gross_amount,balance",
+		"2025-09-01,,opening balance,,,,,,100.00",
+		"2025-09-02 10:00,1,'=SUM(A1:A9),pending,charge,50.00,0.00,50.00,150.00",
+		"2025-09-30,,closing balance,,,,,,150.00",
+		"",
+	}, "\n"), csvOut.String())
+
+	var pdfOut bytes.Buffer
+	assert.NoError(t, WriteStatementPDF(&pdfOut, statement))
+	assert.True(t, strings.HasPrefix(pdfOut.String(), "%PDF-1.4\n"))
+	assert.True(t, strings.HasSuffix(pdfOut.String(), "%%EOF\n"))
+	assert.Contains(t, pdfOut.String(), "(Customer: Sebbie \\(Nairobi\\) \\(CUST001\\)) Tj")
+	assert.Contains(t, pdfOut.String(), "/Count 1 ")
+
+	for i := 0; i < 60; i++ {
+		statement.Lines = append(statement.Lines, statement.Lines[0])
+	}
+	pdfOut.Reset()
+	assert.NoError(t, WriteStatementPDF(&pdfOut, statement))
+	assert.Contains(t, pdfOut.String(), "/Count 2 ")
+}
+
+func TestPDFString(t *testing.T) {
+	assert.Equal(t, `a \(b\) c\\ caf\351 ?`, pdfString("a (b) c\\ café €"))
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// TaxPolicy is the VAT applied to new orders
+type TaxPolicy struct {
+	// RatePercent is the VAT rate, e.g. 16 for 16%
+	RatePercent float64
+	// Inclusive means order amounts already include VAT, as shelf prices
+	// do; otherwise VAT is added on top of the amount
+	Inclusive bool
+}
+
+func DefaultTaxPolicy() TaxPolicy {
+	return TaxPolicy{RatePercent: 16, Inclusive: true}
+}
+
+// TaxPolicyFromEnv reads TAX_RATE_PERCENT (0 for no VAT) and TAX_INCLUSIVE
+// over the defaults
+func TaxPolicyFromEnv() TaxPolicy {
+	policy := DefaultTaxPolicy()
+
+	if f, err := strconv.ParseFloat(os.Getenv("TAX_RATE_PERCENT"), 64); err == nil && f >= 0 {
+		policy.RatePercent = f
+	}
+	if b, err := strconv.ParseBool(os.Getenv("TAX_INCLUSIVE")); err == nil {
+		policy.Inclusive = b
+	}
+	return policy
+}
+
+// Apply sets the order's tax rate and basis from the policy and computes its
+// net, tax and gross amounts
+func (p TaxPolicy) Apply(order *models.Order) {
+	order.TaxRate = p.RatePercent
+	order.TaxInclusive = p.Inclusive
+	RecalculateTax(order)
+}
+
+// RecalculateTax recomputes the order's net, tax and gross amounts from its
+// amount, using the rate and basis stored on the order so later policy
+// changes do not alter existing orders
+func RecalculateTax(order *models.Order) {
+	rate := order.TaxRate / 100
+
+	if order.TaxInclusive {
+		order.GrossAmount = order.Amount
+		order.NetAmount = order.Amount.Scale(1 / (1 + rate))
+	} else {
+		order.NetAmount = order.Amount
+		order.GrossAmount = order.Amount.Scale(1 + rate)
+	}
+	// derived so that net + tax always equals gross exactly
+	order.TaxAmount = order.GrossAmount - order.NetAmount
+}
+
+// BackfillOrderTax computes tax for orders created before amounts were
+// taxed, using the given policy, and returns how many were updated
+func BackfillOrderTax(ctx context.Context, db *gorm.DB, policy TaxPolicy) (int64, error) {
+	var updated int64
+
+	var orders []models.Order
+	err := db.WithContext(ctx).Unscoped().
+		Where("gross_amount = 0 AND amount <> 0").
+		FindInBatches(&orders, 500, func(tx *gorm.DB, batch int) error {
+			for i := range orders {
+				policy.Apply(&orders[i])
+				err := tx.Model(&orders[i]).UpdateColumns(map[string]interface{}{
+					"tax_rate":      orders[i].TaxRate,
+					"tax_inclusive": orders[i].TaxInclusive,
+					"net_amount":    orders[i].NetAmount,
+					"tax_amount":    orders[i].TaxAmount,
+					"gross_amount":  orders[i].GrossAmount,
+				}).Error
+				if err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		}).Error
+
+	return updated, err
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaxPolicyApply(t *testing.T) {
+	tests := []struct {
+		name          string
+		policy        TaxPolicy
+		amount        float64
+		expectedNet   float64
+		expectedTax   float64
+		expectedGross float64
+	}{
+		{name: "inclusive", policy: TaxPolicy{RatePercent: 16, Inclusive: true}, amount: 1160, expectedNet: 1000, expectedTax: 160, expectedGross: 1160},
+		{name: "inclusive rounding", policy: TaxPolicy{RatePercent: 16, Inclusive: true}, amount: 99.99, expectedNet: 86.2, expectedTax: 13.79, expectedGross: 99.99},
+		{name: "exclusive", policy: TaxPolicy{RatePercent: 16, Inclusive: false}, amount: 1000, expectedNet: 1000, expectedTax: 160, expectedGross: 1160},
+		{name: "zero rated", policy: TaxPolicy{RatePercent: 0, Inclusive: true}, amount: 500, expectedNet: 500, expectedTax: 0, expectedGross: 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{Amount: models.Shillings(tt.amount)}
+			tt.policy.Apply(&order)
+
+			assert.Equal(t, tt.policy.RatePercent, order.TaxRate)
+			assert.Equal(t, tt.policy.Inclusive, order.TaxInclusive)
+			assert.Equal(t, models.Shillings(tt.expectedNet), order.NetAmount)
+			assert.Equal(t, models.Shillings(tt.expectedTax), order.TaxAmount)
+			assert.Equal(t, models.Shillings(tt.expectedGross), order.GrossAmount)
+		})
+	}
+}
+
+func TestRecalculateTaxKeepsOrderRate(t *testing.T) {
+	order := models.Order{Amount: models.Shillings(1160)}
+	DefaultTaxPolicy().Apply(&order)
+
+	// a rate change after the order was placed does not apply to it
+	order.Amount = models.Shillings(2320)
+	RecalculateTax(&order)
+
+	assert.Equal(t, float64(16), order.TaxRate)
+	assert.Equal(t, models.Shillings(2000), order.NetAmount)
+	assert.Equal(t, models.Shillings(320), order.TaxAmount)
+}
+
+func TestTaxPolicyFromEnv(t *testing.T) {
+	t.Setenv("TAX_RATE_PERCENT", "8")
+	t.Setenv("TAX_INCLUSIVE", "false")
+	assert.Equal(t, TaxPolicy{RatePercent: 8, Inclusive: false}, TaxPolicyFromEnv())
+
+	t.Setenv("TAX_RATE_PERCENT", "-1")
+	t.Setenv("TAX_INCLUSIVE", "")
+	assert.Equal(t, DefaultTaxPolicy(), TaxPolicyFromEnv())
+}
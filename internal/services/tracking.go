@@ -0,0 +1,88 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTrackingToken = errors.New("invalid tracking token")
+	ErrTrackingTokenExpired = errors.New("tracking token expired")
+	// ErrNoSigningSecret is returned for links that would be signed with an
+	// empty key, which anyone could forge
+	ErrNoSigningSecret = errors.New("no secret to sign links with")
+)
+
+// TrackingService issues and verifies signed, expiring order tracking links
+type TrackingService struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewTrackingService refuses an empty secret with ErrNoSigningSecret
+func NewTrackingService(secret, baseURL string, ttl time.Duration) (*TrackingService, error) {
+	if secret == "" {
+		return nil, ErrNoSigningSecret
+	}
+	if ttl <= 0 {
+		ttl = 30 * 24 * time.Hour
+	}
+	return &TrackingService{
+		secret:  []byte(secret),
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+	}, nil
+}
+
+// GenerateToken returns a token of the form <order id>.<expiry unix>.<signature>
+func (s *TrackingService) GenerateToken(orderID uint) string {
+	payload := fmt.Sprintf("%d.%d", orderID, time.Now().Add(s.ttl).Unix())
+	return payload + "." + s.sign(payload)
+}
+
+// TrackingURL returns the public link customers can open to check an order
+func (s *TrackingService) TrackingURL(orderID uint) string {
+	return s.baseURL + "/track/" + s.GenerateToken(orderID)
+}
+
+// VerifyToken checks the signature and expiry and returns the order id
+func (s *TrackingService) VerifyToken(token string) (uint, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, ErrInvalidTrackingToken
+	}
+
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(s.sign(payload)), []byte(parts[2])) {
+		return 0, ErrInvalidTrackingToken
+	}
+
+	orderID, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, ErrInvalidTrackingToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidTrackingToken
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return 0, ErrTrackingTokenExpired
+	}
+
+	return uint(orderID), nil
+}
+
+func (s *TrackingService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrackingTokenRoundTrip(t *testing.T) {
+	trackingService, err := NewTrackingService("test-secret", "https://api.example.com/", time.Hour)
+	require.NoError(t, err)
+
+	token := trackingService.GenerateToken(42)
+	orderID, err := trackingService.VerifyToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(42), orderID)
+
+	url := trackingService.TrackingURL(42)
+	assert.True(t, strings.HasPrefix(url, "https://api.example.com/track/"))
+}
+
+func TestTrackingTokenRejected(t *testing.T) {
+	trackingService, err := NewTrackingService("test-secret", "https://api.example.com", time.Hour)
+	require.NoError(t, err)
+	other, err := NewTrackingService("other-secret", "https://api.example.com", time.Hour)
+	require.NoError(t, err)
+	token := trackingService.GenerateToken(42)
+
+	tests := []struct {
+		name          string
+		token         string
+		service       *TrackingService
+		expectedError error
+	}{
+		{
+			name:          "malformed token",
+			token:         "not-a-token",
+			service:       trackingService,
+			expectedError: ErrInvalidTrackingToken,
+		},
+		{
+			name:          "tampered order id",
+			token:         "43" + token[2:],
+			service:       trackingService,
+			expectedError: ErrInvalidTrackingToken,
+		},
+		{
+			name:          "different secret",
+			token:         token,
+			service:       other,
+			expectedError: ErrInvalidTrackingToken,
+		},
+		{
+			name:          "expired token",
+			token:         "42.1." + trackingService.sign("42.1"),
+			service:       trackingService,
+			expectedError: ErrTrackingTokenExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.service.VerifyToken(tt.token)
+			assert.ErrorIs(t, err, tt.expectedError)
+		})
+	}
+}
+
+func TestTrackingServiceNeedsSecret(t *testing.T) {
+	_, err := NewTrackingService("", "https://api.example.com", time.Hour)
+	assert.ErrorIs(t, err, ErrNoSigningSecret)
+}
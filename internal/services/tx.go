@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// WithTx runs fn in one database transaction under ctx. The transaction is
+// committed when fn returns nil and rolled back when fn returns an error or
+// panics; a panic carries on once the transaction is rolled back.
+//
+// fn's error is returned as is, so callers can match the sentinel errors
+// they return from fn with errors.Is. When ctx ended first the error also
+// matches ctx.Err(), whatever the driver reported.
+func WithTx(ctx context.Context, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	err := db.WithContext(ctx).Transaction(fn)
+	if err != nil && ctx.Err() != nil && !errors.Is(err, ctx.Err()) {
+		return fmt.Errorf("%w: %w", ctx.Err(), err)
+	}
+	return err
+}
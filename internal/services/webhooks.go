@@ -0,0 +1,367 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/pkg/webhook"
+	"gorm.io/gorm"
+)
+
+var ErrWebhookNotFound = errors.New("webhook subscription not found")
+
+const (
+	// webhookSecretPrefix starts every signing secret, so leaked secrets
+	// are easy to recognise
+	webhookSecretPrefix = "whsec_"
+
+	// DefaultWebhookGracePeriod is how long a rotated secret keeps signing
+	DefaultWebhookGracePeriod = 24 * time.Hour
+
+	// webhookBatch is how many events are sent to a subscription per run
+	webhookBatch = 100
+	// webhookMaxBackoff caps the wait after repeated failures
+	webhookMaxBackoff = time.Hour
+	// maxWebhookErrorBody is how much of a failed response is kept
+	maxWebhookErrorBody = 512
+)
+
+// WebhookService keeps the webhook subscriptions of consumers and sends
+// them the order event log. Each subscription gets its events one at a
+// time in the order they were recorded; a failed delivery is retried,
+// with a growing wait, before any later event is sent. Deliveries are at
+// least once, so consumers skip event ids they have already handled.
+type WebhookService struct {
+	db        *gorm.DB
+	client    *http.Client
+	transport *instrumentedTransport
+	retry     time.Duration
+	now       func() time.Time
+}
+
+// NewWebhookService sends deliveries with a WEBHOOK_HTTP_TIMEOUT (default
+// 10s) and waits retry after a first failure, doubling with each further
+// one up to an hour
+func NewWebhookService(db *gorm.DB, retry time.Duration) *WebhookService {
+	cfg := HTTPClientConfigFromEnv("WEBHOOK")
+	transport := &instrumentedTransport{
+		name:    cfg.Name,
+		base:    newHTTPTransport(cfg),
+		metrics: DefaultOutboundMetrics(),
+	}
+	if retry <= 0 {
+		retry = time.Minute
+	}
+	return &WebhookService{
+		db: db,
+		// each consumer has its own outages, so deliveries share neither
+		// retries nor a circuit breaker; a failure waits for the next run
+		client:    &http.Client{Timeout: cfg.Timeout, Transport: transport},
+		transport: transport,
+		retry:     retry,
+		now:       time.Now,
+	}
+}
+
+// WithTransport sends deliveries through transport instead, e.g. to answer
+// them in tests
+func (s *WebhookService) WithTransport(transport http.RoundTripper) *WebhookService {
+	s.transport.base = transport
+	return s
+}
+
+// WithClock replaces time.Now, for tests
+func (s *WebhookService) WithClock(now func() time.Time) *WebhookService {
+	s.now = now
+	return s
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return webhookSecretPrefix + hex.EncodeToString(b), nil
+}
+
+// Create subscribes sub.URL to the events recorded from now on. Its secret
+// is only returned here, in sub.SigningSecret.
+func (s *WebhookService) Create(ctx context.Context, sub *models.WebhookSubscription) error {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+	db := s.db.WithContext(ctx)
+
+	var last uint
+	if err := db.Model(&models.OrderEvent{}).Select("COALESCE(MAX(id), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	sub.Secret = secret
+	sub.LastEventID = last
+	sub.Active = true
+	if err := db.Create(sub).Error; err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+	sub.SigningSecret = secret
+	return nil
+}
+
+// List returns every subscription, newest first
+func (s *WebhookService) List(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subs []models.WebhookSubscription
+	err := s.db.WithContext(ctx).Order("id DESC").Find(&subs).Error
+	return subs, err
+}
+
+func (s *WebhookService) Get(ctx context.Context, id uint) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	if err := s.db.WithContext(ctx).First(&sub, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return sub, ErrWebhookNotFound
+		}
+		return sub, err
+	}
+	return sub, nil
+}
+
+// Update changes the fields req sets. Reactivating a subscription clears
+// its failures, so it is retried by the next run.
+func (s *WebhookService) Update(ctx context.Context, id uint, req models.UpdateWebhookSubscriptionRequest) (models.WebhookSubscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return sub, err
+	}
+
+	columns := []string{}
+	if req.URL != nil {
+		sub.URL = *req.URL
+		columns = append(columns, "url")
+	}
+	if req.Description != nil {
+		sub.Description = *req.Description
+		columns = append(columns, "description")
+	}
+	if req.Events != nil {
+		sub.Events = *req.Events
+		if len(sub.Events) == 0 {
+			sub.Events = nil
+		}
+		columns = append(columns, "events")
+	}
+	if req.Active != nil {
+		if *req.Active && !sub.Active {
+			sub.Failures, sub.NextAttemptAt = 0, nil
+			columns = append(columns, "failures", "next_attempt_at")
+		}
+		sub.Active = *req.Active
+		columns = append(columns, "active")
+	}
+	if len(columns) == 0 {
+		return sub, nil
+	}
+	if err := s.db.WithContext(ctx).Model(&sub).Select(columns).Updates(&sub).Error; err != nil {
+		return sub, err
+	}
+	return sub, nil
+}
+
+// Delete stops deliveries to a subscription for good
+func (s *WebhookService) Delete(ctx context.Context, id uint) (models.WebhookSubscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return sub, err
+	}
+	return sub, s.db.WithContext(ctx).Delete(&sub).Error
+}
+
+// RotateSecret gives a subscription a new signing secret, returned in
+// SigningSecret. The current one keeps signing deliveries alongside it for
+// grace; a secret still in its grace period from an earlier rotation is
+// dropped.
+func (s *WebhookService) RotateSecret(ctx context.Context, id uint, grace time.Duration) (models.WebhookSubscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return sub, err
+	}
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return sub, err
+	}
+
+	now := s.now()
+	sub.PreviousSecret, sub.PreviousSecretExpiresAt = "", nil
+	if grace > 0 {
+		expires := now.Add(grace)
+		sub.PreviousSecret, sub.PreviousSecretExpiresAt = sub.Secret, &expires
+	}
+	sub.Secret = secret
+	sub.SecretRotatedAt = &now
+	if err := s.db.WithContext(ctx).Model(&sub).Select("secret", "previous_secret", "previous_secret_expires_at", "secret_rotated_at").Updates(&sub).Error; err != nil {
+		return sub, err
+	}
+	sub.SigningSecret = secret
+	return sub, nil
+}
+
+// signingSecrets are the secrets a delivery made now is signed with
+func (s *WebhookService) signingSecrets(sub models.WebhookSubscription) []string {
+	secrets := []string{sub.Secret}
+	if sub.PreviousSecret != "" && sub.PreviousSecretExpiresAt != nil && s.now().Before(*sub.PreviousSecretExpiresAt) {
+		secrets = append(secrets, sub.PreviousSecret)
+	}
+	return secrets
+}
+
+// Deliver sends each active subscription the events recorded since its
+// last delivery, skipping those waiting out a failure, and returns how
+// many events were delivered. A consumer failing is recorded on its
+// subscription rather than returned; the error is for the database.
+func (s *WebhookService) Deliver(ctx context.Context) (int, error) {
+	now := s.now()
+	var subs []models.WebhookSubscription
+	err := s.db.WithContext(ctx).
+		Where("active = ? AND (next_attempt_at IS NULL OR next_attempt_at <= ?)", true, now).
+		Order("id").Find(&subs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, sub := range subs {
+		n, err := s.deliverTo(ctx, sub)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+func (s *WebhookService) deliverTo(ctx context.Context, sub models.WebhookSubscription) (int, error) {
+	db := s.db.WithContext(ctx)
+	var events []models.OrderEvent
+	if err := db.Where("id > ?", sub.LastEventID).Order("id").Limit(webhookBatch).Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	last := sub.LastEventID
+	delivered := 0
+	var failure error
+	for _, event := range events {
+		if len(sub.Events) > 0 && !slices.Contains(sub.Events, event.Type) {
+			last = event.ID
+			continue
+		}
+		if err := s.send(ctx, sub, event); err != nil {
+			if ctx.Err() != nil {
+				// stopped, not failed: the next run carries on
+				break
+			}
+			failure = err
+			break
+		}
+		last = event.ID
+		delivered++
+	}
+
+	updates := map[string]interface{}{"last_event_id": last}
+	if delivered > 0 {
+		updates["last_delivered_at"] = s.now()
+	}
+	if failure != nil {
+		failures := sub.Failures + 1
+		next := s.now().Add(s.backoff(failures))
+		updates["failures"] = failures
+		updates["last_error"] = failure.Error()
+		updates["next_attempt_at"] = next
+		log.Printf("webhook %d delivery failed %d times, retrying at %s: %v", sub.ID, failures, next.Format(time.RFC3339), failure)
+	} else if sub.Failures > 0 || sub.NextAttemptAt != nil {
+		updates["failures"] = 0
+		updates["last_error"] = ""
+		updates["next_attempt_at"] = nil
+	}
+	if last == sub.LastEventID && len(updates) == 1 {
+		return delivered, nil
+	}
+	// a background context, so progress is saved even when ctx was cancelled
+	return delivered, s.db.WithContext(context.WithoutCancel(ctx)).Model(&sub).Updates(updates).Error
+}
+
+func (s *WebhookService) backoff(failures int) time.Duration {
+	delay := s.retry
+	for i := 1; i < failures && delay < webhookMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, webhookMaxBackoff)
+}
+
+// WebhookPayload is the body sent for event
+func WebhookPayload(event models.OrderEvent) ([]byte, error) {
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(webhook.Event{
+		ID:        WebhookEventID(event),
+		Type:      event.Type,
+		CreatedAt: event.CreatedAt,
+		OrderID:   event.OrderID,
+		Sequence:  event.Sequence,
+		Actor:     event.Actor,
+		Data:      data,
+	})
+}
+
+// WebhookEventID is the id consumers tell deliveries of event apart by
+func WebhookEventID(event models.OrderEvent) string {
+	return "evt_" + strconv.FormatUint(uint64(event.ID), 10)
+}
+
+func (s *WebhookService) send(ctx context.Context, sub models.WebhookSubscription, event models.OrderEvent) error {
+	body, err := WebhookPayload(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	signedAt := s.now()
+	signatures := make([]string, 0, 2)
+	for _, secret := range s.signingSecrets(sub) {
+		signatures = append(signatures, webhook.Sign(secret, signedAt, body))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "customer-order-api-webhooks")
+	req.Header.Set(webhook.IDHeader, WebhookEventID(event))
+	req.Header.Set(webhook.EventHeader, event.Type)
+	req.Header.Set(webhook.TimestampHeader, strconv.FormatInt(signedAt.Unix(), 10))
+	req.Header.Set(webhook.SignatureHeader, strings.Join(signatures, ", "))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookErrorBody))
+		return fmt.Errorf("consumer returned status %d: %s", resp.StatusCode, bytes.TrimSpace(excerpt))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxWebhookErrorBody))
+	return nil
+}
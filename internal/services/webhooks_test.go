@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/pkg/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestWebhookService(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "webhooks.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, models.Migrate(db))
+	ctx := context.Background()
+
+	now := time.Date(2026, 3, 11, 7, 0, 0, 0, time.UTC)
+	item := "laptop"
+	status := models.OrderStatusShipped
+	// recorded before the subscription, so never sent
+	require.NoError(t, db.Create(&models.OrderEvent{OrderID: 1, Sequence: 1, Type: models.OrderEventCreated, Data: models.OrderEventData{Item: &item}, CreatedAt: now}).Error)
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	var deliveries []delivery
+	status500 := false
+	webhooks := NewWebhookService(db, time.Minute).
+		WithClock(func() time.Time { return now }).
+		WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			body, _ := io.ReadAll(req.Body)
+			deliveries = append(deliveries, delivery{header: req.Header.Clone(), body: body})
+			code := http.StatusOK
+			if status500 {
+				code = http.StatusInternalServerError
+			}
+			return &http.Response{StatusCode: code, Body: io.NopCloser(strings.NewReader("unavailable")), Header: http.Header{}}, nil
+		}))
+
+	sub := models.WebhookSubscription{URL: "https://hooks.example.com/orders", Events: []string{models.OrderEventCreated, models.OrderEventStatusChanged}}
+	require.NoError(t, webhooks.Create(ctx, &sub))
+	assert.True(t, strings.HasPrefix(sub.SigningSecret, "whsec_"))
+	assert.Equal(t, uint(1), sub.LastEventID)
+	secret := sub.SigningSecret
+
+	stored, err := webhooks.Get(ctx, sub.ID)
+	require.NoError(t, err)
+	assert.Equal(t, secret, stored.Secret)
+	assert.Empty(t, stored.SigningSecret)
+
+	require.NoError(t, db.Create(&models.OrderEvent{OrderID: 2, Sequence: 1, Type: models.OrderEventCreated, Data: models.OrderEventData{Item: &item}, CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&models.OrderEvent{OrderID: 2, Sequence: 2, Type: models.OrderEventItemChanged, Data: models.OrderEventData{Item: &item}, CreatedAt: now}).Error)
+	require.NoError(t, db.Create(&models.OrderEvent{OrderID: 2, Sequence: 3, Type: models.OrderEventStatusChanged, Data: models.OrderEventData{Status: &status}, CreatedAt: now}).Error)
+
+	t.Run("delivers the subscribed events, signed and in order", func(t *testing.T) {
+		delivered, err := webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, delivered)
+		require.Len(t, deliveries, 2)
+
+		assert.Equal(t, "evt_2", deliveries[0].header.Get(webhook.IDHeader))
+		assert.Equal(t, models.OrderEventCreated, deliveries[0].header.Get(webhook.EventHeader))
+		assert.Equal(t, "evt_4", deliveries[1].header.Get(webhook.IDHeader))
+
+		verifier := webhook.NewVerifier(secret).WithClock(func() time.Time { return now })
+		for _, d := range deliveries {
+			require.NoError(t, verifier.Verify(d.header, d.body))
+		}
+		assert.ErrorIs(t, verifier.Verify(deliveries[0].header, deliveries[0].body), webhook.ErrReplayed)
+		assert.ErrorIs(t, webhook.NewVerifier("whsec_other").WithClock(func() time.Time { return now }).Verify(deliveries[0].header, deliveries[0].body), webhook.ErrInvalidSignature)
+
+		stored, err := webhooks.Get(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint(4), stored.LastEventID)
+		require.NotNil(t, stored.LastDeliveredAt)
+
+		delivered, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, delivered)
+		assert.Len(t, deliveries, 2)
+	})
+
+	t.Run("signs with the previous secret during the grace period", func(t *testing.T) {
+		rotated, err := webhooks.RotateSecret(ctx, sub.ID, time.Hour)
+		require.NoError(t, err)
+		assert.NotEqual(t, secret, rotated.SigningSecret)
+		require.NotNil(t, rotated.PreviousSecretExpiresAt)
+		assert.Equal(t, now.Add(time.Hour), *rotated.PreviousSecretExpiresAt)
+
+		deliveries = nil
+		require.NoError(t, db.Create(&models.OrderEvent{OrderID: 3, Sequence: 1, Type: models.OrderEventCreated, Data: models.OrderEventData{Item: &item}, CreatedAt: now}).Error)
+		_, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		require.Len(t, deliveries, 1)
+		assert.Len(t, strings.Split(deliveries[0].header.Get(webhook.SignatureHeader), ","), 2)
+		clock := func() time.Time { return now }
+		require.NoError(t, webhook.NewVerifier(secret).WithClock(clock).Verify(deliveries[0].header, deliveries[0].body))
+		require.NoError(t, webhook.NewVerifier(rotated.SigningSecret).WithClock(clock).Verify(deliveries[0].header, deliveries[0].body))
+
+		// no grace drops the old secret at once
+		rotated, err = webhooks.RotateSecret(ctx, sub.ID, 0)
+		require.NoError(t, err)
+		assert.Nil(t, rotated.PreviousSecretExpiresAt)
+		assert.Equal(t, []string{rotated.SigningSecret}, webhooks.signingSecrets(rotated))
+		secret = rotated.SigningSecret
+	})
+
+	t.Run("backs off after a failure and resumes from the failed event", func(t *testing.T) {
+		deliveries = nil
+		status500 = true
+		require.NoError(t, db.Create(&models.OrderEvent{OrderID: 3, Sequence: 2, Type: models.OrderEventStatusChanged, Data: models.OrderEventData{Status: &status}, CreatedAt: now}).Error)
+
+		delivered, err := webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Zero(t, delivered)
+		stored, err := webhooks.Get(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, stored.Failures)
+		assert.Contains(t, stored.LastError, "status 500: unavailable")
+		require.NotNil(t, stored.NextAttemptAt)
+		assert.Equal(t, now.Add(time.Minute), stored.NextAttemptAt.UTC())
+
+		// waiting out the backoff
+		_, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Len(t, deliveries, 1)
+
+		now = now.Add(time.Minute)
+		_, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		stored, err = webhooks.Get(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, stored.Failures)
+		assert.Equal(t, now.Add(2*time.Minute), stored.NextAttemptAt.UTC())
+
+		status500 = false
+		now = now.Add(2 * time.Minute)
+		delivered, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+		require.Len(t, deliveries, 3)
+		assert.Equal(t, deliveries[0].header.Get(webhook.IDHeader), deliveries[2].header.Get(webhook.IDHeader))
+
+		stored, err = webhooks.Get(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Zero(t, stored.Failures)
+		assert.Empty(t, stored.LastError)
+		assert.Nil(t, stored.NextAttemptAt)
+	})
+
+	t.Run("paused subscriptions get nothing", func(t *testing.T) {
+		inactive := false
+		updated, err := webhooks.Update(ctx, sub.ID, models.UpdateWebhookSubscriptionRequest{Active: &inactive, Events: &[]string{}})
+		require.NoError(t, err)
+		assert.False(t, updated.Active)
+		assert.Empty(t, updated.Events)
+
+		deliveries = nil
+		require.NoError(t, db.Create(&models.OrderEvent{OrderID: 4, Sequence: 1, Type: models.OrderEventCreated, Data: models.OrderEventData{Item: &item}, CreatedAt: now}).Error)
+		_, err = webhooks.Deliver(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+
+		_, err = webhooks.Delete(ctx, sub.ID)
+		require.NoError(t, err)
+		_, err = webhooks.Get(ctx, sub.ID)
+		assert.ErrorIs(t, err, ErrWebhookNotFound)
+	})
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// marketingOptOut is added to campaign messages that do not already say
+// how to opt out
+const marketingOptOut = "reply STOP to opt out"
+
+// WinBackPolicy sets who the win-back campaign texts and what it says
+type WinBackPolicy struct {
+	// Message is the text sent, with {name} replaced by the customer's
+	// name. The campaign is off without one.
+	Message string
+	// InactiveAfter is how long since their last order before a customer
+	// is texted. Each customer is texted once per lapse.
+	InactiveAfter time.Duration
+	// ReactivationWindow is how long after a message an order counts as
+	// won back by it
+	ReactivationWindow time.Duration
+	// BatchSize caps the customers texted per run
+	BatchSize int
+	// MaxAttempts is how many times a failed message is tried per lapse
+	MaxAttempts int
+}
+
+func DefaultWinBackPolicy() WinBackPolicy {
+	return WinBackPolicy{
+		InactiveAfter:      90 * 24 * time.Hour,
+		ReactivationWindow: 30 * 24 * time.Hour,
+		BatchSize:          500,
+		MaxAttempts:        3,
+	}
+}
+
+// WinBackPolicyFromEnv reads WINBACK_MESSAGE, WINBACK_INACTIVE_DAYS,
+// WINBACK_REACTIVATION_DAYS and WINBACK_BATCH_SIZE over the defaults
+func WinBackPolicyFromEnv() WinBackPolicy {
+	policy := DefaultWinBackPolicy()
+	policy.Message = strings.TrimSpace(os.Getenv("WINBACK_MESSAGE"))
+
+	if n, err := strconv.Atoi(os.Getenv("WINBACK_INACTIVE_DAYS")); err == nil && n > 0 {
+		policy.InactiveAfter = time.Duration(n) * 24 * time.Hour
+	}
+	if n, err := strconv.Atoi(os.Getenv("WINBACK_REACTIVATION_DAYS")); err == nil && n > 0 {
+		policy.ReactivationWindow = time.Duration(n) * 24 * time.Hour
+	}
+	if n, err := strconv.Atoi(os.Getenv("WINBACK_BATCH_SIZE")); err == nil && n > 0 {
+		policy.BatchSize = n
+	}
+	return policy
+}
+
+// WithDefaults fills unset fields from DefaultWinBackPolicy
+func (p WinBackPolicy) WithDefaults() WinBackPolicy {
+	defaults := DefaultWinBackPolicy()
+	if p.InactiveAfter <= 0 {
+		p.InactiveAfter = defaults.InactiveAfter
+	}
+	if p.ReactivationWindow <= 0 {
+		p.ReactivationWindow = defaults.ReactivationWindow
+	}
+	if p.BatchSize <= 0 {
+		p.BatchSize = defaults.BatchSize
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	return p
+}
+
+// Enabled reports whether there is a message to send
+func (p WinBackPolicy) Enabled() bool {
+	return p.Message != ""
+}
+
+// WinBackService texts customers who stopped ordering and tracks which of
+// them came back
+type WinBackService struct {
+	db     *gorm.DB
+	sms    SMSServiceInterface
+	policy WinBackPolicy
+	now    func() time.Time
+}
+
+func NewWinBackService(db *gorm.DB, sms SMSServiceInterface, policy WinBackPolicy) *WinBackService {
+	return &WinBackService{
+		db:     db,
+		sms:    sms,
+		policy: policy.WithDefaults(),
+		now:    time.Now,
+	}
+}
+
+// Run records the orders that won customers back since the last run, then
+// texts the customers who have been inactive for InactiveAfter, have not
+// opted out and have not been texted since their last order. It returns
+// how many messages were sent.
+func (s *WinBackService) Run(ctx context.Context) (int, error) {
+	if err := s.MarkReactivated(ctx); err != nil {
+		return 0, err
+	}
+	if !s.policy.Enabled() {
+		return 0, nil
+	}
+
+	db := s.db.WithContext(ctx)
+	now := s.now()
+
+	var customers []models.Customer
+	err := db.Where("last_order_at < ? AND marketing_opt_out_at IS NULL AND anonymized_at IS NULL", now.Add(-s.policy.InactiveAfter)).
+		Where("NOT EXISTS (SELECT 1 FROM win_back_messages w WHERE w.customer_id = customers.id AND w.sent_at > customers.last_order_at AND w.sent = ?)", true).
+		Where("(SELECT COUNT(*) FROM win_back_messages w WHERE w.customer_id = customers.id AND w.sent_at > customers.last_order_at) < ?", s.policy.MaxAttempts).
+		Order("last_order_at ASC").Limit(s.policy.BatchSize).
+		Find(&customers).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find inactive customers: %w", err)
+	}
+
+	sent := 0
+	for _, customer := range customers {
+		if err := ctx.Err(); err != nil {
+			return sent, err
+		}
+
+		message := models.WinBackMessage{
+			CustomerID:  customer.ID,
+			LastOrderAt: *customer.LastOrderAt,
+			SentAt:      s.now(),
+		}
+		if err := s.sms.SendSMS(ctx, customer.Phone, s.message(customer)); err != nil {
+			log.Printf("failed to send win-back sms to customer %d: %v", customer.ID, err)
+			message.Error = err.Error()
+		} else {
+			message.Sent = true
+			sent++
+		}
+		if err := db.Create(&message).Error; err != nil {
+			return sent, fmt.Errorf("failed to record win-back sms to customer %d: %w", customer.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+// message fills in the customer's name and makes sure the text says how
+// to opt out
+func (s *WinBackService) message(customer models.Customer) string {
+	return withOptOut(strings.ReplaceAll(s.policy.Message, "{name}", customer.Name))
+}
+
+// withOptOut makes sure a campaign message says how to opt out
+func withOptOut(message string) string {
+	if !strings.Contains(strings.ToUpper(message), "STOP") {
+		message += ". " + marketingOptOut
+	}
+	return message
+}
+
+// MarkReactivated records, against each sent message still within the
+// reactivation window, the first order its customer placed after it
+func (s *WinBackService) MarkReactivated(ctx context.Context) error {
+	db := s.db.WithContext(ctx)
+
+	var messages []models.WinBackMessage
+	err := db.Where("sent = ? AND reactivated_at IS NULL AND sent_at >= ?", true, s.now().Add(-s.policy.ReactivationWindow)).
+		Find(&messages).Error
+	if err != nil {
+		return fmt.Errorf("failed to find win-back messages: %w", err)
+	}
+
+	for _, message := range messages {
+		var order models.Order
+		err := db.Where("customer_id = ? AND created_at > ? AND created_at <= ?",
+			message.CustomerID, message.SentAt, message.SentAt.Add(s.policy.ReactivationWindow)).
+			Order("created_at ASC").First(&order).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to look up orders of customer %d: %w", message.CustomerID, err)
+		}
+
+		err = db.Model(&message).Updates(map[string]interface{}{
+			"reactivated_at":        order.CreatedAt,
+			"reactivation_order_id": order.ID,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report counts the win-back messages sent from from up to the end of to,
+// and lists the customers they won back
+func (s *WinBackService) Report(ctx context.Context, from, to time.Time) (models.WinBackReport, error) {
+	report := models.WinBackReport{Customers: []models.WinBackReactivation{}}
+	if err := s.MarkReactivated(ctx); err != nil {
+		return report, err
+	}
+
+	db := s.db.WithContext(ctx)
+	end := to.AddDate(0, 0, 1)
+
+	var counts struct {
+		Sent, Failed, Reactivated int64
+	}
+	err := db.Model(&models.WinBackMessage{}).Where("sent_at >= ? AND sent_at < ?", from, end).
+		Select("COALESCE(SUM(CASE WHEN sent = ? THEN 1 ELSE 0 END), 0) AS sent, "+
+			"COALESCE(SUM(CASE WHEN sent = ? THEN 0 ELSE 1 END), 0) AS failed, "+
+			"COUNT(reactivated_at) AS reactivated", true, true).
+		Scan(&counts).Error
+	if err != nil {
+		return report, err
+	}
+	report.MessagesSent, report.MessagesFailed, report.Reactivated = counts.Sent, counts.Failed, counts.Reactivated
+	if report.MessagesSent > 0 {
+		report.ReactivationRate = float64(report.Reactivated) / float64(report.MessagesSent)
+	}
+
+	err = db.Table("win_back_messages").
+		Select("win_back_messages.customer_id, customers.name, customers.code, win_back_messages.last_order_at, "+
+			"win_back_messages.sent_at, win_back_messages.reactivated_at, orders.id AS order_id, orders.amount").
+		Joins("JOIN customers ON customers.id = win_back_messages.customer_id").
+		Joins("JOIN orders ON orders.id = win_back_messages.reactivation_order_id").
+		Where("win_back_messages.sent_at >= ? AND win_back_messages.sent_at < ?", from, end).
+		Order("win_back_messages.reactivated_at ASC").
+		Scan(&report.Customers).Error
+	if err != nil {
+		return report, err
+	}
+	return report, nil
+}
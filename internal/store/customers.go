@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormCustomers struct {
+	db *gorm.DB
+}
+
+// NewCustomerStore keeps customers in db
+func NewCustomerStore(db *gorm.DB) CustomerStore {
+	return &gormCustomers{db: db}
+}
+
+func (s *gormCustomers) Customer(ctx context.Context, id uint) (models.Customer, error) {
+	var customer models.Customer
+	err := s.db.WithContext(ctx).First(&customer, id).Error
+	return customer, err
+}
+
+func (s *gormCustomers) Customers(ctx context.Context, page scopes.Page) ([]models.Customer, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Customer{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var customers []models.Customer
+	if err := query.Order("id").Scopes(scopes.Paginate(page)).Find(&customers).Error; err != nil {
+		return nil, 0, err
+	}
+	return customers, total, nil
+}
+
+func (s *gormCustomers) Create(ctx context.Context, customer *models.Customer) error {
+	return s.db.WithContext(ctx).Create(customer).Error
+}
+
+func (s *gormCustomers) Save(ctx context.Context, customer *models.Customer) error {
+	return s.db.WithContext(ctx).Save(customer).Error
+}
+
+func (s *gormCustomers) Delete(ctx context.Context, customer *models.Customer) error {
+	return s.db.WithContext(ctx).Delete(customer).Error
+}
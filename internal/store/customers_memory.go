@@ -0,0 +1,134 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// MemoryCustomerStore is a CustomerStore kept in memory, for tests. Deleted
+// customers stay in it, hidden, as soft-deleted rows do.
+type MemoryCustomerStore struct {
+	mu        sync.Mutex
+	customers map[uint]models.Customer
+	nextID    uint
+	now       func() time.Time
+}
+
+func NewMemoryCustomerStore() *MemoryCustomerStore {
+	return &MemoryCustomerStore{
+		customers: map[uint]models.Customer{},
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryCustomerStore) Customer(_ context.Context, id uint) (models.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	customer, ok := s.customers[id]
+	if !ok || customer.DeletedAt.Valid {
+		return models.Customer{}, gorm.ErrRecordNotFound
+	}
+	return customer, nil
+}
+
+func (s *MemoryCustomerStore) Customers(_ context.Context, page scopes.Page) ([]models.Customer, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	customers := []models.Customer{}
+	for _, customer := range s.customers {
+		if !customer.DeletedAt.Valid {
+			customers = append(customers, customer)
+		}
+	}
+	slices.SortFunc(customers, func(a, b models.Customer) int { return cmp.Compare(a.ID, b.ID) })
+	return paginate(customers, page), int64(len(customers)), nil
+}
+
+func (s *MemoryCustomerStore) Create(_ context.Context, customer *models.Customer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := customer.BeforeSave(nil); err != nil {
+		return err
+	}
+	if err := s.checkUnique(*customer); err != nil {
+		return err
+	}
+	s.nextID++
+	customer.ID = s.nextID
+	now := s.now()
+	if customer.CreatedAt.IsZero() {
+		customer.CreatedAt = now
+	}
+	customer.UpdatedAt = now
+	s.customers[customer.ID] = *customer
+	return nil
+}
+
+func (s *MemoryCustomerStore) Save(ctx context.Context, customer *models.Customer) error {
+	if customer.ID == 0 {
+		return s.Create(ctx, customer)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := customer.BeforeSave(nil); err != nil {
+		return err
+	}
+	if err := s.checkUnique(*customer); err != nil {
+		return err
+	}
+	customer.UpdatedAt = s.now()
+	s.customers[customer.ID] = *customer
+	return nil
+}
+
+func (s *MemoryCustomerStore) Delete(_ context.Context, customer *models.Customer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.customers[customer.ID]
+	if !ok {
+		return nil
+	}
+	stored.DeletedAt = gorm.DeletedAt{Time: s.now(), Valid: true}
+	s.customers[customer.ID] = stored
+	return nil
+}
+
+// touchLastOrder moves the customer's last_order_at forward to placed, as
+// models.Order.AfterCreate does
+func (s *MemoryCustomerStore) touchLastOrder(customerID uint, placed time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	customer, ok := s.customers[customerID]
+	if !ok || (customer.LastOrderAt != nil && !customer.LastOrderAt.Before(placed)) {
+		return
+	}
+	customer.LastOrderAt = &placed
+	s.customers[customerID] = customer
+}
+
+// checkUnique enforces the unique indexes on code and email_hash, which
+// deleted customers still hold
+func (s *MemoryCustomerStore) checkUnique(customer models.Customer) error {
+	for _, other := range s.customers {
+		if other.ID == customer.ID {
+			continue
+		}
+		if other.Code == customer.Code {
+			return uniqueViolation("customers.code")
+		}
+		if other.EmailHash != nil && customer.EmailHash != nil && *other.EmailHash == *customer.EmailHash {
+			return uniqueViolation("customers.email_hash")
+		}
+	}
+	return nil
+}
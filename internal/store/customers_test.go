@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// customerStoreFactory returns an empty CustomerStore
+type customerStoreFactory func(t *testing.T) CustomerStore
+
+func TestMemoryCustomerStore(t *testing.T) {
+	testCustomerStore(t, func(t *testing.T) CustomerStore {
+		return NewMemoryCustomerStore()
+	})
+}
+
+// testCustomerStore is the contract every CustomerStore implementation must
+// meet
+func testCustomerStore(t *testing.T, newStore customerStoreFactory) {
+	ctx := context.Background()
+
+	t.Run("create, change and delete", func(t *testing.T) {
+		customers := newStore(t)
+
+		customer := models.Customer{Name: "Sebbie Chanzu", Code: " CUST001 ", Phone: "+254740827150", Email: " Sebbievilar2@Gmail.com"}
+		assert.NoError(t, customers.Create(ctx, &customer))
+		assert.NotZero(t, customer.ID)
+		assert.False(t, customer.CreatedAt.IsZero())
+		assert.Equal(t, "CUST001", customer.Code)
+		assert.Equal(t, "sebbievilar2@gmail.com", customer.Email)
+		assert.NotEmpty(t, customer.PhoneHash)
+
+		found, err := customers.Customer(ctx, customer.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Sebbie Chanzu", found.Name)
+		assert.Equal(t, "+254740827150", found.Phone)
+
+		_, err = customers.Customer(ctx, customer.ID+1)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		found.Name = "Sebbie Vilar"
+		found.Email = "sebbie@example.com"
+		assert.NoError(t, customers.Save(ctx, &found))
+		found, err = customers.Customer(ctx, customer.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Sebbie Vilar", found.Name)
+		assert.Equal(t, "sebbie@example.com", found.Email)
+		assert.NotEqual(t, customer.EmailHash, found.EmailHash, "the blind index follows the email")
+
+		assert.NoError(t, customers.Delete(ctx, &found))
+		_, err = customers.Customer(ctx, customer.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("code and email are unique", func(t *testing.T) {
+		customers := newStore(t)
+
+		customer := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"}
+		assert.NoError(t, customers.Create(ctx, &customer))
+
+		sameCode := models.Customer{Name: "Jane Wanjiku", Code: "CUST001 ", Phone: "+254711000002"}
+		assert.ErrorContains(t, customers.Create(ctx, &sameCode), "UNIQUE constraint failed")
+		sameEmail := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "SEBBIEVILAR2@gmail.com"}
+		assert.ErrorContains(t, customers.Create(ctx, &sameEmail), "UNIQUE constraint failed")
+
+		noEmail := models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002"}
+		assert.NoError(t, customers.Create(ctx, &noEmail))
+		alsoNoEmail := models.Customer{Name: "Amina Hassan", Code: "CUST003", Phone: "+254711222333"}
+		assert.NoError(t, customers.Create(ctx, &alsoNoEmail), "any number of customers can leave the email out")
+
+		noEmail.Code = "CUST003"
+		assert.ErrorContains(t, customers.Save(ctx, &noEmail), "UNIQUE constraint failed")
+
+		assert.NoError(t, customers.Delete(ctx, &customer))
+		again := models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150"}
+		assert.ErrorContains(t, customers.Create(ctx, &again), "UNIQUE constraint failed", "a deleted customer's code stays taken")
+	})
+
+	t.Run("customers list in the order they were created", func(t *testing.T) {
+		customers := newStore(t)
+
+		var created []models.Customer
+		for _, code := range []string{"CUST001", "CUST002", "CUST003"} {
+			customer := models.Customer{Name: "Customer " + code, Code: code, Phone: "+254740827150"}
+			assert.NoError(t, customers.Create(ctx, &customer))
+			created = append(created, customer)
+		}
+		assert.NoError(t, customers.Delete(ctx, &created[1]))
+
+		tests := []struct {
+			name          string
+			page          scopes.Page
+			expectedIDs   []uint
+			expectedTotal int64
+		}{
+			{name: "first page", page: scopes.Page{Page: 1, Limit: 10}, expectedIDs: []uint{created[0].ID, created[2].ID}, expectedTotal: 2},
+			{name: "second page", page: scopes.Page{Page: 2, Limit: 1}, expectedIDs: []uint{created[2].ID}, expectedTotal: 2},
+			{name: "past the end", page: scopes.Page{Page: 3, Limit: 1}, expectedIDs: []uint{}, expectedTotal: 2},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, total, err := customers.Customers(ctx, tt.page)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedTotal, total)
+				assert.Equal(t, tt.expectedIDs, customerIDs(found))
+			})
+		}
+	})
+}
+
+func customerIDs(customers []models.Customer) []uint {
+	ids := []uint{}
+	for _, customer := range customers {
+		ids = append(ids, customer.ID)
+	}
+	return ids
+}
@@ -0,0 +1,51 @@
+//go:build cgo
+
+package store
+
+import (
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// The GORM implementations are checked against SQLite, which needs cgo.
+// The fakes are not, so CGO_ENABLED=0 go test still runs the contract
+// against them.
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
+
+func TestGormNoteStore(t *testing.T) {
+	testNoteStore(t, func(t *testing.T) (NoteStore, func(models.Customer) models.Customer) {
+		db := setupTestDB(t)
+		return NewNoteStore(db), func(customer models.Customer) models.Customer {
+			if err := db.Create(&customer).Error; err != nil {
+				t.Fatalf("failed to create customer: %v", err)
+			}
+			return customer
+		}
+	})
+}
+
+func TestGormCustomerStore(t *testing.T) {
+	testCustomerStore(t, func(t *testing.T) CustomerStore {
+		return NewCustomerStore(setupTestDB(t))
+	})
+}
+
+func TestGormOrderStore(t *testing.T) {
+	testOrderStore(t, func(t *testing.T) (OrderStore, CustomerStore) {
+		db := setupTestDB(t)
+		return NewOrderStore(db), NewCustomerStore(db)
+	})
+}
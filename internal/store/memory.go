@@ -0,0 +1,19 @@
+package store
+
+import (
+	"fmt"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+)
+
+// paginate returns the rows on page, as scopes.Paginate would select them
+func paginate[T any](rows []T, page scopes.Page) []T {
+	start := min((page.Page-1)*page.Limit, len(rows))
+	end := min(start+page.Limit, len(rows))
+	return rows[start:end]
+}
+
+// uniqueViolation is the error SQLite returns when column is taken
+func uniqueViolation(column string) error {
+	return fmt.Errorf("UNIQUE constraint failed: %s", column)
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// NotesOrder lists pinned notes first, then the newest
+const NotesOrder = "pinned DESC, created_at DESC, id DESC"
+
+type gormNotes struct {
+	db *gorm.DB
+}
+
+// NewNoteStore keeps notes in db
+func NewNoteStore(db *gorm.DB) NoteStore {
+	return &gormNotes{db: db}
+}
+
+func (s *gormNotes) Customer(ctx context.Context, id uint) (models.Customer, error) {
+	var customer models.Customer
+	err := s.db.WithContext(ctx).First(&customer, id).Error
+	return customer, err
+}
+
+func (s *gormNotes) Notes(ctx context.Context, customerID uint) ([]models.CustomerNote, error) {
+	var notes []models.CustomerNote
+	err := s.db.WithContext(ctx).Where("customer_id = ?", customerID).Order(NotesOrder).Find(&notes).Error
+	return notes, err
+}
+
+func (s *gormNotes) Note(ctx context.Context, customerID, noteID uint) (models.CustomerNote, error) {
+	var note models.CustomerNote
+	err := s.db.WithContext(ctx).Where("customer_id = ?", customerID).First(&note, noteID).Error
+	return note, err
+}
+
+func (s *gormNotes) Create(ctx context.Context, note *models.CustomerNote) error {
+	return s.db.WithContext(ctx).Create(note).Error
+}
+
+func (s *gormNotes) Save(ctx context.Context, note *models.CustomerNote) error {
+	return s.db.WithContext(ctx).Save(note).Error
+}
+
+func (s *gormNotes) Delete(ctx context.Context, note *models.CustomerNote) error {
+	return s.db.WithContext(ctx).Delete(note).Error
+}
+
+func (s *gormNotes) Search(ctx context.Context, search NoteSearch, page scopes.Page) ([]models.CustomerNote, int64, error) {
+	pattern := "%" + scopes.EscapeLike(strings.ToLower(search.Text)) + "%"
+	query := s.db.WithContext(ctx).Model(&models.CustomerNote{}).
+		Where("LOWER(text) LIKE ? "+scopes.LikeEscape, pattern).
+		Scopes(scopes.ByCustomer(search.CustomerID), scopes.CreatedBetween(search.CreatedFrom, search.CreatedTo))
+	if search.Author != "" {
+		query = query.Where("author = ?", search.Author)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var notes []models.CustomerNote
+	if err := query.Order("created_at DESC, id DESC").Scopes(scopes.Paginate(page)).Find(&notes).Error; err != nil {
+		return nil, 0, err
+	}
+	return notes, total, nil
+}
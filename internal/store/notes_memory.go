@@ -0,0 +1,144 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// MemoryNoteStore is a NoteStore kept in memory, for tests. Customers are
+// not managed through it; add the ones the test needs with AddCustomer.
+type MemoryNoteStore struct {
+	mu        sync.Mutex
+	customers map[uint]models.Customer
+	notes     map[uint]models.CustomerNote
+	nextID    uint
+	now       func() time.Time
+}
+
+func NewMemoryNoteStore() *MemoryNoteStore {
+	return &MemoryNoteStore{
+		customers: map[uint]models.Customer{},
+		notes:     map[uint]models.CustomerNote{},
+		now:       time.Now,
+	}
+}
+
+// AddCustomer makes customer known to the store
+func (s *MemoryNoteStore) AddCustomer(customer models.Customer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customers[customer.ID] = customer
+}
+
+func (s *MemoryNoteStore) Customer(_ context.Context, id uint) (models.Customer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	customer, ok := s.customers[id]
+	if !ok {
+		return models.Customer{}, gorm.ErrRecordNotFound
+	}
+	return customer, nil
+}
+
+func (s *MemoryNoteStore) Notes(_ context.Context, customerID uint) ([]models.CustomerNote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notes := []models.CustomerNote{}
+	for _, note := range s.notes {
+		if note.CustomerID == customerID {
+			notes = append(notes, note)
+		}
+	}
+	slices.SortFunc(notes, func(a, b models.CustomerNote) int {
+		if a.Pinned != b.Pinned {
+			if a.Pinned {
+				return -1
+			}
+			return 1
+		}
+		return newestFirst(a, b)
+	})
+	return notes, nil
+}
+
+func (s *MemoryNoteStore) Note(_ context.Context, customerID, noteID uint) (models.CustomerNote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	note, ok := s.notes[noteID]
+	if !ok || note.CustomerID != customerID {
+		return models.CustomerNote{}, gorm.ErrRecordNotFound
+	}
+	return note, nil
+}
+
+func (s *MemoryNoteStore) Create(_ context.Context, note *models.CustomerNote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	note.ID = s.nextID
+	now := s.now()
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = now
+	}
+	note.UpdatedAt = now
+	s.notes[note.ID] = *note
+	return nil
+}
+
+func (s *MemoryNoteStore) Save(ctx context.Context, note *models.CustomerNote) error {
+	if note.ID == 0 {
+		return s.Create(ctx, note)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	note.UpdatedAt = s.now()
+	s.notes[note.ID] = *note
+	return nil
+}
+
+func (s *MemoryNoteStore) Delete(_ context.Context, note *models.CustomerNote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notes, note.ID)
+	return nil
+}
+
+func (s *MemoryNoteStore) Search(_ context.Context, search NoteSearch, page scopes.Page) ([]models.CustomerNote, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := strings.ToLower(search.Text)
+	matches := []models.CustomerNote{}
+	for _, note := range s.notes {
+		switch {
+		case !strings.Contains(strings.ToLower(note.Text), text),
+			search.CustomerID != 0 && note.CustomerID != search.CustomerID,
+			search.Author != "" && note.Author != search.Author,
+			!search.CreatedFrom.IsZero() && note.CreatedAt.Before(search.CreatedFrom),
+			!search.CreatedTo.IsZero() && !note.CreatedAt.Before(search.CreatedTo):
+			continue
+		}
+		matches = append(matches, note)
+	}
+	slices.SortFunc(matches, newestFirst)
+
+	return paginate(matches, page), int64(len(matches)), nil
+}
+
+func newestFirst(a, b models.CustomerNote) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+	return cmp.Compare(b.ID, a.ID)
+}
@@ -0,0 +1,144 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// noteStoreFactory returns an empty NoteStore and a way to add customers
+// to it
+type noteStoreFactory func(t *testing.T) (NoteStore, func(models.Customer) models.Customer)
+
+func TestMemoryNoteStore(t *testing.T) {
+	testNoteStore(t, func(t *testing.T) (NoteStore, func(models.Customer) models.Customer) {
+		notes := NewMemoryNoteStore()
+		nextID := uint(0)
+		return notes, func(customer models.Customer) models.Customer {
+			nextID++
+			customer.ID = nextID
+			notes.AddCustomer(customer)
+			return customer
+		}
+	})
+}
+
+// testNoteStore is the contract every NoteStore implementation must meet
+func testNoteStore(t *testing.T, newStore noteStoreFactory) {
+	ctx := context.Background()
+	base := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("customer lookup", func(t *testing.T) {
+		notes, addCustomer := newStore(t)
+		customer := addCustomer(models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+
+		found, err := notes.Customer(ctx, customer.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, customer.ID, found.ID)
+		assert.Equal(t, "Sebbie Chanzu", found.Name)
+
+		_, err = notes.Customer(ctx, customer.ID+1)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("create, change and delete", func(t *testing.T) {
+		notes, addCustomer := newStore(t)
+		customer := addCustomer(models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+
+		note := models.CustomerNote{CustomerID: customer.ID, Author: "manager@example.com", Text: "Called about the late delivery"}
+		assert.NoError(t, notes.Create(ctx, &note))
+		assert.NotZero(t, note.ID)
+		assert.False(t, note.CreatedAt.IsZero())
+
+		_, err := notes.Note(ctx, customer.ID+1, note.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound, "notes are only found under their customer")
+
+		note.Text = "Refund agreed"
+		note.Pinned = true
+		assert.NoError(t, notes.Save(ctx, &note))
+
+		found, err := notes.Note(ctx, customer.ID, note.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "Refund agreed", found.Text)
+		assert.True(t, found.Pinned)
+		assert.Equal(t, "manager@example.com", found.Author)
+
+		assert.NoError(t, notes.Delete(ctx, &note))
+		_, err = notes.Note(ctx, customer.ID, note.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("notes list pinned first then newest", func(t *testing.T) {
+		notes, addCustomer := newStore(t)
+		customer := addCustomer(models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+		other := addCustomer(models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"})
+
+		oldest := models.CustomerNote{CustomerID: customer.ID, Author: "a@example.com", Text: "first", CreatedAt: base}
+		pinned := models.CustomerNote{CustomerID: customer.ID, Author: "a@example.com", Text: "pinned", Pinned: true, CreatedAt: base.Add(time.Hour)}
+		newest := models.CustomerNote{CustomerID: customer.ID, Author: "a@example.com", Text: "latest", CreatedAt: base.Add(2 * time.Hour)}
+		foreign := models.CustomerNote{CustomerID: other.ID, Author: "a@example.com", Text: "other", CreatedAt: base}
+		for _, note := range []*models.CustomerNote{&oldest, &pinned, &newest, &foreign} {
+			assert.NoError(t, notes.Create(ctx, note))
+		}
+
+		list, err := notes.Notes(ctx, customer.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint{pinned.ID, newest.ID, oldest.ID}, noteIDs(list))
+
+		list, err = notes.Notes(ctx, customer.ID+other.ID)
+		assert.NoError(t, err)
+		assert.Empty(t, list)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		notes, addCustomer := newStore(t)
+		customer := addCustomer(models.Customer{Name: "Sebbie Chanzu", Code: "CUST001", Phone: "+254740827150", Email: "sebbievilar2@gmail.com"})
+		other := addCustomer(models.Customer{Name: "Jane Wanjiku", Code: "CUST002", Phone: "+254711000002", Email: "jane@example.com"})
+
+		refund := models.CustomerNote{CustomerID: customer.ID, Author: "manager@example.com", Text: "Refund agreed after call", CreatedAt: base}
+		policy := models.CustomerNote{CustomerID: other.ID, Author: "other@example.com", Text: "asked about REFUND policy", CreatedAt: base.Add(24 * time.Hour)}
+		happy := models.CustomerNote{CustomerID: other.ID, Author: "other@example.com", Text: "100% happy with delivery", CreatedAt: base.Add(48 * time.Hour)}
+		for _, note := range []*models.CustomerNote{&refund, &policy, &happy} {
+			assert.NoError(t, notes.Create(ctx, note))
+		}
+
+		firstPage := scopes.Page{Page: 1, Limit: 10}
+		tests := []struct {
+			name          string
+			search        NoteSearch
+			page          scopes.Page
+			expectedIDs   []uint
+			expectedTotal int64
+		}{
+			{name: "case insensitive, newest first", search: NoteSearch{Text: "refund"}, page: firstPage, expectedIDs: []uint{policy.ID, refund.ID}, expectedTotal: 2},
+			{name: "by customer", search: NoteSearch{Text: "refund", CustomerID: other.ID}, page: firstPage, expectedIDs: []uint{policy.ID}, expectedTotal: 1},
+			{name: "by author", search: NoteSearch{Text: "refund", Author: "manager@example.com"}, page: firstPage, expectedIDs: []uint{refund.ID}, expectedTotal: 1},
+			{name: "wildcards are literal", search: NoteSearch{Text: "%"}, page: firstPage, expectedIDs: []uint{happy.ID}, expectedTotal: 1},
+			{name: "created range", search: NoteSearch{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(48 * time.Hour)}, page: firstPage, expectedIDs: []uint{policy.ID}, expectedTotal: 1},
+			{name: "second page", search: NoteSearch{}, page: scopes.Page{Page: 2, Limit: 2}, expectedIDs: []uint{refund.ID}, expectedTotal: 3},
+			{name: "past the end", search: NoteSearch{}, page: scopes.Page{Page: 3, Limit: 2}, expectedIDs: []uint{}, expectedTotal: 3},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, total, err := notes.Search(ctx, tt.search, tt.page)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedTotal, total)
+				assert.Equal(t, tt.expectedIDs, noteIDs(found))
+			})
+		}
+	})
+}
+
+func noteIDs(notes []models.CustomerNote) []uint {
+	ids := []uint{}
+	for _, note := range notes {
+		ids = append(ids, note.ID)
+	}
+	return ids
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+type gormOrders struct {
+	db *gorm.DB
+}
+
+// NewOrderStore keeps orders in db
+func NewOrderStore(db *gorm.DB) OrderStore {
+	return &gormOrders{db: db}
+}
+
+func (s *gormOrders) Order(ctx context.Context, id uint) (models.Order, error) {
+	var order models.Order
+	err := s.db.WithContext(ctx).First(&order, id).Error
+	return order, err
+}
+
+func (s *gormOrders) Orders(ctx context.Context, customerID uint, page scopes.Page) ([]models.Order, int64, error) {
+	query := s.db.WithContext(ctx).Model(&models.Order{}).Scopes(scopes.ByCustomer(customerID))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var orders []models.Order
+	if err := query.Order("id").Scopes(scopes.Paginate(page)).Find(&orders).Error; err != nil {
+		return nil, 0, err
+	}
+	return orders, total, nil
+}
+
+func (s *gormOrders) Create(ctx context.Context, order *models.Order) error {
+	return s.db.WithContext(ctx).Create(order).Error
+}
+
+func (s *gormOrders) Save(ctx context.Context, order *models.Order) error {
+	return s.db.WithContext(ctx).Save(order).Error
+}
+
+func (s *gormOrders) Delete(ctx context.Context, order *models.Order) error {
+	return s.db.WithContext(ctx).Delete(order).Error
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// MemoryOrderStore is an OrderStore kept in memory, for tests. Orders are
+// placed for the customers in the MemoryCustomerStore it is given, which
+// is how their last_order_at moves.
+type MemoryOrderStore struct {
+	mu        sync.Mutex
+	customers *MemoryCustomerStore
+	orders    map[uint]models.Order
+	nextID    uint
+	now       func() time.Time
+}
+
+func NewMemoryOrderStore(customers *MemoryCustomerStore) *MemoryOrderStore {
+	return &MemoryOrderStore{
+		customers: customers,
+		orders:    map[uint]models.Order{},
+		now:       time.Now,
+	}
+}
+
+func (s *MemoryOrderStore) Order(_ context.Context, id uint) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	order, ok := s.orders[id]
+	if !ok || order.DeletedAt.Valid {
+		return models.Order{}, gorm.ErrRecordNotFound
+	}
+	return order, nil
+}
+
+func (s *MemoryOrderStore) Orders(_ context.Context, customerID uint, page scopes.Page) ([]models.Order, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	orders := []models.Order{}
+	for _, order := range s.orders {
+		if !order.DeletedAt.Valid && (customerID == 0 || order.CustomerID == customerID) {
+			orders = append(orders, order)
+		}
+	}
+	slices.SortFunc(orders, func(a, b models.Order) int { return cmp.Compare(a.ID, b.ID) })
+	return paginate(orders, page), int64(len(orders)), nil
+}
+
+func (s *MemoryOrderStore) Create(_ context.Context, order *models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUnique(*order); err != nil {
+		return err
+	}
+	if order.Status == "" {
+		order.Status = models.OrderStatusPending
+	}
+	if order.Priority == "" {
+		order.Priority = models.OrderPriorityNormal
+	}
+	if order.Quantity == 0 {
+		order.Quantity = 1
+	}
+	s.nextID++
+	order.ID = s.nextID
+	now := s.now()
+	if order.CreatedAt.IsZero() {
+		order.CreatedAt = now
+	}
+	order.UpdatedAt = now
+	s.orders[order.ID] = *order
+
+	s.customers.touchLastOrder(order.CustomerID, order.CreatedAt)
+	return nil
+}
+
+func (s *MemoryOrderStore) Save(ctx context.Context, order *models.Order) error {
+	if order.ID == 0 {
+		return s.Create(ctx, order)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkUnique(*order); err != nil {
+		return err
+	}
+	order.UpdatedAt = s.now()
+	s.orders[order.ID] = *order
+	return nil
+}
+
+func (s *MemoryOrderStore) Delete(_ context.Context, order *models.Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.orders[order.ID]
+	if !ok {
+		return nil
+	}
+	stored.DeletedAt = gorm.DeletedAt{Time: s.now(), Valid: true}
+	s.orders[order.ID] = stored
+	return nil
+}
+
+// checkUnique enforces the unique index on number, which deleted orders
+// still hold
+func (s *MemoryOrderStore) checkUnique(order models.Order) error {
+	if order.Number == nil {
+		return nil
+	}
+	for _, other := range s.orders {
+		if other.ID != order.ID && other.Number != nil && *other.Number == *order.Number {
+			return uniqueViolation("orders.number")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+)
+
+// orderStoreFactory returns an empty OrderStore and the CustomerStore its
+// orders' customers are kept in
+type orderStoreFactory func(t *testing.T) (OrderStore, CustomerStore)
+
+func TestMemoryOrderStore(t *testing.T) {
+	testOrderStore(t, func(t *testing.T) (OrderStore, CustomerStore) {
+		customers := NewMemoryCustomerStore()
+		return NewMemoryOrderStore(customers), customers
+	})
+}
+
+// testOrderStore is the contract every OrderStore implementation must meet
+func testOrderStore(t *testing.T, newStore orderStoreFactory) {
+	ctx := context.Background()
+	base := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	addCustomer := func(t *testing.T, customers CustomerStore, code string) models.Customer {
+		customer := models.Customer{Name: "Customer " + code, Code: code, Phone: "+254740827150"}
+		if err := customers.Create(ctx, &customer); err != nil {
+			t.Fatalf("failed to create customer: %v", err)
+		}
+		return customer
+	}
+
+	t.Run("create, change and delete", func(t *testing.T) {
+		orders, customers := newStore(t)
+		customer := addCustomer(t, customers, "CUST001")
+
+		order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: base, CustomerID: customer.ID}
+		assert.NoError(t, orders.Create(ctx, &order))
+		assert.NotZero(t, order.ID)
+		assert.False(t, order.CreatedAt.IsZero())
+		assert.Equal(t, models.OrderStatusPending, order.Status)
+		assert.Equal(t, models.OrderPriorityNormal, order.Priority)
+		assert.Equal(t, 1, order.Quantity)
+
+		found, err := orders.Order(ctx, order.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "laptop", found.Item)
+		assert.Equal(t, models.Shillings(1500), found.Amount)
+		assert.True(t, base.Equal(found.Time))
+
+		_, err = orders.Order(ctx, order.ID+1)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+		found.Status = models.OrderStatusShipped
+		assert.NoError(t, orders.Save(ctx, &found))
+		found, err = orders.Order(ctx, order.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, models.OrderStatusShipped, found.Status)
+
+		assert.NoError(t, orders.Delete(ctx, &found))
+		_, err = orders.Order(ctx, order.ID)
+		assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+	})
+
+	t.Run("placing an order moves last_order_at forward", func(t *testing.T) {
+		orders, customers := newStore(t)
+		customer := addCustomer(t, customers, "CUST001")
+
+		later := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: base, CustomerID: customer.ID, CreatedAt: base.Add(time.Hour)}
+		assert.NoError(t, orders.Create(ctx, &later))
+		earlier := models.Order{Item: "mouse", Amount: models.Shillings(500), Time: base, CustomerID: customer.ID, CreatedAt: base}
+		assert.NoError(t, orders.Create(ctx, &earlier))
+
+		found, err := customers.Customer(ctx, customer.ID)
+		assert.NoError(t, err)
+		if assert.NotNil(t, found.LastOrderAt) {
+			assert.True(t, base.Add(time.Hour).Equal(*found.LastOrderAt), "an older order leaves it as it is")
+		}
+	})
+
+	t.Run("numbers are unique", func(t *testing.T) {
+		orders, customers := newStore(t)
+		customer := addCustomer(t, customers, "CUST001")
+
+		number := "ORD-2025-000001"
+		first := models.Order{Number: &number, Item: "laptop", Amount: models.Shillings(1500), Time: base, CustomerID: customer.ID}
+		assert.NoError(t, orders.Create(ctx, &first))
+		second := models.Order{Number: &number, Item: "mouse", Amount: models.Shillings(500), Time: base, CustomerID: customer.ID}
+		assert.ErrorContains(t, orders.Create(ctx, &second), "UNIQUE constraint failed")
+
+		unnumbered := models.Order{Item: "mouse", Amount: models.Shillings(500), Time: base, CustomerID: customer.ID}
+		assert.NoError(t, orders.Create(ctx, &unnumbered))
+		alsoUnnumbered := models.Order{Item: "cable", Amount: models.Shillings(200), Time: base, CustomerID: customer.ID}
+		assert.NoError(t, orders.Create(ctx, &alsoUnnumbered))
+	})
+
+	t.Run("orders list by customer in the order they were placed", func(t *testing.T) {
+		orders, customers := newStore(t)
+		customer := addCustomer(t, customers, "CUST001")
+		other := addCustomer(t, customers, "CUST002")
+
+		var placed []models.Order
+		for _, customerID := range []uint{customer.ID, other.ID, customer.ID, customer.ID} {
+			order := models.Order{Item: "laptop", Amount: models.Shillings(1500), Time: base, CustomerID: customerID}
+			assert.NoError(t, orders.Create(ctx, &order))
+			placed = append(placed, order)
+		}
+		assert.NoError(t, orders.Delete(ctx, &placed[3]))
+
+		tests := []struct {
+			name          string
+			customerID    uint
+			page          scopes.Page
+			expectedIDs   []uint
+			expectedTotal int64
+		}{
+			{name: "one customer's", customerID: customer.ID, page: scopes.Page{Page: 1, Limit: 10}, expectedIDs: []uint{placed[0].ID, placed[2].ID}, expectedTotal: 2},
+			{name: "everyone's", page: scopes.Page{Page: 1, Limit: 10}, expectedIDs: []uint{placed[0].ID, placed[1].ID, placed[2].ID}, expectedTotal: 3},
+			{name: "second page", page: scopes.Page{Page: 2, Limit: 2}, expectedIDs: []uint{placed[2].ID}, expectedTotal: 3},
+			{name: "no orders", customerID: customer.ID + other.ID, page: scopes.Page{Page: 1, Limit: 10}, expectedIDs: []uint{}, expectedTotal: 0},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, total, err := orders.Orders(ctx, tt.customerID, tt.page)
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedTotal, total)
+				assert.Equal(t, tt.expectedIDs, orderIDs(found))
+			})
+		}
+	})
+}
+
+func orderIDs(orders []models.Order) []uint {
+	ids := []uint{}
+	for _, order := range orders {
+		ids = append(ids, order.ID)
+	}
+	return ids
+}
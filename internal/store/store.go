@@ -0,0 +1,73 @@
+// Package store hides the database behind small interfaces, one per
+// aggregate, so handlers can be tested against the in-memory fakes here
+// instead of a real database. Every interface has a GORM implementation
+// for production and a Memory one for tests; the contract tests run the
+// same suite against both.
+//
+// Lookups of rows that do not exist return gorm.ErrRecordNotFound from
+// either implementation, and the fakes report unique violations in
+// SQLite's words, so callers map both the same way they always have.
+package store
+
+import (
+	"context"
+	"time"
+
+	scopes "github.com/SebbieMzingKe/customer-order-api/internal/db"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+)
+
+// NoteStore keeps the notes account managers write on customers
+type NoteStore interface {
+	// Customer returns the customer notes are being read or written for
+	Customer(ctx context.Context, id uint) (models.Customer, error)
+	// Notes lists a customer's notes, pinned first and then the newest
+	Notes(ctx context.Context, customerID uint) ([]models.CustomerNote, error)
+	// Note returns one of a customer's notes
+	Note(ctx context.Context, customerID, noteID uint) (models.CustomerNote, error)
+	Create(ctx context.Context, note *models.CustomerNote) error
+	Save(ctx context.Context, note *models.CustomerNote) error
+	Delete(ctx context.Context, note *models.CustomerNote) error
+	// Search returns a page of the notes matching search, newest first,
+	// along with how many match in total
+	Search(ctx context.Context, search NoteSearch, page scopes.Page) ([]models.CustomerNote, int64, error)
+}
+
+// NoteSearch selects notes across customers. Zero fields do not filter.
+type NoteSearch struct {
+	// Text must appear in the note, ignoring case. Wildcards are literal.
+	Text       string
+	CustomerID uint
+	Author     string
+	// CreatedFrom and CreatedTo bound created_at like scopes.CreatedBetween
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+}
+
+// CustomerStore keeps customers. Deleting one keeps its row, so its code
+// and email stay taken.
+type CustomerStore interface {
+	Customer(ctx context.Context, id uint) (models.Customer, error)
+	// Customers returns a page of customers in the order they were
+	// created, along with how many there are
+	Customers(ctx context.Context, page scopes.Page) ([]models.Customer, int64, error)
+	// Create and Save normalize the code and email and keep the blind
+	// indexes in step, as models.Customer.BeforeSave does
+	Create(ctx context.Context, customer *models.Customer) error
+	Save(ctx context.Context, customer *models.Customer) error
+	Delete(ctx context.Context, customer *models.Customer) error
+}
+
+// OrderStore keeps orders. Placing one moves its customer's last_order_at
+// forward, as models.Order.AfterCreate does.
+type OrderStore interface {
+	Order(ctx context.Context, id uint) (models.Order, error)
+	// Orders returns a page of a customer's orders, or everyone's for a
+	// zero id, in the order they were placed, along with how many there are
+	Orders(ctx context.Context, customerID uint, page scopes.Page) ([]models.Order, int64, error)
+	// Create fills in the column defaults an order leaves zero: pending,
+	// normal priority and a quantity of one
+	Create(ctx context.Context, order *models.Order) error
+	Save(ctx context.Context, order *models.Order) error
+	Delete(ctx context.Context, order *models.Order) error
+}
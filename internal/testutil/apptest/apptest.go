@@ -0,0 +1,59 @@
+// Package apptest builds the whole router for tests, so requests go
+// through the same middleware chain as in production: authentication,
+// policies, scopes and validation abort a request before it reaches its
+// handler exactly as they would when served.
+//
+// It imports app, so only tests outside the packages app depends on, or
+// external _test packages of them, can use it.
+package apptest
+
+import (
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/testutil"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Admin is the admin email of the default Config
+const Admin = "admin@example.com"
+
+// Router is the router with the database and mock senders behind it, for
+// tests to seed and inspect
+type Router struct {
+	*gin.Engine
+	DB    *gorm.DB
+	SMS   *services.MockSMSService
+	Email *services.MockEmailService
+}
+
+// Config is the configuration NewRouter is usually given, with Admin as
+// the only admin
+func Config() app.Config {
+	return app.Config{
+		TrackingSecret: "test-secret",
+		AdminEmails:    []string{Admin},
+	}
+}
+
+// NewRouter builds the router for cfg over a fresh in-memory database and
+// sets JWT_SECRET for the rest of the test, so testutil.Token is accepted
+func NewRouter(t testing.TB, cfg app.Config) *Router {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	testutil.UseSecret(t)
+
+	r := &Router{
+		DB:    testutil.DB(t),
+		SMS:   services.NewMockSMSService(),
+		Email: services.NewMockEmailService(),
+	}
+	r.Engine = app.BuildRouter(cfg, app.Deps{
+		DB:    r.DB,
+		SMS:   r.SMS,
+		Email: r.Email,
+	})
+	return r
+}
@@ -0,0 +1,218 @@
+package testutil
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/gorm"
+)
+
+// seq numbers the records builders make, so the defaults of unique columns
+// never collide within a test binary
+var seq atomic.Int64
+
+func next() int64 {
+	return seq.Add(1)
+}
+
+// CustomerBuilder makes a customer with valid, unique defaults that tests
+// override only where they matter
+type CustomerBuilder struct {
+	t        testing.TB
+	customer models.Customer
+}
+
+// NewCustomer starts a customer with a unique code, phone and email
+func NewCustomer(t testing.TB) *CustomerBuilder {
+	n := next()
+	return &CustomerBuilder{t: t, customer: models.Customer{
+		Name:  fmt.Sprintf("Customer %d", n),
+		Code:  fmt.Sprintf("TEST%04d", n),
+		Phone: fmt.Sprintf("+2547%08d", n),
+		Email: fmt.Sprintf("customer%d@example.com", n),
+	}}
+}
+
+func (b *CustomerBuilder) WithName(name string) *CustomerBuilder {
+	b.customer.Name = name
+	return b
+}
+
+func (b *CustomerBuilder) WithCode(code string) *CustomerBuilder {
+	b.customer.Code = code
+	return b
+}
+
+func (b *CustomerBuilder) WithPhone(phone string) *CustomerBuilder {
+	b.customer.Phone = phone
+	return b
+}
+
+func (b *CustomerBuilder) WithEmail(email string) *CustomerBuilder {
+	b.customer.Email = email
+	return b
+}
+
+func (b *CustomerBuilder) WithBirthday(date models.Date) *CustomerBuilder {
+	b.customer.Birthday = &date
+	return b
+}
+
+func (b *CustomerBuilder) WithOnboardedOn(date models.Date) *CustomerBuilder {
+	b.customer.OnboardedOn = &date
+	return b
+}
+
+// OptedOut marks the customer as having replied STOP at
+func (b *CustomerBuilder) OptedOut(at time.Time) *CustomerBuilder {
+	b.customer.MarketingOptOutAt = &at
+	return b
+}
+
+// Build returns the customer without saving it
+func (b *CustomerBuilder) Build() models.Customer {
+	return b.customer
+}
+
+// Create saves the customer, failing the test if it can't
+func (b *CustomerBuilder) Create(db *gorm.DB) models.Customer {
+	b.t.Helper()
+	customer := b.customer
+	if err := db.Create(&customer).Error; err != nil {
+		b.t.Fatalf("failed to create customer: %v", err)
+	}
+	return customer
+}
+
+// OrderBuilder makes a pending order of one item. Create saves a new
+// customer for it unless one is given with For.
+type OrderBuilder struct {
+	t     testing.TB
+	order models.Order
+}
+
+// NewOrder starts a pending order placed now
+func NewOrder(t testing.TB) *OrderBuilder {
+	n := next()
+	return &OrderBuilder{t: t, order: models.Order{
+		Item:     fmt.Sprintf("item %d", n),
+		Amount:   models.Shillings(100),
+		Time:     time.Now(),
+		Status:   models.OrderStatusPending,
+		Priority: models.OrderPriorityNormal,
+		Quantity: 1,
+	}}
+}
+
+// For places the order for customer
+func (b *OrderBuilder) For(customer models.Customer) *OrderBuilder {
+	b.order.CustomerID = customer.ID
+	return b
+}
+
+func (b *OrderBuilder) WithItem(item string) *OrderBuilder {
+	b.order.Item = item
+	return b
+}
+
+func (b *OrderBuilder) WithAmount(amount models.Money) *OrderBuilder {
+	b.order.Amount = amount
+	return b
+}
+
+func (b *OrderBuilder) WithStatus(status string) *OrderBuilder {
+	b.order.Status = status
+	return b
+}
+
+func (b *OrderBuilder) WithTime(placed time.Time) *OrderBuilder {
+	b.order.Time = placed
+	return b
+}
+
+func (b *OrderBuilder) WithQuantity(quantity int) *OrderBuilder {
+	b.order.Quantity = quantity
+	return b
+}
+
+// WithProduct draws the order from product's stock, at its price
+func (b *OrderBuilder) WithProduct(product models.Product) *OrderBuilder {
+	b.order.ProductID = &product.ID
+	b.order.Item = product.Name
+	b.order.Amount = product.Price
+	return b
+}
+
+// Build returns the order without saving it
+func (b *OrderBuilder) Build() models.Order {
+	return b.order
+}
+
+// Create saves the order, and a customer for it if it has none
+func (b *OrderBuilder) Create(db *gorm.DB) models.Order {
+	b.t.Helper()
+	order := b.order
+	if order.CustomerID == 0 {
+		order.CustomerID = NewCustomer(b.t).Create(db).ID
+	}
+	if err := db.Create(&order).Error; err != nil {
+		b.t.Fatalf("failed to create order: %v", err)
+	}
+	return order
+}
+
+// ProductBuilder makes a product in stock with a unique SKU
+type ProductBuilder struct {
+	t       testing.TB
+	product models.Product
+}
+
+func NewProduct(t testing.TB) *ProductBuilder {
+	n := next()
+	return &ProductBuilder{t: t, product: models.Product{
+		Name:              fmt.Sprintf("Product %d", n),
+		SKU:               fmt.Sprintf("SKU-%04d", n),
+		Price:             models.Shillings(100),
+		StockQuantity:     10,
+		LowStockThreshold: 2,
+	}}
+}
+
+func (b *ProductBuilder) WithName(name string) *ProductBuilder {
+	b.product.Name = name
+	return b
+}
+
+func (b *ProductBuilder) WithSKU(sku string) *ProductBuilder {
+	b.product.SKU = sku
+	return b
+}
+
+func (b *ProductBuilder) WithPrice(price models.Money) *ProductBuilder {
+	b.product.Price = price
+	return b
+}
+
+func (b *ProductBuilder) WithStock(quantity, lowStockThreshold int) *ProductBuilder {
+	b.product.StockQuantity = quantity
+	b.product.LowStockThreshold = lowStockThreshold
+	return b
+}
+
+// Build returns the product without saving it
+func (b *ProductBuilder) Build() models.Product {
+	return b.product
+}
+
+// Create saves the product, failing the test if it can't
+func (b *ProductBuilder) Create(db *gorm.DB) models.Product {
+	b.t.Helper()
+	product := b.product
+	if err := db.Create(&product).Error; err != nil {
+		b.t.Fatalf("failed to create product: %v", err)
+	}
+	return product
+}
@@ -0,0 +1,69 @@
+package testutil
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/respond"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuilders(t *testing.T) {
+	db := DB(t)
+
+	first := NewCustomer(t).Create(db)
+	second := NewCustomer(t).WithPhone("+254740827150").WithBirthday("1990-05-17").Create(db)
+	assert.NotEqual(t, first.Code, second.Code)
+	assert.NotEqual(t, first.Email, second.Email)
+	assert.Equal(t, "+254740827150", second.Phone)
+	require.NotNil(t, second.Birthday)
+	assert.Equal(t, models.Date("1990-05-17"), *second.Birthday)
+
+	product := NewProduct(t).WithPrice(models.Shillings(250)).Create(db)
+	order := NewOrder(t).WithProduct(product).WithQuantity(2).Create(db)
+	assert.NotZero(t, order.CustomerID, "a customer is made for an order without one")
+	assert.Equal(t, product.Name, order.Item)
+	assert.Equal(t, models.Shillings(250), order.Amount)
+
+	order = NewOrder(t).For(first).WithStatus(models.OrderStatusDelivered).Create(db)
+	var stored models.Order
+	require.NoError(t, db.Preload("Customer").First(&stored, order.ID).Error)
+	assert.Equal(t, first.ID, stored.Customer.ID)
+	assert.Equal(t, models.OrderStatusDelivered, stored.Status)
+}
+
+func TestRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/echo", func(c *gin.Context) {
+		var body map[string]string
+		if err := respond.BindJSON(c, &body); err != nil {
+			respond.Error(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		body["authorization"] = c.GetHeader("Authorization")
+		respond.OK(c, http.StatusOK, body)
+	})
+
+	Run(t, r, []Case{
+		{
+			Name:    "decodes data",
+			Request: NewRequest("POST", "/echo").WithToken("abc").WithJSON(map[string]string{"item": "laptop"}),
+			Status:  http.StatusOK,
+			Check: func(t *testing.T, w *Response) {
+				var body map[string]string
+				w.Data(&body)
+				assert.Equal(t, map[string]string{"item": "laptop", "authorization": "Bearer abc"}, body)
+			},
+		},
+		{
+			Name:    "reads the error code",
+			Request: NewRequest("POST", "/echo").WithJSON(`{"item": `),
+			Status:  http.StatusBadRequest,
+			Code:    "invalid_request",
+		},
+	})
+}
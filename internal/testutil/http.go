@@ -0,0 +1,125 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Request is a request for a test to send through a handler, built up
+// with the With methods
+type Request struct {
+	method string
+	path   string
+	body   []byte
+	header http.Header
+}
+
+func NewRequest(method, path string) *Request {
+	return &Request{method: method, path: path, header: http.Header{}}
+}
+
+// WithJSON sends body as JSON. Strings and byte slices are sent as they
+// are, so tests can send malformed JSON; anything else is marshalled.
+func (r *Request) WithJSON(body interface{}) *Request {
+	switch body := body.(type) {
+	case string:
+		r.body = []byte(body)
+	case []byte:
+		r.body = body
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			panic("testutil: failed to marshal request body: " + err.Error())
+		}
+		r.body = data
+	}
+	r.header.Set("Content-Type", "application/json")
+	return r
+}
+
+// WithToken sends token as a bearer token
+func (r *Request) WithToken(token string) *Request {
+	r.header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Serve sends the request through h and returns what it wrote
+func (r *Request) Serve(t testing.TB, h http.Handler) *Response {
+	t.Helper()
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequest(r.method, r.path, body)
+	if err != nil {
+		t.Fatalf("failed to build request %s %s: %v", r.method, r.path, err)
+	}
+	req.Header = r.header.Clone()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return &Response{ResponseRecorder: w, t: t}
+}
+
+// Response is what a handler wrote, with helpers to read the envelope
+type Response struct {
+	*httptest.ResponseRecorder
+	t testing.TB
+}
+
+// Data decodes the envelope's data into v, failing the test if the body
+// isn't a data envelope
+func (r *Response) Data(v interface{}) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), &models.Envelope{Data: v}); err != nil {
+		r.t.Fatalf("failed to decode response %d %s: %v", r.Code, r.Body.String(), err)
+	}
+}
+
+// Error returns the body of an error envelope, empty if there is none
+func (r *Response) Error() models.ErrorBody {
+	var envelope models.ErrorEnvelope
+	json.Unmarshal(r.Body.Bytes(), &envelope)
+	return envelope.Error
+}
+
+// Case is one row of a table of requests and what each should answer
+type Case struct {
+	Name    string
+	Request *Request
+	Status  int
+	// Code is the error code expected, when the request should fail
+	Code string
+	// Check makes any further assertions on the response
+	Check func(t *testing.T, w *Response)
+}
+
+// Run sends each case's request through h in a subtest and checks the
+// status and error code it answers with
+func Run(t *testing.T, h http.Handler, cases []Case) {
+	t.Helper()
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			w := tc.Request.Serve(t, h)
+			assert.Equal(t, tc.Status, w.Code, w.Body.String())
+			if tc.Code != "" {
+				assert.Equal(t, tc.Code, w.Error().Code)
+			}
+			if tc.Check != nil {
+				tc.Check(t, w)
+			}
+		})
+	}
+}
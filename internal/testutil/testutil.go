@@ -0,0 +1,30 @@
+// Package testutil holds what the test suites share: an in-memory database,
+// builders for the records most tests seed, signed JWTs and helpers to send
+// requests through a handler and read the envelope back.
+//
+// It imports nothing from this module but models, so the tests of any
+// other package can use it. Tests that need the whole router, with every
+// middleware in front of the handlers, use the apptest package instead.
+package testutil
+
+import (
+	"testing"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// DB opens an in-memory sqlite database with every model migrated
+func DB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+	return db
+}
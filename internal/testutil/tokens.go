@@ -0,0 +1,71 @@
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Secret is the JWT_SECRET the tokens here are signed with
+const Secret = "test-secret"
+
+// tokenIssuer is the issuer and audience the default TokenConfig expects
+const tokenIssuer = "customer-order-api"
+
+// UseSecret sets JWT_SECRET to Secret for the rest of the test, so the
+// auth middleware accepts the tokens signed here
+func UseSecret(t testing.TB) {
+	t.Setenv("JWT_SECRET", Secret)
+}
+
+// Claims returns the claims of a token for email valid for ttl from now.
+// A negative ttl makes an expired token.
+func Claims(email string, ttl time.Duration) *models.Claims {
+	now := time.Now()
+	return &models.Claims{
+		Email: email,
+		Sub:   email,
+		Name:  "test user",
+		Iss:   tokenIssuer,
+		Aud:   tokenIssuer,
+		Iat:   now.Unix(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			Issuer:    tokenIssuer,
+			Subject:   email,
+		},
+	}
+}
+
+// Sign signs claims with secret using HS256
+func Sign(t testing.TB, claims *models.Claims, secret string) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// Token returns a token for email signed with Secret and valid for a day
+func Token(t testing.TB, email string) string {
+	t.Helper()
+	return Sign(t, Claims(email, 24*time.Hour), Secret)
+}
+
+// ExpiredToken returns a token for email that expired a day ago
+func ExpiredToken(t testing.TB, email string) string {
+	t.Helper()
+	return Sign(t, Claims(email, -24*time.Hour), Secret)
+}
+
+// ScopedToken returns a token for email limited to the space separated
+// scopes
+func ScopedToken(t testing.TB, email, scope string) string {
+	t.Helper()
+	claims := Claims(email, 24*time.Hour)
+	claims.Scope = scope
+	return Sign(t, claims, Secret)
+}
@@ -0,0 +1,205 @@
+// Package validation registers the binding rules specific to this API, so
+// request types declare them in tags instead of handlers checking them:
+//
+//	Phone string `json:"phone" binding:"required,kenyan_phone"`
+//
+// Each rule has its own error code, which a request failing only that rule
+// is answered with.
+package validation
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	TagKenyanPhone  = "kenyan_phone"
+	TagCustomerCode = "customer_code"
+	TagOrderAmount  = "order_amount"
+	TagOrderTime    = "order_time"
+	TagSegmentTag   = "segment_tag"
+	TagPromoCode    = "promo_code"
+)
+
+// Limits bounds the values the order rules accept
+type Limits struct {
+	// MaxOrderAmount is the largest amount an order may be placed for
+	MaxOrderAmount float64
+	// OrderTimePast and OrderTimeFuture are how far before and after now a
+	// new order may be timed
+	OrderTimePast   time.Duration
+	OrderTimeFuture time.Duration
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxOrderAmount:  10_000_000,
+		OrderTimePast:   30 * 24 * time.Hour,
+		OrderTimeFuture: time.Hour,
+	}
+}
+
+// WithDefaults fills unset limits from DefaultLimits
+func (l Limits) WithDefaults() Limits {
+	defaults := DefaultLimits()
+	if l.MaxOrderAmount <= 0 {
+		l.MaxOrderAmount = defaults.MaxOrderAmount
+	}
+	if l.OrderTimePast <= 0 {
+		l.OrderTimePast = defaults.OrderTimePast
+	}
+	if l.OrderTimeFuture <= 0 {
+		l.OrderTimeFuture = defaults.OrderTimeFuture
+	}
+	return l
+}
+
+// LimitsFromEnv reads ORDER_MAX_AMOUNT, ORDER_TIME_PAST_WINDOW and
+// ORDER_TIME_FUTURE_WINDOW over the defaults
+func LimitsFromEnv() Limits {
+	var limits Limits
+	limits.MaxOrderAmount, _ = strconv.ParseFloat(os.Getenv("ORDER_MAX_AMOUNT"), 64)
+	limits.OrderTimePast, _ = time.ParseDuration(os.Getenv("ORDER_TIME_PAST_WINDOW"))
+	limits.OrderTimeFuture, _ = time.ParseDuration(os.Getenv("ORDER_TIME_FUTURE_WINDOW"))
+	return limits.WithDefaults()
+}
+
+var current atomic.Pointer[Limits]
+
+// SetLimits sets the limits the order rules check against
+func SetLimits(l Limits) {
+	l = l.WithDefaults()
+	current.Store(&l)
+}
+
+// CurrentLimits returns the limits set with SetLimits, or the defaults
+func CurrentLimits() Limits {
+	if l := current.Load(); l != nil {
+		return *l
+	}
+	return DefaultLimits()
+}
+
+var (
+	// Kenyan mobile numbers, 7XX or 1XX, after +254, 254, 0 or nothing
+	kenyanPhone  = regexp.MustCompile(`^(?:\+?254|0)?[17][0-9]{8}$`)
+	phoneSpacing = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "")
+	// a letter prefix then digits, such as CUST001 or WHOLESALE01
+	customerCode = regexp.MustCompile(`^[A-Za-z]{2,20}[0-9]{1,20}$`)
+	// lowercase letters, digits, dashes and underscores, such as vip or
+	// nairobi-wholesale
+	segmentTag = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+	// letters, digits, dashes and underscores, such as XMAS25 or DEC-2026
+	promoCode = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{2,31}$`)
+)
+
+// IsKenyanPhone reports whether phone is a Kenyan mobile number, ignoring
+// spaces, dashes and brackets
+func IsKenyanPhone(phone string) bool {
+	return kenyanPhone.MatchString(phoneSpacing.Replace(phone))
+}
+
+// IsSegmentTag reports whether tag can be put on customers
+func IsSegmentTag(tag string) bool {
+	return segmentTag.MatchString(tag)
+}
+
+type rule struct {
+	validate func(fl validator.FieldLevel) bool
+	code     string
+	message  func() string
+}
+
+var rules = map[string]rule{
+	TagKenyanPhone: {
+		validate: func(fl validator.FieldLevel) bool {
+			return IsKenyanPhone(fl.Field().String())
+		},
+		code:    "invalid_phone",
+		message: func() string { return "must be a Kenyan mobile number such as +254712345678" },
+	},
+	TagCustomerCode: {
+		validate: func(fl validator.FieldLevel) bool {
+			return customerCode.MatchString(fl.Field().String())
+		},
+		code:    "invalid_customer_code",
+		message: func() string { return "must be letters followed by digits, such as CUST001" },
+	},
+	TagSegmentTag: {
+		validate: func(fl validator.FieldLevel) bool {
+			return IsSegmentTag(fl.Field().String())
+		},
+		code:    "invalid_tag",
+		message: func() string { return "must be lowercase letters, digits, dashes and underscores, such as vip" },
+	},
+	TagPromoCode: {
+		validate: func(fl validator.FieldLevel) bool {
+			return promoCode.MatchString(fl.Field().String())
+		},
+		code:    "invalid_promo_code",
+		message: func() string { return "must be 3 to 32 letters, digits, dashes and underscores, such as XMAS25" },
+	},
+	TagOrderAmount: {
+		validate: func(fl validator.FieldLevel) bool {
+			return orderAmount(fl.Field()) <= CurrentLimits().MaxOrderAmount
+		},
+		code: "amount_too_large",
+		message: func() string {
+			return "must not exceed " + strconv.FormatFloat(CurrentLimits().MaxOrderAmount, 'f', -1, 64)
+		},
+	},
+	TagOrderTime: {
+		validate: func(fl validator.FieldLevel) bool {
+			at, ok := fl.Field().Interface().(time.Time)
+			if !ok {
+				return false
+			}
+			limits := CurrentLimits()
+			now := time.Now()
+			return !at.Before(now.Add(-limits.OrderTimePast)) && !at.After(now.Add(limits.OrderTimeFuture))
+		},
+		code: "order_time_out_of_range",
+		message: func() string {
+			limits := CurrentLimits()
+			return fmt.Sprintf("must be at most %s before and %s after now", limits.OrderTimePast, limits.OrderTimeFuture)
+		},
+	},
+}
+
+// Register adds the rules to v
+func Register(v *validator.Validate) error {
+	for tag, r := range rules {
+		if err := v.RegisterValidation(tag, r.validate); err != nil {
+			return fmt.Errorf("failed to register %s: %w", tag, err)
+		}
+	}
+	return nil
+}
+
+// Describe returns the error code and message of a rule registered here
+func Describe(tag string) (code, message string, ok bool) {
+	r, ok := rules[tag]
+	if !ok {
+		return "", "", false
+	}
+	return r.code, r.message(), true
+}
+
+// orderAmount reads an amount in shillings. Amounts are models.Money, whole
+// cents, but plain float fields are read as shillings too.
+func orderAmount(field reflect.Value) float64 {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()) / 100
+	default:
+		return field.Float()
+	}
+}
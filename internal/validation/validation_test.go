@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsKenyanPhone(t *testing.T) {
+	tests := []struct {
+		phone    string
+		expected bool
+	}{
+		{"+254740827150", true},
+		{"254740827150", true},
+		{"0740827150", true},
+		{"0111768132", true},
+		{"+254 740 827-150", true},
+		{"(0740) 827150", true},
+		{"+255740827150", false},
+		{"0840827150", false},
+		{"074082715", false},
+		{"07408271500", false},
+		{"123", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			assert.Equal(t, tt.expected, IsKenyanPhone(tt.phone))
+		})
+	}
+}
+
+func TestRules(t *testing.T) {
+	v := validator.New()
+	if err := Register(v); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	SetLimits(Limits{MaxOrderAmount: 1000, OrderTimePast: 24 * time.Hour, OrderTimeFuture: time.Hour})
+	t.Cleanup(func() { SetLimits(DefaultLimits()) })
+
+	now := time.Now()
+	tests := []struct {
+		name  string
+		value interface{}
+		tag   string
+		valid bool
+	}{
+		{"customer code", "CUST001", TagCustomerCode, true},
+		{"customer code in lower case", "wholesale01", TagCustomerCode, true},
+		{"customer code without digits", "CUST", TagCustomerCode, false},
+		{"customer code without letters", "001", TagCustomerCode, false},
+		{"customer code with punctuation", "CUST-001", TagCustomerCode, false},
+		{"segment tag", "nairobi-wholesale", TagSegmentTag, true},
+		{"segment tag in upper case", "VIP", TagSegmentTag, false},
+		{"segment tag with spaces", "big spenders", TagSegmentTag, false},
+		{"promo code", "DEC-2026", TagPromoCode, true},
+		{"promo code in lower case", "xmas25", TagPromoCode, true},
+		{"promo code too short", "X1", TagPromoCode, false},
+		{"promo code with spaces", "XMAS 25", TagPromoCode, false},
+		{"amount at the limit", 1000.0, TagOrderAmount, true},
+		{"amount over the limit", 1000.5, TagOrderAmount, false},
+		{"time now", now, TagOrderTime, true},
+		{"time within the past window", now.Add(-23 * time.Hour), TagOrderTime, true},
+		{"time before the past window", now.Add(-25 * time.Hour), TagOrderTime, false},
+		{"time after the future window", now.Add(2 * time.Hour), TagOrderTime, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Var(tt.value, tt.tag)
+			assert.Equal(t, tt.valid, err == nil, "error: %v", err)
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	SetLimits(Limits{MaxOrderAmount: 2500})
+	t.Cleanup(func() { SetLimits(DefaultLimits()) })
+
+	code, message, ok := Describe(TagOrderAmount)
+	assert.True(t, ok)
+	assert.Equal(t, "amount_too_large", code)
+	assert.Equal(t, "must not exceed 2500", message)
+
+	_, _, ok = Describe("required")
+	assert.False(t, ok)
+}
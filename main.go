@@ -1,111 +1,48 @@
 package main
 
 import (
+	"context"
 	"log"
-	"net/http"
-	"os"
 
-	"github.com/SebbieMzingKe/customer-order-api/internal/handlers"
-	"github.com/SebbieMzingKe/customer-order-api/internal/middleware"
-	"github.com/SebbieMzingKe/customer-order-api/internal/models"
-	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/buildinfo"
 
-	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-var db *gorm.DB
-
 func init() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found")
 	}
+}
 
-	var err error
+func main() {
+	container := app.NewContainer()
+	defer container.Close()
 
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=localhost user=savannah password=savannah dbname=savannah port=5432 sslmode=disable"
+	report := container.Verify(context.Background())
+	report.Log()
+	if report.Refuse() {
+		log.Fatalf("refusing to serve traffic, %d startup checks failed (STARTUP_STRICT is set)", len(report.Failed()))
 	}
 
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	r, err := container.Router()
 	if err != nil {
-
-		log.Fatal("failed to connect to database", err)
+		log.Fatal("failed to start: ", err)
 	}
-
-	err = db.AutoMigrate(&models.Customer{}, &models.Order{})
+	deps, err := container.ProvideDeps()
 	if err != nil {
-		log.Fatal("failed to migrate database", err)
-
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal("failed to start: ", err)
 	}
 
-	err = db.AutoMigrate()
-	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+	deps.Scheduler.Start(context.Background())
+	defer deps.Scheduler.Stop()
 
-	}
-}
-
-func main() {
+	serverCfg := app.ServerConfigFromEnv()
+	server := app.NewServer(serverCfg, r)
 
-	smsService := services.NewSMSService(
-		os.Getenv("AFRICASTALKING_USERNAME"),
-		os.Getenv("AFRICASTALKING_API_KEY"),
-		os.Getenv("AFRICASTALKING_SENDER_ID"),
-	)
-
-	customerHandler := handlers.NewCustomerHandler(db)
-	orderHandler := handlers.NewOrderHandler(db, smsService)
-	authHandler := handlers.NewAuthHandler()
-
-	r := gin.Default()
-
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
-
-	r.GET("/", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "welcome to customer order api"})
-	})
-	
-	auth := r.Group("/auth")
-	{
-		auth.GET("/login", authHandler.Login)
-		auth.GET("/callback", authHandler.Callback)
-		auth.GET("/userinfo", middleware.AuthMiddleware(), authHandler.UserInfo)
-	}
-
-	api := r.Group("/api/v1")
-	api.Use(middleware.AuthMiddleware())
-	{
-		customers := api.Group("/customers")
-		{
-			customers.POST("", customerHandler.CreateCustomer)
-			customers.GET("", customerHandler.GetCustomers)
-			customers.GET("/:id", customerHandler.GetCustomer)
-			customers.PUT("/:id", customerHandler.UpdateCustomer)
-			customers.DELETE("/:id", customerHandler.DeleteCustomer)
-		}
-
-		orders := api.Group("/orders")
-		{
-			orders.POST("", orderHandler.CreateOrder)
-			orders.GET("", orderHandler.GetOrders)
-			orders.GET("/:id", orderHandler.GetOrder)
-			orders.PUT("/:id", orderHandler.UpdateOrder)
-			orders.DELETE("/:id", orderHandler.DeleteOrder)
-		}
+	log.Printf("server is starting on %s (tls: %t, %s)", serverCfg.Addr, serverCfg.TLS(), buildinfo.Get())
+	if err := app.ListenAndServe(serverCfg, server); err != nil {
+		log.Print(err)
 	}
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-
-	log.Printf("server is starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
 }
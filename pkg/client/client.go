@@ -0,0 +1,236 @@
+// Package client is a typed Go client for the customer order API. It speaks
+// the same request and response models as the server, so callers do not
+// have to hand-roll HTTP calls that drift from the API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultMaxRetries  = 2
+	defaultBaseBackoff = 200 * time.Millisecond
+)
+
+// TokenSource returns the bearer token to send with a request
+type TokenSource func(ctx context.Context) (string, error)
+
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	maxRetries  int
+	baseBackoff time.Duration
+
+	mu          sync.RWMutex
+	tokenSource TokenSource
+	apiKey      string
+}
+
+type Option func(*Client)
+
+// WithToken authenticates every request with a fixed bearer token
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.tokenSource = func(context.Context) (string, error) { return token, nil }
+	}
+}
+
+// WithTokenSource authenticates requests with a token fetched per request,
+// e.g. from a cache that refreshes it before it expires
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Client) {
+		c.tokenSource = source
+	}
+}
+
+// WithAPIKey authenticates every request with a partner API key instead of
+// a token
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries sets how many times idempotent requests are retried after a
+// network error, 429 or 5xx. POST requests are never retried.
+func WithRetries(maxRetries int) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+	}
+}
+
+// New returns a client for the API at baseURL, e.g. https://api.example.com
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		httpClient:  &http.Client{Timeout: defaultTimeout},
+		maxRetries:  defaultMaxRetries,
+		baseBackoff: defaultBaseBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Login exchanges credentials for an access token and uses it for all
+// later requests
+func (c *Client) Login(ctx context.Context, email, password string) (*AuthResponse, error) {
+	var auth AuthResponse
+	err := c.do(ctx, http.MethodGet, "/auth/login", nil, LoginRequest{Email: email, Password: password}, &auth)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.tokenSource = func(context.Context) (string, error) { return auth.AccessToken, nil }
+	c.mu.Unlock()
+
+	return &auth, nil
+}
+
+// APIError is returned for any non-2xx response
+type APIError struct {
+	StatusCode int
+	ErrorBody
+	// RequestID identifies the request in the server logs
+	RequestID string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("api error %d: %s: %s (request %s)", e.StatusCode, e.Code, e.Message, e.RequestID)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	retries := c.maxRetries
+	if method == http.MethodPost {
+		retries = 0
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			if err := c.wait(ctx, attempt); err != nil {
+				return err
+			}
+		}
+
+		retry, err := c.attempt(ctx, method, endpoint, payload, out)
+		if err == nil {
+			return nil
+		}
+		if !retry {
+			return err
+		}
+		lastErr = err
+	}
+	return lastErr
+}
+
+// attempt sends one request and reports whether a failure may be retried
+func (c *Client) attempt(ctx context.Context, method, endpoint string, payload []byte, out interface{}) (bool, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, body)
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	c.mu.RLock()
+	tokenSource := c.tokenSource
+	c.mu.RUnlock()
+	if tokenSource != nil {
+		token, err := tokenSource(ctx)
+		if err != nil {
+			return false, fmt.Errorf("failed to get token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return true, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var envelope ErrorEnvelope
+		json.Unmarshal(respBody, &envelope)
+		apiErr := &APIError{StatusCode: resp.StatusCode, ErrorBody: envelope.Error, RequestID: envelope.RequestID}
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+		return retry, apiErr
+	}
+
+	if out != nil {
+		// out receives the envelope's data, unless the caller wants the
+		// meta too and passes an *Envelope itself
+		envelope, ok := out.(*Envelope)
+		if !ok {
+			envelope = &Envelope{Data: out}
+		}
+		if err := json.Unmarshal(respBody, envelope); err != nil {
+			return false, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return false, nil
+}
+
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	backoff := c.baseBackoff << (attempt - 1)
+	delay := time.Duration(rand.Int63n(int64(backoff)) + 1)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/SebbieMzingKe/customer-order-api/internal/app"
+	"github.com/SebbieMzingKe/customer-order-api/internal/models"
+	"github.com/SebbieMzingKe/customer-order-api/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestServer(t *testing.T) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	server := httptest.NewServer(app.BuildRouter(app.Config{TrackingSecret: "test-secret"}, app.Deps{
+		DB:  db,
+		SMS: services.NewMockSMSService(),
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestClientAgainstServer(t *testing.T) {
+	ctx := context.Background()
+	server := setupTestServer(t)
+	c := New(server.URL)
+
+	_, err := c.ListCustomers(ctx, ListOptions{})
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+
+	auth, err := c.Login(ctx, "sebbievilar2@gmail.com", "password")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, auth.AccessToken)
+
+	customer, err := c.CreateCustomer(ctx, CreateCustomerRequest{
+		Name:  "Sebbie Chanzu",
+		Code:  "CUST001",
+		Phone: "+254740827150",
+		Email: "sebbievilar2@gmail.com",
+	})
+	assert.NoError(t, err)
+	assert.NotZero(t, customer.ID)
+
+	_, err = c.CreateCustomer(ctx, CreateCustomerRequest{
+		Name:  "Sebbie Chanzu",
+		Code:  "CUST001",
+		Phone: "+254740827150",
+		Email: "other@gmail.com",
+	})
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "customer_exists", apiErr.Code)
+
+	for i := 0; i < 5; i++ {
+		_, err := c.CreateOrder(ctx, CreateOrderRequest{
+			Item:       "laptop",
+			Amount:     1500,
+			Time:       time.Now(),
+			CustomerID: customer.ID,
+		})
+		assert.NoError(t, err)
+	}
+
+	page, err := c.ListOrders(ctx, ListOrdersOptions{ListOptions: ListOptions{Limit: 2}, CustomerID: customer.ID})
+	assert.NoError(t, err)
+	assert.Len(t, page.Orders, 2)
+	assert.Equal(t, int64(5), page.Total)
+
+	var ids []uint
+	for order, err := range c.AllOrders(ctx, ListOrdersOptions{ListOptions: ListOptions{Limit: 2}}) {
+		assert.NoError(t, err)
+		ids = append(ids, order.ID)
+	}
+	assert.Len(t, ids, 5)
+
+	shipped := models.OrderStatusShipped
+	updated, err := c.UpdateOrder(ctx, ids[0], UpdateOrderRequest{Status: &shipped})
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrderStatusShipped, updated.Status)
+
+	assert.NoError(t, c.DeleteOrder(ctx, ids[0]))
+	_, err = c.GetOrder(ctx, ids[0])
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		failures      int32
+		expectedCalls int32
+		expectError   bool
+	}{
+		{name: "get retried until success", method: http.MethodGet, failures: 2, expectedCalls: 3},
+		{name: "get gives up after max retries", method: http.MethodGet, failures: 5, expectedCalls: 3, expectError: true},
+		{name: "post never retried", method: http.MethodPost, failures: 1, expectedCalls: 1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&calls, 1) <= tt.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.Write([]byte(`{"data": {"id": 1}}`))
+			}))
+			defer server.Close()
+
+			c := New(server.URL, WithToken("token"), WithRetries(2))
+			c.baseBackoff = time.Millisecond
+
+			var out Customer
+			err := c.do(context.Background(), tt.method, "/api/v1/customers", nil, nil, &out)
+
+			assert.Equal(t, tt.expectedCalls, atomic.LoadInt32(&calls))
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, uint(1), out.ID)
+			}
+		})
+	}
+}
+
+func TestClientWithAPIKey(t *testing.T) {
+	var key, authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, authorization = r.Header.Get("X-API-Key"), r.Header.Get("Authorization")
+		w.Write([]byte(`{"data": [], "meta": {"total": 0}}`))
+	}))
+	defer server.Close()
+
+	page, err := New(server.URL, WithAPIKey("sk_test")).ListOrders(context.Background(), ListOrdersOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, page.Orders)
+	assert.Equal(t, "sk_test", key)
+	assert.Empty(t, authorization)
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+func (c *Client) CreateCustomer(ctx context.Context, req CreateCustomerRequest) (*Customer, error) {
+	var customer Customer
+	if err := c.do(ctx, http.MethodPost, "/api/v1/customers", nil, req, &customer); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (c *Client) GetCustomer(ctx context.Context, id uint) (*Customer, error) {
+	var customer Customer
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/customers/%d", id), nil, nil, &customer); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (c *Client) ListCustomers(ctx context.Context, opts ListOptions) (*CustomerPage, error) {
+	var page CustomerPage
+	envelope := &Envelope{Data: &page.Customers, Meta: &page.PageMeta}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/customers", opts.query(), nil, envelope); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllCustomers walks every page of customers, stopping at the first error
+func (c *Client) AllCustomers(ctx context.Context, opts ListOptions) iter.Seq2[Customer, error] {
+	return paginate(ctx, opts, func(ctx context.Context, opts ListOptions) ([]Customer, int64, error) {
+		page, err := c.ListCustomers(ctx, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return page.Customers, page.Total, nil
+	})
+}
+
+func (c *Client) UpdateCustomer(ctx context.Context, id uint, req UpdateCustomerRequest) (*Customer, error) {
+	var customer Customer
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/customers/%d", id), nil, req, &customer); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+func (c *Client) DeleteCustomer(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/customers/%d", id), nil, nil, nil)
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if len(o.Fields) > 0 {
+		query.Set("fields", strings.Join(o.Fields, ","))
+	}
+	return query
+}
+
+// paginate turns a page fetcher into an iterator over every item, starting
+// at opts.Page and stopping once total items have been seen
+func paginate[T any](ctx context.Context, opts ListOptions, fetch func(context.Context, ListOptions) ([]T, int64, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		if opts.Page < 1 {
+			opts.Page = 1
+		}
+		if opts.Limit < 1 {
+			opts.Limit = 50
+		}
+
+		seen := int64((opts.Page - 1) * opts.Limit)
+		for {
+			items, total, err := fetch(ctx, opts)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			seen += int64(len(items))
+			if len(items) == 0 || seen >= total {
+				return
+			}
+			opts.Page++
+		}
+	}
+}
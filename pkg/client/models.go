@@ -0,0 +1,45 @@
+package client
+
+import "github.com/SebbieMzingKe/customer-order-api/internal/models"
+
+// The client shares the server's models, re-exported here because packages
+// outside this module cannot import internal/models directly.
+type (
+	Customer              = models.Customer
+	Order                 = models.Order
+	CreateCustomerRequest = models.CreateCustomerRequest
+	UpdateCustomerRequest = models.UpdateCustomerRequest
+	CreateOrderRequest    = models.CreateOrderRequest
+	UpdateOrderRequest    = models.UpdateOrderRequest
+	LoginRequest          = models.LoginRequest
+	AuthResponse          = models.AuthResponse
+	Envelope              = models.Envelope
+	ErrorEnvelope         = models.ErrorEnvelope
+	ErrorBody             = models.ErrorBody
+	FieldError            = models.FieldError
+	PageMeta              = models.PageMeta
+)
+
+// ListOptions selects one page of a list endpoint
+type ListOptions struct {
+	Page  int
+	Limit int
+	// Fields limits the returned fields, as with ?fields=
+	Fields []string
+}
+
+type CustomerPage struct {
+	Customers []Customer
+	PageMeta
+}
+
+type OrderPage struct {
+	Orders []Order
+	PageMeta
+}
+
+// ListOrdersOptions adds order filters to ListOptions
+type ListOrdersOptions struct {
+	ListOptions
+	CustomerID uint
+}
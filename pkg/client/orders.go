@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+func (c *Client) CreateOrder(ctx context.Context, req CreateOrderRequest) (*Order, error) {
+	var order Order
+	if err := c.do(ctx, http.MethodPost, "/api/v1/orders", nil, req, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (c *Client) GetOrder(ctx context.Context, id uint) (*Order, error) {
+	var order Order
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/orders/%d", id), nil, nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrderByNumber fetches the order with a number such as ORD-2025-000123
+func (c *Client) GetOrderByNumber(ctx context.Context, number string) (*Order, error) {
+	var order Order
+	if err := c.do(ctx, http.MethodGet, "/api/v1/orders/by-number/"+url.PathEscape(number), nil, nil, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (c *Client) ListOrders(ctx context.Context, opts ListOrdersOptions) (*OrderPage, error) {
+	query := opts.query()
+	if opts.CustomerID != 0 {
+		query.Set("customer_id", strconv.FormatUint(uint64(opts.CustomerID), 10))
+	}
+
+	var page OrderPage
+	envelope := &Envelope{Data: &page.Orders, Meta: &page.PageMeta}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/orders", query, nil, envelope); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// AllOrders walks every page of orders, stopping at the first error
+func (c *Client) AllOrders(ctx context.Context, opts ListOrdersOptions) iter.Seq2[Order, error] {
+	return paginate(ctx, opts.ListOptions, func(ctx context.Context, page ListOptions) ([]Order, int64, error) {
+		opts.ListOptions = page
+		result, err := c.ListOrders(ctx, opts)
+		if err != nil {
+			return nil, 0, err
+		}
+		return result.Orders, result.Total, nil
+	})
+}
+
+func (c *Client) UpdateOrder(ctx context.Context, id uint, req UpdateOrderRequest) (*Order, error) {
+	var order Order
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/api/v1/orders/%d", id), nil, req, &order); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (c *Client) DeleteOrder(ctx context.Context, id uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/api/v1/orders/%d", id), nil, nil, nil)
+}
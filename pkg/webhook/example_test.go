@@ -0,0 +1,20 @@
+package webhook_test
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/SebbieMzingKe/customer-order-api/pkg/webhook"
+)
+
+// A consumer verifies deliveries before acting on them. While the API's
+// secret is rotated, it is given both the new and the previous secret.
+func ExampleVerifier_Handler() {
+	verifier := webhook.NewVerifier(os.Getenv("WEBHOOK_SECRET"), os.Getenv("WEBHOOK_PREVIOUS_SECRET"))
+
+	http.Handle("/webhooks/orders", verifier.Handler(func(r *http.Request, event webhook.Event) error {
+		log.Printf("order %d: %s", event.OrderID, event.Type)
+		return nil
+	}))
+}
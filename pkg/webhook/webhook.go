@@ -0,0 +1,215 @@
+// Package webhook verifies the order events the customer order API sends
+// to webhook subscriptions, for consumers written in Go.
+//
+// Every delivery carries its event id, the unix time it was signed at and
+// one or more signatures:
+//
+//	X-Webhook-ID: evt_42
+//	X-Webhook-Event: order.status_changed
+//	X-Webhook-Timestamp: 1758279600
+//	X-Webhook-Signature: v1=5257a869e7ec..., v1=9f86d081884c...
+//
+// Each signature is the hex HMAC-SHA256 of "<timestamp>.<body>" under one
+// of the subscription's secrets. While a secret is being rotated the
+// delivery is signed with both the new and the previous one, so a consumer
+// holding either accepts it. Deliveries are retried until they succeed, so
+// the same event can arrive more than once; Verifier turns away repeats it
+// has seen, and consumers keeping state should also skip event ids they
+// have already handled.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IDHeader        = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+
+	// signatureVersion prefixes each signature, so the scheme can change
+	// without breaking consumers
+	signatureVersion = "v1="
+
+	// DefaultTolerance is how far a delivery's timestamp may be from now
+	DefaultTolerance = 5 * time.Minute
+
+	// maxBody caps the body Handler reads
+	maxBody = 1 << 20
+)
+
+var (
+	ErrMissingHeaders   = errors.New("webhook: missing id, timestamp or signature header")
+	ErrInvalidTimestamp = errors.New("webhook: invalid timestamp")
+	ErrTooOld           = errors.New("webhook: timestamp is outside the tolerance")
+	ErrInvalidSignature = errors.New("webhook: no valid signature")
+	ErrReplayed         = errors.New("webhook: event was already delivered")
+)
+
+// Event is the body of a delivery
+type Event struct {
+	// ID is the same for every attempt to deliver the event
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	OrderID   uint      `json:"order_id"`
+	// Sequence numbers the events of one order from 1
+	Sequence int    `json:"sequence"`
+	Actor    string `json:"actor"`
+	// Data holds the order fields the event set, as in the order's history
+	Data json.RawMessage `json:"data"`
+}
+
+// Sign returns the signature of body sent at timestamp under secret, as it
+// appears in the X-Webhook-Signature header
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verifier checks deliveries against a subscription's secrets
+type Verifier struct {
+	secrets   []string
+	tolerance time.Duration
+	now       func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewVerifier accepts deliveries signed with any of secrets. Pass the
+// previous secret as well while switching to a rotated one; empty secrets
+// are ignored, so an unset one never verifies anything.
+func NewVerifier(secrets ...string) *Verifier {
+	var set []string
+	for _, secret := range secrets {
+		if secret != "" {
+			set = append(set, secret)
+		}
+	}
+	return &Verifier{
+		secrets:   set,
+		tolerance: DefaultTolerance,
+		now:       time.Now,
+		seen:      make(map[string]time.Time),
+	}
+}
+
+// WithTolerance changes how far a timestamp may be from now
+func (v *Verifier) WithTolerance(tolerance time.Duration) *Verifier {
+	v.tolerance = tolerance
+	return v
+}
+
+// WithClock replaces time.Now, for tests
+func (v *Verifier) WithClock(now func() time.Time) *Verifier {
+	v.now = now
+	return v
+}
+
+// Verify checks the signature and timestamp of a delivery and that its id
+// was not verified before within the tolerance. A delivery that fails
+// verification is not remembered, so the API's retry is still accepted.
+func (v *Verifier) Verify(header http.Header, body []byte) error {
+	id := header.Get(IDHeader)
+	timestamp := header.Get(TimestampHeader)
+	signatures := header.Get(SignatureHeader)
+	if id == "" || timestamp == "" || signatures == "" {
+		return ErrMissingHeaders
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	signedAt := time.Unix(unix, 0)
+	now := v.now()
+	if signedAt.Before(now.Add(-v.tolerance)) || signedAt.After(now.Add(v.tolerance)) {
+		return ErrTooOld
+	}
+
+	if !v.signed(signatures, signedAt, body) {
+		return ErrInvalidSignature
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for seenID, at := range v.seen {
+		if now.Sub(at) > 2*v.tolerance {
+			delete(v.seen, seenID)
+		}
+	}
+	if _, ok := v.seen[id]; ok {
+		return ErrReplayed
+	}
+	v.seen[id] = now
+	return nil
+}
+
+func (v *Verifier) signed(signatures string, signedAt time.Time, body []byte) bool {
+	for _, secret := range v.secrets {
+		expected := Sign(secret, signedAt, body)
+		for _, signature := range strings.Split(signatures, ",") {
+			if hmac.Equal([]byte(strings.TrimSpace(signature)), []byte(expected)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Handler verifies deliveries before passing their events to handle. It
+// answers 401 to deliveries that fail verification, 200 to repeats without
+// handling them again, and 500 when handle fails, so the API retries.
+func (v *Verifier) Handler(handle func(*http.Request, Event) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+		if err != nil {
+			http.Error(w, "unreadable body", http.StatusBadRequest)
+			return
+		}
+
+		switch err := v.Verify(r.Header, body); {
+		case errors.Is(err, ErrReplayed):
+			w.WriteHeader(http.StatusOK)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var event Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		if err := handle(r, event); err != nil {
+			v.forget(r.Header.Get(IDHeader))
+			http.Error(w, "failed to handle event", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// forget lets a delivery that failed to be handled be verified again when
+// it is retried
+func (v *Verifier) forget(id string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.seen, id)
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signedHeader(id string, at time.Time, body []byte, secrets ...string) http.Header {
+	signatures := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		signatures = append(signatures, Sign(secret, at, body))
+	}
+	header := http.Header{}
+	header.Set(IDHeader, id)
+	header.Set(EventHeader, "order.created")
+	header.Set(TimestampHeader, strconv.FormatInt(at.Unix(), 10))
+	header.Set(SignatureHeader, strings.Join(signatures, ", "))
+	return header
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2026, 3, 11, 7, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	body := []byte(`{"id":"evt_1","type":"order.created"}`)
+
+	t.Run("accepts either secret while rotating", func(t *testing.T) {
+		header := signedHeader("evt_1", now, body, "whsec_new", "whsec_old")
+		assert.NoError(t, NewVerifier("whsec_old").WithClock(clock).Verify(header, body))
+		assert.NoError(t, NewVerifier("whsec_new").WithClock(clock).Verify(header, body))
+		assert.ErrorIs(t, NewVerifier("whsec_other").WithClock(clock).Verify(header, body), ErrInvalidSignature)
+	})
+
+	t.Run("ignores empty secrets", func(t *testing.T) {
+		header := signedHeader("evt_1", now, body, "")
+		assert.ErrorIs(t, NewVerifier("whsec_new", "").WithClock(clock).Verify(header, body), ErrInvalidSignature)
+	})
+
+	t.Run("rejects a changed body", func(t *testing.T) {
+		header := signedHeader("evt_1", now, body, "whsec_new")
+		err := NewVerifier("whsec_new").WithClock(clock).Verify(header, []byte(`{"id":"evt_1","type":"order.deleted"}`))
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("rejects stale and malformed timestamps", func(t *testing.T) {
+		verifier := NewVerifier("whsec_new").WithClock(clock)
+		assert.ErrorIs(t, verifier.Verify(signedHeader("evt_1", now.Add(-6*time.Minute), body, "whsec_new"), body), ErrTooOld)
+		assert.ErrorIs(t, verifier.Verify(signedHeader("evt_1", now.Add(6*time.Minute), body, "whsec_new"), body), ErrTooOld)
+		assert.NoError(t, verifier.WithTolerance(10*time.Minute).Verify(signedHeader("evt_1", now.Add(-6*time.Minute), body, "whsec_new"), body))
+
+		header := signedHeader("evt_2", now, body, "whsec_new")
+		header.Set(TimestampHeader, "yesterday")
+		assert.ErrorIs(t, verifier.Verify(header, body), ErrInvalidTimestamp)
+		assert.ErrorIs(t, verifier.Verify(http.Header{}, body), ErrMissingHeaders)
+	})
+
+	t.Run("rejects replays until they are forgotten", func(t *testing.T) {
+		verifier := NewVerifier("whsec_new").WithClock(clock)
+		header := signedHeader("evt_1", now, body, "whsec_new")
+		require.NoError(t, verifier.Verify(header, body))
+		assert.ErrorIs(t, verifier.Verify(header, body), ErrReplayed)
+
+		// a retry signed later is still the same event
+		assert.ErrorIs(t, verifier.Verify(signedHeader("evt_1", now.Add(time.Minute), body, "whsec_new"), body), ErrReplayed)
+
+		now = now.Add(11 * time.Minute)
+		assert.NoError(t, verifier.Verify(signedHeader("evt_1", now, body, "whsec_new"), body))
+	})
+}
+
+func TestHandler(t *testing.T) {
+	now := time.Date(2026, 3, 11, 7, 0, 0, 0, time.UTC)
+	body := `{"id":"evt_7","type":"order.status_changed","order_id":3,"sequence":2,"data":{"status":"shipped"}}`
+
+	var handled []Event
+	fail := true
+	handler := NewVerifier("whsec_new").WithClock(func() time.Time { return now }).Handler(func(r *http.Request, event Event) error {
+		if fail {
+			return errors.New("database down")
+		}
+		handled = append(handled, event)
+		return nil
+	})
+	deliver := func(header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/orders", strings.NewReader(body))
+		req.Header = header
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	header := signedHeader("evt_7", now, []byte(body), "whsec_new")
+
+	assert.Equal(t, http.StatusUnauthorized, deliver(signedHeader("evt_7", now, []byte(body), "whsec_other")))
+	assert.Equal(t, http.StatusInternalServerError, deliver(header))
+
+	fail = false
+	assert.Equal(t, http.StatusOK, deliver(header))
+	assert.Equal(t, http.StatusOK, deliver(header))
+	require.Len(t, handled, 1)
+	assert.Equal(t, "evt_7", handled[0].ID)
+	assert.Equal(t, uint(3), handled[0].OrderID)
+	assert.JSONEq(t, `{"status":"shipped"}`, string(handled[0].Data))
+}